@@ -7,6 +7,8 @@ readonly GO_VERSION=$(cat .go-version)
 
 DOCKER_IMAGES="centos/systemd:latest
 alehaa/debian-systemd:stretch
+jrei/systemd-ubuntu:20.04
+robertdebock/amazonlinux:2
 docker.elastic.co/observability-ci/picklesdoc:2.20.1
 golang:${GO_VERSION}-stretch
 "
@@ -15,6 +15,10 @@ set -euxo pipefail
 #   - STACK_VERSION - that's the version of the stack to be tested. Default '8.0.0-SNAPSHOT'.
 #   - METRICBEAT_VERSION - that's the version of the metricbeat to be tested. Default '8.0.0-SNAPSHOT'.
 #
+# Environment variables:
+#   - SCENARIO_RETRIES - number of times the failed scenarios are retried. Default '0'.
+#   - PARALLEL - number of workers running the scenarios in parallel. Default '1'.
+#
 
 SUITE=${1:-''}
 TAGS=${2:-''}
@@ -36,6 +40,8 @@ if ! SUITE=${SUITE} TAGS="${TAGS}" FORMAT=junit STACK_VERSION=${STACK_VERSION} M
   exit_status=1
 fi
 
-## Transform report to Junit by parsing the stdout generated previously
-sed -e 's/^[ \t]*//; s#>.*failed$#>#g' ${REPORT} | grep -E '^<.*>$' > ${REPORT}.xml
+## Transform report to Junit by parsing the stdout generated previously.
+## Each retry attempt of the failed scenarios generates its own report.
+sed -e 's/^[ \t]*//; s#>.*failed$#>#g' ${REPORT} | grep -E '^<.*>$' \
+  | awk -v report="${REPORT}" '/^<\?xml/ { n++ } { print > (n <= 1 ? report ".xml" : report "-retry-" (n - 1) ".xml") }'
 exit $exit_status
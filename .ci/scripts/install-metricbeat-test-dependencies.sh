@@ -11,6 +11,7 @@ set -euxo pipefail
 # Parameters:
 #   - GOOS - that's the name of the O.S. used to build the binary
 #   - GOARCH - that's the name of the architecture of the O.S. used to build the binary.
+#   - METRICBEAT_VERSION - that's the version of the metricbeat to be tested, whose integrations are synced.
 #
 
 TARGET_OS=${GOOS:-linux}
@@ -19,5 +20,5 @@ TARGET_ARCH=${GOARCH:-amd64}
 # Build OP Binary
 GOOS=${TARGET_OS} GOARCH=${TARGET_ARCH} make -C e2e fetch-binary
 
-# Sync integrations
-make -C e2e sync-integrations
+# Sync the integrations of the version of metricbeat under test
+make -C e2e sync-integrations BEATS_VERSION="${METRICBEAT_VERSION:-}"
@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var checkAsJSON = false
+var checkMinDiskSpace = "10g"
+var checkMinMemory = "4g"
+var checkProfile = "fleet"
+
+func init() {
+	config.InitConfig()
+
+	checkCmd.Flags().BoolVarP(&checkAsJSON, "json", "j", false, "Prints the results of the checks as JSON, for scripting (default false)")
+	checkCmd.Flags().StringVarP(&checkMinDiskSpace, "min-disk", "", checkMinDiskSpace, "Sets the min free space of the disk of the Docker daemon")
+	checkCmd.Flags().StringVarP(&checkMinMemory, "min-memory", "", checkMinMemory, "Sets the min memory available to the Docker daemon")
+	checkCmd.Flags().StringVarP(&checkProfile, "profile", "p", checkProfile, "Sets the profile whose ports and registries are checked, none if empty")
+
+	rootCmd.AddCommand(checkCmd)
+}
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Validates that the host can run the Profiles and the test suites",
+	Long: `Validates that the host can run the Profiles and the test suites before running them: the Docker
+daemon is reachable in a supported version, docker-compose is available, there is enough memory and disk,
+the vm.max_map_count of the kernel fits Elasticsearch, the ports published by the Profile are free, and
+there are credentials for the registries of its images. It prints how to fix each issue, and fails if
+a check fails`,
+	Run: func(cmd *cobra.Command, args []string) {
+		minDiskSpace, err := units.RAMInBytes(checkMinDiskSpace)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"min-disk": checkMinDiskSpace,
+			}).Fatal("The min free space of the disk is not valid, i.e. 10g")
+		}
+
+		minMemory, err := units.RAMInBytes(checkMinMemory)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"min-memory": checkMinMemory,
+			}).Fatal("The min memory is not valid, i.e. 4g")
+		}
+
+		results := services.RunPreflightChecks(services.PreflightOptions{
+			MinDiskSpace: minDiskSpace,
+			MinMemory:    minMemory,
+			Profile:      checkProfile,
+		})
+
+		if checkAsJSON {
+			bytes, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("Could not marshal the results of the checks")
+			}
+
+			fmt.Println(string(bytes))
+		} else {
+			printCheckTable(results)
+		}
+
+		for _, result := range results {
+			if result.Status == services.CheckFailed {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// printCheckTable prints the results of the checks as a table, with the remediation of each issue
+// below it
+func printCheckTable(results []services.CheckResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tMESSAGE")
+
+	for _, result := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", result.Check, result.Status, result.Message)
+		if result.Remediation != "" {
+			fmt.Fprintf(w, "\t\t→ %s\n", result.Remediation)
+		}
+	}
+
+	_ = w.Flush()
+}
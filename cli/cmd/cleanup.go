@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var cleanupOptions = services.CleanupOptions{}
+
+func init() {
+	config.InitConfig()
+
+	cleanupCmd.Flags().BoolVarP(&cleanupOptions.DryRun, "dry-run", "n", false, "Lists the resources which would be removed, without removing them (default false)")
+	cleanupCmd.Flags().DurationVarP(&cleanupOptions.OlderThan, "older-than", "o", 0, "Removes only the resources created before, i.e. 2h (default all of them)")
+	cleanupCmd.Flags().StringVarP(&cleanupOptions.RunID, "run-id", "r", "", "Removes only the resources of a run (default all the runs)")
+	cleanupCmd.Flags().StringVarP(&cleanupOptions.Suite, "suite", "s", "", "Removes only the resources of a test suite, i.e. fleet (default all the suites)")
+
+	rootCmd.AddCommand(cleanupCmd)
+}
+
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Removes the resources left behind by previous runs",
+	Long: `Removes the Docker containers, networks and volumes created by previous runs, i.e. interrupted CI
+jobs, which are identified by the labels of the run, the test suite and the scenario which created
+them, so that they do not leak onto shared workers. The resources of the current run, set in the
+OP_RUN_ID env var, are never removed`,
+	Run: func(cmd *cobra.Command, args []string) {
+		orphans, err := services.Cleanup(cleanupOptions)
+		if len(orphans) > 0 {
+			printOrphansTable(orphans, time.Now())
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not clean up the resources of previous runs")
+		}
+
+		if len(orphans) == 0 {
+			fmt.Println("There are no resources left behind by previous runs")
+		}
+	},
+}
+
+// printOrphansTable prints the resources of previous runs as a table, with a row per resource
+func printOrphansTable(orphans []services.OrphanResource, now time.Time) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAME\tRUN ID\tSUITE\tSCENARIO\tAGE")
+
+	for _, orphan := range orphans {
+		age := ""
+		if !orphan.Created.IsZero() {
+			age = now.Sub(orphan.Created).Round(time.Second).String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", orphan.Kind, orphan.Name, orphan.RunID, orDash(orphan.Suite), orDash(orphan.Scenario), orDash(age))
+	}
+
+	_ = w.Flush()
+}
@@ -0,0 +1,161 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var configAsJSON = false
+
+func init() {
+	config.InitConfig()
+
+	configViewCmd.Flags().BoolVarP(&configAsJSON, "json", "j", false, "Prints the configuration as JSON, for scripting (default false)")
+
+	for _, setting := range config.GetEffectiveSettings() {
+		configSetCmd.Long += fmt.Sprintf("\n  - %s: %s (%s)", setting.Key, config.Settings[setting.Key].Description, setting.EnvVar)
+	}
+
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configSetCmd)
+
+	rootCmd.AddCommand(configCmd)
+}
+
+// effectiveConfig the configuration in effect of the tool, printed by the view command
+type effectiveConfig struct {
+	ConfigFile string                    `json:"configFile"`
+	Profiles   map[string]string         `json:"profiles"` // the path of the compose file, by profile
+	Services   map[string]string         `json:"services"` // the path of the compose file, by service
+	Settings   []config.EffectiveSetting `json:"settings"`
+	Workspace  string                    `json:"workspace"`
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Shows and sets the configuration of the workspace",
+	Long: `Shows the configuration in effect of the tool, and sets the persistent defaults stored in the
+config file of the workspace, which the environment variables override`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// NOOP
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Shows the configuration in effect",
+	Long: `Shows the configuration in effect of the tool: the workspace, the profiles and the services
+discovered, and the value of each setting, with where it comes from: the environment, the config
+file of the workspace, or the default`,
+	Run: func(cmd *cobra.Command, args []string) {
+		effective := effectiveConfig{
+			ConfigFile: config.GetConfigFile(),
+			Profiles:   map[string]string{},
+			Services:   map[string]string{},
+			Settings:   config.GetEffectiveSettings(),
+			Workspace:  config.Op.Workspace,
+		}
+
+		for name, profile := range config.AvailableProfiles() {
+			effective.Profiles[name] = profile.Path
+		}
+		for name, service := range config.AvailableServices() {
+			effective.Services[name] = service.Path
+		}
+
+		if configAsJSON {
+			bytes, err := json.MarshalIndent(effective, "", "  ")
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("Could not marshal the configuration")
+			}
+
+			fmt.Println(string(bytes))
+			return
+		}
+
+		printConfig(effective)
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY [VALUE]",
+	Short: "Sets a persistent default in the config file of the workspace",
+	Long: `Sets a persistent default in the config file of the workspace, removing it if no value is
+passed, so that its default applies again. The environment variable of a setting overrides it.
+The settings are:`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+		value := ""
+		if len(args) > 1 {
+			value = args[1]
+		}
+
+		err := config.SetSetting(config.Op.Workspace, key, value)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"setting": key,
+			}).Fatal("Could not set the setting")
+		}
+
+		if value == "" {
+			fmt.Printf("%s was removed from %s\n", key, config.GetConfigFile())
+			return
+		}
+
+		fmt.Printf("%s=%s was stored in %s\n", key, value, config.GetConfigFile())
+	},
+}
+
+// printConfig prints the configuration in effect as tables: the settings, the profiles and the services
+func printConfig(effective effectiveConfig) {
+	fmt.Printf("Workspace:   %s\n", effective.Workspace)
+	fmt.Printf("Config file: %s\n\n", effective.ConfigFile)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE\tENV VAR")
+	for _, setting := range effective.Settings {
+		value := setting.Value
+		if value == "" {
+			value = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", setting.Key, value, setting.Source, setting.EnvVar)
+	}
+	fmt.Fprintln(w)
+
+	printPaths(w, "PROFILE", effective.Profiles)
+	fmt.Fprintln(w)
+	printPaths(w, "SERVICE", effective.Services)
+
+	w.Flush()
+}
+
+// printPaths prints the paths of the compose files of the profiles or the services, sorted by name
+func printPaths(w *tabwriter.Writer, header string, paths map[string]string) {
+	names := []string{}
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "%s\tPATH\n", header)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, paths[name])
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var destroyOptions = services.TeardownOptions{}
+
+func init() {
+	config.InitConfig()
+
+	destroyCmd.Flags().BoolVarP(&destroyOptions.All, "all", "a", false, "Destroys all the services of the profile, or of all the running profiles and services if no profile is set")
+	destroyCmd.Flags().StringVarP(&destroyOptions.Profile, "profile", "s", "", "Sets the running profile of the services. If not set, the service must be running on its own")
+
+	rootCmd.AddCommand(destroyCmd)
+}
+
+var destroyCmd = &cobra.Command{
+	Use:   "destroy [service...]",
+	Short: "Destroys Services of a running Profile, or running Services",
+	Long: `Destroys the Services of a running Profile, or a Service running on its own, removing their Docker
+containers with their volumes, and resolving them from the state of the workspace. The state of a
+Profile is destroyed once all its Services are, i.e. op destroy --profile fleet --all`,
+	Args: cobra.ArbitraryArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 && !destroyOptions.All {
+			_ = cmd.Help()
+			return
+		}
+
+		err := services.DestroyServices(args, destroyOptions)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"all":      destroyOptions.All,
+				"error":    err,
+				"profile":  destroyOptions.Profile,
+				"services": args,
+			}).Fatal("Could not destroy the services")
+		}
+	},
+}
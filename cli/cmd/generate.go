@@ -0,0 +1,108 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	git "github.com/elastic/e2e-testing/cli/internal"
+	scaffold "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var beatsDir = ""
+var forceGenerate = false
+var generateRemote = "elastic:master"
+var metricbeatSuiteDir = filepath.Join("e2e", "_suites", "metricbeat")
+var servicesDir = filepath.Join("cli", "config", "compose", "services")
+
+func init() {
+	config.InitConfig()
+
+	generateModuleTestCmd.Flags().StringVarP(&beatsDir, "beats-dir", "b", "", "Sets the dir of a checkout of the Beats repository, which is cloned into the workspace if empty")
+	generateModuleTestCmd.Flags().BoolVarP(&forceGenerate, "force", "f", false, "Overwrites the existing files of the module (default false)")
+	generateModuleTestCmd.Flags().StringVarP(&generateRemote, "remote", "r", "elastic:master", "Sets the remote for Beats, using 'user:branch' as format (i.e. elastic:master)")
+	generateModuleTestCmd.Flags().StringVarP(&servicesDir, "services-dir", "s", servicesDir, "Sets the dir where the compose file of the service of the module is written")
+	generateModuleTestCmd.Flags().StringVarP(&metricbeatSuiteDir, "suite-dir", "d", metricbeatSuiteDir, "Sets the dir of the metricbeat suite, where the configuration and the feature file of the module are written")
+
+	generateCmd.AddCommand(generateModuleTestCmd)
+	rootCmd.AddCommand(generateCmd)
+}
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generates the files of new tests",
+	Long:  "Subcommands will allow scaffolding the files of new tests",
+	Run: func(cmd *cobra.Command, args []string) {
+		// NOOP
+	},
+}
+
+var generateModuleTestCmd = &cobra.Command{
+	Use:   "module-test <module>",
+	Short: "Generates the integration tests of a metricbeat module",
+	Long: `Generates the integration tests of a metricbeat module, reading its metadata from the Beats repository:
+the compose file of the service of the module, the configuration of metricbeat monitoring the service, and
+a feature file with an example for each version and variant of the service supported by the module`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("the name of the metricbeat module is required, i.e. redis")
+		}
+
+		arr := strings.Split(generateRemote, ":")
+		if len(arr) == 2 {
+			return nil
+		}
+		return errors.New("invalid 'user:branch' format: " + generateRemote + ". Example: 'elastic:master'")
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		module := strings.ToLower(args[0])
+
+		dir := beatsDir
+		if dir == "" {
+			workspace := config.Op.Workspace
+
+			// BeatsRepo default object representing Beats project
+			var BeatsRepo = git.ProjectBuilder.
+				WithBaseWorkspace(path.Join(workspace, "git")).
+				WithDomain("github.com").
+				WithName("beats").
+				WithRemote(generateRemote).
+				Build()
+
+			git.Clone(BeatsRepo)
+
+			dir = BeatsRepo.GetWorkspace()
+		}
+
+		metadata, err := scaffold.ReadModuleMetadata(dir, module)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"beatsDir": dir,
+				"error":    err,
+				"module":   module,
+			}).Fatal("Could not read the metadata of the module")
+		}
+
+		files, err := scaffold.ScaffoldModuleTest(metadata, servicesDir, metricbeatSuiteDir, forceGenerate)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":  err,
+				"module": module,
+			}).Fatal("Could not generate the tests of the module")
+		}
+
+		log.WithFields(log.Fields{
+			"files":    files,
+			"module":   module,
+			"variants": len(metadata.Variants),
+		}).Info("The tests of the module were generated. Run them with the 'integrations && " + module + "' tags of the metricbeat suite, adding them to .ci/.e2e-tests.yaml")
+	},
+}
@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	lint "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var strictLint = false
+var suitesDir = filepath.Join("e2e", "_suites")
+
+func init() {
+	lintFeaturesCmd.Flags().BoolVarP(&strictLint, "strict", "s", false, "Fails on warnings too, i.e. unused step definitions (default false)")
+	lintFeaturesCmd.Flags().StringVarP(&suitesDir, "suites-dir", "d", suitesDir, "Sets the dir where the test suites are looked up when no suite is passed")
+
+	rootCmd.AddCommand(lintFeaturesCmd)
+}
+
+var lintFeaturesCmd = &cobra.Command{
+	Use:   "lint-features [suite dirs]",
+	Short: "Lints the feature files of the test suites",
+	Long: `Lints the feature files of the test suites, matching their steps against the step definitions
+registered by the Go code of each suite, and reporting the undefined steps, which would be pending
+in the runs, the duplicated, ambiguous and unused step definitions, and the inconsistencies of the tags.
+It fails if there are errors, or warnings in strict mode`,
+	Run: func(cmd *cobra.Command, args []string) {
+		suites := args
+		if len(suites) == 0 {
+			suites = findSuites(suitesDir)
+		}
+
+		if len(suites) == 0 {
+			log.WithFields(log.Fields{
+				"dir": suitesDir,
+			}).Fatal("There are no test suites to lint")
+		}
+
+		errors := 0
+		warnings := 0
+		for _, suite := range suites {
+			issues, err := lint.LintFeatures(suite)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+					"suite": suite,
+				}).Fatal("Could not lint the feature files of the suite")
+			}
+
+			for _, issue := range issues {
+				fmt.Printf("%s: %s\n", suite, issue)
+
+				if issue.Severity == lint.LintError {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+		}
+
+		fields := log.Fields{
+			"errors":   errors,
+			"suites":   len(suites),
+			"warnings": warnings,
+		}
+
+		if errors > 0 || (strictLint && warnings > 0) {
+			log.WithFields(fields).Error("The feature files have issues")
+			os.Exit(1)
+		}
+
+		log.WithFields(fields).Info("The feature files were linted")
+	},
+}
+
+// findSuites returns the dirs of the test suites, which contain a features dir
+func findSuites(dir string) []string {
+	featureDirs, err := filepath.Glob(filepath.Join(dir, "*", "features"))
+	if err != nil {
+		return []string{}
+	}
+
+	suites := []string{}
+	for _, featureDir := range featureDirs {
+		suites = append(suites, filepath.Dir(featureDir))
+	}
+
+	return suites
+}
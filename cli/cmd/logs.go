@@ -0,0 +1,77 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var logsFilter string
+var logsOptions = services.LogsOptions{}
+var logsProfile string
+
+func init() {
+	config.InitConfig()
+
+	logsCmd.Flags().StringVarP(&logsProfile, "profile", "s", "", "Sets the running profile of the services. If not set, the service must be running on its own")
+	logsCmd.Flags().BoolVarP(&logsOptions.Follow, "follow", "f", false, "Follows the logs until interrupted")
+	logsCmd.Flags().StringVar(&logsOptions.Since, "since", "", "Shows the logs since a timestamp (i.e. 2021-01-02T13:23:37) or relative (i.e. 5m)")
+	logsCmd.Flags().StringVar(&logsOptions.Tail, "tail", "all", "Sets the number of lines to show from the end of the logs of each container")
+	logsCmd.Flags().BoolVarP(&logsOptions.Timestamps, "timestamps", "t", false, "Shows the timestamps of the lines")
+	logsCmd.Flags().StringVarP(&logsFilter, "filter", "g", "", "Shows only the lines matching a regular expression, i.e. 'ERROR|WARN'")
+
+	rootCmd.AddCommand(logsCmd)
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs [services]",
+	Short: "Shows the logs of the Services of a running Profile, or of a running Service",
+	Long: `Shows the logs of the Services of a running Profile, or of a Service running on its own, resolving
+their Docker containers from the state of the workspace, so that there is no need to know the paths of the
+docker-compose files. All the Services of the Profile are shown if no Service is passed`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if logsFilter == "" {
+			return nil
+		}
+
+		filter, err := regexp.Compile(logsFilter)
+		if err != nil {
+			return err
+		}
+
+		logsOptions.Filter = filter
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// an interrupt stops following the logs
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			cancel()
+		}()
+
+		err := services.StreamLogs(ctx, logsProfile, args, logsOptions, os.Stdout)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"profile":  logsProfile,
+				"services": args,
+			}).Fatal("Could not show the logs")
+		}
+	},
+}
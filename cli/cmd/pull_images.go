@@ -0,0 +1,83 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var pullImagesOutput string
+var pullImagesProfile = "fleet"
+var pullImagesServices string
+var pullImagesVersion string
+
+func init() {
+	config.InitConfig()
+
+	pullImagesCmd.Flags().StringVarP(&pullImagesOutput, "output", "o", "", "Writes the lockfile to a path, besides printing it")
+	pullImagesCmd.Flags().StringVarP(&pullImagesProfile, "profile", "p", pullImagesProfile, "Sets the profile whose images are pulled")
+	pullImagesCmd.Flags().StringVarP(&pullImagesServices, "withServices", "s", "", "Sets a list of comma-separated services whose images are pulled alongside the profile")
+	pullImagesCmd.Flags().StringVarP(&pullImagesVersion, "version", "v", shell.GetEnv("STACK_VERSION", ""), "Sets the version of the stack, or an alias of the latest version of a minor, i.e. 8.0-SNAPSHOT")
+
+	rootCmd.AddCommand(pullImagesCmd)
+}
+
+var pullImagesCmd = &cobra.Command{
+	Use:   "pull-images",
+	Short: "Pulls the images of a Profile in an exact version of the stack, printing their lockfile",
+	Long: `Resolves a version of the stack, or an alias of the latest version of a minor, i.e. 8.0-SNAPSHOT,
+into the exact version with the artifacts API, including the latest build of the snapshots, and pulls the
+images of a Profile in that version. It prints a lockfile pinning the images by their digest, which the
+Profiles and the test suites run when its path is set in the OP_IMAGES_LOCKFILE environment variable, so
+that the runs are reproducible even if the tags of the snapshots move`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if pullImagesVersion == "" {
+			log.Fatal("There is no version of the stack to resolve, set it with the --version flag or the STACK_VERSION environment variable")
+		}
+
+		composeNames := []string{}
+		for _, srv := range strings.Split(pullImagesServices, ",") {
+			if srv = strings.TrimSpace(srv); srv != "" {
+				composeNames = append(composeNames, srv)
+			}
+		}
+
+		lock, err := services.LockImages(pullImagesProfile, composeNames, pullImagesVersion, map[string]string{})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": pullImagesProfile,
+				"version": pullImagesVersion,
+			}).Fatal("Could not pull the images of the profile")
+		}
+
+		bytes, err := lock.Marshal()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not marshal the lockfile of the images")
+		}
+
+		if pullImagesOutput != "" {
+			err = io.WriteFile(bytes, pullImagesOutput)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":  err,
+					"output": pullImagesOutput,
+				}).Fatal("Could not write the lockfile of the images")
+			}
+		}
+
+		fmt.Print(string(bytes))
+	},
+}
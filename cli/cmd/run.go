@@ -6,16 +6,20 @@ package cmd
 
 import (
 	"strings"
+	"time"
 
 	"github.com/elastic/e2e-testing/cli/config"
 	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/cobra"
 )
 
+var composeProfilesToRun string
 var servicesToRun string
 var versionToRun string
+var waitTimeout time.Duration
 
 func init() {
 	config.InitConfig()
@@ -26,6 +30,7 @@ func init() {
 		serviceSubcommand := buildRunServiceCommand(k)
 
 		serviceSubcommand.Flags().StringVarP(&versionToRun, "version", "v", "latest", "Sets the image version to run")
+		serviceSubcommand.Flags().DurationVarP(&waitTimeout, "wait", "w", 0, "Waits for the service to be healthy, up to a timeout, i.e. 5m (default: not waiting)")
 
 		runServiceCmd.AddCommand(serviceSubcommand)
 	}
@@ -37,6 +42,8 @@ func init() {
 
 		profileSubcommand.Flags().StringVarP(&versionToRun, "profileVersion", "v", "latest", "Sets the profile version to run")
 		profileSubcommand.Flags().StringVarP(&servicesToRun, "withServices", "s", "", "Sets a list of comma-separated services to be depoyed alongside the profile")
+		profileSubcommand.Flags().StringVarP(&composeProfilesToRun, "composeProfiles", "c", "", "Sets a list of comma-separated profiles of the compose file to activate, running their services, i.e. fleet-server,apm-server")
+		profileSubcommand.Flags().DurationVarP(&waitTimeout, "wait", "w", 0, "Waits for the services of the profile to be healthy, up to a timeout, i.e. 5m (default: not waiting)")
 
 		runProfileCmd.AddCommand(profileSubcommand)
 	}
@@ -68,6 +75,11 @@ func buildRunServiceCommand(srv string) *cobra.Command {
 				log.WithFields(log.Fields{
 					"service": srv,
 				}).Error("Could not run the service.")
+				return
+			}
+
+			if waitTimeout > 0 {
+				_ = serviceManager.WaitForHealthy(srv, []string{}, services.WaitOptions{Timeout: waitTimeout})
 			}
 		},
 	}
@@ -84,6 +96,35 @@ func buildRunProfileCommand(key string, profile config.Profile) *cobra.Command {
 			env := map[string]string{
 				"profileVersion": versionToRun,
 			}
+			// the version of the stack in the environment, or in the config file of the workspace
+			if stackVersion := shell.GetEnv("STACK_VERSION", ""); stackVersion != "" {
+				env["stackVersion"] = stackVersion
+			}
+			if composeProfilesToRun != "" {
+				env[config.ComposeProfilesKey] = composeProfilesToRun
+			}
+
+			if config.IsSecuredProfile(key) {
+				_, err := config.GenerateCerts()
+				if err != nil {
+					log.WithFields(log.Fields{
+						"profile": key,
+					}).Error("Could not generate the certificates of the profile.")
+					return
+				}
+			}
+
+			if config.IsClusterProfile(key) {
+				var err error
+				env, err = config.PutClusterEnvironment(env)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"error":   err,
+						"profile": key,
+					}).Error("Could not configure the Elasticsearch cluster of the profile.")
+					return
+				}
+			}
 
 			err := serviceManager.RunCompose(true, []string{key}, env)
 			if err != nil {
@@ -113,6 +154,10 @@ func buildRunProfileCommand(key string, profile config.Profile) *cobra.Command {
 					}).Error("Could not add services to the profile.")
 				}
 			}
+
+			if waitTimeout > 0 {
+				_ = serviceManager.WaitForHealthy(key, []string{}, services.WaitOptions{Timeout: waitTimeout})
+			}
 		},
 	}
 }
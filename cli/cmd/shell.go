@@ -0,0 +1,45 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var shellOptions = services.ShellOptions{}
+var shellProfile string
+
+func init() {
+	config.InitConfig()
+
+	shellCmd.Flags().StringVarP(&shellProfile, "profile", "s", "", "Sets the running profile of the service. If not set, the service must be running on its own")
+	shellCmd.Flags().StringVarP(&shellOptions.User, "user", "u", "", "Sets the user running the shell, i.e. root")
+
+	rootCmd.AddCommand(shellCmd)
+}
+
+var shellCmd = &cobra.Command{
+	Use:   "shell service [-- command]",
+	Short: "Opens an interactive shell in a Service of a running Profile, or in a running Service",
+	Long: `Opens an interactive shell in the Docker container of a Service of a running Profile, or of a Service
+running on its own, resolving the container from the state of the workspace, for debugging. A command
+can be run instead of the shell, passing it after '--', i.e. op shell --profile fleet elastic-agent -- elastic-agent status`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		shellOptions.Command = args[1:]
+
+		err := services.OpenShell(shellProfile, args[0], shellOptions)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": shellProfile,
+				"service": args[0],
+			}).Fatal("Could not open the shell")
+		}
+	},
+}
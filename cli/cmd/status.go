@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var statusAsJSON = false
+
+func init() {
+	config.InitConfig()
+
+	statusCmd.Flags().BoolVarP(&statusAsJSON, "json", "j", false, "Prints the status as JSON, for scripting (default false)")
+
+	rootCmd.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the running Profiles and Services",
+	Long: `Shows the Profiles and Services started by the tool, as persisted in the state of the workspace,
+inspecting their Docker containers: the version, the state and health, the published ports and the
+uptime of each Service`,
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := services.GetStatus()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not get the status of the Profiles and Services")
+		}
+
+		if statusAsJSON {
+			bytes, err := json.MarshalIndent(statuses, "", "  ")
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+				}).Fatal("Could not marshal the status of the Profiles and Services")
+			}
+
+			fmt.Println(string(bytes))
+			return
+		}
+
+		if len(statuses) == 0 {
+			fmt.Println("There are no Profiles or Services started by the tool")
+			return
+		}
+
+		printStatusTable(statuses)
+	},
+}
+
+// printStatusTable prints the status of the runs as a table, with a row per container
+func printStatusTable(statuses []services.RunStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PROFILE\tPROJECT\tSERVICE\tVERSION\tSTATE\tPORTS\tUPTIME")
+
+	for _, status := range statuses {
+		profile := status.Profile
+		if profile == "" {
+			profile = "-"
+		}
+
+		if len(status.Services) == 0 {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\tno containers\t-\t-\n", profile, status.Project)
+			continue
+		}
+
+		for _, service := range status.Services {
+			state := service.State
+			if service.Health != "" {
+				state += " (" + service.Health + ")"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", profile, status.Project, service.Name, orDash(service.Version), state, orDash(strings.Join(service.Ports, ", ")), orDash(service.Uptime))
+		}
+	}
+
+	_ = w.Flush()
+}
+
+// orDash returns a dash for the empty values of the table
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
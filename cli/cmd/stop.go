@@ -12,11 +12,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var stopOptions = services.TeardownOptions{}
 var versionToStop string
 
 func init() {
 	config.InitConfig()
 
+	stopCmd.Flags().BoolVarP(&stopOptions.All, "all", "a", false, "Stops all the services of the profile, or of all the running profiles and services if no profile is set")
+	stopCmd.Flags().StringVarP(&stopOptions.Profile, "profile", "s", "", "Sets the running profile of the services. If not set, the service must be running on its own")
+
 	rootCmd.AddCommand(stopCmd)
 
 	for k := range config.AvailableServices() {
@@ -39,11 +43,27 @@ func init() {
 }
 
 var stopCmd = &cobra.Command{
-	Use:   "stop",
+	Use:   "stop [service...]",
 	Short: "Stops a Service or Profile",
-	Long:  "Stops a Service or Profile, stoppping the Docker containers that expose their internal configuration",
+	Long: `Stops a Service or Profile, stoppping the Docker containers that expose their internal configuration.
+The Services of a running Profile, or a Service running on its own, can be stopped without removing their
+containers, resolving them from the state of the workspace, i.e. op stop --profile fleet kibana`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		// NOOP
+		if len(args) == 0 && !stopOptions.All {
+			_ = cmd.Help()
+			return
+		}
+
+		err := services.StopServices(args, stopOptions)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"all":      stopOptions.All,
+				"error":    err,
+				"profile":  stopOptions.Profile,
+				"services": args,
+			}).Fatal("Could not stop the services")
+		}
 	},
 }
 
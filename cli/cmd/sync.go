@@ -24,12 +24,16 @@ import (
 var deleteRepository = false
 var excludedBlocks = []string{"build"}
 var remote = "elastic:master"
+var syncCommit = ""
+var syncVersion = ""
 
 func init() {
 	config.InitConfig()
 
+	syncIntegrationsCmd.Flags().StringVarP(&syncCommit, "commit", "c", "", "Sets the full hash of the commit of Beats to sync, which must be in the synced branch (default: the head of the branch)")
 	syncIntegrationsCmd.Flags().BoolVarP(&deleteRepository, "delete", "d", false, "Will delete the existing Beats repository before cloning it again (default false)")
 	syncIntegrationsCmd.Flags().StringVarP(&remote, "remote", "r", "elastic:master", "Sets the remote for Beats, using 'user:branch' as format (i.e. elastic:master)")
+	syncIntegrationsCmd.Flags().StringVarP(&syncVersion, "version", "v", "", "Sets the version of Beats under test, syncing its release branch instead of the branch of the remote, i.e. 7.13 for 7.13.0-SNAPSHOT")
 
 	syncCmd.AddCommand(syncIntegrationsCmd)
 	rootCmd.AddCommand(syncCmd)
@@ -47,8 +51,15 @@ var syncCmd = &cobra.Command{
 var syncIntegrationsCmd = &cobra.Command{
 	Use:   "integrations",
 	Short: "Sync services from Beats",
-	Long:  "Sync services from Beats, checking out current version of the services from GitHub",
+	Long: `Sync services from Beats, checking out the services from GitHub: the head of a branch, or a commit, so that the
+metricbeat suite tests the definitions of the modules matching the version of Beats under test`,
 	Args: func(cmd *cobra.Command, args []string) error {
+		if syncVersion != "" {
+			if _, err := git.BranchOfVersion(syncVersion); err != nil {
+				return err
+			}
+		}
+
 		arr := strings.Split(remote, ":")
 		if len(arr) == 2 {
 			return nil
@@ -80,10 +91,53 @@ var syncIntegrationsCmd = &cobra.Command{
 
 		git.Clone(BeatsRepo)
 
+		commit, err := checkoutBeats(BeatsRepo)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"commit":  syncCommit,
+				"error":   err,
+				"remote":  remote,
+				"version": syncVersion,
+			}).Fatal("Could not check out Beats")
+		}
+
 		copyIntegrationsComposeFiles(BeatsRepo, workspace)
+
+		log.WithFields(log.Fields{
+			"commit": commit,
+			"url":    BeatsRepo.GetURL(),
+		}).Info("Integrations synced from Beats")
 	},
 }
 
+// checkoutBeats checks out the commit of Beats to sync, or the head of the release branch of the
+// version under test, falling back to the branch of the remote when the version has no release
+// branch yet, i.e. while it's developed in master. It returns the hash of the checked out commit
+func checkoutBeats(beats git.Project) (string, error) {
+	project := beats
+	if syncVersion != "" {
+		branch, err := git.BranchOfVersion(syncVersion)
+		if err != nil {
+			return "", err
+		}
+		project.Branch = branch
+	}
+
+	commit, err := git.Checkout(project, syncCommit)
+	if err != nil && project.Branch != beats.Branch && syncCommit == "" {
+		log.WithFields(log.Fields{
+			"branch":  project.Branch,
+			"error":   err,
+			"remote":  remote,
+			"version": syncVersion,
+		}).Warn("The release branch of the version could not be checked out, syncing the branch of the remote")
+
+		return git.Checkout(beats, "")
+	}
+
+	return commit, err
+}
+
 // tells whether the a array contains the x string.
 func contains(a []string, x string) bool {
 	for _, n := range a {
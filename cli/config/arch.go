@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	shell "github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchEnvVar the environment variable overriding the architecture of the images of the services
+// and of the packages of the artifacts, which is the one of the host by default
+const ArchEnvVar = "OP_ARCH"
+
+// AMD64 the x86_64 architecture
+const AMD64 = "amd64"
+
+// ARM64 the 64-bits ARM architecture, i.e. Apple Silicon or Graviton
+const ARM64 = "arm64"
+
+// dockerPlatformKey the variable of the platform of the images pulled and run by docker-compose
+const dockerPlatformKey = "DOCKER_DEFAULT_PLATFORM"
+
+// archAliases the names used by other tools for the supported architectures
+var archAliases = map[string]string{
+	"aarch64": ARM64,
+	"amd64":   AMD64,
+	"arm64":   ARM64,
+	"x86_64":  AMD64,
+}
+
+// GetArch returns the architecture of the services and the artifacts: the one set in the OP_ARCH
+// environment variable, or the one of the host, exiting if it's not supported
+func GetArch() string {
+	value := shell.GetEnv(ArchEnvVar, runtime.GOARCH)
+
+	arch, err := normaliseArch(value)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"arch":  value,
+			"error": err,
+		}).Fatal("The architecture is not supported")
+	}
+
+	return arch
+}
+
+// GetArtifactArch returns the architecture in the name of the packages of the artifacts for a
+// package type, as each one follows the naming of its ecosystem:
+// i.e. elastic-agent-8.0.0-SNAPSHOT-aarch64.rpm, elastic-agent-8.0.0-SNAPSHOT-arm64.deb
+// or elastic-agent-8.0.0-SNAPSHOT-linux-arm64.tar.gz
+func GetArtifactArch(extension string) string {
+	return artifactArch(GetArch(), extension)
+}
+
+// GetDockerPlatform returns the platform of the images of the services, i.e. linux/arm64
+func GetDockerPlatform() string {
+	return "linux/" + GetArch()
+}
+
+// PutArchEnvironment puts the platform of the images into the environment of the compose files,
+// so that docker-compose pulls and runs the images of the architecture of the host, or the
+// overriden one, instead of emulating them
+func PutArchEnvironment(env map[string]string) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	if _, exists := env[dockerPlatformKey]; !exists {
+		env[dockerPlatformKey] = GetDockerPlatform()
+	}
+
+	return env
+}
+
+// artifactArch returns the architecture in the name of the packages of an architecture
+// for a package type
+func artifactArch(arch string, extension string) string {
+	switch extension {
+	case "deb":
+		return arch
+	case "rpm":
+		if arch == ARM64 {
+			return "aarch64"
+		}
+		return "x86_64"
+	default:
+		// tar.gz, zip and msi
+		if arch == ARM64 {
+			return ARM64
+		}
+		return "x86_64"
+	}
+}
+
+// normaliseArch returns the supported architecture named by a value, which could be the name
+// used by Go, Docker or the packages
+func normaliseArch(value string) (string, error) {
+	arch, supported := archAliases[strings.ToLower(value)]
+	if !supported {
+		return "", fmt.Errorf("the %s architecture is not supported: use %s or %s", value, AMD64, ARM64)
+	}
+
+	return arch, nil
+}
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifactArch(t *testing.T) {
+	assert.Equal(t, "x86_64", artifactArch(AMD64, "tar.gz"))
+	assert.Equal(t, "x86_64", artifactArch(AMD64, "rpm"))
+	assert.Equal(t, "amd64", artifactArch(AMD64, "deb"))
+	assert.Equal(t, "x86_64", artifactArch(AMD64, "zip"))
+
+	assert.Equal(t, "arm64", artifactArch(ARM64, "tar.gz"))
+	assert.Equal(t, "aarch64", artifactArch(ARM64, "rpm"))
+	assert.Equal(t, "arm64", artifactArch(ARM64, "deb"))
+}
+
+func TestGetArchOverriden(t *testing.T) {
+	os.Setenv(ArchEnvVar, "aarch64")
+	defer os.Unsetenv(ArchEnvVar)
+
+	assert.Equal(t, ARM64, GetArch())
+	assert.Equal(t, "linux/arm64", GetDockerPlatform())
+	assert.Equal(t, "aarch64", GetArtifactArch("rpm"))
+
+	env := PutArchEnvironment(map[string]string{})
+	assert.Equal(t, "linux/arm64", env["DOCKER_DEFAULT_PLATFORM"])
+
+	env = PutArchEnvironment(map[string]string{"DOCKER_DEFAULT_PLATFORM": "linux/amd64"})
+	assert.Equal(t, "linux/amd64", env["DOCKER_DEFAULT_PLATFORM"])
+}
+
+func TestNormaliseArch(t *testing.T) {
+	arch, err := normaliseArch("x86_64")
+	assert.Nil(t, err)
+	assert.Equal(t, AMD64, arch)
+
+	arch, err = normaliseArch("ARM64")
+	assert.Nil(t, err)
+	assert.Equal(t, ARM64, arch)
+
+	_, err = normaliseArch("386")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,195 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// CatalogFileName the name of the file of the workspace describing services without a compose
+// file, i.e. $HOME/.op/catalog.yml
+const CatalogFileName = "catalog.yml"
+
+// catalogHeader the first line of the compose files generated from the catalog, so that they are
+// regenerated when the catalog changes, while the compose files written by hand are never replaced
+const catalogHeader = "# Generated from the " + CatalogFileName + " file of the workspace: edit the catalog instead"
+
+// catalogServiceName the names of the services of the catalog, which are used in the names of the
+// variables of their compose files, i.e. REDIS_VERSION
+var catalogServiceName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// catalog the services described in the catalog of the workspace, by their name
+type catalog struct {
+	Services map[string]catalogService `yaml:"services"`
+}
+
+// catalogService a service described in the catalog of the workspace
+type catalogService struct {
+	Environment map[string]string   `yaml:"environment"`
+	Healthcheck *catalogHealthcheck `yaml:"healthcheck"`
+	Image       string              `yaml:"image"`   // the image without tag, i.e. redis
+	Ports       []string            `yaml:"ports"`   // as in a compose file, i.e. "6379:6379"
+	Version     string              `yaml:"version"` // the tag of the image when no version is passed
+}
+
+// catalogHealthcheck the command checking the health of the container of a service of the catalog
+type catalogHealthcheck struct {
+	Interval string `yaml:"interval"`
+	Retries  int    `yaml:"retries"`
+	Test     string `yaml:"test"` // a shell command, i.e. redis-cli ping
+}
+
+// catalogCompose the compose file generated for a service of the catalog
+type catalogCompose struct {
+	Version  string                           `yaml:"version"`
+	Services map[string]catalogComposeService `yaml:"services"`
+}
+
+// catalogComposeService the service of a compose file generated for a service of the catalog
+type catalogComposeService struct {
+	Environment map[string]string          `yaml:"environment,omitempty"`
+	Healthcheck *catalogComposeHealthcheck `yaml:"healthcheck,omitempty"`
+	Image       string                     `yaml:"image"`
+	Ports       []string                   `yaml:"ports,omitempty"`
+}
+
+// catalogComposeHealthcheck the healthcheck of a compose file generated for a service of the catalog
+type catalogComposeHealthcheck struct {
+	Interval string   `yaml:"interval,omitempty"`
+	Retries  int      `yaml:"retries,omitempty"`
+	Test     []string `yaml:"test"`
+}
+
+// readCatalog generates the compose files of the services described in the catalog of the
+// workspace, under the compose/services dir of the workspace, so that they are available as the
+// services of the workspace, with their run and stop subcommands. The version of a service is read
+// from the SERVICE_VERSION variable, replacing "SERVICE_" with the service name in uppercase. The
+// services bundled in the tool cannot be replaced by the catalog
+func readCatalog(workspace string, bundled map[string]Service) {
+	catalogPath := path.Join(workspace, CatalogFileName)
+
+	found, err := io.Exists(catalogPath)
+	if !found || err != nil {
+		return
+	}
+
+	bytes, err := io.ReadFile(catalogPath)
+	if err != nil {
+		return
+	}
+
+	c := catalog{}
+	err = yaml.Unmarshal(bytes, &c)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"catalog": catalogPath,
+			"error":   err,
+		}).Error("Could not unmarshal the catalog of services")
+		return
+	}
+
+	for name, srv := range c.Services {
+		if _, exists := bundled[name]; exists {
+			log.WithFields(log.Fields{
+				"catalog": catalogPath,
+				"service": name,
+			}).Warn("The service of the catalog is bundled in the tool, skipping it")
+			continue
+		}
+
+		err := writeCatalogComposeFile(workspace, name, srv)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"catalog": catalogPath,
+				"error":   err,
+				"service": name,
+			}).Warn("Could not add the service of the catalog")
+		}
+	}
+}
+
+// newCatalogCompose returns the compose file of a service of the catalog
+func newCatalogCompose(name string, srv catalogService) catalogCompose {
+	version := srv.Version
+	if version == "" {
+		version = "latest"
+	}
+
+	service := catalogComposeService{
+		Environment: srv.Environment,
+		Image:       srv.Image + ":${" + strings.ToUpper(name) + "_VERSION:-" + version + "}",
+		Ports:       srv.Ports,
+	}
+
+	if srv.Healthcheck != nil {
+		service.Healthcheck = &catalogComposeHealthcheck{
+			Interval: srv.Healthcheck.Interval,
+			Retries:  srv.Healthcheck.Retries,
+			Test:     []string{"CMD-SHELL", srv.Healthcheck.Test},
+		}
+	}
+
+	return catalogCompose{
+		Version:  "2.3",
+		Services: map[string]catalogComposeService{name: service},
+	}
+}
+
+// writeCatalogComposeFile writes the compose file of a service of the catalog to the workspace,
+// unless the service already has a compose file which was not generated from the catalog
+func writeCatalogComposeFile(workspace string, name string, srv catalogService) error {
+	if !catalogServiceName.MatchString(name) {
+		return fmt.Errorf("the name must be lowercase letters, digits and underscores")
+	}
+	if srv.Image == "" {
+		return fmt.Errorf("the image is required")
+	}
+	if srv.Healthcheck != nil && srv.Healthcheck.Test == "" {
+		return fmt.Errorf("the test of the healthcheck is required")
+	}
+
+	composeFilePath := path.Join(workspace, "compose", "services", name, "docker-compose.yml")
+
+	found, err := io.Exists(composeFilePath)
+	if found && err == nil {
+		existing, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return err
+		}
+
+		if !strings.HasPrefix(string(existing), catalogHeader) {
+			return fmt.Errorf("the service has a compose file in the workspace")
+		}
+	}
+
+	bytes, err := yaml.Marshal(newCatalogCompose(name, srv))
+	if err != nil {
+		return err
+	}
+
+	err = io.MkdirAll(path.Dir(composeFilePath))
+	if err != nil {
+		return err
+	}
+
+	err = io.WriteFile(append([]byte(catalogHeader+"\n"), bytes...), composeFilePath)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":    composeFilePath,
+		"service": name,
+	}).Trace("Catalog service")
+
+	return nil
+}
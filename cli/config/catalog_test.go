@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"path"
+	"testing"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+const testCatalog = `services:
+  redis:
+    image: redis
+    version: "6.2"
+    ports:
+      - "6379:6379"
+    environment:
+      ALLOW_EMPTY_PASSWORD: "yes"
+    healthcheck:
+      test: redis-cli ping
+      interval: 1s
+      retries: 300
+  kibana:
+    image: kibana
+  invalid-name:
+    image: foo
+`
+
+func TestNewCatalogCompose(t *testing.T) {
+	compose := newCatalogCompose("redis", catalogService{
+		Environment: map[string]string{"ALLOW_EMPTY_PASSWORD": "yes"},
+		Healthcheck: &catalogHealthcheck{Interval: "1s", Retries: 300, Test: "redis-cli ping"},
+		Image:       "redis",
+		Ports:       []string{"6379:6379"},
+		Version:     "6.2",
+	})
+
+	srv := compose.Services["redis"]
+	assert.Equal(t, "2.3", compose.Version)
+	assert.Equal(t, "redis:${REDIS_VERSION:-6.2}", srv.Image)
+	assert.Equal(t, []string{"6379:6379"}, srv.Ports)
+	assert.Equal(t, []string{"CMD-SHELL", "redis-cli ping"}, srv.Healthcheck.Test)
+
+	compose = newCatalogCompose("foo", catalogService{Image: "foo"})
+	assert.Equal(t, "foo:${FOO_VERSION:-latest}", compose.Services["foo"].Image)
+	assert.Nil(t, compose.Services["foo"].Healthcheck)
+}
+
+func TestReadCatalogGeneratesComposeFiles(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	filet.File(t, path.Join(workspace, CatalogFileName), testCatalog)
+
+	readCatalog(workspace, map[string]Service{"kibana": {Name: "kibana"}})
+
+	bytes, err := io.ReadFile(path.Join(workspace, "compose", "services", "redis", "docker-compose.yml"))
+	assert.Nil(t, err)
+
+	compose := catalogCompose{}
+	err = yaml.Unmarshal(bytes, &compose)
+	assert.Nil(t, err)
+	assert.Equal(t, "redis:${REDIS_VERSION:-6.2}", compose.Services["redis"].Image)
+
+	e, _ := io.Exists(path.Join(workspace, "compose", "services", "kibana"))
+	assert.False(t, e)
+	e, _ = io.Exists(path.Join(workspace, "compose", "services", "invalid-name"))
+	assert.False(t, e)
+}
+
+func TestWriteCatalogComposeFileKeepsComposeFilesOfTheWorkspace(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	composeFilePath := path.Join(workspace, "compose", "services", "redis", "docker-compose.yml")
+
+	err := writeCatalogComposeFile(workspace, "redis", catalogService{Image: "redis"})
+	assert.Nil(t, err)
+
+	// the compose files generated from the catalog are regenerated
+	err = writeCatalogComposeFile(workspace, "redis", catalogService{Image: "bitnami/redis"})
+	assert.Nil(t, err)
+
+	bytes, _ := io.ReadFile(composeFilePath)
+	assert.Contains(t, string(bytes), "bitnami/redis:${REDIS_VERSION:-latest}")
+
+	err = io.WriteFile([]byte("version: '2.3'\n"), composeFilePath)
+	assert.Nil(t, err)
+
+	err = writeCatalogComposeFile(workspace, "redis", catalogService{Image: "redis"})
+	assert.NotNil(t, err)
+
+	bytes, _ = io.ReadFile(composeFilePath)
+	assert.Equal(t, "version: '2.3'\n", string(bytes))
+}
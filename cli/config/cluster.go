@@ -0,0 +1,114 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	shell "github.com/elastic/e2e-testing/cli/shell"
+)
+
+// ClusterProfileInfix the infix of the profiles running a multi-node Elasticsearch cluster, with a
+// dedicated master, i.e. fleet-cluster and fleet-cluster-secured
+const ClusterProfileInfix = "-cluster"
+
+// ElasticsearchClusterSizeEnvVar the environment variable setting the number of nodes of the
+// Elasticsearch cluster, including the dedicated master (Default: 3)
+const ElasticsearchClusterSizeEnvVar = "ELASTICSEARCH_CLUSTER_SIZE"
+
+// ElasticsearchHeapSizeEnvVar the environment variable setting the heap of each node of the
+// Elasticsearch cluster, i.e. 1g (Default: 512m)
+const ElasticsearchHeapSizeEnvVar = "ELASTICSEARCH_HEAP_SIZE"
+
+// MinElasticsearchClusterSize the number of nodes of the smallest cluster: the dedicated master and
+// two data nodes, so that the replicas of the shards are relocated when a data node restarts
+const MinElasticsearchClusterSize = 3
+
+// MaxElasticsearchClusterSize the number of nodes of the biggest cluster, as the data nodes are
+// declared by the compose files of the cluster profiles
+const MaxElasticsearchClusterSize = 5
+
+// heapSizeRegex matches the heap sizes supported by the JVM options, i.e. 512m or 1g
+var heapSizeRegex = regexp.MustCompile(`^[1-9][0-9]*[kmg]$`)
+
+// GetClusterProfile returns the name of the variant of a profile running a multi-node Elasticsearch
+// cluster, keeping its secured suffix, i.e. fleet-cluster-secured for fleet-secured
+func GetClusterProfile(profile string) string {
+	if IsClusterProfile(profile) {
+		return profile
+	}
+
+	if IsSecuredProfile(profile) {
+		return GetSecuredProfile(strings.TrimSuffix(profile, SecuredProfileSuffix) + ClusterProfileInfix)
+	}
+
+	return profile + ClusterProfileInfix
+}
+
+// IsClusterProfile checks if a profile runs a multi-node Elasticsearch cluster
+func IsClusterProfile(profile string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(profile, SecuredProfileSuffix), ClusterProfileInfix)
+}
+
+// PutClusterEnvironment puts the size and the heap of the Elasticsearch cluster, set with the
+// ELASTICSEARCH_CLUSTER_SIZE and ELASTICSEARCH_HEAP_SIZE environment variables, into the environment
+// of the compose files of a cluster profile, keeping the ones already set in it
+func PutClusterEnvironment(env map[string]string) (map[string]string, error) {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	size := env["elasticsearchClusterSize"]
+	if size == "" {
+		size = shell.GetEnv(ElasticsearchClusterSizeEnvVar, strconv.Itoa(MinElasticsearchClusterSize))
+	}
+
+	heapSize := env["elasticsearchHeapSize"]
+	if heapSize == "" {
+		heapSize = shell.GetEnv(ElasticsearchHeapSizeEnvVar, "512m")
+	}
+
+	return putClusterEnvironment(env, size, heapSize)
+}
+
+// putClusterEnvironment puts the size and the heap of the Elasticsearch cluster into the environment
+// of the compose files, activating the compose profiles of the data nodes beyond the default ones,
+// i.e. elasticsearch-3 for a cluster of 4 nodes
+func putClusterEnvironment(env map[string]string, size string, heapSize string) (map[string]string, error) {
+	nodes, err := strconv.Atoi(size)
+	if err != nil || nodes < MinElasticsearchClusterSize || nodes > MaxElasticsearchClusterSize {
+		return env, fmt.Errorf("the size of the Elasticsearch cluster must be between %d and %d nodes: %s", MinElasticsearchClusterSize, MaxElasticsearchClusterSize, size)
+	}
+
+	if !heapSizeRegex.MatchString(heapSize) {
+		return env, fmt.Errorf("the heap of the Elasticsearch nodes must be a size of the JVM options, i.e. 512m or 1g: %s", heapSize)
+	}
+
+	env["elasticsearchClusterSize"] = size
+	env["elasticsearchHeapSize"] = heapSize
+
+	profiles := GetComposeProfiles(env)
+	active := map[string]bool{}
+	for _, profile := range profiles {
+		active[profile] = true
+	}
+
+	// the dedicated master and the elasticsearch and elasticsearch-2 data nodes always run
+	for node := MinElasticsearchClusterSize; node < nodes; node++ {
+		profile := fmt.Sprintf("elasticsearch-%d", node)
+		if !active[profile] {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	if len(profiles) > 0 {
+		env[ComposeProfilesKey] = strings.Join(profiles, ",")
+	}
+
+	return env, nil
+}
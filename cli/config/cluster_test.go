@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClusterProfile(t *testing.T) {
+	assert.Equal(t, "fleet-cluster", GetClusterProfile("fleet"))
+	assert.Equal(t, "fleet-cluster", GetClusterProfile("fleet-cluster"))
+	assert.Equal(t, "fleet-cluster-secured", GetClusterProfile("fleet-secured"))
+	assert.Equal(t, "fleet-cluster-secured", GetSecuredProfile(GetClusterProfile("fleet")))
+
+	assert.True(t, IsClusterProfile("fleet-cluster"))
+	assert.True(t, IsClusterProfile("fleet-cluster-secured"))
+	assert.False(t, IsClusterProfile("fleet"))
+	assert.False(t, IsClusterProfile("fleet-secured"))
+}
+
+func TestPutClusterEnvironmentWithDefaultSize(t *testing.T) {
+	env, err := putClusterEnvironment(map[string]string{ComposeProfilesKey: ""}, "3", "512m")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "3", env["elasticsearchClusterSize"])
+	assert.Equal(t, "512m", env["elasticsearchHeapSize"])
+	assert.Empty(t, env[ComposeProfilesKey])
+}
+
+func TestPutClusterEnvironmentActivatesTheDataNodes(t *testing.T) {
+	env, err := putClusterEnvironment(map[string]string{ComposeProfilesKey: "fleet-server,elasticsearch-3"}, "5", "1g")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "5", env["elasticsearchClusterSize"])
+	assert.Equal(t, "1g", env["elasticsearchHeapSize"])
+	assert.Equal(t, "fleet-server,elasticsearch-3,elasticsearch-4", env[ComposeProfilesKey])
+}
+
+func TestPutClusterEnvironmentWithInvalidSize(t *testing.T) {
+	for _, size := range []string{"2", "6", "three"} {
+		_, err := putClusterEnvironment(map[string]string{}, size, "512m")
+		assert.NotNil(t, err, size)
+	}
+}
+
+func TestPutClusterEnvironmentWithInvalidHeapSize(t *testing.T) {
+	for _, heapSize := range []string{"", "512", "1gb", "0m"} {
+		_, err := putClusterEnvironment(map[string]string{}, "3", heapSize)
+		assert.NotNil(t, err, heapSize)
+	}
+}
@@ -25,6 +25,10 @@ import (
 // files representing the services and the profiles
 var opComposeBox *packr.Box
 
+// opKubernetesBox the tool's static files where we will embed the Kubernetes manifests
+// of the services and the profiles which can be deployed to a Kubernetes cluster
+var opKubernetesBox *packr.Box
+
 // Op the tool's configuration, read from tool's workspace
 var Op *OpConfig
 
@@ -68,13 +72,24 @@ func AvailableProfiles() map[string]Profile {
 // GetComposeFile returns the path of the compose file, looking up the
 // tool's workdir or in the static resources already packaged in the binary
 func GetComposeFile(isProfile bool, composeName string) (string, error) {
-	composeFileName := "docker-compose.yml"
+	return getStaticFile(opComposeBox, "compose", isProfile, composeName, "docker-compose.yml")
+}
+
+// GetKubernetesManifest returns the path of the Kubernetes manifest of a profile or a service,
+// looking up the tool's workdir or in the static resources already packaged in the binary
+func GetKubernetesManifest(isProfile bool, name string) (string, error) {
+	return getStaticFile(opKubernetesBox, "kubernetes", isProfile, name, "kubernetes.yml")
+}
+
+// getStaticFile returns the path of a file of a profile or a service in a dir of the tool's
+// workdir, extracting it from the static resources packaged in the binary if it does not exist
+func getStaticFile(box *packr.Box, dir string, isProfile bool, composeName string, composeFileName string) (string, error) {
 	serviceType := "services"
 	if isProfile {
 		serviceType = "profiles"
 	}
 
-	composeFilePath := path.Join(Op.Workspace, "compose", serviceType, composeName, composeFileName)
+	composeFilePath := path.Join(Op.Workspace, dir, serviceType, composeName, composeFileName)
 	found, err := io.Exists(composeFilePath)
 	if found && err == nil {
 		log.WithFields(log.Fields{
@@ -91,7 +106,11 @@ func GetComposeFile(isProfile bool, composeName string) (string, error) {
 		"type":            serviceType,
 	}).Trace("Compose file not found at workdir. Extracting from binary resources")
 
-	composeBytes, err := opComposeBox.Find(path.Join(serviceType, composeName, composeFileName))
+	if box == nil {
+		return "", fmt.Errorf("there are no packaged %s files", dir)
+	}
+
+	composeBytes, err := box.Find(path.Join(serviceType, composeName, composeFileName))
 	if err != nil {
 		log.WithFields(log.Fields{
 			"composeFileName": composeFileName,
@@ -128,17 +147,27 @@ func GetServiceConfig(service string) (Service, bool) {
 	return Op.GetServiceConfig(service)
 }
 
-// Init creates this tool workspace under user's home, in a hidden directory named ".op"
+// Init creates this tool workspace under user's home, in a hidden directory named ".op", applying
+// the persistent defaults stored in its config file before configuring the logger, and checks that
+// the binaries of the container runtime are installed
 func Init() {
-	configureLogger()
+	InitWorkspace()
+
+	runtime := GetContainerRuntime()
 
 	binaries := []string{
-		"docker",
-		"docker-compose",
+		runtime.Executable,
+		runtime.ComposeExecutable,
 	}
 	shell.CheckInstalledSoftware(binaries)
+}
 
+// InitWorkspace creates this tool workspace, and configures the logger with its persistent defaults,
+// without checking the binaries of the container runtime, i.e. for the command checking them
+func InitWorkspace() {
 	InitConfig()
+
+	configureLogger()
 }
 
 // InitConfig initialises configuration
@@ -258,6 +287,8 @@ func configureLogger() {
 		FullTimestamp: fullTimestamp,
 	})
 
+	addRunIDHook()
+
 	switch logLevel := os.Getenv("OP_LOG_LEVEL"); logLevel {
 	case "TRACE":
 		log.SetLevel(log.TraceLevel)
@@ -283,6 +314,9 @@ func newConfig(workspace string) {
 	}
 
 	checkConfigDirs(workspace)
+	// the lockfile of the images takes precedence over the config file of the workspace
+	applyImagesLock()
+	applySettings(workspace)
 
 	opConfig := OpConfig{
 		Services:  map[string]Service{},
@@ -299,11 +333,13 @@ func newConfig(workspace string) {
 		return
 	}
 
-	// add file system services and profiles
+	// add catalog, file system services and profiles
+	readCatalog(workspace, Op.Services)
 	readFilesFromFileSystem("services")
 	readFilesFromFileSystem("profiles")
 
 	opComposeBox = box
+	opKubernetesBox = packr.New("Kubernetes Manifests", "./kubernetes")
 }
 
 func packComposeFiles(op *OpConfig) *packr.Box {
@@ -91,6 +91,22 @@ func TestNewConfigPopulatesConfiguration(t *testing.T) {
 	assert.True(t, (Op.Profiles != nil))
 }
 
+func TestGetKubernetesManifestExtractsThePackagedManifest(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	initTestConfig(t)
+
+	manifestPath, err := GetKubernetesManifest(true, "fleet")
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(Op.Workspace, "kubernetes", "profiles", "fleet", "kubernetes.yml"), manifestPath)
+
+	e, _ := io.Exists(manifestPath)
+	assert.True(t, e)
+
+	_, err = GetKubernetesManifest(false, "non-existent")
+	assert.NotNil(t, err)
+}
+
 func checkLoggerWithLogLevel(t *testing.T, level string) {
 	os.Setenv("OP_LOG_LEVEL", strings.ToUpper(level))
 	defer cleanUpEnv()
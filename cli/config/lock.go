@@ -0,0 +1,115 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"sort"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ImagesLockEnvVar the environment variable with the path of the lockfile of the images, written by
+// the pull-images command, so that the profiles and the test suites run the images it pins
+const ImagesLockEnvVar = "OP_IMAGES_LOCKFILE"
+
+// ImagesLock the versions and the images resolved for a profile, pinning the images by their digest,
+// so that the runs using it are reproducible even if the tags of the images move, i.e. the snapshots
+type ImagesLock struct {
+	BuildID string            `yaml:"buildID,omitempty"` // the build of the snapshot in the artifacts API, i.e. 8.0.0-59098054
+	Commits map[string]string `yaml:"commits,omitempty"` // the commits of the projects in the build of the snapshot, by project
+	Env     map[string]string `yaml:"env"`               // the environment variables applied when the lockfile is used, i.e. STACK_VERSION
+	Images  []LockedImage     `yaml:"images"`
+	Profile string            `yaml:"profile"`
+	Version string            `yaml:"version"` // the version, or the alias, the lockfile was resolved from, i.e. 8.0-SNAPSHOT
+}
+
+// LockedImage an image of a profile pinned by its digest
+type LockedImage struct {
+	Digest string `yaml:"digest"` // the digest of the image in its registry, i.e. sha256:2f1c...
+	Image  string `yaml:"image"`  // the image, with the tag used by the compose files
+}
+
+// Digest returns the digest pinning an image, and if the lock pins it
+func (l ImagesLock) Digest(image string) (string, bool) {
+	for _, locked := range l.Images {
+		if locked.Image == image && locked.Digest != "" {
+			return locked.Digest, true
+		}
+	}
+
+	return "", false
+}
+
+// Marshal returns the lockfile in YAML, with its images sorted
+func (l ImagesLock) Marshal() ([]byte, error) {
+	sort.Slice(l.Images, func(i, j int) bool {
+		return l.Images[i].Image < l.Images[j].Image
+	})
+
+	return yaml.Marshal(l)
+}
+
+// GetImagesLock returns the lockfile of the images set in the OP_IMAGES_LOCKFILE environment variable,
+// and if it's set
+func GetImagesLock() (ImagesLock, bool, error) {
+	lockPath := os.Getenv(ImagesLockEnvVar)
+	if lockPath == "" {
+		return ImagesLock{}, false, nil
+	}
+
+	lock, err := ReadImagesLock(lockPath)
+	if err != nil {
+		return ImagesLock{}, false, err
+	}
+
+	return lock, true, nil
+}
+
+// ReadImagesLock reads a lockfile of the images
+func ReadImagesLock(lockPath string) (ImagesLock, error) {
+	bytes, err := io.ReadFile(lockPath)
+	if err != nil {
+		return ImagesLock{}, err
+	}
+
+	lock := ImagesLock{}
+	err = yaml.Unmarshal(bytes, &lock)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  lockPath,
+		}).Error("Could not parse the lockfile of the images")
+		return ImagesLock{}, err
+	}
+
+	return lock, nil
+}
+
+// applyImagesLock sets the environment variables of the lockfile of the images, if any, unless they
+// are already set, so that the environment always overrides the lockfile, as it does with the config
+// file of the workspace
+func applyImagesLock() {
+	lock, exists, err := GetImagesLock()
+	if err != nil || !exists {
+		return
+	}
+
+	for name, value := range lock.Env {
+		if value == "" || os.Getenv(name) != "" {
+			continue
+		}
+
+		_ = os.Setenv(name, value)
+	}
+
+	log.WithFields(log.Fields{
+		"env":     lock.Env,
+		"path":    os.Getenv(ImagesLockEnvVar),
+		"profile": lock.Profile,
+	}).Debug("The lockfile of the images was applied")
+}
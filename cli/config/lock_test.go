@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+const imagesLock = `buildID: 8.0.1-59098054
+commits:
+  elasticsearch: abc123
+env:
+  STACK_VERSION: 8.0.1-SNAPSHOT
+images:
+- digest: sha256:2f1c
+  image: docker.elastic.co/observability-ci/kibana:8.0.1-SNAPSHOT
+- digest: ""
+  image: localhost/built:latest
+profile: fleet
+version: 8.0-SNAPSHOT
+`
+
+func TestReadImagesLock(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	lockPath := path.Join(filet.TmpDir(t, ""), "images.lock.yml")
+	filet.File(t, lockPath, imagesLock)
+
+	lock, err := ReadImagesLock(lockPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "8.0.1-59098054", lock.BuildID)
+	assert.Equal(t, "fleet", lock.Profile)
+	assert.Equal(t, "8.0-SNAPSHOT", lock.Version)
+
+	digest, exists := lock.Digest("docker.elastic.co/observability-ci/kibana:8.0.1-SNAPSHOT")
+	assert.True(t, exists)
+	assert.Equal(t, "sha256:2f1c", digest)
+
+	_, exists = lock.Digest("localhost/built:latest")
+	assert.False(t, exists)
+
+	bytes, err := lock.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, imagesLock, string(bytes))
+}
+
+func TestApplyImagesLockKeepsTheEnvironment(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	lockPath := path.Join(filet.TmpDir(t, ""), "images.lock.yml")
+	filet.File(t, lockPath, imagesLock)
+
+	defer os.Unsetenv(ImagesLockEnvVar)
+	defer os.Unsetenv("STACK_VERSION")
+
+	os.Setenv(ImagesLockEnvVar, lockPath)
+	os.Unsetenv("STACK_VERSION")
+	applyImagesLock()
+	assert.Equal(t, "8.0.1-SNAPSHOT", os.Getenv("STACK_VERSION"))
+
+	os.Setenv("STACK_VERSION", "7.16.2")
+	applyImagesLock()
+	assert.Equal(t, "7.16.2", os.Getenv("STACK_VERSION"))
+}
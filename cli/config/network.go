@@ -0,0 +1,77 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// NetworkSubnetKey the variable of the environment of the compose files with the subnet of the
+// network of the project, in CIDR format, i.e. 172.28.0.0/16. It's read from the OP_NETWORK_SUBNET
+// environment variable too, and Docker chooses the subnet if it's empty
+const NetworkSubnetKey = "NETWORK_SUBNET"
+
+// GetNetworkSubnet returns the subnet of the network of a project, from the environment of the
+// compose files or from the OP_NETWORK_SUBNET environment variable, which is empty if Docker
+// chooses it. It fails if the subnet is not in CIDR format
+func GetNetworkSubnet(env map[string]string) (string, error) {
+	subnet, exists := env[NetworkSubnetKey]
+	if !exists {
+		subnet = os.Getenv("OP_" + NetworkSubnetKey)
+	}
+
+	subnet = strings.TrimSpace(subnet)
+	if subnet == "" {
+		return "", nil
+	}
+
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", fmt.Errorf("the subnet of the network is not in CIDR format, i.e. 172.28.0.0/16: %s - %v", subnet, err)
+	}
+
+	return network.String(), nil
+}
+
+// GetServiceAliases returns the aliases of a service in the network of its project, which are the
+// same in every run, so that the services and the agents resolve it consistently: its name, its
+// name qualified with the project, i.e. elasticsearch.fleet-worker2, and the extra aliases read from
+// the environment of the compose files, replacing "SERVICE_" with the service name in uppercase,
+// or else from the environment variables prefixed with "OP_". The variable is:
+//   - SERVICE_ALIASES: the comma-separated aliases (i.e. OP_KIBANA_ALIASES=kibana.local,kb)
+func GetServiceAliases(env map[string]string, project string, service string) []string {
+	aliases := []string{service, service + "." + project}
+
+	key := strings.ToUpper(strings.ReplaceAll(service, "-", "_")) + "_ALIASES"
+	value, exists := env[key]
+	if !exists {
+		value = os.Getenv("OP_" + key)
+	}
+
+	for _, alias := range strings.Split(value, ",") {
+		alias = strings.TrimSpace(alias)
+		if alias == "" || containsString(aliases, alias) {
+			continue
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases
+}
+
+// containsString checks if a value is in a list
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNetworkSubnet(t *testing.T) {
+	defer os.Unsetenv("OP_NETWORK_SUBNET")
+
+	subnet, err := GetNetworkSubnet(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", subnet)
+
+	os.Setenv("OP_NETWORK_SUBNET", "172.28.0.0/16")
+	subnet, err = GetNetworkSubnet(map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "172.28.0.0/16", subnet)
+
+	subnet, err = GetNetworkSubnet(map[string]string{NetworkSubnetKey: "10.10.1.7/24"})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.10.1.0/24", subnet)
+
+	_, err = GetNetworkSubnet(map[string]string{NetworkSubnetKey: "172.28.0.0"})
+	assert.NotNil(t, err)
+}
+
+func TestGetServiceAliases(t *testing.T) {
+	defer os.Unsetenv("OP_FLEET_SERVER_ALIASES")
+
+	aliases := GetServiceAliases(map[string]string{}, "fleet-worker2", "kibana")
+	assert.Equal(t, []string{"kibana", "kibana.fleet-worker2"}, aliases)
+
+	aliases = GetServiceAliases(map[string]string{"KIBANA_ALIASES": "kibana.local, kb,kibana,"}, "fleet", "kibana")
+	assert.Equal(t, []string{"kibana", "kibana.fleet", "kibana.local", "kb"}, aliases)
+
+	os.Setenv("OP_FLEET_SERVER_ALIASES", "fleet")
+	aliases = GetServiceAliases(map[string]string{}, "fleet", "fleet-server")
+	assert.Equal(t, []string{"fleet-server", "fleet-server.fleet", "fleet"}, aliases)
+}
@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// noResourceLimit the value of a resource limit removing it, i.e. OP_ELASTICSEARCH_MEM_LIMIT=0
+const noResourceLimit = "0"
+
+// ServiceResources the limits of the resources of the container of a service, so that the services
+// run in CI workers with fixed resources without being killed when they run out of memory
+type ServiceResources struct {
+	CPUs     string // the number of CPUs, i.e. 1.5, no limit if empty
+	MemLimit string // the memory, i.e. 2g, no limit if empty
+}
+
+// defaultServiceResources the limits of the resources of the services of the stack by default, by
+// the name of their service. Elasticsearch runs with a heap of 1g in the profiles
+var defaultServiceResources = map[string]ServiceResources{
+	"elasticsearch": {CPUs: "2", MemLimit: "2g"},
+	"kibana":        {CPUs: "1", MemLimit: "1g"},
+}
+
+// GetServiceResources returns the limits of the resources of a service, and if it has any. Each
+// limit is read from the environment of the compose files, replacing "SERVICE_" with the service
+// name in uppercase, then from the environment variables prefixed with "OP_", and it falls back to
+// the defaults of the service. The variables are:
+//   - SERVICE_CPUS: the number of CPUs (i.e. OP_ELASTICSEARCH_CPUS=1.5)
+//   - SERVICE_MEM_LIMIT: the memory (i.e. OP_KIBANA_MEM_LIMIT=2g)
+//
+// A limit set to 0 removes it
+func GetServiceResources(env map[string]string, service string) (ServiceResources, bool) {
+	serviceUpper := strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+	defaults := defaultServiceResources[service]
+
+	resources := ServiceResources{
+		CPUs:     getResourceLimit(env, serviceUpper+"_CPUS", defaults.CPUs),
+		MemLimit: getResourceLimit(env, serviceUpper+"_MEM_LIMIT", defaults.MemLimit),
+	}
+
+	return resources, resources.CPUs != "" || resources.MemLimit != ""
+}
+
+// getResourceLimit returns a limit of the resources of a service from the environment of the compose
+// files or from the environment variables, falling back to a default value. It returns empty if
+// the limit is removed
+func getResourceLimit(env map[string]string, key string, defaultValue string) string {
+	value, exists := env[key]
+	if !exists {
+		value, exists = os.LookupEnv("OP_" + key)
+	}
+	if !exists {
+		value = defaultValue
+	}
+
+	value = strings.TrimSpace(value)
+	if value == noResourceLimit {
+		return ""
+	}
+
+	return value
+}
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetServiceResourcesDefaults(t *testing.T) {
+	resources, limited := GetServiceResources(map[string]string{}, "elasticsearch")
+	assert.True(t, limited)
+	assert.Equal(t, ServiceResources{CPUs: "2", MemLimit: "2g"}, resources)
+
+	resources, limited = GetServiceResources(map[string]string{}, "kibana")
+	assert.True(t, limited)
+	assert.Equal(t, ServiceResources{CPUs: "1", MemLimit: "1g"}, resources)
+
+	_, limited = GetServiceResources(map[string]string{}, "mysql")
+	assert.False(t, limited)
+}
+
+func TestGetServiceResourcesFromTheEnvironment(t *testing.T) {
+	defer os.Unsetenv("OP_ELASTICSEARCH_MEM_LIMIT")
+	defer os.Unsetenv("OP_PACKAGE_REGISTRY_CPUS")
+
+	os.Setenv("OP_ELASTICSEARCH_MEM_LIMIT", "4g")
+	os.Setenv("OP_PACKAGE_REGISTRY_CPUS", "0.5")
+
+	resources, limited := GetServiceResources(map[string]string{}, "elasticsearch")
+	assert.True(t, limited)
+	assert.Equal(t, ServiceResources{CPUs: "2", MemLimit: "4g"}, resources)
+
+	resources, limited = GetServiceResources(map[string]string{}, "package-registry")
+	assert.True(t, limited)
+	assert.Equal(t, ServiceResources{CPUs: "0.5"}, resources)
+
+	// the environment of the compose files takes precedence
+	resources, _ = GetServiceResources(map[string]string{"ELASTICSEARCH_MEM_LIMIT": "3g"}, "elasticsearch")
+	assert.Equal(t, "3g", resources.MemLimit)
+}
+
+func TestGetServiceResourcesRemovesTheLimits(t *testing.T) {
+	resources, limited := GetServiceResources(map[string]string{"KIBANA_CPUS": "0", "KIBANA_MEM_LIMIT": "0"}, "kibana")
+	assert.False(t, limited)
+	assert.Equal(t, ServiceResources{}, resources)
+}
@@ -0,0 +1,136 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	shell "github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// RunIDEnvVar the environment variable holding the ID of the run, which is shared by all the
+// processes of a run, i.e. the workers, the retries or the iterations of a soak run
+const RunIDEnvVar = "OP_RUN_ID"
+
+// RunIDKey the name of the variable of the ID of the run in the environment of the compose files
+// and the state, and of the field of the log entries
+const RunIDKey = "runID"
+
+// RunIDLabel the label of the containers with the ID of the run which created them
+const RunIDLabel = "co.elastic.e2e.run-id"
+
+// ScenarioLabel the label of the containers with the name of the scenario which created them
+const ScenarioLabel = "co.elastic.e2e.scenario"
+
+// SuiteLabel the label of the containers with the name of the test suite which created them
+const SuiteLabel = "co.elastic.e2e.suite"
+
+var runID string
+var runIDOnce sync.Once
+
+// runScope the test suite and the scenario running in the process
+var runScope struct {
+	scenario string
+	suite    string
+}
+var runScopeMutex sync.RWMutex
+
+var runIDHookOnce sync.Once
+
+// GetRunID returns the ID of the run, read from the OP_RUN_ID environment variable, i.e. the tag
+// of a CI build. If it's not set, an ID is generated from the current time and a random suffix,
+// i.e. 20201201T101530-3fa2b1, and exported to the environment, so that the processes run by
+// the tool share it
+func GetRunID() string {
+	runIDOnce.Do(func() {
+		runID = shell.GetEnv(RunIDEnvVar, "")
+		if runID != "" {
+			return
+		}
+
+		suffix := make([]byte, 3)
+		_, _ = rand.Read(suffix)
+
+		runID = time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+		_ = os.Setenv(RunIDEnvVar, runID)
+	})
+
+	return runID
+}
+
+// SetRunScope sets the names of the test suite and the scenario running in the process, which
+// label the resources created by the tool, so that the ones left behind by an interrupted run are
+// traced back to them. The scenario is empty between the scenarios
+func SetRunScope(suite string, scenario string) {
+	runScopeMutex.Lock()
+	defer runScopeMutex.Unlock()
+
+	runScope.suite = suite
+	runScope.scenario = scenario
+}
+
+// GetRunLabels returns the labels of the resources created by the tool: the ID of the run, and
+// the names of the test suite and the scenario running, if any
+func GetRunLabels(runID string) map[string]string {
+	runScopeMutex.RLock()
+	defer runScopeMutex.RUnlock()
+
+	labels := map[string]string{
+		RunIDLabel: runID,
+	}
+	if runScope.suite != "" {
+		labels[SuiteLabel] = runScope.suite
+	}
+	if runScope.scenario != "" {
+		labels[ScenarioLabel] = runScope.scenario
+	}
+
+	return labels
+}
+
+// PutRunEnvironment puts the ID of the run into the environment, so that the compose files and the
+// state are correlated with it. An ID already in the environment is kept, as the services started
+// by a previous run are reused in developer mode
+func PutRunEnvironment(env map[string]string) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	if _, exists := env[RunIDKey]; !exists {
+		env[RunIDKey] = GetRunID()
+	}
+
+	return env
+}
+
+// runIDHook adds the ID of the run to the fields of the log entries
+type runIDHook struct{}
+
+// Levels returns the levels of the log entries the hook is fired for, which are all of them
+func (h runIDHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire adds the ID of the run to the fields of a log entry
+func (h runIDHook) Fire(entry *log.Entry) error {
+	if _, exists := entry.Data[RunIDKey]; !exists {
+		entry.Data[RunIDKey] = GetRunID()
+	}
+
+	return nil
+}
+
+// addRunIDHook adds the ID of the run to the log entries, once
+func addRunIDHook() {
+	runIDHookOnce.Do(func() {
+		log.AddHook(runIDHook{})
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRunIDIsSharedWithTheProcessesOfTheRun(t *testing.T) {
+	runID := GetRunID()
+
+	assert.NotEmpty(t, runID)
+	assert.Equal(t, runID, GetRunID())
+	assert.Equal(t, runID, os.Getenv(RunIDEnvVar))
+}
+
+func TestPutRunEnvironment(t *testing.T) {
+	env := PutRunEnvironment(map[string]string{})
+
+	assert.Equal(t, GetRunID(), env[RunIDKey])
+}
+
+func TestPutRunEnvironmentKeepsTheIDOfAPreviousRun(t *testing.T) {
+	env := PutRunEnvironment(map[string]string{
+		RunIDKey: "20201201T101530-3fa2b1",
+	})
+
+	assert.Equal(t, "20201201T101530-3fa2b1", env[RunIDKey])
+}
+
+func TestGetRunLabels(t *testing.T) {
+	defer SetRunScope("", "")
+
+	assert.Equal(t, map[string]string{RunIDLabel: "20201201T101530-3fa2b1"}, GetRunLabels("20201201T101530-3fa2b1"))
+
+	SetRunScope("fleet", "Deploying the agent")
+	assert.Equal(t, map[string]string{
+		RunIDLabel:    "20201201T101530-3fa2b1",
+		ScenarioLabel: "Deploying the agent",
+		SuiteLabel:    "fleet",
+	}, GetRunLabels("20201201T101530-3fa2b1"))
+}
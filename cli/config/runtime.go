@@ -0,0 +1,184 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	shell "github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// ContainerRuntimeEnvVar the environment variable selecting the container runtime running the
+// services: docker (default) or podman
+const ContainerRuntimeEnvVar = "OP_CONTAINER_RUNTIME"
+
+// ComposeExecutableEnvVar the environment variable overriding the compose executable of the
+// container runtime, i.e. docker-compose to run the compose files against the Podman socket, or
+// "docker compose" to run them with the Compose V2 plugin of Docker
+const ComposeExecutableEnvVar = "OP_COMPOSE_EXECUTABLE"
+
+// ComposeProfilesKey the variable of the environment of the compose files activating the profiles
+// of the compose specification, i.e. COMPOSE_PROFILES=fleet-server,apm-server, so that the services
+// of a compose file with those profiles are run too
+const ComposeProfilesKey = "COMPOSE_PROFILES"
+
+// dockerHostKey the variable of the socket of the Docker API in the environment of docker-compose
+const dockerHostKey = "DOCKER_HOST"
+
+// ContainerRuntime a container runtime running the services: its CLI, the tool running the
+// compose files, and the socket of its Docker compatible API
+type ContainerRuntime struct {
+	ComposeArgs       []string // the args of the compose executable before the ones of its commands, i.e. compose
+	ComposeExecutable string   // docker-compose, podman-compose, or docker for the Compose V2 plugin
+	Executable        string   // the CLI of the runtime: docker or podman
+	Host              string   // the socket of the API, empty for the default one of Docker
+	Name              string   // docker or podman
+}
+
+// detectComposeV2Once detects the Compose V2 plugin of Docker once, as it runs a command
+var detectComposeV2Once sync.Once
+
+// composeV2 if the compose files are run with the Compose V2 plugin of Docker by default
+var composeV2 bool
+
+// detectComposeV2 checks if the compose files must be run with the Compose V2 plugin of Docker,
+// which is when the legacy docker-compose binary is not installed, but the plugin is
+var detectComposeV2 = func() bool {
+	if _, err := exec.LookPath("docker-compose"); err == nil {
+		return false
+	}
+
+	return exec.Command("docker", "compose", "version").Run() == nil
+}
+
+// GetContainerRuntime returns the container runtime selected with the OP_CONTAINER_RUNTIME
+// environment variable, exiting if it's not supported
+func GetContainerRuntime() ContainerRuntime {
+	name := shell.GetEnv(ContainerRuntimeEnvVar, "docker")
+
+	runtime, err := newContainerRuntime(name, shell.GetEnv(ComposeExecutableEnvVar, ""))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"runtime": name,
+		}).Fatal("The container runtime is not supported")
+	}
+
+	return runtime
+}
+
+// GetComposeProfiles returns the profiles of the compose specification activated in the environment
+// of the compose files, or in the environment variables, i.e. COMPOSE_PROFILES=fleet-server,apm-server
+func GetComposeProfiles(env map[string]string) []string {
+	value, exists := env[ComposeProfilesKey]
+	if !exists {
+		value = os.Getenv(ComposeProfilesKey)
+	}
+
+	profiles := []string{}
+	for _, profile := range strings.Split(value, ",") {
+		if profile = strings.TrimSpace(profile); profile != "" {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles
+}
+
+// IsComposeV2 checks if the compose files are run by the Compose V2 plugin of Docker
+func (r ContainerRuntime) IsComposeV2() bool {
+	return r.ComposeExecutable == r.Executable && len(r.ComposeArgs) > 0 && r.ComposeArgs[0] == "compose"
+}
+
+// IsPodmanCompose checks if the compose files are run by podman-compose, which does not support
+// all the commands of docker-compose, i.e. rm
+func (r ContainerRuntime) IsPodmanCompose() bool {
+	return r.ComposeExecutable == "podman-compose"
+}
+
+// PutRuntimeEnvironment puts the socket of the API of the container runtime into the environment of
+// the compose files, so that docker-compose runs them against the Podman socket
+func PutRuntimeEnvironment(env map[string]string) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	runtime := GetContainerRuntime()
+	if runtime.Host == "" {
+		return env
+	}
+
+	if _, exists := env[dockerHostKey]; !exists {
+		env[dockerHostKey] = runtime.Host
+	}
+
+	return env
+}
+
+// getPodmanHost returns the socket of the API of Podman: the one set in the CONTAINER_HOST or the
+// DOCKER_HOST environment variables, or the default one, which is in the runtime dir of the user
+// when Podman runs rootless
+func getPodmanHost() string {
+	for _, variable := range []string{"CONTAINER_HOST", dockerHostKey} {
+		if host := os.Getenv(variable); host != "" {
+			return host
+		}
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir != "" && os.Geteuid() != 0 {
+		return "unix://" + strings.TrimSuffix(runtimeDir, "/") + "/podman/podman.sock"
+	}
+
+	return "unix:///run/podman/podman.sock"
+}
+
+// newContainerRuntime returns a container runtime by its name, with the compose executable
+// overriden if it's not empty, which could include the args before the ones of its commands,
+// i.e. "docker compose". Docker runs the compose files with its Compose V2 plugin when the legacy
+// docker-compose binary is not installed
+func newContainerRuntime(name string, composeExecutable string) (ContainerRuntime, error) {
+	var runtime ContainerRuntime
+
+	switch strings.ToLower(name) {
+	case "docker":
+		runtime = ContainerRuntime{
+			ComposeExecutable: "docker-compose",
+			Executable:        "docker",
+			Name:              "docker",
+		}
+	case "podman":
+		runtime = ContainerRuntime{
+			ComposeExecutable: "podman-compose",
+			Executable:        "podman",
+			Host:              getPodmanHost(),
+			Name:              "podman",
+		}
+	default:
+		return runtime, fmt.Errorf("the %s container runtime is not supported: use docker or podman", name)
+	}
+
+	if composeExecutable == "" && runtime.Name == "docker" {
+		detectComposeV2Once.Do(func() {
+			composeV2 = detectComposeV2()
+		})
+
+		if composeV2 {
+			composeExecutable = "docker compose"
+		}
+	}
+
+	if fields := strings.Fields(composeExecutable); len(fields) > 0 {
+		runtime.ComposeExecutable = fields[0]
+		runtime.ComposeArgs = fields[1:]
+	}
+
+	return runtime, nil
+}
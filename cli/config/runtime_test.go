@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerRuntimeDefaultsToDocker(t *testing.T) {
+	os.Unsetenv(ContainerRuntimeEnvVar)
+	os.Unsetenv(ComposeExecutableEnvVar)
+	detectComposeV2Once.Do(func() {})
+	composeV2 = false
+
+	runtime := GetContainerRuntime()
+	assert.Equal(t, "docker", runtime.Name)
+	assert.Equal(t, "docker", runtime.Executable)
+	assert.Equal(t, "docker-compose", runtime.ComposeExecutable)
+	assert.Equal(t, "", runtime.Host)
+	assert.False(t, runtime.IsPodmanCompose())
+
+	env := PutRuntimeEnvironment(map[string]string{})
+	_, exists := env["DOCKER_HOST"]
+	assert.False(t, exists)
+}
+
+func TestNewContainerRuntimeForPodman(t *testing.T) {
+	os.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	defer os.Unsetenv("CONTAINER_HOST")
+
+	runtime, err := newContainerRuntime("Podman", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "podman", runtime.Name)
+	assert.Equal(t, "podman", runtime.Executable)
+	assert.Equal(t, "podman-compose", runtime.ComposeExecutable)
+	assert.Equal(t, "unix:///tmp/podman.sock", runtime.Host)
+	assert.True(t, runtime.IsPodmanCompose())
+}
+
+func TestNewContainerRuntimeForPodmanWithDockerCompose(t *testing.T) {
+	runtime, err := newContainerRuntime("podman", "docker-compose")
+	assert.Nil(t, err)
+	assert.Equal(t, "podman", runtime.Executable)
+	assert.Equal(t, "docker-compose", runtime.ComposeExecutable)
+	assert.False(t, runtime.IsPodmanCompose())
+}
+
+func TestNewContainerRuntimeWithComposeV2(t *testing.T) {
+	runtime, err := newContainerRuntime("docker", "docker compose")
+	assert.Nil(t, err)
+	assert.Equal(t, "docker", runtime.ComposeExecutable)
+	assert.Equal(t, []string{"compose"}, runtime.ComposeArgs)
+	assert.True(t, runtime.IsComposeV2())
+	assert.False(t, runtime.IsPodmanCompose())
+}
+
+func TestNewContainerRuntimeDetectsComposeV2(t *testing.T) {
+	detectComposeV2Once.Do(func() {})
+	composeV2 = true
+	defer func() {
+		composeV2 = false
+	}()
+
+	runtime, err := newContainerRuntime("docker", "")
+	assert.Nil(t, err)
+	assert.True(t, runtime.IsComposeV2())
+
+	runtime, err = newContainerRuntime("docker", "docker-compose")
+	assert.Nil(t, err)
+	assert.False(t, runtime.IsComposeV2())
+}
+
+func TestGetComposeProfiles(t *testing.T) {
+	assert.Equal(t, []string{"fleet-server", "apm-server"}, GetComposeProfiles(map[string]string{ComposeProfilesKey: "fleet-server, apm-server,"}))
+	assert.Equal(t, []string{}, GetComposeProfiles(map[string]string{ComposeProfilesKey: ""}))
+
+	os.Setenv(ComposeProfilesKey, "package-registry")
+	defer os.Unsetenv(ComposeProfilesKey)
+
+	assert.Equal(t, []string{"package-registry"}, GetComposeProfiles(map[string]string{}))
+}
+
+func TestNewContainerRuntimeNotSupported(t *testing.T) {
+	_, err := newContainerRuntime("containerd", "")
+	assert.NotNil(t, err)
+}
+
+func TestGetPodmanHostRootless(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("the socket of the rootless Podman is only used by other users than root")
+	}
+
+	os.Unsetenv("CONTAINER_HOST")
+	os.Unsetenv("DOCKER_HOST")
+	os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000/")
+	defer os.Unsetenv("XDG_RUNTIME_DIR")
+
+	assert.Equal(t, "unix:///run/user/1000/podman/podman.sock", getPodmanHost())
+}
+
+func TestPutRuntimeEnvironmentForPodman(t *testing.T) {
+	os.Setenv(ContainerRuntimeEnvVar, "podman")
+	os.Setenv("CONTAINER_HOST", "unix:///tmp/podman.sock")
+	defer os.Unsetenv(ContainerRuntimeEnvVar)
+	defer os.Unsetenv("CONTAINER_HOST")
+
+	env := PutRuntimeEnvironment(map[string]string{})
+	assert.Equal(t, "unix:///tmp/podman.sock", env["DOCKER_HOST"])
+
+	env = PutRuntimeEnvironment(map[string]string{"DOCKER_HOST": "tcp://podman:8080"})
+	assert.Equal(t, "tcp://podman:8080", env["DOCKER_HOST"])
+}
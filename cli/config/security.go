@@ -0,0 +1,212 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/cli/internal/certs"
+	shell "github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// CertsDirKey the name of the variable of the dir of the certificates in the environment of the
+// compose files, which is mounted by the services of the secured stack
+const CertsDirKey = "certsDir"
+
+// URLSchemeKey the name of the variable of the scheme of the URLs of the services of the stack in
+// the environment of the compose files, so that the services reach the secured stack with https
+const URLSchemeKey = "urlScheme"
+
+// SecuredProfileSuffix the suffix of the profiles running the stack with TLS and authentication
+// enabled, i.e. fleet-secured
+const SecuredProfileSuffix = "-secured"
+
+// securedServices the services of the stack which listen with TLS, getting a certificate
+var securedServices = []string{"elasticsearch", "fleet-server", "kibana"}
+
+// ServiceSecurity the options running a service monitored by the beats secured, i.e. a MySQL with
+// TLS and a password, so that the modules are tested against secured deployments
+type ServiceSecurity struct {
+	Configs  map[string]string // the local config files mounted into the container, by their path in it
+	Password string            // the password of the user
+	TLS      bool              // listens with TLS, with a certificate signed by the CA of the secured stack
+	Username string            // the user the clients authenticate with, no authentication if empty
+}
+
+// caCertPath the path of the certificate of the CA of the secured stack, empty until the
+// certificates are generated
+var caCertPath string
+
+var caCertPathMutex sync.RWMutex
+
+// GenerateCerts generates the CA and the certificates of the services of the secured stack in
+// the certs dir of the state, reusing the valid ones, and trusts the CA in the HTTP requests
+// of the tool, which reach the stack with https from then on. It returns the path of the
+// certificate of the CA
+func GenerateCerts() (string, error) {
+	bundle, err := certs.Generate(GetCertsDir(), securedServices)
+	if err != nil {
+		return "", err
+	}
+
+	err = shell.TrustCACertificate(bundle.CACertPath())
+	if err != nil {
+		return "", err
+	}
+
+	caCertPathMutex.Lock()
+	defer caCertPathMutex.Unlock()
+
+	caCertPath = bundle.CACertPath()
+
+	log.WithFields(log.Fields{
+		"caCert":   caCertPath,
+		"services": securedServices,
+	}).Info("The certificates of the secured stack were generated")
+
+	return caCertPath, nil
+}
+
+// GenerateServiceCerts generates the certificate of a service signed by the CA of the secured stack,
+// generating the CA too if it does not exist, without trusting it in the requests of the tool. It
+// returns the dir of the certificates
+func GenerateServiceCerts(service string) (string, error) {
+	_, err := certs.Generate(GetCertsDir(), []string{service})
+	if err != nil {
+		return "", err
+	}
+
+	return GetCertsDir(), nil
+}
+
+// GetCACertPath returns the path of the certificate of the CA of the secured stack, which is empty
+// if the certificates are not generated
+func GetCACertPath() string {
+	caCertPathMutex.RLock()
+	defer caCertPathMutex.RUnlock()
+
+	return caCertPath
+}
+
+// GetCertsDir returns the dir where the certificates of the secured stack are generated, laid out
+// as the elasticsearch-certutil tool does, i.e. ca/ca.crt and kibana/kibana.crt
+func GetCertsDir() string {
+	return filepath.Join(GetStateDir(), "certs")
+}
+
+// GetServiceSecurity returns the security options of a service from the environment of the compose
+// files, put with PutServiceSecurityEnvironment, and if the service runs secured
+func GetServiceSecurity(env map[string]string, service string) (ServiceSecurity, bool) {
+	serviceUpper := strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+
+	security := ServiceSecurity{
+		Configs:  map[string]string{},
+		Password: env[serviceUpper+"_PASSWORD"],
+		TLS:      env[serviceUpper+"_TLS"] == "true",
+		Username: env[serviceUpper+"_USERNAME"],
+	}
+
+	for _, config := range strings.Split(env[serviceUpper+"_CONFIGS"], ",") {
+		parts := strings.SplitN(config, ":", 2)
+		if len(parts) == 2 {
+			security.Configs[parts[1]] = parts[0]
+		}
+	}
+
+	secured := security.TLS || security.Username != "" || len(security.Configs) > 0
+
+	return security, secured
+}
+
+// GetSecuredProfile returns the name of the variant of a profile running the stack with TLS and
+// authentication enabled, i.e. fleet-secured
+func GetSecuredProfile(profile string) string {
+	if IsSecuredProfile(profile) {
+		return profile
+	}
+
+	return profile + SecuredProfileSuffix
+}
+
+// GetURLScheme returns the scheme of the URLs of the services of the stack: https once the
+// certificates of the secured stack are generated, and http otherwise
+func GetURLScheme() string {
+	if GetCACertPath() != "" {
+		return "https"
+	}
+
+	return "http"
+}
+
+// IsSecuredProfile checks if a profile runs the stack with TLS and authentication enabled
+func IsSecuredProfile(profile string) bool {
+	return strings.HasSuffix(profile, SecuredProfileSuffix)
+}
+
+// PutServiceSecurityEnvironment puts the security options of a service into the environment of the
+// compose files, replacing "SERVICE_" with the service name in uppercase, so that the service runs
+// secured. The variables are:
+//   - SERVICE_CONFIGS: the config files mounted into the container (i.e. APACHE_CONFIGS=local:container)
+//   - SERVICE_PASSWORD and SERVICE_USERNAME: the credentials (i.e. MYSQL_USERNAME)
+//   - SERVICE_TLS: true if the service listens with TLS (i.e. KAFKA_TLS), which puts the dir of the
+//     certificates too, so that the beats trust their CA
+func PutServiceSecurityEnvironment(env map[string]string, service string, security ServiceSecurity) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	serviceUpper := strings.ToUpper(strings.ReplaceAll(service, "-", "_"))
+
+	if len(security.Configs) > 0 {
+		configs := []string{}
+		for containerPath, localPath := range security.Configs {
+			configs = append(configs, localPath+":"+containerPath)
+		}
+		sort.Strings(configs)
+
+		env[serviceUpper+"_CONFIGS"] = strings.Join(configs, ",")
+	}
+
+	if security.Username != "" {
+		env[serviceUpper+"_USERNAME"] = security.Username
+		env[serviceUpper+"_PASSWORD"] = security.Password
+	}
+
+	if security.TLS {
+		env[serviceUpper+"_TLS"] = "true"
+
+		if _, exists := env[CertsDirKey]; !exists {
+			env[CertsDirKey] = GetCertsDir()
+		}
+	}
+
+	return env
+}
+
+// PutSecurityEnvironment puts the dir of the certificates and the scheme of the URLs into the
+// environment once the certificates are generated, so that the compose files of the secured
+// stack mount them, and the services reach the stack with https
+func PutSecurityEnvironment(env map[string]string) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	if GetCACertPath() == "" {
+		return env
+	}
+
+	if _, exists := env[CertsDirKey]; !exists {
+		env[CertsDirKey] = GetCertsDir()
+	}
+	if _, exists := env[URLSchemeKey]; !exists {
+		env[URLSchemeKey] = GetURLScheme()
+	}
+
+	return env
+}
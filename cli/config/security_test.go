@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSecuredProfile(t *testing.T) {
+	assert.Equal(t, "fleet-secured", GetSecuredProfile("fleet"))
+	assert.Equal(t, "fleet-secured", GetSecuredProfile("fleet-secured"))
+
+	assert.True(t, IsSecuredProfile("fleet-secured"))
+	assert.False(t, IsSecuredProfile("fleet"))
+}
+
+func TestPutSecurityEnvironmentWithoutCerts(t *testing.T) {
+	env := PutSecurityEnvironment(map[string]string{})
+
+	_, exists := env[CertsDirKey]
+	assert.False(t, exists)
+	_, exists = env[URLSchemeKey]
+	assert.False(t, exists)
+	assert.Equal(t, "http", GetURLScheme())
+}
+
+func TestGenerateCerts(t *testing.T) {
+	defer filet.CleanUp(t)
+	defer func() {
+		caCertPath = ""
+	}()
+
+	initTestConfig(t)
+
+	os.Unsetenv("OP_WORKER_ID")
+
+	caCert, err := GenerateCerts()
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(GetStateDir(), "certs", "ca", "ca.crt"), caCert)
+	assert.Equal(t, caCert, GetCACertPath())
+	assert.Equal(t, "https", GetURLScheme())
+
+	for _, service := range securedServices {
+		e, _ := io.Exists(path.Join(GetCertsDir(), service, service+".crt"))
+		assert.True(t, e, service)
+	}
+
+	env := PutSecurityEnvironment(map[string]string{})
+	assert.Equal(t, GetCertsDir(), env[CertsDirKey])
+	assert.Equal(t, "https", env[URLSchemeKey])
+}
+
+func TestPutServiceSecurityEnvironment(t *testing.T) {
+	env := PutServiceSecurityEnvironment(map[string]string{}, "mysql", ServiceSecurity{
+		Configs:  map[string]string{"/etc/mysql/conf.d/e2e.cnf": "/tmp/e2e.cnf"},
+		Password: "secret",
+		TLS:      true,
+		Username: "elastic",
+	})
+
+	assert.Equal(t, "/tmp/e2e.cnf:/etc/mysql/conf.d/e2e.cnf", env["MYSQL_CONFIGS"])
+	assert.Equal(t, "secret", env["MYSQL_PASSWORD"])
+	assert.Equal(t, "true", env["MYSQL_TLS"])
+	assert.Equal(t, "elastic", env["MYSQL_USERNAME"])
+	assert.Equal(t, GetCertsDir(), env[CertsDirKey])
+
+	security, secured := GetServiceSecurity(env, "mysql")
+	assert.True(t, secured)
+	assert.Equal(t, ServiceSecurity{
+		Configs:  map[string]string{"/etc/mysql/conf.d/e2e.cnf": "/tmp/e2e.cnf"},
+		Password: "secret",
+		TLS:      true,
+		Username: "elastic",
+	}, security)
+}
+
+func TestGetServiceSecurityOfAPlainService(t *testing.T) {
+	_, secured := GetServiceSecurity(map[string]string{"APACHE_VERSION": "2.4.20"}, "apache")
+	assert.False(t, secured)
+}
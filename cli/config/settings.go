@@ -0,0 +1,231 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileName the name of the file of the workspace where the persistent defaults of the tool are
+// stored, i.e. $HOME/.op/config.yml
+const ConfigFileName = "config.yml"
+
+// the sources of the value of a setting
+const (
+	SettingFromConfigFile  = "config file"
+	SettingFromDefault     = "default"
+	SettingFromEnvironment = "environment"
+)
+
+// Setting a persistent default of the tool, stored in the config file of the workspace, which is
+// applied to the environment variable overriding it, unless that variable is already set
+type Setting struct {
+	Default     string                   // the value used when it's set nowhere, empty if it depends on the profile
+	Description string                   // the help of the setting, shown by the config commands
+	EnvVar      string                   // the environment variable overriding the setting, i.e. STACK_VERSION
+	validate    func(value string) error // checks a value before storing it, nil if any value is valid
+}
+
+// Settings the persistent defaults of the tool, by their key in the config file of the workspace
+var Settings = map[string]Setting{
+	"logLevel": {
+		Default:     "INFO",
+		Description: "The log level of the tool and the test suites: TRACE, DEBUG, INFO, WARNING, ERROR, FATAL or PANIC",
+		EnvVar:      "OP_LOG_LEVEL",
+		validate:    oneOf("TRACE", "DEBUG", "INFO", "WARNING", "ERROR", "FATAL", "PANIC"),
+	},
+	"provider": {
+		Default:     "docker",
+		Description: "The provider of the services under test of the test suites: docker, kubernetes or remote",
+		EnvVar:      "PROVIDER",
+		validate:    oneOf("docker", "kubernetes", "remote"),
+	},
+	"stackVersion": {
+		Description: "The version of the stack run by the profiles and the test suites, i.e. 7.14.0-SNAPSHOT",
+		EnvVar:      "STACK_VERSION",
+	},
+}
+
+// EffectiveSetting the value of a setting in effect, and where it comes from
+type EffectiveSetting struct {
+	EnvVar string `json:"envVar"`
+	Key    string `json:"key"`
+	Source string `json:"source"` // environment, config file or default
+	Value  string `json:"value"`
+}
+
+// appliedSettings the keys of the settings applied from the config file of the workspace, as their
+// environment variables were not set
+var appliedSettings = map[string]bool{}
+
+// GetConfigFile returns the path of the config file of the workspace
+func GetConfigFile() string {
+	return path.Join(Op.Workspace, ConfigFileName)
+}
+
+// GetEffectiveSettings returns the settings in effect, sorted by key: the environment variable
+// overriding a setting if set, the value in the config file of the workspace otherwise, or the default
+func GetEffectiveSettings() []EffectiveSetting {
+	effective := []EffectiveSetting{}
+	for _, key := range settingKeys() {
+		setting := Settings[key]
+
+		es := EffectiveSetting{
+			EnvVar: setting.EnvVar,
+			Key:    key,
+			Source: SettingFromDefault,
+			Value:  setting.Default,
+		}
+
+		if value := os.Getenv(setting.EnvVar); value != "" {
+			es.Value = value
+			es.Source = SettingFromEnvironment
+			if appliedSettings[key] {
+				es.Source = SettingFromConfigFile
+			}
+		}
+
+		effective = append(effective, es)
+	}
+
+	return effective
+}
+
+// ReadSettings returns the settings stored in the config file of a workspace, by their key, which are
+// none if the file does not exist
+func ReadSettings(workspace string) (map[string]string, error) {
+	configPath := path.Join(workspace, ConfigFileName)
+
+	found, err := io.Exists(configPath)
+	if !found || err != nil {
+		return map[string]string{}, nil
+	}
+
+	bytes, err := io.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]string{}
+	err = yaml.Unmarshal(bytes, &settings)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  configPath,
+		}).Error("Could not parse the config file of the workspace")
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// SetSetting stores the value of a setting in the config file of a workspace, removing it from the
+// file if the value is empty, so that its default applies again
+func SetSetting(workspace string, key string, value string) error {
+	setting, exists := Settings[key]
+	if !exists {
+		return fmt.Errorf("the %s setting does not exist, the settings are: %s", key, strings.Join(settingKeys(), ", "))
+	}
+
+	if value != "" && setting.validate != nil {
+		err := setting.validate(value)
+		if err != nil {
+			return fmt.Errorf("the value of the %s setting is not valid: %v", key, err)
+		}
+	}
+
+	settings, err := ReadSettings(workspace)
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		delete(settings, key)
+	} else {
+		settings[key] = value
+	}
+
+	bytes, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	configPath := path.Join(workspace, ConfigFileName)
+
+	err = io.WriteFile(bytes, configPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  configPath,
+		}).Error("Could not write the config file of the workspace")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path":    configPath,
+		"setting": key,
+		"value":   value,
+	}).Debug("The setting was stored in the config file of the workspace")
+
+	return nil
+}
+
+// applySettings sets the environment variables of the settings stored in the config file of a
+// workspace, unless they are already set, so that the environment always overrides the file
+func applySettings(workspace string) {
+	settings, err := ReadSettings(workspace)
+	if err != nil {
+		return
+	}
+
+	for key, value := range settings {
+		setting, exists := Settings[key]
+		if !exists {
+			log.WithFields(log.Fields{
+				"setting": key,
+			}).Warn("The config file of the workspace has an unknown setting, it will be ignored")
+			continue
+		}
+
+		if value == "" || os.Getenv(setting.EnvVar) != "" {
+			continue
+		}
+
+		_ = os.Setenv(setting.EnvVar, value)
+		appliedSettings[key] = true
+	}
+}
+
+// oneOf returns a validation accepting only some values
+func oneOf(values ...string) func(value string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if value == v {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%s is not one of %s", value, strings.Join(values, ", "))
+	}
+}
+
+// settingKeys returns the keys of the settings, sorted
+func settingKeys() []string {
+	keys := []string{}
+	for key := range Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSettingsWithoutConfigFile(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+
+	settings, err := ReadSettings(workspace)
+	assert.Nil(t, err)
+	assert.Empty(t, settings)
+}
+
+func TestSetSettingStoresAndRemovesTheValue(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+
+	err := SetSetting(workspace, "stackVersion", "7.14.0-SNAPSHOT")
+	assert.Nil(t, err)
+	err = SetSetting(workspace, "provider", "kubernetes")
+	assert.Nil(t, err)
+
+	settings, err := ReadSettings(workspace)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"provider": "kubernetes", "stackVersion": "7.14.0-SNAPSHOT"}, settings)
+
+	err = SetSetting(workspace, "provider", "")
+	assert.Nil(t, err)
+
+	settings, err = ReadSettings(workspace)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"stackVersion": "7.14.0-SNAPSHOT"}, settings)
+}
+
+func TestSetSettingWithInvalidValues(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+
+	assert.NotNil(t, SetSetting(workspace, "unknown", "foo"))
+	assert.NotNil(t, SetSetting(workspace, "logLevel", "VERBOSE"))
+	assert.NotNil(t, SetSetting(workspace, "provider", "vagrant"))
+
+	e, _ := os.Stat(path.Join(workspace, ConfigFileName))
+	assert.Nil(t, e)
+}
+
+func TestApplySettingsKeepsTheEnvironment(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	filet.File(t, path.Join(workspace, ConfigFileName), "provider: remote\nstackVersion: 7.14.0-SNAPSHOT\n")
+
+	os.Setenv("STACK_VERSION", "7.13.0")
+	defer os.Unsetenv("STACK_VERSION")
+	defer os.Unsetenv("PROVIDER")
+	defer delete(appliedSettings, "provider")
+
+	applySettings(workspace)
+
+	assert.Equal(t, "remote", os.Getenv("PROVIDER"))
+	assert.Equal(t, "7.13.0", os.Getenv("STACK_VERSION"))
+
+	sources := map[string]string{}
+	for _, setting := range GetEffectiveSettings() {
+		sources[setting.Key] = setting.Source
+	}
+	assert.Equal(t, map[string]string{
+		"logLevel":     SettingFromDefault,
+		"provider":     SettingFromConfigFile,
+		"stackVersion": SettingFromEnvironment,
+	}, sources)
+}
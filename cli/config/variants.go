@@ -0,0 +1,99 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultVersionRegex matches the default version of a service in its compose file, i.e.
+// ${MYSQL_VERSION:-5.7.12}
+var defaultVersionRegex = regexp.MustCompile(`\$\{[A-Za-z0-9_]+_VERSION:-([^}]+)\}`)
+
+// ServiceVariant a version of a service supported by its metricbeat module, in a variant of the
+// service when there are several, i.e. percona for mysql
+type ServiceVariant struct {
+	Variant string // empty if the service has no variants
+	Version string
+}
+
+// GetServiceVariants returns the versions and the variants of a service supported by its metricbeat
+// module, read from the _meta/supported-versions.yml file of the service in the workspace, which is
+// synced from Beats with the "op sync integrations" command
+func GetServiceVariants(service string) ([]ServiceVariant, error) {
+	return readServiceVariants(path.Join(Op.Workspace, "compose", "services", service))
+}
+
+// readServiceVariants reads the <SERVICE>_VERSION and <SERVICE>_VARIANT variables of each entry of
+// the supported-versions.yml file of the dir of a service. The entries without version get the
+// default version in the compose file of the service
+func readServiceVariants(serviceDir string) ([]ServiceVariant, error) {
+	versionsPath := path.Join(serviceDir, "_meta", "supported-versions.yml")
+
+	found, err := io.Exists(versionsPath)
+	if err != nil || !found {
+		return nil, fmt.Errorf("the %s file does not exist, sync it from Beats with the 'op sync integrations' command", versionsPath)
+	}
+
+	content, err := io.ReadFile(versionsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	supportedVersions := struct {
+		Variants []map[string]string `yaml:"variants"`
+	}{}
+
+	err = yaml.Unmarshal(content, &supportedVersions)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the %s file: %v", versionsPath, err)
+	}
+
+	variants := []ServiceVariant{}
+	for _, env := range supportedVersions.Variants {
+		variant := ServiceVariant{}
+		for k, v := range env {
+			if strings.HasSuffix(k, "_VERSION") {
+				variant.Version = v
+			} else if strings.HasSuffix(k, "_VARIANT") {
+				variant.Variant = v
+			}
+		}
+
+		if variant.Version == "" {
+			variant.Version = readDefaultVersion(path.Join(serviceDir, "docker-compose.yml"))
+		}
+
+		variants = append(variants, variant)
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("the %s file has no variants", versionsPath)
+	}
+
+	return variants, nil
+}
+
+// readDefaultVersion returns the default version of the service of a compose file, or latest if
+// there is none
+func readDefaultVersion(composePath string) string {
+	content, err := io.ReadFile(composePath)
+	if err != nil {
+		return "latest"
+	}
+
+	matches := defaultVersionRegex.FindSubmatch(content)
+	if len(matches) == 2 {
+		return string(matches[1])
+	}
+
+	return "latest"
+}
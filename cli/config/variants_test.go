@@ -0,0 +1,50 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+const testSupportedVersions = `variants:
+  - MYSQL_VARIANT: mysql
+    MYSQL_VERSION: 5.7
+  - MYSQL_VARIANT: mysql
+    MYSQL_VERSION: 8.0.13
+  - MYSQL_VARIANT: mariadb
+`
+
+func TestReadServiceVariants(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	serviceDir := filet.TmpDir(t, "")
+	err := io.MkdirAll(path.Join(serviceDir, "_meta"))
+	assert.Nil(t, err)
+
+	filet.File(t, path.Join(serviceDir, "_meta", "supported-versions.yml"), testSupportedVersions)
+	filet.File(t, path.Join(serviceDir, "docker-compose.yml"), "services:\n  mysql:\n    image: beats-mysql:${MYSQL_VARIANT:-mysql}-${MYSQL_VERSION:-5.7.12}-1\n")
+
+	variants, err := readServiceVariants(serviceDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []ServiceVariant{
+		{Variant: "mysql", Version: "5.7"},
+		{Variant: "mysql", Version: "8.0.13"},
+		{Variant: "mariadb", Version: "5.7.12"},
+	}, variants)
+}
+
+func TestReadServiceVariantsWithoutSupportedVersions(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	serviceDir := filet.TmpDir(t, "")
+
+	_, err := readServiceVariants(serviceDir)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+	shell "github.com/elastic/e2e-testing/cli/shell"
+)
+
+// workerPortsOffset the offset applied to the host ports of the services for each worker,
+// i.e. the Elasticsearch of the worker 2 is exposed at the 11200 port
+const workerPortsOffset = 1000
+
+// hostPorts the ports exposed at the host by the services, by the name of the variable
+// used in the compose files to set them
+var hostPorts = map[string]int{
+	"elasticsearchPort":          9200,
+	"elasticsearchTransportPort": 9300,
+	"fleetServerPort":            8220,
+	"kibanaPort":                 5601,
+	"opbeansGoPort":              8000,
+}
+
+// GetWorkerID returns the ID of the worker running the services, read from the OP_WORKER_ID
+// environment variable. Workers run in parallel, each one in an isolated environment: its own
+// docker-compose projects, state and host ports. It returns 0 when there are no workers
+func GetWorkerID() int {
+	workerID := shell.GetEnvInteger("OP_WORKER_ID", 0)
+	if workerID < 0 {
+		return 0
+	}
+
+	return workerID
+}
+
+// GetComposeProjectName returns the name of the docker-compose project for a compose file,
+// which is namespaced for each worker, i.e. metricbeat-worker2
+func GetComposeProjectName(composeName string) string {
+	workerID := GetWorkerID()
+	if workerID == 0 {
+		return composeName
+	}
+
+	return fmt.Sprintf("%s-worker%d", composeName, workerID)
+}
+
+// GetHostPort returns the port at the host where a port of a service is exposed, which is
+// shifted for each worker to avoid collisions
+func GetHostPort(port int) int {
+	return port + GetWorkerID()*workerPortsOffset
+}
+
+// GetStateDir returns the dir where the state of the services is persisted, which is
+// a sandbox in the workspace for each worker
+func GetStateDir() string {
+	workerID := GetWorkerID()
+	if workerID == 0 {
+		return Op.Workspace
+	}
+
+	stateDir := filepath.Join(Op.Workspace, "workers", strconv.Itoa(workerID))
+	_ = io.MkdirAll(stateDir)
+
+	return stateDir
+}
+
+// PutWorkerEnvironment puts the host ports of the services, shifted for the worker, into
+// the environment, so that the compose files expose them without collisions
+func PutWorkerEnvironment(env map[string]string) map[string]string {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	for variable, port := range hostPorts {
+		if _, exists := env[variable]; !exists {
+			env[variable] = strconv.Itoa(GetHostPort(port))
+		}
+	}
+
+	return env
+}
@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package config
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	io "github.com/elastic/e2e-testing/cli/internal"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetComposeProjectNameWithoutWorker(t *testing.T) {
+	os.Unsetenv("OP_WORKER_ID")
+
+	assert.Equal(t, "metricbeat", GetComposeProjectName("metricbeat"))
+}
+
+func TestGetComposeProjectNameWithWorker(t *testing.T) {
+	os.Setenv("OP_WORKER_ID", "2")
+	defer os.Unsetenv("OP_WORKER_ID")
+
+	assert.Equal(t, "metricbeat-worker2", GetComposeProjectName("metricbeat"))
+}
+
+func TestGetHostPortIsShiftedForEachWorker(t *testing.T) {
+	os.Unsetenv("OP_WORKER_ID")
+	assert.Equal(t, 9200, GetHostPort(9200))
+
+	os.Setenv("OP_WORKER_ID", "2")
+	defer os.Unsetenv("OP_WORKER_ID")
+	assert.Equal(t, 11200, GetHostPort(9200))
+}
+
+func TestGetStateDirIsASandboxForEachWorker(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	initTestConfig(t)
+
+	os.Unsetenv("OP_WORKER_ID")
+	assert.Equal(t, Op.Workspace, GetStateDir())
+
+	os.Setenv("OP_WORKER_ID", "3")
+	defer os.Unsetenv("OP_WORKER_ID")
+
+	stateDir := GetStateDir()
+	assert.Equal(t, path.Join(Op.Workspace, "workers", "3"), stateDir)
+
+	e, _ := io.Exists(stateDir)
+	assert.True(t, e)
+}
+
+func TestPutWorkerEnvironmentKeepsExistingPorts(t *testing.T) {
+	os.Setenv("OP_WORKER_ID", "1")
+	defer os.Unsetenv("OP_WORKER_ID")
+
+	env := PutWorkerEnvironment(map[string]string{
+		"kibanaPort": "5602",
+	})
+
+	assert.Equal(t, "10200", env["elasticsearchPort"])
+	assert.Equal(t, "10300", env["elasticsearchTransportPort"])
+	assert.Equal(t, "5602", env["kibanaPort"])
+}
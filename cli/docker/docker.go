@@ -5,13 +5,28 @@
 package docker
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,6 +35,204 @@ var instance *client.Client
 // OPNetworkName name of the network used by the tool
 const OPNetworkName = "elastic-dev-network"
 
+// ConnectContainerToNetworks connects a container to networks, in the same manner "docker network
+// connect" does, with the aliases and the addresses of their endpoints, i.e. the ones returned by
+// DisconnectContainerFromNetworks, so that the container is reachable again at its service name
+func ConnectContainerToNetworks(ctx context.Context, containerName string, endpoints map[string]*network.EndpointSettings) error {
+	dockerClient := getDockerClient()
+
+	for name, endpoint := range endpoints {
+		settings := &network.EndpointSettings{
+			Aliases:    endpoint.Aliases,
+			IPAMConfig: endpoint.IPAMConfig,
+			Links:      endpoint.Links,
+		}
+
+		err := dockerClient.NetworkConnect(ctx, name, containerName, settings)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"container": containerName,
+				"error":     err,
+				"network":   name,
+			}).Error("Could not connect the container to the network")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"network":   name,
+		}).Debug("Container has been connected to the network")
+	}
+
+	return nil
+}
+
+// CopyToContainer writes a file with the given content into a container, i.e. the log files
+// harvested by an agent. The parent dir of the file must exist in the container
+func CopyToContainer(ctx context.Context, containerName string, filePath string, content []byte) error {
+	dockerClient := getDockerClient()
+
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+
+	err := tarWriter.WriteHeader(&tar.Header{
+		ModTime: time.Now(),
+		Mode:    0644,
+		Name:    filepath.Base(filePath),
+		Size:    int64(len(content)),
+	})
+	if err == nil {
+		_, err = tarWriter.Write(content)
+	}
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"file":      filePath,
+		}).Error("Could not archive the file to be copied into the container")
+		return err
+	}
+
+	err = dockerClient.CopyToContainer(ctx, containerName, filepath.Dir(filePath), &buf, types.CopyToContainerOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"file":      filePath,
+		}).Error("Could not copy the file into the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+		"file":      filePath,
+		"size":      len(content),
+	}).Debug("File copied into the container")
+
+	return nil
+}
+
+// CreateNetwork creates a bridge network with labels, in the same manner "docker network create"
+// does, returning its ID. Its addresses are allocated in a subnet, in CIDR format, or in the one
+// chosen by Docker if it's empty. The network with the same name is reused if it already exists
+func CreateNetwork(ctx context.Context, name string, labels map[string]string, subnet string) (string, error) {
+	dockerClient := getDockerClient()
+
+	nameFilters := filters.NewArgs()
+	nameFilters.Add("name", name)
+
+	networks, err := dockerClient.NetworkList(ctx, types.NetworkListOptions{Filters: nameFilters})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"network": name,
+		}).Error("Could not list the networks")
+		return "", err
+	}
+
+	for _, existing := range networks {
+		// the name filter matches the networks containing the name
+		if existing.Name == name {
+			return existing.ID, nil
+		}
+	}
+
+	options := types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+		Labels:         labels,
+	}
+	if subnet != "" {
+		options.IPAM = &network.IPAM{
+			Driver: "default",
+			Config: []network.IPAMConfig{{Subnet: subnet}},
+		}
+	}
+
+	created, err := dockerClient.NetworkCreate(ctx, name, options)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"network": name,
+			"subnet":  subnet,
+		}).Error("Could not create the network")
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"network": name,
+		"subnet":  subnet,
+	}).Debug("Network has been created")
+
+	return created.ID, nil
+}
+
+// CreateVolume creates a local volume with labels, in the same manner "docker volume create" does.
+// The volume with the same name is kept if it already exists
+func CreateVolume(ctx context.Context, name string, labels map[string]string) error {
+	dockerClient := getDockerClient()
+
+	_, err := dockerClient.VolumeCreate(ctx, volume.VolumeCreateBody{
+		Driver: "local",
+		Labels: labels,
+		Name:   name,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"volume": name,
+		}).Error("Could not create the volume")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"volume": name,
+	}).Trace("Volume has been created")
+
+	return nil
+}
+
+// DisconnectContainerFromNetworks disconnects a running container from all its networks, in the same
+// manner "docker network disconnect" does, so that it cannot reach any other container. It returns
+// the endpoints of the networks it was connected to, to connect it back with ConnectContainerToNetworks
+func DisconnectContainerFromNetworks(ctx context.Context, containerName string) (map[string]*network.EndpointSettings, error) {
+	dockerClient := getDockerClient()
+
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not inspect the container")
+		return nil, err
+	}
+
+	disconnected := map[string]*network.EndpointSettings{}
+	for name, endpoint := range inspect.NetworkSettings.Networks {
+		err := dockerClient.NetworkDisconnect(ctx, name, containerName, false)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"container": containerName,
+				"error":     err,
+				"network":   name,
+			}).Error("Could not disconnect the container from the network")
+			return disconnected, err
+		}
+
+		disconnected[name] = endpoint
+
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"network":   name,
+		}).Debug("Container has been disconnected from the network")
+	}
+
+	return disconnected, nil
+}
+
 // ExecCommandIntoContainer executes a command, as a user, into a container
 func ExecCommandIntoContainer(ctx context.Context, containerName string, user string, cmd []string) (string, error) {
 	dockerClient := getDockerClient()
@@ -118,93 +331,975 @@ func ExecCommandIntoContainer(ctx context.Context, containerName string, user st
 	return output, nil
 }
 
-// InspectContainer returns the JSON representation of the inspection of a
-// Docker container, identified by its name
-func InspectContainer(name string) (*types.ContainerJSON, error) {
+// ExecCommandIntoContainerWithResult executes a command, as a user, into a container, returning
+// its stdout, its stderr and its exit code. It only fails if the command could not be run, so
+// that the callers can check the output of the failing commands
+func ExecCommandIntoContainerWithResult(ctx context.Context, containerName string, user string, cmd []string) (shell.ExecResult, error) {
 	dockerClient := getDockerClient()
 
-	ctx := context.Background()
+	response, err := dockerClient.ContainerExecCreate(
+		ctx, containerName, types.ExecConfig{
+			User:         user,
+			AttachStderr: true,
+			AttachStdout: true,
+			Cmd:          cmd,
+		})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"command":   cmd,
+			"error":     err,
+		}).Warn("Could not create command in container")
+		return shell.ExecResult{}, err
+	}
+
+	resp, err := dockerClient.ContainerExecAttach(ctx, response.ID, types.ExecStartCheck{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"command":   cmd,
+			"error":     err,
+		}).Error("Could not execute command in container")
+		return shell.ExecResult{}, err
+	}
+	defer resp.Close()
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	_, err = stdcopy.StdCopy(&stdout, &stderr, resp.Reader)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"command":   cmd,
+			"error":     err,
+		}).Error("Could not read the command output from container")
+		return shell.ExecResult{}, err
+	}
+
+	inspect, err := dockerClient.ContainerExecInspect(ctx, response.ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"command":   cmd,
+			"error":     err,
+		}).Error("Could not inspect the command executed in container")
+		return shell.ExecResult{}, err
+	}
+
+	result := shell.ExecResult{
+		ExitCode: inspect.ExitCode,
+		Stderr:   strings.Trim(stderr.String(), "\n"),
+		Stdout:   strings.Trim(stdout.String(), "\n"),
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+		"command":   cmd,
+		"exitCode":  result.ExitCode,
+	}).Trace("Command executed in container")
+
+	return result, nil
+}
+
+// GetComposeServiceContainer returns the running container of a service belonging to a docker-compose project
+func GetComposeServiceContainer(project string, service string) (types.Container, error) {
+	dockerClient := getDockerClient()
 
 	labelFilters := filters.NewArgs()
-	labelFilters.Add("label", "service.owner=co.elastic.observability")
-	labelFilters.Add("label", "service.container.name="+name)
+	labelFilters.Add("label", "com.docker.compose.project="+strings.ToLower(project))
+	labelFilters.Add("label", "com.docker.compose.service="+service)
 
-	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: labelFilters})
+	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{Filters: labelFilters})
 	if err != nil {
 		log.WithFields(log.Fields{
-			"error":  err,
-			"labels": labelFilters,
-		}).Fatal("Cannot list containers")
+			"error":   err,
+			"project": project,
+			"service": service,
+		}).Warn("Could not list the containers of the service")
+		return types.Container{}, err
 	}
 
-	inspect, err := dockerClient.ContainerInspect(ctx, containers[0].ID)
+	if len(containers) == 0 {
+		err = fmt.Errorf("There is no running container for the %s service in the %s project", service, project)
+		log.WithFields(log.Fields{
+			"project": project,
+			"service": service,
+		}).Warn("The service is not running")
+		return types.Container{}, err
+	}
+
+	return containers[0], nil
+}
+
+// GetContainerIPAddresses returns the addresses of a container in each of its networks
+func GetContainerIPAddresses(ctx context.Context, containerName string) ([]string, error) {
+	dockerClient := getDockerClient()
+
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
 	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not inspect the container")
 		return nil, err
 	}
 
-	return &inspect, nil
+	addresses := []string{}
+	for _, endpoint := range inspect.NetworkSettings.Networks {
+		if endpoint.IPAddress != "" {
+			addresses = append(addresses, endpoint.IPAddress)
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("the %s container has no address in its networks", containerName)
+	}
+
+	return addresses, nil
 }
 
-// RemoveContainer removes a container identified by its container name
-func RemoveContainer(containerName string) error {
+// GetContainerLogs returns the logs of a container, including stdout and stderr
+func GetContainerLogs(ctx context.Context, containerName string) (string, error) {
 	dockerClient := getDockerClient()
 
-	ctx := context.Background()
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not inspect the container")
+		return "", err
+	}
 
-	options := types.ContainerRemoveOptions{
-		Force:         true,
-		RemoveVolumes: true,
+	reader, err := dockerClient.ContainerLogs(ctx, containerName, types.ContainerLogsOptions{
+		ShowStderr: true,
+		ShowStdout: true,
+		Timestamps: true,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not retrieve the logs of the container")
+		return "", err
 	}
+	defer reader.Close()
 
-	if err := dockerClient.ContainerRemove(ctx, containerName, options); err != nil {
+	var logs bytes.Buffer
+
+	// containers without a TTY multiplex stdout and stderr in the same stream
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = logs.ReadFrom(reader)
+	} else {
+		_, err = stdcopy.StdCopy(&logs, &logs, reader)
+	}
+	if err != nil {
 		log.WithFields(log.Fields{
-			"error":   err,
-			"service": containerName,
-		}).Warn("Service could not be removed")
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not read the logs of the container")
+		return "", err
+	}
 
-		return err
+	return logs.String(), nil
+}
+
+// GetContainerStats returns a sample of the resource usage of a container: CPU, memory, network and processes
+func GetContainerStats(ctx context.Context, containerName string) (*types.StatsJSON, error) {
+	dockerClient := getDockerClient()
+
+	response, err := dockerClient.ContainerStats(ctx, containerName, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not retrieve the stats of the container")
+		return nil, err
 	}
+	defer response.Body.Close()
 
-	log.WithFields(log.Fields{
-		"service": containerName,
-	}).Info("Service has been removed")
+	var stats types.StatsJSON
+	err = json.NewDecoder(response.Body).Decode(&stats)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not parse the stats of the container")
+		return nil, err
+	}
 
-	return nil
+	return &stats, nil
 }
 
-// RemoveDevNetwork removes the developer network
-func RemoveDevNetwork() error {
+// GetContainerState returns the state of a container, identified by its ID or name: its status,
+// its start time and its health, which is nil if the container has no healthcheck
+func GetContainerState(ctx context.Context, containerName string) (*types.ContainerState, error) {
 	dockerClient := getDockerClient()
 
-	ctx := context.Background()
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not inspect the container")
+		return nil, err
+	}
 
-	log.WithFields(log.Fields{
-		"network": OPNetworkName,
-	}).Trace("Removing Dev Network...")
+	return inspect.State, nil
+}
 
-	if err := dockerClient.NetworkRemove(ctx, OPNetworkName); err != nil {
-		return err
-	}
+// GetImageRepoDigests returns the digests of a local image in the registries it was pulled from,
+// i.e. docker.elastic.co/observability-ci/kibana@sha256:2f1c...
+func GetImageRepoDigests(ctx context.Context, image string) ([]string, error) {
+	dockerClient := getDockerClient()
 
-	log.WithFields(log.Fields{
-		"network": OPNetworkName,
-	}).Trace("Dev Network has been removed")
+	inspect, _, err := dockerClient.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"image": image,
+		}).Error("Could not inspect the image")
+		return nil, err
+	}
 
-	return nil
+	return inspect.RepoDigests, nil
 }
 
-func getDockerClient() *client.Client {
-	if instance != nil {
-		return instance
+// GetServerInfo returns the info and the version of the daemon serving the Docker API, in the same
+// manner "docker info" and "docker version" do, failing if it's not reachable
+func GetServerInfo(ctx context.Context) (types.Info, types.Version, error) {
+	dockerClient := getDockerClient()
+
+	info, err := dockerClient.Info(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Could not get the info of the Docker daemon")
+		return types.Info{}, types.Version{}, err
 	}
 
-	clientVersion := "1.39"
+	version, err := dockerClient.ServerVersion(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Could not get the version of the Docker daemon")
+		return info, types.Version{}, err
+	}
+
+	return info, version, nil
+}
+
+// ImageExists checks if an image is present in the local images, so that it's not pulled
+func ImageExists(ctx context.Context, image string) bool {
+	dockerClient := getDockerClient()
+
+	_, _, err := dockerClient.ImageInspectWithRaw(ctx, image)
+	return err == nil
+}
+
+// InspectContainer returns the JSON representation of the inspection of a
+// Docker container, identified by its name
+func InspectContainer(name string) (*types.ContainerJSON, error) {
+	dockerClient := getDockerClient()
+
+	ctx := context.Background()
+
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", "service.owner=co.elastic.observability")
+	labelFilters.Add("label", "service.container.name="+name)
+
+	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: labelFilters})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"labels": labelFilters,
+		}).Fatal("Cannot list containers")
+	}
+
+	inspect, err := dockerClient.ContainerInspect(ctx, containers[0].ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inspect, nil
+}
+
+// KillContainer sends a signal to the main process of a container, i.e. SIGKILL
+func KillContainer(ctx context.Context, containerName string, signal string) error {
+	dockerClient := getDockerClient()
+
+	err := dockerClient.ContainerKill(ctx, containerName, signal)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"signal":    signal,
+		}).Error("Could not send the signal to the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+		"signal":    signal,
+	}).Debug("Signal sent to the container")
+
+	return nil
+}
+
+// ListComposeContainers returns the containers, running or not, belonging to a docker-compose project
+func ListComposeContainers(project string) ([]types.Container, error) {
+	dockerClient := getDockerClient()
+
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", "com.docker.compose.project="+strings.ToLower(project))
+
+	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: labelFilters})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"project": project,
+		}).Warn("Could not list the containers of the project")
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// ListLabelledContainers returns the containers, running or not, with a label, whatever its value
+func ListLabelledContainers(label string) ([]types.Container, error) {
+	dockerClient := getDockerClient()
+
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", label)
+
+	containers, err := dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: labelFilters})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"label": label,
+		}).Warn("Could not list the containers with the label")
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// ListLabelledNetworks returns the networks with a label, whatever its value
+func ListLabelledNetworks(label string) ([]types.NetworkResource, error) {
+	dockerClient := getDockerClient()
+
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", label)
+
+	networks, err := dockerClient.NetworkList(context.Background(), types.NetworkListOptions{Filters: labelFilters})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"label": label,
+		}).Warn("Could not list the networks with the label")
+		return nil, err
+	}
+
+	return networks, nil
+}
+
+// ListLabelledVolumes returns the volumes with a label, whatever its value
+func ListLabelledVolumes(label string) ([]*types.Volume, error) {
+	dockerClient := getDockerClient()
+
+	labelFilters := filters.NewArgs()
+	labelFilters.Add("label", label)
+
+	response, err := dockerClient.VolumeList(context.Background(), labelFilters)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"label": label,
+		}).Warn("Could not list the volumes with the label")
+		return nil, err
+	}
+
+	return response.Volumes, nil
+}
+
+// LoadImage loads the images stored in a tar file, which could be compressed, in the same
+// manner "docker load" does, returning the references of the loaded images
+func LoadImage(ctx context.Context, imagePath string) ([]string, error) {
+	dockerClient := getDockerClient()
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  imagePath,
+		}).Error("Could not open the image file")
+		return nil, err
+	}
+	defer f.Close()
+
+	response, err := dockerClient.ImageLoad(ctx, f, true)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  imagePath,
+		}).Error("Could not load the image")
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	images := []string{}
+
+	decoder := json.NewDecoder(response.Body)
+	for decoder.More() {
+		var message jsonmessage.JSONMessage
+		err := decoder.Decode(&message)
+		if err != nil {
+			return nil, err
+		}
+
+		if message.Error != nil {
+			return nil, message.Error
+		}
+
+		// i.e. "Loaded image: docker.elastic.co/beats/elastic-agent:8.0.0-SNAPSHOT"
+		if strings.HasPrefix(message.Stream, "Loaded image: ") {
+			images = append(images, strings.TrimSpace(strings.TrimPrefix(message.Stream, "Loaded image: ")))
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"images": images,
+		"path":   imagePath,
+	}).Debug("Images loaded")
+
+	return images, nil
+}
+
+// PullImage pulls an image for a platform, i.e. linux/arm64, in the same manner "docker pull"
+// does, waiting for the pull to complete
+func PullImage(ctx context.Context, image string, platform string) error {
+	dockerClient := getDockerClient()
+
+	reader, err := dockerClient.ImagePull(ctx, image, types.ImagePullOptions{Platform: platform})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"image":    image,
+			"platform": platform,
+		}).Error("Could not pull the image")
+		return err
+	}
+	defer reader.Close()
+
+	decoder := json.NewDecoder(reader)
+	for decoder.More() {
+		var message jsonmessage.JSONMessage
+		err := decoder.Decode(&message)
+		if err != nil {
+			return err
+		}
+
+		if message.Error != nil {
+			log.WithFields(log.Fields{
+				"error":    message.Error,
+				"image":    image,
+				"platform": platform,
+			}).Error("Could not pull the image")
+			return message.Error
+		}
+	}
+
+	return nil
+}
+
+// RemoveContainer removes a container identified by its container name
+func RemoveContainer(containerName string) error {
+	dockerClient := getDockerClient()
+
+	ctx := context.Background()
+
+	options := types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	}
+
+	if err := dockerClient.ContainerRemove(ctx, containerName, options); err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": containerName,
+		}).Warn("Service could not be removed")
+
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"service": containerName,
+	}).Info("Service has been removed")
+
+	return nil
+}
+
+// RemoveDevNetwork removes the developer network
+func RemoveDevNetwork() error {
+	dockerClient := getDockerClient()
+
+	ctx := context.Background()
+
+	log.WithFields(log.Fields{
+		"network": OPNetworkName,
+	}).Trace("Removing Dev Network...")
+
+	if err := dockerClient.NetworkRemove(ctx, OPNetworkName); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"network": OPNetworkName,
+	}).Trace("Dev Network has been removed")
+
+	return nil
+}
+
+// RemoveNetwork removes a network identified by its ID or its name
+func RemoveNetwork(network string) error {
+	dockerClient := getDockerClient()
+
+	if err := dockerClient.NetworkRemove(context.Background(), network); err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"network": network,
+		}).Warn("Network could not be removed")
+
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"network": network,
+	}).Debug("Network has been removed")
+
+	return nil
+}
+
+// RemoveVolume removes a volume identified by its name, which must not be used by any container
+func RemoveVolume(volume string) error {
+	dockerClient := getDockerClient()
+
+	if err := dockerClient.VolumeRemove(context.Background(), volume, false); err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"volume": volume,
+		}).Warn("Volume could not be removed")
+
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"volume": volume,
+	}).Debug("Volume has been removed")
+
+	return nil
+}
+
+// RestartContainer restarts a container identified by its ID or its name, in the same manner
+// "docker restart" does
+func RestartContainer(ctx context.Context, containerName string) error {
+	dockerClient := getDockerClient()
+
+	err := dockerClient.ContainerRestart(ctx, containerName, nil)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not restart the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+	}).Debug("Container has been restarted")
+
+	return nil
+}
+
+// RunContainer creates a container with a name and starts it, in the same manner "docker run -d"
+// does, returning its ID. The container is removed if it cannot be started
+func RunContainer(ctx context.Context, name string, containerConfig *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig) (string, error) {
+	dockerClient := getDockerClient()
+
+	created, err := dockerClient.ContainerCreate(ctx, containerConfig, hostConfig, networkingConfig, name)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": name,
+			"error":     err,
+			"image":     containerConfig.Image,
+		}).Error("Could not create the container")
+		return "", err
+	}
+
+	err = dockerClient.ContainerStart(ctx, created.ID, types.ContainerStartOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": name,
+			"error":     err,
+			"image":     containerConfig.Image,
+		}).Error("Could not start the container")
+
+		_ = dockerClient.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"container": name,
+		"image":     containerConfig.Image,
+	}).Debug("Container is running")
+
+	return created.ID, nil
+}
+
+// RunInContainerNetwork runs a command in a disposable container, created from an image, which
+// joins the network stack of another container with the NET_ADMIN capability, so that it's able
+// to alter the network of the other container, i.e. with tc or iptables. It returns the output
+// of the command
+func RunInContainerNetwork(ctx context.Context, image string, containerName string, cmd []string) (string, error) {
+	hostConfig := &container.HostConfig{
+		CapAdd:      []string{"NET_ADMIN"},
+		NetworkMode: container.NetworkMode("container:" + containerName),
+	}
+
+	return runDisposableContainer(ctx, image, containerName, cmd, hostConfig)
+}
+
+// RunInHostPIDNamespace runs a command in a disposable privileged container, created from an
+// image, which joins the PID namespace of the host, with the cgroups of the host mounted at
+// /host/sys/fs/cgroup, so that it's able to alter the resources of another container, i.e. to
+// throttle its disk IO. It returns the output of the command
+func RunInHostPIDNamespace(ctx context.Context, image string, containerName string, cmd []string) (string, error) {
+	hostConfig := &container.HostConfig{
+		Binds:      []string{"/sys/fs/cgroup:/host/sys/fs/cgroup"},
+		PidMode:    container.PidMode("host"),
+		Privileged: true,
+	}
+
+	return runDisposableContainer(ctx, image, containerName, cmd, hostConfig)
+}
+
+// runDisposableContainer runs a command in a disposable container, created from an image, which
+// alters another container, returning the output of the command
+func runDisposableContainer(ctx context.Context, image string, containerName string, cmd []string, hostConfig *container.HostConfig) (string, error) {
+	dockerClient := getDockerClient()
+
+	reader, err := dockerClient.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"image": image,
+		}).Error("Could not pull the image")
+		return "", err
+	}
+	_, _ = ioutil.ReadAll(reader)
+	reader.Close()
+
+	created, err := dockerClient.ContainerCreate(ctx,
+		&container.Config{
+			Cmd:        cmd,
+			Entrypoint: []string{},
+			Image:      image,
+		}, hostConfig, nil, "")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command":   cmd,
+			"container": containerName,
+			"error":     err,
+			"image":     image,
+		}).Error("Could not create the container altering the container")
+		return "", err
+	}
+	defer func() {
+		_ = dockerClient.ContainerRemove(context.Background(), created.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+
+	err = dockerClient.ContainerStart(ctx, created.ID, types.ContainerStartOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command":   cmd,
+			"container": containerName,
+			"error":     err,
+			"image":     image,
+		}).Error("Could not start the container altering the container")
+		return "", err
+	}
+
+	var exitCode int64
+	statusCh, errCh := dockerClient.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			log.WithFields(log.Fields{
+				"command":   cmd,
+				"container": containerName,
+				"error":     err,
+			}).Error("Could not wait for the command altering the container")
+			return "", err
+		}
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+
+	output, err := GetContainerLogs(ctx, created.ID)
+	if err != nil {
+		return "", err
+	}
+
+	if exitCode != 0 {
+		err = fmt.Errorf("The command %v exited with code %d: %s", cmd, exitCode, output)
+		log.WithFields(log.Fields{
+			"command":   cmd,
+			"container": containerName,
+			"exitCode":  exitCode,
+			"output":    output,
+		}).Error("The command altering the container failed")
+		return output, err
+	}
+
+	log.WithFields(log.Fields{
+		"command":   cmd,
+		"container": containerName,
+	}).Trace("Command altering the container executed")
+
+	return output, nil
+}
+
+// SaveImage saves an image to a tar file, in the same manner "docker save" does, so that it can be
+// loaded with LoadImage. The file is replaced atomically, so that a partial file is never loaded
+func SaveImage(ctx context.Context, image string, imagePath string) error {
+	dockerClient := getDockerClient()
+
+	reader, err := dockerClient.ImageSave(ctx, []string{image})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"image": image,
+		}).Error("Could not save the image")
+		return err
+	}
+	defer reader.Close()
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(imagePath), filepath.Base(imagePath)+".*.tmp")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  imagePath,
+		}).Error("Could not create the image file")
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = io.Copy(tmpFile, reader)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), imagePath)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"image": image,
+			"path":  imagePath,
+		}).Error("Could not write the image file")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"image": image,
+		"path":  imagePath,
+	}).Debug("Image saved")
+
+	return nil
+}
+
+// SetContainerNetworkAliases replaces the aliases of a running container in a network, which are
+// the names the embedded DNS server of Docker resolves to its address, disconnecting it from the
+// network and connecting it back with them, as the aliases of a connected container cannot change.
+// The container keeps the address set when it was connected, and is not resolvable by any alias
+// when they are empty
+func SetContainerNetworkAliases(ctx context.Context, containerName string, networkName string, aliases []string) error {
+	dockerClient := getDockerClient()
+
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not inspect the container")
+		return err
+	}
+
+	endpoint, exists := inspect.NetworkSettings.Networks[networkName]
+	if !exists {
+		return fmt.Errorf("The container %s is not connected to the %s network", containerName, networkName)
+	}
+
+	err = dockerClient.NetworkDisconnect(ctx, networkName, containerName, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"network":   networkName,
+		}).Error("Could not disconnect the container from the network")
+		return err
+	}
+
+	err = dockerClient.NetworkConnect(ctx, networkName, containerName, &network.EndpointSettings{
+		Aliases:    aliases,
+		IPAMConfig: endpoint.IPAMConfig,
+		Links:      endpoint.Links,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"aliases":   aliases,
+			"container": containerName,
+			"error":     err,
+			"network":   networkName,
+		}).Error("Could not connect the container to the network")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"aliases":   aliases,
+		"container": containerName,
+		"network":   networkName,
+	}).Debug("The aliases of the container have been replaced")
+
+	return nil
+}
+
+// StartContainer starts a stopped container identified by its ID or its name, in the same manner
+// "docker start" does
+func StartContainer(ctx context.Context, containerName string) error {
+	dockerClient := getDockerClient()
+
+	err := dockerClient.ContainerStart(ctx, containerName, types.ContainerStartOptions{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not start the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+	}).Debug("Container has been started")
+
+	return nil
+}
+
+// StopContainer stops a running container identified by its ID or its name, without removing it,
+// in the same manner "docker stop" does
+func StopContainer(ctx context.Context, containerName string) error {
+	dockerClient := getDockerClient()
+
+	err := dockerClient.ContainerStop(ctx, containerName, nil)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not stop the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+	}).Debug("Container has been stopped")
+
+	return nil
+}
+
+// StreamContainerLogs writes the logs of a container, including stdout and stderr, to a writer as
+// they are read, so that they can be followed until the container stops or the context is done
+func StreamContainerLogs(ctx context.Context, containerName string, options types.ContainerLogsOptions, w io.Writer) error {
+	dockerClient := getDockerClient()
+
+	inspect, err := dockerClient.ContainerInspect(ctx, containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not inspect the container")
+		return err
+	}
+
+	options.ShowStderr = true
+	options.ShowStdout = true
+
+	reader, err := dockerClient.ContainerLogs(ctx, containerName, options)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not retrieve the logs of the container")
+		return err
+	}
+	defer reader.Close()
+
+	// containers without a TTY multiplex stdout and stderr in the same stream
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(w, reader)
+	} else {
+		_, err = stdcopy.StdCopy(w, w, reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Warn("Could not read the logs of the container")
+		return err
+	}
+
+	return nil
+}
+
+// TagImage adds a tag to an image, in the same manner "docker tag" does
+func TagImage(ctx context.Context, source string, target string) error {
+	dockerClient := getDockerClient()
+
+	err := dockerClient.ImageTag(ctx, source, target)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"source": source,
+			"target": target,
+		}).Error("Could not tag the image")
+		return err
+	}
+
+	return nil
+}
+
+func getDockerClient() *client.Client {
+	if instance != nil {
+		return instance
+	}
+
+	clientVersion := "1.39"
+
+	opts := []client.Opt{client.WithVersion(clientVersion)}
+
+	// Podman serves a Docker compatible API in its own socket
+	runtime := config.GetContainerRuntime()
+	if runtime.Host != "" {
+		opts = append(opts, client.WithHost(runtime.Host))
+	}
 
-	instance, err := client.NewClientWithOpts(client.WithVersion(clientVersion))
+	instance, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":         err,
 			"clientVersion": clientVersion,
+			"host":          runtime.Host,
+			"runtime":       runtime.Name,
 		}).Fatal("Cannot get Docker Client")
 	}
 
@@ -0,0 +1,279 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package certs
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// caName the name of the certificate authority, which is the name of its dir and files
+const caName = "ca"
+
+// keySize the size in bits of the RSA keys
+const keySize = 2048
+
+// validity the period of time the generated material is valid for
+const validity = 365 * 24 * time.Hour
+
+// renewBefore the period of time before the expiration of the material when it's generated again,
+// so that it does not expire while the services are running
+const renewBefore = 7 * 24 * time.Hour
+
+// Bundle the CA and the certificates of the services generated in a dir, which is laid out as
+// the elasticsearch-certutil tool does, i.e. ca/ca.crt and kibana/kibana.crt
+type Bundle struct {
+	Dir      string
+	Services []string
+}
+
+// CACertPath returns the path of the certificate of the CA
+func (b *Bundle) CACertPath() string {
+	return b.CertPath(caName)
+}
+
+// CertPath returns the path of the certificate of a service
+func (b *Bundle) CertPath(name string) string {
+	return filepath.Join(b.Dir, name, name+".crt")
+}
+
+// KeyPath returns the path of the private key of a service
+func (b *Bundle) KeyPath(name string) string {
+	return filepath.Join(b.Dir, name, name+".key")
+}
+
+// Generate generates a CA into a dir, and a certificate signed by the CA for each service, valid for
+// the name of the service, localhost and the loopback addresses. The material already in the dir is
+// reused while it's valid, so that the services of a previous run keep trusting it
+func Generate(dir string, services []string) (*Bundle, error) {
+	bundle := &Bundle{
+		Dir:      dir,
+		Services: services,
+	}
+
+	caCert, caKey, err := bundle.loadCA()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":   dir,
+			"error": err,
+		}).Debug("Generating a new CA")
+
+		caCert, caKey, err = bundle.generateCA()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dir":   dir,
+				"error": err,
+			}).Error("Could not generate the CA")
+			return nil, err
+		}
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	for _, service := range services {
+		if bundle.isValid(service, roots) {
+			log.WithFields(log.Fields{
+				"path":    bundle.CertPath(service),
+				"service": service,
+			}).Trace("Reusing the certificate of the service")
+			continue
+		}
+
+		err := bundle.generateCertificate(service, caCert, caKey)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dir":     dir,
+				"error":   err,
+				"service": service,
+			}).Error("Could not generate the certificate of the service")
+			return nil, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"dir":      dir,
+		"services": services,
+	}).Debug("Certificates generated")
+
+	return bundle, nil
+}
+
+// generateCA generates a self-signed CA, writing its certificate and key to the dir of the bundle
+func (b *Bundle) generateCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template, err := newTemplate("Elastic E2E Testing CA")
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = b.write(caName, der, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// generateCertificate generates the certificate of a service signed by the CA, writing it and
+// its key to the dir of the bundle
+func (b *Bundle) generateCertificate(service string, caCert *x509.Certificate, caKey *rsa.PrivateKey) error {
+	key, err := rsa.GenerateKey(rand.Reader, keySize)
+	if err != nil {
+		return err
+	}
+
+	template, err := newTemplate(service)
+	if err != nil {
+		return err
+	}
+	template.DNSNames = []string{service, "localhost"}
+	template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+	template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	return b.write(service, der, key)
+}
+
+// isValid checks if the certificate of a service exists, is signed by the CA and is not about to
+// expire
+func (b *Bundle) isValid(service string, roots *x509.CertPool) bool {
+	cert, err := readCertificate(b.CertPath(service))
+	if err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(b.KeyPath(service)); err != nil {
+		return false
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		CurrentTime: time.Now().Add(renewBefore),
+		DNSName:     service,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		Roots:       roots,
+	})
+
+	return err == nil
+}
+
+// loadCA reads the certificate and key of the CA from the dir of the bundle, failing if they do not
+// exist or the CA is about to expire
+func (b *Bundle) loadCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	cert, err := readCertificate(b.CACertPath())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return nil, nil, fmt.Errorf("the CA expires at %s", cert.NotAfter)
+	}
+
+	bytes, err := ioutil.ReadFile(b.KeyPath(caName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return nil, nil, errors.New("the key of the CA is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// write writes a certificate and its key, PEM encoded, to the dir of a service. The files are
+// readable by anyone, as they are mounted into containers running with other users, and the
+// material is only meant for testing
+func (b *Bundle) write(name string, der []byte, key *rsa.PrivateKey) error {
+	err := os.MkdirAll(filepath.Join(b.Dir, name), 0755)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	err = ioutil.WriteFile(b.CertPath(name), certPEM, 0644)
+	if err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return ioutil.WriteFile(b.KeyPath(name), keyPEM, 0644)
+}
+
+// newTemplate returns the template of a certificate for a common name, with a random serial number
+func newTemplate(commonName string) (*x509.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	return &x509.Certificate{
+		NotAfter:     now.Add(validity),
+		NotBefore:    now.Add(-time.Hour),
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"Elastic"},
+		},
+	}, nil
+}
+
+// readCertificate reads a PEM encoded certificate from a file
+func readCertificate(path string) (*x509.Certificate, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return nil, fmt.Errorf("the certificate at %s is not PEM encoded", path)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
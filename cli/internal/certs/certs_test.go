@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package certs
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+	dir := path.Join(tmpDir, "certs")
+
+	bundle, err := Generate(dir, []string{"elasticsearch", "kibana"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, path.Join(dir, "ca", "ca.crt"), bundle.CACertPath())
+	assert.Equal(t, path.Join(dir, "kibana", "kibana.crt"), bundle.CertPath("kibana"))
+	assert.Equal(t, path.Join(dir, "kibana", "kibana.key"), bundle.KeyPath("kibana"))
+
+	ca, err := readCertificate(bundle.CACertPath())
+	assert.Nil(t, err)
+	assert.True(t, ca.IsCA)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	for _, service := range []string{"elasticsearch", "kibana"} {
+		cert, err := readCertificate(bundle.CertPath(service))
+		assert.Nil(t, err)
+
+		for _, name := range []string{service, "localhost", "127.0.0.1"} {
+			_, err = cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+			assert.Nil(t, err, name)
+		}
+
+		_, err = cert.Verify(x509.VerifyOptions{DNSName: "package-registry", Roots: roots})
+		assert.NotNil(t, err)
+	}
+}
+
+func TestGenerateReusesValidMaterial(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	bundle, err := Generate(tmpDir, []string{"elasticsearch"})
+	assert.Nil(t, err)
+
+	caBytes, _ := ioutil.ReadFile(bundle.CACertPath())
+	certBytes, _ := ioutil.ReadFile(bundle.CertPath("elasticsearch"))
+
+	bundle, err = Generate(tmpDir, []string{"elasticsearch", "kibana"})
+	assert.Nil(t, err)
+
+	reusedCABytes, _ := ioutil.ReadFile(bundle.CACertPath())
+	reusedCertBytes, _ := ioutil.ReadFile(bundle.CertPath("elasticsearch"))
+	assert.Equal(t, caBytes, reusedCABytes)
+	assert.Equal(t, certBytes, reusedCertBytes)
+
+	kibanaBytes, _ := ioutil.ReadFile(bundle.CertPath("kibana"))
+	assert.NotEmpty(t, kibanaBytes)
+}
+
+func TestGenerateReplacesCertificatesOfAnotherCA(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+	otherDir := filet.TmpDir(t, "")
+
+	bundle, err := Generate(tmpDir, []string{"kibana"})
+	assert.Nil(t, err)
+
+	other, err := Generate(otherDir, []string{"kibana"})
+	assert.Nil(t, err)
+
+	// the certificate of the service is signed by another CA
+	otherCertBytes, _ := ioutil.ReadFile(other.CertPath("kibana"))
+	err = ioutil.WriteFile(bundle.CertPath("kibana"), otherCertBytes, 0644)
+	assert.Nil(t, err)
+
+	bundle, err = Generate(tmpDir, []string{"kibana"})
+	assert.Nil(t, err)
+
+	ca, _ := readCertificate(bundle.CACertPath())
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	cert, err := readCertificate(bundle.CertPath("kibana"))
+	assert.Nil(t, err)
+
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "kibana", Roots: roots})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,658 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LintError severity of the issues that must be fixed, as they cause pending or ambiguous scenarios
+const LintError = "error"
+
+// LintWarning severity of the issues that should be fixed
+const LintWarning = "warning"
+
+// stepKeywords keywords starting the steps of a scenario
+var stepKeywords = []string{"Given ", "When ", "Then ", "And ", "But ", "* "}
+
+// tagPattern valid format of a tag, which cannot include whitespaces nor another tag
+var tagPattern = regexp.MustCompile(`^@[^@\s]+$`)
+
+// LintIssue an issue found in the feature files or the step definitions of a test suite
+type LintIssue struct {
+	Location string // the location of the issue, i.e. features/apache.feature:12
+	Message  string // the description of the issue
+	Severity string // the severity of the issue: error or warning
+}
+
+// String returns the representation of the issue in the report
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Location, i.Severity, i.Message)
+}
+
+// StepDefinition the expression of a step registered by a test suite
+type StepDefinition struct {
+	Expr     string // the regular expression of the step
+	Location string // the location of the registration, i.e. metricbeat_test.go:210
+	Shared   bool   // if the step is registered by a package shared by several suites
+}
+
+// FeatureStep a step of a scenario in a feature file
+type FeatureStep struct {
+	Location string // the location of the step, i.e. features/apache.feature:12
+	Text     string // the text of the step, without the keyword
+}
+
+// FeatureTag a tag in a feature file
+type FeatureTag struct {
+	Location string // the location of the tag
+	Name     string // the name of the tag, i.e. @apache
+}
+
+// Feature the steps and tags of a feature file. The steps of the scenario outlines are expanded
+// with the values of their examples
+type Feature struct {
+	Path  string
+	Steps []FeatureStep
+	Tags  []FeatureTag // all the tags in the file
+	// the tags of the feature, which apply to all its scenarios
+	FeatureTags []string
+}
+
+// LintFeatures checks the feature files of a test suite against its step definitions, reporting
+// the undefined steps, which are pending in the runs, the step definitions registered more than
+// once, the steps matching several definitions, the unused step definitions of the suite, and
+// the inconsistencies of the tags
+func LintFeatures(suiteDir string) ([]LintIssue, error) {
+	definitions, err := FindStepDefinitions(suiteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	featureFiles, err := filepath.Glob(filepath.Join(suiteDir, "features", "*.feature"))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(featureFiles) == 0 {
+		log.WithFields(log.Fields{
+			"suite": suiteDir,
+		}).Warn("There are no feature files in the suite")
+	}
+
+	features := []Feature{}
+	for _, featureFile := range featureFiles {
+		feature, err := ParseFeature(featureFile)
+		if err != nil {
+			return nil, err
+		}
+
+		features = append(features, feature)
+	}
+
+	issues := []LintIssue{}
+	issues = append(issues, lintStepDefinitions(definitions)...)
+	issues = append(issues, lintSteps(suiteDir, features, definitions)...)
+	issues = append(issues, lintTags(suiteDir, features)...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return lessLocation(issues[i].Location, issues[j].Location)
+	})
+
+	return issues, nil
+}
+
+// FindStepDefinitions returns the steps registered by the Go files of a test suite, and by the
+// packages of the same Go module it imports, which are marked as shared. The steps are read
+// from the calls to the Step function with a string literal as expression
+func FindStepDefinitions(suiteDir string) ([]StepDefinition, error) {
+	modulePath, moduleDir := findGoModule(suiteDir)
+
+	definitions := []StepDefinition{}
+	visited := map[string]bool{}
+
+	var walk func(dir string, shared bool) error
+	walk = func(dir string, shared bool) error {
+		if visited[dir] {
+			return nil
+		}
+		visited[dir] = true
+
+		steps, imports, err := parseStepDefinitions(suiteDir, dir, shared)
+		if err != nil {
+			return err
+		}
+		definitions = append(definitions, steps...)
+
+		if modulePath == "" {
+			return nil
+		}
+
+		for _, imp := range imports {
+			if imp != modulePath && !strings.HasPrefix(imp, modulePath+"/") {
+				continue
+			}
+
+			importDir := filepath.Join(moduleDir, filepath.FromSlash(strings.TrimPrefix(imp, modulePath)))
+			err := walk(importDir, true)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(suiteDir, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return definitions, nil
+}
+
+// ParseFeature reads the steps and tags of a feature file
+func ParseFeature(featurePath string) (Feature, error) {
+	f, err := os.Open(featurePath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  featurePath,
+		}).Error("Could not open the feature file")
+		return Feature{}, err
+	}
+	defer f.Close()
+
+	feature := Feature{
+		Path:  featurePath,
+		Steps: []FeatureStep{},
+		Tags:  []FeatureTag{},
+	}
+
+	outline := []FeatureStep{} // the steps of the scenario outline being read
+	inOutline := false
+	inExamples := false
+	inDocString := ""
+	header := []string{} // the header of the examples table being read
+	pendingTags := []string{}
+
+	flushOutline := func() {
+		if inOutline && !inExamples {
+			// an outline without examples is not run, but its steps must be defined
+			feature.Steps = append(feature.Steps, outline...)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		location := fmt.Sprintf("%s:%d", featurePath, lineNumber)
+
+		if inDocString != "" {
+			if strings.HasPrefix(line, inDocString) {
+				inDocString = ""
+			}
+			continue
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, `"""`) || strings.HasPrefix(line, "```"):
+			inDocString = line[:3]
+		case strings.HasPrefix(line, "@"):
+			for _, tag := range strings.Fields(line) {
+				if strings.HasPrefix(tag, "#") {
+					break
+				}
+				feature.Tags = append(feature.Tags, FeatureTag{Location: location, Name: tag})
+				pendingTags = append(pendingTags, tag)
+			}
+		case strings.HasPrefix(line, "Feature:"):
+			feature.FeatureTags = pendingTags
+			pendingTags = []string{}
+		case strings.HasPrefix(line, "Scenario Outline:") || strings.HasPrefix(line, "Scenario Template:"):
+			flushOutline()
+			outline = []FeatureStep{}
+			inOutline = true
+			inExamples = false
+			pendingTags = []string{}
+		case strings.HasPrefix(line, "Scenario:") || strings.HasPrefix(line, "Example:") || strings.HasPrefix(line, "Background:"):
+			flushOutline()
+			inOutline = false
+			inExamples = false
+			pendingTags = []string{}
+		case strings.HasPrefix(line, "Examples:") || strings.HasPrefix(line, "Scenarios:"):
+			inExamples = true
+			header = []string{}
+			pendingTags = []string{}
+		case strings.HasPrefix(line, "|"):
+			if !inOutline || !inExamples {
+				// data table of a step
+				continue
+			}
+
+			cells := parseTableRow(line)
+			if len(header) == 0 {
+				header = cells
+				continue
+			}
+
+			for _, step := range outline {
+				text := step.Text
+				for i, name := range header {
+					if i < len(cells) {
+						text = strings.ReplaceAll(text, "<"+name+">", cells[i])
+					}
+				}
+				feature.Steps = append(feature.Steps, FeatureStep{Location: step.Location, Text: text})
+			}
+		default:
+			text, isStep := trimStepKeyword(line)
+			if !isStep {
+				continue
+			}
+
+			step := FeatureStep{Location: location, Text: text}
+			if inOutline {
+				outline = append(outline, step)
+			} else {
+				feature.Steps = append(feature.Steps, step)
+			}
+		}
+	}
+	flushOutline()
+
+	err = scanner.Err()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  featurePath,
+		}).Error("Could not read the feature file")
+		return Feature{}, err
+	}
+
+	return feature, nil
+}
+
+// findGoModule returns the path and the dir of the Go module of a dir, looking up the go.mod
+// file in its parent dirs
+func findGoModule(dir string) (string, string) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", ""
+	}
+
+	for {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 2 && fields[0] == "module" {
+					return fields[1], dir
+				}
+			}
+			return "", ""
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// lintStepDefinitions reports the step expressions registered more than once, or which are not
+// valid regular expressions
+func lintStepDefinitions(definitions []StepDefinition) []LintIssue {
+	issues := []LintIssue{}
+	seen := map[string]StepDefinition{}
+
+	for _, definition := range definitions {
+		_, err := regexp.Compile(definition.Expr)
+		if err != nil {
+			issues = append(issues, LintIssue{
+				Location: definition.Location,
+				Message:  fmt.Sprintf("invalid step expression %q: %v", definition.Expr, err),
+				Severity: LintError,
+			})
+			continue
+		}
+
+		if previous, exists := seen[definition.Expr]; exists {
+			issues = append(issues, LintIssue{
+				Location: definition.Location,
+				Message:  fmt.Sprintf("duplicated step definition %q, already registered at %s", definition.Expr, previous.Location),
+				Severity: LintError,
+			})
+			continue
+		}
+
+		seen[definition.Expr] = definition
+	}
+
+	return issues
+}
+
+// lintSteps reports the steps not matching any definition, which are pending in the runs, the
+// steps matching several definitions, which run the first one registered, and the definitions of
+// the suite not matching any step. The definitions of the shared packages are not reported as
+// unused, as suites only use some of them
+func lintSteps(suiteDir string, features []Feature, definitions []StepDefinition) []LintIssue {
+	issues := []LintIssue{}
+
+	expressions := map[string]*regexp.Regexp{}
+	for _, definition := range definitions {
+		if re, err := regexp.Compile(definition.Expr); err == nil {
+			expressions[definition.Expr] = re
+		}
+	}
+
+	used := map[string]bool{}
+	reported := map[string]bool{} // the steps already reported, as outlines repeat them
+
+	for _, feature := range features {
+		for _, step := range feature.Steps {
+			matches := []string{}
+			for _, definition := range definitions {
+				re, valid := expressions[definition.Expr]
+				if !valid {
+					continue
+				}
+
+				if re.MatchString(step.Text) {
+					used[definition.Expr] = true
+					if !containsString(matches, definition.Expr) {
+						matches = append(matches, definition.Expr)
+					}
+				}
+			}
+
+			key := step.Location + step.Text
+			if reported[key] {
+				continue
+			}
+			reported[key] = true
+
+			location := relativeLocation(suiteDir, step.Location)
+
+			if len(matches) == 0 {
+				issues = append(issues, LintIssue{
+					Location: location,
+					Message:  fmt.Sprintf("undefined step %q", step.Text),
+					Severity: LintError,
+				})
+			} else if len(matches) > 1 {
+				issues = append(issues, LintIssue{
+					Location: location,
+					Message:  fmt.Sprintf("ambiguous step %q matches %q, which takes precedence, and %s", step.Text, matches[0], strings.Join(quoteAll(matches[1:]), ", ")),
+					Severity: LintWarning,
+				})
+			}
+		}
+	}
+
+	for _, definition := range definitions {
+		if definition.Shared || used[definition.Expr] {
+			continue
+		}
+
+		issues = append(issues, LintIssue{
+			Location: definition.Location,
+			Message:  fmt.Sprintf("unused step definition %q", definition.Expr),
+			Severity: LintWarning,
+		})
+	}
+
+	return issues
+}
+
+// lintTags reports the features without tags, as they cannot be run in isolation, the tags with
+// an invalid format, the tags repeated in the same line, and the tags of the suite only differing
+// in their case, as the tag expressions are case sensitive
+func lintTags(suiteDir string, features []Feature) []LintIssue {
+	issues := []LintIssue{}
+	byLowerCase := map[string]FeatureTag{}
+
+	for _, feature := range features {
+		if len(feature.FeatureTags) == 0 {
+			issues = append(issues, LintIssue{
+				Location: relativeLocation(suiteDir, feature.Path),
+				Message:  "the feature has no tags, so it cannot be run in isolation",
+				Severity: LintError,
+			})
+		}
+
+		line := map[string]bool{}
+		lineLocation := ""
+		for _, tag := range feature.Tags {
+			location := relativeLocation(suiteDir, tag.Location)
+			if tag.Location != lineLocation {
+				line = map[string]bool{}
+				lineLocation = tag.Location
+			}
+
+			if !tagPattern.MatchString(tag.Name) {
+				issues = append(issues, LintIssue{
+					Location: location,
+					Message:  fmt.Sprintf("invalid tag %q", tag.Name),
+					Severity: LintError,
+				})
+				continue
+			}
+
+			if line[tag.Name] {
+				issues = append(issues, LintIssue{
+					Location: location,
+					Message:  fmt.Sprintf("duplicated tag %q", tag.Name),
+					Severity: LintWarning,
+				})
+			}
+			line[tag.Name] = true
+
+			lower := strings.ToLower(tag.Name)
+			if previous, exists := byLowerCase[lower]; exists && previous.Name != tag.Name {
+				issues = append(issues, LintIssue{
+					Location: location,
+					Message:  fmt.Sprintf("tag %q differs only in case from %q at %s", tag.Name, previous.Name, relativeLocation(suiteDir, previous.Location)),
+					Severity: LintWarning,
+				})
+				continue
+			}
+			byLowerCase[lower] = tag
+		}
+	}
+
+	return issues
+}
+
+// lessLocation tells whether a location goes before another one, comparing the paths and then
+// the line numbers
+func lessLocation(a string, b string) bool {
+	pathA, lineA := splitLocation(a)
+	pathB, lineB := splitLocation(b)
+
+	if pathA != pathB {
+		return pathA < pathB
+	}
+
+	return lineA < lineB
+}
+
+// parseStepDefinitions returns the steps registered by the Go files of a package dir, and the
+// packages they import
+func parseStepDefinitions(suiteDir string, dir string, shared bool) ([]StepDefinition, []string, error) {
+	fset := token.NewFileSet()
+
+	// the tests of the shared packages do not register steps for the suite
+	filter := func(info os.FileInfo) bool {
+		return !shared || !strings.HasSuffix(info.Name(), "_test.go")
+	}
+
+	pkgs, err := parser.ParseDir(fset, dir, filter, 0)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":   dir,
+			"error": err,
+		}).Error("Could not parse the Go files")
+		return nil, nil, err
+	}
+
+	definitions := []StepDefinition{}
+	imports := []string{}
+
+	// sort the packages and files, so that the steps are returned in a stable order
+	pkgNames := []string{}
+	for name := range pkgs {
+		pkgNames = append(pkgNames, name)
+	}
+	sort.Strings(pkgNames)
+
+	for _, pkgName := range pkgNames {
+		fileNames := []string{}
+		for name := range pkgs[pkgName].Files {
+			fileNames = append(fileNames, name)
+		}
+		sort.Strings(fileNames)
+
+		for _, fileName := range fileNames {
+			file := pkgs[pkgName].Files[fileName]
+
+			for _, imp := range file.Imports {
+				if path, err := strconv.Unquote(imp.Path.Value); err == nil {
+					imports = append(imports, path)
+				}
+			}
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) == 0 {
+					return true
+				}
+
+				selector, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok || selector.Sel.Name != "Step" {
+					return true
+				}
+
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+
+				expr, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					return true
+				}
+
+				position := fset.Position(lit.Pos())
+				definitions = append(definitions, StepDefinition{
+					Expr:     expr,
+					Location: relativeLocation(suiteDir, fmt.Sprintf("%s:%d", position.Filename, position.Line)),
+					Shared:   shared,
+				})
+
+				return true
+			})
+		}
+	}
+
+	return definitions, imports, nil
+}
+
+// parseTableRow returns the trimmed cells of a row of a table
+func parseTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := []string{}
+	for _, cell := range strings.Split(line, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+
+	return cells
+}
+
+// relativeLocation returns a location relative to the dir of the suite
+func relativeLocation(suiteDir string, location string) string {
+	absDir, err := filepath.Abs(suiteDir)
+	if err != nil {
+		return location
+	}
+
+	absLocation, err := filepath.Abs(location)
+	if err != nil {
+		return location
+	}
+
+	rel, err := filepath.Rel(absDir, absLocation)
+	if err != nil {
+		return location
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// splitLocation returns the path and the line number of a location, being 0 if it has no line
+func splitLocation(location string) (string, int) {
+	i := strings.LastIndex(location, ":")
+	if i < 0 {
+		return location, 0
+	}
+
+	line, err := strconv.Atoi(location[i+1:])
+	if err != nil {
+		return location, 0
+	}
+
+	return location[:i], line
+}
+
+// trimStepKeyword returns the text of a step without its keyword, and if the line is a step
+func trimStepKeyword(line string) (string, bool) {
+	for _, keyword := range stepKeywords {
+		if strings.HasPrefix(line, keyword) {
+			return strings.TrimSpace(strings.TrimPrefix(line, keyword)), true
+		}
+	}
+
+	return "", false
+}
+
+// containsString tells whether a slice contains a string
+func containsString(a []string, x string) bool {
+	for _, n := range a {
+		if x == n {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteAll returns the strings quoted
+func quoteAll(a []string) []string {
+	quoted := []string{}
+	for _, s := range a {
+		quoted = append(quoted, strconv.Quote(s))
+	}
+	return quoted
+}
@@ -0,0 +1,104 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+const suiteGoFile = `package main
+
+func InitializeScenario(s *godog.ScenarioContext) {
+	s.Step(` + "`" + `^"([^"]*)" is running$` + "`" + `, serviceIsRunning)
+	s.Step(` + "`" + `^there are "([^"]*)" events in the index$` + "`" + `, thereAreEvents)
+	s.Step(` + "`" + `^there are "([^"]*)" events in the index$` + "`" + `, thereAreEvents)
+	s.Step(` + "`" + `^the service is stopped$` + "`" + `, serviceIsStopped)
+}
+`
+
+const suiteFeatureFile = `@apache
+Feature: Apache
+
+# a comment
+@smoke @smoke
+Scenario Outline: Apache-<version> sends metrics
+  Given "<version>" is running
+    And an undefined step
+  Then there are "<count>" events in the index
+    """
+    Given this is not a step
+    """
+Examples:
+| version | count |
+| 2.2     | 5     |
+| 2.4     | 10    |
+
+@Smoke
+Scenario: Apache is running
+  Given "apache" is running
+`
+
+func TestLintFeatures(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	suiteDir := filet.TmpDir(t, "")
+	featuresDir := path.Join(suiteDir, "features")
+
+	err := MkdirAll(featuresDir)
+	assert.Nil(t, err)
+
+	filet.File(t, path.Join(suiteDir, "suite_test.go"), suiteGoFile)
+	filet.File(t, path.Join(featuresDir, "apache.feature"), suiteFeatureFile)
+	filet.File(t, path.Join(featuresDir, "untagged.feature"), "Feature: Untagged\nScenario: foo\n  Given \"foo\" is running\n")
+
+	issues, err := LintFeatures(suiteDir)
+	assert.Nil(t, err)
+
+	messages := []string{}
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+
+	assert.Equal(t, []string{
+		`features/apache.feature:5: warning: duplicated tag "@smoke"`,
+		`features/apache.feature:8: error: undefined step "an undefined step"`,
+		`features/apache.feature:18: warning: tag "@Smoke" differs only in case from "@smoke" at features/apache.feature:5`,
+		`features/untagged.feature: error: the feature has no tags, so it cannot be run in isolation`,
+		`suite_test.go:6: error: duplicated step definition "^there are \"([^\"]*)\" events in the index$", already registered at suite_test.go:5`,
+		`suite_test.go:7: warning: unused step definition "^the service is stopped$"`,
+	}, messages)
+}
+
+func TestParseFeatureExpandsTheOutlines(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+	featurePath := path.Join(tmpDir, "apache.feature")
+	filet.File(t, featurePath, suiteFeatureFile)
+
+	feature, err := ParseFeature(featurePath)
+	assert.Nil(t, err)
+
+	texts := []string{}
+	for _, step := range feature.Steps {
+		texts = append(texts, step.Text)
+	}
+
+	assert.Equal(t, []string{
+		`"2.2" is running`,
+		"an undefined step",
+		`there are "5" events in the index`,
+		`"2.4" is running`,
+		"an undefined step",
+		`there are "10" events in the index`,
+		`"apache" is running`,
+	}, texts)
+	assert.Equal(t, []string{"@apache"}, feature.FeatureTags)
+	assert.Equal(t, 4, len(feature.Tags))
+}
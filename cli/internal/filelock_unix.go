@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build !windows
+// +build !windows
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lockPollInterval the interval between the attempts to lock a file locked by another process
+const lockPollInterval = 100 * time.Millisecond
+
+// lockTimeout the max time waiting for a file locked by another process
+const lockTimeout = 30 * time.Second
+
+// lockFile takes an exclusive advisory lock of a file, which is created if it does not exist,
+// waiting for the other process holding it, and returning the function releasing it
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+
+		if err != syscall.EWOULDBLOCK || time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s: %v", path, err)
+		}
+
+		log.WithFields(log.Fields{
+			"path": path,
+		}).Trace("Waiting for the lock held by another process")
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -8,12 +8,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/lann/builder"
 	log "github.com/sirupsen/logrus"
 
 	git "gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	ssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
 )
@@ -89,6 +91,87 @@ func (b projectBuilder) withUser(user string) projectBuilder {
 // ProjectBuilder builder for git projects
 var ProjectBuilder = builder.Register(projectBuilder{}, Project{}).(projectBuilder)
 
+// versionPattern matches the major and minor of a version, i.e. 7.13 for 7.13.0-SNAPSHOT
+var versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(\.\d+)?(-.+)?$`)
+
+// BranchOfVersion returns the release branch of a version of an Elastic project, which is named
+// after its major and minor, i.e. 7.13 for 7.13.0-SNAPSHOT
+func BranchOfVersion(version string) (string, error) {
+	matches := versionPattern.FindStringSubmatch(version)
+	if matches == nil {
+		return "", fmt.Errorf("the %s version is not valid, i.e. 7.13.0-SNAPSHOT", version)
+	}
+
+	return matches[1] + "." + matches[2], nil
+}
+
+// Checkout checks out a commit of a cloned project, or the head of its branch if the commit is
+// empty. The branch is fetched from the origin remote first, so that an existing clone is updated,
+// or switched to another branch. It returns the hash of the checked out commit
+func Checkout(project Project, commit string) (string, error) {
+	repository, err := git.PlainOpen(project.GetWorkspace())
+	if err != nil {
+		return "", err
+	}
+
+	remoteRef := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, project.Branch)
+	fetchOptions := &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs: []gitconfig.RefSpec{
+			gitconfig.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(project.Branch), remoteRef)),
+		},
+	}
+
+	if project.Protocol == GitProtocol {
+		auth, err := ssh.NewSSHAgentAuth("git")
+		if err != nil {
+			return "", err
+		}
+		fetchOptions.Auth = auth
+	}
+
+	err = repository.Fetch(fetchOptions)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return "", fmt.Errorf("could not fetch the %s branch of %s: %v", project.Branch, project.GetURL(), err)
+	}
+
+	var hash plumbing.Hash
+	if commit != "" {
+		h, err := repository.ResolveRevision(plumbing.Revision(commit))
+		if err != nil {
+			return "", fmt.Errorf("the %s commit is not in the %s branch of %s: %v", commit, project.Branch, project.GetURL(), err)
+		}
+		hash = *h
+	} else {
+		ref, err := repository.Reference(remoteRef, true)
+		if err != nil {
+			return "", err
+		}
+		hash = ref.Hash()
+	}
+
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Force: true,
+		Hash:  hash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"branch": project.Branch,
+		"commit": hash.String(),
+		"url":    project.GetURL(),
+	}).Debug("Project checked out")
+
+	return hash.String(), nil
+}
+
 // Clone allows cloning an array of repositories simultaneously
 func Clone(repositories ...Project) {
 	repositoriesChannel := make(chan Project, len(repositories))
@@ -7,9 +7,13 @@ package internal
 import (
 	"path"
 	"testing"
+	"time"
 
 	"github.com/Flaque/filet"
 	"github.com/stretchr/testify/assert"
+	git "gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
 const repoBranch = "master"
@@ -74,6 +78,103 @@ func TestBuildWithWellFormedRemote(t *testing.T) {
 	assert.Equal(t, repoRemote, repo.User)
 }
 
+func TestBranchOfVersion(t *testing.T) {
+	branch, err := BranchOfVersion("7.13.0-SNAPSHOT")
+	assert.Nil(t, err)
+	assert.Equal(t, "7.13", branch)
+
+	branch, err = BranchOfVersion("v7.12.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "7.12", branch)
+
+	branch, err = BranchOfVersion("8.0")
+	assert.Nil(t, err)
+	assert.Equal(t, "8.0", branch)
+
+	_, err = BranchOfVersion("master")
+	assert.NotNil(t, err)
+}
+
+func TestCheckout(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	originDir := filet.TmpDir(t, "")
+	origin, err := git.PlainInit(originDir, false)
+	assert.Nil(t, err)
+
+	first := commitFile(t, origin, originDir, "first")
+	second := commitFile(t, origin, originDir, "second")
+
+	gitDir := createGitDir(t)
+	repo := ProjectBuilder.
+		WithBaseWorkspace(gitDir).
+		WithDomain(repoDomain).
+		WithRemote(repoRemote + ":master").
+		WithName(repoName).
+		Build()
+
+	_, err = git.PlainClone(repo.GetWorkspace(), false, &git.CloneOptions{URL: originDir})
+	assert.Nil(t, err)
+
+	hash, err := Checkout(repo, "")
+	assert.Nil(t, err)
+	assert.Equal(t, second, hash)
+
+	hash, err = Checkout(repo, first)
+	assert.Nil(t, err)
+	assert.Equal(t, first, hash)
+	assertFileContent(t, repo, "first")
+
+	// the clone is updated with the new commits of the branch
+	third := commitFile(t, origin, originDir, "third")
+
+	hash, err = Checkout(repo, "")
+	assert.Nil(t, err)
+	assert.Equal(t, third, hash)
+	assertFileContent(t, repo, "third")
+
+	// the clone is switched to another branch
+	worktree, err := origin.Worktree()
+	assert.Nil(t, err)
+	err = worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("7.13"), Create: true})
+	assert.Nil(t, err)
+	backport := commitFile(t, origin, originDir, "backport")
+
+	repo.Branch = "7.13"
+	hash, err = Checkout(repo, "")
+	assert.Nil(t, err)
+	assert.Equal(t, backport, hash)
+
+	repo.Branch = "6.8"
+	_, err = Checkout(repo, "")
+	assert.NotNil(t, err)
+}
+
+func assertFileContent(t *testing.T, repo Project, content string) {
+	bytes, err := ReadFile(path.Join(repo.GetWorkspace(), "file.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(bytes))
+}
+
+// commitFile commits a file with a content into a repository, returning the hash of the commit
+func commitFile(t *testing.T, repository *git.Repository, dir string, content string) string {
+	err := WriteFile([]byte(content), path.Join(dir, "file.txt"))
+	assert.Nil(t, err)
+
+	worktree, err := repository.Worktree()
+	assert.Nil(t, err)
+
+	_, err = worktree.Add("file.txt")
+	assert.Nil(t, err)
+
+	hash, err := worktree.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "e2e", Email: "e2e@elastic.co", When: time.Now()},
+	})
+	assert.Nil(t, err)
+
+	return hash.String()
+}
+
 func TestClone(t *testing.T) {
 	defer filet.CleanUp(t)
 	gitDir := createGitDir(t)
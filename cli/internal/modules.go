@@ -0,0 +1,510 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// healthProbeLabel the label of a service declaring how to check that it's ready, which is
+// defined by the services package
+const healthProbeLabel = "co.elastic.e2e.probe"
+
+// defaultVersionPattern the default version of a service in its compose file, i.e.
+// ${REDIS_VERSION:-3.2.12}
+var defaultVersionPattern = regexp.MustCompile(`\$\{[A-Za-z0-9_]+_VERSION:-([^}]+)\}`)
+
+// hostPortPattern the port of a host of a configuration, i.e. 127.0.0.1:6379 or
+// tcp(127.0.0.1:3306)/
+var hostPortPattern = regexp.MustCompile(`:(\d+)(?:[/)]|$)`)
+
+// ModuleVariant a version of the service monitored by a metricbeat module, in a variant of the
+// service when there are several, i.e. percona for mysql
+type ModuleVariant struct {
+	Variant string // empty if the service has no variants
+	Version string
+}
+
+// ModuleMetadata the metadata of a metricbeat module in the Beats repository: the service of its
+// compose file, its default configuration, and the versions of the service it supports
+type ModuleMetadata struct {
+	Hosts      []string // the default hosts of the module, i.e. 127.0.0.1:6379
+	Metricsets []string // the metricsets of the default configuration, empty for the defaults of the module
+	Name       string
+	Ports      []int // the ports of the container of the service
+	Variants   []ModuleVariant
+	service    yaml.MapSlice // the service in the compose file of the module
+}
+
+// ReadModuleMetadata reads the metadata of a metricbeat module from a checkout of the Beats
+// repository: the docker-compose.yml file of the module, and its _meta/config.yml and
+// _meta/supported-versions.yml files, which are optional
+func ReadModuleMetadata(beatsDir string, module string) (ModuleMetadata, error) {
+	moduleDir := filepath.Join(beatsDir, "metricbeat", "module", module)
+
+	found, err := Exists(moduleDir)
+	if err != nil || !found {
+		return ModuleMetadata{}, fmt.Errorf("the %s module does not exist in %s", module, beatsDir)
+	}
+
+	metadata := ModuleMetadata{Name: module}
+
+	err = metadata.readService(filepath.Join(moduleDir, "docker-compose.yml"))
+	if err != nil {
+		return ModuleMetadata{}, err
+	}
+
+	err = metadata.readConfig(filepath.Join(moduleDir, "_meta", "config.yml"))
+	if err != nil {
+		return ModuleMetadata{}, err
+	}
+
+	err = metadata.readSupportedVersions(filepath.Join(moduleDir, "_meta", "supported-versions.yml"))
+	if err != nil {
+		return ModuleMetadata{}, err
+	}
+
+	// the ports of the services which are not published are the ones of the default hosts
+	if len(metadata.Ports) == 0 {
+		for _, host := range metadata.Hosts {
+			if port := parseHostPort(host); port > 0 {
+				metadata.Ports = append(metadata.Ports, port)
+				break
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"hosts":      metadata.Hosts,
+		"metricsets": metadata.Metricsets,
+		"module":     module,
+		"ports":      metadata.Ports,
+		"variants":   len(metadata.Variants),
+	}).Debug("Metadata of the module read")
+
+	return metadata, nil
+}
+
+// ComposeFile returns the compose file of the service of the module for the tool, without the
+// build context, as the service is run from its image, and with a probe of its first port when
+// the service has no healthcheck, so that the tests wait for it to be ready
+func (m ModuleMetadata) ComposeFile() ([]byte, error) {
+	service := yaml.MapSlice{}
+	hasImage := false
+	hasHealthcheck := false
+	hasPorts := false
+	var labels interface{}
+
+	for _, item := range m.service {
+		key := fmt.Sprint(item.Key)
+		switch key {
+		case "build":
+			continue
+		case "healthcheck":
+			hasHealthcheck = true
+		case "image":
+			hasImage = true
+		case "labels":
+			labels = item.Value
+			continue
+		case "ports":
+			hasPorts = true
+		}
+
+		service = append(service, item)
+	}
+
+	if !hasImage {
+		return nil, fmt.Errorf("the service of the %s module has no image, as it's built from the Beats repository, which is not supported", m.Name)
+	}
+
+	if !hasPorts && len(m.Ports) > 0 {
+		service = append(service, yaml.MapItem{Key: "ports", Value: []string{strconv.Itoa(m.Ports[0])}})
+	}
+
+	if !hasHealthcheck && len(m.Ports) > 0 {
+		probe := fmt.Sprintf("tcp://:%d", m.Ports[0])
+
+		switch l := labels.(type) {
+		case yaml.MapSlice:
+			labels = append(l, yaml.MapItem{Key: healthProbeLabel, Value: probe})
+		case []interface{}:
+			labels = append(l, healthProbeLabel+"="+probe)
+		default:
+			labels = yaml.MapSlice{{Key: healthProbeLabel, Value: probe}}
+		}
+	}
+
+	if labels != nil {
+		service = append(service, yaml.MapItem{Key: "labels", Value: labels})
+	}
+
+	compose := struct {
+		Version  string        `yaml:"version"`
+		Services yaml.MapSlice `yaml:"services"`
+	}{
+		Version:  "2.3",
+		Services: yaml.MapSlice{{Key: m.Name, Value: service}},
+	}
+
+	return yaml.Marshal(&compose)
+}
+
+// Configuration returns the configuration of metricbeat for the module, with the metricsets of
+// its default configuration, and monitoring the service by its name, which is shared by all the
+// variants of the service
+func (m ModuleMetadata) Configuration() []byte {
+	hosts := []string{}
+	for _, host := range m.Hosts {
+		host = strings.ReplaceAll(host, "127.0.0.1", m.Name)
+		host = strings.ReplaceAll(host, "localhost", m.Name)
+		hosts = append(hosts, host)
+	}
+
+	if len(hosts) == 0 {
+		host := m.Name
+		if len(m.Ports) > 0 {
+			host += ":" + strconv.Itoa(m.Ports[0])
+		}
+		hosts = append(hosts, host)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("metricbeat.modules:\n")
+	buf.WriteString("- module: " + m.Name + "\n")
+	if len(m.Metricsets) > 0 {
+		buf.WriteString("  metricsets: [" + strings.Join(quoteAll(m.Metricsets), ", ") + "]\n")
+	}
+	buf.WriteString("  period: 10s\n")
+	buf.WriteString("  enabled: true\n")
+	buf.WriteString("\n")
+	buf.WriteString("  # " + m.title() + " hosts\n")
+	buf.WriteString("  hosts: [" + strings.Join(quoteAll(hosts), ", ") + "]\n")
+
+	return buf.Bytes()
+}
+
+// Feature returns the feature file of the integration tests of the module for the metricbeat
+// suite, with an example for each supported version of the service, which is tagged with the
+// name of the module, as the examples of the integrations feature
+func (m ModuleMetadata) Feature() []byte {
+	hasVariants := false
+	for _, v := range m.Variants {
+		if v.Variant != "" {
+			hasVariants = true
+			break
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("@integrations\n")
+	buf.WriteString("Feature: " + m.title() + " module\n")
+	buf.WriteString("  As a Metricbeat developer I want to check that the " + m.title() + " module works as expected\n")
+	buf.WriteString("\n")
+
+	rows := [][]string{}
+	if hasVariants {
+		buf.WriteString("Scenario Outline: <integration>-<variant>-<version> sends metrics to Elasticsearch without errors\n")
+		buf.WriteString("  Given \"<variant>\" v<version>, variant of \"<integration>\", is running for metricbeat\n")
+		buf.WriteString("  When metricbeat is installed and configured for \"<variant>\", variant of the \"<integration>\" module\n")
+		buf.WriteString("  Then there are \"<variant>\" events in the index\n")
+
+		rows = append(rows, []string{"integration", "variant", "version"})
+		for _, v := range m.Variants {
+			rows = append(rows, []string{m.Name, v.Variant, v.Version})
+		}
+	} else {
+		buf.WriteString("Scenario Outline: <integration>-<version> sends metrics to Elasticsearch without errors\n")
+		buf.WriteString("  Given \"<integration>\" \"<version>\" is running for metricbeat\n")
+		buf.WriteString("  When metricbeat is installed and configured for \"<integration>\" module\n")
+		buf.WriteString("  Then there are \"<integration>\" events in the index\n")
+
+		rows = append(rows, []string{"integration", "version"})
+		for _, v := range m.Variants {
+			rows = append(rows, []string{m.Name, v.Version})
+		}
+	}
+	buf.WriteString("    And there are no errors in the index\n")
+	buf.WriteString("\n")
+	buf.WriteString("@" + m.Name + "\n")
+	buf.WriteString("Examples: " + m.title() + "\n")
+	buf.WriteString(formatTable(rows))
+
+	return buf.Bytes()
+}
+
+// ScaffoldModuleTest writes the files of the integration tests of a metricbeat module: the compose
+// file of its service under a services dir, and its configuration and feature file under the dir
+// of the metricbeat suite, returning their paths. The existing files are not overwritten unless
+// it's forced
+func ScaffoldModuleTest(metadata ModuleMetadata, servicesDir string, suiteDir string, force bool) ([]string, error) {
+	composeFile, err := metadata.ComposeFile()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		content []byte
+		path    string
+	}{
+		{content: composeFile, path: filepath.Join(servicesDir, metadata.Name, "docker-compose.yml")},
+		{content: metadata.Configuration(), path: filepath.Join(suiteDir, "configurations", metadata.Name+".yml")},
+		{content: metadata.Feature(), path: filepath.Join(suiteDir, "features", metadata.Name+".feature")},
+	}
+
+	if !force {
+		for _, f := range files {
+			found, err := Exists(f.path)
+			if err == nil && found {
+				return nil, fmt.Errorf("the %s file already exists, it can be overwritten forcing the generation", f.path)
+			}
+		}
+	}
+
+	paths := []string{}
+	for _, f := range files {
+		err := MkdirAll(filepath.Dir(f.path))
+		if err != nil {
+			return paths, err
+		}
+
+		err = ioutil.WriteFile(f.path, f.content, 0644)
+		if err != nil {
+			return paths, err
+		}
+
+		log.WithFields(log.Fields{
+			"module": metadata.Name,
+			"path":   f.path,
+		}).Debug("File of the tests of the module written")
+
+		paths = append(paths, f.path)
+	}
+
+	return paths, nil
+}
+
+// readConfig reads the metricsets and the hosts of the default configuration of the module
+func (m *ModuleMetadata) readConfig(configPath string) error {
+	found, err := Exists(configPath)
+	if err != nil || !found {
+		log.WithFields(log.Fields{
+			"config": configPath,
+			"module": m.Name,
+		}).Debug("The module has no default configuration")
+		return nil
+	}
+
+	content, err := ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	modules := []struct {
+		Hosts      []string `yaml:"hosts"`
+		Metricsets []string `yaml:"metricsets"`
+		Module     string   `yaml:"module"`
+	}{}
+
+	err = yaml.Unmarshal(content, &modules)
+	if err != nil {
+		return fmt.Errorf("could not parse the default configuration of the %s module: %v", m.Name, err)
+	}
+
+	for _, module := range modules {
+		if module.Module == m.Name {
+			m.Hosts = module.Hosts
+			m.Metricsets = module.Metricsets
+			break
+		}
+	}
+
+	return nil
+}
+
+// readService reads the service of the module in its compose file, which is the one named as the
+// module, or the first one, and the ports of its container
+func (m *ModuleMetadata) readService(composePath string) error {
+	content, err := ReadFile(composePath)
+	if err != nil {
+		return fmt.Errorf("the %s module has no compose file: %v", m.Name, err)
+	}
+
+	compose := struct {
+		Services yaml.MapSlice `yaml:"services"`
+	}{}
+
+	err = yaml.Unmarshal(content, &compose)
+	if err != nil {
+		return fmt.Errorf("could not parse the compose file of the %s module: %v", m.Name, err)
+	}
+
+	if len(compose.Services) == 0 {
+		return fmt.Errorf("the compose file of the %s module has no services", m.Name)
+	}
+
+	item := compose.Services[0]
+	for _, s := range compose.Services {
+		if fmt.Sprint(s.Key) == m.Name {
+			item = s
+			break
+		}
+	}
+
+	service, ok := item.Value.(yaml.MapSlice)
+	if !ok {
+		return fmt.Errorf("the %v service of the compose file of the %s module is not valid", item.Key, m.Name)
+	}
+	m.service = service
+
+	for _, s := range service {
+		if fmt.Sprint(s.Key) != "ports" {
+			continue
+		}
+
+		ports, _ := s.Value.([]interface{})
+		for _, p := range ports {
+			if port := parseContainerPort(fmt.Sprint(p)); port > 0 {
+				m.Ports = append(m.Ports, port)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readSupportedVersions reads the versions of the service supported by the module, and their
+// variants, which are the <SERVICE>_VERSION and <SERVICE>_VARIANT variables of each entry of the
+// file. The default version in the compose file is the only one when the file does not exist
+func (m *ModuleMetadata) readSupportedVersions(versionsPath string) error {
+	found, err := Exists(versionsPath)
+	if err == nil && found {
+		content, err := ReadFile(versionsPath)
+		if err != nil {
+			return err
+		}
+
+		supportedVersions := struct {
+			Variants []map[string]string `yaml:"variants"`
+		}{}
+
+		err = yaml.Unmarshal(content, &supportedVersions)
+		if err != nil {
+			return fmt.Errorf("could not parse the supported versions of the %s module: %v", m.Name, err)
+		}
+
+		for _, env := range supportedVersions.Variants {
+			variant := ModuleVariant{}
+			for k, v := range env {
+				if strings.HasSuffix(k, "_VERSION") {
+					variant.Version = v
+				} else if strings.HasSuffix(k, "_VARIANT") {
+					variant.Variant = v
+				}
+			}
+
+			if variant.Version == "" {
+				variant.Version = m.defaultVersion()
+			}
+
+			m.Variants = append(m.Variants, variant)
+		}
+	}
+
+	if len(m.Variants) == 0 {
+		m.Variants = []ModuleVariant{{Version: m.defaultVersion()}}
+	}
+
+	return nil
+}
+
+// defaultVersion returns the default version of the service in the compose file of the module,
+// or latest if there is none
+func (m ModuleMetadata) defaultVersion() string {
+	for _, item := range m.service {
+		if fmt.Sprint(item.Key) != "image" {
+			continue
+		}
+
+		matches := defaultVersionPattern.FindStringSubmatch(fmt.Sprint(item.Value))
+		if len(matches) == 2 {
+			return matches[1]
+		}
+	}
+
+	return "latest"
+}
+
+// title returns the name of the module for the humans, i.e. Php fpm for php_fpm
+func (m ModuleMetadata) title() string {
+	name := strings.ReplaceAll(m.Name, "_", " ")
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// formatTable returns the rows of a table of examples of a feature file, aligning their columns
+func formatTable(rows [][]string) string {
+	widths := []int{}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, row := range rows {
+		buf.WriteString("|")
+		for i, cell := range row {
+			buf.WriteString(" " + cell + strings.Repeat(" ", widths[i]-len(cell)) + " |")
+		}
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// parseContainerPort returns the port of the container in a port of a compose file, i.e. 3306 for
+// "127.0.0.1:33060:3306/tcp", or zero if it's not valid
+func parseContainerPort(port string) int {
+	port = strings.SplitN(port, "/", 2)[0]
+	parts := strings.Split(port, ":")
+
+	p, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return 0
+	}
+
+	return p
+}
+
+// parseHostPort returns the port of a host of a configuration, i.e. 3306 for
+// "root:secret@tcp(127.0.0.1:3306)/", or zero if it has no port
+func parseHostPort(host string) int {
+	matches := hostPortPattern.FindAllStringSubmatch(host, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+
+	p, err := strconv.Atoi(matches[len(matches)-1][1])
+	if err != nil {
+		return 0
+	}
+
+	return p
+}
@@ -0,0 +1,222 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+const mysqlComposeFile = `version: '2.3'
+
+services:
+  mysql:
+    image: docker.elastic.co/integrations-ci/beats-mysql:${MYSQL_VARIANT:-mysql}-${MYSQL_VERSION:-5.7.12}-1
+    build:
+      context: ./_meta
+      args:
+        MYSQL_IMAGE: ${MYSQL_VARIANT:-mysql}:${MYSQL_VERSION:-5.7.12}
+    ports:
+      - 3306
+`
+
+const mysqlConfigFile = `- module: mysql
+  metricsets:
+    - status
+  #  - galera_status
+  period: 10s
+
+  # Host DSN should be defined as "user:pass@tcp(127.0.0.1:3306)/"
+  hosts: ["root:secret@tcp(127.0.0.1:3306)/"]
+`
+
+const mysqlSupportedVersionsFile = `variants:
+  - MYSQL_VARIANT: mysql
+    MYSQL_VERSION: 5.7
+  - MYSQL_VARIANT: percona
+    MYSQL_VERSION: 8.0.13-4
+  - MYSQL_VARIANT: mariadb
+`
+
+const redisComposeFile = `version: '2.3'
+
+services:
+  redis:
+    image: docker.elastic.co/integrations-ci/beats-redis:${REDIS_VERSION:-3.2.12}-1
+    build:
+      context: ./_meta
+    healthcheck:
+      test: ["CMD", "redis-cli", "ping"]
+`
+
+func writeModule(t *testing.T, beatsDir string, module string, files map[string]string) {
+	moduleDir := path.Join(beatsDir, "metricbeat", "module", module)
+
+	err := MkdirAll(path.Join(moduleDir, "_meta"))
+	assert.Nil(t, err)
+
+	for name, content := range files {
+		filet.File(t, path.Join(moduleDir, name), content)
+	}
+}
+
+func TestReadModuleMetadata(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	beatsDir := filet.TmpDir(t, "")
+	writeModule(t, beatsDir, "mysql", map[string]string{
+		"docker-compose.yml":           mysqlComposeFile,
+		"_meta/config.yml":             mysqlConfigFile,
+		"_meta/supported-versions.yml": mysqlSupportedVersionsFile,
+	})
+
+	metadata, err := ReadModuleMetadata(beatsDir, "mysql")
+	assert.Nil(t, err)
+	assert.Equal(t, "mysql", metadata.Name)
+	assert.Equal(t, []string{"root:secret@tcp(127.0.0.1:3306)/"}, metadata.Hosts)
+	assert.Equal(t, []string{"status"}, metadata.Metricsets)
+	assert.Equal(t, []int{3306}, metadata.Ports)
+	assert.Equal(t, []ModuleVariant{
+		{Variant: "mysql", Version: "5.7"},
+		{Variant: "percona", Version: "8.0.13-4"},
+		{Variant: "mariadb", Version: "5.7.12"},
+	}, metadata.Variants)
+
+	_, err = ReadModuleMetadata(beatsDir, "redis")
+	assert.NotNil(t, err)
+}
+
+func TestReadModuleMetadataWithoutMeta(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	beatsDir := filet.TmpDir(t, "")
+	writeModule(t, beatsDir, "redis", map[string]string{
+		"docker-compose.yml": redisComposeFile,
+	})
+
+	metadata, err := ReadModuleMetadata(beatsDir, "redis")
+	assert.Nil(t, err)
+	assert.Empty(t, metadata.Hosts)
+	assert.Empty(t, metadata.Ports)
+	assert.Equal(t, []ModuleVariant{{Version: "3.2.12"}}, metadata.Variants)
+
+	compose, err := metadata.ComposeFile()
+	assert.Nil(t, err)
+	assert.NotContains(t, string(compose), "build")
+	assert.NotContains(t, string(compose), "co.elastic.e2e.probe")
+	assert.Contains(t, string(compose), "healthcheck")
+
+	assert.Equal(t, `metricbeat.modules:
+- module: redis
+  period: 10s
+  enabled: true
+
+  # Redis hosts
+  hosts: ["redis"]
+`, string(metadata.Configuration()))
+}
+
+func TestModuleMetadataFiles(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	beatsDir := filet.TmpDir(t, "")
+	writeModule(t, beatsDir, "mysql", map[string]string{
+		"docker-compose.yml":           mysqlComposeFile,
+		"_meta/config.yml":             mysqlConfigFile,
+		"_meta/supported-versions.yml": mysqlSupportedVersionsFile,
+	})
+
+	metadata, err := ReadModuleMetadata(beatsDir, "mysql")
+	assert.Nil(t, err)
+
+	compose, err := metadata.ComposeFile()
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  mysql:
+    image: docker.elastic.co/integrations-ci/beats-mysql:${MYSQL_VARIANT:-mysql}-${MYSQL_VERSION:-5.7.12}-1
+    ports:
+    - 3306
+    labels:
+      co.elastic.e2e.probe: tcp://:3306
+`, string(compose))
+
+	assert.Equal(t, `metricbeat.modules:
+- module: mysql
+  metricsets: ["status"]
+  period: 10s
+  enabled: true
+
+  # Mysql hosts
+  hosts: ["root:secret@tcp(mysql:3306)/"]
+`, string(metadata.Configuration()))
+
+	assert.Equal(t, `@integrations
+Feature: Mysql module
+  As a Metricbeat developer I want to check that the Mysql module works as expected
+
+Scenario Outline: <integration>-<variant>-<version> sends metrics to Elasticsearch without errors
+  Given "<variant>" v<version>, variant of "<integration>", is running for metricbeat
+  When metricbeat is installed and configured for "<variant>", variant of the "<integration>" module
+  Then there are "<variant>" events in the index
+    And there are no errors in the index
+
+@mysql
+Examples: Mysql
+| integration | variant | version  |
+| mysql       | mysql   | 5.7      |
+| mysql       | percona | 8.0.13-4 |
+| mysql       | mariadb | 5.7.12   |
+`, string(metadata.Feature()))
+}
+
+func TestScaffoldModuleTest(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	beatsDir := filet.TmpDir(t, "")
+	writeModule(t, beatsDir, "mysql", map[string]string{
+		"docker-compose.yml": mysqlComposeFile,
+	})
+
+	metadata, err := ReadModuleMetadata(beatsDir, "mysql")
+	assert.Nil(t, err)
+
+	targetDir := filet.TmpDir(t, "")
+	servicesDir := path.Join(targetDir, "services")
+	suiteDir := path.Join(targetDir, "metricbeat")
+
+	paths, err := ScaffoldModuleTest(metadata, servicesDir, suiteDir, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		path.Join(servicesDir, "mysql", "docker-compose.yml"),
+		path.Join(suiteDir, "configurations", "mysql.yml"),
+		path.Join(suiteDir, "features", "mysql.feature"),
+	}, paths)
+
+	for _, p := range paths {
+		found, _ := Exists(p)
+		assert.True(t, found)
+	}
+
+	_, err = ScaffoldModuleTest(metadata, servicesDir, suiteDir, false)
+	assert.NotNil(t, err)
+
+	_, err = ScaffoldModuleTest(metadata, servicesDir, suiteDir, true)
+	assert.Nil(t, err)
+}
+
+func TestParsePorts(t *testing.T) {
+	assert.Equal(t, 3306, parseContainerPort("3306"))
+	assert.Equal(t, 3306, parseContainerPort("127.0.0.1:33060:3306/tcp"))
+	assert.Equal(t, 0, parseContainerPort("${MYSQL_PORT}"))
+
+	assert.Equal(t, 3306, parseHostPort("root:secret@tcp(127.0.0.1:3306)/"))
+	assert.Equal(t, 6379, parseHostPort("127.0.0.1:6379"))
+	assert.Equal(t, 8080, parseHostPort("http://localhost:8080/status"))
+	assert.Equal(t, 0, parseHostPort("http://127.0.0.1"))
+}
@@ -5,119 +5,411 @@
 package internal
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 
 	"gopkg.in/yaml.v2"
 )
 
-// stateRun represents a Run
-type stateRun struct {
-	ID       string            // ID of the run
-	Profile  stateService      // profile of the run (Optional)
+// stateSchemaVersion the version of the schema of the state files written by the tool. The state
+// files without version were written before the schema was versioned, and they are migrated when
+// they are read
+const stateSchemaVersion = 2
+
+// Run represents the state of a run of a profile or a service, as persisted in its state file
+type Run struct {
 	Env      map[string]string // environment for the run
-	Services []stateService    // services in the run
+	ID       string            // ID of the run, i.e. fleet-profile or apache-service
+	Profile  string            // name of the profile of the run, empty for a service
+	Services []string          // names of the services added to the run
+}
+
+// Store persists the state of the runs of the profiles and services, so that the environment
+// of a run is recovered when it's updated or stopped
+type Store interface {
+	// Destroy destroys the state of a run
+	Destroy(id string) error
+	// List returns the state of the runs, sorted by their ID
+	List() ([]Run, error)
+	// Recover returns the environment of a run, which is empty if the run has no state
+	Recover(id string) (map[string]string, error)
+	// Update persists the state of a run, from the compose files of its profile and services
+	Update(id string, composeFilePaths []string, env map[string]string) error
 }
 
-// stateService represents a service in a Run
-type stateService struct {
-	Name string
+// stateRun represents a Run in a state file
+type stateRun struct {
+	Version  int               `yaml:"version"`
+	ID       string            `yaml:"id"`
+	Profile  string            `yaml:"profile,omitempty"`
+	Services []string          `yaml:"services"`
+	Env      map[string]string `yaml:"env"`
+}
+
+// legacyStateRun represents a Run in the state files without schema version, which nested the
+// names of the profile and services in objects
+type legacyStateRun struct {
+	ID      string `yaml:"id"`
+	Profile struct {
+		Name string `yaml:"name"`
+	} `yaml:"profile"`
+	Env      map[string]string `yaml:"env"`
+	Services []struct {
+		Name string `yaml:"name"`
+	} `yaml:"services"`
 }
 
-// Recover recovers the state for a run
-func Recover(id string, workdir string) map[string]string {
+// newStateRun returns the state of a run, from the compose files of its profile and services.
+// The first compose file is the one of the profile for the runs of a profile
+func newStateRun(id string, composeFilePaths []string, env map[string]string) stateRun {
 	run := stateRun{
-		Env: map[string]string{},
+		Version:  stateSchemaVersion,
+		ID:       id,
+		Env:      env,
+		Services: []string{},
+	}
+
+	if strings.HasSuffix(id, "-profile") && len(composeFilePaths) > 0 {
+		run.Profile = filepath.Base(filepath.Dir(composeFilePaths[0]))
+	}
+
+	for i, f := range composeFilePaths {
+		if i > 0 {
+			run.Services = append(run.Services, filepath.Base(filepath.Dir(f)))
+		}
 	}
 
-	stateFile := filepath.Join(workdir, id+".run")
-	bytes, err := ReadFile(stateFile) //nolint
+	return run
+}
+
+// parseStateRun parses the state of a run, migrating the state files written with a previous
+// schema, which is reported, and failing for the ones written with a newer schema
+func parseStateRun(bytes []byte) (stateRun, bool, error) {
+	versioned := struct {
+		Version int `yaml:"version"`
+	}{}
+
+	err := yaml.Unmarshal(bytes, &versioned)
 	if err != nil {
-		return run.Env
+		return stateRun{}, false, err
+	}
+
+	if versioned.Version > stateSchemaVersion {
+		return stateRun{}, false, fmt.Errorf("the schema version of the state is %d, newer than the %d version supported by the tool", versioned.Version, stateSchemaVersion)
+	}
+
+	if versioned.Version == stateSchemaVersion {
+		run := stateRun{}
+		err = yaml.Unmarshal(bytes, &run)
+		return run, false, err
 	}
 
-	err = yaml.Unmarshal(bytes, &run)
+	legacy := legacyStateRun{}
+	err = yaml.Unmarshal(bytes, &legacy)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"stateFile": stateFile,
-		}).Error("Could not unmarshal state")
+		return stateRun{}, false, err
+	}
+
+	run := stateRun{
+		Version:  stateSchemaVersion,
+		ID:       legacy.ID,
+		Profile:  legacy.Profile.Name,
+		Env:      legacy.Env,
+		Services: []string{},
+	}
+	for _, service := range legacy.Services {
+		run.Services = append(run.Services, service.Name)
 	}
 
-	return run.Env
+	return run, true, nil
 }
 
-// Destroy destroys the state for a run
-func Destroy(id string, workdir string) {
-	stateFile := filepath.Join(workdir, id+".run")
-	err := os.Remove(stateFile)
+// toRun returns the run of a state
+func (r stateRun) toRun(id string) Run {
+	env := map[string]string{}
+	for k, v := range r.Env {
+		env[k] = v
+	}
+
+	return Run{
+		Env:      env,
+		ID:       id,
+		Profile:  r.Profile,
+		Services: append([]string{}, r.Services...),
+	}
+}
+
+// fileStore the store persisting the state of each run in a file of a workdir, i.e.
+// fleet-profile.run, which is locked while it's read or written, so that the concurrent runs of
+// the tool do not corrupt it
+type fileStore struct {
+	workdir string
+}
+
+// NewFileStore returns a store persisting the state of the runs in the files of a workdir, which
+// by default is the state dir of the tool's workspace
+func NewFileStore(workdir string) Store {
+	return &fileStore{workdir: workdir}
+}
+
+// Destroy removes the state file of a run
+func (s *fileStore) Destroy(id string) error {
+	unlock, err := lockFile(s.lockPath(id))
 	if err != nil {
-		log.WithFields(log.Fields{
-			"error":     err,
-			"stateFile": stateFile,
-		}).Warn("Could not destroy state")
+		return err
+	}
+	defer unlock()
 
-		return
+	stateFile := s.statePath(id)
+	err = os.Remove(stateFile)
+	if err != nil {
+		return err
 	}
 
 	log.WithFields(log.Fields{
 		"stateFile": stateFile,
 	}).Trace("State destroyed")
+
+	return nil
 }
 
-// Update updates the state of en execution, using ID as the file name for the run.
-// The state file will be located under 'workdir', which by default will be the tool's
-// workspace.
-func Update(id string, workdir string, composeFilePaths []string, env map[string]string) {
-	stateFile := filepath.Join(workdir, id+".run")
+// List returns the state of the runs persisted in the workdir, sorted by their ID. The state
+// files which cannot be read are skipped
+func (s *fileStore) List() ([]Run, error) {
+	runs := []Run{}
+
+	stateFiles, err := filepath.Glob(filepath.Join(s.workdir, "*.run"))
+	if err != nil {
+		return runs, err
+	}
+
+	sort.Strings(stateFiles)
+
+	for _, stateFile := range stateFiles {
+		id := strings.TrimSuffix(filepath.Base(stateFile), ".run")
+
+		run, exists, err := s.read(id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"stateFile": stateFile,
+			}).Warn("Could not read state")
+			continue
+		}
+		if !exists {
+			continue
+		}
+
+		runs = append(runs, run.toRun(id))
+	}
+
+	return runs, nil
+}
+
+// Recover returns the environment persisted in the state file of a run
+func (s *fileStore) Recover(id string) (map[string]string, error) {
+	run, _, err := s.read(id)
+	if err != nil {
+		return map[string]string{}, err
+	}
+
+	return run.toRun(id).Env, nil
+}
+
+// Update writes the state file of a run, replacing it atomically
+func (s *fileStore) Update(id string, composeFilePaths []string, env map[string]string) error {
+	stateFile := s.statePath(id)
 
 	log.WithFields(log.Fields{
-		"dir":       workdir,
+		"dir":       s.workdir,
 		"stateFile": stateFile,
 	}).Trace("Updating state")
 
-	run := stateRun{
-		ID:       id,
-		Env:      env,
-		Services: []stateService{},
+	unlock, err := lockFile(s.lockPath(id))
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	if strings.HasSuffix(id, "-profile") {
-		run.Profile = stateService{
-			Name: filepath.Base(filepath.Dir(composeFilePaths[0])),
+	err = s.write(newStateRun(id, composeFilePaths, env))
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"dir":       s.workdir,
+		"stateFile": stateFile,
+	}).Trace("State updated")
+
+	return nil
+}
+
+// lockPath returns the path of the lock of the state file of a run, which is not removed, as
+// removing it while it's locked would let another run lock a new file
+func (s *fileStore) lockPath(id string) string {
+	return filepath.Join(s.workdir, id+".lock")
+}
+
+// read reads the state file of a run, reporting if it exists. The state files written with a
+// previous schema are migrated, persisting them with the current one
+func (s *fileStore) read(id string) (stateRun, bool, error) {
+	stateFile := s.statePath(id)
+
+	found, err := Exists(stateFile)
+	if err != nil || !found {
+		return stateRun{Env: map[string]string{}}, false, nil
+	}
+
+	unlock, err := lockFile(s.lockPath(id))
+	if err != nil {
+		return stateRun{Env: map[string]string{}}, false, err
+	}
+	defer unlock()
+
+	bytes, err := ioutil.ReadFile(stateFile)
+	if err != nil {
+		// the state was destroyed before it was locked
+		if os.IsNotExist(err) {
+			return stateRun{Env: map[string]string{}}, false, nil
 		}
+		return stateRun{Env: map[string]string{}}, false, err
 	}
 
-	args := []string{}
-	for i, f := range composeFilePaths {
-		args = append(args, "-f", f)
+	run, migrated, err := parseStateRun(bytes)
+	if err != nil {
+		return stateRun{Env: map[string]string{}}, true, fmt.Errorf("could not parse the %s state file: %v", stateFile, err)
+	}
 
-		if i > 0 {
-			run.Services = append(run.Services, stateService{
-				Name: filepath.Base(filepath.Dir(f)),
-			})
+	if migrated {
+		run.ID = id
+
+		err = s.write(run)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"stateFile": stateFile,
+			}).Warn("Could not persist the migrated state")
+		} else {
+			log.WithFields(log.Fields{
+				"stateFile": stateFile,
+				"version":   stateSchemaVersion,
+			}).Debug("State migrated to the current schema")
 		}
 	}
-	args = append(args, "config")
 
+	return run, true, nil
+}
+
+// statePath returns the path of the state file of a run
+func (s *fileStore) statePath(id string) string {
+	return filepath.Join(s.workdir, id+".run")
+}
+
+// write writes the state file of a run into a temporary file, which replaces the state file, so
+// that it's never read partially written. The lock of the run must be held
+func (s *fileStore) write(run stateRun) error {
 	bytes, err := yaml.Marshal(&run)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"stateFile": stateFile,
-		}).Error("Could not marshal state")
+		return err
 	}
 
-	err = WriteFile(bytes, stateFile) //nolint
+	tmpFile, err := ioutil.TempFile(s.workdir, "."+run.ID+".run.*")
 	if err != nil {
-		log.WithFields(log.Fields{
-			"stateFile": stateFile,
-		}).Error("Could not create state file")
+		return err
 	}
 
-	log.WithFields(log.Fields{
-		"dir":       workdir,
-		"stateFile": stateFile,
-	}).Trace("State updated")
+	_, err = tmpFile.Write(bytes)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+
+	err = os.Rename(tmpFile.Name(), s.statePath(run.ID))
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+
+	return nil
+}
+
+// memoryStore the store keeping the state of the runs in memory, which is lost when the process
+// exits, i.e. for the programs running the services of a test suite on their own
+type memoryStore struct {
+	mutex sync.Mutex
+	runs  map[string]stateRun
+}
+
+// NewMemoryStore returns a store keeping the state of the runs in memory
+func NewMemoryStore() Store {
+	return &memoryStore{runs: map[string]stateRun{}}
+}
+
+// Destroy removes the state of a run
+func (s *memoryStore) Destroy(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.runs[id]; !exists {
+		return fmt.Errorf("there is no state for the %s run", id)
+	}
+
+	delete(s.runs, id)
+	return nil
+}
+
+// List returns the state of the runs, sorted by their ID
+func (s *memoryStore) List() ([]Run, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	runs := []Run{}
+	for id, run := range s.runs {
+		runs = append(runs, run.toRun(id))
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+
+	return runs, nil
+}
+
+// Recover returns the environment of a run
+func (s *memoryStore) Recover(id string) (map[string]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	run, exists := s.runs[id]
+	if !exists {
+		return map[string]string{}, nil
+	}
+
+	return run.toRun(id).Env, nil
+}
+
+// Update keeps the state of a run, copying its environment
+func (s *memoryStore) Update(id string, composeFilePaths []string, env map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	run := newStateRun(id, composeFilePaths, nil)
+	run.Env = map[string]string{}
+	for k, v := range env {
+		run.Env[k] = v
+	}
+
+	s.runs[id] = run
+	return nil
 }
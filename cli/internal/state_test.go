@@ -5,13 +5,24 @@
 package internal
 
 import (
+	"fmt"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/Flaque/filet"
 	"github.com/stretchr/testify/assert"
 )
 
+const legacyStateFile = `id: fleet-profile
+profile:
+  name: fleet
+env:
+  stackVersion: 8.0.0-SNAPSHOT
+services:
+- name: elastic-agent
+`
+
 func TestRecover(t *testing.T) {
 	defer filet.CleanUp(t)
 
@@ -32,19 +43,33 @@ func TestRecover(t *testing.T) {
 
 	_ = MkdirAll(workspace)
 
-	Update(ID, workspace, composeFiles, initialEnv)
+	store := NewFileStore(workspace)
+
+	err := store.Update(ID, composeFiles, initialEnv)
+	assert.Nil(t, err)
 
 	runFile := filepath.Join(workspace, ID+".run")
 	e, _ := Exists(runFile)
 	assert.True(t, e)
 
-	env := Recover(ID, workspace)
+	env, err := store.Recover(ID)
+	assert.Nil(t, err)
 
 	value, e := env["foo"]
 	assert.True(t, e)
 	assert.Equal(t, "bar", value)
 }
 
+func TestRecoverWithoutState(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	env, err := NewFileStore(tmpDir).Recover("missing-profile")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{}, env)
+}
+
 func TestUpdateCreatesStateFile(t *testing.T) {
 	defer filet.CleanUp(t)
 
@@ -62,8 +87,189 @@ func TestUpdateCreatesStateFile(t *testing.T) {
 	runFile := filepath.Join(workspace, ID+".run")
 	_ = MkdirAll(runFile)
 
-	Update(ID, workspace, composeFiles, map[string]string{})
+	_ = NewFileStore(workspace).Update(ID, composeFiles, map[string]string{})
 
 	e, _ := Exists(runFile)
 	assert.True(t, e)
 }
+
+func TestUpdateWritesSchemaVersion(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+
+	err := NewFileStore(workspace).Update("fleet-profile", []string{
+		filepath.Join(workspace, "compose/profiles/fleet/docker-compose.yml"),
+		filepath.Join(workspace, "compose/services/elastic-agent/docker-compose.yml"),
+	}, map[string]string{"stackVersion": "8.0.0-SNAPSHOT"})
+	assert.Nil(t, err)
+
+	bytes, err := ReadFile(filepath.Join(workspace, "fleet-profile.run"))
+	assert.Nil(t, err)
+	assert.Equal(t, `version: 2
+id: fleet-profile
+profile: fleet
+services:
+- elastic-agent
+env:
+  stackVersion: 8.0.0-SNAPSHOT
+`, string(bytes))
+}
+
+func TestUpdateConcurrently(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			store := NewFileStore(workspace)
+			err := store.Update("apache-service", []string{"compose/services/apache/docker-compose.yml"}, map[string]string{"run": fmt.Sprint(i)})
+			assert.Nil(t, err)
+
+			_, err = store.Recover("apache-service")
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	runs, err := NewFileStore(workspace).List()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(runs))
+	assert.Contains(t, runs[0].Env, "run")
+}
+
+func TestDestroy(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	store := NewFileStore(workspace)
+
+	_ = store.Update("apache-service", []string{}, map[string]string{"foo": "bar"})
+
+	err := store.Destroy("apache-service")
+	assert.Nil(t, err)
+
+	e, _ := Exists(filepath.Join(workspace, "apache-service.run"))
+	assert.False(t, e)
+
+	assert.NotNil(t, store.Destroy("apache-service"))
+}
+
+func TestList(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	workspace := filepath.Join(tmpDir, ".op")
+	_ = MkdirAll(workspace)
+
+	store := NewFileStore(workspace)
+
+	_ = store.Update("fleet-profile", []string{
+		filepath.Join(workspace, "compose/profiles/fleet/docker-compose.yml"),
+		filepath.Join(workspace, "compose/services/elastic-agent/docker-compose.yml"),
+	}, map[string]string{"stackVersion": "8.0.0-SNAPSHOT"})
+	_ = store.Update("apache-service", []string{
+		filepath.Join(workspace, "compose/services/apache/docker-compose.yml"),
+	}, map[string]string{})
+	_ = WriteFile([]byte("not: [valid"), filepath.Join(workspace, "broken-profile.run"))
+
+	runs, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(runs))
+
+	assert.Equal(t, "apache-service", runs[0].ID)
+	assert.Equal(t, "", runs[0].Profile)
+	assert.Equal(t, 0, len(runs[0].Services))
+
+	assert.Equal(t, "fleet-profile", runs[1].ID)
+	assert.Equal(t, "fleet", runs[1].Profile)
+	assert.Equal(t, []string{"elastic-agent"}, runs[1].Services)
+	assert.Equal(t, "8.0.0-SNAPSHOT", runs[1].Env["stackVersion"])
+}
+
+func TestListWithoutState(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	runs, err := NewFileStore(filepath.Join(tmpDir, "missing")).List()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(runs))
+}
+
+func TestMigrateLegacyState(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	stateFile := filepath.Join(workspace, "fleet-profile.run")
+	_ = WriteFile([]byte(legacyStateFile), stateFile)
+
+	store := NewFileStore(workspace)
+
+	runs, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, "fleet", runs[0].Profile)
+	assert.Equal(t, []string{"elastic-agent"}, runs[0].Services)
+	assert.Equal(t, "8.0.0-SNAPSHOT", runs[0].Env["stackVersion"])
+
+	// the migrated state is persisted with the current schema
+	bytes, err := ReadFile(stateFile)
+	assert.Nil(t, err)
+
+	run, migrated, err := parseStateRun(bytes)
+	assert.Nil(t, err)
+	assert.False(t, migrated)
+	assert.Equal(t, stateSchemaVersion, run.Version)
+	assert.Equal(t, "fleet", run.Profile)
+}
+
+func TestRecoverNewerSchemaVersion(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	workspace := filet.TmpDir(t, "")
+	_ = WriteFile([]byte("version: 99\nid: fleet-profile\n"), filepath.Join(workspace, "fleet-profile.run"))
+
+	env, err := NewFileStore(workspace).Recover("fleet-profile")
+	assert.NotNil(t, err)
+	assert.Equal(t, map[string]string{}, env)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	env := map[string]string{"foo": "bar"}
+	err := store.Update("metricbeat-profile", []string{
+		"compose/profiles/metricbeat/docker-compose.yml",
+		"compose/services/redis/docker-compose.yml",
+	}, env)
+	assert.Nil(t, err)
+	_ = store.Update("apache-service", []string{"compose/services/apache/docker-compose.yml"}, map[string]string{})
+
+	// the environment is copied
+	env["foo"] = "baz"
+
+	recovered, err := store.Recover("metricbeat-profile")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, recovered)
+
+	runs, err := store.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(runs))
+	assert.Equal(t, "apache-service", runs[0].ID)
+	assert.Equal(t, "metricbeat", runs[1].Profile)
+	assert.Equal(t, []string{"redis"}, runs[1].Services)
+
+	assert.Nil(t, store.Destroy("apache-service"))
+	assert.NotNil(t, store.Destroy("apache-service"))
+
+	recovered, err = store.Recover("apache-service")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{}, recovered)
+}
@@ -5,11 +5,19 @@
 package main
 
 import (
+	"os"
+
 	"github.com/elastic/e2e-testing/cli/cmd"
 	"github.com/elastic/e2e-testing/cli/config"
 )
 
 func init() {
+	// the check command reports the missing binaries itself, with how to install them
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		config.InitWorkspace()
+		return
+	}
+
 	config.Init()
 }
 
@@ -7,7 +7,7 @@
 set -exo pipefail
 
 readonly supportedOSS=("darwin" "linux" "windows")
-readonly supportedArchs=("386" "amd64")
+readonly supportedArchs=("386" "amd64" "arm64")
 
 arch="${TARGET_ARCH}"
 extension=""
@@ -34,10 +34,10 @@ fi
 
 if [[ "${TARGET_ARCH}" != "" ]]; then
     # GO_ARCH represents the Golang's supported Architectures.
-    # Possible values: 386, amd64
+    # Possible values: 386, amd64, arm64
     readonly GO_ARCH="${TARGET_ARCH:-amd64}"
     if [[ ! " ${supportedArchs[@]} " =~ " ${GO_ARCH} " ]]; then
-        echo "It's not possible to build a binary for ${GO_ARCH}. Supported values: 386, amd64"
+        echo "It's not possible to build a binary for ${GO_ARCH}. Supported values: 386, amd64, arm64"
         exit 1
     fi
 
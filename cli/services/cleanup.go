@@ -0,0 +1,199 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	log "github.com/sirupsen/logrus"
+)
+
+// the kinds of the resources created by the tool, in the order they are removed, as the networks
+// and the volumes cannot be removed while a container uses them
+const (
+	containerKind = "container"
+	networkKind   = "network"
+	volumeKind    = "volume"
+)
+
+var resourceKinds = []string{containerKind, networkKind, volumeKind}
+
+// CleanupOptions the options selecting the resources left behind by previous runs
+type CleanupOptions struct {
+	DryRun    bool          // only lists the resources, without removing them
+	OlderThan time.Duration // only the resources created before, zero for all of them
+	RunID     string        // only the resources of a run, empty for all of them
+	Suite     string        // only the resources of a test suite, empty for all of them
+}
+
+// OrphanResource a container, a network or a volume created by a previous run, identified by the
+// labels of the run
+type OrphanResource struct {
+	Created  time.Time `json:"created"`
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"` // container, network or volume
+	Name     string    `json:"name"`
+	RunID    string    `json:"runId"`
+	Scenario string    `json:"scenario,omitempty"`
+	Suite    string    `json:"suite,omitempty"`
+}
+
+// Cleanup removes the containers, the networks and the volumes created by previous runs, i.e.
+// interrupted CI jobs, and the state of their profiles and services, returning the resources
+// removed, or the ones which would be removed in a dry run. The resources of the current run are
+// never removed
+func Cleanup(options CleanupOptions) ([]OrphanResource, error) {
+	resources, err := listRunResources()
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := selectOrphans(resources, options, config.GetRunID(), time.Now())
+	if options.DryRun {
+		return orphans, nil
+	}
+
+	removed := []OrphanResource{}
+	removedRuns := map[string]bool{}
+	for _, orphan := range orphans {
+		switch orphan.Kind {
+		case containerKind:
+			err = docker.RemoveContainer(orphan.ID)
+		case networkKind:
+			err = docker.RemoveNetwork(orphan.ID)
+		case volumeKind:
+			err = docker.RemoveVolume(orphan.Name)
+		}
+		if err != nil {
+			continue
+		}
+
+		removed = append(removed, orphan)
+		removedRuns[orphan.RunID] = true
+	}
+
+	for _, run := range listState() {
+		if removedRuns[run.Env[config.RunIDKey]] {
+			destroyState(run.ID)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"orphans": len(orphans),
+		"removed": len(removed),
+	}).Debug("The resources of previous runs have been cleaned up")
+
+	if len(removed) < len(orphans) {
+		return removed, fmt.Errorf("could not remove %d of the %d resources of previous runs", len(orphans)-len(removed), len(orphans))
+	}
+
+	return removed, nil
+}
+
+// listRunResources returns the containers, the networks and the volumes labelled with a run
+func listRunResources() ([]OrphanResource, error) {
+	resources := []OrphanResource{}
+
+	containers, err := docker.ListLabelledContainers(config.RunIDLabel)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range containers {
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+
+		resources = append(resources, newOrphanResource(containerKind, container.ID, name, time.Unix(container.Created, 0), container.Labels))
+	}
+
+	networks, err := docker.ListLabelledNetworks(config.RunIDLabel)
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		resources = append(resources, newOrphanResource(networkKind, network.ID, network.Name, network.Created, network.Labels))
+	}
+
+	volumes, err := docker.ListLabelledVolumes(config.RunIDLabel)
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range volumes {
+		// the volumes created by old versions of Docker have no creation time, so they are
+		// considered as old as they can be
+		created, _ := time.Parse(time.RFC3339, volume.CreatedAt)
+
+		resources = append(resources, newOrphanResource(volumeKind, volume.Name, volume.Name, created, volume.Labels))
+	}
+
+	return resources, nil
+}
+
+// newOrphanResource returns a resource, reading the run which created it from its labels
+func newOrphanResource(kind string, id string, name string, created time.Time, labels map[string]string) OrphanResource {
+	return OrphanResource{
+		Created:  created.UTC(),
+		ID:       id,
+		Kind:     kind,
+		Name:     name,
+		RunID:    labels[config.RunIDLabel],
+		Scenario: labels[config.ScenarioLabel],
+		Suite:    labels[config.SuiteLabel],
+	}
+}
+
+// selectOrphans returns the resources matching the options at a time, except the ones of the
+// current run, sorted in the order they must be removed: the containers, the networks and the
+// volumes, by name
+func selectOrphans(resources []OrphanResource, options CleanupOptions, currentRunID string, now time.Time) []OrphanResource {
+	orphans := []OrphanResource{}
+
+	for _, resource := range resources {
+		if resource.RunID == "" || resource.RunID == currentRunID {
+			continue
+		}
+
+		if options.RunID != "" && resource.RunID != options.RunID {
+			continue
+		}
+
+		if options.Suite != "" && resource.Suite != options.Suite {
+			continue
+		}
+
+		if options.OlderThan > 0 && now.Sub(resource.Created) < options.OlderThan {
+			continue
+		}
+
+		orphans = append(orphans, resource)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		if orphans[i].Kind != orphans[j].Kind {
+			return kindOrder(orphans[i].Kind) < kindOrder(orphans[j].Kind)
+		}
+
+		return orphans[i].Name < orphans[j].Name
+	})
+
+	return orphans
+}
+
+// kindOrder returns the position of a kind of resource in the order they are removed
+func kindOrder(kind string) int {
+	for i, k := range resourceKinds {
+		if k == kind {
+			return i
+		}
+	}
+
+	return len(resourceKinds)
+}
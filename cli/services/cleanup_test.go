@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var cleanupTime = time.Date(2020, 12, 1, 12, 0, 0, 0, time.UTC)
+
+var runResources = []OrphanResource{
+	{Created: cleanupTime.Add(-2 * time.Hour), ID: "vol", Kind: volumeKind, Name: "fleet_data", RunID: "run-1", Suite: "fleet"},
+	{Created: cleanupTime.Add(-2 * time.Hour), ID: "net", Kind: networkKind, Name: "fleet_default", RunID: "run-1", Suite: "fleet"},
+	{Created: cleanupTime.Add(-2 * time.Hour), ID: "kb", Kind: containerKind, Name: "fleet_kibana_1", RunID: "run-1", Suite: "fleet"},
+	{Created: cleanupTime.Add(-2 * time.Hour), ID: "es", Kind: containerKind, Name: "fleet_elasticsearch_1", RunID: "run-1", Suite: "fleet"},
+	{Created: cleanupTime.Add(-10 * time.Minute), ID: "mb", Kind: containerKind, Name: "metricbeat_metricbeat_1", RunID: "run-2", Scenario: "Redis", Suite: "metricbeat"},
+	{Created: cleanupTime.Add(-1 * time.Minute), ID: "agent", Kind: containerKind, Name: "fleet_centos-systemd_1", RunID: "current", Suite: "fleet"},
+}
+
+func orphanNames(orphans []OrphanResource) []string {
+	names := []string{}
+	for _, orphan := range orphans {
+		names = append(names, orphan.Name)
+	}
+
+	return names
+}
+
+func TestSelectOrphansSkipsTheCurrentRun(t *testing.T) {
+	orphans := selectOrphans(runResources, CleanupOptions{}, "current", cleanupTime)
+
+	assert.Equal(t, []string{"fleet_elasticsearch_1", "fleet_kibana_1", "metricbeat_metricbeat_1", "fleet_default", "fleet_data"}, orphanNames(orphans))
+}
+
+func TestSelectOrphansOfARun(t *testing.T) {
+	orphans := selectOrphans(runResources, CleanupOptions{RunID: "run-2"}, "current", cleanupTime)
+
+	assert.Equal(t, []string{"metricbeat_metricbeat_1"}, orphanNames(orphans))
+}
+
+func TestSelectOrphansOfASuite(t *testing.T) {
+	orphans := selectOrphans(runResources, CleanupOptions{Suite: "fleet"}, "current", cleanupTime)
+
+	assert.Equal(t, []string{"fleet_elasticsearch_1", "fleet_kibana_1", "fleet_default", "fleet_data"}, orphanNames(orphans))
+}
+
+func TestSelectOrphansOlderThan(t *testing.T) {
+	orphans := selectOrphans(runResources, CleanupOptions{OlderThan: time.Hour}, "current", cleanupTime)
+
+	assert.Equal(t, []string{"fleet_elasticsearch_1", "fleet_kibana_1", "fleet_default", "fleet_data"}, orphanNames(orphans))
+}
+
+func TestNewOrphanResource(t *testing.T) {
+	labels := map[string]string{
+		config.RunIDLabel:    "run-1",
+		config.ScenarioLabel: "Deploying the agent",
+		config.SuiteLabel:    "fleet",
+	}
+
+	resource := newOrphanResource(containerKind, "abc", "fleet_kibana_1", cleanupTime, labels)
+
+	assert.Equal(t, OrphanResource{Created: cleanupTime, ID: "abc", Kind: containerKind, Name: "fleet_kibana_1", RunID: "run-1", Scenario: "Deploying the agent", Suite: "fleet"}, resource)
+}
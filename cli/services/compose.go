@@ -0,0 +1,624 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/elastic/e2e-testing/cli/config"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	homedir "github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v2"
+)
+
+// composeProject the services, the networks and the volumes of the compose files of a project,
+// with their variables replaced and their overrides merged, as docker-compose does
+type composeProject struct {
+	name     string
+	networks map[string]composeResource // the labels of the default network
+	services map[string]*composeService
+	volumes  map[string]composeResource
+}
+
+// composeResource a network or a volume of a compose file
+type composeResource struct {
+	Labels composeMapping `yaml:"labels"`
+}
+
+// composeService the options of a service of a compose file supported by the Docker API service
+// manager, which are the ones used by the compose files bundled with the tool
+type composeService struct {
+	Command       composeCommand      `yaml:"command"`
+	CPUs          float64             `yaml:"cpus"`
+	ContainerName string              `yaml:"container_name"`
+	DependsOn     composeDependencies `yaml:"depends_on"`
+	Entrypoint    composeCommand      `yaml:"entrypoint"`
+	Environment   composeMapping      `yaml:"environment"`
+	Healthcheck   *composeHealthcheck `yaml:"healthcheck"`
+	Hostname      string              `yaml:"hostname"`
+	Image         string              `yaml:"image"`
+	Labels        composeMapping      `yaml:"labels"`
+	MemLimit      string              `yaml:"mem_limit"`
+	Networks      composeNetworks     `yaml:"networks"`
+	Ports         []string            `yaml:"ports"`
+	Privileged    bool                `yaml:"privileged"`
+	Profiles      []string            `yaml:"profiles"` // the service only runs when one of them is active
+	User          string              `yaml:"user"`
+	Volumes       []string            `yaml:"volumes"`
+	WorkingDir    string              `yaml:"working_dir"`
+}
+
+// composeHealthcheck the healthcheck of a service of a compose file
+type composeHealthcheck struct {
+	Disable     bool           `yaml:"disable"`
+	Interval    string         `yaml:"interval"`
+	Retries     int            `yaml:"retries"`
+	StartPeriod string         `yaml:"start_period"`
+	Test        composeCommand `yaml:"test"`
+	Timeout     string         `yaml:"timeout"`
+}
+
+// rawComposeFile a compose file as it's parsed
+type rawComposeFile struct {
+	Networks map[string]composeResource `yaml:"networks"`
+	Services map[string]*composeService `yaml:"services"`
+	Volumes  map[string]composeResource `yaml:"volumes"`
+}
+
+// composeCommand a command of a compose file, which is a list of args or a string, which is split
+// into args as a shell does. A string is kept as the only arg in a healthcheck, where it's run by
+// the shell of the container
+type composeCommand struct {
+	args  []string
+	shell string // the command when it's a string
+}
+
+// UnmarshalYAML parses a command from a list of args or a string
+func (c *composeCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var shell string
+	if err := unmarshal(&shell); err == nil {
+		c.shell = shell
+		c.args = splitCommand(shell)
+		return nil
+	}
+
+	return unmarshal(&c.args)
+}
+
+// isSet checks if the command was set in the compose file
+func (c composeCommand) isSet() bool {
+	return c.shell != "" || len(c.args) > 0
+}
+
+// composeDependencies the services a service depends on, with the condition to start it: a list of
+// services, which are started before, or a map with their conditions, i.e. service_healthy
+type composeDependencies map[string]string
+
+// UnmarshalYAML parses the dependencies from a list of services or a map with their conditions
+func (d *composeDependencies) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	dependencies := composeDependencies{}
+
+	var services []string
+	if err := unmarshal(&services); err == nil {
+		for _, service := range services {
+			dependencies[service] = "service_started"
+		}
+		*d = dependencies
+		return nil
+	}
+
+	var conditions map[string]struct {
+		Condition string `yaml:"condition"`
+	}
+	if err := unmarshal(&conditions); err != nil {
+		return err
+	}
+
+	for service, condition := range conditions {
+		if condition.Condition == "" {
+			condition.Condition = "service_started"
+		}
+		dependencies[service] = condition.Condition
+	}
+	*d = dependencies
+
+	return nil
+}
+
+// composeNetworks the networks of a service of a compose file, with its aliases in each of them: a
+// list of networks, or a map with their options
+type composeNetworks map[string][]string
+
+// UnmarshalYAML parses the networks from a list of networks or a map with their aliases
+func (n *composeNetworks) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	networks := composeNetworks{}
+
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		for _, name := range names {
+			networks[name] = []string{}
+		}
+		*n = networks
+		return nil
+	}
+
+	var options map[string]*struct {
+		Aliases []string `yaml:"aliases"`
+	}
+	if err := unmarshal(&options); err != nil {
+		return err
+	}
+
+	for name, option := range options {
+		networks[name] = []string{}
+		if option != nil {
+			networks[name] = option.Aliases
+		}
+	}
+	*n = networks
+
+	return nil
+}
+
+// composeMapping the environment or the labels of a service of a compose file: a list of
+// name=value entries, or a map
+type composeMapping map[string]string
+
+// UnmarshalYAML parses the mapping from a list of name=value entries or a map
+func (m *composeMapping) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	mapping := composeMapping{}
+
+	var entries []string
+	if err := unmarshal(&entries); err == nil {
+		for _, entry := range entries {
+			parts := strings.SplitN(entry, "=", 2)
+			if len(parts) == 1 {
+				mapping[parts[0]] = ""
+				continue
+			}
+			mapping[parts[0]] = parts[1]
+		}
+		*m = mapping
+		return nil
+	}
+
+	var values map[string]string
+	if err := unmarshal(&values); err != nil {
+		return err
+	}
+
+	for name, value := range values {
+		mapping[name] = value
+	}
+	*m = mapping
+
+	return nil
+}
+
+// loadComposeProject parses the compose files of a project, replacing their variables with the
+// values in an environment, and merging them in order, so that the later ones override the
+// services of the former ones, as docker-compose does with its -f flags. The services with
+// profiles of the compose specification are skipped unless one of them is active in the environment
+func loadComposeProject(project string, composeFilePaths []string, env map[string]string) (*composeProject, error) {
+	result := &composeProject{
+		name:     strings.ToLower(project),
+		networks: map[string]composeResource{},
+		services: map[string]*composeService{},
+		volumes:  map[string]composeResource{},
+	}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		compose := rawComposeFile{}
+		err = yaml.Unmarshal([]byte(expandEnv(string(bytes), env)), &compose)
+		if err != nil {
+			return nil, fmt.Errorf("Could not parse the compose file: %s - %v", composeFilePath, err)
+		}
+
+		for name, network := range compose.Networks {
+			result.networks[name] = mergeResource(result.networks[name], network)
+		}
+		for name, volume := range compose.Volumes {
+			result.volumes[name] = mergeResource(result.volumes[name], volume)
+		}
+
+		for name, service := range compose.Services {
+			if service == nil {
+				service = &composeService{}
+			}
+
+			volumes, err := resolveVolumes(filepath.Dir(composeFilePath), service.Volumes)
+			if err != nil {
+				return nil, fmt.Errorf("Could not resolve the volumes of the service: %s - %v", name, err)
+			}
+			service.Volumes = volumes
+
+			if existing, exists := result.services[name]; exists {
+				existing.merge(service)
+				continue
+			}
+			result.services[name] = service
+		}
+	}
+
+	activeProfiles := config.GetComposeProfiles(env)
+	for name, service := range result.services {
+		if !service.isActive(activeProfiles) {
+			delete(result.services, name)
+		}
+	}
+
+	for name, service := range result.services {
+		if service.Image == "" {
+			return nil, fmt.Errorf("The service has no image: %s", name)
+		}
+
+		for dependency := range service.DependsOn {
+			if _, exists := result.services[dependency]; !exists {
+				return nil, fmt.Errorf("The service %s depends on an undefined service: %s", name, dependency)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// containerName returns the name of the container of a service, i.e. fleet_elasticsearch_1, or
+// the one set in its compose file
+func (p *composeProject) containerName(service string) string {
+	if name := p.services[service].ContainerName; name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("%s_%s_1", p.name, service)
+}
+
+// networkName returns the name of the default network of the project, i.e. fleet_default
+func (p *composeProject) networkName() string {
+	return projectNetworkName(p.name)
+}
+
+// startOrder returns the services sorted so that each service comes after the services it depends
+// on, and by name otherwise. It fails if the dependencies have a cycle
+func (p *composeProject) startOrder() ([]string, error) {
+	names := []string{}
+	for name := range p.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ordered := []string{}
+	visited := map[string]bool{}
+	visiting := map[string]bool{}
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("The dependencies of the services have a cycle: %s", name)
+		}
+		visiting[name] = true
+
+		dependencies := []string{}
+		for dependency := range p.services[name].DependsOn {
+			dependencies = append(dependencies, dependency)
+		}
+		sort.Strings(dependencies)
+
+		for _, dependency := range dependencies {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		ordered = append(ordered, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// volumeName returns the name of a named volume of the project, i.e. fleet_data
+func (p *composeProject) volumeName(volume string) string {
+	return p.name + "_" + volume
+}
+
+// healthConfig returns the healthcheck of a container from the one of its compose file
+func (h *composeHealthcheck) healthConfig() (*container.HealthConfig, error) {
+	if h.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}, nil
+	}
+
+	health := &container.HealthConfig{
+		Retries: h.Retries,
+	}
+
+	if h.Test.shell != "" {
+		health.Test = []string{"CMD-SHELL", h.Test.shell}
+	} else if len(h.Test.args) > 0 {
+		health.Test = h.Test.args
+	}
+
+	durations := []struct {
+		value  string
+		target *time.Duration
+	}{
+		{h.Interval, &health.Interval},
+		{h.StartPeriod, &health.StartPeriod},
+		{h.Timeout, &health.Timeout},
+	}
+	for _, duration := range durations {
+		if duration.value == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(duration.value)
+		if err != nil {
+			return nil, fmt.Errorf("The duration of the healthcheck is not valid: %s - %v", duration.value, err)
+		}
+		*duration.target = d
+	}
+
+	return health, nil
+}
+
+// isActive checks if a service runs with the active profiles of the compose specification: the
+// services without profiles always run, and the others when any of their profiles is active
+func (s *composeService) isActive(activeProfiles []string) bool {
+	if len(s.Profiles) == 0 {
+		return true
+	}
+
+	for _, profile := range s.Profiles {
+		for _, active := range activeProfiles {
+			if profile == active {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// merge merges the options of a service of an override compose file into a service: the options
+// with a single value are replaced, the environment, the labels and the dependencies are merged,
+// and the ports and the volumes are appended, replacing the volumes mounted at the same path
+func (s *composeService) merge(override *composeService) {
+	if override.Command.isSet() {
+		s.Command = override.Command
+	}
+	if override.CPUs != 0 {
+		s.CPUs = override.CPUs
+	}
+	if override.ContainerName != "" {
+		s.ContainerName = override.ContainerName
+	}
+	if override.Entrypoint.isSet() {
+		s.Entrypoint = override.Entrypoint
+	}
+	if override.Hostname != "" {
+		s.Hostname = override.Hostname
+	}
+	if override.Image != "" {
+		s.Image = override.Image
+	}
+	if override.MemLimit != "" {
+		s.MemLimit = override.MemLimit
+	}
+	if override.Privileged {
+		s.Privileged = true
+	}
+	if len(override.Profiles) > 0 {
+		s.Profiles = override.Profiles
+	}
+	if override.User != "" {
+		s.User = override.User
+	}
+	if override.WorkingDir != "" {
+		s.WorkingDir = override.WorkingDir
+	}
+
+	if override.Healthcheck != nil {
+		if s.Healthcheck == nil {
+			s.Healthcheck = &composeHealthcheck{}
+		}
+		s.Healthcheck.merge(override.Healthcheck)
+	}
+
+	s.DependsOn = composeDependencies(mergeMapping(s.DependsOn, override.DependsOn))
+	s.Environment = mergeMapping(s.Environment, override.Environment)
+	s.Labels = mergeMapping(s.Labels, override.Labels)
+
+	s.Ports = append(s.Ports, override.Ports...)
+
+	for name, aliases := range override.Networks {
+		if s.Networks == nil {
+			s.Networks = composeNetworks{}
+		}
+		s.Networks[name] = appendUnique(s.Networks[name], aliases...)
+	}
+
+	for _, volume := range override.Volumes {
+		target := volumeTarget(volume)
+
+		replaced := false
+		for i, existing := range s.Volumes {
+			if volumeTarget(existing) == target {
+				s.Volumes[i] = volume
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			s.Volumes = append(s.Volumes, volume)
+		}
+	}
+}
+
+// merge merges the options of a healthcheck of an override compose file into a healthcheck
+func (h *composeHealthcheck) merge(override *composeHealthcheck) {
+	if override.Disable {
+		h.Disable = true
+	}
+	if override.Interval != "" {
+		h.Interval = override.Interval
+	}
+	if override.Retries > 0 {
+		h.Retries = override.Retries
+	}
+	if override.StartPeriod != "" {
+		h.StartPeriod = override.StartPeriod
+	}
+	if override.Test.isSet() {
+		h.Test = override.Test
+	}
+	if override.Timeout != "" {
+		h.Timeout = override.Timeout
+	}
+}
+
+// mergeMapping returns a mapping with the values of another one merged, which override the values
+// with the same name
+func mergeMapping(mapping map[string]string, override map[string]string) map[string]string {
+	if len(mapping) == 0 && len(override) == 0 {
+		return mapping
+	}
+
+	merged := map[string]string{}
+	for name, value := range mapping {
+		merged[name] = value
+	}
+	for name, value := range override {
+		merged[name] = value
+	}
+
+	return merged
+}
+
+// appendUnique appends values to a list, skipping the ones already in it
+func appendUnique(values []string, others ...string) []string {
+	for _, other := range others {
+		if !contains(values, other) {
+			values = append(values, other)
+		}
+	}
+
+	return values
+}
+
+// mergeResource merges the labels of a network or a volume of an override compose file
+func mergeResource(resource composeResource, override composeResource) composeResource {
+	return composeResource{Labels: mergeMapping(resource.Labels, override.Labels)}
+}
+
+// resolveVolumes resolves the local paths of the volumes of a service relative to the dir of its
+// compose file, and the home dir, as docker-compose does. The named volumes are kept
+func resolveVolumes(dir string, volumes []string) ([]string, error) {
+	resolved := make([]string, len(volumes))
+
+	for i, volume := range volumes {
+		parts := strings.SplitN(volume, ":", 2)
+		source := parts[0]
+
+		if len(parts) == 1 || !isLocalPath(source) {
+			resolved[i] = volume
+			continue
+		}
+
+		if strings.HasPrefix(source, "~") {
+			expanded, err := homedir.Expand(source)
+			if err != nil {
+				return nil, err
+			}
+			source = expanded
+		} else if !filepath.IsAbs(source) {
+			source = filepath.Join(dir, source)
+		}
+
+		resolved[i] = source + ":" + parts[1]
+	}
+
+	return resolved, nil
+}
+
+// isLocalPath checks if the source of a volume is a path in the host, and not a named volume
+func isLocalPath(source string) bool {
+	return strings.HasPrefix(source, ".") || strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~")
+}
+
+// splitCommand splits a command into its args as a shell does, honouring the single and the double
+// quotes, and the escaped chars
+func splitCommand(command string) []string {
+	args := []string{}
+
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args
+}
+
+// volumeTarget returns the path in the container where a volume is mounted
+func volumeTarget(volume string) string {
+	parts := strings.Split(volume, ":")
+	if len(parts) == 1 {
+		return parts[0]
+	}
+
+	return parts[1]
+}
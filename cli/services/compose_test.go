@@ -0,0 +1,204 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Flaque/filet"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+const profileComposeFile = `version: '2.3'
+services:
+  elasticsearch:
+    healthcheck:
+      test: ["CMD", "curl", "-f", "http://127.0.0.1:9200/"]
+      retries: 300
+      interval: 1s
+    environment:
+      - ES_JAVA_OPTS=-Xms1g -Xmx1g
+      - network.host=
+    image: "docker.elastic.co/observability-ci/elasticsearch:${stackVersion:-8.0.0-SNAPSHOT}"
+    ports:
+      - "${elasticsearchPort:-9200}:9200"
+  kibana:
+    depends_on:
+      elasticsearch:
+        condition: service_healthy
+    healthcheck:
+      test: "curl -f http://localhost:5601/login | grep kbn-injected-metadata"
+    image: "docker.elastic.co/observability-ci/kibana:${stackVersion:-8.0.0-SNAPSHOT}"
+    volumes:
+      - ./kibana.yml:/usr/share/kibana/config/kibana.yml
+`
+
+func TestLoadComposeProject(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, profileComposeFile)
+
+	project, err := loadComposeProject("Fleet", []string{profile}, map[string]string{"stackVersion": "7.13.0"})
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet", project.name)
+	assert.Equal(t, "fleet_default", project.networkName())
+	assert.Equal(t, "fleet_kibana_1", project.containerName("kibana"))
+
+	elasticsearch := project.services["elasticsearch"]
+	assert.Equal(t, "docker.elastic.co/observability-ci/elasticsearch:7.13.0", elasticsearch.Image)
+	assert.Equal(t, []string{"9200:9200"}, elasticsearch.Ports)
+	assert.Equal(t, composeMapping{"ES_JAVA_OPTS": "-Xms1g -Xmx1g", "network.host": ""}, elasticsearch.Environment)
+
+	kibana := project.services["kibana"]
+	assert.Equal(t, composeDependencies{"elasticsearch": "service_healthy"}, kibana.DependsOn)
+	assert.Equal(t, []string{path.Join(tmpDir, "kibana.yml") + ":/usr/share/kibana/config/kibana.yml"}, kibana.Volumes)
+}
+
+func TestLoadComposeProjectMergesTheOverrides(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, profileComposeFile)
+
+	override := path.Join(tmpDir, "override.yml")
+	filet.File(t, override, `version: '2.3'
+services:
+  elasticsearch:
+    environment:
+      ES_JAVA_OPTS: "-Xms2g -Xmx2g"
+    labels:
+      co.elastic.e2e.run-id: "20201201T101530-3fa2b1"
+    healthcheck:
+      retries: 10
+  kibana:
+    command: kibana --verbose "--elasticsearch.hosts=http://elasticsearch:9200"
+    volumes:
+      - /tmp/kibana.yml:/usr/share/kibana/config/kibana.yml:ro
+`)
+
+	project, err := loadComposeProject("fleet", []string{profile, override}, map[string]string{})
+	assert.Nil(t, err)
+
+	elasticsearch := project.services["elasticsearch"]
+	assert.Equal(t, "-Xms2g -Xmx2g", elasticsearch.Environment["ES_JAVA_OPTS"])
+	assert.Equal(t, "", elasticsearch.Environment["network.host"])
+	assert.Equal(t, "20201201T101530-3fa2b1", elasticsearch.Labels["co.elastic.e2e.run-id"])
+	assert.Equal(t, 10, elasticsearch.Healthcheck.Retries)
+	assert.Equal(t, "1s", elasticsearch.Healthcheck.Interval)
+
+	kibana := project.services["kibana"]
+	assert.Equal(t, []string{"kibana", "--verbose", "--elasticsearch.hosts=http://elasticsearch:9200"}, kibana.Command.args)
+	assert.Equal(t, []string{"/tmp/kibana.yml:/usr/share/kibana/config/kibana.yml:ro"}, kibana.Volumes)
+}
+
+func TestLoadComposeProjectWithAnUndefinedDependency(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, service, `version: '2.3'
+services:
+  kibana:
+    depends_on:
+      - elasticsearch
+    image: kibana
+`)
+
+	_, err := loadComposeProject("kibana", []string{service}, map[string]string{})
+	assert.NotNil(t, err)
+}
+
+func TestLoadComposeProjectWithComposeProfiles(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, `services:
+  elasticsearch:
+    image: elasticsearch
+  fleet-server:
+    image: elastic-agent
+    profiles: ["fleet-server"]
+  apm-server:
+    image: apm-server
+    profiles: ["apm-server", "all"]
+`)
+
+	project, err := loadComposeProject("fleet", []string{profile}, map[string]string{"COMPOSE_PROFILES": ""})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(project.services))
+	assert.NotNil(t, project.services["elasticsearch"])
+
+	project, err = loadComposeProject("fleet", []string{profile}, map[string]string{"COMPOSE_PROFILES": "fleet-server, all"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(project.services))
+}
+
+func TestComposeHealthcheck(t *testing.T) {
+	healthcheck := &composeHealthcheck{
+		Interval: "1s",
+		Retries:  300,
+		Test:     composeCommand{shell: "curl -f http://localhost:5601", args: splitCommand("curl -f http://localhost:5601")},
+	}
+
+	health, err := healthcheck.healthConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, &container.HealthConfig{
+		Interval: time.Second,
+		Retries:  300,
+		Test:     []string{"CMD-SHELL", "curl -f http://localhost:5601"},
+	}, health)
+
+	disabled, err := (&composeHealthcheck{Disable: true}).healthConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"NONE"}, disabled.Test)
+
+	_, err = (&composeHealthcheck{Interval: "often"}).healthConfig()
+	assert.NotNil(t, err)
+}
+
+func TestStartOrder(t *testing.T) {
+	project := &composeProject{
+		services: map[string]*composeService{
+			"elastic-agent":    {DependsOn: composeDependencies{"kibana": "service_started"}},
+			"elasticsearch":    {},
+			"kibana":           {DependsOn: composeDependencies{"elasticsearch": "service_healthy", "package-registry": "service_healthy"}},
+			"package-registry": {},
+		},
+	}
+
+	order, err := project.startOrder()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"elasticsearch", "package-registry", "kibana", "elastic-agent"}, order)
+}
+
+func TestStartOrderWithACycle(t *testing.T) {
+	project := &composeProject{
+		services: map[string]*composeService{
+			"elasticsearch": {DependsOn: composeDependencies{"kibana": "service_started"}},
+			"kibana":        {DependsOn: composeDependencies{"elasticsearch": "service_started"}},
+		},
+	}
+
+	_, err := project.startOrder()
+	assert.NotNil(t, err)
+}
+
+func TestSplitCommand(t *testing.T) {
+	assert.Equal(t, []string{"/lib/systemd/systemd"}, splitCommand("/lib/systemd/systemd"))
+	assert.Equal(t, []string{"sh", "-c", "echo 'it works'"}, splitCommand(`sh -c "echo 'it works'"`))
+	assert.Equal(t, []string{"echo", "a b", "c"}, splitCommand(`echo a\ b  c`))
+	assert.Equal(t, []string{"echo", ""}, splitCommand(`echo ''`))
+}
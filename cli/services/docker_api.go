@@ -0,0 +1,784 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	log "github.com/sirupsen/logrus"
+)
+
+// the labels docker-compose puts to the resources of a project, which the tool uses to find them
+const (
+	composeConfigHashLabel      = "com.docker.compose.config-hash"
+	composeContainerNumberLabel = "com.docker.compose.container-number"
+	composeNetworkLabel         = "com.docker.compose.network"
+	composeOneoffLabel          = "com.docker.compose.oneoff"
+	composeProjectLabel         = "com.docker.compose.project"
+	composeVolumeLabel          = "com.docker.compose.volume"
+)
+
+// DockerAPIServiceManager implementation of the service manager interface running the compose
+// files with the Docker API, so that the docker-compose binary is not needed. The compose files are
+// parsed and their services are run as docker-compose does: in the default network of the project,
+// with the names and the labels of docker-compose, so that the rest of the tool finds them in the
+// same manner. The operations which use the Docker API already are the ones of the docker-compose
+// service manager
+type DockerAPIServiceManager struct {
+	DockerServiceManager
+}
+
+// containerSpec the options creating the container of a service
+type containerSpec struct {
+	Config           *container.Config
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+}
+
+// composeRun the args of a docker-compose run command
+type composeRun struct {
+	cmds         []string
+	env          map[string]string
+	name         string
+	service      string
+	servicePorts bool
+	user         string
+}
+
+// NewDockerAPIServiceManager returns a new service manager for the Docker API
+func NewDockerAPIServiceManager() *DockerAPIServiceManager {
+	return &DockerAPIServiceManager{}
+}
+
+// AddServicesToCompose runs services in the project of a running profile
+func (sm *DockerAPIServiceManager) AddServicesToCompose(profile string, composeNames []string, env map[string]string) error {
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"services": composeNames,
+	}).Trace("Adding services to the profile with the Docker API")
+
+	newComposeNames := []string{profile}
+	newComposeNames = append(newComposeNames, composeNames...)
+
+	persistedEnv := recoverState(profile + "-profile")
+	for k, v := range env {
+		persistedEnv[k] = v
+	}
+
+	return sm.up(true, newComposeNames, persistedEnv)
+}
+
+// RemoveServicesFromCompose removes the containers of services from the project of a running profile
+func (sm *DockerAPIServiceManager) RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error {
+	for _, composeName := range composeNames {
+		err := removeServiceContainers(config.GetComposeProjectName(profile), composeName)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"profile": profile,
+				"service": composeName,
+			}).Error("Could not remove service from the profile")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"profile": profile,
+			"service": composeName,
+		}).Debug("Service removed from the profile")
+	}
+
+	return nil
+}
+
+// RunCommand executes a docker-compose command in the project of a running profile, translated to
+// the Docker API: exec, logs, ps, restart, run and up are supported
+func (sm *DockerAPIServiceManager) RunCommand(profile string, composeNames []string, composeArgs []string, env map[string]string) error {
+	if len(composeArgs) == 0 {
+		return fmt.Errorf("There is no docker-compose command to run with the Docker API")
+	}
+
+	project := config.GetComposeProjectName(profile)
+	ctx := context.Background()
+
+	switch composeArgs[0] {
+	case "exec":
+		composeExec, err := parseComposeExec(composeArgs[1:])
+		if err != nil {
+			return err
+		}
+
+		return execComposeService(ctx, project, composeExec)
+	case "logs":
+		return StreamLogs(ctx, profile, composeServiceArgs(composeArgs[1:]), LogsOptions{}, os.Stdout)
+	case "ps":
+		containers, err := docker.ListComposeContainers(project)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(containers, func(i, j int) bool {
+			return containerName(containers[i]) < containerName(containers[j])
+		})
+		for _, container := range containers {
+			fmt.Printf("%s\t%s\t%s\n", containerName(container), container.Labels[composeServiceLabel], container.Status)
+		}
+		return nil
+	case "restart":
+		containers, err := docker.ListComposeContainers(project)
+		if err != nil {
+			return err
+		}
+
+		containers, err = selectServiceContainers(containers, composeServiceArgs(composeArgs[1:]))
+		if err != nil {
+			return err
+		}
+
+		for _, container := range containers {
+			err := docker.RestartContainer(ctx, container.ID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "run":
+		run, err := parseComposeRun(composeArgs[1:])
+		if err != nil {
+			return err
+		}
+
+		persistedEnv := recoverState(profile + "-profile")
+		for k, v := range env {
+			persistedEnv[k] = v
+		}
+
+		return sm.run(composeNames, run, persistedEnv)
+	case "up":
+		return sm.up(true, composeNames, env)
+	}
+
+	log.WithFields(log.Fields{
+		"args":    composeArgs,
+		"profile": profile,
+	}).Error("The docker-compose command is not supported with the Docker API")
+	return fmt.Errorf("The %s command of docker-compose is not supported by the Docker API service manager", composeArgs[0])
+}
+
+// RunCompose runs the services of a profile, or a service, with the Docker API
+func (sm *DockerAPIServiceManager) RunCompose(isProfile bool, composeNames []string, env map[string]string) error {
+	return sm.up(isProfile, composeNames, env)
+}
+
+// ScaleService runs a number of replicas of a service in the project of a running profile, as
+// "docker-compose up --scale" does: the first replica is run as the rest of services, and the
+// missing replicas are run next to it, with the number of the replica in their names and labels.
+// The replicas above the number of replicas are removed
+func (sm *DockerAPIServiceManager) ScaleService(profile string, service string, replicas int, env map[string]string) error {
+	if replicas < 1 {
+		return fmt.Errorf("The %s service cannot be scaled to %d replicas", service, replicas)
+	}
+
+	persistedEnv := recoverState(profile + "-profile")
+	for k, v := range env {
+		persistedEnv[k] = v
+	}
+
+	err := sm.up(true, []string{profile, service}, persistedEnv)
+	if err != nil {
+		return err
+	}
+
+	invocation, err := newComposeInvocation(true, []string{profile, service}, persistedEnv)
+	if err != nil {
+		return err
+	}
+
+	project, err := loadComposeProject(invocation.project, invocation.invokedFilePaths, renderEnvironment(invocation.env))
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.ListComposeContainers(project.name)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	running := map[int]bool{}
+	for _, current := range containers {
+		if current.Labels[composeServiceLabel] != service || current.Labels[composeOneoffLabel] == "True" {
+			continue
+		}
+
+		number, _ := strconv.Atoi(current.Labels[composeContainerNumberLabel])
+		if number <= replicas {
+			running[number] = true
+			continue
+		}
+
+		err := docker.RemoveContainer(current.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for number := 2; number <= replicas; number++ {
+		if running[number] {
+			continue
+		}
+
+		name, spec, err := newReplicaSpec(project, service, number)
+		if err != nil {
+			return err
+		}
+
+		_, err = docker.RunContainer(ctx, name, spec.Config, spec.HostConfig, spec.NetworkingConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"replicas": replicas,
+		"service":  service,
+	}).Debug("The service has been scaled with the Docker API")
+
+	return nil
+}
+
+// StopCompose removes the containers and the default network of the project of a profile, or a
+// service, as "docker-compose down" does. The volumes of a profile are removed too, as "docker-compose
+// down --volumes" does, while the ones of a service are kept
+func (sm *DockerAPIServiceManager) StopCompose(isProfile bool, composeNames []string) error {
+	ID := composeNames[0] + "-service"
+	if isProfile {
+		ID = composeNames[0] + "-profile"
+	}
+
+	project := config.GetComposeProjectName(composeNames[0])
+
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+	}
+
+	for _, container := range containers {
+		err := docker.RemoveContainer(container.ID)
+		if err != nil {
+			return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+		}
+	}
+
+	networks, err := docker.ListLabelledNetworks(composeProjectLabel + "=" + strings.ToLower(project))
+	if err != nil {
+		return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+	}
+
+	for _, network := range networks {
+		err := docker.RemoveNetwork(network.ID)
+		if err != nil {
+			return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+		}
+	}
+
+	if isProfile {
+		volumes, err := docker.ListLabelledVolumes(composeProjectLabel + "=" + strings.ToLower(project))
+		if err != nil {
+			return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+		}
+
+		for _, volume := range volumes {
+			err := docker.RemoveVolume(volume.Name)
+			if err != nil {
+				return fmt.Errorf("Could not stop the project: %s - %v", project, err)
+			}
+		}
+	}
+	defer destroyState(ID)
+
+	log.WithFields(log.Fields{
+		"profile": composeNames[0],
+		"project": project,
+	}).Trace("Project stopped with the Docker API.")
+
+	return nil
+}
+
+// run runs a one-off container of a service in the project of a running profile, as
+// "docker-compose run -d" does. The services it depends on are not started
+func (sm *DockerAPIServiceManager) run(composeNames []string, run composeRun, env map[string]string) error {
+	invocation, err := newComposeInvocation(true, composeNames, env)
+	if err != nil {
+		return err
+	}
+
+	project, err := loadComposeProject(invocation.project, invocation.invokedFilePaths, renderEnvironment(invocation.env))
+	if err != nil {
+		return err
+	}
+
+	if _, exists := project.services[run.service]; !exists {
+		return fmt.Errorf("The service is not defined in the compose files: %s", run.service)
+	}
+
+	spec, err := newContainerSpec(project, run.service)
+	if err != nil {
+		return err
+	}
+
+	spec.Config.Labels[composeOneoffLabel] = "True"
+	if len(run.cmds) > 0 {
+		spec.Config.Cmd = run.cmds
+	}
+	if run.user != "" {
+		spec.Config.User = run.user
+	}
+	for name, value := range run.env {
+		spec.Config.Env = append(spec.Config.Env, name+"="+value)
+	}
+	if !run.servicePorts {
+		spec.HostConfig.PortBindings = nil
+	}
+
+	name := run.name
+	if name == "" {
+		name = fmt.Sprintf("%s_%s_run_%d", project.name, run.service, time.Now().UnixNano())
+	}
+
+	ctx := context.Background()
+
+	err = ensureImage(ctx, spec.Config.Image)
+	if err != nil {
+		return err
+	}
+
+	_, err = docker.RunContainer(ctx, name, spec.Config, spec.HostConfig, spec.NetworkingConfig)
+	return err
+}
+
+// up runs the services of the compose files of a profile, or a service, creating the default
+// network and the volumes of the project. The containers whose options did not change are kept,
+// as docker-compose does, and the services wait for the services they depend on to be healthy
+// when they declare that condition
+func (sm *DockerAPIServiceManager) up(isProfile bool, composeNames []string, env map[string]string) error {
+	invocation, err := newComposeInvocation(isProfile, composeNames, env)
+	if err != nil {
+		return err
+	}
+
+	project, err := loadComposeProject(invocation.project, invocation.invokedFilePaths, renderEnvironment(invocation.env))
+	if err != nil {
+		return err
+	}
+
+	err = sm.CreateNetwork(composeNames[0], invocation.env)
+	if err != nil {
+		return fmt.Errorf("Could not run compose file: %v - %v", invocation.filePaths, err)
+	}
+
+	err = runComposeProject(context.Background(), project)
+	if err != nil {
+		return fmt.Errorf("Could not run compose file: %v - %v", invocation.filePaths, err)
+	}
+
+	defer updateState(invocation.id, invocation.filePaths, invocation.env)
+
+	log.WithFields(log.Fields{
+		"composeFilePaths": invocation.filePaths,
+		"env":              invocation.env,
+		"profile":          composeNames[0],
+	}).Debug("Compose files run with the Docker API.")
+
+	return nil
+}
+
+// hash returns a hash of the options of a container, so that the container is recreated when
+// they change only
+func (s containerSpec) hash() (string, error) {
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bytes)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// composeServiceArgs returns the services of the args of a docker-compose command, skipping its flags
+func composeServiceArgs(args []string) []string {
+	services := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			services = append(services, arg)
+		}
+	}
+
+	return services
+}
+
+// ensureImage pulls an image if it's not present
+func ensureImage(ctx context.Context, image string) error {
+	if docker.ImageExists(ctx, image) {
+		return nil
+	}
+
+	return docker.PullImage(ctx, image, config.GetDockerPlatform())
+}
+
+// execComposeService executes a command in the container of a service of a project, as
+// "docker-compose exec" does, writing its output. It fails if the command exits with an error,
+// unless it's detached
+func execComposeService(ctx context.Context, project string, composeExec composeExec) error {
+	container, err := docker.GetComposeServiceContainer(project, composeExec.service)
+	if err != nil {
+		return err
+	}
+
+	result, err := docker.ExecCommandIntoContainerWithResult(ctx, container.ID, composeExec.user, composeExec.command())
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(result.Stdout)
+
+	if result.ExitCode != 0 {
+		return fmt.Errorf("The command exited with code %d in the service %s: %s", result.ExitCode, composeExec.service, result.Stderr)
+	}
+
+	return nil
+}
+
+// newContainerSpec returns the options creating the container of a service of a project, with the
+// labels of docker-compose, attached to the default network of the project with the name of the
+// service and the aliases of the compose files as aliases
+func newContainerSpec(project *composeProject, service string) (containerSpec, error) {
+	composeService := project.services[service]
+
+	labels := map[string]string{}
+	for name, value := range composeService.Labels {
+		labels[name] = value
+	}
+	labels[composeContainerNumberLabel] = "1"
+	labels[composeOneoffLabel] = "False"
+	labels[composeProjectLabel] = project.name
+	labels[composeServiceLabel] = service
+
+	env := []string{}
+	for name, value := range composeService.Environment {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(composeService.Ports)
+	if err != nil {
+		return containerSpec{}, fmt.Errorf("The ports of the service are not valid: %s - %v", service, err)
+	}
+
+	memory := int64(0)
+	if composeService.MemLimit != "" {
+		memory, err = units.RAMInBytes(composeService.MemLimit)
+		if err != nil {
+			return containerSpec{}, fmt.Errorf("The memory limit of the service is not valid: %s - %v", service, err)
+		}
+	}
+
+	binds := []string{}
+	anonymousVolumes := map[string]struct{}{}
+	for _, volume := range composeService.Volumes {
+		parts := strings.SplitN(volume, ":", 2)
+		if len(parts) == 1 {
+			anonymousVolumes[volume] = struct{}{}
+			continue
+		}
+
+		if !isLocalPath(parts[0]) {
+			if _, exists := project.volumes[parts[0]]; !exists {
+				return containerSpec{}, fmt.Errorf("The service %s uses an undefined volume: %s", service, parts[0])
+			}
+			volume = project.volumeName(parts[0]) + ":" + parts[1]
+		}
+
+		binds = append(binds, volume)
+	}
+
+	spec := containerSpec{
+		Config: &container.Config{
+			Cmd:          composeService.Command.args,
+			Entrypoint:   composeService.Entrypoint.args,
+			Env:          env,
+			ExposedPorts: exposedPorts,
+			Hostname:     composeService.Hostname,
+			Image:        composeService.Image,
+			Labels:       labels,
+			User:         composeService.User,
+			WorkingDir:   composeService.WorkingDir,
+		},
+		HostConfig: &container.HostConfig{
+			Binds:        binds,
+			NetworkMode:  container.NetworkMode(project.networkName()),
+			PortBindings: portBindings,
+			Privileged:   composeService.Privileged,
+			Resources: container.Resources{
+				Memory:   memory,
+				NanoCPUs: int64(composeService.CPUs * 1e9),
+			},
+		},
+		NetworkingConfig: &network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				project.networkName(): {Aliases: appendUnique([]string{service}, composeService.Networks["default"]...)},
+			},
+		},
+	}
+
+	if len(anonymousVolumes) > 0 {
+		spec.Config.Volumes = anonymousVolumes
+	}
+
+	if composeService.Healthcheck != nil {
+		spec.Config.Healthcheck, err = composeService.Healthcheck.healthConfig()
+		if err != nil {
+			return containerSpec{}, err
+		}
+	}
+
+	return spec, nil
+}
+
+// newReplicaSpec returns the name and the options creating the container of a replica of a service
+// of a project, other than the first one, with the hash of the options of the first one, so that
+// the replicas are kept while the options of the service do not change. The services with a fixed
+// container name cannot be scaled
+func newReplicaSpec(project *composeProject, service string, number int) (string, containerSpec, error) {
+	if project.services[service].ContainerName != "" {
+		return "", containerSpec{}, fmt.Errorf("The %s service cannot be scaled, as the name of its container is fixed: %s", service, project.services[service].ContainerName)
+	}
+
+	spec, err := newContainerSpec(project, service)
+	if err != nil {
+		return "", containerSpec{}, err
+	}
+
+	hash, err := spec.hash()
+	if err != nil {
+		return "", containerSpec{}, err
+	}
+	spec.Config.Labels[composeConfigHashLabel] = hash
+	spec.Config.Labels[composeContainerNumberLabel] = strconv.Itoa(number)
+
+	return fmt.Sprintf("%s_%s_%d", project.name, service, number), spec, nil
+}
+
+// parseComposeRun parses the args of a docker-compose run command, after the run command. Only the
+// detached containers are supported, and the flags not changing the container are ignored
+func parseComposeRun(args []string) (composeRun, error) {
+	result := composeRun{
+		env: map[string]string{},
+	}
+	detach := false
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") {
+			result.service = arg
+			result.cmds = args[i+1:]
+			break
+		}
+
+		hasValue := i+1 < len(args)
+		switch {
+		case arg == "-d" || arg == "--detach":
+			detach = true
+		case arg == "--service-ports":
+			result.servicePorts = true
+		case arg == "--name" && hasValue:
+			result.name = args[i+1]
+			i++
+		case (arg == "-e" || arg == "--env") && hasValue:
+			parts := strings.SplitN(args[i+1], "=", 2)
+			if len(parts) == 2 {
+				result.env[parts[0]] = parts[1]
+			}
+			i++
+		case (arg == "-u" || arg == "--user") && hasValue:
+			result.user = args[i+1]
+			i++
+		case (arg == "-w" || arg == "--workdir" || arg == "--entrypoint" || arg == "-l" || arg == "--label") && hasValue:
+			i++
+		}
+	}
+
+	if result.service == "" {
+		return result, fmt.Errorf("The docker-compose run command has no service: %v", args)
+	}
+	if !detach {
+		return result, fmt.Errorf("The docker-compose run command must be detached with the Docker API: %v", args)
+	}
+
+	return result, nil
+}
+
+// runComposeProject creates the default network and the volumes of a project, and runs the
+// containers of its services in the order of their dependencies
+func runComposeProject(ctx context.Context, project *composeProject) error {
+	networkLabels := mergeMapping(project.networks["default"].Labels, map[string]string{
+		composeNetworkLabel: "default",
+		composeProjectLabel: project.name,
+	})
+
+	_, err := docker.CreateNetwork(ctx, project.networkName(), networkLabels, "")
+	if err != nil {
+		return err
+	}
+
+	for name, volume := range project.volumes {
+		volumeLabels := mergeMapping(volume.Labels, map[string]string{
+			composeProjectLabel: project.name,
+			composeVolumeLabel:  name,
+		})
+
+		err := docker.CreateVolume(ctx, project.volumeName(name), volumeLabels)
+		if err != nil {
+			return err
+		}
+	}
+
+	order, err := project.startOrder()
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.ListComposeContainers(project.name)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range order {
+		err := waitForDependencies(ctx, project, service)
+		if err != nil {
+			return err
+		}
+
+		err = runComposeService(ctx, project, service, containers)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"project": project.name,
+				"service": service,
+			}).Error("Could not run the service with the Docker API")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runComposeService runs the container of a service of a project, keeping its current container if
+// its options did not change, which is started if it's stopped. Otherwise the current container is
+// replaced by a new one
+func runComposeService(ctx context.Context, project *composeProject, service string, containers []types.Container) error {
+	spec, err := newContainerSpec(project, service)
+	if err != nil {
+		return err
+	}
+
+	hash, err := spec.hash()
+	if err != nil {
+		return err
+	}
+	spec.Config.Labels[composeConfigHashLabel] = hash
+
+	for _, current := range containers {
+		if current.Labels[composeServiceLabel] != service || current.Labels[composeOneoffLabel] == "True" {
+			continue
+		}
+
+		if current.Labels[composeConfigHashLabel] == hash {
+			if current.State == "running" {
+				log.WithFields(log.Fields{
+					"project": project.name,
+					"service": service,
+				}).Trace("The container of the service is up to date")
+				return nil
+			}
+
+			return docker.StartContainer(ctx, current.ID)
+		}
+
+		err := docker.RemoveContainer(current.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ensureImage(ctx, spec.Config.Image)
+	if err != nil {
+		return err
+	}
+
+	_, err = docker.RunContainer(ctx, project.containerName(service), spec.Config, spec.HostConfig, spec.NetworkingConfig)
+	return err
+}
+
+// waitForDependencies waits for the services a service depends on with the service_healthy
+// condition to be healthy, for 5 minutes at most
+func waitForDependencies(ctx context.Context, project *composeProject, service string) error {
+	healthy := []string{}
+	for dependency, condition := range project.services[service].DependsOn {
+		if condition == "service_healthy" {
+			healthy = append(healthy, dependency)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return nil
+	}
+	sort.Strings(healthy)
+
+	options := WaitOptions{}.withDefaults()
+	deadline := time.Now().Add(options.Timeout)
+	for {
+		unhealthy, err := getUnhealthyServices(project.name, healthy)
+		if err == nil && len(unhealthy) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("The services %s depends on are not healthy after %s: %s", service, options.Timeout, strings.Join(unhealthy, ", "))
+			}
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"project":   project.name,
+			"service":   service,
+			"unhealthy": unhealthy,
+		}).Trace("Waiting for the dependencies of the service to be healthy")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(options.PollInterval):
+		}
+	}
+}
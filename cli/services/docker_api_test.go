@@ -0,0 +1,125 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewContainerSpec(t *testing.T) {
+	project := &composeProject{
+		name: "fleet",
+		services: map[string]*composeService{
+			"elasticsearch": {
+				CPUs:        1.5,
+				Environment: composeMapping{"xpack.security.enabled": "true", "ES_JAVA_OPTS": "-Xms1g"},
+				Image:       "elasticsearch:7.13.0",
+				Labels:      composeMapping{"co.elastic.e2e.run-id": "20201201T101530-3fa2b1"},
+				MemLimit:    "2g",
+				Ports:       []string{"9200:9200"},
+				Volumes:     []string{"data:/usr/share/elasticsearch/data", "/tmp/certs:/usr/share/certs:ro", "/tmp/logs"},
+			},
+		},
+		volumes: map[string]composeResource{"data": {}},
+	}
+
+	spec, err := newContainerSpec(project, "elasticsearch")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "elasticsearch:7.13.0", spec.Config.Image)
+	assert.Equal(t, []string{"ES_JAVA_OPTS=-Xms1g", "xpack.security.enabled=true"}, spec.Config.Env)
+	assert.Equal(t, map[string]string{
+		"co.elastic.e2e.run-id":               "20201201T101530-3fa2b1",
+		"com.docker.compose.container-number": "1",
+		"com.docker.compose.oneoff":           "False",
+		"com.docker.compose.project":          "fleet",
+		"com.docker.compose.service":          "elasticsearch",
+	}, spec.Config.Labels)
+	assert.Contains(t, spec.Config.ExposedPorts, nat.Port("9200/tcp"))
+	assert.Equal(t, []nat.PortBinding{{HostPort: "9200"}}, spec.HostConfig.PortBindings[nat.Port("9200/tcp")])
+	assert.Equal(t, []string{"fleet_data:/usr/share/elasticsearch/data", "/tmp/certs:/usr/share/certs:ro"}, spec.HostConfig.Binds)
+	assert.Contains(t, spec.Config.Volumes, "/tmp/logs")
+	assert.Equal(t, "fleet_default", string(spec.HostConfig.NetworkMode))
+	assert.Equal(t, int64(2*1024*1024*1024), spec.HostConfig.Memory)
+	assert.Equal(t, int64(1500000000), spec.HostConfig.NanoCPUs)
+	assert.Equal(t, []string{"elasticsearch"}, spec.NetworkingConfig.EndpointsConfig["fleet_default"].Aliases)
+
+	hash, err := spec.hash()
+	assert.Nil(t, err)
+
+	same, err := newContainerSpec(project, "elasticsearch")
+	assert.Nil(t, err)
+	sameHash, err := same.hash()
+	assert.Nil(t, err)
+	assert.Equal(t, hash, sameHash)
+
+	project.services["elasticsearch"].Image = "elasticsearch:7.14.0"
+	changed, err := newContainerSpec(project, "elasticsearch")
+	assert.Nil(t, err)
+	changedHash, err := changed.hash()
+	assert.Nil(t, err)
+	assert.NotEqual(t, hash, changedHash)
+}
+
+func TestNewContainerSpecWithAnUndefinedVolume(t *testing.T) {
+	project := &composeProject{
+		name: "fleet",
+		services: map[string]*composeService{
+			"elasticsearch": {
+				Image:   "elasticsearch:7.13.0",
+				Volumes: []string{"data:/usr/share/elasticsearch/data"},
+			},
+		},
+	}
+
+	_, err := newContainerSpec(project, "elasticsearch")
+	assert.NotNil(t, err)
+}
+
+func TestNewReplicaSpec(t *testing.T) {
+	project := &composeProject{
+		name: "fleet",
+		services: map[string]*composeService{
+			"fleet-server": {
+				Image: "elastic-agent:8.0.0-SNAPSHOT",
+				Ports: []string{"8220-8229:8220"},
+			},
+		},
+	}
+
+	first, err := newContainerSpec(project, "fleet-server")
+	assert.Nil(t, err)
+	firstHash, err := first.hash()
+	assert.Nil(t, err)
+
+	name, spec, err := newReplicaSpec(project, "fleet-server", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet_fleet-server_2", name)
+	assert.Equal(t, "2", spec.Config.Labels["com.docker.compose.container-number"])
+	assert.Equal(t, firstHash, spec.Config.Labels["com.docker.compose.config-hash"])
+	assert.Equal(t, []string{"fleet-server"}, spec.NetworkingConfig.EndpointsConfig["fleet_default"].Aliases)
+
+	project.services["fleet-server"].ContainerName = "fleet-server"
+	_, _, err = newReplicaSpec(project, "fleet-server", 2)
+	assert.NotNil(t, err)
+}
+
+func TestParseComposeRun(t *testing.T) {
+	run, err := parseComposeRun([]string{"-d", "--name", "fleet_elastic-agent_7.12.0", "-e", "FLEET_ENROLL=1", "elastic-agent"})
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet_elastic-agent_7.12.0", run.name)
+	assert.Equal(t, "elastic-agent", run.service)
+	assert.Equal(t, map[string]string{"FLEET_ENROLL": "1"}, run.env)
+	assert.Empty(t, run.cmds)
+	assert.False(t, run.servicePorts)
+}
+
+func TestParseComposeRunAttached(t *testing.T) {
+	_, err := parseComposeRun([]string{"--name", "agent", "elastic-agent", "elastic-agent", "version"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,171 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/elastic/e2e-testing/cli/docker"
+)
+
+// HealthProbeLabel the label of a service in its compose file declaring how to check that it's ready
+// when its image has no healthcheck: a TCP port, i.e. tcp://:3306, or an HTTP endpoint, i.e.
+// http://:80/server-status, of its container, which are probed at the port published in the host
+const HealthProbeLabel = "co.elastic.e2e.probe"
+
+// defaultPollInterval the time between the checks of the health of the services
+const defaultPollInterval = 2 * time.Second
+
+// defaultWaitTimeout the max time waiting for the services to be healthy
+const defaultWaitTimeout = 5 * time.Minute
+
+// probeTimeout the max time of a probe of a service
+const probeTimeout = 5 * time.Second
+
+// WaitOptions the options waiting for the services to be healthy. The zero values are replaced by
+// the defaults: checking them every 2 seconds, for 5 minutes
+type WaitOptions struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+// withDefaults returns the options, replacing the zero values by the defaults
+func (o WaitOptions) withDefaults() WaitOptions {
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultPollInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaultWaitTimeout
+	}
+
+	return o
+}
+
+// checkContainerHealth checks if the container of a service is healthy, returning the reason when
+// it's not. A running container is healthy when its healthcheck passes, or when its probe passes if
+// its image has no healthcheck, or otherwise just because it's running
+func checkContainerHealth(ctx context.Context, container types.Container) (bool, string) {
+	containerState, err := docker.GetContainerState(ctx, container.ID)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	if !containerState.Running {
+		return false, containerState.Status
+	}
+
+	if containerState.Health != nil {
+		return containerState.Health.Status == "healthy", containerState.Health.Status
+	}
+
+	probe, exists := container.Labels[HealthProbeLabel]
+	if !exists {
+		return true, containerState.Status
+	}
+
+	err = runHealthProbe(probe, container.Ports)
+	if err != nil {
+		return false, err.Error()
+	}
+
+	return true, "probed"
+}
+
+// getUnhealthyServices returns the services of a docker-compose project which are not healthy yet,
+// with the reason, i.e. elasticsearch (starting). All the services of the project are checked when
+// there are no services, and the ones without a container are not healthy
+func getUnhealthyServices(project string, composeNames []string) ([]string, error) {
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout*2)
+	defer cancel()
+
+	checked := map[string]bool{}
+	unhealthy := []string{}
+	for _, container := range containers {
+		service := container.Labels[composeServiceLabel]
+		if len(composeNames) > 0 && !contains(composeNames, service) {
+			continue
+		}
+		checked[service] = true
+
+		healthy, reason := checkContainerHealth(ctx, container)
+		if !healthy {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", service, reason))
+		}
+	}
+
+	for _, composeName := range composeNames {
+		if !checked[composeName] {
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (not created)", composeName))
+		}
+	}
+
+	sort.Strings(unhealthy)
+
+	return unhealthy, nil
+}
+
+// runHealthProbe probes a port of a container at the port published in the host: a TCP port is
+// ready when it accepts connections, and an HTTP endpoint when it responds without an error status
+func runHealthProbe(probe string, ports []types.Port) error {
+	u, err := url.Parse(probe)
+	if err != nil {
+		return fmt.Errorf("invalid probe %s: %v", probe, err)
+	}
+
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		return fmt.Errorf("the probe %s has no port", probe)
+	}
+
+	hostPort := 0
+	for _, p := range ports {
+		if int(p.PrivatePort) == port && p.PublicPort != 0 {
+			hostPort = int(p.PublicPort)
+			break
+		}
+	}
+	if hostPort == 0 {
+		return fmt.Errorf("the %d port of the probe is not published", port)
+	}
+
+	address := net.JoinHostPort("localhost", strconv.Itoa(hostPort))
+
+	switch u.Scheme {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", address, probeTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http":
+		client := &http.Client{Timeout: probeTimeout}
+
+		resp, err := client.Get("http://" + address + u.RequestURI())
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("%s responded %d", u.RequestURI(), resp.StatusCode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("the %s scheme of the probe is not supported, only tcp and http", u.Scheme)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// publishedAt returns the ports of a container publishing a private port at the port of a listener
+func publishedAt(t *testing.T, privatePort uint16, address string) []types.Port {
+	_, port, err := net.SplitHostPort(address)
+	assert.Nil(t, err)
+
+	publicPort, err := strconv.Atoi(port)
+	assert.Nil(t, err)
+
+	return []types.Port{{PrivatePort: privatePort, PublicPort: uint16(publicPort), Type: "tcp"}}
+}
+
+func TestRunHealthProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/server-status" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	ports := publishedAt(t, 80, server.Listener.Addr().String())
+
+	assert.Nil(t, runHealthProbe("http://:80/server-status", ports))
+	assert.NotNil(t, runHealthProbe("http://:80/", ports))
+}
+
+func TestRunHealthProbeTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ports := publishedAt(t, 3306, listener.Addr().String())
+	assert.Nil(t, runHealthProbe("tcp://:3306", ports))
+
+	listener.Close()
+	assert.NotNil(t, runHealthProbe("tcp://:3306", ports))
+}
+
+func TestRunHealthProbeInvalid(t *testing.T) {
+	ports := []types.Port{{PrivatePort: 3306, PublicPort: 33060, Type: "tcp"}}
+
+	assert.EqualError(t, runHealthProbe("tcp://:6379", ports), "the 6379 port of the probe is not published")
+	assert.EqualError(t, runHealthProbe("tcp://localhost", ports), "the probe tcp://localhost has no port")
+	assert.EqualError(t, runHealthProbe("udp://:3306", ports), "the udp scheme of the probe is not supported, only tcp and http")
+}
+
+func TestWaitOptionsWithDefaults(t *testing.T) {
+	options := WaitOptions{}.withDefaults()
+	assert.Equal(t, 2*time.Second, options.PollInterval)
+	assert.Equal(t, 5*time.Minute, options.Timeout)
+
+	options = WaitOptions{PollInterval: time.Second, Timeout: time.Minute}.withDefaults()
+	assert.Equal(t, time.Second, options.PollInterval)
+	assert.Equal(t, time.Minute, options.Timeout)
+}
@@ -0,0 +1,390 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// ImagesCacheDirEnvVar the environment variable setting the dir where the images are cached as tar
+// files, i.e. a dir kept between the jobs of a CI worker. The images found in it are loaded
+// instead of pulled, and the pulled ones are saved into it
+const ImagesCacheDirEnvVar = "OP_IMAGES_CACHE_DIR"
+
+// pullConcurrency the max number of images pulled at the same time
+const pullConcurrency = 4
+
+// pullTimeout the max time to pull the images of the compose files
+const pullTimeout = 20 * time.Minute
+
+// imagesComposeFile the parts of a compose file with the images of its services
+type imagesComposeFile struct {
+	Services map[string]struct {
+		Image string `yaml:"image"`
+	} `yaml:"services"`
+}
+
+// composeImages returns the images of the services of compose files, sorted and without duplicates,
+// with their variables replaced by the values in an environment. The images whose variables have
+// no value, such as the tags of the services which are not run, are skipped
+func composeImages(composeFilePaths []string, env map[string]string) ([]string, error) {
+	unique := map[string]bool{}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		compose := imagesComposeFile{}
+		err = yaml.Unmarshal(bytes, &compose)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, service := range compose.Services {
+			image := strings.TrimSpace(expandEnv(service.Image, env))
+			if image == "" || strings.HasSuffix(image, ":") || strings.Contains(image, "$") {
+				continue
+			}
+
+			unique[image] = true
+		}
+	}
+
+	images := []string{}
+	for image := range unique {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	return images, nil
+}
+
+// profileComposeFiles returns the compose files of a profile, if any, and of the services run with it
+func profileComposeFiles(profile string, composeNames []string) ([]string, error) {
+	composeFilePaths := []string{}
+	if profile != "" {
+		composeFilePath, err := config.GetComposeFile(true, profile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get compose file: %s - %v", composeFilePath, err)
+		}
+		composeFilePaths = append(composeFilePaths, composeFilePath)
+	}
+
+	for _, composeName := range composeNames {
+		composeFilePath, err := config.GetComposeFile(false, composeName)
+		if err != nil {
+			return nil, fmt.Errorf("Could not get compose file: %s - %v", composeFilePath, err)
+		}
+		composeFilePaths = append(composeFilePaths, composeFilePath)
+	}
+
+	return composeFilePaths, nil
+}
+
+// LockImages resolves a version of the stack, or an alias, with the artifacts API, pulls the images
+// of a profile and of the services run with it in that version, and returns the lockfile pinning them
+// by their digest, with the STACK_VERSION environment variable set to the resolved version
+func LockImages(profile string, composeNames []string, version string, env map[string]string) (config.ImagesLock, error) {
+	resolved, err := ResolveStackVersion(version)
+	if err != nil {
+		return config.ImagesLock{}, err
+	}
+
+	composeFilePaths, err := profileComposeFiles(profile, composeNames)
+	if err != nil {
+		return config.ImagesLock{}, err
+	}
+
+	env = mergeMapping(env, map[string]string{"stackVersion": resolved.Version})
+
+	images, err := composeImages(composeFilePaths, renderEnvironment(env))
+	if err != nil {
+		return config.ImagesLock{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+	defer cancel()
+
+	err = pullImages(ctx, images, shell.GetEnv(ImagesCacheDirEnvVar, ""))
+	if err != nil {
+		return config.ImagesLock{}, err
+	}
+
+	lock := config.ImagesLock{
+		BuildID: resolved.BuildID,
+		Commits: resolved.Commits,
+		Env:     map[string]string{"STACK_VERSION": resolved.Version},
+		Images:  []config.LockedImage{},
+		Profile: profile,
+		Version: version,
+	}
+
+	for _, image := range images {
+		repoDigests, err := docker.GetImageRepoDigests(ctx, image)
+		if err != nil {
+			return config.ImagesLock{}, err
+		}
+
+		digest := imageDigest(image, repoDigests)
+		if digest == "" {
+			// i.e. the images built locally, which were not pulled from a registry
+			log.WithFields(log.Fields{
+				"image": image,
+			}).Warn("The image has no digest in a registry, it's not pinned by the lockfile")
+		}
+
+		lock.Images = append(lock.Images, config.LockedImage{Digest: digest, Image: image})
+	}
+
+	return lock, nil
+}
+
+// pullLockedImages pulls the images pinned by a lockfile by their digest, tagging them as the compose
+// files refer to them, unless they are present with that digest already. It returns the images
+// which are not pinned by the lockfile
+func pullLockedImages(ctx context.Context, images []string, lock config.ImagesLock) ([]string, error) {
+	unlocked := []string{}
+
+	for _, image := range images {
+		digest, exists := lock.Digest(image)
+		if !exists {
+			unlocked = append(unlocked, image)
+			continue
+		}
+
+		if docker.ImageExists(ctx, image) {
+			repoDigests, err := docker.GetImageRepoDigests(ctx, image)
+			if err == nil && imageDigest(image, repoDigests) == digest {
+				log.WithFields(log.Fields{
+					"digest": digest,
+					"image":  image,
+				}).Trace("The image pinned by the lockfile is already present")
+				continue
+			}
+		}
+
+		pinned := imageRepository(image) + "@" + digest
+
+		err := docker.PullImage(ctx, pinned, config.GetDockerPlatform())
+		if err != nil {
+			return nil, err
+		}
+
+		err = docker.TagImage(ctx, pinned, image)
+		if err != nil {
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"digest": digest,
+			"image":  image,
+		}).Info("Image pinned by the lockfile ready")
+	}
+
+	return unlocked, nil
+}
+
+// imageDigest returns the digest of an image in the registry of its repository, from its digests in
+// the registries it was pulled from, i.e. sha256:2f1c... for
+// docker.elastic.co/observability-ci/kibana@sha256:2f1c..., empty if it was not pulled from it
+func imageDigest(image string, repoDigests []string) string {
+	repository := imageRepository(image)
+
+	for _, repoDigest := range repoDigests {
+		if strings.HasPrefix(repoDigest, repository+"@") {
+			return strings.TrimPrefix(repoDigest, repository+"@")
+		}
+	}
+
+	return ""
+}
+
+// imageRepository returns the repository of an image, without its tag or digest, i.e.
+// docker.elastic.co/observability-ci/kibana for docker.elastic.co/observability-ci/kibana:8.0.0-SNAPSHOT,
+// or localhost:5000/package-registry for localhost:5000/package-registry:latest
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+
+	return image
+}
+
+// imageCacheFile returns the path of the tar file of an image in the cache dir, i.e.
+// docker.elastic.co_observability-ci_kibana_8.0.0-SNAPSHOT.tar
+func imageCacheFile(cacheDir string, image string) string {
+	name := strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image)
+
+	return filepath.Join(cacheDir, name+".tar")
+}
+
+// pullImages pulls the images which are not present, at most pullConcurrency at the same time,
+// loading them from the cache dir if they are cached, and caching the pulled ones. It fails if any
+// image could not be pulled, once all of them are done
+func pullImages(ctx context.Context, images []string, cacheDir string) error {
+	missing := []string{}
+	for _, image := range images {
+		if docker.ImageExists(ctx, image) {
+			log.WithFields(log.Fields{
+				"image": image,
+			}).Trace("The image is already present")
+			continue
+		}
+
+		missing = append(missing, image)
+	}
+
+	if len(missing) == 0 {
+		log.WithFields(log.Fields{
+			"images": len(images),
+		}).Debug("All the images are already present")
+		return nil
+	}
+
+	if cacheDir != "" {
+		err := io.MkdirAll(cacheDir)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dir":   cacheDir,
+				"error": err,
+			}).Warn("Could not create the cache dir of the images, which are not cached")
+			cacheDir = ""
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"images":  missing,
+		"present": len(images) - len(missing),
+	}).Info("Pulling the images of the services")
+
+	var mutex sync.Mutex
+	done := 0
+	failed := []string{}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < pullConcurrency && i < len(missing); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for image := range queue {
+				start := time.Now()
+				source, err := pullImage(ctx, image, cacheDir)
+
+				mutex.Lock()
+				done++
+				if err != nil {
+					failed = append(failed, image)
+				}
+				progress := fmt.Sprintf("%d/%d", done, len(missing))
+				mutex.Unlock()
+
+				if err != nil {
+					log.WithFields(log.Fields{
+						"error":    err,
+						"image":    image,
+						"progress": progress,
+					}).Warn("Could not pull the image")
+					continue
+				}
+
+				log.WithFields(log.Fields{
+					"elapsedTime": time.Since(start).Round(time.Millisecond),
+					"image":       image,
+					"progress":    progress,
+					"source":      source,
+				}).Info("Image ready")
+			}
+		}()
+	}
+
+	for _, image := range missing {
+		queue <- image
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("could not pull %d of the %d images: %s", len(failed), len(missing), strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// pullImage loads an image from the cache dir, or pulls it and caches it, returning where the
+// image came from: the cache or the registry
+func pullImage(ctx context.Context, image string, cacheDir string) (string, error) {
+	cacheFile := ""
+	if cacheDir != "" {
+		cacheFile = imageCacheFile(cacheDir, image)
+	}
+
+	if cacheFile != "" {
+		if _, err := os.Stat(cacheFile); err == nil {
+			_, err := docker.LoadImage(ctx, cacheFile)
+			if err == nil && docker.ImageExists(ctx, image) {
+				return "cache", nil
+			}
+
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  cacheFile,
+				"image": image,
+			}).Warn("Could not load the image from the cache, pulling it")
+		}
+	}
+
+	err := docker.PullImage(ctx, image, config.GetDockerPlatform())
+	if err != nil {
+		return "", err
+	}
+
+	if cacheFile != "" {
+		// the image was pulled, so not caching it is not an error
+		_ = docker.SaveImage(ctx, image, cacheFile)
+	}
+
+	return "registry", nil
+}
+
+// renderEnvironment returns the environment the compose files are rendered with: the one of the
+// process, overridden by the one of the profile and services
+func renderEnvironment(env map[string]string) map[string]string {
+	rendered := map[string]string{}
+	for _, variable := range os.Environ() {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			rendered[parts[0]] = parts[1]
+		}
+	}
+
+	for k, v := range env {
+		rendered[k] = v
+	}
+
+	return rendered
+}
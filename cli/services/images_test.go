@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposeImages(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "profile.yml")
+	filet.File(t, profile, `version: '2.3'
+services:
+  elasticsearch:
+    image: "docker.elastic.co/observability-ci/elasticsearch:${stackVersion:-8.0.0-SNAPSHOT}"
+  kibana:
+    image: "docker.elastic.co/observability-ci/kibana:${stackVersion:-8.0.0-SNAPSHOT}"
+  package-registry:
+    image: "${packageRegistryImage:-docker.elastic.co/package-registry/distribution:staging}"
+`)
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, `version: '2.3'
+services:
+  elastic-agent:
+    image: docker.elastic.co/observability-ci/elastic-agent${elasticAgentDockerImageSuffix}:${elasticAgentTag:-8.0.0-SNAPSHOT}
+  opbeans-go:
+    image: "docker.elastic.co/observability-ci/opbeans-go:${opbeansGoTag}"
+  build-only:
+    build: .
+`)
+
+	env := map[string]string{
+		"elasticAgentDockerImageSuffix": "-complete",
+		"stackVersion":                  "7.13.0",
+	}
+
+	images, err := composeImages([]string{profile, service}, env)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"docker.elastic.co/observability-ci/elastic-agent-complete:8.0.0-SNAPSHOT",
+		"docker.elastic.co/observability-ci/elasticsearch:7.13.0",
+		"docker.elastic.co/observability-ci/kibana:7.13.0",
+		"docker.elastic.co/package-registry/distribution:staging",
+	}, images)
+}
+
+func TestImageCacheFile(t *testing.T) {
+	assert.Equal(t, path.Join("cache", "docker.elastic.co_observability-ci_kibana_8.0.0-SNAPSHOT.tar"), imageCacheFile("cache", "docker.elastic.co/observability-ci/kibana:8.0.0-SNAPSHOT"))
+	assert.Equal(t, path.Join("cache", "localhost_5000_centos_systemd_latest.tar"), imageCacheFile("cache", "localhost:5000/centos/systemd:latest"))
+}
+
+func TestRenderEnvironmentOverridesTheProcessEnvironment(t *testing.T) {
+	defer os.Unsetenv("OP_TEST_RENDER_TAG")
+	os.Setenv("OP_TEST_RENDER_TAG", "process")
+
+	rendered := renderEnvironment(map[string]string{"OP_TEST_RENDER_TAG": "profile"})
+	assert.Equal(t, "profile", rendered["OP_TEST_RENDER_TAG"])
+
+	rendered = renderEnvironment(nil)
+	assert.Equal(t, "process", rendered["OP_TEST_RENDER_TAG"])
+}
+
+func TestImageRepository(t *testing.T) {
+	assert.Equal(t, "docker.elastic.co/observability-ci/kibana", imageRepository("docker.elastic.co/observability-ci/kibana:8.0.0-SNAPSHOT"))
+	assert.Equal(t, "docker.elastic.co/observability-ci/kibana", imageRepository("docker.elastic.co/observability-ci/kibana@sha256:2f1c"))
+	assert.Equal(t, "localhost:5000/package-registry", imageRepository("localhost:5000/package-registry:latest"))
+	assert.Equal(t, "localhost:5000/package-registry", imageRepository("localhost:5000/package-registry"))
+	assert.Equal(t, "redis", imageRepository("redis"))
+}
+
+func TestImageDigest(t *testing.T) {
+	repoDigests := []string{
+		"docker.elastic.co/beats/elastic-agent@sha256:aaaa",
+		"docker.elastic.co/observability-ci/kibana@sha256:2f1c",
+	}
+
+	assert.Equal(t, "sha256:2f1c", imageDigest("docker.elastic.co/observability-ci/kibana:8.0.0-SNAPSHOT", repoDigests))
+	assert.Equal(t, "", imageDigest("docker.elastic.co/observability-ci/kibana-ubi8:8.0.0-SNAPSHOT", repoDigests))
+	assert.Equal(t, "", imageDigest("redis:latest", []string{}))
+}
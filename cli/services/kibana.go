@@ -10,15 +10,22 @@ import (
 	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
 	curl "github.com/elastic/e2e-testing/cli/shell"
 	log "github.com/sirupsen/logrus"
 )
 
-// KibanaBaseURL All URLs running on localhost as Kibana is expected to be exposed there
-const kibanaBaseURL = "http://localhost:5601"
+// kibanaBaseURL All URLs running on localhost as Kibana is expected to be exposed there,
+// with https when the stack is secured
+const kibanaBaseURL = "%s://localhost:%d"
+
+// kibanaPort the port where Kibana listens to
+const kibanaPort = 5601
 
 const endpointMetadataURL = "/api/endpoint/metadata"
 
+const ingestManagerDataStreamsURL = "/api/fleet/data_streams"
+
 const ingestManagerAgentPoliciesURL = "/api/fleet/agent_policies"
 const ingestManagerAgentPolicyURL = ingestManagerAgentPoliciesURL + "/%s"
 
@@ -31,19 +38,16 @@ const ingestManagerIntegrationURL = "/api/fleet/epm/packages/%s-%s"
 
 // KibanaClient manages calls to Kibana APIs
 type KibanaClient struct {
-	baseURL string
-	url     string
+	url string
 }
 
 // NewKibanaClient returns a kibana client
 func NewKibanaClient() *KibanaClient {
-	return &KibanaClient{
-		baseURL: kibanaBaseURL,
-	}
+	return &KibanaClient{}
 }
 
 func (k *KibanaClient) getURL() string {
-	return k.baseURL + k.url
+	return k.GetBaseURL() + k.url
 }
 
 func (k *KibanaClient) withURL(path string) *KibanaClient {
@@ -115,9 +119,29 @@ func (k *KibanaClient) DeleteIntegrationFromPolicy(packageConfigID string) (stri
 	return body, err
 }
 
-// GetBaseURL retrieves the base URl where Kibana is listening
+// GetBaseURL retrieves the base URl where Kibana is listening, which is resolved on each call,
+// as the certificates of the secured stack are generated once the client exists
 func (k *KibanaClient) GetBaseURL() string {
-	return k.baseURL
+	return fmt.Sprintf(kibanaBaseURL, config.GetURLScheme(), config.GetHostPort(kibanaPort))
+}
+
+// GetDataStreams sends a GET request to fetch the data streams listed in Fleet
+func (k *KibanaClient) GetDataStreams() (string, error) {
+	k.withURL(ingestManagerDataStreamsURL)
+
+	getReq := createDefaultHTTPRequest(k.getURL())
+
+	body, err := curl.Get(getReq)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"body":  body,
+			"error": err,
+			"url":   k.getURL(),
+		}).Error("Could not get Fleet's data streams")
+		return "", err
+	}
+
+	return body, err
 }
 
 // GetIntegration sends a GET request to fetch an integration by name and version
@@ -236,7 +260,7 @@ func (k *KibanaClient) UpdateIntegrationPackageConfig(packageConfigID string, pa
 	return body, err
 }
 
-// WaitForKibana waits for kibana running in localhost:5601 to be healthy, returning false
+// WaitForKibana waits for kibana running in localhost to be healthy, returning false
 // if kibana does not get healthy status in a defined number of minutes.
 func (k *KibanaClient) WaitForKibana(maxTimeoutMinutes time.Duration) (bool, error) {
 	k.withURL("/status")
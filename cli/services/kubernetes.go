@@ -0,0 +1,764 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// KubernetesClusterProviderEnvVar the environment variable selecting the tool creating the
+// Kubernetes cluster: kind (default) or k3d
+const KubernetesClusterProviderEnvVar = "OP_KUBERNETES_CLUSTER_PROVIDER"
+
+// kubernetesClusterName the name of the cluster created by the tool, which is namespaced for
+// each worker, i.e. e2e-testing-worker2
+const kubernetesClusterName = "e2e-testing"
+
+// kubernetesClusterCreatedKey the name of the variable in the state of a profile recording that
+// the tool created the cluster, so that it's destroyed when the profile is stopped
+const kubernetesClusterCreatedKey = "kubernetesClusterCreated"
+
+// kubernetesPortForwardsKey the name of the variable in the state of a profile with the PIDs of
+// the processes forwarding the ports of its services to the host
+const kubernetesPortForwardsKey = "kubernetesPortForwards"
+
+// kubernetesNamespaceKey the name of the variable of the manifests with the namespace they are
+// applied into, i.e. to name the cluster-wide resources of a service after its namespace
+const kubernetesNamespaceKey = "kubernetesNamespace"
+
+// kubernetesWaitTimeout the max time to wait for the deployments to be available
+const kubernetesWaitTimeout = "600s"
+
+// kubernetesConfigMap a config map created from a file in the host, which is mounted by the
+// manifests instead of the file, as the pods cannot mount the files of the host
+type kubernetesConfigMap struct {
+	key  string // the key of the file in the config map
+	name string // the name of the config map
+}
+
+// kubernetesConfigFiles the config maps created from the files set in the environment, by the name
+// of the variable used in the compose files to mount them
+var kubernetesConfigFiles = map[string]kubernetesConfigMap{
+	"elasticAgentConfigFile": {key: "elastic-agent.yml", name: "elastic-agent-config"},
+	"kibanaConfigPath":       {key: "kibana.yml", name: "kibana-config"},
+	"metricbeatConfigFile":   {key: "metricbeat.yml", name: "metricbeat-config"},
+}
+
+// kubernetesPortForwards the ports of the services forwarded to the host when a profile runs,
+// by the name of the service, which are shifted for each worker as in docker-compose
+var kubernetesPortForwards = map[string]int{
+	"elasticsearch": 9200,
+	"kibana":        5601,
+}
+
+// envVariableRegex matches the variables of the manifests, as in the compose files: ${name}
+// and ${name:-default}
+var envVariableRegex = regexp.MustCompile(`\$\{([A-Za-z0-9_]+)(:-([^}]*))?\}`)
+
+// KubernetesServiceManager implementation of the service manager interface, deploying the
+// services and the profiles into a Kubernetes cluster created with kind or k3d, from the
+// Kubernetes manifests bundled with the tool. Each profile, or service, runs in its own
+// namespace, which is named as its docker-compose project
+type KubernetesServiceManager struct {
+	cluster *kubernetesCluster
+}
+
+// NewKubernetesServiceManager returns a new service manager for Kubernetes
+func NewKubernetesServiceManager() *KubernetesServiceManager {
+	provider := shell.GetEnv(KubernetesClusterProviderEnvVar, "kind")
+
+	shell.CheckInstalledSoftware([]string{provider, "kubectl"})
+
+	return &KubernetesServiceManager{
+		cluster: &kubernetesCluster{
+			name:     config.GetComposeProjectName(kubernetesClusterName),
+			provider: provider,
+		},
+	}
+}
+
+// AddServicesToCompose deploys services into the namespace of a running profile
+func (sm *KubernetesServiceManager) AddServicesToCompose(profile string, composeNames []string, env map[string]string) error {
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"services": composeNames,
+	}).Trace("Adding services to the profile in Kubernetes")
+
+	persistedEnv := recoverState(profile + "-profile")
+	for k, v := range env {
+		persistedEnv[k] = v
+	}
+
+	return sm.deploy(profile, false, composeNames, persistedEnv)
+}
+
+// CreateNetwork does nothing, as the services reach each other in the network of the cluster, by the
+// names of their Kubernetes services
+func (sm *KubernetesServiceManager) CreateNetwork(composeName string, env map[string]string) error {
+	log.WithFields(log.Fields{
+		"profile": composeName,
+	}).Trace("The services run in the network of the Kubernetes cluster")
+
+	return nil
+}
+
+// ExecCommandInService executes a command in the pod of the deployment of a service, in the namespace
+// of a running profile, or of the service run on its own, returning its output and its exit code
+func (sm *KubernetesServiceManager) ExecCommandInService(profile string, service string, cmds []string) (shell.ExecResult, error) {
+	namespace := config.GetComposeProjectName(profile)
+	if profile == "" {
+		namespace = config.GetComposeProjectName(service)
+	}
+
+	args := []string{"--context", sm.cluster.context(), "exec", "--namespace", namespace, "deployment/" + service, "--"}
+	args = append(args, cmds...)
+
+	result, err := shell.ExecuteWithResult(".", "kubectl", args...)
+	if err != nil {
+		return shell.ExecResult{}, fmt.Errorf("Could not execute the command in the service: %s - %v", service, err)
+	}
+
+	// kubectl fails with its own error if the pod is not found, so it must be told apart from the
+	// exit code of the command
+	if result.ExitCode != 0 && strings.HasPrefix(result.Stderr, "Error from server") {
+		return shell.ExecResult{}, fmt.Errorf("Could not execute the command in the service: %s - %s", service, result.Stderr)
+	}
+
+	return result, nil
+}
+
+// PullImages does nothing, as the images are pulled by the nodes of the cluster
+func (sm *KubernetesServiceManager) PullImages(profile string, composeNames []string, env map[string]string) error {
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"services": composeNames,
+	}).Trace("The images are pulled by the nodes of the Kubernetes cluster")
+
+	return nil
+}
+
+// RemoveNetwork does nothing, as the services run in the network of the cluster, which is not
+// removed with the namespace
+func (sm *KubernetesServiceManager) RemoveNetwork(composeName string) error {
+	log.WithFields(log.Fields{
+		"profile": composeName,
+	}).Trace("The services run in the network of the Kubernetes cluster")
+
+	return nil
+}
+
+// RemoveServicesFromCompose deletes services from the namespace of a running profile
+func (sm *KubernetesServiceManager) RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error {
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"services": composeNames,
+	}).Trace("Removing services from the profile in Kubernetes")
+
+	persistedEnv := recoverState(profile + "-profile")
+	for k, v := range env {
+		persistedEnv[k] = v
+	}
+
+	namespace := config.GetComposeProjectName(profile)
+
+	for _, composeName := range composeNames {
+		manifestPath, err := renderKubernetesManifest(namespace, false, composeName, persistedEnv)
+		if err != nil {
+			return err
+		}
+
+		_, err = sm.kubectl("delete", "--namespace", namespace, "--ignore-not-found", "-f", manifestPath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": profile,
+				"service": composeName,
+			}).Error("Could not remove service from the profile in Kubernetes")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"profile": profile,
+			"service": composeName,
+		}).Debug("Service removed from the profile in Kubernetes")
+	}
+
+	return nil
+}
+
+// RunCommand executes a docker-compose command in the namespace of a running profile, translated
+// to kubectl: exec, logs and ps are supported
+func (sm *KubernetesServiceManager) RunCommand(profile string, composeNames []string, composeArgs []string, env map[string]string) error {
+	if len(composeArgs) == 0 {
+		return fmt.Errorf("There is no docker-compose command to run in Kubernetes")
+	}
+
+	namespace := config.GetComposeProjectName(profile)
+
+	switch composeArgs[0] {
+	case "exec":
+		composeExec, err := parseComposeExec(composeArgs[1:])
+		if err != nil {
+			return err
+		}
+
+		args := []string{"exec", "--namespace", namespace, "deployment/" + composeExec.service, "--"}
+		args = append(args, composeExec.command()...)
+
+		_, err = sm.kubectl(args...)
+		return err
+	case "logs":
+		services := []string{}
+		for _, arg := range composeArgs[1:] {
+			if !strings.HasPrefix(arg, "-") {
+				services = append(services, arg)
+			}
+		}
+
+		args := []string{"logs", "--namespace", namespace, "--all-containers", "--prefix"}
+		if len(services) == 0 {
+			args = append(args, "--selector", "app")
+		} else {
+			args = append(args, "deployment/"+services[0])
+		}
+
+		output, err := sm.kubectl(args...)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(output)
+		return nil
+	case "ps":
+		output, err := sm.kubectl("get", "pods", "--namespace", namespace, "-o", "wide")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(output)
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"args":    composeArgs,
+		"profile": profile,
+	}).Error("The docker-compose command is not supported in Kubernetes")
+	return fmt.Errorf("The %s command of docker-compose is not supported by the Kubernetes service manager", composeArgs[0])
+}
+
+// RunCompose deploys a profile, or a service, into its own namespace of the cluster, creating the
+// cluster if it does not exist. The ports of the services of a profile are forwarded to the host
+func (sm *KubernetesServiceManager) RunCompose(isProfile bool, composeNames []string, env map[string]string) error {
+	if env == nil {
+		env = map[string]string{}
+	}
+
+	created, err := sm.cluster.ensure()
+	if err != nil {
+		return err
+	}
+	if created {
+		env[kubernetesClusterCreatedKey] = "true"
+	}
+
+	err = sm.deploy(composeNames[0], isProfile, composeNames, env)
+	if err != nil {
+		return err
+	}
+
+	if !isProfile {
+		return nil
+	}
+
+	pids, err := sm.forwardPorts(config.GetComposeProjectName(composeNames[0]))
+	if err != nil {
+		return err
+	}
+	env[kubernetesPortForwardsKey] = strings.Join(pids, ",")
+
+	updateState(composeNames[0]+"-profile", composeNames, env)
+
+	return nil
+}
+
+// ScaleService scales the deployment of a service in the namespace of a running profile to a number
+// of replicas, waiting for its rollout
+func (sm *KubernetesServiceManager) ScaleService(profile string, service string, replicas int, env map[string]string) error {
+	if replicas < 1 {
+		return fmt.Errorf("The %s service cannot be scaled to %d replicas", service, replicas)
+	}
+
+	namespace := config.GetComposeProjectName(profile)
+
+	_, err := sm.kubectl("scale", "deployment", service, "--namespace", namespace, fmt.Sprintf("--replicas=%d", replicas))
+	if err != nil {
+		return fmt.Errorf("Could not scale the deployment: %s - %v", service, err)
+	}
+
+	_, err = sm.kubectl("rollout", "status", "--namespace", namespace, "deployment/"+service, "--timeout="+kubernetesWaitTimeout)
+	if err != nil {
+		return fmt.Errorf("The replicas of the deployment are not available: %s - %v", service, err)
+	}
+
+	return nil
+}
+
+// SetServiceAliases is not supported, as the services are resolved by the names of their Kubernetes
+// services, which are managed by the cluster
+func (sm *KubernetesServiceManager) SetServiceAliases(profile string, service string, aliases []string) error {
+	log.WithFields(log.Fields{
+		"aliases": aliases,
+		"profile": profile,
+		"service": service,
+	}).Error("The aliases of the services are not supported in Kubernetes")
+	return fmt.Errorf("The aliases of the %s service are not supported by the Kubernetes service manager", service)
+}
+
+// StopCompose deletes the namespace of a profile, or a service, stopping the processes forwarding
+// its ports. The cluster is destroyed with the profile which created it
+func (sm *KubernetesServiceManager) StopCompose(isProfile bool, composeNames []string) error {
+	ID := composeNames[0] + "-service"
+	if isProfile {
+		ID = composeNames[0] + "-profile"
+	}
+	persistedEnv := recoverState(ID)
+
+	for _, pid := range strings.Split(persistedEnv[kubernetesPortForwardsKey], ",") {
+		stopProcess(pid)
+	}
+
+	namespace := config.GetComposeProjectName(composeNames[0])
+
+	_, err := sm.kubectl("delete", "namespace", namespace, "--ignore-not-found")
+	if err != nil {
+		return fmt.Errorf("Could not delete the namespace: %s - %v", namespace, err)
+	}
+	defer destroyState(ID)
+
+	if isProfile && persistedEnv[kubernetesClusterCreatedKey] == "true" {
+		err = sm.cluster.destroy()
+		if err != nil {
+			return err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"namespace": namespace,
+		"profile":   composeNames[0],
+	}).Trace("Kubernetes namespace deleted.")
+
+	return nil
+}
+
+// WaitForHealthy waits for the pods of services of a running profile, or a service run on its own,
+// to be ready, until a timeout. The pods are selected by the app label, which is the name of their
+// service, and all the pods of its namespace are checked when there are no services
+func (sm *KubernetesServiceManager) WaitForHealthy(profile string, composeNames []string, options WaitOptions) error {
+	options = options.withDefaults()
+	namespace := config.GetComposeProjectName(profile)
+
+	args := []string{"wait", "--namespace", namespace, "--for=condition=ready", "pod", fmt.Sprintf("--timeout=%ds", int(options.Timeout.Seconds()))}
+	if len(composeNames) > 0 {
+		args = append(args, "--selector", "app in ("+strings.Join(composeNames, ",")+")")
+	} else {
+		args = append(args, "--all")
+	}
+
+	_, err := sm.kubectl(args...)
+	if err != nil {
+		return fmt.Errorf("The pods of the namespace are not ready: %s - %v", namespace, err)
+	}
+
+	return nil
+}
+
+// deploy applies the manifests of a profile and its services, or of services, into the namespace
+// of the profile, waiting for their deployments to be available
+func (sm *KubernetesServiceManager) deploy(profile string, isProfile bool, composeNames []string, env map[string]string) error {
+	namespace := config.GetComposeProjectName(profile)
+
+	env = config.PutWorkerEnvironment(env)
+	env = config.PutRunEnvironment(env)
+
+	err := sm.ensureNamespace(namespace, env[config.RunIDKey])
+	if err != nil {
+		return err
+	}
+
+	err = sm.createConfigMaps(namespace, env)
+	if err != nil {
+		return err
+	}
+
+	manifestPaths := []string{}
+	for i, composeName := range composeNames {
+		manifestPath, err := renderKubernetesManifest(namespace, isProfile && i == 0, composeName, env)
+		if err != nil {
+			return err
+		}
+		manifestPaths = append(manifestPaths, manifestPath)
+
+		_, err = sm.kubectl("apply", "--namespace", namespace, "-f", manifestPath)
+		if err != nil {
+			return fmt.Errorf("Could not apply the Kubernetes manifest: %s - %v", manifestPath, err)
+		}
+	}
+
+	_, err = sm.kubectl("wait", "--namespace", namespace, "--for=condition=available", "deployment", "--all", "--timeout="+kubernetesWaitTimeout)
+	if err != nil {
+		return fmt.Errorf("The deployments of the namespace are not available: %s - %v", namespace, err)
+	}
+
+	err = sm.waitForDaemonSets(namespace)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"cluster":   sm.cluster.name,
+		"manifests": manifestPaths,
+		"namespace": namespace,
+	}).Debug("Kubernetes manifests applied.")
+
+	return nil
+}
+
+// createConfigMaps creates the config maps of the files set in the environment, replacing the
+// existing ones, as the files could change between scenarios
+func (sm *KubernetesServiceManager) createConfigMaps(namespace string, env map[string]string) error {
+	for variable, configMap := range kubernetesConfigFiles {
+		filePath, exists := env[variable]
+		if !exists || filePath == "" {
+			continue
+		}
+
+		_, err := sm.kubectl("delete", "configmap", configMap.name, "--namespace", namespace, "--ignore-not-found")
+		if err != nil {
+			return err
+		}
+
+		_, err = sm.kubectl("create", "configmap", configMap.name, "--namespace", namespace, "--from-file="+configMap.key+"="+filePath)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"configMap": configMap.name,
+				"error":     err,
+				"file":      filePath,
+			}).Error("Could not create the config map of the file")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureNamespace creates a namespace if it does not exist, labelled with the ID of the run
+func (sm *KubernetesServiceManager) ensureNamespace(namespace string, runID string) error {
+	output, err := sm.kubectl("get", "namespaces", "-o", "name")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "namespace/"+namespace {
+			return nil
+		}
+	}
+
+	_, err = sm.kubectl("create", "namespace", namespace)
+	if err != nil {
+		return err
+	}
+
+	_, err = sm.kubectl("label", "namespace", namespace, config.RunIDLabel+"="+runID)
+	return err
+}
+
+// forwardPorts forwards the ports of the services of a namespace to the host, in background
+// processes which are kept running after the tool exits, returning their PIDs
+func (sm *KubernetesServiceManager) forwardPorts(namespace string) ([]string, error) {
+	pids := []string{}
+
+	for service, port := range kubernetesPortForwards {
+		hostPort := config.GetHostPort(port)
+
+		cmd := exec.Command("kubectl", "--context", sm.cluster.context(), "port-forward", "--namespace", namespace, "service/"+service, fmt.Sprintf("%d:%d", hostPort, port))
+		err := cmd.Start()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":     err,
+				"namespace": namespace,
+				"port":      port,
+				"service":   service,
+			}).Error("Could not forward the port of the service")
+			return pids, err
+		}
+
+		pids = append(pids, strconv.Itoa(cmd.Process.Pid))
+		_ = cmd.Process.Release()
+
+		log.WithFields(log.Fields{
+			"hostPort":  hostPort,
+			"namespace": namespace,
+			"port":      port,
+			"service":   service,
+		}).Debug("Port of the service forwarded to the host")
+	}
+
+	return pids, nil
+}
+
+// waitForDaemonSets waits for the daemon sets of a namespace to run their pods in all the nodes,
+// which are not covered by the availability of the deployments
+func (sm *KubernetesServiceManager) waitForDaemonSets(namespace string) error {
+	output, err := sm.kubectl("get", "daemonsets", "--namespace", namespace, "-o", "name")
+	if err != nil {
+		return err
+	}
+
+	for _, daemonSet := range strings.Fields(output) {
+		_, err = sm.kubectl("rollout", "status", "--namespace", namespace, daemonSet, "--timeout="+kubernetesWaitTimeout)
+		if err != nil {
+			return fmt.Errorf("The daemon set of the namespace is not ready: %s/%s - %v", namespace, daemonSet, err)
+		}
+	}
+
+	return nil
+}
+
+// kubectl executes a kubectl command in the context of the cluster
+func (sm *KubernetesServiceManager) kubectl(args ...string) (string, error) {
+	kubectl := &Kubectl{}
+	return kubectl.Run(append([]string{"--context", sm.cluster.context()}, args...)...)
+}
+
+// kubernetesCluster a Kubernetes cluster run in docker by kind or k3d
+type kubernetesCluster struct {
+	name     string
+	provider string // kind or k3d
+}
+
+// context returns the name of the kubectl context of the cluster
+func (c *kubernetesCluster) context() string {
+	return c.provider + "-" + c.name
+}
+
+// destroy destroys the cluster
+func (c *kubernetesCluster) destroy() error {
+	_, err := shell.Execute(".", c.provider, c.subcommand("delete", "--name", c.name)...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cluster":  c.name,
+			"error":    err,
+			"provider": c.provider,
+		}).Error("Could not destroy the Kubernetes cluster")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"cluster":  c.name,
+		"provider": c.provider,
+	}).Debug("Kubernetes cluster destroyed")
+
+	return nil
+}
+
+// ensure creates the cluster if it does not exist, returning if it was created
+func (c *kubernetesCluster) ensure() (bool, error) {
+	output, err := shell.Execute(".", c.provider, c.subcommand("list")...)
+	if err != nil {
+		return false, err
+	}
+
+	if containsCluster(output, c.name) {
+		return false, nil
+	}
+
+	args := c.subcommand("create", "--name", c.name, "--wait", "5m")
+	if c.provider == "k3d" {
+		args = c.subcommand("create", c.name, "--wait")
+	}
+
+	_, err = shell.Execute(".", c.provider, args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"cluster":  c.name,
+			"error":    err,
+			"provider": c.provider,
+		}).Error("Could not create the Kubernetes cluster")
+		return false, err
+	}
+
+	log.WithFields(log.Fields{
+		"cluster":  c.name,
+		"provider": c.provider,
+	}).Info("Kubernetes cluster created")
+
+	return true, nil
+}
+
+// subcommand returns the args of a subcommand managing clusters, which are named differently by
+// the providers: kind get clusters, or k3d cluster list
+func (c *kubernetesCluster) subcommand(command string, args ...string) []string {
+	if c.provider == "k3d" {
+		if command == "delete" {
+			return []string{"cluster", "delete", c.name}
+		}
+		return append([]string{"cluster", command}, args...)
+	}
+
+	if command == "list" {
+		return []string{"get", "clusters"}
+	}
+	return append([]string{command, "cluster"}, args...)
+}
+
+// composeExec the args of a docker-compose exec command
+type composeExec struct {
+	cmds    []string
+	detach  bool
+	service string
+	user    string
+}
+
+// command returns the command executed in the container, or in the pod, which is run in background
+// when the docker-compose command is detached
+func (e composeExec) command() []string {
+	if !e.detach {
+		return e.cmds
+	}
+
+	quoted := make([]string, len(e.cmds))
+	for i, cmd := range e.cmds {
+		quoted[i] = "'" + strings.ReplaceAll(cmd, "'", `'\''`) + "'"
+	}
+
+	return []string{"sh", "-c", strings.Join(quoted, " ") + " > /dev/null 2>&1 &"}
+}
+
+// parseComposeExec parses the args of a docker-compose exec command, after the exec command.
+// The flags setting the env, the index or the working dir are ignored, and the user too in Kubernetes
+func parseComposeExec(args []string) (composeExec, error) {
+	flagsWithValue := map[string]bool{
+		"--env": true, "-e": true, "--index": true, "--user": true, "-u": true, "--workdir": true, "-w": true,
+	}
+
+	result := composeExec{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") {
+			result.service = arg
+			result.cmds = args[i+1:]
+			break
+		}
+
+		if arg == "-d" || arg == "--detach" {
+			result.detach = true
+		} else if (arg == "-u" || arg == "--user") && i+1 < len(args) {
+			result.user = args[i+1]
+			i++
+		} else if flagsWithValue[arg] {
+			i++
+		}
+	}
+
+	if result.service == "" || len(result.cmds) == 0 {
+		return result, fmt.Errorf("The docker-compose exec command has no service or command: %v", args)
+	}
+
+	return result, nil
+}
+
+// containsCluster checks if the output of the command listing the clusters contains a cluster
+func containsCluster(output string, name string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expandEnv replaces the variables of a manifest with their values in the environment, using the
+// defaults of the variables which are not set, as docker-compose does
+func expandEnv(content string, env map[string]string) string {
+	return envVariableRegex.ReplaceAllStringFunc(content, func(variable string) string {
+		matches := envVariableRegex.FindStringSubmatch(variable)
+
+		if value, exists := env[matches[1]]; exists && value != "" {
+			return value
+		}
+
+		return matches[3]
+	})
+}
+
+// manifestEnv returns a copy of the environment of a manifest, with the namespace it's applied into
+func manifestEnv(namespace string, env map[string]string) map[string]string {
+	values := map[string]string{}
+	for k, v := range env {
+		values[k] = v
+	}
+	values[kubernetesNamespaceKey] = namespace
+
+	return values
+}
+
+// renderKubernetesManifest writes the manifest of a profile or a service, with the variables
+// replaced, into the state dir, returning its path
+func renderKubernetesManifest(namespace string, isProfile bool, name string, env map[string]string) (string, error) {
+	manifestPath, err := config.GetKubernetesManifest(isProfile, name)
+	if err != nil {
+		return "", fmt.Errorf("Could not get the Kubernetes manifest: %s - %v", name, err)
+	}
+
+	content, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return "", err
+	}
+
+	renderedDir := filepath.Join(config.GetStateDir(), "kubernetes", namespace)
+	err = state.MkdirAll(renderedDir)
+	if err != nil {
+		return "", err
+	}
+
+	renderedPath := filepath.Join(renderedDir, name+".yml")
+	err = ioutil.WriteFile(renderedPath, []byte(expandEnv(string(content), manifestEnv(namespace, env))), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return renderedPath, nil
+}
+
+// stopProcess stops a process by its PID, ignoring the ones which do not exist
+func stopProcess(pid string) {
+	id, err := strconv.Atoi(pid)
+	if err != nil {
+		return
+	}
+
+	process, err := os.FindProcess(id)
+	if err != nil {
+		return
+	}
+
+	_ = process.Kill()
+}
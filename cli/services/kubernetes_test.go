@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainsCluster(t *testing.T) {
+	kindOutput := "e2e-testing\ne2e-testing-worker2"
+	assert.True(t, containsCluster(kindOutput, "e2e-testing-worker2"))
+	assert.False(t, containsCluster(kindOutput, "e2e-testing-worker3"))
+
+	k3dOutput := "NAME          SERVERS   AGENTS   LOADBALANCER\ne2e-testing   1/1       0/0      true"
+	assert.True(t, containsCluster(k3dOutput, "e2e-testing"))
+	assert.False(t, containsCluster(k3dOutput, "NAME-testing"))
+}
+
+func TestExpandEnv(t *testing.T) {
+	content := "image: ${image}:${tag:-8.0.0-SNAPSHOT}\nport: ${port:-9200}\nempty: '${missing}'"
+
+	expanded := expandEnv(content, map[string]string{"image": "elasticsearch", "port": ""})
+	assert.Equal(t, "image: elasticsearch:8.0.0-SNAPSHOT\nport: 9200\nempty: ''", expanded)
+}
+
+func TestManifestEnv(t *testing.T) {
+	env := map[string]string{"elasticAgentTag": "8.0.0-SNAPSHOT"}
+
+	values := manifestEnv("fleet", env)
+	assert.Equal(t, map[string]string{"elasticAgentTag": "8.0.0-SNAPSHOT", "kubernetesNamespace": "fleet"}, values)
+	assert.NotContains(t, env, "kubernetesNamespace")
+}
+
+func TestKubernetesClusterSubcommands(t *testing.T) {
+	kind := &kubernetesCluster{name: "e2e-testing", provider: "kind"}
+	assert.Equal(t, "kind-e2e-testing", kind.context())
+	assert.Equal(t, []string{"get", "clusters"}, kind.subcommand("list"))
+	assert.Equal(t, []string{"delete", "cluster", "--name", "e2e-testing"}, kind.subcommand("delete", "--name", "e2e-testing"))
+
+	k3d := &kubernetesCluster{name: "e2e-testing", provider: "k3d"}
+	assert.Equal(t, "k3d-e2e-testing", k3d.context())
+	assert.Equal(t, []string{"cluster", "list"}, k3d.subcommand("list"))
+	assert.Equal(t, []string{"cluster", "delete", "e2e-testing"}, k3d.subcommand("delete", "--name", "e2e-testing"))
+}
+
+func TestParseComposeExec(t *testing.T) {
+	composeExec, err := parseComposeExec([]string{"-T", "-u", "root", "elastic-agent", "elastic-agent", "status"})
+	assert.Nil(t, err)
+	assert.Equal(t, "elastic-agent", composeExec.service)
+	assert.Equal(t, "root", composeExec.user)
+	assert.False(t, composeExec.detach)
+	assert.Equal(t, []string{"elastic-agent", "status"}, composeExec.command())
+}
+
+func TestParseComposeExecDetached(t *testing.T) {
+	composeExec, err := parseComposeExec([]string{"-d", "elastic-agent", "echo", "it's"})
+	assert.Nil(t, err)
+	assert.True(t, composeExec.detach)
+	assert.Equal(t, []string{"sh", "-c", `'echo' 'it'\''s' > /dev/null 2>&1 &`}, composeExec.command())
+}
+
+func TestParseComposeExecWithoutCommand(t *testing.T) {
+	_, err := parseComposeExec([]string{"-T", "elastic-agent"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,171 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	"gopkg.in/yaml.v2"
+)
+
+// runLabels the labels of the resources with the run which created them
+var runLabels = []string{config.RunIDLabel, config.ScenarioLabel, config.SuiteLabel}
+
+// composeFile the parts of a compose file needed to override its services and volumes
+type composeFile struct {
+	Version  string                 `yaml:"version"`
+	Services map[string]interface{} `yaml:"services"`
+	Volumes  map[string]interface{} `yaml:"volumes"`
+}
+
+// labelsOverride a service, a network or a volume of a compose file only overriding its labels
+type labelsOverride struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+// labelsComposeFile a compose file overriding the labels of the services, and of the default
+// network and the volumes of the project
+type labelsComposeFile struct {
+	Version  string                    `yaml:"version"`
+	Services map[string]labelsOverride `yaml:"services"`
+	Networks map[string]labelsOverride `yaml:"networks,omitempty"`
+	Volumes  map[string]labelsOverride `yaml:"volumes,omitempty"`
+}
+
+// writeRunLabelsFile writes into a dir a compose file labelling the containers of the services of
+// the compose files with the labels of the run, which is passed after them to docker-compose, so
+// that the labels are merged into the services. The services with a container keep the labels of
+// the run which created it, as docker-compose recreates the containers whose labels change. The
+// default network and the volumes of the project, which are shared by the scenarios, are labelled
+// with the run but not with the scenario. It returns an empty path if the compose files do not
+// have services, or use the first version of the format, which does not support overriding them
+func writeRunLabelsFile(dir string, project string, composeFilePaths []string, labels map[string]string, current map[string]map[string]string) (string, error) {
+	override := labelsComposeFile{
+		Services: map[string]labelsOverride{},
+	}
+	volumes := []string{}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return "", err
+		}
+
+		compose := composeFile{}
+		err = yaml.Unmarshal(bytes, &compose)
+		if err != nil {
+			return "", err
+		}
+
+		if override.Version == "" {
+			override.Version = compose.Version
+		}
+
+		for service := range compose.Services {
+			serviceLabels, exists := current[service]
+			if !exists {
+				serviceLabels = labels
+			}
+
+			override.Services[service] = labelsOverride{Labels: serviceLabels}
+		}
+
+		for volume := range compose.Volumes {
+			volumes = append(volumes, volume)
+		}
+	}
+
+	if override.Version == "" || len(override.Services) == 0 {
+		return "", nil
+	}
+
+	if supportsResourceLabels(override.Version) {
+		projectLabels := projectRunLabels(labels)
+
+		override.Networks = map[string]labelsOverride{
+			"default": {Labels: projectLabels},
+		}
+
+		for _, volume := range volumes {
+			if override.Volumes == nil {
+				override.Volumes = map[string]labelsOverride{}
+			}
+			override.Volumes[volume] = labelsOverride{Labels: projectLabels}
+		}
+	}
+
+	bytes, err := yaml.Marshal(&override)
+	if err != nil {
+		return "", err
+	}
+
+	labelsFilePath := filepath.Join(dir, project+"-labels.yml")
+
+	err = io.WriteFile(bytes, labelsFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	return labelsFilePath, nil
+}
+
+// projectRunLabels returns the labels of the run of the resources shared by the scenarios, i.e. the
+// default network and the volumes of a project, which are not labelled with the scenario
+func projectRunLabels(labels map[string]string) map[string]string {
+	projectLabels := map[string]string{}
+	for k, v := range labels {
+		if k != config.ScenarioLabel {
+			projectLabels[k] = v
+		}
+	}
+
+	return projectLabels
+}
+
+// currentRunLabels returns the labels of the run of the containers of a project, by the name of
+// their service
+func currentRunLabels(containerLabels []map[string]string) map[string]map[string]string {
+	current := map[string]map[string]string{}
+
+	for _, labels := range containerLabels {
+		service, exists := labels[composeServiceLabel]
+		if !exists {
+			continue
+		}
+
+		serviceLabels := map[string]string{}
+		for _, label := range runLabels {
+			if value, exists := labels[label]; exists {
+				serviceLabels[label] = value
+			}
+		}
+
+		current[service] = serviceLabels
+	}
+
+	return current
+}
+
+// supportsResourceLabels checks if a version of the format of the compose files supports labelling
+// the networks and the volumes, which was added in the 2.1 version
+func supportsResourceLabels(version string) bool {
+	parts := strings.SplitN(version, ".", 2)
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+
+	minor := 0
+	if len(parts) > 1 {
+		minor, _ = strconv.Atoi(parts[1])
+	}
+
+	return major > 2 || (major == 2 && minor >= 1)
+}
@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteRunLabelsFileLabelsAllTheServices(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "profile.yml")
+	filet.File(t, profile, "version: '2.3'\nservices:\n  elasticsearch:\n    image: elasticsearch\n  kibana:\n    image: kibana\n")
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  elastic-agent:\n    image: elastic-agent\n")
+
+	labelsFile, err := writeRunLabelsFile(tmpDir, "fleet", []string{profile, service}, map[string]string{config.RunIDLabel: "20201201T101530-3fa2b1"}, map[string]map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(tmpDir, "fleet-labels.yml"), labelsFile)
+
+	content, err := ioutil.ReadFile(labelsFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  elastic-agent:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+  elasticsearch:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+  kibana:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+networks:
+  default:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+`, string(content))
+}
+
+func TestWriteRunLabelsFileKeepsTheLabelsOfTheRunningContainers(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "profile.yml")
+	filet.File(t, profile, "version: '2.3'\nservices:\n  elasticsearch:\n    image: elasticsearch\nvolumes:\n  data: {}\n")
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  elastic-agent:\n    image: elastic-agent\n")
+
+	labels := map[string]string{
+		config.RunIDLabel:    "20201201T101530-3fa2b1",
+		config.ScenarioLabel: "Deploying the agent",
+		config.SuiteLabel:    "fleet",
+	}
+	current := currentRunLabels([]map[string]string{
+		{composeServiceLabel: "elasticsearch", config.RunIDLabel: "20201201T101530-3fa2b1", config.SuiteLabel: "fleet", "foo": "bar"},
+	})
+
+	labelsFile, err := writeRunLabelsFile(tmpDir, "fleet", []string{profile, service}, labels, current)
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(labelsFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  elastic-agent:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+      co.elastic.e2e.scenario: Deploying the agent
+      co.elastic.e2e.suite: fleet
+  elasticsearch:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+      co.elastic.e2e.suite: fleet
+networks:
+  default:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+      co.elastic.e2e.suite: fleet
+volumes:
+  data:
+    labels:
+      co.elastic.e2e.run-id: 20201201T101530-3fa2b1
+      co.elastic.e2e.suite: fleet
+`, string(content))
+}
+
+func TestSupportsResourceLabels(t *testing.T) {
+	assert.False(t, supportsResourceLabels("2"))
+	assert.False(t, supportsResourceLabels("2.0"))
+	assert.True(t, supportsResourceLabels("2.1"))
+	assert.True(t, supportsResourceLabels("2.3"))
+	assert.True(t, supportsResourceLabels("3.8"))
+	assert.False(t, supportsResourceLabels("latest"))
+}
+
+func TestWriteRunLabelsFileSkipsTheFirstVersionOfTheFormat(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	compose := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, compose, "redis:\n  image: redis\n")
+
+	labelsFile, err := writeRunLabelsFile(tmpDir, "redis", []string{compose}, map[string]string{config.RunIDLabel: "20201201T101530-3fa2b1"}, map[string]map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", labelsFile)
+}
@@ -0,0 +1,238 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogsOptions the options to retrieve the logs of the services
+type LogsOptions struct {
+	Filter     *regexp.Regexp // only the lines matching it are written, all if nil
+	Follow     bool
+	Since      string // a timestamp or a duration relative to now, i.e. 5m, all the logs if empty
+	Tail       string // number of lines from the end of the logs, or all
+	Timestamps bool
+}
+
+// StreamLogs writes the logs of the services of a running profile, or of a service run on its own,
+// to a writer, prefixing each line with the name of its container as docker-compose does. The
+// docker-compose project is resolved from the state persisted in the workspace, and all the
+// services of the project are included if no service is passed
+func StreamLogs(ctx context.Context, profile string, serviceNames []string, options LogsOptions, w io.Writer) error {
+	project, err := resolveLogsProject(listState(), profile, serviceNames)
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return err
+	}
+
+	containers, err = selectServiceContainers(containers, serviceNames)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"project":  project,
+			"services": serviceNames,
+		}).Error("Could not find the containers of the services")
+		return err
+	}
+
+	width := 0
+	for _, container := range containers {
+		if len(containerName(container)) > width {
+			width = len(containerName(container))
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, len(containers))
+
+	for _, container := range containers {
+		wg.Add(1)
+		go func(container types.Container) {
+			defer wg.Done()
+
+			lw := &logsWriter{
+				filter: options.Filter,
+				mu:     &mu,
+				prefix: fmt.Sprintf("%-*s | ", width, containerName(container)),
+				w:      w,
+			}
+
+			err := docker.StreamContainerLogs(ctx, container.ID, types.ContainerLogsOptions{
+				Follow:     options.Follow,
+				Since:      options.Since,
+				Tail:       options.Tail,
+				Timestamps: options.Timestamps,
+			}, lw)
+			if err == nil {
+				err = lw.Flush()
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(container)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// containerName returns the name of a container, i.e. fleet_elasticsearch_1
+func containerName(container types.Container) string {
+	if len(container.Names) == 0 {
+		return container.ID
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/")
+}
+
+// resolveLogsProject returns the docker-compose project of a running profile, or of a service run
+// on its own when no profile is passed, from the state of the runs
+func resolveLogsProject(runs []state.Run, profile string, serviceNames []string) (string, error) {
+	id := profile + "-profile"
+	composeName := profile
+	if profile == "" {
+		if len(serviceNames) != 1 {
+			return "", fmt.Errorf("a profile is required to select %d services, i.e. --profile fleet", len(serviceNames))
+		}
+
+		id = serviceNames[0] + "-service"
+		composeName = serviceNames[0]
+	}
+
+	for _, run := range runs {
+		if run.ID == id {
+			return config.GetComposeProjectName(composeName), nil
+		}
+	}
+
+	if profile == "" {
+		return "", fmt.Errorf("the %s service is not running on its own, use --profile to select the profile running it", composeName)
+	}
+
+	return "", fmt.Errorf("the %s profile is not running", profile)
+}
+
+// selectServiceContainers returns the containers of some services, sorted by their name, or all
+// of them if no service is passed. It fails if a service has no containers
+func selectServiceContainers(containers []types.Container, serviceNames []string) ([]types.Container, error) {
+	selected := []types.Container{}
+	for _, container := range containers {
+		if len(serviceNames) == 0 || contains(serviceNames, container.Labels[composeServiceLabel]) {
+			selected = append(selected, container)
+		}
+	}
+
+	for _, serviceName := range serviceNames {
+		found := false
+		for _, container := range selected {
+			if container.Labels[composeServiceLabel] == serviceName {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("the %s service has no containers", serviceName)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("there are no containers")
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return containerName(selected[i]) < containerName(selected[j])
+	})
+
+	return selected, nil
+}
+
+// contains returns if a value is in a slice
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// logsWriter writes the lines of the logs of a container, prefixed, to a writer shared with the
+// rest of containers, skipping the lines not matching the filter. As the logs are read in chunks,
+// the lines are written once they are complete, so that they are not mixed
+type logsWriter struct {
+	buffer []byte
+	filter *regexp.Regexp
+	mu     *sync.Mutex
+	prefix string
+	w      io.Writer
+}
+
+// Write writes the complete lines of a chunk of the logs, keeping the last one if incomplete
+func (lw *logsWriter) Write(p []byte) (int, error) {
+	lw.buffer = append(lw.buffer, p...)
+
+	for {
+		i := bytes.IndexByte(lw.buffer, '\n')
+		if i < 0 {
+			break
+		}
+
+		err := lw.writeLine(lw.buffer[:i])
+		lw.buffer = append(lw.buffer[:0], lw.buffer[i+1:]...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the last line of the logs, which could not end with a new line
+func (lw *logsWriter) Flush() error {
+	if len(lw.buffer) == 0 {
+		return nil
+	}
+
+	err := lw.writeLine(lw.buffer)
+	lw.buffer = lw.buffer[:0]
+
+	return err
+}
+
+func (lw *logsWriter) writeLine(line []byte) error {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if lw.filter != nil && !lw.filter.Match(line) {
+		return nil
+	}
+
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	_, err := fmt.Fprintf(lw.w, "%s%s\n", lw.prefix, line)
+	return err
+}
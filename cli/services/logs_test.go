@@ -0,0 +1,84 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogsWriterWritesCompleteLines(t *testing.T) {
+	var out bytes.Buffer
+	lw := &logsWriter{mu: &sync.Mutex{}, prefix: "fleet_kibana_1 | ", w: &out}
+
+	_, err := lw.Write([]byte("first line\nsecond "))
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet_kibana_1 | first line\n", out.String())
+
+	_, err = lw.Write([]byte("line\r\nthird line"))
+	assert.Nil(t, err)
+	assert.Nil(t, lw.Flush())
+	assert.Equal(t, "fleet_kibana_1 | first line\nfleet_kibana_1 | second line\nfleet_kibana_1 | third line\n", out.String())
+}
+
+func TestLogsWriterFiltersLines(t *testing.T) {
+	var out bytes.Buffer
+	lw := &logsWriter{filter: regexp.MustCompile("ERROR|WARN"), mu: &sync.Mutex{}, w: &out}
+
+	_, err := lw.Write([]byte("INFO started\nERROR failed\nWARN retrying\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR failed\nWARN retrying\n", out.String())
+}
+
+func TestResolveLogsProject(t *testing.T) {
+	runs := []state.Run{{ID: "apache-service"}, {ID: "fleet-profile", Profile: "fleet"}}
+
+	project, err := resolveLogsProject(runs, "fleet", []string{"elastic-agent"})
+	assert.Nil(t, err)
+	assert.Equal(t, "fleet", project)
+
+	project, err = resolveLogsProject(runs, "", []string{"apache"})
+	assert.Nil(t, err)
+	assert.Equal(t, "apache", project)
+
+	_, err = resolveLogsProject(runs, "metricbeat", nil)
+	assert.NotNil(t, err)
+
+	_, err = resolveLogsProject(runs, "", []string{"mysql"})
+	assert.NotNil(t, err)
+
+	_, err = resolveLogsProject(runs, "", []string{"apache", "mysql"})
+	assert.NotNil(t, err)
+}
+
+func TestSelectServiceContainers(t *testing.T) {
+	containers := []types.Container{
+		{Labels: map[string]string{composeServiceLabel: "kibana"}, Names: []string{"/fleet_kibana_1"}},
+		{Labels: map[string]string{composeServiceLabel: "elastic-agent"}, Names: []string{"/fleet_elastic-agent_2"}},
+		{Labels: map[string]string{composeServiceLabel: "elastic-agent"}, Names: []string{"/fleet_elastic-agent_1"}},
+	}
+
+	selected, err := selectServiceContainers(containers, []string{"elastic-agent"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(selected))
+	assert.Equal(t, "fleet_elastic-agent_1", containerName(selected[0]))
+	assert.Equal(t, "fleet_elastic-agent_2", containerName(selected[1]))
+
+	selected, err = selectServiceContainers(containers, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(selected))
+
+	_, err = selectServiceContainers(containers, []string{"elastic-agent", "apache"})
+	assert.NotNil(t, err)
+
+	_, err = selectServiceContainers(nil, nil)
+	assert.NotNil(t, err)
+}
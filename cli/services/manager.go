@@ -5,32 +5,71 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/elastic/e2e-testing/cli/config"
-	state "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
 
 	log "github.com/sirupsen/logrus"
-	tc "github.com/testcontainers/testcontainers-go"
 )
 
 // ServiceManager manages lifecycle of a service
 type ServiceManager interface {
 	AddServicesToCompose(profile string, composeNames []string, env map[string]string) error
+	CreateNetwork(composeName string, env map[string]string) error
+	ExecCommandInService(profile string, service string, cmds []string) (shell.ExecResult, error)
+	PullImages(profile string, composeNames []string, env map[string]string) error
+	RemoveNetwork(composeName string) error
 	RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error
 	RunCommand(profile string, composeNames []string, composeArgs []string, env map[string]string) error
 	RunCompose(isProfile bool, composeNames []string, env map[string]string) error
+	ScaleService(profile string, service string, replicas int, env map[string]string) error
+	SetServiceAliases(profile string, service string, aliases []string) error
 	StopCompose(isProfile bool, composeNames []string) error
+	WaitForHealthy(profile string, composeNames []string, options WaitOptions) error
 }
 
 // DockerServiceManager implementation of the service manager interface
 type DockerServiceManager struct {
 }
 
-// NewServiceManager returns a new service manager
+// composeInvocation the compose files of a profile, or of services, and the environment they are
+// run with, which are resolved in the same manner for all the commands
+type composeInvocation struct {
+	env              map[string]string
+	filePaths        []string // the compose files of the profile and the services
+	id               string   // the ID of the state of the run
+	invokedFilePaths []string // the compose files with the ones overriding their labels, security, resources and aliases
+	project          string
+}
+
+// ServiceManagerEnvVar the environment variable selecting the service manager: docker-compose
+// (default), docker-api, which runs the compose files without the docker-compose binary, or kubernetes
+const ServiceManagerEnvVar = "OP_SERVICE_MANAGER"
+
+// NewServiceManager returns a new service manager, which is selected with the OP_SERVICE_MANAGER
+// environment variable. Its operations are traced when a span starter is set
 func NewServiceManager() ServiceManager {
-	return &DockerServiceManager{}
+	var sm ServiceManager = &DockerServiceManager{}
+	switch shell.GetEnv(ServiceManagerEnvVar, "docker-compose") {
+	case "docker-api":
+		sm = NewDockerAPIServiceManager()
+	case "kubernetes":
+		sm = NewKubernetesServiceManager()
+	}
+
+	if starter := getSpanStarter(); starter != nil {
+		return &tracedServiceManager{sm: sm, starter: starter}
+	}
+
+	return sm
 }
 
 // AddServicesToCompose adds services to a running docker compose
@@ -43,7 +82,7 @@ func (sm *DockerServiceManager) AddServicesToCompose(profile string, composeName
 	newComposeNames := []string{profile}
 	newComposeNames = append(newComposeNames, composeNames...)
 
-	persistedEnv := state.Recover(profile+"-profile", config.Op.Workspace)
+	persistedEnv := recoverState(profile + "-profile")
 	for k, v := range env {
 		persistedEnv[k] = v
 	}
@@ -56,6 +95,104 @@ func (sm *DockerServiceManager) AddServicesToCompose(profile string, composeName
 	return nil
 }
 
+// CreateNetwork creates the default network of the project of a profile, or of a service run on its
+// own, before its services run, so that it's not created by docker-compose. Its addresses are
+// allocated in the subnet set in the NETWORK_SUBNET variable of the environment, or in the
+// OP_NETWORK_SUBNET environment variable, if any. The network is reused if it already exists
+func (sm *DockerServiceManager) CreateNetwork(composeName string, env map[string]string) error {
+	project := config.GetComposeProjectName(composeName)
+
+	err := createProjectNetwork(project, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"project": project,
+		}).Error("Could not create the network of the project")
+		return err
+	}
+
+	return nil
+}
+
+// ExecCommandInService executes a command in the container of a service of a running profile, or of
+// a service run on its own, returning its output and its exit code, so that the callers can check
+// the output of the failing commands too
+func (sm *DockerServiceManager) ExecCommandInService(profile string, service string, cmds []string) (shell.ExecResult, error) {
+	project := config.GetComposeProjectName(profile)
+	if profile == "" {
+		project = config.GetComposeProjectName(service)
+	}
+
+	container, err := docker.GetComposeServiceContainer(project, service)
+	if err != nil {
+		return shell.ExecResult{}, err
+	}
+
+	result, err := docker.ExecCommandIntoContainerWithResult(context.Background(), container.ID, "root", cmds)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command": cmds,
+			"error":   err,
+			"profile": profile,
+			"service": service,
+		}).Error("Could not execute command in the service")
+		return shell.ExecResult{}, err
+	}
+
+	return result, nil
+}
+
+// PullImages pulls the images of the services of a profile and the services added to it, with the
+// variables of the compose files replaced, so that they are not pulled in the middle of the
+// scenarios. The images are pulled concurrently, skipping the ones already present, and loaded
+// from the cache dir set in the OP_IMAGES_CACHE_DIR env var, if any. The images pinned by the
+// lockfile set in the OP_IMAGES_LOCKFILE env var are pulled by their digest
+func (sm *DockerServiceManager) PullImages(profile string, composeNames []string, env map[string]string) error {
+	composeFilePaths, err := profileComposeFiles(profile, composeNames)
+	if err != nil {
+		return err
+	}
+
+	images, err := composeImages(composeFilePaths, renderEnvironment(env))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pullTimeout)
+	defer cancel()
+
+	// the images pinned by the lockfile, if any, are pulled by their digest
+	lock, locked, err := config.GetImagesLock()
+	if err != nil {
+		return err
+	}
+	if locked {
+		images, err = pullLockedImages(ctx, images, lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pullImages(ctx, images, shell.GetEnv(ImagesCacheDirEnvVar, ""))
+}
+
+// RemoveNetwork removes the default network of the project of a profile, or of a service run on its
+// own, once its services are stopped. It does nothing if the network does not exist
+func (sm *DockerServiceManager) RemoveNetwork(composeName string) error {
+	project := config.GetComposeProjectName(composeName)
+
+	err := removeProjectNetwork(project)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"project": project,
+		}).Error("Could not remove the network of the project")
+		return err
+	}
+
+	return nil
+}
+
 // RemoveServicesFromCompose removes services from a running docker compose
 func (sm *DockerServiceManager) RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error {
 	log.WithFields(log.Fields{
@@ -66,7 +203,7 @@ func (sm *DockerServiceManager) RemoveServicesFromCompose(profile string, compos
 	newComposeNames := []string{profile}
 	newComposeNames = append(newComposeNames, composeNames...)
 
-	persistedEnv := state.Recover(profile+"-profile", config.Op.Workspace)
+	persistedEnv := recoverState(profile + "-profile")
 	for k, v := range env {
 		persistedEnv[k] = v
 	}
@@ -75,7 +212,12 @@ func (sm *DockerServiceManager) RemoveServicesFromCompose(profile string, compos
 		command := []string{"rm", "-fvs"}
 		command = append(command, composeName)
 
-		err := executeCompose(sm, true, newComposeNames, command, persistedEnv)
+		var err error
+		if config.GetContainerRuntime().IsPodmanCompose() {
+			err = removeServiceContainers(config.GetComposeProjectName(profile), composeName)
+		} else {
+			err = executeCompose(sm, true, newComposeNames, command, persistedEnv)
+		}
 		if err != nil {
 			log.WithFields(log.Fields{
 				"command": command,
@@ -103,7 +245,82 @@ func (sm *DockerServiceManager) RunCompose(isProfile bool, composeNames []string
 	return executeCompose(sm, isProfile, composeNames, []string{"up", "-d"}, env)
 }
 
-// StopCompose stops a docker compose by its name
+// ScaleService runs a number of replicas of a service in a running profile, as "docker-compose up
+// --scale" does, keeping its running containers. The replicas are removed down to the number of
+// replicas when there are more
+func (sm *DockerServiceManager) ScaleService(profile string, service string, replicas int, env map[string]string) error {
+	if replicas < 1 {
+		return fmt.Errorf("The %s service cannot be scaled to %d replicas", service, replicas)
+	}
+
+	persistedEnv := recoverState(profile + "-profile")
+	for k, v := range env {
+		persistedEnv[k] = v
+	}
+
+	err := executeCompose(sm, true, []string{profile, service}, scaleCommand(service, replicas), persistedEnv)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"profile":  profile,
+			"replicas": replicas,
+			"service":  service,
+		}).Error("Could not scale the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"profile":  profile,
+		"replicas": replicas,
+		"service":  service,
+	}).Debug("The service has been scaled")
+
+	return nil
+}
+
+// SetServiceAliases replaces the aliases of the container of a service of a running profile, or of a
+// service run on its own, in the default network of its project, so that the other services resolve
+// it by other names, or by none if they are empty, i.e. to exercise the failures resolving it. The
+// aliases it was run with are restored when they are nil
+func (sm *DockerServiceManager) SetServiceAliases(profile string, service string, aliases []string) error {
+	composeName := profile
+	ID := profile + "-profile"
+	if profile == "" {
+		composeName = service
+		ID = service + "-service"
+	}
+	project := config.GetComposeProjectName(composeName)
+
+	if aliases == nil {
+		aliases = config.GetServiceAliases(recoverState(ID), project, service)
+	}
+
+	container, err := docker.GetComposeServiceContainer(project, service)
+	if err != nil {
+		return err
+	}
+
+	err = docker.SetContainerNetworkAliases(context.Background(), container.ID, projectNetworkName(project), aliases)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"aliases": aliases,
+			"error":   err,
+			"profile": profile,
+			"service": service,
+		}).Error("Could not replace the aliases of the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"aliases": aliases,
+		"profile": profile,
+		"service": service,
+	}).Debug("The aliases of the service have been replaced")
+
+	return nil
+}
+
+// StopCompose stops a docker compose by its name, removing the volumes of a profile
 func (sm *DockerServiceManager) StopCompose(isProfile bool, composeNames []string) error {
 	composeFilePaths := make([]string, len(composeNames))
 	for i, composeName := range composeNames {
@@ -123,13 +340,25 @@ func (sm *DockerServiceManager) StopCompose(isProfile bool, composeNames []strin
 	if isProfile {
 		ID = composeNames[0] + "-profile"
 	}
-	persistedEnv := state.Recover(ID, config.Op.Workspace)
+	persistedEnv := recoverState(ID)
 
-	err := executeCompose(sm, isProfile, composeNames, []string{"down", "--remove-orphans"}, persistedEnv)
+	// the data of the profile, i.e. the one of Elasticsearch, is removed with it, so that the next run
+	// starts from scratch
+	downArgs := []string{"down", "--remove-orphans"}
+	if isProfile {
+		downArgs = append(downArgs, "--volumes")
+	}
+
+	err := executeCompose(sm, isProfile, composeNames, downArgs, persistedEnv)
+	if err != nil {
+		return fmt.Errorf("Could not stop compose file: %v - %v", composeFilePaths, err)
+	}
+	defer destroyState(ID)
+
+	err = sm.RemoveNetwork(composeNames[0])
 	if err != nil {
 		return fmt.Errorf("Could not stop compose file: %v - %v", composeFilePaths, err)
 	}
-	defer state.Destroy(ID, config.Op.Workspace)
 
 	log.WithFields(log.Fields{
 		"composeFilePath": composeFilePaths,
@@ -139,7 +368,150 @@ func (sm *DockerServiceManager) StopCompose(isProfile bool, composeNames []strin
 	return nil
 }
 
+// WaitForHealthy waits for services of a running profile, or a service run on its own, to be
+// healthy, checking them with a poll interval until a timeout. All its services are checked when
+// there are none
+func (sm *DockerServiceManager) WaitForHealthy(profile string, composeNames []string, options WaitOptions) error {
+	options = options.withDefaults()
+	project := config.GetComposeProjectName(profile)
+
+	deadline := time.Now().Add(options.Timeout)
+	for {
+		unhealthy, err := getUnhealthyServices(project, composeNames)
+		if err == nil && len(unhealthy) == 0 {
+			log.WithFields(log.Fields{
+				"profile":  profile,
+				"services": composeNames,
+			}).Debug("The services are healthy")
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("The services are not healthy after %s: %s", options.Timeout, strings.Join(unhealthy, ", "))
+			}
+			log.WithFields(log.Fields{
+				"error":    err,
+				"profile":  profile,
+				"services": composeNames,
+				"timeout":  options.Timeout,
+			}).Error("The services could not get the healthy status")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"error":     err,
+			"profile":   profile,
+			"unhealthy": unhealthy,
+		}).Trace("Waiting for the services to be healthy")
+
+		time.Sleep(options.PollInterval)
+	}
+}
+
+// removeServiceContainers removes the containers, running or not, of a service of a compose project
+// with the API of the container runtime, as podman-compose does not support the rm command
+func removeServiceContainers(project string, service string) error {
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return err
+	}
+
+	for _, container := range containers {
+		if container.Labels[composeServiceLabel] != service {
+			continue
+		}
+
+		err := docker.RemoveContainer(container.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listRunLabels returns the labels of the run of the containers of a docker-compose project, by
+// the name of their service, which are empty if they cannot be listed
+func listRunLabels(project string) map[string]map[string]string {
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return map[string]map[string]string{}
+	}
+
+	containerLabels := []map[string]string{}
+	for _, container := range containers {
+		containerLabels = append(containerLabels, container.Labels)
+	}
+
+	return currentRunLabels(containerLabels)
+}
+
 func executeCompose(sm *DockerServiceManager, isProfile bool, composeNames []string, command []string, env map[string]string) error {
+	invocation, err := newComposeInvocation(isProfile, composeNames, env)
+	if err != nil {
+		return err
+	}
+
+	// the network is created before docker-compose creates the containers attached to it
+	if command[0] == "up" || command[0] == "run" {
+		err = sm.CreateNetwork(composeNames[0], invocation.env)
+		if err != nil {
+			return fmt.Errorf("Could not run compose file: %v - %v", invocation.filePaths, err)
+		}
+	}
+
+	err = runComposeCommand(config.GetContainerRuntime(), invocation, command)
+	if err != nil {
+		return fmt.Errorf("Could not run compose file: %v - %v", invocation.filePaths, err)
+	}
+
+	defer updateState(invocation.id, invocation.filePaths, invocation.env)
+
+	log.WithFields(log.Fields{
+		"cmd":              command,
+		"composeFilePaths": invocation.filePaths,
+		"env":              invocation.env,
+		"profile":          composeNames[0],
+	}).Debug("Docker compose executed.")
+
+	return nil
+}
+
+// scaleCommand returns the docker-compose command running a number of replicas of a service, which
+// keeps its running containers, even if their options changed
+func scaleCommand(service string, replicas int) []string {
+	return []string{"up", "-d", "--no-recreate", "--scale", fmt.Sprintf("%s=%d", service, replicas), service}
+}
+
+// composeCommandArgs returns the args of the compose executable of a container runtime running a
+// command over the compose files of a project, activating the profiles of the compose specification
+// set in the environment of the compose files
+func composeCommandArgs(runtime config.ContainerRuntime, invocation composeInvocation, command []string) []string {
+	args := append([]string{}, runtime.ComposeArgs...)
+
+	for _, filePath := range invocation.invokedFilePaths {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			absPath = filePath
+		}
+		args = append(args, "-f", absPath)
+	}
+
+	args = append(args, "-p", invocation.project)
+
+	for _, profile := range config.GetComposeProfiles(invocation.env) {
+		args = append(args, "--profile", profile)
+	}
+
+	return append(args, command...)
+}
+
+// newComposeInvocation resolves the compose files of a profile, or of services, and the environment
+// they are run with, writing the compose files overriding the labels of their services with the
+// ones of the run, running the secured services with their security options, limiting the
+// resources of the services, and adding their aliases in the default network of the project
+func newComposeInvocation(isProfile bool, composeNames []string, env map[string]string) (composeInvocation, error) {
 	composeFilePaths := make([]string, len(composeNames))
 	for i, composeName := range composeNames {
 		b := false
@@ -149,34 +521,99 @@ func executeCompose(sm *DockerServiceManager, isProfile bool, composeNames []str
 
 		composeFilePath, err := config.GetComposeFile(b, composeName)
 		if err != nil {
-			return fmt.Errorf("Could not get compose file: %s - %v", composeFilePath, err)
+			return composeInvocation{}, fmt.Errorf("Could not get compose file: %s - %v", composeFilePath, err)
 		}
 		composeFilePaths[i] = composeFilePath
 	}
 
-	compose := tc.NewLocalDockerCompose(composeFilePaths, composeNames[0])
-	execError := compose.
-		WithCommand(command).
-		WithEnv(env).
-		Invoke()
-	err := execError.Error
-	if err != nil {
-		return fmt.Errorf("Could not run compose file: %v - %v", composeFilePaths, err)
-	}
-
 	suffix := "-service"
 	if isProfile {
 		suffix = "-profile"
 	}
 	ID := filepath.Base(filepath.Dir(composeFilePaths[0])) + suffix
-	defer state.Update(ID, config.Op.Workspace, composeFilePaths, env)
+
+	env = config.PutWorkerEnvironment(env)
+	env = config.PutSecurityEnvironment(env)
+	env = config.PutRuntimeEnvironment(env)
+	env = config.PutArchEnvironment(env)
+
+	// the services started by a previous run keep its ID, so that they are not recreated
+	if _, exists := env[config.RunIDKey]; !exists {
+		if runID, persisted := recoverState(ID)[config.RunIDKey]; persisted {
+			env[config.RunIDKey] = runID
+		}
+	}
+	env = config.PutRunEnvironment(env)
+
+	projectName := config.GetComposeProjectName(composeNames[0])
+
+	invokedFilePaths := composeFilePaths
+	labelsFilePath, err := writeRunLabelsFile(config.GetStateDir(), projectName, composeFilePaths, config.GetRunLabels(env[config.RunIDKey]), listRunLabels(projectName))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"project": projectName,
+		}).Warn("Could not label the containers with the ID of the run")
+	} else if labelsFilePath != "" {
+		invokedFilePaths = append(append([]string{}, composeFilePaths...), labelsFilePath)
+	}
+
+	securityFilePath, err := writeServiceSecurityFile(config.GetStateDir(), projectName, composeFilePaths, env)
+	if err != nil {
+		return composeInvocation{}, fmt.Errorf("Could not run the services secured: %v - %v", composeFilePaths, err)
+	} else if securityFilePath != "" {
+		invokedFilePaths = append(append([]string{}, invokedFilePaths...), securityFilePath)
+	}
+
+	resourcesFilePath, err := writeServiceResourcesFile(config.GetStateDir(), projectName, composeFilePaths, env)
+	if err != nil {
+		return composeInvocation{}, fmt.Errorf("Could not limit the resources of the services: %v - %v", composeFilePaths, err)
+	} else if resourcesFilePath != "" {
+		invokedFilePaths = append(append([]string{}, invokedFilePaths...), resourcesFilePath)
+	}
+
+	networkFilePath, err := writeServiceNetworkFile(config.GetStateDir(), projectName, composeFilePaths, env)
+	if err != nil {
+		return composeInvocation{}, fmt.Errorf("Could not add the aliases of the services: %v - %v", composeFilePaths, err)
+	} else if networkFilePath != "" {
+		invokedFilePaths = append(append([]string{}, invokedFilePaths...), networkFilePath)
+	}
+
+	return composeInvocation{
+		env:              env,
+		filePaths:        composeFilePaths,
+		id:               ID,
+		invokedFilePaths: invokedFilePaths,
+		project:          projectName,
+	}, nil
+}
+
+// runComposeCommand runs a command over the compose files of a project with the compose executable
+// of a container runtime: the legacy docker-compose binary, the Compose V2 plugin of Docker, or
+// podman-compose. The command runs in the dir of the first compose file, with the environment of the
+// compose files, writing its output to the output of the tool
+func runComposeCommand(runtime config.ContainerRuntime, invocation composeInvocation, command []string) error {
+	args := composeCommandArgs(runtime, invocation, command)
+
+	cmd := exec.Command(runtime.ComposeExecutable, args...)
+	cmd.Dir = filepath.Dir(invocation.filePaths[0])
+	cmd.Env = os.Environ()
+	for k, v := range invocation.env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 
 	log.WithFields(log.Fields{
-		"cmd":              command,
-		"composeFilePaths": composeFilePaths,
-		"env":              env,
-		"profile":          composeNames[0],
-	}).Debug("Docker compose executed.")
+		"args":       args,
+		"executable": runtime.ComposeExecutable,
+		"project":    invocation.project,
+	}).Trace("Running compose command")
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s exited abnormally whilst running %v: %v", strings.Join(append([]string{runtime.ComposeExecutable}, runtime.ComposeArgs...), " "), command, err)
+	}
 
 	return nil
 }
@@ -0,0 +1,43 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposeCommandArgs(t *testing.T) {
+	invocation := composeInvocation{
+		env:              map[string]string{config.ComposeProfilesKey: "fleet-server,apm-server"},
+		invokedFilePaths: []string{"/tmp/fleet/docker-compose.yml", "/tmp/fleet-labels.yml"},
+		project:          "fleet",
+	}
+
+	composeV2 := config.ContainerRuntime{ComposeArgs: []string{"compose"}, ComposeExecutable: "docker", Executable: "docker"}
+
+	args := composeCommandArgs(composeV2, invocation, []string{"up", "-d"})
+	assert.Equal(t, []string{
+		"compose",
+		"-f", "/tmp/fleet/docker-compose.yml",
+		"-f", "/tmp/fleet-labels.yml",
+		"-p", "fleet",
+		"--profile", "fleet-server",
+		"--profile", "apm-server",
+		"up", "-d",
+	}, args)
+
+	invocation.env = map[string]string{config.ComposeProfilesKey: ""}
+	legacy := config.ContainerRuntime{ComposeExecutable: "docker-compose", Executable: "docker"}
+
+	args = composeCommandArgs(legacy, invocation, []string{"ps"})
+	assert.Equal(t, []string{"-f", "/tmp/fleet/docker-compose.yml", "-f", "/tmp/fleet-labels.yml", "-p", "fleet", "ps"}, args)
+}
+
+func TestScaleCommand(t *testing.T) {
+	assert.Equal(t, []string{"up", "-d", "--no-recreate", "--scale", "fleet-server=2", "fleet-server"}, scaleCommand("fleet-server", 2))
+}
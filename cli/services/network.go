@@ -0,0 +1,157 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// networkOverride a service of a compose file only overriding its aliases in the default network of
+// the project
+type networkOverride struct {
+	Networks map[string]networkAliases `yaml:"networks"`
+}
+
+// networkAliases the aliases of a service in a network
+type networkAliases struct {
+	Aliases []string `yaml:"aliases"`
+}
+
+// networkComposeFile a compose file overriding the aliases of the services in the default network
+// of the project
+type networkComposeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]networkOverride `yaml:"services"`
+}
+
+// writeServiceNetworkFile writes into a dir a compose file adding the aliases of the services of the
+// compose files in the default network of the project, which is passed after them to docker-compose,
+// so that the services are resolved by the same names in every run, i.e. kibana.fleet. The name of
+// the service is not added, as docker-compose always adds it. It returns an empty path if no service
+// has other aliases, or the compose files use the first version of the format, which does not
+// support networks
+func writeServiceNetworkFile(dir string, project string, composeFilePaths []string, env map[string]string) (string, error) {
+	override := networkComposeFile{
+		Services: map[string]networkOverride{},
+	}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return "", err
+		}
+
+		compose := composeFile{}
+		err = yaml.Unmarshal(bytes, &compose)
+		if err != nil {
+			return "", err
+		}
+
+		if override.Version == "" {
+			override.Version = compose.Version
+		}
+
+		for service := range compose.Services {
+			aliases := []string{}
+			for _, alias := range config.GetServiceAliases(env, project, service) {
+				if alias != service {
+					aliases = append(aliases, alias)
+				}
+			}
+
+			if len(aliases) == 0 {
+				continue
+			}
+
+			override.Services[service] = networkOverride{
+				Networks: map[string]networkAliases{
+					"default": {Aliases: aliases},
+				},
+			}
+		}
+	}
+
+	if override.Version == "" || len(override.Services) == 0 {
+		return "", nil
+	}
+
+	bytes, err := yaml.Marshal(&override)
+	if err != nil {
+		return "", err
+	}
+
+	networkFilePath := filepath.Join(dir, project+"-network.yml")
+
+	err = io.WriteFile(bytes, networkFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	return networkFilePath, nil
+}
+
+// createProjectNetwork creates the default network of a project before its services run, labelled
+// as docker-compose labels it, so that docker-compose uses it instead of creating it, and with the
+// labels of the run, so that it's removed with the orphans of the run. Its addresses are allocated in
+// the subnet set in the environment, if any. The network is reused if it already exists
+func createProjectNetwork(project string, env map[string]string) error {
+	subnet, err := config.GetNetworkSubnet(env)
+	if err != nil {
+		return err
+	}
+
+	labels := mergeMapping(projectRunLabels(config.GetRunLabels(env[config.RunIDKey])), map[string]string{
+		composeNetworkLabel: "default",
+		composeProjectLabel: strings.ToLower(project),
+	})
+
+	_, err = docker.CreateNetwork(context.Background(), projectNetworkName(project), labels, subnet)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"network": projectNetworkName(project),
+		"project": project,
+		"subnet":  subnet,
+	}).Trace("The network of the project is ready")
+
+	return nil
+}
+
+// removeProjectNetwork removes the default network of a project once its services are stopped. It
+// does nothing if the network was removed already, i.e. by docker-compose
+func removeProjectNetwork(project string) error {
+	networks, err := docker.ListLabelledNetworks(composeProjectLabel + "=" + strings.ToLower(project))
+	if err != nil {
+		return err
+	}
+
+	for _, network := range networks {
+		if network.Name != projectNetworkName(project) {
+			continue
+		}
+
+		err := docker.RemoveNetwork(network.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// projectNetworkName returns the name of the default network of a project, i.e. fleet_default
+func projectNetworkName(project string) string {
+	return strings.ToLower(project) + "_default"
+}
@@ -0,0 +1,90 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteServiceNetworkFile(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, profileComposeFile)
+
+	networkFile, err := writeServiceNetworkFile(tmpDir, "fleet", []string{profile}, map[string]string{"KIBANA_ALIASES": "kibana.local,kibana"})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(tmpDir, "fleet-network.yml"), networkFile)
+
+	content, err := ioutil.ReadFile(networkFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  elasticsearch:
+    networks:
+      default:
+        aliases:
+        - elasticsearch.fleet
+  kibana:
+    networks:
+      default:
+        aliases:
+        - kibana.fleet
+        - kibana.local
+`, string(content))
+
+	project, err := loadComposeProject("fleet", []string{profile, networkFile}, map[string]string{})
+	assert.Nil(t, err)
+
+	spec, err := newContainerSpec(project, "kibana")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"kibana", "kibana.fleet", "kibana.local"}, spec.NetworkingConfig.EndpointsConfig["fleet_default"].Aliases)
+}
+
+func TestWriteServiceNetworkFileSkipsTheFirstVersionOfTheFormat(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "mysql:\n  image: mysql\n")
+
+	networkFile, err := writeServiceNetworkFile(tmpDir, "metricbeat", []string{service}, map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", networkFile)
+}
+
+func TestComposeNetworks(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, `version: '2.3'
+services:
+  elasticsearch:
+    image: elasticsearch
+    networks:
+      - default
+  kibana:
+    image: kibana
+    networks:
+      default:
+        aliases:
+          - kb
+`)
+
+	project, err := loadComposeProject("fleet", []string{profile}, map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, composeNetworks{"default": []string{}}, project.services["elasticsearch"].Networks)
+	assert.Equal(t, composeNetworks{"default": []string{"kb"}}, project.services["kibana"].Networks)
+}
@@ -0,0 +1,565 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/mitchellh/go-homedir"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// the status of a preflight check of the host
+const (
+	CheckPassed  CheckStatus = "ok"
+	CheckWarning CheckStatus = "warning"
+	CheckFailed  CheckStatus = "error"
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// minDockerVersion the oldest version of the Docker daemon supporting the options of the compose files
+const minDockerVersion = "19.03.0"
+
+// minComposeVersion the oldest version of docker-compose supporting the 2.3 format of the compose files,
+// with the limits of the resources
+const minComposeVersion = "1.25.0"
+
+// minMaxMapCount the minimum vm.max_map_count of the kernel for Elasticsearch
+const minMaxMapCount = 262144
+
+// maxMapCountPath the file of the kernel setting with the max number of memory maps of a process
+var maxMapCountPath = "/proc/sys/vm/max_map_count"
+
+// dockerHubRegistry the registry of the images without a registry, as stored by "docker login"
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// CheckStatus the status of a preflight check: ok, warning, error or skipped
+type CheckStatus string
+
+// PreflightOptions the options of the checks of the host
+type PreflightOptions struct {
+	MinDiskSpace int64  // the min free bytes of the disk of the Docker daemon
+	MinMemory    int64  // the min bytes of memory available to the Docker daemon
+	Profile      string // the profile whose ports and registries are checked, none if empty
+}
+
+// CheckResult the result of a preflight check, with the remediation of its issue, if any
+type CheckResult struct {
+	Check       string      `json:"check"`
+	Message     string      `json:"message"`
+	Remediation string      `json:"remediation,omitempty"`
+	Status      CheckStatus `json:"status"`
+}
+
+// preflightComposeFile the parts of a compose file checked before running it
+type preflightComposeFile struct {
+	Services map[string]struct {
+		Image string   `yaml:"image"`
+		Ports []string `yaml:"ports"`
+	} `yaml:"services"`
+}
+
+// dockerConfigFile the parts of the config file of the Docker CLI with the credentials of the registries
+type dockerConfigFile struct {
+	Auths       map[string]interface{} `json:"auths"`
+	CredHelpers map[string]string      `json:"credHelpers"`
+}
+
+// RunPreflightChecks validates that the host can run the profiles and the test suites: the Docker
+// daemon is reachable in a supported version, docker-compose is available, there is enough memory
+// and disk, the kernel allows the memory maps of Elasticsearch, the ports published by the profile
+// are free, and there are credentials for the registries of its images
+func RunPreflightChecks(options PreflightOptions) []CheckResult {
+	results := []CheckResult{}
+
+	containerRuntime := config.GetContainerRuntime()
+
+	info, version, err := docker.GetServerInfo(context.Background())
+	results = append(results, checkDockerDaemon(containerRuntime.Name, version.Version, err))
+	dockerReachable := err == nil
+
+	results = append(results, checkCompose(containerRuntime))
+
+	if dockerReachable {
+		results = append(results, checkMemory(info.MemTotal, options.MinMemory))
+		results = append(results, checkDiskSpace(diskSpacePath(info.DockerRootDir), options.MinDiskSpace))
+	} else {
+		results = append(results, skippedCheck("memory", "The Docker daemon is not reachable"))
+		results = append(results, skippedCheck("disk", "The Docker daemon is not reachable"))
+	}
+
+	results = append(results, checkMaxMapCount(runtime.GOOS))
+
+	if options.Profile == "" {
+		return results
+	}
+
+	compose, err := readPreflightComposeFile(options.Profile)
+	if err != nil {
+		results = append(results, CheckResult{
+			Check:       "profile",
+			Message:     fmt.Sprintf("The compose file of the %s profile could not be read: %v", options.Profile, err),
+			Remediation: "Check the name of the profile with `op config view`",
+			Status:      CheckFailed,
+		})
+		return results
+	}
+
+	toolPorts := map[int]string{}
+	if dockerReachable {
+		toolPorts = listToolPorts()
+	}
+	for _, port := range composePorts(compose) {
+		results = append(results, checkPort(port, toolPorts))
+	}
+
+	dockerConfig, err := readDockerConfig()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Debug("Could not read the config of the Docker CLI, the registries have no credentials")
+	}
+	for _, registry := range composeRegistries(compose) {
+		results = append(results, checkRegistryCredentials(registry, dockerConfig))
+	}
+
+	return results
+}
+
+// checkDockerDaemon checks that the daemon of the container runtime is reachable, and that Docker
+// is not older than the supported version
+func checkDockerDaemon(runtimeName string, version string, err error) CheckResult {
+	result := CheckResult{Check: runtimeName}
+
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("The %s daemon is not reachable: %v", runtimeName, err)
+		result.Remediation = "Start the Docker daemon, i.e. `sudo systemctl start docker` or Docker Desktop, and check that your user can access its socket, i.e. adding it to the docker group"
+		if runtimeName == "podman" {
+			result.Remediation = "Start the socket of the Podman API, i.e. `systemctl --user start podman.socket`, or set the DOCKER_HOST environment variable to its path"
+		}
+		return result
+	}
+
+	if runtimeName == "docker" && compareVersions(version, minDockerVersion) < 0 {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("Docker %s is older than the supported version: %s", version, minDockerVersion)
+		result.Remediation = fmt.Sprintf("Upgrade Docker to %s or later", minDockerVersion)
+		return result
+	}
+
+	result.Status = CheckPassed
+	result.Message = fmt.Sprintf("The %s daemon is reachable, in version %s", runtimeName, version)
+
+	return result
+}
+
+// checkCompose checks that the compose executable of the container runtime is available, and that
+// docker-compose is not older than the supported version. It's not needed by the Docker API and the
+// Kubernetes service managers
+func checkCompose(containerRuntime config.ContainerRuntime) CheckResult {
+	result := CheckResult{Check: "compose"}
+
+	serviceManager := shell.GetEnv(ServiceManagerEnvVar, "docker-compose")
+	if serviceManager != "docker-compose" {
+		return skippedCheck(result.Check, fmt.Sprintf("The %s service manager does not run docker-compose", serviceManager))
+	}
+
+	executable := strings.Join(append([]string{containerRuntime.ComposeExecutable}, containerRuntime.ComposeArgs...), " ")
+
+	args := append(append([]string{}, containerRuntime.ComposeArgs...), "version", "--short")
+	output, err := exec.Command(containerRuntime.ComposeExecutable, args...).Output()
+	if err != nil {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("%s is not available: %v", executable, err)
+		result.Remediation = "Install docker-compose (https://docs.docker.com/compose/install/), or set the OP_SERVICE_MANAGER environment variable to docker-api to run the compose files without it"
+		return result
+	}
+
+	version := strings.TrimPrefix(strings.TrimSpace(string(output)), "v")
+	if containerRuntime.ComposeExecutable == "docker-compose" && compareVersions(version, minComposeVersion) < 0 {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("docker-compose %s is older than the supported version: %s", version, minComposeVersion)
+		result.Remediation = fmt.Sprintf("Upgrade docker-compose to %s or later", minComposeVersion)
+		return result
+	}
+
+	result.Status = CheckPassed
+	result.Message = fmt.Sprintf("%s is available, in version %s", executable, version)
+
+	return result
+}
+
+// checkMemory checks that the memory available to the Docker daemon, which is the one of its VM in
+// Docker Desktop, fits the limits of the services
+func checkMemory(memory int64, minMemory int64) CheckResult {
+	result := CheckResult{Check: "memory"}
+
+	if memory < minMemory {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("The Docker daemon has %s of memory, less than the %s the stack needs", units.BytesSize(float64(memory)), units.BytesSize(float64(minMemory)))
+		result.Remediation = "Increase the memory of Docker Desktop in Preferences > Resources, or lower the limits of the services, i.e. OP_ELASTICSEARCH_MEM_LIMIT=1g"
+		return result
+	}
+
+	result.Status = CheckPassed
+	result.Message = fmt.Sprintf("The Docker daemon has %s of memory", units.BytesSize(float64(memory)))
+
+	return result
+}
+
+// checkDiskSpace checks that the disk of a path has enough free space for the images and the data of
+// the services
+func checkDiskSpace(path string, minDiskSpace int64) CheckResult {
+	result := CheckResult{Check: "disk"}
+
+	free, err := freeDiskSpace(path)
+	if err != nil {
+		return skippedCheck(result.Check, fmt.Sprintf("The free space of the disk of %s could not be read: %v", path, err))
+	}
+
+	if free < minDiskSpace {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("The disk of %s has %s free, less than %s", path, units.BytesSize(float64(free)), units.BytesSize(float64(minDiskSpace)))
+		result.Remediation = "Remove the resources left behind by previous runs with `op cleanup`, and the unused images with `docker system prune`"
+		return result
+	}
+
+	result.Status = CheckPassed
+	result.Message = fmt.Sprintf("The disk of %s has %s free", path, units.BytesSize(float64(free)))
+
+	return result
+}
+
+// checkMaxMapCount checks that the kernel allows the memory maps Elasticsearch needs, which is only
+// read in Linux, as Docker Desktop sets it in its VM
+func checkMaxMapCount(goos string) CheckResult {
+	result := CheckResult{Check: "vm.max_map_count"}
+
+	if goos != "linux" {
+		return skippedCheck(result.Check, "It's set by Docker Desktop in its VM")
+	}
+
+	content, err := ioutil.ReadFile(maxMapCountPath)
+	if err != nil {
+		return skippedCheck(result.Check, fmt.Sprintf("It could not be read: %v", err))
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return skippedCheck(result.Check, fmt.Sprintf("It's not a number: %s", strings.TrimSpace(string(content))))
+	}
+
+	if value < minMaxMapCount {
+		result.Status = CheckFailed
+		result.Message = fmt.Sprintf("It's %d, less than the %d Elasticsearch needs", value, minMaxMapCount)
+		result.Remediation = fmt.Sprintf("Run `sudo sysctl -w vm.max_map_count=%d`, and add it to /etc/sysctl.conf to keep it after a reboot", minMaxMapCount)
+		return result
+	}
+
+	result.Status = CheckPassed
+	result.Message = fmt.Sprintf("It's %d", value)
+
+	return result
+}
+
+// composePort a port published in the host by a service of a compose file
+type composePort struct {
+	port     int
+	service  string
+	variable string // the variable setting the port, i.e. kibanaPort, if any
+}
+
+// checkPort checks that a port published by a profile is free in the host, or published by a
+// container of the tool, i.e. of the running profile
+func checkPort(port composePort, toolPorts map[int]string) CheckResult {
+	result := CheckResult{Check: fmt.Sprintf("port %d", port.port)}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port.port))
+	if err == nil {
+		_ = listener.Close()
+
+		result.Status = CheckPassed
+		result.Message = fmt.Sprintf("The port of the %s service is free", port.service)
+		return result
+	}
+
+	if container, exists := toolPorts[port.port]; exists {
+		result.Status = CheckPassed
+		result.Message = fmt.Sprintf("The port of the %s service is published by the %s container of the tool", port.service, container)
+		return result
+	}
+
+	result.Status = CheckFailed
+	result.Message = fmt.Sprintf("The port of the %s service is in use", port.service)
+	result.Remediation = fmt.Sprintf("Stop the process listening on it, which is listed by `lsof -i :%d`", port.port)
+	if port.variable != "" {
+		result.Remediation += fmt.Sprintf(", or publish the service in another port with the %s variable of the profile", port.variable)
+	}
+
+	return result
+}
+
+// checkRegistryCredentials checks that the Docker CLI has credentials for a registry, warning that
+// the images are pulled anonymously otherwise, which fails for private images, and is rate limited
+// by Docker Hub
+func checkRegistryCredentials(registry string, dockerConfig dockerConfigFile) CheckResult {
+	result := CheckResult{Check: "registry " + registry}
+
+	key := registry
+	if registry == "docker.io" {
+		key = dockerHubRegistry
+	}
+
+	_, hasAuth := dockerConfig.Auths[key]
+	_, hasHelper := dockerConfig.CredHelpers[key]
+	if hasAuth || hasHelper {
+		result.Status = CheckPassed
+		result.Message = "There are credentials for the registry"
+		return result
+	}
+
+	result.Status = CheckWarning
+	result.Message = "There are no credentials for the registry, so its images are pulled anonymously"
+	result.Remediation = fmt.Sprintf("Run `docker login %s` if its images are private, or to avoid the rate limits of anonymous pulls", registry)
+
+	return result
+}
+
+// composePorts returns the ports published in the host by the services of a compose file, sorted,
+// with their default values
+func composePorts(compose preflightComposeFile) []composePort {
+	ports := []composePort{}
+
+	for name, service := range compose.Services {
+		for _, spec := range service.Ports {
+			port, variable, ok := parsePublishedPort(spec)
+			if !ok {
+				continue
+			}
+
+			ports = append(ports, composePort{port: port, service: name, variable: variable})
+		}
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].port < ports[j].port
+	})
+
+	return ports
+}
+
+// parsePublishedPort returns the port published in the host by the port spec of a compose file,
+// i.e. "${kibanaPort:-5601}:5601" or "127.0.0.1:8220:8220/tcp", with the variable setting it, if
+// any. It's false if the port is not published in a fixed port of the host, i.e. "5601"
+func parsePublishedPort(spec string) (int, string, bool) {
+	variable := ""
+	if matches := envVariableRegex.FindStringSubmatch(spec); matches != nil {
+		variable = matches[1]
+	}
+
+	parts := strings.Split(expandEnv(spec, map[string]string{}), ":")
+	if len(parts) < 2 {
+		return 0, "", false
+	}
+
+	port, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return 0, "", false
+	}
+
+	return port, variable, true
+}
+
+// composeRegistries returns the registries of the images of a compose file, sorted and without
+// duplicates, which is docker.io for the images without a registry
+func composeRegistries(compose preflightComposeFile) []string {
+	unique := map[string]bool{}
+	for _, service := range compose.Services {
+		if service.Image == "" {
+			continue
+		}
+
+		unique[imageRegistry(expandEnv(service.Image, map[string]string{}))] = true
+	}
+
+	registries := []string{}
+	for registry := range unique {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	return registries
+}
+
+// imageRegistry returns the registry of an image, which is docker.io if the first component of its
+// name is not a host, i.e. elastic/elasticsearch
+func imageRegistry(image string) string {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 {
+		return "docker.io"
+	}
+
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return parts[0]
+	}
+
+	return "docker.io"
+}
+
+// compareVersions compares two versions by their numeric components, ignoring their suffixes, i.e.
+// 20.10.7+dfsg1, returning -1, 0 or 1
+func compareVersions(a string, b string) int {
+	partsA := versionNumbers(a)
+	partsB := versionNumbers(b)
+
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		numberA, numberB := 0, 0
+		if i < len(partsA) {
+			numberA = partsA[i]
+		}
+		if i < len(partsB) {
+			numberB = partsB[i]
+		}
+
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// versionNumbers returns the numeric components of a version, until the first one which is not a
+// number
+func versionNumbers(version string) []int {
+	numbers := []int{}
+	for _, part := range strings.Split(version, ".") {
+		digits := part
+		if i := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+			digits = part[:i]
+		}
+
+		number, err := strconv.Atoi(digits)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, number)
+
+		if len(digits) < len(part) {
+			break
+		}
+	}
+
+	return numbers
+}
+
+// diskSpacePath returns the path whose disk is checked: the root dir of the Docker daemon when it's
+// in the host, or else the workspace of the tool
+func diskSpacePath(dockerRootDir string) string {
+	if dockerRootDir != "" {
+		if _, err := os.Stat(dockerRootDir); err == nil {
+			return dockerRootDir
+		}
+	}
+
+	return config.Op.Workspace
+}
+
+// listToolPorts returns the containers of the tool, by the ports they publish in the host
+func listToolPorts() map[int]string {
+	ports := map[int]string{}
+
+	containers, err := docker.ListLabelledContainers(config.RunIDLabel)
+	if err != nil {
+		return ports
+	}
+
+	for _, container := range containers {
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+
+		for _, port := range container.Ports {
+			if port.PublicPort != 0 {
+				ports[int(port.PublicPort)] = name
+			}
+		}
+	}
+
+	return ports
+}
+
+// readPreflightComposeFile reads the compose file of a profile
+func readPreflightComposeFile(profile string) (preflightComposeFile, error) {
+	compose := preflightComposeFile{}
+
+	composeFilePath, err := config.GetComposeFile(true, profile)
+	if err != nil {
+		return compose, err
+	}
+
+	bytes, err := ioutil.ReadFile(composeFilePath)
+	if err != nil {
+		return compose, err
+	}
+
+	err = yaml.Unmarshal(bytes, &compose)
+
+	return compose, err
+}
+
+// readDockerConfig reads the config file of the Docker CLI, in the dir of the DOCKER_CONFIG
+// environment variable, or in $HOME/.docker
+func readDockerConfig() (dockerConfigFile, error) {
+	dockerConfig := dockerConfigFile{}
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return dockerConfig, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return dockerConfig, err
+	}
+
+	err = json.Unmarshal(bytes, &dockerConfig)
+
+	return dockerConfig, err
+}
+
+// skippedCheck returns the result of a check which could not run, with the reason
+func skippedCheck(check string, reason string) CheckResult {
+	return CheckResult{
+		Check:   check,
+		Message: reason,
+		Status:  CheckSkipped,
+	}
+}
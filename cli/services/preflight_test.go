@@ -0,0 +1,130 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"errors"
+	"net"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDockerDaemon(t *testing.T) {
+	assert.Equal(t, CheckPassed, checkDockerDaemon("docker", "20.10.7", nil).Status)
+	assert.Equal(t, CheckPassed, checkDockerDaemon("podman", "3.2.1", nil).Status)
+
+	result := checkDockerDaemon("docker", "18.09.1", nil)
+	assert.Equal(t, CheckFailed, result.Status)
+	assert.Contains(t, result.Remediation, minDockerVersion)
+
+	result = checkDockerDaemon("docker", "", errors.New("connection refused"))
+	assert.Equal(t, CheckFailed, result.Status)
+	assert.Contains(t, result.Message, "connection refused")
+	assert.NotEmpty(t, result.Remediation)
+}
+
+func TestCheckMemory(t *testing.T) {
+	assert.Equal(t, CheckPassed, checkMemory(8<<30, 4<<30).Status)
+
+	result := checkMemory(2<<30, 4<<30)
+	assert.Equal(t, CheckFailed, result.Status)
+	assert.Equal(t, "The Docker daemon has 2GiB of memory, less than the 4GiB the stack needs", result.Message)
+}
+
+func TestCheckMaxMapCount(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	defaultPath := maxMapCountPath
+	defer func() { maxMapCountPath = defaultPath }()
+
+	dir := filet.TmpDir(t, "")
+	maxMapCountPath = path.Join(dir, "max_map_count")
+
+	assert.Equal(t, CheckSkipped, checkMaxMapCount("linux").Status)
+	assert.Equal(t, CheckSkipped, checkMaxMapCount("darwin").Status)
+
+	filet.File(t, maxMapCountPath, "65530\n")
+	result := checkMaxMapCount("linux")
+	assert.Equal(t, CheckFailed, result.Status)
+	assert.Contains(t, result.Remediation, "vm.max_map_count=262144")
+
+	filet.File(t, maxMapCountPath, "262144\n")
+	assert.Equal(t, CheckPassed, checkMaxMapCount("linux").Status)
+}
+
+func TestCheckPort(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	busy := listener.Addr().(*net.TCPAddr).Port
+
+	result := checkPort(composePort{port: busy, service: "kibana", variable: "kibanaPort"}, map[int]string{})
+	assert.Equal(t, CheckFailed, result.Status)
+	assert.Contains(t, result.Remediation, "kibanaPort")
+
+	result = checkPort(composePort{port: busy, service: "kibana"}, map[int]string{busy: "fleet_kibana_1"})
+	assert.Equal(t, CheckPassed, result.Status)
+	assert.Contains(t, result.Message, "fleet_kibana_1")
+
+	listener.Close()
+	assert.Equal(t, CheckPassed, checkPort(composePort{port: busy, service: "kibana"}, map[int]string{}).Status)
+}
+
+func TestCheckRegistryCredentials(t *testing.T) {
+	dockerConfig := dockerConfigFile{
+		Auths:       map[string]interface{}{dockerHubRegistry: map[string]interface{}{}},
+		CredHelpers: map[string]string{"gcr.io": "gcloud"},
+	}
+
+	assert.Equal(t, CheckPassed, checkRegistryCredentials("docker.io", dockerConfig).Status)
+	assert.Equal(t, CheckPassed, checkRegistryCredentials("gcr.io", dockerConfig).Status)
+
+	result := checkRegistryCredentials("docker.elastic.co", dockerConfig)
+	assert.Equal(t, CheckWarning, result.Status)
+	assert.Equal(t, "Run `docker login docker.elastic.co` if its images are private, or to avoid the rate limits of anonymous pulls", result.Remediation)
+}
+
+func TestParsePublishedPort(t *testing.T) {
+	port, variable, ok := parsePublishedPort("${kibanaPort:-5601}:5601")
+	assert.True(t, ok)
+	assert.Equal(t, 5601, port)
+	assert.Equal(t, "kibanaPort", variable)
+
+	port, variable, ok = parsePublishedPort("127.0.0.1:8220:8220/tcp")
+	assert.True(t, ok)
+	assert.Equal(t, 8220, port)
+	assert.Equal(t, "", variable)
+
+	_, _, ok = parsePublishedPort("5601")
+	assert.False(t, ok)
+}
+
+func TestComposeRegistries(t *testing.T) {
+	compose := preflightComposeFile{}
+	compose.Services = map[string]struct {
+		Image string   `yaml:"image"`
+		Ports []string `yaml:"ports"`
+	}{
+		"elasticsearch":    {Image: "docker.elastic.co/observability-ci/elasticsearch:${stackVersion:-8.0.0-SNAPSHOT}"},
+		"kibana":           {Image: "docker.elastic.co/observability-ci/kibana:${stackVersion:-8.0.0-SNAPSHOT}"},
+		"mysql":            {Image: "mysql:5.7"},
+		"package-registry": {Image: "localhost:5000/package-registry:latest"},
+		"redis":            {Image: "library/redis"},
+	}
+
+	assert.Equal(t, []string{"docker.elastic.co", "docker.io", "localhost:5000"}, composeRegistries(compose))
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("19.03.0", "19.03"))
+	assert.Equal(t, 1, compareVersions("20.10.7+dfsg1", "19.03.0"))
+	assert.Equal(t, -1, compareVersions("1.24.1", "1.25.0"))
+	assert.Equal(t, 1, compareVersions("2.0.0-rc.3", "1.25.0"))
+	assert.Equal(t, -1, compareVersions("18.09.1-ce", "19.03.0"))
+}
@@ -0,0 +1,18 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+//go:build windows
+// +build windows
+
+package services
+
+import (
+	"errors"
+)
+
+// freeDiskSpace returns the bytes available to the user in the disk of a path, which is not read
+// in Windows, as the daemon runs in the VM of Docker Desktop
+func freeDiskSpace(path string) (int64, error) {
+	return 0, errors.New("not supported in Windows")
+}
@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/go-units"
+	"github.com/elastic/e2e-testing/cli/config"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// resourcesOverride a service of a compose file overriding the limits of its resources
+type resourcesOverride struct {
+	CPUs     float64 `yaml:"cpus,omitempty"`
+	MemLimit string  `yaml:"mem_limit,omitempty"`
+}
+
+// resourcesComposeFile a compose file overriding the limits of the resources of the services
+type resourcesComposeFile struct {
+	Version  string                       `yaml:"version"`
+	Services map[string]resourcesOverride `yaml:"services"`
+}
+
+// writeServiceResourcesFile writes into a dir a compose file limiting the resources of the services
+// of the compose files, with the limits of the environment or their defaults, which is passed after
+// them to docker-compose. It returns an empty path if no service is limited, or if the compose files
+// use the first version of the format, which does not support overriding them
+func writeServiceResourcesFile(dir string, project string, composeFilePaths []string, env map[string]string) (string, error) {
+	override := resourcesComposeFile{
+		Services: map[string]resourcesOverride{},
+	}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return "", err
+		}
+
+		compose := composeFile{}
+		err = yaml.Unmarshal(bytes, &compose)
+		if err != nil {
+			return "", err
+		}
+
+		if override.Version == "" {
+			override.Version = compose.Version
+		}
+
+		for service := range compose.Services {
+			resources, limited := config.GetServiceResources(env, service)
+			if !limited {
+				continue
+			}
+
+			serviceOverride, err := newResourcesOverride(resources)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"cpus":     resources.CPUs,
+					"error":    err,
+					"memLimit": resources.MemLimit,
+					"project":  project,
+					"service":  service,
+				}).Error("The limits of the resources of the service are not valid")
+				return "", err
+			}
+
+			override.Services[service] = serviceOverride
+		}
+	}
+
+	if override.Version == "" || len(override.Services) == 0 {
+		return "", nil
+	}
+
+	bytes, err := yaml.Marshal(&override)
+	if err != nil {
+		return "", err
+	}
+
+	resourcesFilePath := filepath.Join(dir, project+"-resources.yml")
+
+	err = io.WriteFile(bytes, resourcesFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	return resourcesFilePath, nil
+}
+
+// newResourcesOverride returns the limits of the resources of a service, checking that the number of
+// CPUs is a positive number, and that the memory is a size understood by docker, i.e. 512m
+func newResourcesOverride(resources config.ServiceResources) (resourcesOverride, error) {
+	override := resourcesOverride{}
+
+	if resources.CPUs != "" {
+		cpus, err := strconv.ParseFloat(resources.CPUs, 64)
+		if err != nil || cpus <= 0 {
+			return override, fmt.Errorf("The number of CPUs is not valid: %s", resources.CPUs)
+		}
+		override.CPUs = cpus
+	}
+
+	if resources.MemLimit != "" {
+		_, err := units.RAMInBytes(resources.MemLimit)
+		if err != nil {
+			return override, fmt.Errorf("The memory limit is not valid: %s - %v", resources.MemLimit, err)
+		}
+		override.MemLimit = resources.MemLimit
+	}
+
+	return override, nil
+}
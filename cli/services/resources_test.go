@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteServiceResourcesFile(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	profile := path.Join(tmpDir, "docker-compose.yml")
+	filet.File(t, profile, profileComposeFile)
+
+	resourcesFile, err := writeServiceResourcesFile(tmpDir, "fleet", []string{profile}, map[string]string{"KIBANA_CPUS": "0", "KIBANA_MEM_LIMIT": "1536m"})
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(tmpDir, "fleet-resources.yml"), resourcesFile)
+
+	content, err := ioutil.ReadFile(resourcesFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  elasticsearch:
+    cpus: 2
+    mem_limit: 2g
+  kibana:
+    mem_limit: 1536m
+`, string(content))
+
+	project, err := loadComposeProject("fleet", []string{profile, resourcesFile}, map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, project.services["elasticsearch"].CPUs)
+	assert.Equal(t, "1536m", project.services["kibana"].MemLimit)
+}
+
+func TestWriteServiceResourcesFileWithoutLimitedServices(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  mysql:\n    image: mysql\n")
+
+	resourcesFile, err := writeServiceResourcesFile(tmpDir, "metricbeat", []string{service}, map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", resourcesFile)
+}
+
+func TestWriteServiceResourcesFileWithInvalidLimits(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  mysql:\n    image: mysql\n")
+
+	_, err := writeServiceResourcesFile(tmpDir, "metricbeat", []string{service}, map[string]string{"MYSQL_MEM_LIMIT": "a lot"})
+	assert.NotNil(t, err)
+
+	_, err = writeServiceResourcesFile(tmpDir, "metricbeat", []string{service}, map[string]string{"MYSQL_CPUS": "-1"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,292 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	io "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// serviceCertsPath the path where the certificates are mounted into the containers of the secured
+// services, laid out as the certs dir, i.e. /usr/share/certs/mysql/mysql.crt
+const serviceCertsPath = "/usr/share/certs"
+
+// securityOverride a service of a compose file overriding how it runs secured
+type securityOverride struct {
+	Command     []string          `yaml:"command,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	Healthcheck map[string]string `yaml:"healthcheck,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
+}
+
+// securityComposeFile a compose file overriding the secured services
+type securityComposeFile struct {
+	Version  string                      `yaml:"version"`
+	Services map[string]securityOverride `yaml:"services"`
+}
+
+// securityPreset returns how a service runs secured, writing the config files it needs into a dir
+type securityPreset func(service string, security config.ServiceSecurity, dir string) (securityOverride, error)
+
+// securityPresets how the services supported by the beats modules run with TLS and authentication,
+// by the name of their service. The other services only get the certificates and the config files
+var securityPresets = map[string]securityPreset{
+	"apache": apacheSecurity,
+	"kafka":  kafkaSecurity,
+	"mysql":  mysqlSecurity,
+}
+
+// writeServiceSecurityFile writes into a dir a compose file running secured the services of the
+// compose files whose security options are in the environment, which is passed after them to
+// docker-compose. The certificates of the services with TLS are generated, signed by the CA of the
+// secured stack, and mounted into their containers with the config files of the options. It
+// returns an empty path if no service runs secured
+func writeServiceSecurityFile(dir string, project string, composeFilePaths []string, env map[string]string) (string, error) {
+	override := securityComposeFile{
+		Services: map[string]securityOverride{},
+	}
+
+	for _, composeFilePath := range composeFilePaths {
+		bytes, err := io.ReadFile(composeFilePath)
+		if err != nil {
+			return "", err
+		}
+
+		compose := composeFile{}
+		err = yaml.Unmarshal(bytes, &compose)
+		if err != nil {
+			return "", err
+		}
+
+		if override.Version == "" {
+			override.Version = compose.Version
+		}
+
+		for service := range compose.Services {
+			security, secured := config.GetServiceSecurity(env, service)
+			if !secured {
+				continue
+			}
+
+			serviceOverride, err := newSecurityOverride(service, security, filepath.Join(dir, project+"-"+service+"-security"))
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":   err,
+					"project": project,
+					"service": service,
+				}).Error("Could not run the service secured")
+				return "", err
+			}
+
+			override.Services[service] = serviceOverride
+		}
+	}
+
+	if override.Version == "" || len(override.Services) == 0 {
+		return "", nil
+	}
+
+	bytes, err := yaml.Marshal(&override)
+	if err != nil {
+		return "", err
+	}
+
+	securityFilePath := filepath.Join(dir, project+"-security.yml")
+
+	err = io.WriteFile(bytes, securityFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	return securityFilePath, nil
+}
+
+// newSecurityOverride returns how a service runs secured: its config files and its certificates
+// mounted into its container, and the command and the environment of its preset, if any
+func newSecurityOverride(service string, security config.ServiceSecurity, dir string) (securityOverride, error) {
+	override := securityOverride{}
+
+	if security.TLS {
+		certsDir, err := config.GenerateServiceCerts(service)
+		if err != nil {
+			return override, err
+		}
+
+		override.Volumes = append(override.Volumes, certsDir+":"+serviceCertsPath+":ro")
+	}
+
+	configs := []string{}
+	for containerPath, localPath := range security.Configs {
+		configs = append(configs, localPath+":"+containerPath+":ro")
+	}
+	sort.Strings(configs)
+	override.Volumes = append(override.Volumes, configs...)
+
+	preset, exists := securityPresets[service]
+	if !exists {
+		return override, nil
+	}
+
+	err := io.MkdirAll(dir)
+	if err != nil {
+		return override, err
+	}
+
+	presetOverride, err := preset(service, security, dir)
+	if err != nil {
+		return override, err
+	}
+
+	override.Command = presetOverride.Command
+	override.Environment = presetOverride.Environment
+	override.Healthcheck = presetOverride.Healthcheck
+	override.Volumes = append(override.Volumes, presetOverride.Volumes...)
+
+	return override, nil
+}
+
+// apacheSecurity runs Apache with TLS on the 443 port, and the server status behind basic
+// authentication, with a config file included after the one of the image
+func apacheSecurity(service string, security config.ServiceSecurity, dir string) (securityOverride, error) {
+	override := securityOverride{}
+
+	confDir := "/usr/local/apache2/conf"
+	lines := []string{}
+
+	if security.TLS {
+		lines = append(lines,
+			"LoadModule ssl_module modules/mod_ssl.so",
+			"LoadModule socache_shmcb_module modules/mod_socache_shmcb.so",
+			"Listen 443",
+			"SSLSessionCache shmcb:/usr/local/apache2/logs/ssl_scache(512000)",
+			"<VirtualHost *:443>",
+			"  SSLEngine on",
+			"  SSLCertificateFile "+serviceCertPath(service, ".crt"),
+			"  SSLCertificateKeyFile "+serviceCertPath(service, ".key"),
+			"</VirtualHost>",
+		)
+	}
+
+	if security.Username != "" {
+		htpasswd := filepath.Join(dir, "e2e-testing.htpasswd")
+		err := io.WriteFile([]byte(security.Username+":"+sha1Password(security.Password)+"\n"), htpasswd)
+		if err != nil {
+			return override, err
+		}
+		override.Volumes = append(override.Volumes, htpasswd+":"+path.Join(confDir, "e2e-testing.htpasswd")+":ro")
+
+		lines = append(lines,
+			`<Location "/server-status">`,
+			"  AuthType Basic",
+			`  AuthName "e2e-testing"`,
+			"  AuthUserFile "+path.Join(confDir, "e2e-testing.htpasswd"),
+			"  Require valid-user",
+			"</Location>",
+		)
+
+		// the server status is not reachable without the credentials anymore
+		override.Healthcheck = map[string]string{
+			"test": fmt.Sprintf("curl -f -u %s:%s http://localhost/server-status", security.Username, security.Password),
+		}
+	}
+
+	if len(lines) == 0 {
+		return override, nil
+	}
+
+	conf := filepath.Join(dir, "e2e-testing.conf")
+	err := io.WriteFile([]byte(strings.Join(lines, "\n")+"\n"), conf)
+	if err != nil {
+		return override, err
+	}
+	override.Volumes = append(override.Volumes, conf+":"+path.Join(confDir, "e2e-testing.conf")+":ro")
+
+	// the directives of the config file are processed after the ones of the image
+	override.Command = []string{"httpd-foreground", "-c", "Include " + path.Join(confDir, "e2e-testing.conf")}
+
+	return override, nil
+}
+
+// kafkaSecurity enables the SASL/PLAIN authentication of the users of Kafka with a JAAS file. The
+// listeners are not changed, so a listener with SASL or TLS must be set in a custom server.properties
+// file mounted with the config files of the options, where the certificates are mounted too
+func kafkaSecurity(service string, security config.ServiceSecurity, dir string) (securityOverride, error) {
+	override := securityOverride{}
+
+	if security.Username == "" {
+		return override, nil
+	}
+
+	jaas := fmt.Sprintf(`KafkaServer {
+  org.apache.kafka.common.security.plain.PlainLoginModule required
+  username="%[1]s"
+  password="%[2]s"
+  user_%[1]s="%[2]s";
+};
+`, security.Username, security.Password)
+
+	jaasFile := filepath.Join(dir, "kafka_server_jaas.conf")
+	err := io.WriteFile([]byte(jaas), jaasFile)
+	if err != nil {
+		return override, err
+	}
+
+	override.Volumes = append(override.Volumes, jaasFile+":/etc/kafka/e2e-testing-jaas.conf:ro")
+	override.Environment = map[string]string{
+		"KAFKA_OPTS": "-Djava.security.auth.login.config=/etc/kafka/e2e-testing-jaas.conf",
+	}
+
+	return override, nil
+}
+
+// mysqlSecurity runs MySQL, or its MariaDB and Percona variants, with TLS, and with a user, or the
+// password of the root user
+func mysqlSecurity(service string, security config.ServiceSecurity, dir string) (securityOverride, error) {
+	override := securityOverride{}
+
+	if security.Username == "root" {
+		override.Environment = map[string]string{
+			"MYSQL_ROOT_PASSWORD": security.Password,
+		}
+	} else if security.Username != "" {
+		override.Environment = map[string]string{
+			"MYSQL_PASSWORD": security.Password,
+			"MYSQL_USER":     security.Username,
+		}
+	}
+
+	if security.TLS {
+		override.Command = []string{
+			"mysqld",
+			"--ssl-ca=" + path.Join(serviceCertsPath, "ca", "ca.crt"),
+			"--ssl-cert=" + serviceCertPath(service, ".crt"),
+			"--ssl-key=" + serviceCertPath(service, ".key"),
+		}
+	}
+
+	return override, nil
+}
+
+// serviceCertPath returns the path of the certificate or the key of a service in its container
+func serviceCertPath(service string, extension string) string {
+	return path.Join(serviceCertsPath, service, service+extension)
+}
+
+// sha1Password returns a password hashed for the htpasswd files, in their SHA1 format
+func sha1Password(password string) string {
+	hash := sha1.Sum([]byte(password))
+
+	return "{SHA}" + base64.StdEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,105 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteServiceSecurityFileWithoutSecuredServices(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  mysql:\n    image: mysql\n")
+
+	securityFile, err := writeServiceSecurityFile(tmpDir, "metricbeat", []string{service}, map[string]string{"MYSQL_VERSION": "8.0.13"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", securityFile)
+}
+
+func TestWriteServiceSecurityFileForMySQL(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	service := path.Join(tmpDir, "service.yml")
+	filet.File(t, service, "version: '2.3'\nservices:\n  mysql:\n    image: mysql\n")
+
+	env := config.PutServiceSecurityEnvironment(map[string]string{}, "mysql", config.ServiceSecurity{
+		Configs:  map[string]string{"/etc/mysql/conf.d/e2e.cnf": "/tmp/e2e.cnf"},
+		Password: "secret",
+		Username: "elastic",
+	})
+
+	securityFile, err := writeServiceSecurityFile(tmpDir, "metricbeat", []string{service}, env)
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(tmpDir, "metricbeat-security.yml"), securityFile)
+
+	content, err := ioutil.ReadFile(securityFile)
+	assert.Nil(t, err)
+	assert.Equal(t, `version: "2.3"
+services:
+  mysql:
+    environment:
+      MYSQL_PASSWORD: secret
+      MYSQL_USER: elastic
+    volumes:
+    - /tmp/e2e.cnf:/etc/mysql/conf.d/e2e.cnf:ro
+`, string(content))
+}
+
+func TestApacheSecurityWithAuthentication(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	override, err := apacheSecurity("apache", config.ServiceSecurity{Password: "secret", Username: "elastic"}, tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"httpd-foreground", "-c", "Include /usr/local/apache2/conf/e2e-testing.conf"}, override.Command)
+	assert.Equal(t, "curl -f -u elastic:secret http://localhost/server-status", override.Healthcheck["test"])
+
+	htpasswd, err := ioutil.ReadFile(path.Join(tmpDir, "e2e-testing.htpasswd"))
+	assert.Nil(t, err)
+	assert.Equal(t, "elastic:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n", string(htpasswd))
+
+	conf, err := ioutil.ReadFile(path.Join(tmpDir, "e2e-testing.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(conf), "Require valid-user")
+	assert.NotContains(t, string(conf), "SSLEngine")
+}
+
+func TestKafkaSecurityWithAuthentication(t *testing.T) {
+	defer filet.CleanUp(t)
+
+	tmpDir := filet.TmpDir(t, "")
+
+	override, err := kafkaSecurity("kafka", config.ServiceSecurity{Password: "secret", Username: "stats"}, tmpDir)
+	assert.Nil(t, err)
+	assert.Equal(t, "-Djava.security.auth.login.config=/etc/kafka/e2e-testing-jaas.conf", override.Environment["KAFKA_OPTS"])
+
+	jaas, err := ioutil.ReadFile(path.Join(tmpDir, "kafka_server_jaas.conf"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(jaas), `user_stats="secret";`)
+}
+
+func TestMySQLSecurityWithTLS(t *testing.T) {
+	override, err := mysqlSecurity("mysql", config.ServiceSecurity{Password: "test", TLS: true, Username: "root"}, "")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"MYSQL_ROOT_PASSWORD": "test"}, override.Environment)
+	assert.Equal(t, []string{
+		"mysqld",
+		"--ssl-ca=/usr/share/certs/ca/ca.crt",
+		"--ssl-cert=/usr/share/certs/mysql/mysql.crt",
+		"--ssl-key=/usr/share/certs/mysql/mysql.key",
+	}, override.Command)
+}
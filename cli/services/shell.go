@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/elastic/e2e-testing/cli/docker"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultShellCommand the command run by the interactive shells when none is passed, which falls back
+// to sh in the images without bash, i.e. the alpine based ones
+var defaultShellCommand = []string{"sh", "-c", "if command -v bash >/dev/null; then exec bash; else exec sh; fi"}
+
+// ShellOptions the options to open an interactive shell in the container of a service
+type ShellOptions struct {
+	Command []string // the command to run, a shell if empty
+	User    string   // the user running the command, the one of the image if empty
+}
+
+// OpenShell opens an interactive shell in the container of a service of a running profile, or of a
+// service run on its own, attaching the terminal to it with docker exec until the shell exits. The
+// docker-compose project is resolved from the state persisted in the workspace
+func OpenShell(profile string, serviceName string, options ShellOptions) error {
+	project, err := resolveLogsProject(listState(), profile, []string{serviceName})
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return err
+	}
+
+	containers, err = selectServiceContainers(containers, []string{serviceName})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"project": project,
+			"service": serviceName,
+		}).Error("Could not find the container of the service")
+		return err
+	}
+
+	// the first container is used if the service is scaled
+	name := containerName(containers[0])
+
+	cmd := exec.Command("docker", shellArgs(name, options)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.WithFields(log.Fields{
+		"args":      cmd.Args,
+		"container": name,
+	}).Debug("Opening a shell in the container")
+
+	err = cmd.Run()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": name,
+			"error":     err,
+		}).Error("The shell in the container failed")
+		return err
+	}
+
+	return nil
+}
+
+// shellArgs returns the arguments of docker to run a command interactively in a container, with a TTY
+func shellArgs(containerName string, options ShellOptions) []string {
+	args := []string{"exec", "-it"}
+	if options.User != "" {
+		args = append(args, "--user", options.User)
+	}
+	args = append(args, containerName)
+
+	if len(options.Command) == 0 {
+		return append(args, defaultShellCommand...)
+	}
+
+	return append(args, options.Command...)
+}
@@ -0,0 +1,21 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellArgs(t *testing.T) {
+	args := shellArgs("fleet_elastic-agent_1", ShellOptions{})
+	assert.Equal(t, append([]string{"exec", "-it", "fleet_elastic-agent_1"}, defaultShellCommand...), args)
+}
+
+func TestShellArgsWithACommandAndAUser(t *testing.T) {
+	args := shellArgs("fleet_elastic-agent_1", ShellOptions{Command: []string{"elastic-agent", "status"}, User: "root"})
+	assert.Equal(t, []string{"exec", "-it", "--user", "root", "fleet_elastic-agent_1", "elastic-agent", "status"}, args)
+}
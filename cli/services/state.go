@@ -0,0 +1,87 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"sync"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+)
+
+var stateStore state.Store
+var stateStoreMutex sync.RWMutex
+
+// SetStateStore sets the store of the state of the runs of the profiles and services, i.e. an
+// in-memory store for the programs which do not share the runs with the CLI. The state is
+// persisted in the state dir of the workspace by default
+func SetStateStore(store state.Store) {
+	stateStoreMutex.Lock()
+	defer stateStoreMutex.Unlock()
+
+	stateStore = store
+}
+
+// getStateStore returns the store of the state of the runs, which is the state dir of the
+// workspace if no store was set
+func getStateStore() state.Store {
+	stateStoreMutex.RLock()
+	defer stateStoreMutex.RUnlock()
+
+	if stateStore == nil {
+		return state.NewFileStore(config.GetStateDir())
+	}
+
+	return stateStore
+}
+
+// destroyState destroys the state of a run
+func destroyState(id string) {
+	err := getStateStore().Destroy(id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"id":    id,
+		}).Warn("Could not destroy state")
+	}
+}
+
+// listState returns the state of the runs, sorted by their ID
+func listState() []state.Run {
+	runs, err := getStateStore().List()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Could not list the state of the runs")
+	}
+
+	return runs
+}
+
+// recoverState returns the environment persisted in the state of a run, which is empty if it
+// cannot be recovered
+func recoverState(id string) map[string]string {
+	env, err := getStateStore().Recover(id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"id":    id,
+		}).Error("Could not recover state")
+	}
+
+	return env
+}
+
+// updateState persists the state of a run, from the compose files of its profile and services
+func updateState(id string, composeFilePaths []string, env map[string]string) {
+	err := getStateStore().Update(id, composeFilePaths, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"id":    id,
+		}).Error("Could not update state")
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	state "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetStateStore(t *testing.T) {
+	defer SetStateStore(nil)
+
+	SetStateStore(state.NewMemoryStore())
+
+	updateState("redis-service", []string{"compose/services/redis/docker-compose.yml"}, map[string]string{"REDIS_VERSION": "5.0.5"})
+	assert.Equal(t, map[string]string{"REDIS_VERSION": "5.0.5"}, recoverState("redis-service"))
+
+	runs := listState()
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, "redis-service", runs[0].ID)
+
+	destroyState("redis-service")
+	assert.Equal(t, 0, len(listState()))
+}
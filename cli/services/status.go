@@ -0,0 +1,222 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	state "github.com/elastic/e2e-testing/cli/internal"
+)
+
+// composeServiceLabel the label of the containers with the name of their service in the compose file
+const composeServiceLabel = "com.docker.compose.service"
+
+// RunStatus the status of a profile or a service started by the tool, and of the containers
+// of its docker-compose project
+type RunStatus struct {
+	ID       string          `json:"id"`                // ID of the state of the run, i.e. fleet-profile
+	Profile  string          `json:"profile,omitempty"` // empty for a service run on its own
+	Project  string          `json:"project"`           // name of the docker-compose project
+	RunID    string          `json:"runId,omitempty"`   // ID of the run which started the services
+	Services []ServiceStatus `json:"services"`
+}
+
+// ServiceStatus the status of the container of a service
+type ServiceStatus struct {
+	Container string   `json:"container"`
+	Health    string   `json:"health,omitempty"` // healthy, unhealthy or starting, empty without healthcheck
+	Name      string   `json:"name"`
+	Ports     []string `json:"ports"`               // the published ports, i.e. 0.0.0.0:9200->9200/tcp
+	StartedAt string   `json:"startedAt,omitempty"` // RFC3339, empty if the container is not running
+	State     string   `json:"state"`               // i.e. running or exited
+	Uptime    string   `json:"uptime,omitempty"`
+	Version   string   `json:"version"` // tag of the image of the container
+}
+
+// GetStatus returns the status of the profiles and the services persisted in the state of the
+// workspace, inspecting the containers of their docker-compose projects
+func GetStatus() ([]RunStatus, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	statuses := []RunStatus{}
+	for _, run := range listState() {
+		runStatus, err := newRunStatus(ctx, run, now)
+		if err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, runStatus)
+	}
+
+	return statuses, nil
+}
+
+// GetRunningProfile returns the status of the services of a profile kept running by a previous run,
+// and if they can be reused: all of them are running, and they were run with the same values of the
+// variables of an environment, as persisted in the state of the workspace. The runs reuse them
+// instead of recreating them, i.e. in developer mode
+func GetRunningProfile(profile string, env map[string]string) (RunStatus, bool, error) {
+	for _, run := range listState() {
+		if run.ID != profile+"-profile" {
+			continue
+		}
+
+		runStatus, err := newRunStatus(context.Background(), run, time.Now())
+		if err != nil {
+			return RunStatus{}, false, err
+		}
+
+		return runStatus, includesEnvironment(run.Env, env) && runStatus.isRunning(), nil
+	}
+
+	return RunStatus{}, false, nil
+}
+
+// isRunning checks if the containers of the services of a run are running, and not unhealthy
+func (s RunStatus) isRunning() bool {
+	if len(s.Services) == 0 {
+		return false
+	}
+
+	for _, service := range s.Services {
+		if service.State != "running" || service.Health == "unhealthy" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// includesEnvironment checks if the environment persisted in the state of a run has the same values
+// of the variables of an environment
+func includesEnvironment(persisted map[string]string, env map[string]string) bool {
+	for name, value := range env {
+		if persistedValue, exists := persisted[name]; !exists || persistedValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRunStatus returns the status of a run, inspecting the containers of its docker-compose project
+func newRunStatus(ctx context.Context, run state.Run, now time.Time) (RunStatus, error) {
+	composeName := strings.TrimSuffix(strings.TrimSuffix(run.ID, "-profile"), "-service")
+	project := config.GetComposeProjectName(composeName)
+
+	containers, err := docker.ListComposeContainers(project)
+	if err != nil {
+		return RunStatus{}, err
+	}
+
+	runStatus := RunStatus{
+		ID:       run.ID,
+		Profile:  run.Profile,
+		Project:  project,
+		RunID:    run.Env[config.RunIDKey],
+		Services: []ServiceStatus{},
+	}
+
+	for _, container := range containers {
+		containerState, err := docker.GetContainerState(ctx, container.ID)
+		if err != nil {
+			return RunStatus{}, err
+		}
+
+		runStatus.Services = append(runStatus.Services, newServiceStatus(container, containerState, now))
+	}
+
+	sort.Slice(runStatus.Services, func(i, j int) bool {
+		return runStatus.Services[i].Name < runStatus.Services[j].Name
+	})
+
+	return runStatus, nil
+}
+
+// newServiceStatus returns the status of the container of a service, with its uptime at a time
+func newServiceStatus(container types.Container, containerState *types.ContainerState, now time.Time) ServiceStatus {
+	name := ""
+	if len(container.Names) > 0 {
+		name = strings.TrimPrefix(container.Names[0], "/")
+	}
+
+	status := ServiceStatus{
+		Container: name,
+		Name:      container.Labels[composeServiceLabel],
+		Ports:     publishedPorts(container.Ports),
+		State:     container.State,
+		Version:   imageVersion(container.Image),
+	}
+
+	if containerState == nil {
+		return status
+	}
+
+	status.State = containerState.Status
+	if containerState.Health != nil {
+		status.Health = containerState.Health.Status
+	}
+
+	if containerState.Running {
+		startedAt, err := time.Parse(time.RFC3339Nano, containerState.StartedAt)
+		if err == nil {
+			status.StartedAt = startedAt.UTC().Format(time.RFC3339)
+			status.Uptime = now.Sub(startedAt).Round(time.Second).String()
+		}
+	}
+
+	return status
+}
+
+// imageVersion returns the tag of an image, i.e. 8.0.0-SNAPSHOT, which is latest if the image has
+// no tag, and empty if the image is referenced by its digest
+func imageVersion(image string) string {
+	if strings.Contains(image, "@") || strings.HasPrefix(image, "sha256:") {
+		return ""
+	}
+
+	// the registry could have a port, i.e. localhost:5000/kibana
+	name := image[strings.LastIndex(image, "/")+1:]
+
+	index := strings.LastIndex(name, ":")
+	if index < 0 {
+		return "latest"
+	}
+
+	return name[index+1:]
+}
+
+// publishedPorts returns the ports of a container published at the host, sorted, in the format
+// of the ps command of docker, i.e. 0.0.0.0:9200->9200/tcp
+func publishedPorts(ports []types.Port) []string {
+	published := []string{}
+	seen := map[string]bool{}
+	for _, port := range ports {
+		if port.PublicPort == 0 {
+			continue
+		}
+
+		// the API could list a published port more than once
+		publishedPort := fmt.Sprintf("%s:%d->%d/%s", port.IP, port.PublicPort, port.PrivatePort, port.Type)
+		if seen[publishedPort] {
+			continue
+		}
+		seen[publishedPort] = true
+
+		published = append(published, publishedPort)
+	}
+
+	sort.Strings(published)
+
+	return published
+}
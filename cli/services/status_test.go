@@ -0,0 +1,106 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageVersion(t *testing.T) {
+	assert.Equal(t, "8.0.0-SNAPSHOT", imageVersion("docker.elastic.co/observability-ci/kibana:8.0.0-SNAPSHOT"))
+	assert.Equal(t, "2.4", imageVersion("localhost:5000/httpd:2.4"))
+	assert.Equal(t, "latest", imageVersion("localhost:5000/httpd"))
+	assert.Equal(t, "latest", imageVersion("centos"))
+	assert.Equal(t, "", imageVersion("sha256:4b3e1a5c"))
+	assert.Equal(t, "", imageVersion("centos@sha256:4b3e1a5c"))
+}
+
+func TestPublishedPorts(t *testing.T) {
+	ports := []types.Port{
+		{IP: "0.0.0.0", PrivatePort: 9300, PublicPort: 9300, Type: "tcp"},
+		{PrivatePort: 9600, Type: "tcp"},
+		{IP: "0.0.0.0", PrivatePort: 9200, PublicPort: 11200, Type: "tcp"},
+		{IP: "0.0.0.0", PrivatePort: 9200, PublicPort: 11200, Type: "tcp"},
+	}
+
+	assert.Equal(t, []string{"0.0.0.0:11200->9200/tcp", "0.0.0.0:9300->9300/tcp"}, publishedPorts(ports))
+	assert.Equal(t, []string{}, publishedPorts(nil))
+}
+
+func TestNewServiceStatusOfRunningContainer(t *testing.T) {
+	container := types.Container{
+		Image:  "docker.elastic.co/observability-ci/elasticsearch:8.0.0-SNAPSHOT",
+		Labels: map[string]string{composeServiceLabel: "elasticsearch"},
+		Names:  []string{"/fleet_elasticsearch_1"},
+		Ports:  []types.Port{{IP: "0.0.0.0", PrivatePort: 9200, PublicPort: 9200, Type: "tcp"}},
+		State:  "running",
+	}
+	containerState := &types.ContainerState{
+		Health:    &types.Health{Status: "healthy"},
+		Running:   true,
+		StartedAt: "2020-12-01T10:15:30.123456789Z",
+		Status:    "running",
+	}
+	now := time.Date(2020, 12, 1, 11, 20, 30, 0, time.UTC)
+
+	status := newServiceStatus(container, containerState, now)
+	assert.Equal(t, "fleet_elasticsearch_1", status.Container)
+	assert.Equal(t, "healthy", status.Health)
+	assert.Equal(t, "elasticsearch", status.Name)
+	assert.Equal(t, []string{"0.0.0.0:9200->9200/tcp"}, status.Ports)
+	assert.Equal(t, "2020-12-01T10:15:30Z", status.StartedAt)
+	assert.Equal(t, "running", status.State)
+	assert.Equal(t, "1h5m0s", status.Uptime)
+	assert.Equal(t, "8.0.0-SNAPSHOT", status.Version)
+}
+
+func TestNewServiceStatusOfExitedContainer(t *testing.T) {
+	container := types.Container{
+		Image:  "centos:7",
+		Labels: map[string]string{composeServiceLabel: "centos"},
+		Names:  []string{"/fleet_centos_1"},
+		State:  "exited",
+	}
+	containerState := &types.ContainerState{
+		StartedAt: "2020-12-01T10:15:30Z",
+		Status:    "exited",
+	}
+
+	status := newServiceStatus(container, containerState, time.Now())
+	assert.Equal(t, "", status.Health)
+	assert.Equal(t, "", status.StartedAt)
+	assert.Equal(t, "exited", status.State)
+	assert.Equal(t, "", status.Uptime)
+	assert.Equal(t, "7", status.Version)
+}
+
+func TestIncludesEnvironment(t *testing.T) {
+	persisted := map[string]string{"runId": "20201201T101530-3fa2b1", "stackVersion": "7.13.0"}
+
+	assert.True(t, includesEnvironment(persisted, map[string]string{"stackVersion": "7.13.0"}))
+	assert.True(t, includesEnvironment(persisted, map[string]string{}))
+	assert.False(t, includesEnvironment(persisted, map[string]string{"stackVersion": "7.14.0"}))
+	assert.False(t, includesEnvironment(persisted, map[string]string{"kibanaConfigPath": "/tmp/kibana.yml"}))
+}
+
+func TestRunStatusIsRunning(t *testing.T) {
+	running := RunStatus{Services: []ServiceStatus{
+		{Health: "healthy", Name: "elasticsearch", State: "running"},
+		{Name: "package-registry", State: "running"},
+	}}
+	assert.True(t, running.isRunning())
+
+	unhealthy := RunStatus{Services: []ServiceStatus{{Health: "unhealthy", Name: "elasticsearch", State: "running"}}}
+	assert.False(t, unhealthy.isRunning())
+
+	exited := RunStatus{Services: []ServiceStatus{{Name: "elasticsearch", State: "exited"}}}
+	assert.False(t, exited.isRunning())
+
+	assert.False(t, RunStatus{}.isRunning())
+}
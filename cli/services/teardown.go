@@ -0,0 +1,199 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	log "github.com/sirupsen/logrus"
+)
+
+// TeardownOptions the options selecting the services whose containers are stopped or destroyed
+type TeardownOptions struct {
+	All     bool   // all the services of the profile, or of all the runs of the state without a profile
+	Profile string // the running profile of the services, empty for a service run on its own
+}
+
+// teardownTarget the containers of a run selected to be stopped or destroyed
+type teardownTarget struct {
+	id       string   // the ID of the state of the run, i.e. fleet-profile
+	project  string   // the docker-compose project of the run
+	services []string // the services of the run, empty for all of them
+}
+
+// DestroyServices removes the containers of services of a running profile, or of a service run on
+// its own, with their anonymous volumes and the named volumes of the docker-compose project they
+// mount, resolving the project from the state of the workspace. The network and the state of a run
+// are destroyed too once all its containers are removed
+func DestroyServices(serviceNames []string, options TeardownOptions) error {
+	targets, err := resolveTeardownTargets(listState(), serviceNames, options)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		containers, err := listTeardownContainers(target, options)
+		if err != nil {
+			return err
+		}
+
+		volumes := []string{}
+		for _, container := range containers {
+			err := docker.RemoveContainer(containerName(container))
+			if err != nil {
+				return err
+			}
+
+			volumes = append(volumes, namedVolumes(container, target.project)...)
+		}
+
+		for _, volume := range volumes {
+			// the volume could be mounted by the containers of other services of the project
+			_ = docker.RemoveVolume(volume)
+		}
+
+		remaining, err := docker.ListComposeContainers(target.project)
+		if err != nil {
+			return err
+		}
+
+		if len(remaining) == 0 {
+			_ = docker.RemoveNetwork(target.project + "_default")
+			destroyState(target.id)
+		}
+
+		log.WithFields(log.Fields{
+			"containers": len(containers),
+			"project":    target.project,
+			"services":   target.services,
+			"volumes":    volumes,
+		}).Info("The services were destroyed")
+	}
+
+	return nil
+}
+
+// StopServices stops the containers of services of a running profile, or of a service run on its
+// own, without removing them, so that they keep their data when they are started again. The
+// docker-compose project is resolved from the state of the workspace
+func StopServices(serviceNames []string, options TeardownOptions) error {
+	targets, err := resolveTeardownTargets(listState(), serviceNames, options)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	for _, target := range targets {
+		containers, err := listTeardownContainers(target, options)
+		if err != nil {
+			return err
+		}
+
+		stopped := 0
+		for _, container := range containers {
+			if container.State != "running" {
+				continue
+			}
+
+			err := docker.StopContainer(ctx, containerName(container))
+			if err != nil {
+				return err
+			}
+			stopped++
+		}
+
+		log.WithFields(log.Fields{
+			"containers": stopped,
+			"project":    target.project,
+			"services":   target.services,
+		}).Info("The services were stopped")
+	}
+
+	return nil
+}
+
+// listTeardownContainers returns the containers of the services of a run selected to be stopped or
+// destroyed. The runs without containers are skipped when all of them are selected
+func listTeardownContainers(target teardownTarget, options TeardownOptions) ([]types.Container, error) {
+	containers, err := docker.ListComposeContainers(target.project)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(containers) == 0 && options.All {
+		return containers, nil
+	}
+
+	containers, err = selectServiceContainers(containers, target.services)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"project":  target.project,
+			"services": target.services,
+		}).Error("Could not find the containers of the services")
+		return nil, err
+	}
+
+	return containers, nil
+}
+
+// namedVolumes returns the named volumes of a docker-compose project mounted by a container, which
+// are prefixed by the name of the project, i.e. fleet_data. The anonymous volumes are not included
+func namedVolumes(container types.Container, project string) []string {
+	volumes := []string{}
+	for _, m := range container.Mounts {
+		if m.Type == mount.TypeVolume && strings.HasPrefix(m.Name, project+"_") {
+			volumes = append(volumes, m.Name)
+		}
+	}
+
+	return volumes
+}
+
+// resolveTeardownTargets returns the runs whose containers are stopped or destroyed, from the state
+// of the runs: the run of the profile, or of the service run on its own, or all the runs when all
+// the services are selected without a profile
+func resolveTeardownTargets(runs []state.Run, serviceNames []string, options TeardownOptions) ([]teardownTarget, error) {
+	if options.All && len(serviceNames) > 0 {
+		return nil, fmt.Errorf("the services cannot be passed when all of them are selected")
+	} else if !options.All && len(serviceNames) == 0 {
+		return nil, fmt.Errorf("pass the services, or select all of them, i.e. --all")
+	}
+
+	if options.All && options.Profile == "" {
+		targets := []teardownTarget{}
+		for _, run := range runs {
+			composeName := strings.TrimSuffix(strings.TrimSuffix(run.ID, "-profile"), "-service")
+
+			targets = append(targets, teardownTarget{id: run.ID, project: config.GetComposeProjectName(composeName)})
+		}
+
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("there are no running profiles or services")
+		}
+
+		return targets, nil
+	}
+
+	project, err := resolveLogsProject(runs, options.Profile, serviceNames)
+	if err != nil {
+		return nil, err
+	}
+
+	id := options.Profile + "-profile"
+	if options.Profile == "" {
+		id = serviceNames[0] + "-service"
+	}
+
+	return []teardownTarget{{id: id, project: project, services: serviceNames}}, nil
+}
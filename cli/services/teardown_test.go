@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+	state "github.com/elastic/e2e-testing/cli/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedVolumes(t *testing.T) {
+	container := types.Container{
+		Mounts: []types.MountPoint{
+			{Name: "fleet_data", Type: mount.TypeVolume},
+			{Name: "4b3e1a5c9d2f", Type: mount.TypeVolume},
+			{Source: "/tmp/certs", Type: mount.TypeBind},
+			{Name: "metricbeat_data", Type: mount.TypeVolume},
+		},
+	}
+
+	assert.Equal(t, []string{"fleet_data"}, namedVolumes(container, "fleet"))
+	assert.Equal(t, []string{}, namedVolumes(types.Container{}, "fleet"))
+}
+
+func TestResolveTeardownTargets(t *testing.T) {
+	runs := []state.Run{{ID: "apache-service"}, {ID: "fleet-profile", Profile: "fleet"}}
+
+	targets, err := resolveTeardownTargets(runs, []string{"kibana", "elasticsearch"}, TeardownOptions{Profile: "fleet"})
+	assert.Nil(t, err)
+	assert.Equal(t, []teardownTarget{{id: "fleet-profile", project: "fleet", services: []string{"kibana", "elasticsearch"}}}, targets)
+
+	targets, err = resolveTeardownTargets(runs, []string{"apache"}, TeardownOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []teardownTarget{{id: "apache-service", project: "apache", services: []string{"apache"}}}, targets)
+
+	targets, err = resolveTeardownTargets(runs, nil, TeardownOptions{All: true, Profile: "fleet"})
+	assert.Nil(t, err)
+	assert.Equal(t, []teardownTarget{{id: "fleet-profile", project: "fleet"}}, targets)
+
+	targets, err = resolveTeardownTargets(runs, nil, TeardownOptions{All: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []teardownTarget{{id: "apache-service", project: "apache"}, {id: "fleet-profile", project: "fleet"}}, targets)
+}
+
+func TestResolveTeardownTargetsWithInvalidSelections(t *testing.T) {
+	runs := []state.Run{{ID: "fleet-profile", Profile: "fleet"}}
+
+	_, err := resolveTeardownTargets(runs, nil, TeardownOptions{Profile: "fleet"})
+	assert.NotNil(t, err)
+
+	_, err = resolveTeardownTargets(runs, []string{"kibana"}, TeardownOptions{All: true, Profile: "fleet"})
+	assert.NotNil(t, err)
+
+	_, err = resolveTeardownTargets(runs, []string{"kibana"}, TeardownOptions{Profile: "metricbeat"})
+	assert.NotNil(t, err)
+
+	_, err = resolveTeardownTargets([]state.Run{}, nil, TeardownOptions{All: true})
+	assert.NotNil(t, err)
+}
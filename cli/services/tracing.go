@@ -0,0 +1,189 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+)
+
+// SpanStarter starts a span of an operation of the service managers in the trace of the caller, i.e.
+// the transaction of the running scenario of a test suite, returning the function ending it with the
+// error of the operation
+type SpanStarter func(name string, labels map[string]string) func(err error)
+
+var spanStarter SpanStarter
+var spanStarterMutex sync.RWMutex
+
+// SetSpanStarter sets the starter of the spans of the operations of the service managers returned
+// by NewServiceManager from then on. They are not traced by default
+func SetSpanStarter(starter SpanStarter) {
+	spanStarterMutex.Lock()
+	defer spanStarterMutex.Unlock()
+
+	spanStarter = starter
+}
+
+// getSpanStarter returns the starter of the spans of the operations of the service managers, which
+// is nil if they are not traced
+func getSpanStarter() SpanStarter {
+	spanStarterMutex.RLock()
+	defer spanStarterMutex.RUnlock()
+
+	return spanStarter
+}
+
+// tracedServiceManager a service manager recording a span for each operation of the wrapped one
+type tracedServiceManager struct {
+	sm      ServiceManager
+	starter SpanStarter
+}
+
+// AddServicesToCompose adds services to a running docker compose, recording a span
+func (t *tracedServiceManager) AddServicesToCompose(profile string, composeNames []string, env map[string]string) error {
+	end := t.starter("AddServicesToCompose "+profile, spanLabels(profile, composeNames))
+
+	err := t.sm.AddServicesToCompose(profile, composeNames, env)
+	end(err)
+
+	return err
+}
+
+// CreateNetwork creates the default network of the project of a profile, recording a span
+func (t *tracedServiceManager) CreateNetwork(composeName string, env map[string]string) error {
+	end := t.starter("CreateNetwork "+composeName, spanLabels("", []string{composeName}))
+
+	err := t.sm.CreateNetwork(composeName, env)
+	end(err)
+
+	return err
+}
+
+// ExecCommandInService executes a command in the container of a service, recording a span
+func (t *tracedServiceManager) ExecCommandInService(profile string, service string, cmds []string) (shell.ExecResult, error) {
+	labels := spanLabels(profile, []string{service})
+	labels["command"] = strings.Join(cmds, " ")
+
+	end := t.starter("ExecCommandInService "+service, labels)
+
+	result, err := t.sm.ExecCommandInService(profile, service, cmds)
+	end(err)
+
+	return result, err
+}
+
+// PullImages pulls the images of the services of a profile, recording a span
+func (t *tracedServiceManager) PullImages(profile string, composeNames []string, env map[string]string) error {
+	end := t.starter("PullImages "+profile, spanLabels(profile, composeNames))
+
+	err := t.sm.PullImages(profile, composeNames, env)
+	end(err)
+
+	return err
+}
+
+// RemoveNetwork removes the default network of the project of a profile, recording a span
+func (t *tracedServiceManager) RemoveNetwork(composeName string) error {
+	end := t.starter("RemoveNetwork "+composeName, spanLabels("", []string{composeName}))
+
+	err := t.sm.RemoveNetwork(composeName)
+	end(err)
+
+	return err
+}
+
+// RemoveServicesFromCompose removes services from a running docker compose, recording a span
+func (t *tracedServiceManager) RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error {
+	end := t.starter("RemoveServicesFromCompose "+profile, spanLabels(profile, composeNames))
+
+	err := t.sm.RemoveServicesFromCompose(profile, composeNames, env)
+	end(err)
+
+	return err
+}
+
+// RunCommand executes a docker-compose command in a running docker compose, recording a span
+func (t *tracedServiceManager) RunCommand(profile string, composeNames []string, composeArgs []string, env map[string]string) error {
+	labels := spanLabels(profile, composeNames)
+	labels["command"] = strings.Join(composeArgs, " ")
+
+	end := t.starter("RunCommand "+profile, labels)
+
+	err := t.sm.RunCommand(profile, composeNames, composeArgs, env)
+	end(err)
+
+	return err
+}
+
+// RunCompose runs a docker compose by its name, recording a span
+func (t *tracedServiceManager) RunCompose(isProfile bool, composeNames []string, env map[string]string) error {
+	end := t.starter("RunCompose "+strings.Join(composeNames, ","), spanLabels("", composeNames))
+
+	err := t.sm.RunCompose(isProfile, composeNames, env)
+	end(err)
+
+	return err
+}
+
+// ScaleService runs a number of replicas of a service of a running profile, recording a span
+func (t *tracedServiceManager) ScaleService(profile string, service string, replicas int, env map[string]string) error {
+	labels := spanLabels(profile, []string{service})
+	labels["replicas"] = strconv.Itoa(replicas)
+
+	end := t.starter("ScaleService "+service, labels)
+
+	err := t.sm.ScaleService(profile, service, replicas, env)
+	end(err)
+
+	return err
+}
+
+// SetServiceAliases replaces the aliases of a service in the network of its project, recording a span
+func (t *tracedServiceManager) SetServiceAliases(profile string, service string, aliases []string) error {
+	labels := spanLabels(profile, []string{service})
+	labels["aliases"] = strings.Join(aliases, ",")
+
+	end := t.starter("SetServiceAliases "+service, labels)
+
+	err := t.sm.SetServiceAliases(profile, service, aliases)
+	end(err)
+
+	return err
+}
+
+// StopCompose stops a docker compose by its name, recording a span
+func (t *tracedServiceManager) StopCompose(isProfile bool, composeNames []string) error {
+	end := t.starter("StopCompose "+strings.Join(composeNames, ","), spanLabels("", composeNames))
+
+	err := t.sm.StopCompose(isProfile, composeNames)
+	end(err)
+
+	return err
+}
+
+// WaitForHealthy waits for services of a running profile to be healthy, recording a span
+func (t *tracedServiceManager) WaitForHealthy(profile string, composeNames []string, options WaitOptions) error {
+	end := t.starter("WaitForHealthy "+profile, spanLabels(profile, composeNames))
+
+	err := t.sm.WaitForHealthy(profile, composeNames, options)
+	end(err)
+
+	return err
+}
+
+// spanLabels returns the labels of the span of an operation on the services of a profile
+func spanLabels(profile string, composeNames []string) map[string]string {
+	labels := map[string]string{
+		"services": strings.Join(composeNames, ","),
+	}
+	if profile != "" {
+		labels["profile"] = profile
+	}
+
+	return labels
+}
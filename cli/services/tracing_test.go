@@ -0,0 +1,116 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeServiceManager struct {
+	err error
+}
+
+func (f *fakeServiceManager) AddServicesToCompose(profile string, composeNames []string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) CreateNetwork(composeName string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) ExecCommandInService(profile string, service string, cmds []string) (shell.ExecResult, error) {
+	return shell.ExecResult{}, f.err
+}
+
+func (f *fakeServiceManager) PullImages(profile string, composeNames []string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) RemoveNetwork(composeName string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) RemoveServicesFromCompose(profile string, composeNames []string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) RunCommand(profile string, composeNames []string, composeArgs []string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) RunCompose(isProfile bool, composeNames []string, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) ScaleService(profile string, service string, replicas int, env map[string]string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) SetServiceAliases(profile string, service string, aliases []string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) StopCompose(isProfile bool, composeNames []string) error {
+	return f.err
+}
+
+func (f *fakeServiceManager) WaitForHealthy(profile string, composeNames []string, options WaitOptions) error {
+	return f.err
+}
+
+func TestNewServiceManagerIsTracedWithASpanStarter(t *testing.T) {
+	defer SetSpanStarter(nil)
+
+	_, traced := NewServiceManager().(*tracedServiceManager)
+	assert.False(t, traced)
+
+	SetSpanStarter(func(name string, labels map[string]string) func(err error) {
+		return func(err error) {}
+	})
+
+	_, traced = NewServiceManager().(*tracedServiceManager)
+	assert.True(t, traced)
+}
+
+func TestTracedServiceManagerRecordsSpans(t *testing.T) {
+	names := []string{}
+	labels := []map[string]string{}
+	errs := []error{}
+
+	starter := func(name string, l map[string]string) func(err error) {
+		names = append(names, name)
+		labels = append(labels, l)
+
+		return func(err error) {
+			errs = append(errs, err)
+		}
+	}
+
+	failure := errors.New("compose failed")
+	sm := &tracedServiceManager{sm: &fakeServiceManager{err: failure}, starter: starter}
+
+	err := sm.AddServicesToCompose("fleet", []string{"fleet-server"}, nil)
+	assert.Equal(t, failure, err)
+
+	err = sm.RunCommand("fleet", []string{"centos-systemd"}, []string{"up", "-d"}, nil)
+	assert.Equal(t, failure, err)
+
+	err = sm.StopCompose(true, []string{"fleet"})
+	assert.Equal(t, failure, err)
+
+	err = sm.ScaleService("fleet", "fleet-server", 2, nil)
+	assert.Equal(t, failure, err)
+
+	assert.Equal(t, []string{"AddServicesToCompose fleet", "RunCommand fleet", "StopCompose fleet", "ScaleService fleet-server"}, names)
+	assert.Equal(t, map[string]string{"profile": "fleet", "services": "fleet-server"}, labels[0])
+	assert.Equal(t, map[string]string{"command": "up -d", "profile": "fleet", "services": "centos-systemd"}, labels[1])
+	assert.Equal(t, map[string]string{"services": "fleet"}, labels[2])
+	assert.Equal(t, map[string]string{"profile": "fleet", "replicas": "2", "services": "fleet-server"}, labels[3])
+	assert.Equal(t, []error{failure, failure, failure, failure}, errs)
+}
@@ -0,0 +1,163 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// artifactsAPIURL the URL of the artifacts API, which lists the versions of the stack and the builds
+// of their snapshots
+var artifactsAPIURL = "https://artifacts-api.elastic.co/v1"
+
+// snapshotSuffix the suffix of the versions of the snapshots
+const snapshotSuffix = "-SNAPSHOT"
+
+// minorAliasPattern matches the aliases of the latest version of a minor, i.e. 7.16 for the latest
+// release of 7.16, or 8.0-SNAPSHOT for the latest snapshot of 8.0
+var minorAliasPattern = regexp.MustCompile(`^(\d+)\.(\d+)(-SNAPSHOT)?$`)
+
+// ResolvedVersion a version of the stack resolved with the artifacts API
+type ResolvedVersion struct {
+	BuildID string            // the latest build of a snapshot, i.e. 8.0.0-59098054, empty for the releases
+	Commits map[string]string // the commits of the projects in the latest build of a snapshot, by project
+	Version string            // the exact version, i.e. 8.0.0-SNAPSHOT
+}
+
+// ResolveStackVersion resolves a version of the stack, or an alias of the latest version of a minor,
+// i.e. 8.0-SNAPSHOT, into the exact version with the artifacts API, with the latest build of the
+// snapshots and the commits of its projects. The versions of the pull requests, i.e. pr-22000, are
+// not resolved
+func ResolveStackVersion(version string) (ResolvedVersion, error) {
+	if strings.HasPrefix(strings.ToLower(version), "pr-") {
+		return ResolvedVersion{Version: version}, nil
+	}
+
+	resolved := ResolvedVersion{Version: version}
+
+	if matches := minorAliasPattern.FindStringSubmatch(version); matches != nil {
+		versions, err := listArtifactsVersions()
+		if err != nil {
+			return ResolvedVersion{}, err
+		}
+
+		latest, found := latestVersionOfMinor(versions, matches[1]+"."+matches[2], matches[3] != "")
+		if !found {
+			return ResolvedVersion{}, fmt.Errorf("the %s alias does not match any version in the artifacts API", version)
+		}
+
+		resolved.Version = latest
+	}
+
+	if strings.HasSuffix(resolved.Version, snapshotSuffix) {
+		buildID, commits, err := getLatestSnapshotBuild(resolved.Version)
+		if err != nil {
+			return ResolvedVersion{}, err
+		}
+
+		resolved.BuildID = buildID
+		resolved.Commits = commits
+	}
+
+	log.WithFields(log.Fields{
+		"alias":   version,
+		"buildID": resolved.BuildID,
+		"version": resolved.Version,
+	}).Debug("The version of the stack was resolved")
+
+	return resolved, nil
+}
+
+// latestVersionOfMinor returns the latest version of a minor, i.e. 8.0, in a list of versions, which
+// is a snapshot or a release
+func latestVersionOfMinor(versions []string, minor string, snapshot bool) (string, bool) {
+	latest := ""
+	for _, version := range versions {
+		if !strings.HasPrefix(version, minor+".") || strings.HasSuffix(version, snapshotSuffix) != snapshot {
+			continue
+		}
+
+		// the versions of the releases have no suffix, and the pre-releases, i.e. 8.0.0-rc1, are skipped
+		if !snapshot && strings.Contains(version, "-") {
+			continue
+		}
+
+		if latest == "" || compareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+
+	return latest, latest != ""
+}
+
+// listArtifactsVersions returns the versions listed by the artifacts API, released or not
+func listArtifactsVersions() ([]string, error) {
+	response := struct {
+		Versions []string `json:"versions"`
+	}{}
+
+	err := getArtifactsAPI("/versions", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Versions, nil
+}
+
+// getLatestSnapshotBuild returns the ID of the latest build of a snapshot in the artifacts API, i.e.
+// 8.0.0-59098054, with the commits of its projects, by project, i.e. elasticsearch
+func getLatestSnapshotBuild(version string) (string, map[string]string, error) {
+	response := struct {
+		Build struct {
+			BuildID  string `json:"build_id"`
+			Projects map[string]struct {
+				CommitHash string `json:"commit_hash"`
+			} `json:"projects"`
+		} `json:"build"`
+	}{}
+
+	err := getArtifactsAPI("/versions/"+version+"/builds/latest", &response)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if response.Build.BuildID == "" {
+		return "", nil, fmt.Errorf("the artifacts API did not list any build of the %s version", version)
+	}
+
+	commits := map[string]string{}
+	for project, info := range response.Build.Projects {
+		if info.CommitHash != "" {
+			commits[project] = info.CommitHash
+		}
+	}
+
+	return response.Build.BuildID, commits, nil
+}
+
+// getArtifactsAPI sends a GET request to a path of the artifacts API, decoding the response into
+// the result
+func getArtifactsAPI(path string, result interface{}) error {
+	r := shell.HTTPRequest{
+		URL: artifactsAPIURL + path + "?x-elastic-no-kpi=true",
+	}
+
+	body, err := shell.Get(r)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   r.URL,
+		}).Error("Could not get the versions from the artifacts API")
+		return err
+	}
+
+	return json.Unmarshal([]byte(body), result)
+}
@@ -0,0 +1,77 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatestVersionOfMinor(t *testing.T) {
+	versions := []string{"7.16.2", "7.16.3-SNAPSHOT", "7.16.10", "8.0.0-rc1", "8.0.0-SNAPSHOT", "8.0.1-SNAPSHOT", "8.1.0-SNAPSHOT"}
+
+	latest, found := latestVersionOfMinor(versions, "7.16", false)
+	assert.True(t, found)
+	assert.Equal(t, "7.16.10", latest)
+
+	latest, found = latestVersionOfMinor(versions, "8.0", true)
+	assert.True(t, found)
+	assert.Equal(t, "8.0.1-SNAPSHOT", latest)
+
+	_, found = latestVersionOfMinor(versions, "8.0", false)
+	assert.False(t, found)
+}
+
+func TestResolveStackVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/versions":
+			_, _ = w.Write([]byte(`{"versions": ["7.16.2", "8.0.0-SNAPSHOT", "8.0.1-SNAPSHOT"]}`))
+		case "/versions/8.0.1-SNAPSHOT/builds/latest":
+			_, _ = w.Write([]byte(`{"build": {"build_id": "8.0.1-59098054", "projects": {"elasticsearch": {"commit_hash": "abc123"}, "kibana": {"commit_hash": "def456"}}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defaultURL := artifactsAPIURL
+	artifactsAPIURL = server.URL
+	defer func() { artifactsAPIURL = defaultURL }()
+
+	t.Run("A snapshot alias resolves to the latest build of the minor", func(t *testing.T) {
+		resolved, err := ResolveStackVersion("8.0-SNAPSHOT")
+		assert.Nil(t, err)
+		assert.Equal(t, "8.0.1-SNAPSHOT", resolved.Version)
+		assert.Equal(t, "8.0.1-59098054", resolved.BuildID)
+		assert.Equal(t, map[string]string{"elasticsearch": "abc123", "kibana": "def456"}, resolved.Commits)
+	})
+
+	t.Run("A release alias resolves to the latest release of the minor", func(t *testing.T) {
+		resolved, err := ResolveStackVersion("7.16")
+		assert.Nil(t, err)
+		assert.Equal(t, ResolvedVersion{Version: "7.16.2"}, resolved)
+	})
+
+	t.Run("A release is not resolved", func(t *testing.T) {
+		resolved, err := ResolveStackVersion("7.16.1")
+		assert.Nil(t, err)
+		assert.Equal(t, ResolvedVersion{Version: "7.16.1"}, resolved)
+	})
+
+	t.Run("A pull request is not resolved", func(t *testing.T) {
+		resolved, err := ResolveStackVersion("pr-22000")
+		assert.Nil(t, err)
+		assert.Equal(t, ResolvedVersion{Version: "pr-22000"}, resolved)
+	})
+
+	t.Run("An alias without versions fails", func(t *testing.T) {
+		_, err := ResolveStackVersion("9.9-SNAPSHOT")
+		assert.NotNil(t, err)
+	})
+}
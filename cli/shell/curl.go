@@ -6,15 +6,130 @@ package shell
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// HTTPExchange represents an executed HTTP request, with its response
+type HTTPExchange struct {
+	Duration   time.Duration
+	Error      string
+	Method     string
+	Payload    string
+	Response   string
+	StartedAt  time.Time
+	StatusCode int
+	URL        string
+}
+
+// httpObservers functions notified of every HTTP request executed by this package
+var httpObservers []func(HTTPExchange)
+
+var httpObserversMutex sync.RWMutex
+
+// httpTransport the transport executing the HTTP requests of this package, which trusts the
+// CA certificates added with TrustCACertificate
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+var httpTransportMutex sync.RWMutex
+
+// AddHTTPObserver registers a function that will be notified of every HTTP request
+// executed by this package, once it has finished
+func AddHTTPObserver(observer func(HTTPExchange)) {
+	httpObserversMutex.Lock()
+	defer httpObserversMutex.Unlock()
+
+	httpObservers = append(httpObservers, observer)
+}
+
+// NotifyHTTPExchange notifies the registered observers about an executed HTTP request,
+// so that requests executed by other HTTP clients can be observed too
+func NotifyHTTPExchange(exchange HTTPExchange) {
+	httpObserversMutex.RLock()
+	defer httpObserversMutex.RUnlock()
+
+	for _, observer := range httpObservers {
+		observer(exchange)
+	}
+}
+
+// GetTransport returns the transport executing the HTTP requests of this package, so that
+// other HTTP clients trust the same CA certificates
+func GetTransport() http.RoundTripper {
+	httpTransportMutex.RLock()
+	defer httpTransportMutex.RUnlock()
+
+	return httpTransport
+}
+
+// TrustCACertificate adds the PEM encoded certificate of a CA in a file to the ones trusted by
+// the HTTP requests executed by this package, along with the ones of the system
+func TrustCACertificate(caCertPath string) error {
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  caCertPath,
+		}).Error("Could not read the CA certificate")
+		return err
+	}
+
+	httpTransportMutex.Lock()
+	defer httpTransportMutex.Unlock()
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if current, ok := httpTransport.(*http.Transport); ok {
+		transport = current.Clone()
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+
+	roots := transport.TLSClientConfig.RootCAs
+	if roots == nil {
+		roots, err = x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+	}
+
+	if !roots.AppendCertsFromPEM(caCert) {
+		log.WithField("path", caCertPath).Error("The CA certificate is not PEM encoded")
+		return fmt.Errorf("the CA certificate at %s is not PEM encoded", caCertPath)
+	}
+	transport.TLSClientConfig.RootCAs = roots
+
+	httpTransport = transport
+
+	log.WithField("path", caCertPath).Debug("The CA certificate is trusted by the HTTP requests")
+
+	return nil
+}
+
+// HTTPStatusError the error of a request whose response has a status code out of the 2xx and
+// 3xx ranges, so that the callers can check the status code, and how long the server asked to
+// wait before retrying the request, if it did
+type HTTPStatusError struct {
+	Method     string
+	RetryAfter time.Duration // delay of the Retry-After header of the response, zero if absent
+	StatusCode int
+}
+
+// Error returns the message of the error
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s request failed with %d", e.Method, e.StatusCode)
+}
+
 // HTTPRequest configures an HTTP request
 type HTTPRequest struct {
 	BasicAuthUser     string
@@ -69,8 +184,31 @@ func Put(r HTTPRequest) (string, error) {
 	return request(r)
 }
 
-// Post executes a request
+// request executes a request, notifying the observers about it
 func request(r HTTPRequest) (string, error) {
+	exchange := HTTPExchange{
+		Method:    r.method,
+		Payload:   r.Payload,
+		StartedAt: time.Now(),
+		URL:       r.GetURL(),
+	}
+
+	response, statusCode, err := doRequest(r)
+
+	exchange.Duration = time.Since(exchange.StartedAt)
+	exchange.Response = response
+	exchange.StatusCode = statusCode
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+
+	NotifyHTTPExchange(exchange)
+
+	return response, err
+}
+
+// doRequest executes a request, returning the body and the status code of the response
+func doRequest(r HTTPRequest) (string, int, error) {
 	escapedURL := r.GetURL()
 
 	fields := log.Fields{
@@ -95,7 +233,7 @@ func request(r HTTPRequest) (string, error) {
 			"method":     r.method,
 			"escapedURL": escapedURL,
 		}).Warn("Error creating request")
-		return "", err
+		return "", 0, err
 	}
 
 	if r.Headers != nil {
@@ -108,14 +246,16 @@ func request(r HTTPRequest) (string, error) {
 		req.SetBasicAuth(r.BasicAuthUser, r.BasicAuthPassword)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	client := &http.Client{Transport: GetTransport()}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":      err,
 			"method":     r.method,
 			"escapedURL": escapedURL,
 		}).Warn("Error executing request")
-		return "", err
+		return "", 0, err
 	}
 	defer resp.Body.Close()
 
@@ -126,14 +266,40 @@ func request(r HTTPRequest) (string, error) {
 			"method":     r.method,
 			"escapedURL": escapedURL,
 		}).Warn("Could not read response body")
-		return "", err
+		return "", resp.StatusCode, err
 	}
 	bodyString := string(bodyBytes)
 
 	// http.Status ==> [2xx, 4xx)
 	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest {
-		return bodyString, nil
+		return bodyString, resp.StatusCode, nil
+	}
+
+	return bodyString, resp.StatusCode, &HTTPStatusError{
+		Method:     r.method,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		StatusCode: resp.StatusCode,
+	}
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, which is either a number of seconds
+// or an HTTP date. It returns zero for an empty, invalid or past value
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
 	}
 
-	return bodyString, fmt.Errorf("%s request failed with %d", r.method, resp.StatusCode)
+	return date.Sub(now)
 }
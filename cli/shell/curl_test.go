@@ -0,0 +1,132 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package shell
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPObserversAreNotified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	}))
+	defer server.Close()
+
+	exchanges := []HTTPExchange{}
+	AddHTTPObserver(func(exchange HTTPExchange) {
+		exchanges = append(exchanges, exchange)
+	})
+
+	_, err := Post(HTTPRequest{URL: server.URL + "/ok", Payload: `{"foo":"bar"}`})
+	assert.Nil(t, err)
+
+	_, err = Get(HTTPRequest{URL: server.URL + "/fail"})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, 2, len(exchanges))
+
+	assert.Equal(t, "POST", exchanges[0].Method)
+	assert.Equal(t, server.URL+"/ok", exchanges[0].URL)
+	assert.Equal(t, `{"foo":"bar"}`, exchanges[0].Payload)
+	assert.Equal(t, http.StatusOK, exchanges[0].StatusCode)
+	assert.Equal(t, `{"path":"/ok"}`, exchanges[0].Response)
+	assert.Equal(t, "", exchanges[0].Error)
+
+	assert.Equal(t, "GET", exchanges[1].Method)
+	assert.Equal(t, http.StatusInternalServerError, exchanges[1].StatusCode)
+	assert.Equal(t, "GET request failed with 500", exchanges[1].Error)
+}
+
+func TestHTTPStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"statusCode":404}`))
+	}))
+	defer server.Close()
+
+	body, err := Delete(HTTPRequest{URL: server.URL})
+	assert.Equal(t, `{"statusCode":404}`, body)
+
+	var statusErr *HTTPStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, "DELETE", statusErr.Method)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	assert.Equal(t, time.Duration(0), statusErr.RetryAfter)
+}
+
+func TestHTTPStatusErrorWithRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := Get(HTTPRequest{URL: server.URL})
+
+	var statusErr *HTTPStatusError
+	assert.True(t, errors.As(err, &statusErr))
+	assert.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+	assert.Equal(t, 3*time.Second, statusErr.RetryAfter)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestTrustCACertificate(t *testing.T) {
+	defer filet.CleanUp(t)
+	defer func() {
+		httpTransport = http.DefaultTransport
+	}()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"secured":true}`))
+	}))
+	defer server.Close()
+
+	_, err := Get(HTTPRequest{URL: server.URL})
+	assert.NotNil(t, err)
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caCertFile := filet.TmpFile(t, "", string(caCert))
+
+	err = TrustCACertificate(caCertFile.Name())
+	assert.Nil(t, err)
+
+	body, err := Get(HTTPRequest{URL: server.URL})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"secured":true}`, body)
+}
+
+func TestTrustCACertificateFailsWithoutPEM(t *testing.T) {
+	defer filet.CleanUp(t)
+	defer func() {
+		httpTransport = http.DefaultTransport
+	}()
+
+	caCertFile := filet.TmpFile(t, "", "not a certificate")
+
+	err := TrustCACertificate(caCertFile.Name())
+	assert.NotNil(t, err)
+	assert.Equal(t, http.DefaultTransport, GetTransport())
+}
@@ -68,6 +68,60 @@ func Execute(workspace string, command string, args ...string) (string, error) {
 	return trimmedOutput, nil
 }
 
+// ExecResult the result of a command which ran to completion, no matter its exit code
+type ExecResult struct {
+	ExitCode int    `json:"exitCode"`
+	Stderr   string `json:"stderr"`
+	Stdout   string `json:"stdout"`
+}
+
+// ExecuteWithResult executes a command in the machine the program is running, as Execute does,
+// returning its output and its exit code. It only fails if the command could not be run, so that
+// the callers can check the output of the failing commands
+func ExecuteWithResult(workspace string, command string, args ...string) (ExecResult, error) {
+	log.WithFields(log.Fields{
+		"command": command,
+		"args":    args,
+	}).Trace("Executing command")
+
+	cmd := exec.Command(command, args[0:]...)
+
+	cmd.Dir = workspace
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	exitCode := 0
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		log.WithFields(log.Fields{
+			"baseDir": workspace,
+			"command": command,
+			"args":    args,
+			"error":   err,
+		}).Error("Error executing command")
+
+		return ExecResult{}, err
+	}
+
+	result := ExecResult{
+		ExitCode: exitCode,
+		Stderr:   strings.Trim(stderr.String(), "\n"),
+		Stdout:   strings.Trim(out.String(), "\n"),
+	}
+
+	log.WithFields(log.Fields{
+		"exitCode": result.ExitCode,
+		"output":   result.Stdout,
+	}).Trace("Output")
+
+	return result, nil
+}
+
 // GetEnv returns an environment variable as string
 func GetEnv(envVar string, defaultValue string) string {
 	if value, exists := os.LookupEnv(envVar); exists {
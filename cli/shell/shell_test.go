@@ -45,3 +45,14 @@ func TestGetEnvBool(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteWithResultOfAFailingCommand(t *testing.T) {
+	result, err := ExecuteWithResult(".", "sh", "-c", "echo out; echo err >&2; exit 3")
+	assert.Nil(t, err)
+	assert.Equal(t, ExecResult{ExitCode: 3, Stderr: "err", Stdout: "out"}, result)
+}
+
+func TestExecuteWithResultOfAMissingCommand(t *testing.T) {
+	_, err := ExecuteWithResult(".", "this-command-does-not-exist")
+	assert.NotNil(t, err)
+}
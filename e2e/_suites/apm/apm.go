@@ -0,0 +1,372 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// FleetServerServiceName the name of the service of the Fleet Server, which runs the APM Server
+// of the APM integration, being its host name in the network of the profile too
+const FleetServerServiceName = "fleet-server"
+
+// OpbeansGoServiceName the name of the service of the opbeans-go app
+const OpbeansGoServiceName = "opbeans-go"
+
+// apmIntegrationTitle the title of the APM integration in the Package Registry
+const apmIntegrationTitle = "Elastic APM"
+
+// apmServerPort the port the APM Server listens at in the container of the Fleet Server
+const apmServerPort = 8200
+
+// fleetServerPort the port of the Fleet Server in the network of the profile
+const fleetServerPort = 8220
+
+// instrumentedApp an app instrumented with an agent of APM, sending its traces to the APM Server
+type instrumentedApp struct {
+	path string // the path of the endpoint of the app receiving the requests, i.e. /api/products
+	port int    // the port of the app, exposed at the host
+}
+
+// instrumentedApps the apps instrumented with an agent of APM, by the name of their service
+var instrumentedApps = map[string]instrumentedApp{
+	OpbeansGoServiceName: {path: "/api/products", port: 8000},
+}
+
+// APMTestSuite represents the state of a scenario of the APM suite
+type APMTestSuite struct {
+	FleetServerHostname string               // the hostname the Fleet Server is listed with in Fleet
+	PackagePolicy       kibana.PackagePolicy // the APM integration added to the policy of the Fleet Server
+	Services            []string             // the services added to the profile by the scenario
+	StartedAt           time.Time            // the time the scenario started at
+}
+
+// beforeScenario resets the state of the suite for a new scenario
+func (ats *APMTestSuite) beforeScenario() {
+	ats.FleetServerHostname = ""
+	ats.PackagePolicy = kibana.PackagePolicy{}
+	ats.Services = []string{}
+	ats.StartedAt = time.Now().UTC()
+}
+
+// afterScenario unenrolls the Fleet Server, removes the services added by the scenario, and deletes
+// the APM integration from the policy of the Fleet Server
+func (ats *APMTestSuite) afterScenario() {
+	if ats.FleetServerHostname != "" {
+		agent, err := fleetClient.GetAgentByHostname(ats.FleetServerHostname)
+		if err == nil {
+			err = fleetClient.UnenrollAgent(agent.ID, true)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"hostname": ats.FleetServerHostname,
+			}).Warn("The Fleet Server could not be unenrolled")
+		}
+	}
+
+	if len(ats.Services) > 0 {
+		if !developerMode {
+			serviceManager := services.NewServiceManager()
+			err := serviceManager.RemoveServicesFromCompose(APMProfileName, ats.Services, apmServicesEnv())
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":    err,
+					"services": ats.Services,
+				}).Warn("The services of the scenario could not be removed")
+			}
+		} else {
+			log.WithField("services", ats.Services).Info("Because we are running in development mode, the services won't be stopped")
+		}
+	}
+
+	if ats.PackagePolicy.ID != "" {
+		err := fleetClient.DeletePackagePolicy(ats.PackagePolicy.ID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":           err,
+				"packagePolicyID": ats.PackagePolicy.ID,
+			}).Warn("The APM integration could not be deleted from the policy of the Fleet Server")
+		}
+	}
+
+	ats.beforeScenario()
+}
+
+// theAPMIntegrationIsAddedToThePolicyOfTheFleetServer adds the APM integration, in its latest
+// version, to the default policy of the Fleet Server, so that the Fleet Server runs an APM Server
+// listening in the network of the profile
+func (ats *APMTestSuite) theAPMIntegrationIsAddedToThePolicyOfTheFleetServer() error {
+	integration, err := fleetClient.GetPackageByTitle(apmIntegrationTitle)
+	if err != nil {
+		return err
+	}
+
+	policy, err := fleetClient.GetDefaultFleetServerPolicy()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not get the policy of the Fleet Server, which is created by the setup of Fleet")
+		return err
+	}
+
+	packagePolicy := kibana.PackagePolicy{
+		Description: integration.Title + "-test-description",
+		Enabled:     true,
+		Inputs: []kibana.PackagePolicyInput{
+			{
+				Enabled:        true,
+				PolicyTemplate: "apmserver",
+				Streams:        []json.RawMessage{},
+				Type:           "apm",
+				Vars: map[string]kibana.PackagePolicyConfigValue{
+					// the APM Server listens in all the interfaces, so that the apps reach it
+					"host": {Type: "text", Value: fmt.Sprintf("0.0.0.0:%d", apmServerPort)},
+					"url":  {Type: "text", Value: getAPMServerURL()},
+				},
+			},
+		},
+		Name:      integration.Name + "-test-name",
+		Namespace: "default",
+		Package: kibana.PackageInfo{
+			Name:    integration.Name,
+			Title:   integration.Title,
+			Version: integration.Version,
+		},
+		PolicyID: policy.ID,
+	}
+
+	ats.PackagePolicy, err = fleetClient.AddPackagePolicy(packagePolicy)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"policyID": policy.ID,
+		}).Error("Could not add the APM integration to the policy of the Fleet Server")
+		return err
+	}
+
+	return nil
+}
+
+// aFleetServerIsDeployed bootstraps a Fleet Server into the default Fleet Server policy, waiting for
+// it to be listed in Fleet as online, so that it runs the integrations of its policy
+func (ats *APMTestSuite) aFleetServerIsDeployed() error {
+	serviceToken, err := fleetClient.CreateServiceToken()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not create the service token of the Fleet Server")
+		return err
+	}
+
+	policy, err := fleetClient.GetDefaultFleetServerPolicy()
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("http://%s:%d", FleetServerServiceName, fleetServerPort)
+	err = fleetClient.UpdateFleetServerHosts([]string{url})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   url,
+		}).Error("Could not set the URL of the Fleet Server in the settings of Fleet")
+		return err
+	}
+
+	env := apmServicesEnv()
+	env["fleetServerPolicyID"] = policy.ID
+	env["fleetServerServiceToken"] = serviceToken.Value
+
+	err = ats.addService(FleetServerServiceName, env)
+	if err != nil {
+		return err
+	}
+
+	hostname, err := docker.ExecCommandIntoContainer(e2e.ScenarioContext(), env["fleetServerContainerName"], "root", []string{"cat", "/etc/hostname"})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"containerName": env["fleetServerContainerName"],
+			"error":         err,
+		}).Error("Could not retrieve the hostname of the Fleet Server")
+		return err
+	}
+	ats.FleetServerHostname = hostname
+
+	return waitForFleetServerOnline(hostname)
+}
+
+// theInstrumentedAppReceivesRequests deploys an instrumented app, sending its traces to the APM
+// Server of the Fleet Server, and sends a number of requests to it, each one being a transaction
+func (ats *APMTestSuite) theInstrumentedAppReceivesRequests(app string, requests string) error {
+	instrumented, exists := instrumentedApps[app]
+	if !exists {
+		return fmt.Errorf("the %s app is not instrumented with an agent of APM", app)
+	}
+
+	count, err := strconv.Atoi(requests)
+	if err != nil {
+		return err
+	}
+
+	err = ats.addService(app, apmServicesEnv())
+	if err != nil {
+		return err
+	}
+
+	r := shell.HTTPRequest{
+		URL: fmt.Sprintf("http://localhost:%d%s", config.GetHostPort(instrumented.port), instrumented.path),
+	}
+
+	// the app could be still starting
+	exp := e2e.GetExponentialBackOff(time.Duration(timeoutFactor) * time.Minute)
+	err = backoff.Retry(func() error {
+		_, err := shell.Get(r)
+		return err
+	}, exp)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"app":   app,
+			"error": err,
+			"url":   r.URL,
+		}).Error("The instrumented app could not receive the requests")
+		return err
+	}
+
+	for i := 1; i < count; i++ {
+		_, err := shell.Get(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"app":      app,
+		"requests": count,
+	}).Info("The instrumented app received the requests")
+
+	return nil
+}
+
+// thereAreAtLeastTransactionsOfTheServiceInTheDataStream waits for a number of transactions of a
+// service, sent since the scenario started, to be queryable in a data stream, i.e. traces-apm-default
+func (ats *APMTestSuite) thereAreAtLeastTransactionsOfTheServiceInTheDataStream(transactions string, service string, dataStream string) error {
+	count, err := strconv.Atoi(transactions)
+	if err != nil {
+		return err
+	}
+
+	query := elasticsearch.NewQuery().
+		WithTerm("processor.event", "transaction").
+		WithTerm("service.name", service).
+		WithTimeRange(ats.StartedAt, time.Time{}).
+		WithSize(count)
+
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute)
+
+	_, err = e2e.WaitForHits(dataStream, query, count, maxTimeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dataStream":   dataStream,
+			"error":        err,
+			"service":      service,
+			"transactions": count,
+		}).Error("The transactions of the service are not in the data stream")
+		return err
+	}
+
+	return nil
+}
+
+// addService adds a service to the profile, being removed after the scenario
+func (ats *APMTestSuite) addService(service string, env map[string]string) error {
+	ats.Services = append(ats.Services, service)
+
+	serviceManager := services.NewServiceManager()
+	err := serviceManager.AddServicesToCompose(APMProfileName, []string{service}, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": service,
+		}).Error("Could not add the service to the profile")
+		return err
+	}
+
+	return nil
+}
+
+// apmServicesEnv returns the environment of the compose files of the services added by the
+// scenarios: the Fleet Server, with plain HTTP, and the instrumented apps, reaching its APM Server
+func apmServicesEnv() map[string]string {
+	env := map[string]string{}
+	for k, v := range profileEnv {
+		env[k] = v
+	}
+
+	env["apmServerURL"] = getAPMServerURL()
+	env["fleetServerCert"] = ""
+	env["fleetServerCertKey"] = ""
+	env["fleetServerContainerName"] = fmt.Sprintf("%s_%s_%d", config.GetComposeProjectName(APMProfileName), FleetServerServiceName, 1)
+	env["fleetServerElasticsearchCA"] = ""
+	env["fleetServerInsecureHTTP"] = "1"
+	env["fleetServerTag"] = agentVersion
+	env["opbeansGoTag"] = opbeansGoVersion
+
+	return env
+}
+
+// getAPMServerURL returns the URL of the APM Server run by the Fleet Server, in the network of the
+// profile
+func getAPMServerURL() string {
+	return fmt.Sprintf("http://%s:%d", FleetServerServiceName, apmServerPort)
+}
+
+// waitForFleetServerOnline waits for the Fleet Server to be listed in Fleet as online
+func waitForFleetServerOnline(hostname string) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+	retryCount := 1
+
+	fleetServerOnlineFn := func() error {
+		agent, err := fleetClient.GetAgentByHostname(hostname)
+		if err == nil && agent.Status != "online" {
+			err = fmt.Errorf("the Fleet Server is %s", agent.Status)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"hostname":    hostname,
+				"retries":     retryCount,
+			}).Warn("The Fleet Server is not online yet")
+
+			retryCount++
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    hostname,
+			"retries":     retryCount,
+		}).Info("The Fleet Server is online")
+
+		return nil
+	}
+
+	return backoff.Retry(fleetServerOnlineFn, exp)
+}
@@ -0,0 +1,134 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/pkg/steps"
+	"github.com/elastic/e2e-testing/e2e/runner"
+)
+
+// APMProfileName the name of the profile running the runtime dependencies of the suite:
+// Elasticsearch, Kibana and the Package Registry
+const APMProfileName = "apm"
+
+// developerMode tears down the backend services (ES, Kibana, Package Registry)
+// after a test suite. This is the desired behavior, but when developing, we maybe want to keep
+// them running to speed up the development cycle.
+// It can be overriden by the DEVELOPER_MODE env var, or the --keep-stack flag
+var developerMode = false
+
+const agentVersionBase = "8.0.0-SNAPSHOT"
+
+// agentVersion is the version of the agent running the Fleet Server and the APM Server
+// It can be overriden by ELASTIC_AGENT_VERSION env var
+var agentVersion = agentVersionBase
+
+// opbeansGoVersion is the version of the opbeans-go app, instrumented with the Go agent of APM
+// It can be overriden by OPBEANS_GO_VERSION env var
+var opbeansGoVersion = "latest"
+
+// packageRegistryImage is the docker image of the Elastic Package Registry run by the profile
+// It can be overriden by PACKAGE_REGISTRY_IMAGE env var
+var packageRegistryImage = "docker.elastic.co/package-registry/distribution:staging"
+
+// stackVersion is the version of the stack to use
+// It can be overriden by STACK_VERSION env var
+var stackVersion = agentVersionBase
+
+// timeoutFactor a multiplier for the max timeout when doing backoff retries.
+// It can be overriden by TIMEOUT_FACTOR env var
+var timeoutFactor = 3
+
+// profileEnv is the environment to be applied to any execution
+// affecting the runtime dependencies (or profile)
+var profileEnv map[string]string
+
+// fleetClient the typed client of the Fleet and Integrations APIs of Kibana
+var fleetClient *kibana.Client
+
+// ats holds the state of the suite, shared by its hooks and the steps of its scenarios
+var ats APMTestSuite
+
+func init() {
+	config.Init()
+
+	fleetClient = kibana.NewClient()
+
+	timeoutFactor = shell.GetEnvInteger("TIMEOUT_FACTOR", timeoutFactor)
+	agentVersion = e2e.GetElasticArtifactVersion(shell.GetEnv("ELASTIC_AGENT_VERSION", agentVersion))
+	opbeansGoVersion = shell.GetEnv("OPBEANS_GO_VERSION", opbeansGoVersion)
+	packageRegistryImage = shell.GetEnv("PACKAGE_REGISTRY_IMAGE", packageRegistryImage)
+	stackVersion = shell.GetEnv("STACK_VERSION", stackVersion)
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(newAPMSuite().Run())
+}
+
+// newAPMSuite returns the APM suite, running the APM profile with the images of the Fleet Server and
+// the instrumented apps pulled, and setting Fleet up
+func newAPMSuite() *runner.Suite {
+	return runner.New(runner.Options{
+		Name:    "apm",
+		Profile: APMProfileName,
+		ReportProperties: map[string]string{
+			"agentVersion":     agentVersion,
+			"opbeansGoVersion": opbeansGoVersion,
+			"stackVersion":     stackVersion,
+		},
+		Timeout: time.Duration(timeoutFactor) * time.Minute,
+		Fleet:   true,
+		ProfileEnv: func() (map[string]string, error) {
+			workDir, _ := os.Getwd()
+			profileEnv = map[string]string{
+				"kibanaConfigPath":     path.Join(workDir, "configurations", "kibana.config.yml"),
+				"packageRegistryImage": packageRegistryImage,
+				"stackVersion":         stackVersion,
+			}
+
+			return profileEnv, nil
+		},
+		PullServices: func(profileEnv map[string]string) ([]string, map[string]string) {
+			return []string{FleetServerServiceName, OpbeansGoServiceName}, apmServicesEnv()
+		},
+		BeforeSuite: func() {
+			developerMode = e2e.IsDeveloperMode()
+		},
+		Scenario:         InitializeAPMScenario,
+		StepBundles:      []steps.Bundle{steps.ServicesBundle, steps.WaitsBundle, steps.ElasticsearchBundle, steps.FleetBundle},
+		CleanDataStreams: true,
+		DataStreams:      []string{"traces-apm*", "metrics-apm*", "logs-apm*"},
+	})
+}
+
+// InitializeAPMScenario adds steps to the scenarios of the Godog test suite, which destroy the
+// services they deploy
+func InitializeAPMScenario(s *godog.ScenarioContext) func() error {
+	e2e.Step(s, `^the APM integration is added to the policy of the Fleet Server$`, ats.theAPMIntegrationIsAddedToThePolicyOfTheFleetServer)
+	e2e.Step(s, `^a Fleet Server is deployed$`, ats.aFleetServerIsDeployed)
+	e2e.Step(s, `^the "([^"]*)" instrumented app receives "(\d+)" requests$`, ats.theInstrumentedAppReceivesRequests)
+	e2e.Step(s, `^there are at least "(\d+)" transactions of the "([^"]*)" service in the "([^"]*)" data stream$`, ats.thereAreAtLeastTransactionsOfTheServiceInTheDataStream)
+
+	s.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		ats.beforeScenario()
+		return ctx, nil
+	})
+
+	return func() error {
+		ats.afterScenario()
+		return nil
+	}
+}
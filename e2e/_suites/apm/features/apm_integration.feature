@@ -0,0 +1,18 @@
+@apm_integration
+Feature: APM Integration
+  Scenarios for the APM Server run by the Fleet Server with the APM integration, receiving the
+  traces of an app instrumented with an agent of APM.
+
+@install
+Scenario: Installing the APM integration
+  When the "Elastic APM" integration is installed in Fleet
+  Then the "Elastic APM" integration index templates are installed
+    And the "Elastic APM" integration ingest pipelines are installed
+
+@traces
+Scenario: Sending the traces of an instrumented app to the APM Server of the Fleet Server
+  Given the "Elastic APM" integration is installed in Fleet
+    And the APM integration is added to the policy of the Fleet Server
+    And a Fleet Server is deployed
+  When the "opbeans-go" instrumented app receives "10" requests
+  Then there are at least "10" transactions of the "opbeans-go" service in the "traces-apm-default" data stream
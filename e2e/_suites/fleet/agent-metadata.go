@@ -0,0 +1,137 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// hostArchitectures the architecture reported by the agents in their local metadata, i.e. the
+// one of uname -m, by the architecture in the name of their artifacts
+var hostArchitectures = map[string]string{
+	"aarch64": "aarch64",
+	"amd64":   "x86_64",
+	"arm64":   "aarch64",
+	"x86_64":  "x86_64",
+}
+
+// theLocalMetadataOfTheAgentHasField waits for the agent to be listed in Fleet with a value for a
+// field of its local metadata, by its path, i.e. os.family
+func (fts *FleetTestSuite) theLocalMetadataOfTheAgentHasField(path string, value string) error {
+	return fts.waitForAgentLocalMetadata(func(metadata map[string]interface{}) error {
+		field, exists := kibana.LookupMetadataField(metadata, path)
+		if !exists {
+			return fmt.Errorf("The local metadata of the agent has no %s field", path)
+		}
+
+		if fmt.Sprint(field) != value {
+			return fmt.Errorf("The %s field of the local metadata of the agent is %v, but it should be %s", path, field, value)
+		}
+
+		return nil
+	})
+}
+
+// theLocalMetadataOfTheAgentReportsTheArchitectureOfItsHost waits for the agent to be listed in
+// Fleet with the architecture of its host, which is the one of the artifact it was installed from
+func (fts *FleetTestSuite) theLocalMetadataOfTheAgentReportsTheArchitectureOfItsHost() error {
+	installer := fts.getInstaller()
+
+	architecture, exists := hostArchitectures[installer.artifactArch]
+	if !exists {
+		return fmt.Errorf("The %s architecture of the artifact of the agent is not supported", installer.artifactArch)
+	}
+
+	return fts.theLocalMetadataOfTheAgentHasField("host.architecture", architecture)
+}
+
+// theLocalMetadataOfTheAgentReportsTheVersionAndBuildHashUnderTest waits for the agent to be
+// listed in Fleet with the version under test, and the build hash of the installed agent
+func (fts *FleetTestSuite) theLocalMetadataOfTheAgentReportsTheVersionAndBuildHashUnderTest() error {
+	installer := fts.getInstaller()
+
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(FleetProfileName), fts.Image+"-systemd", ElasticAgentServiceName, 1)
+
+	hash, err := installer.getElasticAgentHash(containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"containerName": containerName,
+			"error":         err,
+		}).Error("Could not get the build hash of the agent")
+		return err
+	}
+
+	return fts.waitForAgentLocalMetadata(func(metadata map[string]interface{}) error {
+		agent, err := fts.suite.fleet.GetAgentByHostname(fts.Hostname)
+		if err != nil {
+			return err
+		}
+
+		if agent.Version() != agentVersion {
+			return fmt.Errorf("The agent reports the %s version in its local metadata, but it should be %s", agent.Version(), agentVersion)
+		}
+
+		// the installed agent keeps the short hash only
+		buildHash := agent.LocalMetadata.Elastic.Agent.BuildHash()
+		if !strings.HasPrefix(buildHash, hash) {
+			return fmt.Errorf("The agent reports the %s build hash in its local metadata, but it should be %s", buildHash, hash)
+		}
+
+		return nil
+	})
+}
+
+// waitForAgentLocalMetadata waits for the local metadata of the agent, as it's listed in Fleet, to
+// pass an assertion, as the metadata is updated by the agent when it checks in
+func (fts *FleetTestSuite) waitForAgentLocalMetadata(assertFn func(metadata map[string]interface{}) error) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute)
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	agentMetadataFn := func() error {
+		agent, err := fts.suite.fleet.GetAgentByHostname(fts.Hostname)
+		if err != nil {
+			retryCount++
+			return err
+		}
+
+		metadata, err := fts.suite.fleet.GetAgentLocalMetadata(agent.ID)
+		if err == nil {
+			err = assertFn(metadata)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"agentID":     agent.ID,
+				"elapsedTime": exp.GetElapsedTime(),
+				"hostname":    fts.Hostname,
+				"retry":       retryCount,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"agentID":     agent.ID,
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    fts.Hostname,
+			"retries":     retryCount,
+		}).Info("The local metadata of the agent is listed in Fleet")
+
+		return nil
+	}
+
+	return backoff.Retry(agentMetadataFn, exp)
+}
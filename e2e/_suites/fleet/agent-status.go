@@ -0,0 +1,228 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// fleetCheckinTimeout the time without checkins after which Fleet lists an agent as offline
+const fleetCheckinTimeout = 5 * time.Minute
+
+// unreachableOutputHost the host of Elasticsearch set in the output of the agents to break it, so
+// that the agents cannot send their data
+const unreachableOutputHost = "http://unreachable-output:9200"
+
+// breakOutput points the default output of Fleet to an unreachable host, keeping its hosts so that
+// they are restored in the teardown of the scenario
+func (fts *FleetTestSuite) breakOutput() error {
+	output, err := fts.suite.fleet.GetDefaultOutput()
+	if err != nil {
+		return err
+	}
+
+	err = fts.suite.fleet.UpdateOutputHosts(output.ID, []string{unreachableOutputHost})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"outputID": output.ID,
+		}).Error("Could not break the output of the agent")
+		return err
+	}
+
+	if fts.OutputID == "" {
+		fts.OutputHosts = output.Hosts
+		fts.OutputID = output.ID
+	}
+	fts.StatusChangedAt = time.Now()
+
+	return nil
+}
+
+// restoreOutput restores the hosts of the default output of Fleet broken by the scenario, if any
+func (fts *FleetTestSuite) restoreOutput() error {
+	if fts.OutputID == "" {
+		return nil
+	}
+
+	err := fts.suite.fleet.UpdateOutputHosts(fts.OutputID, fts.OutputHosts)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"hosts":    fts.OutputHosts,
+			"outputID": fts.OutputID,
+		}).Error("Could not restore the output of the agent")
+		return err
+	}
+
+	fts.OutputHosts = nil
+	fts.OutputID = ""
+	fts.StatusChangedAt = time.Now()
+
+	return nil
+}
+
+// theAgentChecksInToFleetWithStatus waits for a checkin of the agent after its process or its
+// output were changed, with the agent listed in a status, i.e. online once the agent is started
+func (fts *FleetTestSuite) theAgentChecksInToFleetWithStatus(desiredStatus string) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+
+	_, err := fts.suite.waitForAgentCheckin(fts.Hostname, desiredStatus, maxTimeout, func(agent kibana.Agent) error {
+		lastCheckin, err := agent.LastCheckinTime()
+		if err != nil {
+			return err
+		}
+
+		if lastCheckin.Before(fts.StatusChangedAt) {
+			return fmt.Errorf("the agent has not checked in since %s, its last checkin was at %s", fts.StatusChangedAt.Format(time.RFC3339), agent.LastCheckin)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// theAgentIsListedInFleetWithStatusAfterTheCheckinTimeout waits for the agent to be listed in a
+// status once it missed its checkins for longer than the checkin timeout of Fleet, i.e. offline
+// once its process is stopped, checking that the agent did not check in since then
+func (fts *FleetTestSuite) theAgentIsListedInFleetWithStatusAfterTheCheckinTimeout(desiredStatus string) error {
+	maxTimeout := fleetCheckinTimeout + e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+
+	agent, err := fts.suite.waitForAgentCheckin(fts.Hostname, desiredStatus, maxTimeout, nil)
+	if err != nil {
+		return err
+	}
+
+	lastCheckin, err := agent.LastCheckinTime()
+	if err != nil {
+		return err
+	}
+
+	if !fts.StatusChangedAt.IsZero() && lastCheckin.After(fts.StatusChangedAt) {
+		return fmt.Errorf("the agent of the %s hostname is listed as %s, but it checked in at %s, after its process was changed", fts.Hostname, desiredStatus, agent.LastCheckin)
+	}
+
+	log.WithFields(log.Fields{
+		"hostname":         fts.Hostname,
+		"lastCheckin":      agent.LastCheckin,
+		"sinceLastCheckin": time.Since(lastCheckin).Round(time.Second),
+		"status":           desiredStatus,
+	}).Info("The agent missed its checkins")
+
+	return nil
+}
+
+// getFleetServiceName returns the name of the service the agents check in to: the Fleet Server once
+// it's deployed in the scenario, or Kibana otherwise
+func (fts *FleetTestSuite) getFleetServiceName() string {
+	if fts.fleetServerURL() != "" {
+		return FleetServerServiceName
+	}
+
+	return "kibana"
+}
+
+// theAgentLosesConnectivityToFleet partitions the host of the agent from Fleet, so that the agent
+// cannot check in, while it keeps sending its data to Elasticsearch. If a duration is set, i.e. 2m,
+// the connectivity is recovered once it elapses
+func (fts *FleetTestSuite) theAgentLosesConnectivityToFleet(duration string) error {
+	err := fts.Chaos.Partition(fts.Image+"-systemd", fts.getFleetServiceName(), duration)
+	if err != nil {
+		return err
+	}
+
+	fts.StatusChangedAt = time.Now()
+
+	return nil
+}
+
+// theAgentRecoversConnectivityToFleet recovers the connectivity of the host of the agent to Fleet
+func (fts *FleetTestSuite) theAgentRecoversConnectivityToFleet() error {
+	return fts.Chaos.RemovePartition(fts.Image+"-systemd", fts.getFleetServiceName())
+}
+
+// theOutputOfTheAgentIsOperated breaks or restores the default output of Fleet, used by the policy
+// of the agent
+func (fts *FleetTestSuite) theOutputOfTheAgentIsOperated(operation string) error {
+	if operation == "broken" {
+		return fts.breakOutput()
+	} else if operation == "restored" {
+		return fts.restoreOutput()
+	}
+
+	return fmt.Errorf("the output can be broken or restored, not %s", operation)
+}
+
+// waitForAgentCheckin polls the agent of a hostname until it's listed in Fleet in a status, parsing
+// its last checkin, and until an optional condition on the agent is met
+func (sc *SuiteContext) waitForAgentCheckin(hostname string, desiredStatus string, maxTimeout time.Duration, conditionFn func(kibana.Agent) error) (kibana.Agent, error) {
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	var agent kibana.Agent
+	agentCheckinFn := func() error {
+		var err error
+		agent, err = sc.fleet.GetAgentByHostname(hostname)
+		if errors.Is(err, kibana.ErrNotFound) {
+			retryCount++
+			return fmt.Errorf("the agent of the %s hostname: %w", hostname, e2eerrors.ErrAgentNotListed)
+		} else if err != nil {
+			retryCount++
+			return err
+		}
+
+		if !strings.EqualFold(agent.Status, desiredStatus) {
+			err = fmt.Errorf("the agent is listed as %s, not %s yet", agent.Status, desiredStatus)
+		} else if conditionFn != nil {
+			err = conditionFn(agent)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime":       exp.GetElapsedTime(),
+				"hostname":          hostname,
+				"lastCheckin":       agent.LastCheckin,
+				"lastCheckinStatus": agent.LastCheckinStatus,
+				"retries":           retryCount,
+				"status":            agent.Status,
+			}).Warn(err.Error())
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    hostname,
+			"lastCheckin": agent.LastCheckin,
+			"retries":     retryCount,
+			"status":      agent.Status,
+		}).Info("The agent is listed in the desired status")
+		return nil
+	}
+
+	err := backoff.Retry(agentCheckinFn, exp)
+	if err != nil {
+		return kibana.Agent{}, &e2eerrors.StatusTimeoutError{
+			Elapsed:  exp.GetElapsedTime(),
+			Err:      err,
+			Resource: fmt.Sprintf("the agent of the %s hostname", hostname),
+			Status:   desiredStatus,
+		}
+	}
+
+	return agent, nil
+}
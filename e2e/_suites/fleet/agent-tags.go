@@ -0,0 +1,105 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// anAgentIsDeployedToFleetWithInstallerAndTags deploys an agent to Fleet enrolling it with a
+// comma-separated list of tags, i.e. "production,eu-west"
+func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstallerAndTags(image string, installerType string, tags string) error {
+	fts.Tags = parseAgentTags(tags)
+
+	return fts.anAgentIsDeployedToFleetWithInstaller(image, installerType)
+}
+
+// theAgentIsListedInFleetWithTags waits for the agent to be listed in Fleet with a comma-separated
+// list of tags, in any order, failing if the agent has more or less tags
+func (fts *FleetTestSuite) theAgentIsListedInFleetWithTags(tags string) error {
+	desiredTags := parseAgentTags(tags)
+
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute)
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	agentTagsFn := func() error {
+		agent, err := fts.suite.fleet.GetAgentByHostname(fts.Hostname)
+		if err != nil {
+			retryCount++
+			return err
+		}
+
+		if !equalAgentTags(agent.Tags, desiredTags) {
+			err = fmt.Errorf("The agent is listed in Fleet with the %v tags, but it should have the %v tags", agent.Tags, desiredTags)
+
+			log.WithFields(log.Fields{
+				"agentID":     agent.ID,
+				"desiredTags": desiredTags,
+				"elapsedTime": exp.GetElapsedTime(),
+				"hostname":    fts.Hostname,
+				"retry":       retryCount,
+				"tags":        agent.Tags,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"agentID":     agent.ID,
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    fts.Hostname,
+			"retries":     retryCount,
+			"tags":        agent.Tags,
+		}).Info("The agent is listed in Fleet with the tags")
+
+		return nil
+	}
+
+	return backoff.Retry(agentTagsFn, exp)
+}
+
+// equalAgentTags returns if two lists of tags have the same tags, in any order
+func equalAgentTags(tags []string, otherTags []string) bool {
+	if len(tags) != len(otherTags) {
+		return false
+	}
+
+	sorted := append([]string{}, tags...)
+	sort.Strings(sorted)
+
+	otherSorted := append([]string{}, otherTags...)
+	sort.Strings(otherSorted)
+
+	for i := range sorted {
+		if sorted[i] != otherSorted[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseAgentTags returns the tags of a comma-separated list, skipping the empty ones
+func parseAgentTags(tags string) []string {
+	parsed := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			parsed = append(parsed, tag)
+		}
+	}
+
+	return parsed
+}
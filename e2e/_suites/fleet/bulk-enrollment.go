@@ -0,0 +1,264 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// ElasticAgentFleetServiceName the name of the service running the Docker image of the agent,
+// which enrolls the agent into Fleet when its container starts
+const ElasticAgentFleetServiceName = "elastic-agent-fleet"
+
+// bulkAgentsPerPage the number of agents retrieved from Fleet in each request of the status of the
+// agents enrolled in bulk
+const bulkAgentsPerPage = 100
+
+// bulkAgents the agents enrolled in bulk in a scenario, each one in a container of the service of
+// the Docker image of the agent
+type bulkAgents struct {
+	hostnames []string
+}
+
+// agentsAreEnrolled scales the service of the Docker image of the agent to a number of containers,
+// each one enrolling its agent into the policy of the scenario when it starts
+func (fts *FleetTestSuite) agentsAreEnrolled(count string) error {
+	replicas, err := strconv.Atoi(count)
+	if err != nil {
+		return err
+	}
+
+	if fts.BulkAgents != nil {
+		return fmt.Errorf("The agents of the scenario were already enrolled in bulk")
+	}
+
+	enrollmentKey, err := fts.suite.createEnrollmentToken(fts.PolicyID)
+	if err != nil {
+		return err
+	}
+	fts.CurrentToken = enrollmentKey.APIKey
+	fts.CurrentTokenID = enrollmentKey.ID
+
+	fleetURL := fts.fleetServerURL()
+	if fleetURL == "" {
+		fleetURL = getAgentKibanaURL()
+	}
+
+	env := map[string]string{
+		"elasticAgentFleetCA":              "",
+		"elasticAgentFleetEnrollmentToken": fts.CurrentToken,
+		"elasticAgentFleetInsecure":        "1",
+		"elasticAgentFleetTag":             agentVersion,
+		"elasticAgentFleetURL":             fleetURL,
+	}
+	if config.GetCACertPath() != "" {
+		// the certs dir is mounted at /usr/share/elastic-agent/certs
+		env["elasticAgentFleetCA"] = "/usr/share/elastic-agent/certs/ca/ca.crt"
+		env["elasticAgentFleetInsecure"] = "0"
+	}
+	fts.suite.env.put(env)
+
+	// the containers are removed after the scenario, even if they could not be started
+	fts.BulkAgents = &bulkAgents{}
+	fts.Cleanup = true
+
+	serviceManager := services.NewServiceManager()
+	err = serviceManager.ScaleService(FleetProfileName, ElasticAgentFleetServiceName, replicas, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"replicas": replicas,
+			"service":  ElasticAgentFleetServiceName,
+		}).Error("Could not enroll the agents in bulk")
+		return err
+	}
+
+	for number := 1; number <= replicas; number++ {
+		containerName := fmt.Sprintf("%s_%s_%d", config.GetComposeProjectName(FleetProfileName), ElasticAgentFleetServiceName, number)
+
+		hostname, err := getContainerHostname(containerName)
+		if err != nil {
+			return err
+		}
+		fts.BulkAgents.hostnames = append(fts.BulkAgents.hostnames, hostname)
+	}
+
+	log.WithFields(log.Fields{
+		"agents":   replicas,
+		"policyID": fts.PolicyID,
+		"url":      fleetURL,
+	}).Info("The agents are enrolled in bulk")
+
+	return nil
+}
+
+// allTheEnrolledAgentsAreListedInFleetWithStatusWithin waits for all the agents enrolled in bulk in
+// the scenario to be listed in Fleet in a status, retrieving the status of all of them at once in
+// each retry, until a number of seconds elapses
+func (fts *FleetTestSuite) allTheEnrolledAgentsAreListedInFleetWithStatusWithin(desiredStatus string, seconds string) error {
+	if fts.BulkAgents == nil {
+		return fmt.Errorf("There are no agents enrolled in bulk in the scenario")
+	}
+
+	timeout, err := strconv.Atoi(seconds)
+	if err != nil {
+		return err
+	}
+
+	maxTimeout := time.Duration(timeout) * time.Second
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	total := len(fts.BulkAgents.hostnames)
+
+	agentsStatusFn := func() error {
+		count, err := fts.suite.countAgentsOfHostnames(fts.PolicyID, desiredStatus, fts.BulkAgents.hostnames)
+		if err != nil {
+			retryCount++
+			return err
+		}
+
+		if count < total {
+			log.WithFields(log.Fields{
+				"agents":      total,
+				"count":       count,
+				"elapsedTime": exp.GetElapsedTime(),
+				"retry":       retryCount,
+				"status":      desiredStatus,
+			}).Warn("Not all the agents are in the desired status yet")
+
+			retryCount++
+
+			return fmt.Errorf("%d of %d agents are in the %s status", count, total, desiredStatus)
+		}
+
+		log.WithFields(log.Fields{
+			"agents":      total,
+			"elapsedTime": exp.GetElapsedTime(),
+			"retries":     retryCount,
+			"status":      desiredStatus,
+		}).Info("All the agents are in the desired status")
+
+		return nil
+	}
+
+	return backoff.Retry(agentsStatusFn, exp)
+}
+
+// removeBulkAgents un-enrolls the agents enrolled in bulk in the scenario, removing their containers
+func (fts *FleetTestSuite) removeBulkAgents() {
+	if fts.BulkAgents == nil {
+		return
+	}
+
+	err := fts.suite.unenrollAgentsOfHostnames(fts.BulkAgents.hostnames)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"agents": len(fts.BulkAgents.hostnames),
+			"err":    err,
+		}).Warn("The agents enrolled in bulk could not be unenrolled")
+	}
+
+	fts.BulkAgents = nil
+
+	if developerMode {
+		log.WithField("service", ElasticAgentFleetServiceName).Info("Because we are running in development mode, the service won't be stopped")
+		return
+	}
+
+	serviceManager := services.NewServiceManager()
+	err = serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{ElasticAgentFleetServiceName}, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":     err,
+			"service": ElasticAgentFleetServiceName,
+		}).Warn("The agents enrolled in bulk could not be removed")
+	}
+}
+
+// countAgentsOfHostnames returns the number of agents of a list of hostnames which are listed in
+// Fleet in a policy with a status, retrieving all the agents of the policy in that status page by
+// page
+func (sc *SuiteContext) countAgentsOfHostnames(policyID string, status string, hostnames []string) (int, error) {
+	pending := map[string]bool{}
+	for _, hostname := range hostnames {
+		pending[hostname] = true
+	}
+
+	query := kibana.AgentsQuery{
+		Kuery:   kibana.KueryAnd(kibana.AgentsByPolicy(policyID), kibana.AgentsByStatus(status)),
+		PerPage: bulkAgentsPerPage,
+	}
+
+	count := 0
+	for query.Page = 1; ; query.Page++ {
+		agents, err := sc.fleet.ListAgents(query)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, agent := range agents {
+			if pending[agent.Hostname()] {
+				delete(pending, agent.Hostname())
+				count++
+			}
+		}
+
+		if len(agents) < bulkAgentsPerPage {
+			return count, nil
+		}
+	}
+}
+
+// unenrollAgentsOfHostnames force un-enrolls the agents of a list of hostnames, retrieving all the
+// agents listed in Fleet page by page
+func (sc *SuiteContext) unenrollAgentsOfHostnames(hostnames []string) error {
+	unenroll := map[string]bool{}
+	for _, hostname := range hostnames {
+		unenroll[hostname] = true
+	}
+
+	query := kibana.AgentsQuery{
+		PerPage:      bulkAgentsPerPage,
+		ShowInactive: true,
+	}
+
+	agentIDs := []string{}
+	for query.Page = 1; ; query.Page++ {
+		agents, err := sc.fleet.ListAgents(query)
+		if err != nil {
+			return err
+		}
+
+		for _, agent := range agents {
+			if unenroll[agent.Hostname()] && agent.Active {
+				agentIDs = append(agentIDs, agent.ID)
+			}
+		}
+
+		if len(agents) < bulkAgentsPerPage {
+			break
+		}
+	}
+
+	for _, agentID := range agentIDs {
+		err := sc.fleet.UnenrollAgent(agentID, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
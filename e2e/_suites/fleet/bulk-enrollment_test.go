@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeSuiteContext returns the context of a suite whose client of the APIs of Fleet is the one
+// of a fake Kibana, and whose deployer has no provider of boxes
+func newFakeSuiteContext(s *kibanatest.Server) *SuiteContext {
+	return NewSuiteContext(s.Client(), &agentDeployer{env: newProfileEnvironment()})
+}
+
+// addFakeAgents enrolls a number of agents with a status into a policy of a fake Kibana, returning
+// their hostnames, which start with a prefix
+func addFakeAgents(s *kibanatest.Server, policyID string, status string, prefix string, count int) []string {
+	hostnames := []string{}
+	for i := 0; i < count; i++ {
+		agent := kibana.Agent{PolicyID: policyID, Status: status}
+		agent.LocalMetadata.Host.Hostname = fmt.Sprintf("%s-%03d", prefix, i)
+		s.AddAgent(agent)
+
+		hostnames = append(hostnames, agent.LocalMetadata.Host.Hostname)
+	}
+
+	return hostnames
+}
+
+func TestCountAgentsOfHostnamesPagesThroughTheAgents(t *testing.T) {
+	s := kibanatest.NewServer()
+	defer s.Close()
+
+	// more agents than the ones listed in a page, in the same status
+	bulk := addFakeAgents(s, kibanatest.DefaultPolicyID, "online", "bulk", 2*bulkAgentsPerPage+50)
+	addFakeAgents(s, kibanatest.DefaultPolicyID, "online", "other", 10)
+	offline := addFakeAgents(s, kibanatest.DefaultPolicyID, "offline", "offline", 5)
+
+	sc := newFakeSuiteContext(s)
+
+	count, err := sc.countAgentsOfHostnames(kibanatest.DefaultPolicyID, "online", bulk)
+	assert.Nil(t, err)
+	assert.Equal(t, len(bulk), count)
+
+	count, err = sc.countAgentsOfHostnames(kibanatest.DefaultPolicyID, "online", append(bulk[:10], offline...))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, count)
+
+	count, err = sc.countAgentsOfHostnames(kibanatest.DefaultFleetServerPolicyID, "online", bulk)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
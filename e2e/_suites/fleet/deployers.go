@@ -0,0 +1,270 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/deploy"
+	log "github.com/sirupsen/logrus"
+)
+
+// agentDeployer deploys the boxes where the agents under test are installed, running the commands
+// of the lifecycle of the installers in them, with the provider selected with the PROVIDER env var:
+// the containers of the services of the profile, the pods of Kubernetes, or remote hosts reached
+// over SSH
+type agentDeployer struct {
+	env      *profileEnvironment // the environment of the profile of the suite, set by its context
+	provider deploy.Deployer
+}
+
+// the OS of the boxes of the agents
+const (
+	linuxOS   = deploy.LinuxPlatform
+	windowsOS = deploy.WindowsPlatform
+)
+
+// windowsRootDir the dir of the Windows hosts where the artifacts of the agents are copied
+const windowsRootDir = deploy.WindowsRootDir
+
+// newAgentDeployer returns the deployer of the boxes of the agents, with the provider set in the
+// PROVIDER env var, or the remote one if the ELASTIC_AGENT_SSH_HOST env var sets a remote host
+func newAgentDeployer() *agentDeployer {
+	provider, err := deploy.NewFromEnv()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not create the deployer of the agents under test")
+	}
+
+	return &agentDeployer{env: newProfileEnvironment(), provider: provider}
+}
+
+// newContainerDeployer returns the deployer of the containers of the services of the profile,
+// where the stand-alone agents run, no matter the provider of the boxes of the agents under test,
+// sharing the environment of the profile with a deployer
+func newContainerDeployer(d *agentDeployer) *agentDeployer {
+	provider, err := deploy.New(deploy.DockerProvider)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Fatal("Could not create the deployer of the containers")
+	}
+
+	return &agentDeployer{env: d.env, provider: provider}
+}
+
+// boxOS returns the OS of the boxes: linux, or windows for the remote Windows hosts
+func (d *agentDeployer) boxOS() string {
+	return d.provider.Platform()
+}
+
+// boxServices returns the services of the boxes of the installers, sorted, and the environment
+// with their tags, so that their images are pulled with the profile. The boxes which are not
+// containers have no images, so there are no services for them
+func (d *agentDeployer) boxServices(installers map[string]ElasticAgentInstaller) ([]string, map[string]string) {
+	services := []string{}
+	env := map[string]string{}
+	if !d.provider.Disposable() {
+		return services, env
+	}
+
+	for _, installer := range installers {
+		envVarsPrefix := strings.ReplaceAll(installer.service, "-", "_")
+		if _, exists := env[envVarsPrefix+"Tag"]; exists {
+			continue
+		}
+
+		env[envVarsPrefix+"Tag"] = installer.tag
+		services = append(services, installer.service)
+	}
+	sort.Strings(services)
+
+	return services, env
+}
+
+// deploy brings the box of an installer up, with the artifact of the agent at its root dir
+func (d *agentDeployer) deploy(installer ElasticAgentInstaller, containerName string) error {
+	service := installer.service // name of the service
+	serviceTag := installer.tag  // docker tag of the service
+
+	envVarsPrefix := strings.ReplaceAll(service, "-", "_")
+
+	d.env.put(map[string]string{
+		// let's start with Centos 7
+		envVarsPrefix + "Tag": serviceTag,
+		// we are setting the container name because Centos service could be reused by any other test suite
+		envVarsPrefix + "ContainerName": containerName,
+	})
+
+	request := d.serviceRequest(installer.host)
+	request.Container = containerName
+
+	err := d.provider.Add(e2e.ScenarioContext(), request)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service": service,
+			"tag":     serviceTag,
+		}).Error("Could not run the target box")
+		return err
+	}
+
+	return d.provider.AddFiles(e2e.ScenarioContext(), request, map[string]string{installer.name: installer.path})
+}
+
+// copyFrom copies a file of the box of a host to a local path
+func (d *agentDeployer) copyFrom(host *agentHost, path string, localPath string) error {
+	return d.provider.CopyFileFrom(e2e.ScenarioContext(), d.serviceRequest(host), path, localPath)
+}
+
+// exec executes a command in the box of a host, failing if the command fails
+func (d *agentDeployer) exec(host *agentHost, cmds []string, detach bool) error {
+	_, err := d.provider.Exec(e2e.ScenarioContext(), d.serviceRequest(host), cmds, deploy.ExecOptions{Detach: detach})
+	return err
+}
+
+// output executes a command in a box, returning its output, including the errors of the command
+func (d *agentDeployer) output(containerName string, cmds []string) (string, error) {
+	request := deploy.ServiceRequest{Container: containerName, Env: d.env.get(), Profile: FleetProfileName}
+
+	return d.provider.Exec(e2e.ScenarioContext(), request, cmds, deploy.ExecOptions{IgnoreExitCode: true})
+}
+
+// remove destroys the box of an installer, or removes the agent from it when the provider reuses
+// the boxes
+func (d *agentDeployer) remove(installer ElasticAgentInstaller) error {
+	if !d.provider.Disposable() {
+		return d.uninstall(installer)
+	}
+
+	return d.provider.Remove(e2e.ScenarioContext(), d.serviceRequest(installer.host))
+}
+
+// restart restarts the box of an installer, waiting for it to be back
+func (d *agentDeployer) restart(installer ElasticAgentInstaller) error {
+	return d.provider.Restart(e2e.ScenarioContext(), d.serviceRequest(installer.host))
+}
+
+// uninstall uninstalls the agent from the box of an installer, and removes its artifact, so that
+// the box can be reused by the next scenario
+func (d *agentDeployer) uninstall(installer ElasticAgentInstaller) error {
+	var uninstall []string
+	switch installer.installerType {
+	case "rpm":
+		uninstall = []string{"yum", "remove", "-y", ElasticAgentProcessName}
+	case "deb":
+		uninstall = []string{"apt-get", "purge", "-y", ElasticAgentProcessName}
+	case "msi":
+		uninstall = msiexecScript("/x", windowsRootDir+installer.name)
+	default:
+		uninstall = []string{installer.binaryPath, "uninstall", "-f"}
+	}
+
+	// the agent could not be installed, so the errors of the uninstall are ignored
+	_, err := d.output("", uninstall)
+	if err != nil {
+		return err
+	}
+
+	if d.boxOS() == windowsOS {
+		paths := []string{}
+		for _, path := range []string{windowsRootDir + installer.name, windowsRootDir + ElasticAgentProcessName, installer.workingDir} {
+			paths = append(paths, deploy.PowershellQuote(path))
+		}
+
+		return d.exec(installer.host, powershellScript("Remove-Item -Recurse -Force -ErrorAction SilentlyContinue -Path "+strings.Join(paths, ", ")), false)
+	}
+
+	return d.exec(installer.host, []string{"rm", "-rf", "/" + installer.name, "/elastic-agent", installer.workingDir}, false)
+}
+
+// serviceRequest returns the request of the service of the box of a host
+func (d *agentDeployer) serviceRequest(host *agentHost) deploy.ServiceRequest {
+	return deploy.ServiceRequest{
+		Container: host.container,
+		Env:       d.env.get(),
+		Name:      host.service,
+		Profile:   host.profile,
+	}
+}
+
+// checkSeveralAgentsSupported fails if the deployer does not support deploying several agents in
+// a scenario, which is only supported by the providers whose boxes are disposable, i.e. containers
+func (d *agentDeployer) checkSeveralAgentsSupported() error {
+	if !d.provider.Disposable() {
+		return fmt.Errorf("Deploying several agents in a scenario is not supported by a provider reusing the boxes")
+	}
+
+	return nil
+}
+
+// getAgentHostname returns the hostname of the box of the agent under test, deployed by the deployer
+func (d *agentDeployer) getAgentHostname(containerName string) (string, error) {
+	cmd := []string{"cat", "/etc/hostname"}
+	if d.boxOS() == windowsOS {
+		cmd = []string{"hostname"}
+	}
+
+	hostname, err := d.output(containerName, cmd)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"containerName": containerName,
+			"error":         err,
+		}).Error("Could not retrieve the hostname of the box")
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"containerName": containerName,
+		"hostname":      hostname,
+	}).Info("Hostname of the box retrieved")
+
+	return hostname, nil
+}
+
+// listFilesCmd returns the command listing the files under a dir of the boxes of the deployer,
+// recursively, with their full path in a line each
+func (d *agentDeployer) listFilesCmd(dir string) []string {
+	if d.boxOS() == windowsOS {
+		return []string{"cmd", "/c", "dir", "/s", "/b", "/a-d", dir}
+	}
+
+	return []string{"find", dir, "-type", "f"}
+}
+
+// powershellScript returns the command running a PowerShell script in the Windows boxes, for the
+// pipelines and the expressions which cannot be run as a command with its args
+func powershellScript(script string) []string {
+	return []string{"Invoke-Expression", script}
+}
+
+// readFileCmd returns the command printing a file of the boxes of the deployer, or its last lines
+// if the number of lines is greater than zero
+func (d *agentDeployer) readFileCmd(path string, lines int) []string {
+	if d.boxOS() == windowsOS {
+		if lines > 0 {
+			return []string{"Get-Content", "-Tail", strconv.Itoa(lines), path}
+		}
+		return []string{"Get-Content", "-Raw", path}
+	}
+
+	if lines > 0 {
+		return []string{"tail", "-n", strconv.Itoa(lines), path}
+	}
+	return []string{"cat", path}
+}
+
+// msiexecScript returns the command running msiexec with an action over a MSI package in the Windows
+// boxes, i.e. /i to install it or /x to uninstall it, waiting for it to finish, as msiexec returns
+// right away when it's called from PowerShell
+func msiexecScript(action string, msiPath string) []string {
+	return powershellScript(fmt.Sprintf(
+		"$p = Start-Process -FilePath msiexec.exe -ArgumentList '%s', '%s', '/qn', '/norestart' -Wait -PassThru; if ($p.ExitCode) { throw \"msiexec exited with $($p.ExitCode)\" }",
+		action, strings.ReplaceAll(msiPath, "'", "''")))
+}
@@ -0,0 +1,238 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/deploy"
+	log "github.com/sirupsen/logrus"
+)
+
+// diagnosticsBundleName the name of the diagnostics bundle of the agents, in their box and in the
+// outputs dir of the scenario, where its key files are unpacked into a dir named after it
+const diagnosticsBundleName = "elastic-agent-diagnostics.zip"
+
+// diagnosticsBundle the diagnostics bundle of an agent, collected by the agent, and copied with its
+// key files unpacked into the outputs dir of the scenario
+type diagnosticsBundle struct {
+	components []string // the components run by the agent when the bundle was collected
+	dir        string   // the dir where the key files of the bundle were unpacked
+	path       string   // the local path of the bundle
+}
+
+// contains reports if the bundle contains a component by its name, i.e. filebeat, matching the
+// components running an input with an output, i.e. filebeat-default, or log-default
+func (b *diagnosticsBundle) contains(name string) bool {
+	for _, component := range b.components {
+		if component == name || strings.HasPrefix(component, name+"-") || strings.HasPrefix(component, name+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectDiagnosticsBundle collects the diagnostics bundle of the agent in its box, copying it to the
+// outputs dir of a scenario, where its key files are unpacked: the metadata, the configs, and the
+// state of the agent and of its components, but not their logs nor their profiles
+func (i *ElasticAgentInstaller) collectDiagnosticsBundle(scenario string) (*diagnosticsBundle, error) {
+	outputsDir, err := e2e.GetScenarioOutputsDir(scenario)
+	if err != nil {
+		return nil, err
+	}
+
+	boxPath := "/tmp/" + diagnosticsBundleName
+	remove := []string{"rm", "-f", boxPath}
+	if i.host.os == windowsOS {
+		boxPath = windowsRootDir + diagnosticsBundleName
+		remove = powershellScript("Remove-Item -Force -ErrorAction SilentlyContinue -Path " + deploy.PowershellQuote(boxPath))
+	}
+
+	// the agent does not overwrite the bundle of a previous scenario reusing the box
+	err = i.host.deployer.exec(i.host, remove, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = i.host.deployer.exec(i.host, []string{i.binaryPath, "diagnostics", "collect", "--file", boxPath}, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": i.service,
+		}).Error("Could not collect the diagnostics bundle of the agent")
+		return nil, err
+	}
+
+	if i.host.os != windowsOS {
+		// the bundle is only readable by root, and the user of the remote hosts could be another one
+		err = i.host.deployer.exec(i.host, []string{"chmod", "0644", boxPath}, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bundle := &diagnosticsBundle{
+		dir:  filepath.Join(outputsDir, strings.TrimSuffix(diagnosticsBundleName, ".zip")),
+		path: filepath.Join(outputsDir, diagnosticsBundleName),
+	}
+
+	err = i.host.deployer.copyFrom(i.host, boxPath, bundle.path)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.components, err = unpackDiagnosticsBundle(bundle.path, bundle.dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"bundle": bundle.path,
+			"error":  err,
+		}).Error("Could not unpack the diagnostics bundle of the agent")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"bundle":     bundle.path,
+		"components": bundle.components,
+		"service":    i.service,
+	}).Debug("The diagnostics bundle of the agent has been collected")
+
+	return bundle, nil
+}
+
+// unpackDiagnosticsBundle unpacks the key files of a diagnostics bundle into a dir, returning the
+// components of the agent in the bundle, sorted by name. The agents since 8.6 keep the files of each
+// component in a dir named after it, i.e. components/log-default, while the former ones keep the
+// config of each application with an output in the metadata, i.e. meta/filebeat-default.yaml
+func unpackDiagnosticsBundle(bundlePath string, dir string) ([]string, error) {
+	reader, err := zip.OpenReader(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	components := map[string]bool{}
+	for _, file := range reader.File {
+		name := path.Clean(file.Name)
+		if strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("The diagnostics bundle contains a file out of its root: %s", file.Name)
+		}
+
+		parts := strings.Split(name, "/")
+		if len(parts) > 2 && parts[0] == "components" {
+			components[parts[1]] = true
+		} else if len(parts) == 2 && parts[0] == "meta" && path.Ext(name) == ".yaml" && parts[1] != "elastic-agent-version.yaml" {
+			components[strings.TrimSuffix(parts[1], ".yaml")] = true
+		}
+
+		if file.FileInfo().IsDir() || !isDiagnosticsKeyFile(name) {
+			continue
+		}
+
+		err := unpackFile(file, filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	names := []string{}
+	for component := range components {
+		names = append(names, component)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// isDiagnosticsKeyFile reports if a file of a diagnostics bundle is unpacked: the YAML and JSON
+// files, and the text files, out of the logs of the agent
+func isDiagnosticsKeyFile(name string) bool {
+	if strings.HasPrefix(name, "logs/") || strings.Contains(name, "/logs/") {
+		return false
+	}
+
+	switch path.Ext(name) {
+	case ".json", ".txt", ".yaml", ".yml":
+		return true
+	}
+
+	return false
+}
+
+// unpackFile writes a file of a zip archive to a local path, creating its parent dirs
+func unpackFile(file *zip.File, localPath string) error {
+	err := os.MkdirAll(filepath.Dir(localPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// theDiagnosticsBundleOfTheAgentIsCollected collects the diagnostics bundle of the agent under test
+// into the outputs dir of the scenario
+func (fts *FleetTestSuite) theDiagnosticsBundleOfTheAgentIsCollected() error {
+	if fts.Image == "" {
+		return errors.New("There is no agent under test to collect its diagnostics bundle")
+	}
+
+	installer := fts.getInstaller()
+
+	bundle, err := installer.collectDiagnosticsBundle(fts.ScenarioName)
+	if err != nil {
+		return err
+	}
+
+	fts.Diagnostics = bundle
+
+	return nil
+}
+
+// theDiagnosticsBundleOfTheAgentContainsTheComponents checks that the diagnostics bundle of the agent
+// contains a comma-separated list of components, collecting the bundle if the scenario did not
+func (fts *FleetTestSuite) theDiagnosticsBundleOfTheAgentContainsTheComponents(components string) error {
+	if fts.Diagnostics == nil {
+		err := fts.theDiagnosticsBundleOfTheAgentIsCollected()
+		if err != nil {
+			return err
+		}
+	}
+
+	missing := []string{}
+	for _, component := range strings.Split(components, ",") {
+		component = strings.TrimSpace(component)
+		if component != "" && !fts.Diagnostics.contains(component) {
+			missing = append(missing, component)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("The diagnostics bundle of the agent does not contain the %s components, but: %s", strings.Join(missing, ", "), strings.Join(fts.Diagnostics.components, ", "))
+	}
+
+	return nil
+}
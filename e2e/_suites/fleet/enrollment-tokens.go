@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// agentIsDeployedToFleetWithInstallerUsingNewTokenForPolicy deploys an agent with a name in the
+// version under test, enrolling it into a policy of the scenario with an enrollment token created
+// for the agent, instead of the token shared by the agents of the policy
+func (fts *FleetTestSuite) agentIsDeployedToFleetWithInstallerUsingNewTokenForPolicy(name string, image string, installerType string, policyName string) error {
+	policyID, err := fts.getPolicyID(policyName)
+	if err != nil {
+		return err
+	}
+
+	enrollmentKey, err := fts.suite.createEnrollmentToken(policyID)
+	if err != nil {
+		return err
+	}
+	// the token is deleted in the teardown of the scenario, even if the agent is not deployed
+	fts.TokenIDs = append(fts.TokenIDs, enrollmentKey.ID)
+
+	return fts.deployNamedAgent(name, image, installerType, policyName, enrollmentKey.APIKey)
+}
+
+// createEnrollmentToken creates an enrollment token for a policy, checking it's listed in the
+// tokens of the policy, and returns it with the secret the agents are enrolled with
+func (sc *SuiteContext) createEnrollmentToken(policyID string) (kibana.EnrollmentAPIKey, error) {
+	enrollmentKey, err := sc.fleet.CreateEnrollmentAPIKey("Test token for "+uuid.New().String(), policyID)
+	if err != nil {
+		return kibana.EnrollmentAPIKey{}, err
+	}
+
+	keys, err := sc.fleet.ListEnrollmentAPIKeys(policyID)
+	if err != nil {
+		return enrollmentKey, err
+	}
+
+	listed := false
+	for _, key := range keys {
+		if key.ID == enrollmentKey.ID {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return enrollmentKey, fmt.Errorf("The %s enrollment token is not listed in the tokens of the %s policy", enrollmentKey.ID, policyID)
+	}
+
+	secret, err := sc.fleet.GetEnrollmentAPIKeySecret(enrollmentKey.ID)
+	if err != nil {
+		return enrollmentKey, err
+	}
+	enrollmentKey.APIKey = secret
+
+	log.WithFields(log.Fields{
+		"policyID": policyID,
+		"tokenID":  enrollmentKey.ID,
+	}).Debug("The enrollment token was created")
+
+	return enrollmentKey, nil
+}
+
+// removeTokens deletes the enrollment tokens created for single agents of the scenario, once
+// their agents were un-enrolled
+func (fts *FleetTestSuite) removeTokens() {
+	for _, tokenID := range fts.TokenIDs {
+		err := fts.suite.fleet.DeleteEnrollmentAPIKey(tokenID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":     err,
+				"tokenID": tokenID,
+			}).Warn("The enrollment token could not be deleted")
+		}
+	}
+
+	fts.TokenIDs = nil
+}
@@ -0,0 +1,62 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateEnrollmentToken(t *testing.T) {
+	versions := []string{kibanatest.DefaultVersion, "7.16.0-SNAPSHOT"}
+
+	for _, version := range versions {
+		t.Run(version, func(t *testing.T) {
+			s := kibanatest.NewServer()
+			defer s.Close()
+
+			s.SetVersion(version)
+
+			sc := newFakeSuiteContext(s)
+
+			enrollmentKey, err := sc.createEnrollmentToken(kibanatest.DefaultPolicyID)
+			assert.Nil(t, err)
+			assert.NotEmpty(t, enrollmentKey.APIKey)
+			assert.Equal(t, kibanatest.DefaultPolicyID, enrollmentKey.PolicyID)
+
+			keys, err := sc.fleet.ListEnrollmentAPIKeys(kibanatest.DefaultPolicyID)
+			assert.Nil(t, err)
+			if assert.Equal(t, 1, len(keys)) {
+				assert.Equal(t, enrollmentKey.ID, keys[0].ID)
+			}
+		})
+	}
+}
+
+func TestRemoveTokensRevokesTheTokensOfTheScenario(t *testing.T) {
+	s := kibanatest.NewServer()
+	defer s.Close()
+
+	sc := newFakeSuiteContext(s)
+
+	fts := &FleetTestSuite{suite: sc}
+	for i := 0; i < 2; i++ {
+		enrollmentKey, err := sc.createEnrollmentToken(kibanatest.DefaultPolicyID)
+		assert.Nil(t, err)
+
+		fts.TokenIDs = append(fts.TokenIDs, enrollmentKey.ID)
+	}
+	tokenIDs := fts.TokenIDs
+
+	fts.removeTokens()
+	assert.Empty(t, fts.TokenIDs)
+
+	for _, tokenID := range tokenIDs {
+		_, err := sc.fleet.GetEnrollmentAPIKeySecret(tokenID)
+		assert.NotNil(t, err, tokenID)
+	}
+}
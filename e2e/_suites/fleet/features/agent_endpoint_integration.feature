@@ -8,7 +8,13 @@ Scenario: Adding the Endpoint Integration to an Agent makes the host to show in
     And the agent is listed in Fleet as "online"
   When the "Endpoint Security" integration is "added" in the policy
   Then the "Endpoint Security" datasource is shown in the policy as added
+    And the agent acknowledges the policy change
     And the host name is shown in the Administration view in the Security App as "online"
+    And the processes are in the state on the host:
+      | process          | state   |
+      | elastic-endpoint | started |
+      | filebeat         | started |
+      | metricbeat       | started |
 
 @endpoint-policy-check
 Scenario: Deploying an Endpoint makes policies to appear in the Security App
@@ -21,6 +27,19 @@ Scenario: Changing an Agent policy is reflected in the Security App
   When the policy is updated to have "malware" in "detect" mode
   Then the policy will reflect the change in the Security App
 
+@set-policy-and-check-policy-response
+Scenario: Changing the protection mode of an Endpoint policy is applied by Endpoint
+  Given an Endpoint is successfully deployed with a "centos" Agent using "tar" installer
+  When the policy is updated to have "malware" in "prevent" mode
+  Then the updated policy is applied in the Security App
+
+@disable-events-and-check-policy-response
+Scenario: Disabling the collection of events in an Endpoint policy is applied by Endpoint
+  Given an Endpoint is successfully deployed with a "centos" Agent using "tar" installer
+  When the policy is updated to have the "network" events "disabled"
+    And the policy is updated to have the "file" events "disabled"
+  Then the updated policy is applied in the Security App
+
 @deploy-endpoint-then-unenroll-agent
 Scenario: Un-enrolling Elastic Agent stops Elastic Endpoint
   Given an Endpoint is successfully deployed with a "centos" Agent using "tar" installer
@@ -34,5 +53,10 @@ Scenario: Removing Endpoint from Agent policy stops the connected Endpoint
   Given an Endpoint is successfully deployed with a "centos" Agent using "tar" installer
   When the "Endpoint Security" integration is "removed" in the policy
   Then the agent is listed in Fleet as "online"
+    And the agent acknowledges the policy change
     But the host name is not shown in the Administration view in the Security App
-    And the "elastic-endpoint" process is in the "stopped" state on the host
+    And the processes are in the state on the host:
+      | process          | state   |
+      | elastic-endpoint | stopped |
+      | filebeat         | started |
+      | metricbeat       | started |
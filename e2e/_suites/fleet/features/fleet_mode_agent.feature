@@ -10,6 +10,8 @@ Scenario Outline: Deploying the <os> agent
     And the "metricbeat" process is in the "started" state on the host
     And the agent is listed in Fleet as "online"
     And system package dashboards are listed in Fleet
+    And the "System" integration dashboards are installed
+    And the "System" integration ingest pipelines are installed
 Examples:
 | os     |
 | centos |
@@ -28,6 +30,17 @@ Examples:
 | centos |
 | debian |
 
+@diagnostics
+Scenario Outline: Collecting the diagnostics bundle of the <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the diagnostics bundle of the agent is collected
+  Then the diagnostics bundle of the agent contains the "filebeat, metricbeat" components
+Examples:
+| os     |
+| centos |
+| debian |
+
 @stop-agent
 Scenario Outline: Stopping the <os> agent stops backend processes
   Given a "<os>" agent is deployed to Fleet with "tar" installer
@@ -39,16 +52,58 @@ Examples:
 | centos |
 | debian |
 
-# @upgrade-agent
-@skip
+@agent-status
+Scenario Outline: Transitioning the status of the <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the "elastic-agent" process is "stopped" on the host
+  Then the agent is listed in Fleet as "offline" after the checkin timeout
+    And the "elastic-agent" process is "started" on the host
+    And the agent checks in to Fleet as "online"
+    And the output of the agent is broken
+    And the agent checks in to Fleet as "degraded"
+    And the output of the agent is restored
+    And the agent checks in to Fleet as "online"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@network-partition
+Scenario Outline: Recovering the <os> agent from a network partition with Fleet
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the agent loses connectivity to Fleet
+  Then the agent is listed in Fleet as "offline" after the checkin timeout
+    And the agent recovers connectivity to Fleet
+    And the agent checks in to Fleet as "online"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@network-partition
+Scenario Outline: Recovering the <os> agent from a short loss of connectivity to Fleet
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the agent loses connectivity to Fleet for "2m"
+  Then the agent checks in to Fleet as "online"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@upgrade-agent
 Scenario Outline: Upgrading the installed <os> agent
-  Given a "<os>" agent "stale" is deployed to Fleet with "tar" installer
+  Given a "<os>" agent "N-1" is deployed to Fleet with "tar" installer
     And certs for "<os>" are installed
   When agent is upgraded to version "latest"
   Then agent is in version "latest"
+    And the agent stays listed in Fleet as "online" for "60" seconds
 Examples:
-| os     | 
-| debian | 
+| os     |
+| centos |
+| debian |
 
 @restart-agent
 Scenario Outline: Restarting the installed <os> agent
@@ -74,6 +129,37 @@ Examples:
 | centos |
 | debian |
 
+@configure-integration
+Scenario Outline: Configuring an integration of the policy of the <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When I configure the "System" integration with:
+    | setting                          | value                 |
+    | logfile.system.auth.enabled      | false                 |
+    | logfile.system.syslog.paths      | ["/var/log/messages"] |
+    | system/metrics.system.cpu.period | 30s                   |
+  Then the agent stays listed in Fleet as "online" for "30" seconds
+    And the "metricbeat" process is in the "started" state on the host
+Examples:
+| os     |
+| centos |
+| debian |
+
+@add-integration
+Scenario Outline: Adding an integration with settings to the policy of the <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the "Nginx" integration is added to the policy with:
+    | setting                    | value                         |
+    | nginx/metrics.enabled      | false                         |
+    | logfile.nginx.access.paths | ["/var/log/nginx/access.log"] |
+  Then the agent stays listed in Fleet as "online" for "30" seconds
+    And the "filebeat" process is in the "started" state on the host
+Examples:
+| os     |
+| centos |
+| debian |
+
 @unenroll
 Scenario Outline: Un-enrolling the <os> agent
   Given a "<os>" agent is deployed to Fleet with "tar" installer
@@ -87,6 +173,44 @@ Examples:
 | centos |
 | debian |
 
+@unenroll-stops-data
+Scenario Outline: Un-enrolling the <os> agent stops sending data
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the agent is un-enrolled
+  Then the agent is listed in Fleet as "inactive"
+    And the agent stops sending data to the data streams
+Examples:
+| os     |
+| centos |
+| debian |
+
+@unenroll-stopped-agent
+Scenario Outline: Un-enrolling the stopped <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+    And the "elastic-agent" process is "stopped" on the host
+  When the agent is un-enrolled
+  Then the agent is listed in Fleet as "unenrolling"
+    And the agent stays listed in Fleet as "unenrolling" for "30" seconds
+Examples:
+| os     |
+| centos |
+| debian |
+
+@force-unenroll-stopped-agent
+Scenario Outline: Force un-enrolling the stopped <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+    And the "elastic-agent" process is "stopped" on the host
+  When the agent is force un-enrolled
+  Then the agent is listed in Fleet as "inactive"
+    And the agent stops sending data to the data streams
+Examples:
+| os     |
+| centos |
+| debian |
+
 @reenroll
 Scenario Outline: Re-enrolling the <os> agent
   Given a "<os>" agent is deployed to Fleet with "tar" installer
@@ -104,7 +228,9 @@ Examples:
 Scenario Outline: Revoking the enrollment token for the <os> agent
   Given a "<os>" agent is deployed to Fleet with "tar" installer
   When the enrollment token is revoked
-  Then an attempt to enroll a new agent fails
+  Then the enrollment token is listed in Fleet as revoked
+    And an attempt to enroll a new agent fails
+    And the agent is listed in Fleet as "online"
 Examples:
 | os     |
 | centos |
@@ -123,3 +249,112 @@ Examples:
 | os     |
 | centos |
 | debian |
+
+@mixed-versions
+Scenario Outline: Enrolling <os> agents of several versions into the same policy
+  Given "<os>" agents in versions "N, N-1, N-2" are deployed to Fleet with "systemd" installer
+  When all the agents are listed in Fleet as "online"
+  Then all the agents are listed in Fleet in their versions
+    And the upgrade is only available for the agents older than the stack
+    And there is data from all the agents in the "metrics-*" index
+Examples:
+| os     |
+| centos |
+| debian |
+
+@multiple-policies
+Scenario Outline: Enrolling <os> agents into different policies
+  Given a policy "B" is created
+    And agent "A" is deployed to Fleet on "<os>" with "systemd" installer
+    And agent "B" is deployed to Fleet on "<os>" with "systemd" installer into policy "B"
+  When agent "A" is listed in Fleet as "online"
+    And agent "B" is listed in Fleet as "online"
+  Then agent "A" is assigned to policy "default"
+    And agent "B" is assigned to policy "B"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@enrollment-token-per-agent
+Scenario Outline: Enrolling <os> agents with their own enrollment tokens
+  Given a policy "B" is created
+    And agent "A" is deployed to Fleet on "<os>" with "systemd" installer using a newly created enrollment token for policy "B"
+    And agent "B" is deployed to Fleet on "<os>" with "systemd" installer using a newly created enrollment token for policy "B"
+  When agent "A" is listed in Fleet as "online"
+    And agent "B" is listed in Fleet as "online"
+  Then agent "A" is assigned to policy "B"
+    And agent "B" is assigned to policy "B"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@reassign-policy
+Scenario Outline: Reassigning one of the <os> agents to another policy
+  Given a policy "B" is created
+    And agent "A" is deployed to Fleet on "<os>" with "systemd" installer
+    And agent "B" is deployed to Fleet on "<os>" with "systemd" installer
+    And agent "A" is listed in Fleet as "online"
+  When agent "A" is reassigned to policy "B"
+  Then agent "A" is assigned to policy "B"
+    And agent "A" is listed in Fleet as "online"
+    And agent "B" is assigned to policy "default"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@unenroll-one-agent
+Scenario Outline: Un-enrolling one of the <os> agents
+  Given agent "A" is deployed to Fleet on "<os>" with "systemd" installer
+    And agent "B" is deployed to Fleet on "<os>" with "systemd" installer
+    And agent "A" is listed in Fleet as "online"
+  When agent "A" is un-enrolled
+  Then agent "A" is listed in Fleet as "inactive"
+    And agent "B" is listed in Fleet as "online"
+Examples:
+| os     |
+| centos |
+| debian |
+
+@enroll-with-tags
+Scenario Outline: Deploying the <os> agent with tags using <installer> installer
+  Given a "<os>" agent is deployed to Fleet with "<installer>" installer and tags "e2e,<os>"
+  When the agent is listed in Fleet as "online"
+  Then the agent is listed in Fleet with tags "e2e,<os>"
+Examples:
+| os     | installer |
+| centos | systemd   |
+| debian | tar       |
+
+@agent-metadata
+Scenario Outline: Reporting the metadata of the <os> agent and its host using <installer> installer
+  Given a "<os>" agent is deployed to Fleet with "<installer>" installer
+  When the agent is listed in Fleet as "online"
+  Then the local metadata of the agent has "os.family" as "<family>"
+    And the local metadata of the agent reports the architecture of its host
+    And the local metadata of the agent reports the version and build hash under test
+Examples:
+| os     | installer | family |
+| centos | tar       | redhat |
+| centos | systemd   | redhat |
+| debian | tar       | debian |
+| debian | systemd   | debian |
+@logstash-output
+Scenario Outline: Deploying the <os> agent sending its data to Logstash
+  Given a Logstash output is added to Fleet
+    And the policy of the agent uses the Logstash output
+  When a "<os>" agent is deployed to Fleet with "tar" installer
+  Then the agent is listed in Fleet as "online"
+    And there is data from the agent in the "logs-elastic_agent-default" data stream through Logstash
+    And there is data from the agent in the "metrics-system.cpu-default" data stream through Logstash
+Examples:
+| os     |
+| centos |
+| debian |
+@package-registry
+Scenario: The integrations used by the scenarios are available in the Package Registry
+  Then the "System" integration is available in the Package Registry
+    And the "Elastic Agent" integration is available in the Package Registry
+    And the "Endpoint Security" integration is available in the Package Registry
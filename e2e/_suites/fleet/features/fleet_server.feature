@@ -0,0 +1,52 @@
+@fleet_server
+Feature: Fleet Server
+  Scenarios for the Agent in Fleet mode enrolling into a Fleet Server, which is bootstrapped with a
+  service token, instead of into Kibana.
+
+@deploy-fleet-server
+Scenario: Deploying a Fleet Server
+  When a Fleet Server is deployed
+  Then the Fleet Server is listed in Fleet as "online"
+
+@install
+Scenario Outline: Deploying the <os> agent into the Fleet Server
+  Given a Fleet Server is deployed
+  When a "<os>" agent is deployed to Fleet with "tar" installer
+  Then the "elastic-agent" process is in the "started" state on the host
+    And the "filebeat" process is in the "started" state on the host
+    And the "metricbeat" process is in the "started" state on the host
+    And the agent is listed in Fleet as "online"
+    And system package dashboards are listed in Fleet
+Examples:
+| os     |
+| centos |
+| debian |
+
+@enroll
+Scenario Outline: Deploying the <os> agent with enroll into the Fleet Server
+  Given a Fleet Server is deployed
+  When a "<os>" agent is deployed to Fleet with "systemd" installer
+  Then the "elastic-agent" process is in the "started" state on the host
+    And the agent is listed in Fleet as "online"
+Examples:
+| os     |
+| centos |
+| debian |
+
+
+@fleet-server-scaling
+Scenario Outline: Killing one of the Fleet Servers behind a load balancer with <os> agents
+  Given "2" Fleet Servers are deployed behind a load balancer
+    And "5" agents are deployed to Fleet on "<os>" with "tar" installer
+    And all the agents are listed in Fleet as "online"
+  When one of the Fleet Servers is killed
+  Then all the agents stay listed in Fleet as "online" for "300" seconds
+Examples:
+| os     |
+| centos |
+
+@bulk-enrollment
+Scenario: Enrolling agents in bulk into the Fleet Server
+  Given a Fleet Server is deployed
+  When "50" agents are enrolled
+  Then all the enrolled agents are listed in Fleet as "online" within "600" seconds
@@ -0,0 +1,16 @@
+@stack_upgrade
+Feature: Stack Upgrade
+  Scenarios upgrading Elasticsearch and Kibana in place, keeping their data, while the agents enrolled in Fleet keep running.
+  They upgrade the stack under test to the version in the STACK_UPGRADE_VERSION env var, restoring it afterwards.
+
+Scenario Outline: Upgrading the stack under a running <os> agent
+  Given a "<os>" agent is deployed to Fleet with "tar" installer
+    And the agent is listed in Fleet as "online"
+  When the stack is upgraded to "next"
+  Then the agent is listed in Fleet as "online"
+    And the "elastic-agent" process is in the "started" state on the host
+    And there is new data in the "metrics-*" index after the stack is upgraded
+Examples:
+| os     |
+| centos |
+| debian |
@@ -32,3 +32,68 @@ Examples:
 | image   |
 | default |
 | ubi8    |
+
+@install-stand-alone
+Scenario Outline: Installing a stand-alone agent with the <installer> package in a <image> box
+  When a "<image>" stand-alone agent is deployed with "<installer>" installer
+  Then the processes are in the state on the host:
+      | process    | state   |
+      | filebeat   | started |
+      | metricbeat | started |
+    And there is new data in the index from agent
+Examples:
+| image       | installer |
+| amazonlinux | rpm       |
+| amazonlinux | tar       |
+| centos      | rpm       |
+| centos      | tar       |
+| debian      | deb       |
+| debian      | tar       |
+| ubuntu      | deb       |
+| ubuntu      | tar       |
+
+@custom-config-stand-alone
+Scenario Outline: Deploying a <image> stand-alone agent with a custom output and input
+  Given the stand-alone agent is configured with the output:
+      | setting               | value                 |
+      | hosts                 | ${ELASTICSEARCH_HOST} |
+      | username              | elastic               |
+      | password              | changeme              |
+      | ssl.verification_mode | none                  |
+    And the stand-alone agent is configured with the input:
+      """
+      id: e2e-custom-logs
+      type: logfile
+      use_output: default
+      data_stream.namespace: default
+      streams:
+        - data_stream:
+            dataset: e2e.custom
+          paths:
+            - /var/log/*.log
+      """
+  When a "<image>" stand-alone agent is deployed
+  Then there is new data in the index from agent
+Examples:
+| image   |
+| default |
+
+@logstash-output-stand-alone
+Scenario Outline: Deploying a <image> stand-alone agent sending its data to Logstash
+  Given the stand-alone agent sends its data to Logstash
+  When a "<image>" stand-alone agent is deployed
+  Then there is data from the stand-alone agent in the "logs-elastic_agent-default" data stream through Logstash
+    And there is data from the stand-alone agent in the "metrics-system.cpu-default" data stream through Logstash
+Examples:
+| image   |
+| default |
+
+@kubernetes-daemonset
+Scenario Outline: Deploying a <image> stand-alone agent as a DaemonSet in Kubernetes
+  When a "<image>" stand-alone agent is deployed as a DaemonSet in Kubernetes
+  Then there is new data in the "metrics-kubernetes.container-default" data stream from the DaemonSet
+    And there is new data in the "metrics-kubernetes.pod-default" data stream from the DaemonSet
+    And there is new data in the "logs-kubernetes.container_logs-default" data stream from the DaemonSet
+Examples:
+| image   |
+| default |
@@ -0,0 +1,63 @@
+@windows_agent
+Feature: Windows Agent
+  Scenarios for the Agent in Fleet mode installed on a remote Windows host, reached over SSH. They need
+  the ELASTIC_AGENT_SSH_HOST and ELASTIC_AGENT_SSH_OS=windows env vars, and are skipped otherwise.
+
+@install
+Scenario Outline: Deploying the windows agent with <installer> installer
+  Given a "windows" agent is deployed to Fleet with "<installer>" installer
+  When the "elastic-agent" process is in the "started" state on the host
+  Then the "filebeat" process is in the "started" state on the host
+    And the "metricbeat" process is in the "started" state on the host
+    And the agent is listed in Fleet as "online"
+    And system package dashboards are listed in Fleet
+Examples:
+| installer |
+| zip       |
+| msi       |
+
+@enroll
+Scenario: Enrolling the windows agent
+  Given an agent is enrolled on "windows"
+  Then the agent is listed in Fleet as "online"
+
+@stop-agent
+Scenario: Stopping the windows agent stops backend processes
+  Given an agent is enrolled on "windows"
+  When the "elastic-agent" process is "stopped" on the host
+  Then the "filebeat" process is in the "stopped" state on the host
+    And the "metricbeat" process is in the "stopped" state on the host
+
+@restart-agent
+Scenario: Restarting the installed windows agent
+  Given an agent is enrolled on "windows"
+  When the "elastic-agent" process is "restarted" on the host
+  Then the "filebeat" process is in the "started" state on the host
+    And the "metricbeat" process is in the "started" state on the host
+    And the agent is listed in Fleet as "online"
+
+@restart-host
+Scenario: Restarting the windows host with persistent agent restarts backend processes
+  Given an agent is enrolled on "windows"
+  When the host is restarted
+  Then the "elastic-agent" process is in the "started" state on the host
+    And the "filebeat" process is in the "started" state on the host
+    And the "metricbeat" process is in the "started" state on the host
+
+@uninstall-host
+Scenario: Un-installing the installed windows agent
+  Given an agent is enrolled on "windows"
+  When the "elastic-agent" process is "uninstalled" on the host
+  Then the "elastic-agent" process is in the "stopped" state on the host
+    And the "filebeat" process is in the "stopped" state on the host
+    And the "metricbeat" process is in the "stopped" state on the host
+    And the file system Agent folder is empty
+
+@agent-metadata
+Scenario: Reporting the metadata of the windows agent and its host
+  Given an agent is enrolled on "windows"
+  When the agent is listed in Fleet as "online"
+  Then the local metadata of the agent has "os.family" as "windows"
+    And the local metadata of the agent has "os.platform" as "windows"
+    And the local metadata of the agent reports the architecture of its host
+    And the local metadata of the agent reports the version and build hash under test
@@ -0,0 +1,268 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// FleetServerLBServiceName the name of the service of the load balancer in front of the replicas of
+// the Fleet Server, which is its host name in the network of the profile too
+const FleetServerLBServiceName = "fleet-server-lb"
+
+// maxFleetServerReplicas the maximum number of replicas of the Fleet Server, as each one binds a
+// port of the range of ports of the service in the host
+const maxFleetServerReplicas = 10
+
+// fleetServersAreDeployedBehindALoadBalancer deploys a number of replicas of the Fleet Server,
+// waiting for all of them to be online, and a load balancer in front of them, which is set as the
+// URL of the Fleet Server in the settings of Fleet, so that the agents deployed afterwards in the
+// scenario enroll into any of them
+func (fts *FleetTestSuite) fleetServersAreDeployedBehindALoadBalancer(count string) error {
+	replicas, err := strconv.Atoi(count)
+	if err != nil {
+		return err
+	}
+
+	if replicas < 2 || replicas > maxFleetServerReplicas {
+		return fmt.Errorf("The number of Fleet Servers behind the load balancer must be between 2 and %d, but it is %d", maxFleetServerReplicas, replicas)
+	}
+
+	if fts.FleetServer != nil {
+		return fmt.Errorf("There is a Fleet Server deployed in the scenario already")
+	}
+
+	// each replica binds its own port in the host, reset when the Fleet Server is removed
+	fts.suite.env.put(map[string]string{
+		"fleetServerPort": getFleetServerPortsRange(),
+	})
+
+	err = fts.aFleetServerIsDeployed()
+	if err != nil {
+		return err
+	}
+
+	serviceManager := services.NewServiceManager()
+	err = serviceManager.ScaleService(FleetProfileName, FleetServerServiceName, replicas, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"replicas": replicas,
+			"service":  FleetServerServiceName,
+		}).Error("Could not scale the Fleet Server")
+		return err
+	}
+
+	for number := 2; number <= replicas; number++ {
+		hostname, err := getContainerHostname(getFleetServerContainerName(number))
+		if err != nil {
+			return err
+		}
+		fts.FleetServer.replicas = append(fts.FleetServer.replicas, hostname)
+
+		// each replica enrolls itself into Fleet when it's ready
+		err = fts.suite.waitForAgentStatus(hostname, "online")
+		if err != nil {
+			return err
+		}
+	}
+
+	// the load balancer is removed after the scenario, even if it could not be started
+	fts.FleetServer.loadBalanced = true
+
+	err = serviceManager.AddServicesToCompose(FleetProfileName, []string{FleetServerLBServiceName}, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": FleetServerLBServiceName,
+		}).Error("Could not deploy the load balancer of the Fleet Server")
+		return err
+	}
+
+	options := services.WaitOptions{
+		Timeout: time.Duration(timeoutFactor) * time.Minute,
+	}
+
+	err = serviceManager.WaitForHealthy(FleetProfileName, []string{FleetServerLBServiceName}, options)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s://%s:%d", config.GetURLScheme(), FleetServerLBServiceName, fleetServerPort)
+	err = fts.suite.fleet.UpdateFleetServerHosts([]string{url})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   url,
+		}).Error("Could not set the URL of the load balancer in the settings of Fleet")
+		return err
+	}
+
+	fts.FleetServer.url = url
+
+	log.WithFields(log.Fields{
+		"replicas": replicas,
+		"url":      url,
+	}).Info("The Fleet Servers are deployed behind a load balancer")
+
+	return nil
+}
+
+// agentsAreDeployedToFleetWithInstaller deploys a number of agents of the version under test, each
+// one in its own container, enrolling them into the policy of the scenario
+func (fts *FleetTestSuite) agentsAreDeployedToFleetWithInstaller(count string, image string, installerType string) error {
+	agents, err := strconv.Atoi(count)
+	if err != nil {
+		return err
+	}
+
+	enrollmentKey, err := fts.suite.createEnrollmentToken(fts.PolicyID)
+	if err != nil {
+		return err
+	}
+	fts.CurrentToken = enrollmentKey.APIKey
+	fts.CurrentTokenID = enrollmentKey.ID
+
+	for i := 0; i < agents; i++ {
+		agent, err := fts.suite.deployAgentInVersion(image, installerType, "N", agentVersion, len(fts.Agents)+1, fts.fleetServerURL(), fts.CurrentToken)
+		if agent != nil {
+			fts.Agents = append(fts.Agents, agent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// oneOfTheFleetServersIsKilled kills the container of the last replica of the Fleet Server of the
+// scenario, so that the agents checking in to it reconnect to the other ones through the load
+// balancer
+func (fts *FleetTestSuite) oneOfTheFleetServersIsKilled() error {
+	if fts.FleetServer == nil || len(fts.FleetServer.replicas) == 0 {
+		return fmt.Errorf("There are no Fleet Servers behind a load balancer in the scenario")
+	}
+
+	containerName := getFleetServerContainerName(len(fts.FleetServer.replicas) + 1)
+
+	err := docker.KillContainer(e2e.ScenarioContext(), containerName, "SIGKILL")
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+	}).Info("One of the Fleet Servers was killed")
+
+	return nil
+}
+
+// allTheAgentsStayListedInFleetWithStatusFor checks that all the agents of the scenario are listed in
+// Fleet in a status during a number of seconds, checking all of them every few seconds
+func (fts *FleetTestSuite) allTheAgentsStayListedInFleetWithStatusFor(desiredStatus string, seconds string) error {
+	duration, err := strconv.Atoi(seconds)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(time.Duration(duration) * time.Second)
+	for {
+		for _, agent := range fts.Agents {
+			agentID, err := fts.suite.getAgentID(agent.hostname)
+			if err != nil {
+				return err
+			}
+
+			isAgentInStatus, err := fts.suite.isAgentInStatus(agentID, desiredStatus)
+			if err != nil {
+				return err
+			}
+
+			if !isAgentInStatus {
+				log.WithFields(log.Fields{
+					"agentID":  agentID,
+					"hostname": agent.hostname,
+					"status":   desiredStatus,
+				}).Error("The agent left the desired status")
+				return fmt.Errorf("The agent of the %s hostname is not in the %s status", agent.hostname, desiredStatus)
+			}
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	log.WithFields(log.Fields{
+		"agents":   len(fts.Agents),
+		"duration": duration,
+		"status":   desiredStatus,
+	}).Info("All the agents stayed in the desired status")
+
+	return nil
+}
+
+// removeFleetServerReplicas unenrolls the replicas of the Fleet Server of the scenario, but the
+// first one, and removes its load balancer, resetting the ports of the service in the host
+func (fts *FleetTestSuite) removeFleetServerReplicas() {
+	for _, hostname := range fts.FleetServer.replicas {
+		err := fts.suite.unenrollAgentsOfHostname(hostname, true)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"hostname": hostname,
+			}).Warn("The replica of the Fleet Server could not be unenrolled")
+		}
+	}
+
+	// the next Fleet Servers of the run bind the port of the worker again
+	fts.suite.env.put(map[string]string{
+		"fleetServerPort": strconv.Itoa(config.GetHostPort(fleetServerPort)),
+	})
+
+	if !fts.FleetServer.loadBalanced {
+		return
+	}
+
+	if developerMode {
+		log.WithField("service", FleetServerLBServiceName).Info("Because we are running in development mode, the service won't be stopped")
+		return
+	}
+
+	serviceManager := services.NewServiceManager()
+	err := serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{FleetServerLBServiceName}, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":     err,
+			"service": FleetServerLBServiceName,
+		}).Warn("The load balancer of the Fleet Server could not be removed")
+	}
+}
+
+// getFleetServerPortsRange returns the ports of the host bound by the replicas of the Fleet Server,
+// one each, starting at the port of the Fleet Server shifted for the worker, i.e. 10220-10229 for the
+// worker 2
+func getFleetServerPortsRange() string {
+	port := config.GetHostPort(fleetServerPort)
+
+	return fmt.Sprintf("%d-%d", port, port+maxFleetServerReplicas-1)
+}
+
+// getFleetServerContainerName returns the name of the container of a replica of the Fleet Server,
+// being 1 the first one
+func getFleetServerContainerName(number int) string {
+	return fmt.Sprintf("%s_%s_%d", config.GetComposeProjectName(FleetProfileName), FleetServerServiceName, number)
+}
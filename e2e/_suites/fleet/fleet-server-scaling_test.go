@@ -0,0 +1,62 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFleetServerPortsRangeIsShiftedForTheWorker(t *testing.T) {
+	os.Unsetenv("OP_WORKER_ID")
+	assert.Equal(t, "8220-8229", getFleetServerPortsRange())
+
+	os.Setenv("OP_WORKER_ID", "2")
+	defer os.Unsetenv("OP_WORKER_ID")
+	assert.Equal(t, "10220-10229", getFleetServerPortsRange())
+}
+
+func TestRemoveFleetServerReplicasRestoresThePortOfTheWorker(t *testing.T) {
+	os.Setenv("OP_WORKER_ID", "2")
+	defer os.Unsetenv("OP_WORKER_ID")
+
+	s := kibanatest.NewServer()
+	defer s.Close()
+
+	replicas := addFakeAgents(s, kibanatest.DefaultFleetServerPolicyID, "online", "fleet-server", 2)
+
+	sc := newFakeSuiteContext(s)
+
+	// the replicas bind the range of ports of the worker while the Fleet Server is scaled up
+	sc.env.put(map[string]string{
+		"fleetServerPort": getFleetServerPortsRange(),
+	})
+	fts := &FleetTestSuite{
+		FleetServer: &fleetServer{replicas: replicas},
+		suite:       sc,
+	}
+
+	fts.removeFleetServerReplicas()
+
+	for _, hostname := range replicas {
+		agentID, err := sc.getAgentID(hostname)
+		assert.Nil(t, err)
+		assert.Equal(t, "", agentID, hostname)
+	}
+
+	// a single Fleet Server deployed afterwards binds the port of the worker, as the service manager
+	// only fills the ports missing in the environment of the profile
+	env := config.PutWorkerEnvironment(sc.env.get())
+	assert.Equal(t, "10220", env["fleetServerPort"])
+
+	count, err := s.Client().CountAgents(kibana.AgentsQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,189 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+)
+
+// FleetServerServiceName the name of the service of the Fleet Server, which is its host name in the
+// network of the profile too
+const FleetServerServiceName = "fleet-server"
+
+// fleetServerPort the port of the Fleet Server in the network of the profile
+const fleetServerPort = 8220
+
+// fleetServer a Fleet Server deployed in a scenario: an agent in fleet-server mode running in the
+// container of its service, bootstrapped with a service token
+type fleetServer struct {
+	hostname     string   // the hostname the Fleet Server is listed with in Fleet
+	loadBalanced bool     // if the replicas are behind a load balancer
+	replicas     []string // the hostnames of the replicas of the Fleet Server, but the first one
+	url          string   // the URL the agents enroll into, empty until the Fleet Server is online
+}
+
+// fleetServerURL returns the URL of the Fleet Server deployed in the scenario, which the agents
+// enroll into instead of Kibana. It's empty when there is no Fleet Server
+func (fts *FleetTestSuite) fleetServerURL() string {
+	if fts.FleetServer == nil {
+		return ""
+	}
+
+	return fts.FleetServer.url
+}
+
+// aFleetServerIsDeployed bootstraps a Fleet Server into the default Fleet Server policy, and
+// sets its URL in the settings of Fleet, so that the agents deployed afterwards in the scenario
+// enroll into it
+func (fts *FleetTestSuite) aFleetServerIsDeployed() error {
+	if fts.FleetServer != nil {
+		return nil
+	}
+
+	policy, err := fts.suite.fleet.GetDefaultFleetServerPolicy()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not get the policy of the Fleet Server, which is created by the setup of Fleet")
+		return err
+	}
+
+	serviceToken, err := fts.suite.fleet.CreateServiceToken()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not create the service token of the Fleet Server")
+		return err
+	}
+
+	url := fmt.Sprintf("%s://%s:%d", config.GetURLScheme(), FleetServerServiceName, fleetServerPort)
+	err = fts.suite.fleet.UpdateFleetServerHosts([]string{url})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"url":   url,
+		}).Error("Could not set the URL of the Fleet Server in the settings of Fleet")
+		return err
+	}
+
+	containerName := getFleetServerContainerName(1)
+
+	fts.suite.env.put(map[string]string{
+		"fleetServerContainerName": containerName,
+		"fleetServerPolicyID":      policy.ID,
+		"fleetServerServiceToken":  serviceToken.Value,
+		"fleetServerTag":           agentVersion,
+	})
+	fts.suite.env.put(getFleetServerTLSEnvironment())
+
+	// the service is removed after the scenario, even if it could not be started
+	fts.FleetServer = &fleetServer{}
+	fts.Cleanup = true
+
+	serviceManager := services.NewServiceManager()
+	err = serviceManager.AddServicesToCompose(FleetProfileName, []string{FleetServerServiceName}, fts.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": FleetServerServiceName,
+		}).Error("Could not deploy the Fleet Server")
+		return err
+	}
+
+	hostname, err := getContainerHostname(containerName)
+	if err != nil {
+		return err
+	}
+	fts.FleetServer.hostname = hostname
+
+	// the Fleet Server enrolls itself into Fleet when it's ready
+	err = fts.suite.waitForAgentStatus(hostname, "online")
+	if err != nil {
+		return err
+	}
+
+	fts.FleetServer.url = url
+
+	log.WithFields(log.Fields{
+		"hostname": hostname,
+		"policyID": policy.ID,
+		"url":      url,
+	}).Info("The Fleet Server is deployed")
+
+	return nil
+}
+
+// theFleetServerIsListedInFleetWithStatus waits for the Fleet Server of the scenario to be listed in
+// Fleet in a status
+func (fts *FleetTestSuite) theFleetServerIsListedInFleetWithStatus(desiredStatus string) error {
+	if fts.FleetServer == nil {
+		return fmt.Errorf("there is no Fleet Server deployed in the scenario")
+	}
+
+	return fts.suite.waitForAgentStatus(fts.FleetServer.hostname, desiredStatus)
+}
+
+// removeFleetServer unenrolls the Fleet Server of the scenario and removes its service, so that the
+// agents of the next scenarios enroll into Kibana, unless they deploy another one
+func (fts *FleetTestSuite) removeFleetServer() {
+	if fts.FleetServer == nil {
+		return
+	}
+
+	fts.removeFleetServerReplicas()
+
+	if fts.FleetServer.hostname != "" {
+		err := fts.suite.unenrollAgentsOfHostname(fts.FleetServer.hostname, true)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"hostname": fts.FleetServer.hostname,
+			}).Warn("The Fleet Server could not be unenrolled")
+		}
+	}
+
+	if !developerMode {
+		serviceManager := services.NewServiceManager()
+		err := serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{FleetServerServiceName}, fts.suite.env.get())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":     err,
+				"service": FleetServerServiceName,
+			}).Warn("The Fleet Server could not be removed")
+		}
+	} else {
+		log.WithField("service", FleetServerServiceName).Info("Because we are running in development mode, the service won't be stopped")
+	}
+
+	fts.FleetServer = nil
+}
+
+// getFleetServerTLSEnvironment returns the environment of the compose file of the Fleet Server, which
+// listens with TLS and trusts the CA of Elasticsearch when the stack is secured, and with plain
+// HTTP otherwise
+func getFleetServerTLSEnvironment() map[string]string {
+	if config.GetCACertPath() == "" {
+		return map[string]string{
+			"fleetServerCert":            "",
+			"fleetServerCertKey":         "",
+			"fleetServerElasticsearchCA": "",
+			"fleetServerInsecureHTTP":    "1",
+		}
+	}
+
+	// the certs dir is mounted at /usr/share/elastic-agent/certs
+	certsDir := "/usr/share/elastic-agent/certs/"
+
+	return map[string]string{
+		"fleetServerCert":            certsDir + FleetServerServiceName + "/" + FleetServerServiceName + ".crt",
+		"fleetServerCertKey":         certsDir + FleetServerServiceName + "/" + FleetServerServiceName + ".key",
+		"fleetServerElasticsearchCA": certsDir + "ca/ca.crt",
+		"fleetServerInsecureHTTP":    "0",
+	}
+}
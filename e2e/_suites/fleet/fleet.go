@@ -6,28 +6,24 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/Jeffail/gabs/v2"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/cucumber/godog"
-	"github.com/elastic/e2e-testing/cli/services"
-	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
 	"github.com/elastic/e2e-testing/e2e"
-	"github.com/google/uuid"
+	"github.com/elastic/e2e-testing/e2e/chaos"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-const fleetAgentsURL = kibanaBaseURL + "/api/fleet/agents"
-const fleetAgentEventsURL = kibanaBaseURL + "/api/fleet/agents/%s/events"
-const fleetAgentsUnEnrollURL = kibanaBaseURL + "/api/fleet/agents/%s/unenroll"
-const fleetAgentUpgradeURL = kibanaBaseURL + "/api/fleet/agents/%s/upgrade"
-const fleetEnrollmentTokenURL = kibanaBaseURL + "/api/fleet/enrollment-api-keys"
-const fleetSetupURL = kibanaBaseURL + "/api/fleet/agents/setup"
-const ingestManagerAgentPoliciesURL = kibanaBaseURL + "/api/fleet/agent_policies"
-const ingestManagerDataStreamsURL = kibanaBaseURL + "/api/fleet/data_streams"
+// agentStatusPollInterval the interval between the checks of the status of an agent which must keep it
+const agentStatusPollInterval = 5 * time.Second
 
 const actionADDED = "added"
 const actionREMOVED = "removed"
@@ -39,21 +35,52 @@ type FleetTestSuite struct {
 	Installers     map[string]ElasticAgentInstaller
 	Cleanup        bool
 	PolicyID       string // will be used to manage tokens
+	PolicyCreated  bool   // the policy was created by the scenario, which deletes it in its teardown
 	CurrentToken   string // current enrollment token
 	CurrentTokenID string // current enrollment tokenID
 	Hostname       string // the hostname of the container
 	// integrations
-	Integration     IntegrationPackage // the installed integration
-	PolicyUpdatedAt string             // the moment the policy was updated
+	Integration     kibana.PackagePolicy // the integration added to the policy
+	PolicyUpdatedAt string               // the moment the policy was updated
+	// benchmarks
+	EnrolledAt      time.Time // the moment the enrollment of the agent started
+	PolicyUpdatedOn time.Time // the moment the update of the policy was requested
+	// policy changes
+	PolicyChangedAt time.Time // the moment an integration was added to or removed from the policy
+	PolicyRevision  int       // the revision of the policy with the change, acknowledged by the agent
+	// status transitions
+	OutputHosts     []string        // the hosts of the default output before the scenario broke it
+	OutputID        string          // the default output broken by the scenario, restored in its teardown
+	StatusChangedAt time.Time       // the moment the process, the output or the network of the agent were changed
+	Chaos           *chaos.Injector // the injector of the faults into the services of the profile
+	// un-enrollment
+	UnenrolledAt time.Time // the moment the agent was un-enrolled, to check it stops sending data
+	// tags
+	Tags []string // the tags the agent is enrolled with
+	// mixed versions
+	Agents []*fleetAgent // the agents of several versions enrolled into the policy
+	// named agents
+	NamedAgents map[string]*fleetAgent     // the agents of the scenario by their name in the steps, i.e. A
+	Policies    map[string]*scenarioPolicy // the policies created in the scenario by their name in the steps
+	TokenIDs    []string                   // the enrollment tokens created for single agents of the scenario
+	// bulk enrollment
+	BulkAgents *bulkAgents // the agents enrolled in bulk, each one in a container of the Docker image
+	// fleet server
+	FleetServer *fleetServer // the Fleet Server the agents enroll into, if any
+	// logstash output
+	LogstashOutput *logstashOutput // the Logstash output added to Fleet in the scenario, if any
+	// diagnostics
+	Diagnostics  *diagnosticsBundle // the diagnostics bundle of the agent collected in the scenario
+	ScenarioName string             // the name of the scenario, naming the outputs dir of its diagnostics
+	// the context of the suite, with its clients and the environment of its profile
+	suite *SuiteContext
 }
 
 // afterScenario destroys the state created by a scenario
 func (fts *FleetTestSuite) afterScenario() {
-	serviceManager := services.NewServiceManager()
-
 	serviceName := fts.Image
 
-	if log.IsLevelEnabled(log.DebugLevel) {
+	if serviceName != "" && log.IsLevelEnabled(log.DebugLevel) {
 		installer := fts.getInstaller()
 		_ = installer.getElasticAgentLogs(fts.Hostname)
 
@@ -63,21 +90,36 @@ func (fts *FleetTestSuite) afterScenario() {
 		}
 	}
 
-	err := fts.unenrollHostname(true)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"err":      err,
-			"hostname": fts.Hostname,
-		}).Warn("The agentIDs for the hostname could not be unenrolled")
+	if fts.Hostname != "" {
+		err := fts.unenrollHostname(true)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"hostname": fts.Hostname,
+			}).Warn("The agentIDs for the hostname could not be unenrolled")
+		}
 	}
 
-	if !developerMode {
-		_ = serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{serviceName + "-systemd"}, profileEnv)
+	fts.removeAgents()
+	fts.removeBulkAgents()
+
+	// the policies and the tokens are deleted once their agents are un-enrolled
+	fts.removeTokens()
+	fts.removeLogstashOutput()
+	fts.removePolicies()
+
+	// the agents are removed before the Fleet Server they are enrolled into
+	fts.removeFleetServer()
+
+	if serviceName == "" {
+		log.Trace("There is no service of an agent under test to be stopped")
+	} else if !developerMode {
+		_ = fts.suite.deployer.remove(fts.getInstaller())
 	} else {
 		log.WithField("service", serviceName).Info("Because we are running in development mode, the service won't be stopped")
 	}
 
-	err = fts.removeToken()
+	err := fts.removeToken()
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":     err,
@@ -85,27 +127,50 @@ func (fts *FleetTestSuite) afterScenario() {
 		}).Warn("The enrollment token could not be deleted")
 	}
 
-	err = deleteIntegrationFromPolicy(fts.Integration, fts.PolicyID)
+	err = fts.suite.deleteIntegrationFromPolicy(fts.Integration)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":             err,
-			"packageConfigID": fts.Integration.packageConfigID,
-			"configurationID": fts.PolicyID,
-		}).Warn("The integration could not be deleted from the configuration")
+			"packagePolicyID": fts.Integration.ID,
+			"policyID":        fts.PolicyID,
+		}).Warn("The integration could not be deleted from the policy")
 	}
 
+	// the policy of the scenario is deleted once its agents, token and integrations are removed
+	fts.removeScenarioPolicy()
+
+	_ = fts.restoreOutput()
+
 	// clean up fields
 	fts.CurrentTokenID = ""
+	fts.Integration = kibana.PackagePolicy{}
+	fts.EnrolledAt = time.Time{}
+	fts.PolicyUpdatedOn = time.Time{}
+	fts.PolicyChangedAt = time.Time{}
+	fts.PolicyRevision = 0
+	fts.StatusChangedAt = time.Time{}
+	fts.UnenrolledAt = time.Time{}
 	fts.Image = ""
 	fts.Hostname = ""
+	fts.Tags = nil
+	fts.Diagnostics = nil
 }
 
-// beforeScenario creates the state needed by a scenario
-func (fts *FleetTestSuite) beforeScenario() {
+// beforeScenario creates the state needed by a scenario, which uses its own policy, named after
+// it, if the policies are not shared by the scenarios
+func (fts *FleetTestSuite) beforeScenario(name string) {
 	fts.Cleanup = false
+	fts.ScenarioName = name
+	fts.NamedAgents = map[string]*fleetAgent{}
+	fts.Policies = map[string]*scenarioPolicy{}
+
+	if policyPerScenario {
+		_ = fts.createScenarioPolicy(name)
+		return
+	}
 
 	// create policy with system monitoring enabled
-	defaultPolicy, err := getAgentDefaultPolicy()
+	defaultPolicy, err := fts.suite.fleet.GetDefaultAgentPolicy()
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
@@ -114,54 +179,104 @@ func (fts *FleetTestSuite) beforeScenario() {
 		return
 	}
 
-	fts.PolicyID = defaultPolicy.Path("id").Data().(string)
+	fts.PolicyCreated = false
+	fts.PolicyID = defaultPolicy.ID
 }
 
-func (fts *FleetTestSuite) contributeSteps(s *godog.Suite) {
-	s.Step(`^a "([^"]*)" agent is deployed to Fleet with "([^"]*)" installer$`, fts.anAgentIsDeployedToFleetWithInstaller)
-	s.Step(`^a "([^"]*)" agent "([^"]*)" is deployed to Fleet with "([^"]*)" installer$`, fts.anStaleAgentIsDeployedToFleetWithInstaller)
-	s.Step(`^agent is in version "([^"]*)"$`, fts.agentInVersion)
-	s.Step(`^agent is upgraded to version "([^"]*)"$`, fts.anAgentIsUpgraded)
-	s.Step(`^the agent is listed in Fleet as "([^"]*)"$`, fts.theAgentIsListedInFleetWithStatus)
-	s.Step(`^the host is restarted$`, fts.theHostIsRestarted)
-	s.Step(`^system package dashboards are listed in Fleet$`, fts.systemPackageDashboardsAreListedInFleet)
-	s.Step(`^the agent is un-enrolled$`, fts.theAgentIsUnenrolled)
-	s.Step(`^the agent is re-enrolled on the host$`, fts.theAgentIsReenrolledOnTheHost)
-	s.Step(`^the enrollment token is revoked$`, fts.theEnrollmentTokenIsRevoked)
-	s.Step(`^an attempt to enroll a new agent fails$`, fts.anAttemptToEnrollANewAgentFails)
-	s.Step(`^the "([^"]*)" process is "([^"]*)" on the host$`, fts.processStateChangedOnTheHost)
-	s.Step(`^the file system Agent folder is empty$`, fts.theFileSystemAgentFolderIsEmpty)
-	s.Step(`^certs for "([^"]*)" are installed$`, fts.installCerts)
+func (fts *FleetTestSuite) contributeSteps(s *godog.ScenarioContext) {
+	e2e.Step(s, `^a "([^"]*)" agent is deployed to Fleet with "([^"]*)" installer$`, fts.anAgentIsDeployedToFleetWithInstaller)
+	e2e.Step(s, `^a "([^"]*)" agent "([^"]*)" is deployed to Fleet with "([^"]*)" installer$`, fts.anStaleAgentIsDeployedToFleetWithInstaller)
+	e2e.Step(s, `^a "([^"]*)" agent is deployed to Fleet with "([^"]*)" installer and tags "([^"]*)"$`, fts.anAgentIsDeployedToFleetWithInstallerAndTags)
+	e2e.Step(s, `^an agent is enrolled on "([^"]*)"$`, fts.anAgentIsEnrolledOn)
+	e2e.Step(s, `^agent is in version "([^"]*)"$`, fts.agentInVersion)
+	e2e.Step(s, `^agent is upgraded to version "([^"]*)"$`, fts.anAgentIsUpgraded)
+	e2e.Step(s, `^the agent is listed in Fleet as "([^"]*)"$`, fts.theAgentIsListedInFleetWithStatus)
+	e2e.Step(s, `^the agent is listed in Fleet with tags "([^"]*)"$`, fts.theAgentIsListedInFleetWithTags)
+	e2e.Step(s, `^the local metadata of the agent has "([^"]*)" as "([^"]*)"$`, fts.theLocalMetadataOfTheAgentHasField)
+	e2e.Step(s, `^the local metadata of the agent reports the architecture of its host$`, fts.theLocalMetadataOfTheAgentReportsTheArchitectureOfItsHost)
+	e2e.Step(s, `^the local metadata of the agent reports the version and build hash under test$`, fts.theLocalMetadataOfTheAgentReportsTheVersionAndBuildHashUnderTest)
+	e2e.Step(s, `^the agent stays listed in Fleet as "([^"]*)" for "([^"]*)" seconds$`, fts.theAgentStaysListedInFleetWithStatus)
+	e2e.Step(s, `^the agent is listed in Fleet as "([^"]*)" after the checkin timeout$`, fts.theAgentIsListedInFleetWithStatusAfterTheCheckinTimeout)
+	e2e.Step(s, `^the agent checks in to Fleet as "([^"]*)"$`, fts.theAgentChecksInToFleetWithStatus)
+	e2e.Step(s, `^the output of the agent is (broken|restored)$`, fts.theOutputOfTheAgentIsOperated)
+	e2e.Step(s, `^the agent loses connectivity to Fleet(?: for "([^"]*)")?$`, fts.theAgentLosesConnectivityToFleet)
+	e2e.Step(s, `^the agent recovers connectivity to Fleet$`, fts.theAgentRecoversConnectivityToFleet)
+	e2e.Step(s, `^the host is restarted$`, fts.theHostIsRestarted)
+	e2e.Step(s, `^system package dashboards are listed in Fleet$`, fts.systemPackageDashboardsAreListedInFleet)
+	e2e.Step(s, `^the agent is un-enrolled$`, fts.theAgentIsUnenrolled)
+	e2e.Step(s, `^the agent is force un-enrolled$`, fts.theAgentIsForceUnenrolled)
+	e2e.Step(s, `^the agent stops sending data to the data streams$`, fts.theAgentStopsSendingDataToTheDataStreams)
+	e2e.Step(s, `^the agent is re-enrolled on the host$`, fts.theAgentIsReenrolledOnTheHost)
+	e2e.Step(s, `^the enrollment token is revoked$`, fts.theEnrollmentTokenIsRevoked)
+	e2e.Step(s, `^the enrollment token is listed in Fleet as revoked$`, fts.theEnrollmentTokenIsListedInFleetAsRevoked)
+	e2e.Step(s, `^an attempt to enroll a new agent fails$`, fts.anAttemptToEnrollANewAgentFails)
+	e2e.Step(s, `^the "([^"]*)" process is "([^"]*)" on the host$`, fts.processStateChangedOnTheHost)
+	e2e.Step(s, `^the file system Agent folder is empty$`, fts.theFileSystemAgentFolderIsEmpty)
+	e2e.Step(s, `^certs for "([^"]*)" are installed$`, fts.installCerts)
+
+	// mixed versions steps
+	e2e.Step(s, `^"([^"]*)" agents in versions "([^"]*)" are deployed to Fleet with "([^"]*)" installer$`, fts.agentsInVersionsAreDeployedToFleetWithInstaller)
+	e2e.Step(s, `^all the agents are listed in Fleet as "([^"]*)"$`, fts.allTheAgentsAreListedInFleetWithStatus)
+	e2e.Step(s, `^all the agents are listed in Fleet in their versions$`, fts.allTheAgentsAreListedInFleetInTheirVersions)
+	e2e.Step(s, `^the upgrade is only available for the agents older than the stack$`, fts.theUpgradeIsOnlyAvailableForTheAgentsOlderThanTheStack)
+	e2e.Step(s, `^there is data from all the agents in the "([^"]*)" index$`, fts.thereIsDataFromAllTheAgentsInTheIndex)
+
+	// named agents steps
+	e2e.Step(s, `^a policy "([^"]*)" is created$`, fts.aPolicyIsCreated)
+	e2e.Step(s, `^agent "([^"]*)" is deployed to Fleet on "([^"]*)" with "([^"]*)" installer$`, fts.agentIsDeployedToFleetWithInstaller)
+	e2e.Step(s, `^agent "([^"]*)" is deployed to Fleet on "([^"]*)" with "([^"]*)" installer into policy "([^"]*)"$`, fts.agentIsDeployedToFleetWithInstallerIntoPolicy)
+	e2e.Step(s, `^agent "([^"]*)" is deployed to Fleet on "([^"]*)" with "([^"]*)" installer using a newly created enrollment token for policy "([^"]*)"$`, fts.agentIsDeployedToFleetWithInstallerUsingNewTokenForPolicy)
+	e2e.Step(s, `^agent "([^"]*)" is listed in Fleet as "([^"]*)"$`, fts.agentIsListedInFleetWithStatus)
+	e2e.Step(s, `^agent "([^"]*)" is assigned to policy "([^"]*)"$`, fts.agentIsAssignedToPolicy)
+	e2e.Step(s, `^agent "([^"]*)" is reassigned to policy "([^"]*)"$`, fts.agentIsReassignedToPolicy)
+	e2e.Step(s, `^agent "([^"]*)" is un-enrolled$`, fts.agentIsUnenrolled)
+
+	// logstash output steps
+	e2e.Step(s, `^a Logstash output is added to Fleet$`, fts.aLogstashOutputIsAddedToFleet)
+	e2e.Step(s, `^the policy of the agent uses the Logstash output$`, fts.thePolicyOfTheAgentUsesTheLogstashOutput)
+	e2e.Step(s, `^there is data from the agent in the "([^"]*)" data stream through Logstash$`, fts.thereIsDataFromTheAgentInTheDataStreamThroughLogstash)
+
+	// fleet server steps
+	e2e.Step(s, `^a Fleet Server is deployed$`, fts.aFleetServerIsDeployed)
+	e2e.Step(s, `^the Fleet Server is listed in Fleet as "([^"]*)"$`, fts.theFleetServerIsListedInFleetWithStatus)
+	e2e.Step(s, `^"([^"]*)" Fleet Servers are deployed behind a load balancer$`, fts.fleetServersAreDeployedBehindALoadBalancer)
+	e2e.Step(s, `^"([^"]*)" agents are deployed to Fleet on "([^"]*)" with "([^"]*)" installer$`, fts.agentsAreDeployedToFleetWithInstaller)
+	e2e.Step(s, `^one of the Fleet Servers is killed$`, fts.oneOfTheFleetServersIsKilled)
+	e2e.Step(s, `^all the agents stay listed in Fleet as "([^"]*)" for "([^"]*)" seconds$`, fts.allTheAgentsStayListedInFleetWithStatusFor)
+	e2e.Step(s, `^"([^"]*)" agents are enrolled$`, fts.agentsAreEnrolled)
+	e2e.Step(s, `^all the enrolled agents are listed in Fleet as "([^"]*)" within "([^"]*)" seconds$`, fts.allTheEnrolledAgentsAreListedInFleetWithStatusWithin)
+	e2e.Step(s, `^the diagnostics bundle of the agent is collected$`, fts.theDiagnosticsBundleOfTheAgentIsCollected)
+	e2e.Step(s, `^the diagnostics bundle of the agent contains the "([^"]*)" components?$`, fts.theDiagnosticsBundleOfTheAgentContainsTheComponents)
+
+	// package registry steps
+	e2e.Step(s, `^the "([^"]*)" integration is available in the Package Registry(?: in version "([^"]*)")?$`, fts.theIntegrationIsAvailableInThePackageRegistry)
 
 	// endpoint steps
-	s.Step(`^the "([^"]*)" integration is "([^"]*)" in the policy$`, fts.theIntegrationIsOperatedInThePolicy)
-	s.Step(`^the "([^"]*)" datasource is shown in the policy as added$`, fts.thePolicyShowsTheDatasourceAdded)
-	s.Step(`^the host name is shown in the Administration view in the Security App as "([^"]*)"$`, fts.theHostNameIsShownInTheAdminViewInTheSecurityApp)
-	s.Step(`^the host name is not shown in the Administration view in the Security App$`, fts.theHostNameIsNotShownInTheAdminViewInTheSecurityApp)
-	s.Step(`^an Endpoint is successfully deployed with a "([^"]*)" Agent using "([^"]*)" installer$`, fts.anEndpointIsSuccessfullyDeployedWithAgentAndInstalller)
-	s.Step(`^the policy response will be shown in the Security App$`, fts.thePolicyResponseWillBeShownInTheSecurityApp)
-	s.Step(`^the policy is updated to have "([^"]*)" in "([^"]*)" mode$`, fts.thePolicyIsUpdatedToHaveMode)
-	s.Step(`^the policy will reflect the change in the Security App$`, fts.thePolicyWillReflectTheChangeInTheSecurityApp)
+	e2e.Step(s, `^the "([^"]*)" integration is "([^"]*)" in the policy$`, fts.theIntegrationIsOperatedInThePolicy)
+	e2e.Step(s, `^the "([^"]*)" datasource is shown in the policy as added$`, fts.thePolicyShowsTheDatasourceAdded)
+	e2e.Step(s, `^the agent acknowledges the policy change$`, fts.theAgentAcknowledgesThePolicyChange)
+	e2e.Step(s, `^I configure the "([^"]*)" integration with:$`, fts.iConfigureTheIntegrationWith)
+	e2e.Step(s, `^the "([^"]*)" integration is added to the policy with:$`, fts.theIntegrationIsAddedToThePolicyWith)
+	e2e.Step(s, `^the host name is shown in the Administration view in the Security App as "([^"]*)"$`, fts.theHostNameIsShownInTheAdminViewInTheSecurityApp)
+	e2e.Step(s, `^the host name is not shown in the Administration view in the Security App$`, fts.theHostNameIsNotShownInTheAdminViewInTheSecurityApp)
+	e2e.Step(s, `^an Endpoint is successfully deployed with a "([^"]*)" Agent using "([^"]*)" installer$`, fts.anEndpointIsSuccessfullyDeployedWithAgentAndInstalller)
+	e2e.Step(s, `^the policy response will be shown in the Security App$`, fts.thePolicyResponseWillBeShownInTheSecurityApp)
+	e2e.Step(s, `^the policy is updated to have "([^"]*)" in "([^"]*)" mode$`, fts.thePolicyIsUpdatedToHaveMode)
+	e2e.Step(s, `^the policy will reflect the change in the Security App$`, fts.thePolicyWillReflectTheChangeInTheSecurityApp)
+	e2e.Step(s, `^the policy is updated to have the "([^"]*)" events "(enabled|disabled)"$`, fts.thePolicyIsUpdatedToHaveTheEvents)
+	e2e.Step(s, `^the updated policy is applied in the Security App$`, fts.theUpdatedPolicyIsAppliedInTheSecurityApp)
 }
 
 func (fts *FleetTestSuite) anStaleAgentIsDeployedToFleetWithInstaller(image, version, installerType string) error {
-	agentVersionBackup := agentVersion
-	defer func() { agentVersion = agentVersionBackup }()
-
-	switch version {
-	case "stale":
-		version = agentStaleVersion
-	case "latest":
-		version = agentVersion
-	default:
-		version = agentStaleVersion
+	version, err := resolveAgentVersion(version)
+	if err != nil {
+		return err
 	}
 
-	agentVersion = version
-
-	// prepare installer for stale version
-	if agentVersion != agentVersionBackup {
-		i := GetElasticAgentInstaller(image, installerType)
+	// prepare installer for the version, if the image is supported by the OS of the boxes, which is
+	// checked by the deployment
+	if version != agentVersion && (image == windowsOS) == (fts.suite.deployer.boxOS() == windowsOS) {
+		i := GetElasticAgentInstaller(fts.suite.deployer, image, installerType, version)
 		installerType = fmt.Sprintf("%s-%s", installerType, version)
 		fts.Installers[fmt.Sprintf("%s-%s", image, installerType)] = i
 	}
@@ -179,64 +294,35 @@ func (fts *FleetTestSuite) installCerts(targetOS string) error {
 }
 
 func (fts *FleetTestSuite) anAgentIsUpgraded(desiredVersion string) error {
-	switch desiredVersion {
-	case "stale":
-		desiredVersion = agentStaleVersion
-	case "latest":
-		desiredVersion = agentVersion
-	default:
-		desiredVersion = agentVersion
+	desiredVersion, err := resolveAgentVersion(desiredVersion)
+	if err != nil {
+		return err
 	}
 
 	return fts.upgradeAgent(desiredVersion)
 }
 
 func (fts *FleetTestSuite) agentInVersion(version string) error {
-	switch version {
-	case "stale":
-		version = agentStaleVersion
-	case "latest":
-		version = agentVersion
+	version, err := resolveAgentVersion(version)
+	if err != nil {
+		return err
 	}
 
-	agentInVersionFn := func() error {
-		agentID, err := getAgentID(fts.Hostname)
-		if err != nil {
-			return err
-		}
-
-		r := createDefaultHTTPRequest(fleetAgentsURL + "/" + agentID)
-		body, err := curl.Get(r)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"body":  body,
-				"error": err,
-				"url":   r.GetURL(),
-			}).Error("Could not get agent in Fleet")
-			return err
-		}
-
-		jsonResponse, err := gabs.ParseJSON([]byte(body))
-
-		retrievedVersion := jsonResponse.Path("item.local_metadata.elastic.agent.version").Data().(string)
-		if isSnapshot := jsonResponse.Path("item.local_metadata.elastic.agent.snapshot").Data().(bool); isSnapshot {
-			retrievedVersion += "-SNAPSHOT"
-		}
-
-		if retrievedVersion != version {
-			return fmt.Errorf("version mismatch required '%s' retrieved '%s'", version, retrievedVersion)
-		}
+	return fts.suite.waitForAgentVersion(fts.Hostname, version)
+}
 
-		return nil
+// anAgentIsEnrolledOn deploys an agent to Fleet with the default installer of an OS, which enrolls the
+// agent when installing it: zip for windows, and tar for the Linux images
+func (fts *FleetTestSuite) anAgentIsEnrolledOn(image string) error {
+	installerType := "tar"
+	if image == windowsOS {
+		installerType = "zip"
 	}
 
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute * 2
-	exp := e2e.GetExponentialBackOff(maxTimeout)
-
-	return backoff.Retry(agentInVersionFn, exp)
+	return fts.anAgentIsDeployedToFleetWithInstaller(image, installerType)
 }
 
-// supported installers: tar, systemd
+// supported installers: tar, systemd, and zip and msi for windows
 func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstaller(image string, installerType string) error {
 	log.WithFields(log.Fields{
 		"image":     image,
@@ -246,39 +332,52 @@ func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstaller(image string, i
 	fts.Image = image
 	fts.InstallerType = installerType
 
-	installer := fts.getInstaller()
+	installer, exists := fts.Installers[image+"-"+installerType]
+	if !exists {
+		log.WithFields(log.Fields{
+			"image":     image,
+			"installer": installerType,
+			"os":        fts.suite.deployer.boxOS(),
+		}).Warn("The installer is not available for the OS of the boxes, i.e. the Windows agents need a remote Windows host. Skipping the scenario")
+		fts.Image = ""
+		return godog.ErrPending
+	}
 
 	profile := installer.profile // name of the runtime dependencies compose file
 
-	serviceName := ElasticAgentServiceName                                                     // name of the service
-	containerName := fmt.Sprintf("%s_%s_%s_%d", profile, fts.Image+"-systemd", serviceName, 1) // name of the container
+	serviceName := ElasticAgentServiceName // name of the service
 
-	uuid := uuid.New().String()
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(profile), fts.Image+"-systemd", serviceName, 1) // name of the container
 
 	// enroll the agent with a new token
-	tokenJSONObject, err := createFleetToken("Test token for "+uuid, fts.PolicyID)
+	enrollmentKey, err := fts.suite.createEnrollmentToken(fts.PolicyID)
 	if err != nil {
 		return err
 	}
-	fts.CurrentToken = tokenJSONObject.Path("api_key").Data().(string)
-	fts.CurrentTokenID = tokenJSONObject.Path("id").Data().(string)
+	fts.CurrentToken = enrollmentKey.APIKey
+	fts.CurrentTokenID = enrollmentKey.ID
 
-	err = deployAgentToFleet(installer, containerName, fts.CurrentToken)
+	// the installation process for TAR includes the enrollment
+	if installer.enrollsOnInstall() {
+		fts.EnrolledAt = time.Now()
+	}
+
+	err = deployAgentToFleet(installer, containerName, fts.fleetServerURL(), fts.CurrentToken, fts.Tags)
 	fts.Cleanup = true
 	if err != nil {
 		return err
 	}
 
-	// the installation process for TAR includes the enrollment
-	if installer.installerType != "tar" {
-		err = installer.EnrollFn(fts.CurrentToken)
+	if !installer.enrollsOnInstall() {
+		fts.EnrolledAt = time.Now()
+		err = installer.EnrollFn(fts.fleetServerURL(), fts.CurrentToken, fts.Tags)
 		if err != nil {
 			return err
 		}
 	}
 
-	// get container hostname once
-	hostname, err := getContainerHostname(containerName)
+	// get the hostname of the box once
+	hostname, err := fts.suite.deployer.getAgentHostname(containerName)
 	if err != nil {
 		return err
 	}
@@ -287,6 +386,20 @@ func (fts *FleetTestSuite) anAgentIsDeployedToFleetWithInstaller(image string, i
 	return err
 }
 
+// collectArtifacts writes the logs and the working dir of the agent under test into
+// the artifacts bundle of a failed scenario
+func (fts *FleetTestSuite) collectArtifacts(bundleDir string) error {
+	if fts.Image == "" || fts.InstallerType == "" {
+		return nil
+	}
+
+	installer := fts.getInstaller()
+
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(FleetProfileName), fts.Image+"-systemd", ElasticAgentServiceName, 1)
+
+	return installer.collectArtifacts(containerName, bundleDir)
+}
+
 func (fts *FleetTestSuite) getInstaller() ElasticAgentInstaller {
 	return fts.Installers[fts.Image+"-"+fts.InstallerType]
 }
@@ -298,10 +411,12 @@ func (fts *FleetTestSuite) processStateChangedOnTheHost(process string, state st
 
 	serviceName := installer.service // name of the service
 
+	fts.StatusChangedAt = time.Now()
+
 	if state == "started" {
-		return systemctlRun(profile, installer.image, serviceName, "start")
+		return serviceRun(installer.host, "start")
 	} else if state == "restarted" {
-		return systemctlRun(profile, installer.image, serviceName, "restart")
+		return serviceRun(installer.host, "restart")
 	} else if state == "uninstalled" {
 		return installer.UninstallFn()
 	} else if state != "stopped" {
@@ -313,7 +428,7 @@ func (fts *FleetTestSuite) processStateChangedOnTheHost(process string, state st
 		"process": process,
 	}).Trace("Stopping process on the service")
 
-	err := systemctlRun(profile, installer.image, serviceName, "stop")
+	err := serviceRun(installer.host, "stop")
 	if err != nil {
 		log.WithFields(log.Fields{
 			"action":  state,
@@ -329,19 +444,19 @@ func (fts *FleetTestSuite) processStateChangedOnTheHost(process string, state st
 	// we are using the Docker client instead of docker-compose
 	// because it does not support returning the output of a
 	// command: it simply returns error level
-	containerName := fmt.Sprintf("%s_%s_%s_%d", profile, fts.Image+"-systemd", ElasticAgentServiceName, 1)
-	return checkProcessStateOnTheHost(containerName, process, "stopped")
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(profile), fts.Image+"-systemd", ElasticAgentServiceName, 1)
+	return checkProcessStateOnTheHost(fts.suite.deployer, containerName, process, "stopped")
 }
 
 func (fts *FleetTestSuite) setup() error {
 	log.Trace("Creating Fleet setup")
 
-	err := createFleetConfiguration()
+	err := fts.suite.createFleetConfiguration()
 	if err != nil {
 		return err
 	}
 
-	err = checkFleetConfiguration()
+	err = fts.suite.checkFleetConfiguration()
 	if err != nil {
 		return err
 	}
@@ -350,71 +465,71 @@ func (fts *FleetTestSuite) setup() error {
 }
 
 func (fts *FleetTestSuite) theAgentIsListedInFleetWithStatus(desiredStatus string) error {
-	log.Tracef("Checking if agent is listed in Fleet as %s", desiredStatus)
+	err := fts.suite.waitForAgentStatus(fts.Hostname, desiredStatus)
+	if err != nil {
+		return err
+	}
 
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute * 2
-	retryCount := 1
+	if desiredStatus == "online" && !fts.EnrolledAt.IsZero() {
+		e2e.RecordMeasurement("enrollment", time.Since(fts.EnrolledAt))
+		fts.EnrolledAt = time.Time{}
+	}
 
-	exp := e2e.GetExponentialBackOff(maxTimeout)
+	return nil
+}
 
-	agentOnlineFn := func() error {
-		agentID, err := getAgentID(fts.Hostname)
+// theAgentStaysListedInFleetWithStatus waits for the agent to be listed in Fleet in a status, checking
+// that it keeps it for a number of seconds, i.e. that an upgraded agent stays healthy
+func (fts *FleetTestSuite) theAgentStaysListedInFleetWithStatus(desiredStatus string, seconds string) error {
+	duration, err := strconv.Atoi(seconds)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid number of seconds: %v", seconds, err)
+	}
+
+	err = fts.suite.waitForAgentStatus(fts.Hostname, desiredStatus)
+	if err != nil {
+		return err
+	}
+
+	agentID, err := fts.suite.getAgentID(fts.Hostname)
+	if err != nil {
+		return err
+	}
+	if agentID == "" {
+		return fmt.Errorf("The agent of the %s hostname is not listed in Fleet", fts.Hostname)
+	}
+
+	deadline := time.Now().Add(time.Duration(duration) * time.Second)
+	for {
+		agent, err := fts.suite.fleet.GetAgent(agentID)
 		if err != nil {
-			retryCount++
 			return err
 		}
 
-		if agentID == "" {
-			// the agent is not listed in Fleet
-			if desiredStatus == "offline" || desiredStatus == "inactive" {
-				log.WithFields(log.Fields{
-					"isAgentInStatus": isAgentInStatus,
-					"elapsedTime":     exp.GetElapsedTime(),
-					"hostname":        fts.Hostname,
-					"retries":         retryCount,
-					"status":          desiredStatus,
-				}).Info("The Agent is not present in Fleet, as expected")
-				return nil
-			} else if desiredStatus == "online" {
-				retryCount++
-				return fmt.Errorf("The agent is not present in Fleet, but it should")
-			}
-		}
-
-		isAgentInStatus, err := isAgentInStatus(agentID, desiredStatus)
-		if err != nil || !isAgentInStatus {
-			if err == nil {
-				err = fmt.Errorf("The Agent is not in the %s status yet", desiredStatus)
-			}
-
+		if !strings.EqualFold(agent.Status, desiredStatus) {
 			log.WithFields(log.Fields{
-				"agentID":         agentID,
-				"isAgentInStatus": isAgentInStatus,
-				"elapsedTime":     exp.GetElapsedTime(),
-				"hostname":        fts.Hostname,
-				"retry":           retryCount,
-				"status":          desiredStatus,
-			}).Warn(err.Error())
-
-			retryCount++
+				"agentID":       agentID,
+				"desiredStatus": desiredStatus,
+				"hostname":      fts.Hostname,
+				"status":        agent.Status,
+				"version":       agent.Version(),
+			}).Error("The agent did not stay in the desired status")
+			return fmt.Errorf("The agent of the %s hostname changed its status to %s, but it should stay %s", fts.Hostname, agent.Status, desiredStatus)
+		}
 
-			return err
+		if time.Now().After(deadline) {
+			break
 		}
 
-		log.WithFields(log.Fields{
-			"isAgentInStatus": isAgentInStatus,
-			"elapsedTime":     exp.GetElapsedTime(),
-			"hostname":        fts.Hostname,
-			"retries":         retryCount,
-			"status":          desiredStatus,
-		}).Info("The Agent is in the desired status")
-		return nil
+		time.Sleep(agentStatusPollInterval)
 	}
 
-	err := backoff.Retry(agentOnlineFn, exp)
-	if err != nil {
-		return err
-	}
+	log.WithFields(log.Fields{
+		"agentID":  agentID,
+		"hostname": fts.Hostname,
+		"seconds":  seconds,
+		"status":   desiredStatus,
+	}).Debug("The agent stayed in the desired status")
 
 	return nil
 }
@@ -428,14 +543,15 @@ func (fts *FleetTestSuite) theFileSystemAgentFolderIsEmpty() error {
 	// we are using the Docker client instead of docker-compose
 	// because it does not support returning the output of a
 	// command: it simply returns error level
-	containerName := fmt.Sprintf("%s_%s_%s_%d", profile, fts.Image+"-systemd", ElasticAgentServiceName, 1)
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(profile), fts.Image+"-systemd", ElasticAgentServiceName, 1)
 
 	content, err := installer.listElasticAgentWorkingDirContent(containerName)
 	if err != nil {
 		return err
 	}
 
-	if strings.Contains(content, "No such file or directory") {
+	// the error of ls in Linux, and of Get-ChildItem in Windows
+	if strings.Contains(content, "No such file or directory") || strings.Contains(content, "does not exist") {
 		return nil
 	}
 
@@ -443,33 +559,7 @@ func (fts *FleetTestSuite) theFileSystemAgentFolderIsEmpty() error {
 }
 
 func (fts *FleetTestSuite) theHostIsRestarted() error {
-	serviceManager := services.NewServiceManager()
-
-	installer := fts.getInstaller()
-
-	profile := installer.profile // name of the runtime dependencies compose file
-	image := installer.image     // image of the service
-	service := installer.service // name of the service
-
-	composes := []string{
-		profile, // profile name
-		image,   // service
-	}
-
-	err := serviceManager.RunCommand(profile, composes, []string{"restart", service}, profileEnv)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"image":   image,
-			"service": service,
-		}).Error("Could not restart the service")
-		return err
-	}
-
-	log.WithFields(log.Fields{
-		"image":   image,
-		"service": service,
-	}).Debug("The service has been restarted")
-	return nil
+	return fts.suite.deployer.restart(fts.getInstaller())
 }
 
 func (fts *FleetTestSuite) systemPackageDashboardsAreListedInFleet() error {
@@ -482,7 +572,7 @@ func (fts *FleetTestSuite) systemPackageDashboardsAreListedInFleet() error {
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
 	countDataStreamsFn := func() error {
-		dataStreams, err := getDataStreams()
+		dataStreams, err := fts.suite.fleet.ListDataStreams()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"retry":       retryCount,
@@ -494,7 +584,7 @@ func (fts *FleetTestSuite) systemPackageDashboardsAreListedInFleet() error {
 			return err
 		}
 
-		count := len(dataStreams.Children())
+		count := len(dataStreams)
 		if count == 0 {
 			err = fmt.Errorf("There are no datastreams yet")
 
@@ -533,6 +623,8 @@ func (fts *FleetTestSuite) systemPackageDashboardsAreListedInFleet() error {
 }
 
 func (fts *FleetTestSuite) theAgentIsUnenrolled() error {
+	fts.UnenrolledAt = time.Now()
+
 	return fts.unenrollHostname(false)
 }
 
@@ -541,7 +633,7 @@ func (fts *FleetTestSuite) theAgentIsReenrolledOnTheHost() error {
 
 	installer := fts.getInstaller()
 
-	err := installer.EnrollFn(fts.CurrentToken)
+	err := installer.EnrollFn(fts.fleetServerURL(), fts.CurrentToken, fts.Tags)
 	if err != nil {
 		return err
 	}
@@ -579,14 +671,14 @@ func (fts *FleetTestSuite) thePolicyShowsTheDatasourceAdded(packageName string)
 
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
-	integration, err := getIntegrationFromAgentPolicy(packageName, fts.PolicyID)
+	integration, err := fts.suite.fleet.GetPackagePolicyByTitle(fts.PolicyID, packageName)
 	if err != nil {
 		return err
 	}
 	fts.Integration = integration
 
 	configurationIsPresentFn := func() error {
-		defaultPolicy, err := getAgentDefaultPolicy()
+		policy, err := fts.suite.fleet.GetAgentPolicy(fts.PolicyID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error":    err,
@@ -599,13 +691,10 @@ func (fts *FleetTestSuite) thePolicyShowsTheDatasourceAdded(packageName string)
 			return err
 		}
 
-		packagePolicies := defaultPolicy.Path("package_policies")
-
-		for _, child := range packagePolicies.Children() {
-			id := child.Data().(string)
-			if id == fts.Integration.packageConfigID {
+		for _, packagePolicy := range policy.PackagePolicies {
+			if packagePolicy.ID == fts.Integration.ID {
 				log.WithFields(log.Fields{
-					"packageConfigID": fts.Integration.packageConfigID,
+					"packagePolicyID": fts.Integration.ID,
 					"policyID":        fts.PolicyID,
 				}).Info("The integration was found in the policy")
 				return nil
@@ -613,14 +702,14 @@ func (fts *FleetTestSuite) thePolicyShowsTheDatasourceAdded(packageName string)
 		}
 
 		log.WithFields(log.Fields{
-			"packageConfigID": fts.Integration.packageConfigID,
+			"packagePolicyID": fts.Integration.ID,
 			"policyID":        fts.PolicyID,
 			"retry":           retryCount,
 		}).Warn("The integration was not found in the policy")
 
 		retryCount++
 
-		return err
+		return fmt.Errorf("the %s integration in the %s policy: %w", packageName, fts.PolicyID, e2eerrors.ErrIntegrationNotFound)
 	}
 
 	err = backoff.Retry(configurationIsPresentFn, exp)
@@ -638,41 +727,39 @@ func (fts *FleetTestSuite) theIntegrationIsOperatedInThePolicy(packageName strin
 		"package":  packageName,
 	}).Trace("Doing an operation for a package on a policy")
 
-	if strings.ToLower(action) == actionADDED {
-		name, version, err := getIntegrationLatestVersion(packageName)
-		if err != nil {
-			return err
-		}
+	changedAt := time.Now()
 
-		integration, err := getIntegration(name, version)
+	if strings.ToLower(action) == actionADDED {
+		integration, err := fts.suite.fleet.GetPackageByTitle(packageName)
 		if err != nil {
 			return err
 		}
-		fts.Integration = integration
 
-		integrationPolicyID, err := addIntegrationToPolicy(fts.Integration, fts.PolicyID)
+		packagePolicy, err := fts.suite.addIntegrationToPolicy(integration, fts.PolicyID)
 		if err != nil {
 			return err
 		}
 
-		fts.Integration.packageConfigID = integrationPolicyID
+		fts.Integration = packagePolicy
+		fts.recordPolicyChange(changedAt)
 		return nil
 	} else if strings.ToLower(action) == actionREMOVED {
-		integration, err := getIntegrationFromAgentPolicy(packageName, fts.PolicyID)
+		integration, err := fts.suite.fleet.GetPackagePolicyByTitle(fts.PolicyID, packageName)
 		if err != nil {
 			return err
 		}
 		fts.Integration = integration
 
-		err = deleteIntegrationFromPolicy(fts.Integration, fts.PolicyID)
+		err = fts.suite.deleteIntegrationFromPolicy(fts.Integration)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"err":             err,
-				"packageConfigID": fts.Integration.packageConfigID,
+				"packagePolicyID": fts.Integration.ID,
 				"policyID":        fts.PolicyID,
 			}).Error("The integration could not be deleted from the policy")
 			return err
 		}
+		fts.recordPolicyChange(changedAt)
 		return nil
 	}
 
@@ -688,12 +775,11 @@ func (fts *FleetTestSuite) theHostNameIsNotShownInTheAdminViewInTheSecurityApp()
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
 	agentListedInSecurityFn := func() error {
-		host, err := isAgentListedInSecurityApp(fts.Hostname)
-		if err != nil {
+		host, err := fts.suite.fleet.GetEndpointHostByHostname(fts.Hostname)
+		if err != nil && !errors.Is(err, kibana.ErrNotFound) {
 			log.WithFields(log.Fields{
 				"elapsedTime": exp.GetElapsedTime(),
 				"err":         err,
-				"host":        host,
 				"hostname":    fts.Hostname,
 				"retry":       retryCount,
 			}).Warn("We could not check the agent in the Administration view in the Security App yet")
@@ -703,7 +789,7 @@ func (fts *FleetTestSuite) theHostNameIsNotShownInTheAdminViewInTheSecurityApp()
 			return err
 		}
 
-		if host != nil {
+		if err == nil {
 			log.WithFields(log.Fields{
 				"elapsedTime": exp.GetElapsedTime(),
 				"host":        host,
@@ -741,7 +827,7 @@ func (fts *FleetTestSuite) theHostNameIsShownInTheAdminViewInTheSecurityApp(stat
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
 	agentListedInSecurityFn := func() error {
-		matches, err := isAgentListedInSecurityAppWithStatus(fts.Hostname, status)
+		matches, err := fts.suite.isAgentListedInSecurityAppWithStatus(fts.Hostname, status)
 		if err != nil || !matches {
 			log.WithFields(log.Fields{
 				"elapsedTime":   exp.GetElapsedTime(),
@@ -791,18 +877,18 @@ func (fts *FleetTestSuite) anEndpointIsSuccessfullyDeployedWithAgentAndInstallle
 }
 
 func (fts *FleetTestSuite) thePolicyResponseWillBeShownInTheSecurityApp() error {
-	agentID, err := getAgentID(fts.Hostname)
+	agentID, err := fts.suite.getAgentID(fts.Hostname)
 	if err != nil {
 		return err
 	}
 
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute
+	maxTimeout := e2e.GetWaitTimeout(e2e.PolicyAppliedTimeout, time.Duration(timeoutFactor)*time.Minute)
 	retryCount := 1
 
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
 	getEventsFn := func() error {
-		listed, err := isPolicyResponseListedInSecurityApp(agentID)
+		listed, err := fts.suite.isPolicyResponseListedInSecurityApp(agentID)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"elapsedTime": exp.GetElapsedTime(),
@@ -837,70 +923,133 @@ func (fts *FleetTestSuite) thePolicyResponseWillBeShownInTheSecurityApp() error
 		return err
 	}
 
+	if !fts.PolicyUpdatedOn.IsZero() {
+		e2e.RecordMeasurement("policy-propagation", time.Since(fts.PolicyUpdatedOn))
+		fts.PolicyUpdatedOn = time.Time{}
+	}
+
 	return nil
 }
 
 func (fts *FleetTestSuite) thePolicyIsUpdatedToHaveMode(name string, mode string) error {
-	if name != "malware" {
-		log.WithFields(log.Fields{
-			"name": name,
-		}).Warn("We only support 'malware' policy to be updated")
-		return godog.ErrPending
-	}
-
-	if mode != "detect" && mode != "prevent" {
+	if mode != "detect" && mode != "prevent" && mode != "off" {
 		log.WithFields(log.Fields{
 			"name": name,
 			"mode": mode,
-		}).Warn("We only support 'detect' and 'prevent' modes")
+		}).Warn("We only support 'detect', 'prevent' and 'off' modes")
 		return godog.ErrPending
 	}
 
-	integration, err := getIntegrationFromAgentPolicy(elasticEnpointIntegrationTitle, fts.PolicyID)
+	return fts.updateIntegration(elasticEnpointIntegrationTitle, endpointProtectionOption{Mode: mode, Protection: name})
+}
+
+func (fts *FleetTestSuite) thePolicyIsUpdatedToHaveTheEvents(event string, state string) error {
+	return fts.updateIntegration(elasticEnpointIntegrationTitle, endpointEventsOption{Enabled: (state == "enabled"), Event: event})
+}
+
+// iConfigureTheIntegrationWith applies the settings of a data table to an integration in the
+// policy of the agent, i.e. "logfile.system.auth.paths | ["/var/log/secure"]"
+func (fts *FleetTestSuite) iConfigureTheIntegrationWith(packageName string, settings *godog.Table) error {
+	options, err := newIntegrationSettingOptions(settings)
 	if err != nil {
 		return err
 	}
-	fts.Integration = integration
 
-	integrationJSON := fts.Integration.json
+	return fts.updateIntegration(packageName, options...)
+}
 
-	// prune fields not allowed in the API side
-	prunedFields := []string{
-		"created_at", "created_by", "id", "revision", "updated_at", "updated_by",
-	}
-	for _, f := range prunedFields {
-		integrationJSON.Delete(f)
+// updateIntegration applies changes to the config of an integration in the policy of the agent,
+// keeping the updated integration to check the policy response
+func (fts *FleetTestSuite) updateIntegration(packageName string, options ...packagePolicyOption) error {
+	integration, err := fts.suite.fleet.GetPackagePolicyByTitle(fts.PolicyID, packageName)
+	if err != nil {
+		return err
 	}
 
-	// wee only support Windows and Mac, not Linux
-	integrationJSON.SetP(mode, "inputs.0.config.policy.value.windows."+name+".mode")
-	integrationJSON.SetP(mode, "inputs.0.config.policy.value.mac."+name+".mode")
+	fts.PolicyUpdatedOn = time.Now()
 
-	response, err := updateIntegrationPackageConfig(fts.Integration.packageConfigID, integrationJSON.String())
+	updatedIntegration, err := fts.suite.updateIntegrationPackageConfig(integration, options...)
 	if err != nil {
 		return err
 	}
+	fts.Integration = updatedIntegration
 
 	// we use a string because we are not able to process what comes in the event, so we will do
 	// an alphabetical order, as they share same layout but different millis and timezone format
-	updatedAt := response.Path("item.updated_at").Data().(string)
-	fts.PolicyUpdatedAt = updatedAt
+	fts.PolicyUpdatedAt = updatedIntegration.UpdatedAt
+	return nil
+}
+
+func (fts *FleetTestSuite) theUpdatedPolicyIsAppliedInTheSecurityApp() error {
+	agentID, err := fts.suite.getAgentID(fts.Hostname)
+	if err != nil {
+		return err
+	}
+
+	maxTimeout := e2e.GetWaitTimeout(e2e.PolicyAppliedTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	policyAppliedFn := func() error {
+		applied, err := fts.suite.isPolicyAppliedInSecurityApp(agentID, fts.Integration)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"err":         err,
+				"retries":     retryCount,
+			}).Warn("Could not get the policy response from the Administration view in the Security App yet")
+			retryCount++
+
+			return err
+		}
+
+		if !applied {
+			log.WithFields(log.Fields{
+				"agentID":     agentID,
+				"elapsedTime": exp.GetElapsedTime(),
+				"retries":     retryCount,
+				"revision":    fts.Integration.Revision,
+			}).Warn("The updated policy is not applied in the Administration view in the Security App yet")
+			retryCount++
+
+			return fmt.Errorf("The revision %d of the policy is not applied in the Administration view in the Security App yet", fts.Integration.Revision)
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"retries":     retryCount,
+			"revision":    fts.Integration.Revision,
+		}).Info("The updated policy is applied in the Administration view in the Security App")
+		return nil
+	}
+
+	err = backoff.Retry(policyAppliedFn, exp)
+	if err != nil {
+		return err
+	}
+
+	if !fts.PolicyUpdatedOn.IsZero() {
+		e2e.RecordMeasurement("policy-propagation", time.Since(fts.PolicyUpdatedOn))
+		fts.PolicyUpdatedOn = time.Time{}
+	}
+
 	return nil
 }
 
 func (fts *FleetTestSuite) thePolicyWillReflectTheChangeInTheSecurityApp() error {
-	agentID, err := getAgentID(fts.Hostname)
+	agentID, err := fts.suite.getAgentID(fts.Hostname)
 	if err != nil {
 		return err
 	}
 
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute * 2
+	maxTimeout := e2e.GetWaitTimeout(e2e.PolicyAppliedTimeout, time.Duration(timeoutFactor)*time.Minute*2)
 	retryCount := 1
 
 	exp := e2e.GetExponentialBackOff(maxTimeout)
 
 	getEventsFn := func() error {
-		err := getAgentEvents("endpoint-security", agentID, fts.Integration.packageConfigID, fts.PolicyUpdatedAt)
+		err := fts.suite.getAgentEvents("endpoint-security", agentID, fts.Integration.ID, fts.PolicyUpdatedAt)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"elapsedTime": exp.GetElapsedTime(),
@@ -934,37 +1083,36 @@ func (fts *FleetTestSuite) theVersionOfThePackageIsInstalled(version string, pac
 		"version": version,
 	}).Trace("Checking if package version is installed")
 
-	name, version, err := getIntegrationLatestVersion(packageName)
+	integration, err := fts.suite.fleet.GetPackageByTitle(packageName)
 	if err != nil {
 		return err
 	}
 
-	installedIntegration, err := installIntegrationAssets(name, version)
-	if err != nil {
-		return err
-	}
-	fts.Integration = installedIntegration
-
-	return nil
+	_, err = fts.suite.fleet.InstallPackage(integration.Name, integration.Version)
+	return err
 }
 
 func (fts *FleetTestSuite) anAttemptToEnrollANewAgentFails() error {
 	log.Trace("Enrolling a new agent with an revoked token")
 
+	if err := fts.suite.deployer.checkSeveralAgentsSupported(); err != nil {
+		return err
+	}
+
 	installer := fts.getInstaller()
 
 	profile := installer.profile // name of the runtime dependencies compose file
 
-	containerName := fmt.Sprintf("%s_%s_%s_%d", profile, fts.Image+"-systemd", ElasticAgentServiceName, 2) // name of the new container
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(profile), fts.Image+"-systemd", ElasticAgentServiceName, 2) // name of the new container
 
-	err := deployAgentToFleet(installer, containerName, fts.CurrentToken)
+	err := deployAgentToFleet(installer, containerName, fts.fleetServerURL(), fts.CurrentToken, fts.Tags)
 	// the installation process for TAR includes the enrollment
-	if installer.installerType != "tar" {
+	if !installer.enrollsOnInstall() {
 		if err != nil {
 			return err
 		}
 
-		err = installer.EnrollFn(fts.CurrentToken)
+		err = installer.EnrollFn(fts.fleetServerURL(), fts.CurrentToken, fts.Tags)
 		if err == nil {
 			err = fmt.Errorf("The agent was enrolled although the token was previously revoked")
 
@@ -983,9 +1131,9 @@ func (fts *FleetTestSuite) anAttemptToEnrollANewAgentFails() error {
 		return nil
 	}
 
-	// checking the error message produced by the install command in TAR installer
-	// to distinguish from other install errors
-	if err != nil && strings.HasPrefix(err.Error(), "Failed to install the agent with subcommand:") {
+	// the install command of the TAR installer fails with a revoked token, unlike the rest of errors
+	// of the deployment
+	if errors.Is(err, e2eerrors.ErrAgentInstallFailed) {
 		log.WithFields(log.Fields{
 			"err":   err,
 			"token": fts.CurrentToken,
@@ -997,16 +1145,11 @@ func (fts *FleetTestSuite) anAttemptToEnrollANewAgentFails() error {
 }
 
 func (fts *FleetTestSuite) removeToken() error {
-	revokeTokenURL := fleetEnrollmentTokenURL + "/" + fts.CurrentTokenID
-	deleteReq := createDefaultHTTPRequest(revokeTokenURL)
-
-	body, err := curl.Delete(deleteReq)
+	err := fts.suite.fleet.DeleteEnrollmentAPIKey(fts.CurrentTokenID)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"tokenID": fts.CurrentTokenID,
-			"body":    body,
 			"error":   err,
-			"url":     revokeTokenURL,
 		}).Error("Could not delete token")
 		return err
 	}
@@ -1018,91 +1161,81 @@ func (fts *FleetTestSuite) removeToken() error {
 	return nil
 }
 
-// unenrollHostname deletes the statuses for an existing agent, filtering by hostname
+// unenrollHostname deletes the statuses for the agent under test
 func (fts *FleetTestSuite) unenrollHostname(force bool) error {
-	log.Tracef("Un-enrolling all agentIDs for %s", fts.Hostname)
+	return fts.suite.unenrollAgentsOfHostname(fts.Hostname, force)
+}
 
-	jsonParsed, err := getOnlineAgents(true)
+// upgradeAgent triggers the upgrade of the agent under test to a version in Fleet, downloading
+// the snapshots from the snapshots site
+func (fts *FleetTestSuite) upgradeAgent(version string) error {
+	agentID, err := fts.suite.getAgentID(fts.Hostname)
 	if err != nil {
 		return err
 	}
+	if agentID == "" {
+		return fmt.Errorf("The agent of the %s hostname is not listed in Fleet", fts.Hostname)
+	}
 
-	hosts := jsonParsed.Path("list").Children()
-
-	for _, host := range hosts {
-		hostname := host.Path("local_metadata.host.hostname").Data().(string)
-		// a hostname has an agentID by status
-		if hostname == fts.Hostname {
-			agentID := host.Path("id").Data().(string)
-			log.WithFields(log.Fields{
-				"hostname": fts.Hostname,
-				"agentID":  agentID,
-			}).Debug("Un-enrolling agent in Fleet")
-
-			err := unenrollAgent(agentID, force)
-			if err != nil {
-				return err
-			}
-		}
+	sourceURI, err := getUpgradeSourceURI(version)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return fts.suite.fleet.UpgradeAgent(agentID, kibana.AgentUpgrade{
+		Force:     true,
+		SourceURI: sourceURI,
+		Version:   version,
+	})
 }
 
-func (fts *FleetTestSuite) upgradeAgent(version string) error {
-	agentID, err := getAgentID(fts.Hostname)
-	if err != nil {
-		return err
+// getUpgradeSourceURI returns the URI the agent downloads the artifact of a version from when it's
+// upgraded, which is read from the ELASTIC_AGENT_UPGRADE_SOURCE_URI env var. Else, it's empty for the
+// released versions, downloaded from the default site, and the downloads dir of the snapshot build
+// for the snapshots, i.e. https://snapshots.elastic.co/8.0.0-59098054/downloads/
+func getUpgradeSourceURI(version string) (string, error) {
+	if sourceURI := shell.GetEnv("ELASTIC_AGENT_UPGRADE_SOURCE_URI", ""); sourceURI != "" {
+		return sourceURI, nil
 	}
 
-	upgradeReq := curl.HTTPRequest{
-		BasicAuthUser:     "elastic",
-		BasicAuthPassword: "changeme",
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-			"kbn-xsrf":     "true",
-		},
-		URL:     fmt.Sprintf(fleetAgentUpgradeURL, agentID),
-		Payload: `{"version":"` + version + `", "force": true}`,
+	if !strings.HasSuffix(version, "-SNAPSHOT") {
+		return "", nil
 	}
 
-	if content, err := curl.Post(upgradeReq); err != nil {
-		return errors.Wrap(err, content)
+	// the agent downloads the artifact from the beats/elastic-agent path of the source URI
+	downloadURL, err := e2e.GetElasticArtifactURL("elastic-agent", version, "linux", config.GetArtifactArch("tar.gz"), "tar.gz")
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	index := strings.Index(downloadURL, "/beats/")
+	if index < 0 {
+		return "", fmt.Errorf("The source URI of the %s version cannot be derived from its download URL: %s", version, downloadURL)
+	}
+
+	return downloadURL[:index+1], nil
 }
 
 // checkFleetConfiguration checks that Fleet configuration is not missing
 // any requirements and is read. To achieve it, a GET request is executed
-func checkFleetConfiguration() error {
-	getReq := curl.HTTPRequest{
-		BasicAuthUser:     "elastic",
-		BasicAuthPassword: "changeme",
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-			"kbn-xsrf":     "e2e-tests",
-		},
-		URL: fleetSetupURL,
-	}
-
+func (sc *SuiteContext) checkFleetConfiguration() error {
 	log.Trace("Ensuring Fleet setup was initialised")
-	responseBody, err := curl.Get(getReq)
+	setup, err := sc.fleet.GetFleetSetup()
 	if err != nil {
 		log.WithFields(log.Fields{
-			"responseBody": responseBody,
+			"error": err,
 		}).Error("Could not check Kibana setup for Fleet")
 		return err
 	}
 
-	if !strings.Contains(responseBody, `"isReady":true,"missing_requirements":[]`) {
-		err = fmt.Errorf("Kibana has not been initialised: %s", responseBody)
+	if !setup.IsReady || len(setup.MissingRequirements) > 0 {
+		err = fmt.Errorf("Kibana has not been initialised: %+v", setup)
 		log.Error(err.Error())
 		return err
 	}
 
 	log.WithFields(log.Fields{
-		"responseBody": responseBody,
+		"setup": setup,
 	}).Info("Kibana setup initialised")
 
 	return nil
@@ -1110,103 +1243,26 @@ func checkFleetConfiguration() error {
 
 // createFleetConfiguration sends a POST request to Fleet forcing the
 // recreation of the configuration
-func createFleetConfiguration() error {
-	postReq := createDefaultHTTPRequest(fleetSetupURL)
-	postReq.Payload = `{
-		"forceRecreate": true
-	}`
-
-	body, err := curl.Post(postReq)
+func (sc *SuiteContext) createFleetConfiguration() error {
+	err := sc.fleet.SetupFleet()
 	if err != nil {
 		log.WithFields(log.Fields{
-			"body":  body,
 			"error": err,
-			"url":   fleetSetupURL,
 		}).Error("Could not initialise Fleet setup")
 		return err
 	}
 
-	log.WithFields(log.Fields{
-		"responseBody": body,
-	}).Info("Fleet setup done")
+	log.Info("Fleet setup done")
 
 	return nil
 }
 
-// createDefaultHTTPRequest Creates a default HTTP request, including the basic auth,
-// JSON content type header, and a specific header that is required by Kibana
-func createDefaultHTTPRequest(url string) curl.HTTPRequest {
-	return curl.HTTPRequest{
-		BasicAuthUser:     "elastic",
-		BasicAuthPassword: "changeme",
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-			"kbn-xsrf":     "e2e-tests",
-		},
-		URL: url,
-	}
-}
-
-// createFleetToken sends a POST request to Fleet creating a new token with a name
-func createFleetToken(name string, policyID string) (*gabs.Container, error) {
-	postReq := createDefaultHTTPRequest(fleetEnrollmentTokenURL)
-	postReq.Payload = `{
-		"policy_id": "` + policyID + `",
-		"name": "` + name + `"
-	}`
-
-	body, err := curl.Post(postReq)
+// deployAgentToFleet deploys the box of an installer and installs the agent in it, enrolling it with
+// a token into the Fleet Server at a URL, or into Kibana if it's empty, when the installer enrolls
+// on install
+func deployAgentToFleet(installer ElasticAgentInstaller, containerName string, fleetServerURL string, token string, tags []string) error {
+	err := installer.host.deployer.deploy(installer, containerName)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  body,
-			"error": err,
-			"url":   fleetSetupURL,
-		}).Error("Could not create Fleet token")
-		return nil, err
-	}
-
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
-	}
-
-	tokenItem := jsonParsed.Path("item")
-
-	log.WithFields(log.Fields{
-		"tokenId":  tokenItem.Path("id").Data().(string),
-		"apiKeyId": tokenItem.Path("api_key_id").Data().(string),
-	}).Debug("Fleet token created")
-
-	return tokenItem, nil
-}
-
-func deployAgentToFleet(installer ElasticAgentInstaller, containerName string, token string) error {
-	profile := installer.profile // name of the runtime dependencies compose file
-	service := installer.service // name of the service
-	serviceTag := installer.tag  // docker tag of the service
-
-	envVarsPrefix := strings.ReplaceAll(service, "-", "_")
-
-	// let's start with Centos 7
-	profileEnv[envVarsPrefix+"Tag"] = serviceTag
-	// we are setting the container name because Centos service could be reused by any other test suite
-	profileEnv[envVarsPrefix+"ContainerName"] = containerName
-	// define paths where the binary will be mounted
-	profileEnv[envVarsPrefix+"AgentBinarySrcPath"] = installer.path
-	profileEnv[envVarsPrefix+"AgentBinaryTargetPath"] = "/" + installer.name
-
-	serviceManager := services.NewServiceManager()
-
-	err := serviceManager.AddServicesToCompose(profile, []string{service}, profileEnv)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"service": service,
-			"tag":     serviceTag,
-		}).Error("Could not run the target box")
 		return err
 	}
 
@@ -1215,7 +1271,7 @@ func deployAgentToFleet(installer ElasticAgentInstaller, containerName string, t
 		return err
 	}
 
-	err = installer.InstallFn(containerName, token)
+	err = installer.InstallFn(containerName, fleetServerURL, token, tags)
 	if err != nil {
 		return err
 	}
@@ -1223,95 +1279,41 @@ func deployAgentToFleet(installer ElasticAgentInstaller, containerName string, t
 	return installer.PostInstallFn()
 }
 
-// getAgentDefaultPolicy sends a GET request to Fleet for the existing default policy
-func getAgentDefaultPolicy() (*gabs.Container, error) {
-	r := createDefaultHTTPRequest(ingestManagerAgentPoliciesURL)
-	body, err := curl.Get(r)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  body,
-			"error": err,
-			"url":   ingestManagerAgentPoliciesURL,
-		}).Error("Could not get Fleet's policies")
-		return nil, err
-	}
-
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
-	}
-
-	// data streams should contain array of elements
-	policies := jsonParsed.Path("items")
-
-	log.WithFields(log.Fields{
-		"count": len(policies.Children()),
-	}).Trace("Fleet policies retrieved")
-
-	// TODO: perform a strong check to capture default policy
-	defaultPolicy := policies.Index(0)
-
-	return defaultPolicy, nil
-}
-
-func getAgentEvents(applicationName string, agentID string, packagePolicyID string, updatedAt string) error {
-	url := fmt.Sprintf(fleetAgentEventsURL, agentID)
-	getReq := createDefaultHTTPRequest(url)
-	getReq.QueryString = "page=1&perPage=20"
-
-	body, err := curl.Get(getReq)
+func (sc *SuiteContext) getAgentEvents(applicationName string, agentID string, packagePolicyID string, updatedAt string) error {
+	events, err := sc.fleet.ListAgentEvents(agentID)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"agentID":         agentID,
 			"application":     applicationName,
-			"body":            body,
 			"error":           err,
 			"packagePolicyID": packagePolicyID,
-			"url":             url,
 		}).Error("Could not get agent events from Fleet")
 		return err
 	}
 
-	jsonResponse, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return err
-	}
-
-	listItems := jsonResponse.Path("list").Children()
-	for _, item := range listItems {
-		message := item.Path("message").Data().(string)
+	for _, event := range events {
 		// we use a string because we are not able to process what comes in the event, so we will do
 		// an alphabetical order, as they share same layout but different millis and timezone format
-		timestamp := item.Path("timestamp").Data().(string)
-
 		log.WithFields(log.Fields{
 			"agentID":         agentID,
 			"application":     applicationName,
-			"event_at":        timestamp,
-			"message":         message,
+			"event_at":        event.Timestamp,
+			"message":         event.Message,
 			"packagePolicyID": packagePolicyID,
 			"updated_at":      updatedAt,
 		}).Trace("Event found")
 
-		matches := (strings.Contains(message, applicationName) &&
-			strings.Contains(message, "["+agentID+"]: State changed to") &&
-			strings.Contains(message, "Protecting with policy {"+packagePolicyID+"}"))
+		matches := (strings.Contains(event.Message, applicationName) &&
+			strings.Contains(event.Message, "["+agentID+"]: State changed to") &&
+			strings.Contains(event.Message, "Protecting with policy {"+packagePolicyID+"}"))
 
-		if matches && timestamp > updatedAt {
+		if matches && event.Timestamp > updatedAt {
 			log.WithFields(log.Fields{
 				"application":     applicationName,
-				"event_at":        timestamp,
+				"event_at":        event.Timestamp,
 				"packagePolicyID": packagePolicyID,
 				"updated_at":      updatedAt,
-				"message":         message,
+				"message":         event.Message,
 			}).Info("Event after the update was found")
 			return nil
 		}
@@ -1321,145 +1323,168 @@ func getAgentEvents(applicationName string, agentID string, packagePolicyID stri
 }
 
 // getAgentID sends a GET request to Fleet for a existing hostname
-// This method will retrieve the only agent ID for a hostname in the online status
-func getAgentID(agentHostname string) (string, error) {
+// This method will retrieve the only agent ID for a hostname in the online status,
+// which is empty if the hostname has no agent
+func (sc *SuiteContext) getAgentID(agentHostname string) (string, error) {
 	log.Tracef("Retrieving agentID for %s", agentHostname)
 
-	jsonParsed, err := getOnlineAgents(false)
-	if err != nil {
+	agent, err := sc.fleet.GetAgentByHostname(agentHostname)
+	if errors.Is(err, kibana.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
 		return "", err
 	}
 
-	hosts := jsonParsed.Path("list").Children()
+	log.WithFields(log.Fields{
+		"hostname": agentHostname,
+		"agentID":  agent.ID,
+	}).Debug("Agent listed in Fleet with online status")
 
-	for _, host := range hosts {
-		hostname := host.Path("local_metadata.host.hostname").Data().(string)
-		if hostname == agentHostname {
-			agentID := host.Path("id").Data().(string)
-			log.WithFields(log.Fields{
-				"hostname": agentHostname,
-				"agentID":  agentID,
-			}).Debug("Agent listed in Fleet with online status")
-			return agentID, nil
-		}
+	return agent.ID, nil
+}
+
+// isAgentInStatus extracts the status for an agent, identified by its hostname
+// It will query Fleet's agents endpoint
+func (sc *SuiteContext) isAgentInStatus(agentID string, desiredStatus string) (bool, error) {
+	agent, err := sc.fleet.GetAgent(agentID)
+	if err != nil {
+		return false, err
 	}
 
-	return "", nil
+	return strings.EqualFold(agent.Status, desiredStatus), nil
 }
 
-// getDataStreams sends a GET request to Fleet for the existing data-streams
-// if called prior to any Agent being deployed it should return a list of
-// zero data streams as: { "data_streams": [] }. If called after the Agent
-// is running, it will return a list of (currently in 7.8) 20 streams
-func getDataStreams() (*gabs.Container, error) {
-	r := createDefaultHTTPRequest(ingestManagerDataStreamsURL)
-	body, err := curl.Get(r)
+// unenrollAgentsOfHostname deletes the statuses for an existing agent, filtering by hostname, so
+// that the agent is found no matter how many agents are listed in Fleet
+func (sc *SuiteContext) unenrollAgentsOfHostname(agentHostname string, force bool) error {
+	log.Tracef("Un-enrolling all agentIDs for %s", agentHostname)
+
+	agents, err := sc.fleet.ListAgents(kibana.AgentsQuery{
+		Kuery:        kibana.AgentsByHostname(agentHostname),
+		ShowInactive: true,
+	})
 	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  body,
-			"error": err,
-			"url":   ingestManagerDataStreamsURL,
-		}).Error("Could not get Fleet's data streams for the agent")
-		return nil, err
+		return err
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
+	for _, agent := range agents {
+		// a hostname has an agentID by status
+		if agent.Hostname() == agentHostname {
+			log.WithFields(log.Fields{
+				"hostname": agentHostname,
+				"agentID":  agent.ID,
+			}).Debug("Un-enrolling agent in Fleet")
+
+			err := sc.fleet.UnenrollAgent(agent.ID, force)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	// data streams should contain array of elements
-	dataStreams := jsonParsed.Path("data_streams")
+	return nil
+}
 
+// waitForAgentStatus waits for the agent of a hostname to be listed in Fleet in a status
+func (sc *SuiteContext) waitForAgentStatus(hostname string, desiredStatus string) error {
 	log.WithFields(log.Fields{
-		"count": len(dataStreams.Children()),
-	}).Debug("Data Streams retrieved")
+		"hostname": hostname,
+		"status":   desiredStatus,
+	}).Trace("Checking if agent is listed in Fleet")
 
-	return dataStreams, nil
-}
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	retryCount := 1
 
-// getOnlineAgents sends a GET request to Fleet for the existing online agents
-// Will return the JSON object representing the response of querying Fleet's Agents
-// endpoint
-func getOnlineAgents(showInactive bool) (*gabs.Container, error) {
-	r := createDefaultHTTPRequest(fleetAgentsURL)
-	// let's not URL encode the querystring, as it seems Kibana is not handling
-	// the request properly, returning an 400 Bad Request error with this message:
-	// [request query.page=1&perPage=20&showInactive=true]: definition for this key is missing
-	r.EncodeURL = false
-	r.QueryString = fmt.Sprintf("page=1&perPage=20&showInactive=%t", showInactive)
-
-	body, err := curl.Get(r)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"body":  body,
-			"error": err,
-			"url":   r.GetURL(),
-		}).Error("Could not get Fleet's online agents")
-		return nil, err
-	}
+	exp := e2e.GetExponentialBackOff(maxTimeout)
 
-	jsonResponse, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
-	}
+	agentOnlineFn := func() error {
+		agentID, err := sc.getAgentID(hostname)
+		if err != nil {
+			retryCount++
+			return err
+		}
 
-	return jsonResponse, nil
-}
+		if agentID == "" {
+			// the agent is not listed in Fleet
+			if desiredStatus == "offline" || desiredStatus == "inactive" {
+				log.WithFields(log.Fields{
+					"elapsedTime": exp.GetElapsedTime(),
+					"hostname":    hostname,
+					"retries":     retryCount,
+					"status":      desiredStatus,
+				}).Info("The Agent is not present in Fleet, as expected")
+				return nil
+			} else if desiredStatus == "online" {
+				retryCount++
+				return fmt.Errorf("the agent of the %s hostname: %w", hostname, e2eerrors.ErrAgentNotListed)
+			}
+		}
+
+		isAgentInStatus, err := sc.isAgentInStatus(agentID, desiredStatus)
+		if err != nil || !isAgentInStatus {
+			if err == nil {
+				err = fmt.Errorf("The Agent is not in the %s status yet", desiredStatus)
+			}
+
+			log.WithFields(log.Fields{
+				"agentID":         agentID,
+				"isAgentInStatus": isAgentInStatus,
+				"elapsedTime":     exp.GetElapsedTime(),
+				"hostname":        hostname,
+				"retry":           retryCount,
+				"status":          desiredStatus,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
 
-// isAgentInStatus extracts the status for an agent, identified by its hostname
-// It will query Fleet's agents endpoint
-func isAgentInStatus(agentID string, desiredStatus string) (bool, error) {
-	r := createDefaultHTTPRequest(fleetAgentsURL + "/" + agentID)
-	body, err := curl.Get(r)
-	if err != nil {
 		log.WithFields(log.Fields{
-			"body":  body,
-			"error": err,
-			"url":   r.GetURL(),
-		}).Error("Could not get agent in Fleet")
-		return false, err
+			"isAgentInStatus": isAgentInStatus,
+			"elapsedTime":     exp.GetElapsedTime(),
+			"hostname":        hostname,
+			"retries":         retryCount,
+			"status":          desiredStatus,
+		}).Info("The Agent is in the desired status")
+		return nil
 	}
 
-	jsonResponse, err := gabs.ParseJSON([]byte(body))
-
-	agentStatus := jsonResponse.Path("item.status").Data().(string)
+	err := backoff.Retry(agentOnlineFn, exp)
+	if err != nil {
+		return &e2eerrors.StatusTimeoutError{
+			Elapsed:  exp.GetElapsedTime(),
+			Err:      err,
+			Resource: fmt.Sprintf("the agent of the %s hostname", hostname),
+			Status:   desiredStatus,
+		}
+	}
 
-	return (strings.ToLower(agentStatus) == strings.ToLower(desiredStatus)), nil
+	return nil
 }
 
-func unenrollAgent(agentID string, force bool) error {
-	unEnrollURL := fmt.Sprintf(fleetAgentsUnEnrollURL, agentID)
-	postReq := createDefaultHTTPRequest(unEnrollURL)
+// waitForAgentVersion waits for the agent of a hostname to be listed in Fleet in a version
+func (sc *SuiteContext) waitForAgentVersion(hostname string, version string) error {
+	agentInVersionFn := func() error {
+		agentID, err := sc.getAgentID(hostname)
+		if err != nil {
+			return err
+		}
 
-	if force {
-		postReq.Payload = `{
-			"force": true
-		}`
-	}
+		retrievedVersion, err := sc.fleet.GetAgentVersion(agentID)
+		if err != nil {
+			return err
+		}
 
-	body, err := curl.Post(postReq)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"agentID": agentID,
-			"body":    body,
-			"error":   err,
-			"url":     unEnrollURL,
-		}).Error("Could unenroll agent")
-		return err
+		if retrievedVersion != version {
+			return fmt.Errorf("version mismatch required '%s' retrieved '%s'", version, retrievedVersion)
+		}
+
+		return nil
 	}
 
-	log.WithFields(log.Fields{
-		"agentID": agentID,
-	}).Debug("Fleet agent was unenrolled")
+	maxTimeout := e2e.GetWaitTimeout(e2e.AgentEnrollTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	exp := e2e.GetExponentialBackOff(maxTimeout)
 
-	return nil
+	return backoff.Retry(agentInVersionFn, exp)
 }
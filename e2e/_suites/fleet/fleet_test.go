@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana/kibanatest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnenrollAgentsOfHostname(t *testing.T) {
+	s := kibanatest.NewServer()
+	defer s.Close()
+
+	// more agents than the ones listed in a page by default
+	hostnames := addFakeAgents(s, kibanatest.DefaultPolicyID, "online", "agent", 30)
+	hostname := hostnames[len(hostnames)-1]
+
+	sc := newFakeSuiteContext(s)
+
+	assert.Nil(t, sc.unenrollAgentsOfHostname(hostname, false))
+
+	agentID, err := sc.getAgentID(hostname)
+	assert.Nil(t, err)
+	isUnenrolling, err := sc.isAgentInStatus(agentID, "unenrolling")
+	assert.Nil(t, err)
+	assert.True(t, isUnenrolling)
+
+	assert.Nil(t, sc.unenrollAgentsOfHostname(hostname, true))
+
+	// the agent is not listed once it's inactive
+	agentID, err = sc.getAgentID(hostname)
+	assert.Nil(t, err)
+	assert.Equal(t, "", agentID)
+
+	count, err := s.Client().CountAgents(kibana.AgentsQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, len(hostnames)-1, count)
+}
+
+func TestUnenrollAgentsOfHostnames(t *testing.T) {
+	s := kibanatest.NewServer()
+	defer s.Close()
+
+	bulk := addFakeAgents(s, kibanatest.DefaultPolicyID, "online", "bulk", bulkAgentsPerPage+20)
+	addFakeAgents(s, kibanatest.DefaultPolicyID, "online", "other", 5)
+
+	sc := newFakeSuiteContext(s)
+
+	assert.Nil(t, sc.unenrollAgentsOfHostnames(bulk))
+
+	count, err := sc.countAgentsOfHostnames(kibanatest.DefaultPolicyID, "online", bulk)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = s.Client().CountAgents(kibana.AgentsQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+}
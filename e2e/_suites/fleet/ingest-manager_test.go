@@ -7,25 +7,32 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/cucumber/godog"
-	"github.com/cucumber/messages-go/v10"
 	"github.com/elastic/e2e-testing/cli/config"
 	"github.com/elastic/e2e-testing/cli/docker"
-	"github.com/elastic/e2e-testing/cli/services"
 	"github.com/elastic/e2e-testing/cli/shell"
 	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/chaos"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/pkg/datagen"
+	"github.com/elastic/e2e-testing/e2e/pkg/steps"
+	"github.com/elastic/e2e-testing/e2e/runner"
 	log "github.com/sirupsen/logrus"
 )
 
 // developerMode tears down the backend services (ES, Kibana, Package Registry)
 // after a test suite. This is the desired behavior, but when developing, we maybe want to keep
 // them running to speed up the development cycle.
-// It can be overriden by the DEVELOPER_MODE env var
+// It can be overriden by the DEVELOPER_MODE env var, or the --keep-stack flag
 var developerMode = false
 
 // ElasticAgentProcessName the name of the process for the Elastic Agent
@@ -34,8 +41,10 @@ const ElasticAgentProcessName = "elastic-agent"
 // ElasticAgentServiceName the name of the service for the Elastic Agent
 const ElasticAgentServiceName = "elastic-agent"
 
-// FleetProfileName the name of the profile to run the runtime, backend services
-const FleetProfileName = "fleet"
+// FleetProfileName the name of the profile to run the runtime, backend services, which is
+// its secured variant, i.e. fleet-secured, when the stack is secured, and its cluster variant,
+// i.e. fleet-cluster-secured, when the stack runs a multi-node Elasticsearch cluster
+var FleetProfileName = "fleet"
 
 var agentVersionBase = "8.0.0-SNAPSHOT"
 
@@ -47,147 +56,273 @@ var agentVersion = agentVersionBase
 // It can be overriden by ELASTIC_AGENT_STALE_VERSION env var. Using latest GA as a default.
 var agentStaleVersion = "7.10.0"
 
+// stackSecured runs the stack with TLS and authentication enabled everywhere, generating a CA
+// and the certificates of the services at the beginning of the suite, which are trusted by the
+// test framework and the agents. It can be overriden by STACK_SECURED env var
+var stackSecured = true
+
+// stackCluster runs a multi-node Elasticsearch cluster, with a dedicated master, sized with the
+// ELASTICSEARCH_CLUSTER_SIZE and ELASTICSEARCH_HEAP_SIZE env vars, so that the scenarios restart
+// its nodes. It can be overriden by STACK_CLUSTER env var
+var stackCluster = false
+
 // stackVersion is the version of the stack to use
 // It can be overriden by STACK_VERSION env var
 var stackVersion = agentVersionBase
 
-// profileEnv is the environment to be applied to any execution
-// affecting the runtime dependencies (or profile)
-var profileEnv map[string]string
+// stackUpgradeVersion is the version the stack is upgraded to in place by the scenarios upgrading it
+// under the running agents, which is the "next" alias of their steps. It can be overriden by
+// STACK_UPGRADE_VERSION env var
+var stackUpgradeVersion = ""
+
+// packageRegistryImage is the docker image of the Elastic Package Registry run by the profile, which
+// can be pinned to a distribution, i.e. docker.elastic.co/package-registry/distribution:<tag or digest>,
+// a snapshot, or a locally built image, so that the tests are not broken by the changes of the public one.
+// It can be overriden by PACKAGE_REGISTRY_IMAGE env var
+var packageRegistryImage = "docker.elastic.co/package-registry/distribution:staging"
+
+// packageRegistryURL is the URL of the Elastic Package Registry used by Kibana, which defaults
+// to the one run by the profile. It can be overriden by PACKAGE_REGISTRY_URL env var
+var packageRegistryURL = ""
+
+// policyPerScenario makes each scenario create its own policy, named after the scenario, instead of
+// using the default one, deleting it in its teardown, so that the scenarios do not interfere with
+// each other. It can be overriden by FLEET_POLICY_PER_SCENARIO env var
+var policyPerScenario = false
 
 // timeoutFactor a multiplier for the max timeout when doing backoff retries.
 // It can be overriden by TIMEOUT_FACTOR env var
 var timeoutFactor = 3
 
-// All URLs running on localhost as Kibana is expected to be exposed there
-const kibanaBaseURL = "http://localhost:5601"
-
-var kibanaClient *services.KibanaClient
-
 func init() {
-	config.Init()
+	// the binaries of the container runtime are checked once the suite runs its scenarios
+	config.InitWorkspace()
 
-	kibanaClient = services.NewKibanaClient()
+	timeoutFactor = shell.GetEnvInteger("TIMEOUT_FACTOR", timeoutFactor)
+	agentVersion = shell.GetEnv("ELASTIC_AGENT_VERSION", agentVersionBase)
+	agentStaleVersion = shell.GetEnv("ELASTIC_AGENT_STALE_VERSION", agentStaleVersion)
 
-	developerMode, _ = shell.GetEnvBool("DEVELOPER_MODE")
-	if developerMode {
-		log.Info("Running in Developer mode 💻: runtime dependencies between different test runs will be reused to speed up dev cycle")
+	stackVersion = shell.GetEnv("STACK_VERSION", stackVersion)
+	stackUpgradeVersion = shell.GetEnv("STACK_UPGRADE_VERSION", stackUpgradeVersion)
+	if secured, err := shell.GetEnvBool("STACK_SECURED"); err == nil {
+		stackSecured = secured
+	}
+	if cluster, err := shell.GetEnvBool("STACK_CLUSTER"); err == nil {
+		stackCluster = cluster
+	}
+	if stackCluster {
+		FleetProfileName = config.GetClusterProfile(FleetProfileName)
+	}
+	if stackSecured {
+		FleetProfileName = config.GetSecuredProfile(FleetProfileName)
+	}
+	packageRegistryImage = shell.GetEnv("PACKAGE_REGISTRY_IMAGE", packageRegistryImage)
+	packageRegistryURL = shell.GetEnv("PACKAGE_REGISTRY_URL", packageRegistryURL)
+	if perScenario, err := shell.GetEnvBool("FLEET_POLICY_PER_SCENARIO"); err == nil {
+		policyPerScenario = perScenario
 	}
+}
 
-	// check if base version is an alias
-	agentVersionBase = e2e.GetElasticArtifactVersion(agentVersionBase)
+func TestMain(m *testing.M) {
+	// the unit tests of the suite run without the stack, nor the artifacts API
+	if !e2e.IsSuiteRequested() {
+		os.Exit(m.Run())
+	}
 
-	timeoutFactor = shell.GetEnvInteger("TIMEOUT_FACTOR", timeoutFactor)
-	agentVersion = shell.GetEnv("ELASTIC_AGENT_VERSION", agentVersionBase)
-	agentStaleVersion = shell.GetEnv("ELASTIC_AGENT_STALE_VERSION", agentStaleVersion)
+	config.Init()
+	resolveAgentVersionAliases()
 
-	// check if version is an alias
-	agentVersion = e2e.GetElasticArtifactVersion(agentVersion)
+	sc := NewSuiteContext(kibana.NewClient(), newAgentDeployer())
 
-	stackVersion = shell.GetEnv("STACK_VERSION", stackVersion)
+	os.Exit(newFleetSuite(sc).Run())
 }
 
-func IngestManagerFeatureContext(s *godog.Suite) {
-	imts := IngestManagerTestSuite{
+// resolveAgentVersionAliases resolves the versions of the agent which are aliases, i.e. 8.0-SNAPSHOT,
+// in the artifacts API, once the suite runs its scenarios
+func resolveAgentVersionAliases() {
+	agentVersionBase = e2e.GetElasticArtifactVersion(agentVersionBase)
+
+	agentVersion = e2e.GetElasticArtifactVersion(shell.GetEnv("ELASTIC_AGENT_VERSION", agentVersionBase))
+}
+
+// NewIngestManagerTestSuite returns the state of the suite shared by its hooks and the steps of its
+// scenarios, with the installers of the agents deployed by the deployer of the context of the suite
+func NewIngestManagerTestSuite(sc *SuiteContext) *IngestManagerTestSuite {
+	// the Windows agents are deployed to remote Windows hosts, where the Linux agents cannot be deployed
+	installers := map[string]ElasticAgentInstaller{}
+	if sc.deployer.boxOS() == windowsOS {
+		installers["windows-msi"] = GetElasticAgentInstaller(sc.deployer, "windows", "msi", agentVersion)
+		installers["windows-zip"] = GetElasticAgentInstaller(sc.deployer, "windows", "zip", agentVersion)
+	} else {
+		installers["amazonlinux-systemd"] = GetElasticAgentInstaller(sc.deployer, "amazonlinux", "systemd", agentVersion)
+		installers["amazonlinux-tar"] = GetElasticAgentInstaller(sc.deployer, "amazonlinux", "tar", agentVersion)
+		installers["centos-systemd"] = GetElasticAgentInstaller(sc.deployer, "centos", "systemd", agentVersion)
+		installers["centos-tar"] = GetElasticAgentInstaller(sc.deployer, "centos", "tar", agentVersion)
+		installers["debian-systemd"] = GetElasticAgentInstaller(sc.deployer, "debian", "systemd", agentVersion)
+		installers["debian-tar"] = GetElasticAgentInstaller(sc.deployer, "debian", "tar", agentVersion)
+		installers["ubuntu-systemd"] = GetElasticAgentInstaller(sc.deployer, "ubuntu", "systemd", agentVersion)
+		installers["ubuntu-tar"] = GetElasticAgentInstaller(sc.deployer, "ubuntu", "tar", agentVersion)
+	}
+
+	return &IngestManagerTestSuite{
 		Fleet: &FleetTestSuite{
-			Installers: map[string]ElasticAgentInstaller{
-				"centos-systemd": GetElasticAgentInstaller("centos", "systemd"),
-				"centos-tar":     GetElasticAgentInstaller("centos", "tar"),
-				"debian-systemd": GetElasticAgentInstaller("debian", "systemd"),
-				"debian-tar":     GetElasticAgentInstaller("debian", "tar"),
-			},
+			Installers: installers,
+			suite:      sc,
 		},
-		StandAlone: &StandAloneTestSuite{},
+		StandAlone: &StandAloneTestSuite{
+			Installers: installers,
+			suite:      sc,
+		},
+		suite: sc,
 	}
-	serviceManager := services.NewServiceManager()
+}
 
-	s.Step(`^the "([^"]*)" process is in the "([^"]*)" state on the host$`, imts.processStateOnTheHost)
+// newFleetSuite returns the Fleet suite, running the Fleet profile, secured and clustered when the
+// stack is, with the images of the boxes of the agents pulled, and setting Fleet up, for a context
+// of the suite
+func newFleetSuite(sc *SuiteContext) *runner.Suite {
+	imts := NewIngestManagerTestSuite(sc)
 
-	imts.Fleet.contributeSteps(s)
-	imts.StandAlone.contributeSteps(s)
+	reportProperties := map[string]string{
+		"agentVersion":         agentVersion,
+		"packageRegistryImage": packageRegistryImage,
+		"stackVersion":         stackVersion,
+	}
+	if packageRegistryURL != "" {
+		reportProperties["packageRegistryURL"] = packageRegistryURL
+	}
 
-	s.BeforeSuite(func() {
-		log.Trace("Installing Fleet runtime dependencies")
+	sc.runner = runner.New(runner.Options{
+		Name:             "fleet",
+		Profile:          FleetProfileName,
+		ReportProperties: reportProperties,
+		Timeout:          time.Duration(timeoutFactor) * time.Minute,
+		LocalImages:      ElasticAgentServiceName,
+		Kibana:           true,
+		ProfileEnv: func() (map[string]string, error) {
+			return fleetProfileEnv(sc)
+		},
+		PullServices: func(profileEnv map[string]string) ([]string, map[string]string) {
+			boxes, boxesEnv := sc.deployer.boxServices(imts.Fleet.Installers)
+			for k, v := range profileEnv {
+				boxesEnv[k] = v
+			}
 
-		workDir, _ := os.Getwd()
-		profileEnv = map[string]string{
-			"stackVersion":     stackVersion,
-			"kibanaConfigPath": path.Join(workDir, "configurations", "kibana.config.yml"),
-		}
+			return boxes, boxesEnv
+		},
+		BeforeSuite: func() {
+			developerMode = e2e.IsDeveloperMode()
 
-		profile := FleetProfileName
-		err := serviceManager.RunCompose(true, []string{profile}, profileEnv)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"profile": profile,
-			}).Fatal("Could not run the runtime dependencies for the profile.")
-		}
+			imts.Fleet.setup()
 
-		minutesToBeHealthy := time.Duration(timeoutFactor) * time.Minute
-		healthy, err := e2e.WaitForElasticsearch(minutesToBeHealthy)
-		if !healthy {
-			log.WithFields(log.Fields{
-				"error":   err,
-				"minutes": minutesToBeHealthy,
-			}).Fatal("The Elasticsearch cluster could not get the healthy status")
-		}
+			imts.StandAlone.RuntimeDependenciesStartDate = time.Now().UTC()
+		},
+		AfterSuite: func() {
+			removeAgentBinaries(imts.Fleet.Installers)
+		},
+		Scenario:           InitializeIngestManagerScenario(imts),
+		StepBundles:        steps.AllBundles,
+		ArtifactCollectors: []e2e.ArtifactCollector{imts.Fleet.collectArtifacts},
+		CleanDataStreams:   true,
+		ResolveVersion:     resolveStackVersion,
+	})
 
-		healthyKibana, err := kibanaClient.WaitForKibana(minutesToBeHealthy)
-		if !healthyKibana {
-			log.WithFields(log.Fields{
-				"error":   err,
-				"minutes": minutesToBeHealthy,
-			}).Fatal("The Kibana instance could not get the healthy status")
+	return sc.runner
+}
+
+// fleetProfileEnv returns the environment of the Fleet profile, generating the certificates of the
+// secured stack, and configuring Kibana to use the Package Registry. It's the environment of the
+// context of the suite, which the steps change
+func fleetProfileEnv(sc *SuiteContext) (map[string]string, error) {
+	kibanaConfigFile := "kibana.config.yml"
+	if stackSecured {
+		kibanaConfigFile = "kibana-secured.config.yml"
+
+		_, err := config.GenerateCerts()
+		if err != nil {
+			return nil, fmt.Errorf("could not generate the certificates of the secured stack: %v", err)
 		}
+	}
 
-		imts.Fleet.setup()
+	workDir, _ := os.Getwd()
+	kibanaConfigPath, err := getKibanaConfigPath(path.Join(workDir, "configurations", kibanaConfigFile))
+	if err != nil {
+		return nil, fmt.Errorf("could not configure Kibana to use the Package Registry at %s: %v", packageRegistryURL, err)
+	}
 
-		imts.StandAlone.RuntimeDependenciesStartDate = time.Now().UTC()
-	})
-	s.BeforeScenario(func(*messages.Pickle) {
-		log.Trace("Before Fleet scenario")
+	profileEnv := map[string]string{
+		"stackVersion":         stackVersion,
+		"kibanaConfigPath":     kibanaConfigPath,
+		"packageRegistryImage": packageRegistryImage,
+	}
+	if stackCluster {
+		profileEnv, err = config.PutClusterEnvironment(profileEnv)
+		if err != nil {
+			return nil, fmt.Errorf("could not configure the Elasticsearch cluster of the profile: %v", err)
+		}
+	}
 
-		imts.StandAlone.Cleanup = false
+	log.WithFields(log.Fields{
+		"image": packageRegistryImage,
+		"url":   packageRegistryURL,
+	}).Debug("Using the Package Registry")
 
-		imts.Fleet.beforeScenario()
-	})
-	s.AfterSuite(func() {
-		if !developerMode {
-			log.Debug("Destroying Fleet runtime dependencies")
-			profile := FleetProfileName
+	return sc.env.reset(profileEnv), nil
+}
 
-			err := serviceManager.StopCompose(true, []string{profile})
+// removeAgentBinaries removes the binaries of the agents downloaded by the installers
+func removeAgentBinaries(installers map[string]ElasticAgentInstaller) {
+	for k, v := range installers {
+		agentPath := v.path
+		if _, err := os.Stat(agentPath); err == nil {
+			err = os.Remove(agentPath)
 			if err != nil {
 				log.WithFields(log.Fields{
-					"error":   err,
-					"profile": profile,
-				}).Warn("Could not destroy the runtime dependencies for the profile.")
+					"err":       err,
+					"installer": k,
+					"path":      agentPath,
+				}).Warn("Elastic Agent binary could not be removed.")
+			} else {
+				log.WithFields(log.Fields{
+					"installer": k,
+					"path":      agentPath,
+				}).Debug("Elastic Agent binary was removed.")
 			}
 		}
+	}
+}
 
-		installers := imts.Fleet.Installers
-		for k, v := range installers {
-			agentPath := v.path
-			if _, err := os.Stat(agentPath); err == nil {
-				err = os.Remove(agentPath)
-				if err != nil {
-					log.WithFields(log.Fields{
-						"err":       err,
-						"installer": k,
-						"path":      agentPath,
-					}).Warn("Elastic Agent binary could not be removed.")
-				} else {
-					log.WithFields(log.Fields{
-						"installer": k,
-						"path":      agentPath,
-					}).Debug("Elastic Agent binary was removed.")
-				}
-			}
-		}
+// InitializeIngestManagerScenario returns the initializer of the scenarios of the Godog test suite,
+// which adds the steps of the suite to them, bound to its state, and destroys the agents they deploy
+func InitializeIngestManagerScenario(imts *IngestManagerTestSuite) func(s *godog.ScenarioContext) func() error {
+	return func(s *godog.ScenarioContext) func() error {
+		return imts.initializeScenario(s)
+	}
+}
+
+// initializeScenario adds the steps of the suite to a scenario, returning the function destroying
+// the agents it deploys
+func (imts *IngestManagerTestSuite) initializeScenario(s *godog.ScenarioContext) func() error {
+	e2e.Step(s, `^the "([^"]*)" process is in the "([^"]*)" state on the host$`, imts.processStateOnTheHost)
+	e2e.Step(s, `^the processes are in the state on the host:$`, imts.processesStateOnTheHost)
+
+	imts.Fleet.contributeSteps(s)
+	imts.StandAlone.contributeSteps(s)
+
+	e2e.RegisterSoakMonitor(s)
+	imts.Fleet.Chaos = chaos.RegisterSteps(s, FleetProfileName)
+	datagen.RegisterSteps(s, FleetProfileName, datagen.Config{})
+
+	s.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		log.Trace("Before Fleet scenario")
+
+		imts.StandAlone.Cleanup = false
+		imts.Fleet.beforeScenario(sc.Name)
+
+		return ctx, nil
 	})
-	s.AfterScenario(func(*messages.Pickle, error) {
-		log.Trace("After Fleet scenario")
 
+	return func() error {
 		if imts.StandAlone.Cleanup {
 			imts.StandAlone.afterScenario()
 		}
@@ -195,29 +330,52 @@ func IngestManagerFeatureContext(s *godog.Suite) {
 		if imts.Fleet.Cleanup {
 			imts.Fleet.afterScenario()
 		}
-	})
+
+		return nil
+	}
 }
 
 // IngestManagerTestSuite represents a test suite, holding references to the pieces needed to run the tests
 type IngestManagerTestSuite struct {
 	Fleet      *FleetTestSuite
 	StandAlone *StandAloneTestSuite
+	suite      *SuiteContext
 }
 
 func (imts *IngestManagerTestSuite) processStateOnTheHost(process string, state string) error {
-	profile := FleetProfileName
-	serviceName := ElasticAgentServiceName
+	if imts.StandAlone.Hostname != "" {
+		d, containerName := imts.StandAlone.box()
+		return checkProcessStateOnTheHost(d, containerName, process, state)
+	}
+
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(FleetProfileName), imts.Fleet.Image+"-systemd", ElasticAgentServiceName, 1)
+	return checkProcessStateOnTheHost(imts.suite.deployer, containerName, process, state)
+}
+
+// processesStateOnTheHost checks the states of several processes at once on the box of the agent,
+// i.e. which beats the agent runs after a change of its policy, from a table of processes and states
+func (imts *IngestManagerTestSuite) processesStateOnTheHost(table *godog.Table) error {
+	states, err := newProcessStates(table)
+	if err != nil {
+		return err
+	}
 
-	containerName := fmt.Sprintf("%s_%s_%s_%d", profile, imts.Fleet.Image+"-systemd", serviceName, 1)
 	if imts.StandAlone.Hostname != "" {
-		containerName = fmt.Sprintf("%s_%s_%d", profile, serviceName, 1)
+		d, containerName := imts.StandAlone.box()
+		return checkProcessesStateOnTheHost(d, containerName, states)
 	}
 
-	return checkProcessStateOnTheHost(containerName, process, state)
+	containerName := fmt.Sprintf("%s_%s_%s_%d", config.GetComposeProjectName(FleetProfileName), imts.Fleet.Image+"-systemd", ElasticAgentServiceName, 1)
+	return checkProcessesStateOnTheHost(imts.suite.deployer, containerName, states)
 }
 
-// checkElasticAgentVersion returns a fallback version (agentVersionBase) if the version set by the environment is empty
+// checkElasticAgentVersion returns a fallback version (agentVersionBase) if the version set by the environment is empty.
+// The versions different from the one under test, i.e. the stale one, are returned as they are
 func checkElasticAgentVersion(version string) string {
+	if version != agentVersion {
+		return version
+	}
+
 	environmentVersion := os.Getenv("ELASTIC_AGENT_VERSION")
 
 	if environmentVersion == "" {
@@ -231,14 +389,108 @@ func checkElasticAgentVersion(version string) string {
 	return version
 }
 
-// name of the container for the service:
-// we are using the Docker client instead of docker-compose
-// because it does not support returning the output of a
-// command: it simply returns error level
-func checkProcessStateOnTheHost(containerName string, process string, state string) error {
+// resolveAgentVersion returns the version of the agent for an alias used by the scenarios:
+//   - latest or N: the version under test
+//   - stale: the version used as a base during upgrades
+//   - N-1, N-2...: the previous minor versions, read from the ELASTIC_AGENT_PREVIOUS_VERSIONS env var,
+//     i.e. '7.10.1,7.9.3', or else the latest releases of the previous minors of the version under test
+//     in the artifacts API. If the API is not available, they are derived from the stale version, which
+//     is N-1
+//
+// Any other value is considered a version, i.e. 7.9.3
+func resolveAgentVersion(alias string) (string, error) {
+	switch alias {
+	case "latest", "N":
+		return agentVersion, nil
+	case "stale":
+		return agentStaleVersion, nil
+	}
+
+	if !strings.HasPrefix(alias, "N-") {
+		return alias, nil
+	}
+
+	previous, err := strconv.Atoi(strings.TrimPrefix(alias, "N-"))
+	if err != nil || previous < 1 {
+		return "", fmt.Errorf("%s is not a valid alias of a previous version of the agent, i.e. N-1", alias)
+	}
+
+	if previousVersions := shell.GetEnv("ELASTIC_AGENT_PREVIOUS_VERSIONS", ""); previousVersions != "" {
+		versions := strings.Split(previousVersions, ",")
+		if previous > len(versions) {
+			return "", fmt.Errorf("There is no %s version of the agent in ELASTIC_AGENT_PREVIOUS_VERSIONS: %s", alias, previousVersions)
+		}
+
+		return strings.TrimSpace(versions[previous-1]), nil
+	}
+
+	version := agentVersion
+	if strings.HasPrefix(strings.ToLower(version), "pr-") {
+		version = agentVersionBase
+	}
+
+	previousVersion, err := e2e.GetArtifactsClient().ResolvePreviousVersion(version, previous)
+	if err == nil {
+		return previousVersion, nil
+	}
+
+	log.WithFields(log.Fields{
+		"alias":        alias,
+		"error":        err,
+		"staleVersion": agentStaleVersion,
+	}).Warn("Could not resolve the previous version in the artifacts API, deriving it from the stale version")
+
+	// the stale version is N-1, so the older ones are derived from it, decreasing its minor
+	parts := strings.Split(agentStaleVersion, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("The stale version of the agent is not a valid version: %s", agentStaleVersion)
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil || minor-(previous-1) < 0 {
+		return "", fmt.Errorf("The %s version of the agent cannot be derived from the stale version: %s", alias, agentStaleVersion)
+	}
+
+	if previous == 1 {
+		return agentStaleVersion, nil
+	}
+
+	return fmt.Sprintf("%s.%d.0", parts[0], minor-(previous-1)), nil
+}
+
+// resolveStackVersion returns the version of the stack for an alias in the steps upgrading it:
+//   - next: the version the stack is upgraded to, read from the STACK_UPGRADE_VERSION env var
+//   - N: the version of the stack under test
+//
+// Any other value is resolved as a version of the agent, i.e. N-1 or 7.9.3
+func resolveStackVersion(alias string) (string, error) {
+	switch alias {
+	case "next":
+		if stackUpgradeVersion == "" {
+			return "", fmt.Errorf("The STACK_UPGRADE_VERSION env var must be set to upgrade the stack from %s", stackVersion)
+		}
+		return stackUpgradeVersion, nil
+	case "N":
+		return stackVersion, nil
+	}
+
+	return resolveAgentVersion(alias)
+}
+
+// checkProcessStateOnTheHost waits for a process to be in a state in the box of an agent, deployed by a deployer
+func checkProcessStateOnTheHost(d *agentDeployer, containerName string, process string, state string) error {
 	timeout := time.Duration(timeoutFactor) * time.Minute
 
-	err := e2e.WaitForProcess(containerName, process, state, timeout)
+	outputFn := func(cmds []string) (string, error) {
+		// the Windows boxes have no pgrep, so the processes are listed by their name
+		if d.boxOS() == windowsOS {
+			cmds = []string{"Get-Process", "-Name", process, "-ErrorAction", "SilentlyContinue"}
+		}
+
+		return d.output(containerName, cmds)
+	}
+
+	err := e2e.WaitForProcessInBox(containerName, outputFn, process, state, timeout)
 	if err != nil {
 		if state == "started" {
 			log.WithFields(log.Fields{
@@ -260,41 +512,73 @@ func checkProcessStateOnTheHost(containerName string, process string, state stri
 	return nil
 }
 
-func execCommandInService(profile string, image string, serviceName string, cmds []string, detach bool) error {
-	serviceManager := services.NewServiceManager()
+// checkProcessesStateOnTheHost waits for several processes to be in their states on a box, listing
+// its processes once per retry
+func checkProcessesStateOnTheHost(d *agentDeployer, containerName string, states map[string]string) error {
+	timeout := time.Duration(timeoutFactor) * time.Minute
 
-	composes := []string{
-		profile, // profile name
-		image,   // image for the service
-	}
-	composeArgs := []string{"exec", "-T"}
-	if detach {
-		composeArgs = append(composeArgs, "-d")
+	outputFn := func(cmds []string) (string, error) {
+		// the Windows boxes have no ps, so the names of the processes are listed instead
+		if d.boxOS() == windowsOS {
+			cmds = powershellScript("Get-Process | ForEach-Object { $_.ProcessName }")
+		}
+
+		return d.output(containerName, cmds)
 	}
-	composeArgs = append(composeArgs, serviceName)
-	composeArgs = append(composeArgs, cmds...)
 
-	err := serviceManager.RunCommand(profile, composes, composeArgs, profileEnv)
+	err := e2e.WaitForProcessesInBox(containerName, outputFn, states, timeout)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"command": cmds,
-			"error":   err,
-			"service": serviceName,
-		}).Error("Could not execute command in container")
-
+			"container": containerName,
+			"error":     err,
+			"states":    states,
+			"timeout":   timeout,
+		}).Error("The processes are not in the desired state")
 		return err
 	}
 
 	return nil
 }
 
+// newProcessStates returns the desired states of the processes of a table with the name of a
+// process and its state, started or stopped, in each row. The first row can be a "process | state"
+// header
+func newProcessStates(table *godog.Table) (map[string]string, error) {
+	states := map[string]string{}
+
+	for i, row := range table.Rows {
+		if len(row.Cells) != 2 {
+			return nil, fmt.Errorf("the row %d of the processes must have a process and a state", i+1)
+		}
+
+		process := strings.TrimSpace(row.Cells[0].Value)
+		state := strings.TrimSpace(row.Cells[1].Value)
+
+		if i == 0 && process == "process" && state == "state" {
+			continue
+		}
+
+		if state != "started" && state != "stopped" {
+			return nil, fmt.Errorf("the state of the %s process must be started or stopped: %s", process, state)
+		}
+
+		states[process] = state
+	}
+
+	if len(states) == 0 {
+		return nil, fmt.Errorf("there are no processes to check")
+	}
+
+	return states, nil
+}
+
 // we need the container name because we use the Docker Client instead of Docker Compose
 func getContainerHostname(containerName string) (string, error) {
 	log.WithFields(log.Fields{
 		"containerName": containerName,
 	}).Trace("Retrieving container name from the Docker client")
 
-	hostname, err := docker.ExecCommandIntoContainer(context.Background(), containerName, "root", []string{"cat", "/etc/hostname"})
+	hostname, err := docker.ExecCommandIntoContainer(e2e.ScenarioContext(), containerName, "root", []string{"cat", "/etc/hostname"})
 	if err != nil {
 		log.WithFields(log.Fields{
 			"containerName": containerName,
@@ -310,3 +594,38 @@ func getContainerHostname(containerName string) (string, error) {
 
 	return hostname, nil
 }
+
+// getKibanaConfigPath returns the path of the configuration file of Kibana. If the URL of the Package
+// Registry is overriden, the file is copied into the state dir pointing to it, so that Kibana uses it
+// instead of the one run by the profile
+func getKibanaConfigPath(configPath string) (string, error) {
+	if packageRegistryURL == "" {
+		return configPath, nil
+	}
+
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "xpack.ingestManager.registryUrl:") {
+			lines[i] = "xpack.ingestManager.registryUrl: " + packageRegistryURL
+		}
+	}
+
+	kibanaConfigPath := filepath.Join(config.GetStateDir(), "fleet-kibana.config.yml")
+
+	err = ioutil.WriteFile(kibanaConfigPath, []byte(strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"config": kibanaConfigPath,
+		"url":    packageRegistryURL,
+	}).Info("Kibana uses the Package Registry")
+
+	return kibanaConfigPath, nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
-	"github.com/Jeffail/gabs/v2"
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -14,331 +17,383 @@ import (
 // and the title is more readable than the name
 const elasticEnpointIntegrationTitle = "Endpoint Security"
 
-// IntegrationPackage used to share information about a integration
-type IntegrationPackage struct {
-	packageConfigID string          `json:"packageConfigId"`
-	name            string          `json:"name"`
-	title           string          `json:"title"`
-	version         string          `json:"version"`
-	json            *gabs.Container // json representation of the integration
+// addIntegrationToPolicy sends a POST request to Fleet adding an integration to a policy, returning the
+// package policy of the integration in the policy
+func (sc *SuiteContext) addIntegrationToPolicy(integration kibana.Package, policyID string) (kibana.PackagePolicy, error) {
+	return sc.fleet.AddPackagePolicy(newPackagePolicy(integration, policyID))
 }
 
-// addIntegrationToPolicy sends a POST request to Fleet adding an integration to a configuration
-func addIntegrationToPolicy(integrationPackage IntegrationPackage, policyID string) (string, error) {
-	name := integrationPackage.name + "-test-name"
-	description := integrationPackage.title + "-test-description"
+// newPackagePolicy returns the package policy adding an integration to a policy, without inputs,
+// which are configured by Fleet
+func newPackagePolicy(integration kibana.Package, policyID string) kibana.PackagePolicy {
+	return kibana.PackagePolicy{
+		Description: integration.Title + "-test-description",
+		Enabled:     true,
+		Name:        integration.Name + "-test-name",
+		Namespace:   "default",
+		Package: kibana.PackageInfo{
+			Name:    integration.Name,
+			Title:   integration.Title,
+			Version: integration.Version,
+		},
+		PolicyID: policyID,
+	}
+}
 
-	body, err := kibanaClient.AddIntegrationToPolicy(integrationPackage.name, name, integrationPackage.title, description, integrationPackage.version, policyID)
-	if err != nil {
-		return "", err
+// deleteIntegrationFromPolicy sends a POST request to Fleet deleting an integration from a policy
+func (sc *SuiteContext) deleteIntegrationFromPolicy(packagePolicy kibana.PackagePolicy) error {
+	if packagePolicy.ID == "" {
+		log.Trace("There is no integration added to the policy to be deleted")
+		return nil
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
+	return sc.fleet.DeletePackagePolicy(packagePolicy.ID)
+}
+
+// isAgentListedInSecurityAppWithStatus inspects the metadata field for a hostname, obtained from
+// the security App. We will check if the status matches the desired status, returning an error
+// if the agent is not present in the Security App
+func (sc *SuiteContext) isAgentListedInSecurityAppWithStatus(hostName string, desiredStatus string) (bool, error) {
+	host, err := sc.fleet.GetEndpointHostByHostname(hostName)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return "", err
+			"hostname": hostName,
+			"error":    err,
+		}).Error("There was an error getting the agent in the Administration view in the Security app")
+		return false, err
 	}
 
-	integrationConfigurationID := jsonParsed.Path("item.id").Data().(string)
-
 	log.WithFields(log.Fields{
-		"policyID":                   policyID,
-		"integrationConfigurationID": integrationConfigurationID,
-		"integration":                integrationPackage.name,
-		"version":                    integrationPackage.version,
-	}).Info("Integration added to the configuration")
+		"desiredStatus": desiredStatus,
+		"hostname":      hostName,
+		"status":        host.HostStatus,
+	}).Debug("Hostname for the agent listed with desired status in the Administration view in the Security App")
 
-	return integrationConfigurationID, nil
+	return (host.HostStatus == desiredStatus), nil
 }
 
-// deleteIntegrationFromPolicy sends a POST request to Fleet deleting an integration from a configuration
-func deleteIntegrationFromPolicy(integrationPackage IntegrationPackage, policyID string) error {
-	_, err := kibanaClient.DeleteIntegrationFromPolicy(integrationPackage.packageConfigID)
-	if err != nil {
-		return err
+// isPolicyResponseListedInSecurityApp retrieves the hosts from Endpoint to check if the policy
+// response of an agent is listed in the Security App with the success status
+func (sc *SuiteContext) isPolicyResponseListedInSecurityApp(agentID string) (bool, error) {
+	host, err := sc.fleet.GetEndpointHostByAgentID(agentID)
+	if errors.Is(err, kibana.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
 	}
 
+	applied := host.Metadata.Endpoint.Policy.Applied
+
 	log.WithFields(log.Fields{
-		"policyID":        policyID,
-		"integration":     integrationPackage.name,
-		"packageConfigId": integrationPackage.packageConfigID,
-		"version":         integrationPackage.version,
-	}).Info("Integration deleted from the configuration")
+		"agentID": agentID,
+		"name":    applied.Name,
+		"status":  applied.Status,
+	}).Debug("Policy response for the agent listed in the Security App")
 
-	return nil
+	return (applied.Status == "success"), nil
 }
 
-// getIntegration returns metadata from an integration from Fleet, without the package ID
-func getIntegration(packageName string, version string) (IntegrationPackage, error) {
-	body, err := kibanaClient.GetIntegration(packageName, version)
-	if err != nil {
-		return IntegrationPackage{}, err
+// packagePolicyOption a change of the config of the package policy of an integration
+type packagePolicyOption interface {
+	// applyTo applies the change to a package policy, failing if it does not support it
+	applyTo(packagePolicy *kibana.PackagePolicy) error
+	// String describes the change
+	String() string
+}
+
+// endpointPolicyOption a change of the Endpoint policy of the Endpoint Security integration,
+// which is applied to the config of each OS supporting it
+type endpointPolicyOption interface {
+	// apply applies the change to the config of an OS, reporting if the OS supports it
+	apply(osConfig map[string]interface{}) bool
+	// String describes the change
+	String() string
+}
+
+// applyEndpointPolicyOption applies a change to the Endpoint policy in the config of the Endpoint
+// Security integration, failing if the change is not supported by any OS
+func applyEndpointPolicyOption(packagePolicy *kibana.PackagePolicy, option endpointPolicyOption) error {
+	if len(packagePolicy.Inputs) == 0 {
+		return fmt.Errorf("The %s package policy has no inputs", packagePolicy.ID)
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse get response into JSON")
-		return IntegrationPackage{}, err
+	policyConfig, exists := packagePolicy.Inputs[0].Config["policy"]
+	if !exists {
+		return fmt.Errorf("The %s package policy has no Endpoint policy", packagePolicy.ID)
 	}
 
-	response := jsonParsed.Path("response")
-	integrationPackage := IntegrationPackage{
-		name:    response.Path("name").Data().(string),
-		title:   response.Path("title").Data().(string),
-		version: response.Path("latestVersion").Data().(string),
+	policyValue, ok := policyConfig.Value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("The Endpoint policy of the %s package policy is not an object", packagePolicy.ID)
 	}
 
-	return integrationPackage, nil
-}
+	applied := false
+	for _, os := range []string{"linux", "mac", "windows"} {
+		osConfig, ok := policyValue[os].(map[string]interface{})
+		if !ok {
+			continue
+		}
 
-// getIntegrationFromAgentPolicy inspects the integrations added to an agent policy, returning the
-// a struct representing the package, including the packageID for the integration in the policy
-func getIntegrationFromAgentPolicy(packageName string, agentPolicyID string) (IntegrationPackage, error) {
-	body, err := kibanaClient.GetIntegrationFromAgentPolicy(agentPolicyID)
-	if err != nil {
-		return IntegrationPackage{}, err
+		if option.apply(osConfig) {
+			applied = true
+		}
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return IntegrationPackage{}, err
+	if !applied {
+		return fmt.Errorf("The Endpoint policy of the %s package policy does not support the change: %s", packagePolicy.ID, option)
 	}
 
-	packagePolicies := jsonParsed.Path("item.package_policies").Children()
-	for _, packagePolicy := range packagePolicies {
-		title := packagePolicy.Path("package.title").Data().(string)
-		if title == packageName {
-			integrationPackage := IntegrationPackage{
-				packageConfigID: packagePolicy.Path("id").Data().(string),
-				name:            packagePolicy.Path("package.name").Data().(string),
-				title:           title,
-				version:         packagePolicy.Path("package.version").Data().(string),
-				json:            packagePolicy,
-			}
-
-			log.WithFields(log.Fields{
-				"package":  integrationPackage,
-				"policyID": agentPolicyID,
-			}).Debug("Package policy found in the configuration")
-
-			return integrationPackage, nil
-		}
-	}
+	return nil
+}
 
-	return IntegrationPackage{}, fmt.Errorf("%s package policy not found in the configuration", packageName)
+// endpointEventsOption enables or disables the collection of a type of events, i.e. process, in
+// the OSes collecting it
+type endpointEventsOption struct {
+	Enabled bool
+	Event   string // i.e. file, network or process
 }
 
-// getIntegrationLatestVersion sends a GET request to Fleet for the existing integrations
-// checking if the desired integration exists in the package registry. If so, it will
-// return name and version (latest) of the integration
-func getIntegrationLatestVersion(integrationName string) (string, string, error) {
-	body, err := kibanaClient.GetIntegrations()
-	if err != nil {
-		return "", "", err
+// apply toggles the collection of the events in the config of an OS
+func (o endpointEventsOption) apply(osConfig map[string]interface{}) bool {
+	events, ok := osConfig["events"].(map[string]interface{})
+	if !ok {
+		return false
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return "", "", err
+	if _, exists := events[o.Event]; !exists {
+		return false
 	}
 
-	// data streams should contain array of elements
-	integrations := jsonParsed.Path("response").Children()
+	events[o.Event] = o.Enabled
+	return true
+}
 
-	log.WithFields(log.Fields{
-		"count": len(integrations),
-	}).Trace("Integrations retrieved")
-
-	for _, integration := range integrations {
-		title := integration.Path("title").Data().(string)
-		if strings.ToLower(title) == strings.ToLower(integrationName) {
-			name := integration.Path("name").Data().(string)
-			version := integration.Path("version").Data().(string)
-			log.WithFields(log.Fields{
-				"name":    name,
-				"title":   title,
-				"version": version,
-			}).Debug("Integration in latest version found")
-			return name, version, nil
-		}
-	}
+// applyTo toggles the collection of the events in the Endpoint policy of a package policy
+func (o endpointEventsOption) applyTo(packagePolicy *kibana.PackagePolicy) error {
+	return applyEndpointPolicyOption(packagePolicy, o)
+}
 
-	return "", "", fmt.Errorf("The %s integration was not found", integrationName)
+// String describes the change
+func (o endpointEventsOption) String() string {
+	return fmt.Sprintf("%s events enabled: %t", o.Event, o.Enabled)
 }
 
-// getMetadataFromSecurityApp sends a POST request to Endpoint retrieving the metadata that
-// is listed in the Security App
-func getMetadataFromSecurityApp() (*gabs.Container, error) {
-	body, err := kibanaClient.GetMetadataFromSecurityApp()
-	if err != nil {
-		return nil, err
-	}
+// endpointProtectionOption sets the mode of a protection, i.e. malware, in the OSes where it can
+// be set, which are Windows and Mac for the malware protection
+type endpointProtectionOption struct {
+	Mode       string // i.e. detect, prevent or off
+	Protection string // i.e. malware or ransomware
+}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
+// apply sets the mode of the protection in the config of an OS
+func (o endpointProtectionOption) apply(osConfig map[string]interface{}) bool {
+	protection, ok := osConfig[o.Protection].(map[string]interface{})
+	if !ok {
+		return false
 	}
 
-	hosts := jsonParsed.Path("hosts")
+	protection["mode"] = o.Mode
+	return true
+}
 
-	log.WithFields(log.Fields{
-		"hosts": hosts,
-	}).Trace("Hosts in the Security App")
+// applyTo sets the mode of the protection in the Endpoint policy of a package policy
+func (o endpointProtectionOption) applyTo(packagePolicy *kibana.PackagePolicy) error {
+	return applyEndpointPolicyOption(packagePolicy, o)
+}
 
-	return hosts, nil
+// String describes the change
+func (o endpointProtectionOption) String() string {
+	return fmt.Sprintf("%s protection in %s mode", o.Protection, o.Mode)
 }
 
-// installIntegration sends a POST request to Fleet installing the assets for an integration
-func installIntegrationAssets(integration string, version string) (IntegrationPackage, error) {
-	body, err := kibanaClient.InstallIntegrationAssets(integration, version)
-	if err != nil {
-		return IntegrationPackage{}, err
+// integrationSettingOption sets a setting of an input of an integration, or of one of its streams,
+// from its path: the type of the input, the dataset of the stream, if any, and the name of a var
+// of the input or the stream, or "enabled" to toggle them, i.e. logfile.system.auth.paths
+type integrationSettingOption struct {
+	Path  string
+	Value interface{}
+}
+
+// applyTo sets the setting in the input or the stream of a package policy matching its path,
+// failing if there is no input, stream or var matching it
+func (o integrationSettingOption) applyTo(packagePolicy *kibana.PackagePolicy) error {
+	inputIndex := -1
+	for i, input := range packagePolicy.Inputs {
+		if strings.HasPrefix(o.Path, input.Type+".") && (inputIndex < 0 || len(input.Type) > len(packagePolicy.Inputs[inputIndex].Type)) {
+			inputIndex = i
+		}
+	}
+	if inputIndex < 0 {
+		return fmt.Errorf("The %s package policy has no input for the %s setting", packagePolicy.ID, o.Path)
 	}
 
-	log.WithFields(log.Fields{
-		"integration": integration,
-		"version":     version,
-	}).Info("Assets for the integration where installed")
+	input := &packagePolicy.Inputs[inputIndex]
+	setting := strings.TrimPrefix(o.Path, input.Type+".")
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse install response into JSON")
-		return IntegrationPackage{}, err
+	streamIndex := -1
+	streamDataset := ""
+	streams := make([]map[string]interface{}, len(input.Streams))
+	for i, raw := range input.Streams {
+		err := json.Unmarshal(raw, &streams[i])
+		if err != nil {
+			return fmt.Errorf("The %s input of the %s package policy has an invalid stream: %w", input.Type, packagePolicy.ID, err)
+		}
+
+		dataStream, _ := streams[i]["data_stream"].(map[string]interface{})
+		dataset, _ := dataStream["dataset"].(string)
+		if dataset != "" && strings.HasPrefix(setting, dataset+".") && len(dataset) > len(streamDataset) {
+			streamIndex = i
+			streamDataset = dataset
+		}
 	}
-	response := jsonParsed.Path("response").Index(0)
 
-	packageConfigID := response.Path("id").Data().(string)
+	if streamIndex < 0 {
+		return o.applyToInput(input, setting)
+	}
 
-	// get the integration again in the case it's already installed
-	integrationPackage, err := getIntegration(integration, version)
+	err := o.applyToStream(streams[streamIndex], strings.TrimPrefix(setting, streamDataset+"."))
 	if err != nil {
-		return IntegrationPackage{}, err
+		return fmt.Errorf("The %s stream of the %s input of the %s package policy: %w", streamDataset, input.Type, packagePolicy.ID, err)
 	}
 
-	integrationPackage.packageConfigID = packageConfigID
+	raw, err := json.Marshal(streams[streamIndex])
+	if err != nil {
+		return err
+	}
+	input.Streams[streamIndex] = raw
 
-	return integrationPackage, nil
+	return nil
 }
 
-// isAgentListedInSecurityApp retrieves the hosts from Endpoint to check if a hostname
-// is listed in the Security App. For that, we will inspect the metadata, and will iterate
-// through the hosts, until we get the proper hostname.
-func isAgentListedInSecurityApp(hostName string) (*gabs.Container, error) {
-	hosts, err := getMetadataFromSecurityApp()
-	if err != nil {
-		return nil, err
+// applyToInput sets a var of an input, or enables or disables it
+func (o integrationSettingOption) applyToInput(input *kibana.PackagePolicyInput, name string) error {
+	if name == "enabled" {
+		enabled, ok := o.Value.(bool)
+		if !ok {
+			return fmt.Errorf("The %s setting must be true or false", o.Path)
+		}
+
+		input.Enabled = enabled
+		return nil
 	}
 
-	for _, host := range hosts.Children() {
-		metadataHostname := host.Path("metadata.host.hostname").Data().(string)
-		if metadataHostname == hostName {
-			log.WithFields(log.Fields{
-				"hostname": hostName,
-			}).Debug("Hostname for the agent listed in the Security App")
+	configValue, exists := input.Vars[name]
+	if !exists {
+		return fmt.Errorf("The %s input has no %s var", input.Type, name)
+	}
+
+	configValue.Value = o.Value
+	input.Vars[name] = configValue
+	return nil
+}
 
-			return host, nil
+// applyToStream sets a var of a stream, or enables or disables it
+func (o integrationSettingOption) applyToStream(stream map[string]interface{}, name string) error {
+	if name == "enabled" {
+		enabled, ok := o.Value.(bool)
+		if !ok {
+			return fmt.Errorf("the %s setting must be true or false", o.Path)
 		}
+
+		stream["enabled"] = enabled
+		return nil
+	}
+
+	vars, _ := stream["vars"].(map[string]interface{})
+	configValue, ok := vars[name].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("there is no %s var", name)
 	}
 
-	return nil, nil
+	configValue["value"] = o.Value
+	return nil
 }
 
-// isAgentListedInSecurityAppWithStatus inspects the metadata field for a hostname, obtained from
-// the security App. We will check if the status matches the desired status, returning an error
-// if the agent is not present in the Security App
-func isAgentListedInSecurityAppWithStatus(hostName string, desiredStatus string) (bool, error) {
-	host, err := isAgentListedInSecurityApp(hostName)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"hostname": hostName,
-			"error":    err,
-		}).Error("There was an error getting the agent in the Administration view in the Security app")
-		return false, err
-	}
+// String describes the change
+func (o integrationSettingOption) String() string {
+	return fmt.Sprintf("%s: %v", o.Path, o.Value)
+}
+
+// newIntegrationSettingOptions returns the settings of an integration from the rows of a data table
+// of a step, with the path of a setting and its value, skipping the optional "setting | value"
+// header. The values are parsed as JSON, i.e. true, 10 or ["/var/log/*.log"], or kept as strings
+// if they are not valid JSON, i.e. 10s
+func newIntegrationSettingOptions(table *godog.Table) ([]packagePolicyOption, error) {
+	options := []packagePolicyOption{}
+
+	for i, row := range table.Rows {
+		if len(row.Cells) != 2 {
+			return nil, fmt.Errorf("The row %d of the settings must have a setting and a value, but it has %d cells", i+1, len(row.Cells))
+		}
 
-	if host == nil {
-		return false, fmt.Errorf("The host %s is not listed in the Administration view in the Security App", hostName)
+		path := strings.TrimSpace(row.Cells[0].Value)
+		raw := strings.TrimSpace(row.Cells[1].Value)
+		if i == 0 && strings.EqualFold(path, "setting") && strings.EqualFold(raw, "value") {
+			continue
+		}
+
+		var value interface{}
+		err := json.Unmarshal([]byte(raw), &value)
+		if err != nil {
+			value = raw
+		}
+
+		options = append(options, integrationSettingOption{Path: path, Value: value})
 	}
 
-	hostStatus := host.Path("host_status").Data().(string)
-	log.WithFields(log.Fields{
-		"desiredStatus": desiredStatus,
-		"hostname":      hostName,
-		"status":        hostStatus,
-	}).Debug("Hostname for the agent listed with desired status in the Administration view in the Security App")
+	if len(options) == 0 {
+		return nil, errors.New("There are no settings in the table")
+	}
 
-	return (hostStatus == desiredStatus), nil
+	return options, nil
 }
 
-// isPolicyResponseListedInSecurityApp sends a POST request to Endpoint to check if a hostname
-// is listed in the Security App. For that, we will inspect the metadata, and will iterate
-// through the hosts, until we get the policy status, finally checking for the success
-// status.
-func isPolicyResponseListedInSecurityApp(agentID string) (bool, error) {
-	hosts, err := getMetadataFromSecurityApp()
-	if err != nil {
+// isPolicyAppliedInSecurityApp retrieves the host of an agent from Endpoint to check if the policy
+// response of the agent reports the revision of a package policy applied with the success status
+func (sc *SuiteContext) isPolicyAppliedInSecurityApp(agentID string, packagePolicy kibana.PackagePolicy) (bool, error) {
+	host, err := sc.fleet.GetEndpointHostByAgentID(agentID)
+	if errors.Is(err, kibana.ErrNotFound) {
+		return false, nil
+	} else if err != nil {
 		return false, err
 	}
 
-	for _, host := range hosts.Children() {
-		metadataAgentID := host.Path("metadata.elastic.agent.id").Data().(string)
-		name := host.Path("metadata.Endpoint.policy.applied.name").Data().(string)
-		status := host.Path("metadata.Endpoint.policy.applied.status").Data().(string)
-		if metadataAgentID == agentID {
-			log.WithFields(log.Fields{
-				"agentID": agentID,
-				"name":    name,
-				"status":  status,
-			}).Debug("Policy response for the agent listed in the Security App")
-
-			return (status == "success"), nil
-		}
+	applied := host.Metadata.Endpoint.Policy.Applied
+
+	log.WithFields(log.Fields{
+		"agentID":          agentID,
+		"appliedRevision":  applied.EndpointPolicyVersion,
+		"expectedRevision": packagePolicy.Revision,
+		"packagePolicyID":  applied.ID,
+		"status":           applied.Status,
+	}).Debug("Policy response for the agent listed in the Security App")
+
+	if applied.ID != packagePolicy.ID || applied.EndpointPolicyVersion < packagePolicy.Revision {
+		return false, nil
+	}
+
+	if applied.Status != "success" {
+		return false, fmt.Errorf("the revision %d of the %s policy was applied with the %s status", applied.EndpointPolicyVersion, applied.ID, applied.Status)
 	}
 
-	return false, nil
+	return true, nil
 }
 
-// updateIntegrationPackageConfig sends a PUT request to Fleet updating integration
-// configuration
-func updateIntegrationPackageConfig(packageConfigID string, payload string) (*gabs.Container, error) {
-	body, err := kibanaClient.UpdateIntegrationPackageConfig(packageConfigID, payload)
-	if err != nil {
-		return nil, err
-	}
+// updateIntegrationPackageConfig applies changes to the config of an integration, sending the
+// updated package policy to Fleet. It fails if a change is not supported by the package policy,
+// i.e. an unknown type of events of the Endpoint policy, or an unknown setting of an input
+func (sc *SuiteContext) updateIntegrationPackageConfig(packagePolicy kibana.PackagePolicy, options ...packagePolicyOption) (kibana.PackagePolicy, error) {
+	for _, option := range options {
+		err := option.applyTo(&packagePolicy)
+		if err != nil {
+			return kibana.PackagePolicy{}, err
+		}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
 		log.WithFields(log.Fields{
-			"error":        err,
-			"responseBody": body,
-		}).Error("Could not parse response into JSON")
-		return nil, err
+			"change":          option.String(),
+			"packagePolicyID": packagePolicy.ID,
+		}).Debug("Package policy changed")
 	}
 
-	log.WithFields(log.Fields{
-		"policyID": packageConfigID,
-	}).Debug("Configuration for the integration was updated")
-
-	return jsonParsed, nil
+	return sc.fleet.UpdatePackagePolicy(packagePolicy)
 }
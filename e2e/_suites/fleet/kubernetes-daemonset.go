@@ -0,0 +1,174 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/datastreams"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// ElasticAgentDaemonSetServiceName the name of the service of the stand-alone agents deployed as a
+// DaemonSet, whose Kubernetes manifest runs an agent in each node of the cluster, collecting the
+// metrics of the kubelet and the logs of the containers of the node
+const ElasticAgentDaemonSetServiceName = "elastic-agent-daemonset"
+
+// aStandaloneAgentIsDeployedAsADaemonSet deploys the stand-alone agent as a DaemonSet into the
+// namespace of the profile, which only runs when the stack is deployed into Kubernetes. The
+// configuration of the agent is rendered into the manifest, sending its data to the Elasticsearch
+// of the profile
+func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployedAsADaemonSet(image string) error {
+	if shell.GetEnv(services.ServiceManagerEnvVar, "") != "kubernetes" {
+		log.WithFields(log.Fields{
+			"image": image,
+		}).Warn("The stand-alone agent is deployed as a DaemonSet only when the stack runs in Kubernetes, set the OP_SERVICE_MANAGER environment variable to kubernetes. Skipping the scenario")
+		return godog.ErrPending
+	}
+
+	imageSuffix := ""
+	if image != "default" {
+		imageSuffix = "-" + image
+	}
+
+	sats.suite.env.put(map[string]string{
+		"elasticAgentDockerImageSuffix": imageSuffix,
+		"elasticAgentOutputHost":        config.GetURLScheme() + "://elasticsearch:9200",
+		"elasticAgentOutputPassword":    "changeme",
+		"elasticAgentOutputUsername":    "elastic",
+		"elasticAgentTag":               agentVersion,
+	})
+
+	serviceManager := services.NewServiceManager()
+
+	err := serviceManager.AddServicesToCompose(FleetProfileName, []string{ElasticAgentDaemonSetServiceName}, sats.suite.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"image": image,
+		}).Error("Could not deploy the stand-alone agent as a DaemonSet")
+		return err
+	}
+
+	sats.DaemonSet = true
+	sats.Image = image
+	sats.Cleanup = true
+
+	// the agents run in the network of the nodes, so their documents have the name of the node
+	node, err := sats.daemonSetNode()
+	if err != nil {
+		return err
+	}
+	sats.Hostname = node
+
+	log.WithFields(log.Fields{
+		"image": image,
+		"node":  node,
+	}).Debug("The stand-alone agent was deployed as a DaemonSet")
+
+	return nil
+}
+
+// daemonSetNode returns the name of the node of the first pod of the DaemonSet of the agents
+func (sats *StandAloneTestSuite) daemonSetNode() (string, error) {
+	kubectl := &services.Kubectl{}
+	namespace := config.GetComposeProjectName(FleetProfileName)
+
+	output, err := kubectl.Run("get", "pods", "--namespace", namespace, "--selector", "app="+ElasticAgentDaemonSetServiceName, "-o", "jsonpath={.items[0].spec.nodeName}")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": namespace,
+		}).Error("Could not get the node of the pods of the DaemonSet")
+		return "", err
+	}
+
+	node := strings.TrimSpace(output)
+	if node == "" {
+		return "", fmt.Errorf("there are no pods of the %s DaemonSet in the %s namespace", ElasticAgentDaemonSetServiceName, namespace)
+	}
+
+	return node, nil
+}
+
+// getDaemonSetLogs logs the logs of the agents of the DaemonSet
+func (sats *StandAloneTestSuite) getDaemonSetLogs() error {
+	kubectl := &services.Kubectl{}
+	namespace := config.GetComposeProjectName(FleetProfileName)
+
+	output, err := kubectl.Run("logs", "--namespace", namespace, "--all-containers", "daemonset/"+ElasticAgentDaemonSetServiceName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": namespace,
+		}).Error("Could not retrieve the logs of the DaemonSet")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"namespace": namespace,
+	}).Debug(output)
+
+	return nil
+}
+
+// thereIsNewDataInTheDataStreamFromTheDaemonSet checks that the agents of the DaemonSet send
+// documents to a data stream, i.e. metrics-kubernetes.pod-default, from their node
+func (sats *StandAloneTestSuite) thereIsNewDataInTheDataStreamFromTheDaemonSet(name string) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	minimumHitsCount := 10
+
+	dataStream, err := parseDataStreamName(name)
+	if err != nil {
+		return err
+	}
+
+	assertions, err := e2e.GetDataStreamAssertions()
+	if err != nil {
+		return err
+	}
+
+	selector := datastreams.Selector{
+		DataStream: dataStream,
+		Hostname:   sats.Hostname,
+		Since:      sats.RuntimeDependenciesStartDate,
+	}
+
+	_, err = assertions.HasDocs(selector, minimumHitsCount, maxTimeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dataStream": name,
+			"error":      err,
+		}).Warn(e2e.WaitForIndices())
+		return err
+	}
+
+	return nil
+}
+
+// parseDataStreamName parses the name of a data stream, i.e. logs-kubernetes.container_logs-default,
+// into its type, dataset and namespace. The datasets can have dashes, but the types and namespaces
+// cannot
+func parseDataStreamName(name string) (elasticsearch.DataStream, error) {
+	first := strings.Index(name, "-")
+	last := strings.LastIndex(name, "-")
+	if first <= 0 || last == first || last == len(name)-1 {
+		return elasticsearch.DataStream{}, fmt.Errorf("%s is not the name of a data stream, i.e. metrics-kubernetes.pod-default", name)
+	}
+
+	return elasticsearch.DataStream{
+		Dataset:   name[first+1 : last],
+		Namespace: name[last+1:],
+		Type:      name[:first],
+	}, nil
+}
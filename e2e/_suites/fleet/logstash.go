@@ -0,0 +1,242 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/datastreams"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogstashServiceName the name of the service of Logstash, which is its host name in the network of
+// the profile too
+const LogstashServiceName = "logstash"
+
+// logstashPort the port of the input of the agents in the pipeline of Logstash
+const logstashPort = 5044
+
+// logstashEventsTag the tag the pipeline of Logstash adds to the events it indexes into Elasticsearch
+const logstashEventsTag = "e2e-logstash"
+
+// logstashOutput a Logstash output added to Fleet in a scenario, and the policies using it
+type logstashOutput struct {
+	id        string
+	policyIDs []string // the policies sending their data to the output, reset in the teardown
+}
+
+// aLogstashOutputIsAddedToFleet deploys Logstash, and adds an output of Fleet sending the data of the
+// agents to it, which the policies of the scenario can use afterwards
+func (fts *FleetTestSuite) aLogstashOutputIsAddedToFleet() error {
+	if fts.LogstashOutput != nil {
+		return fmt.Errorf("The Logstash output was already added to Fleet in the scenario")
+	}
+
+	// Logstash is removed after the scenario, even if it could not be started
+	fts.LogstashOutput = &logstashOutput{}
+
+	err := fts.suite.deployLogstash()
+	if err != nil {
+		return err
+	}
+
+	output, err := fts.suite.fleet.CreateOutput(kibana.Output{
+		Hosts: []string{getLogstashHost()},
+		Name:  fmt.Sprintf("Logstash output for %s %s", fts.ScenarioName, uuid.New().String()),
+		Type:  kibana.LogstashOutputType,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"host":  getLogstashHost(),
+		}).Error("Could not add the Logstash output to Fleet")
+		return err
+	}
+	fts.LogstashOutput.id = output.ID
+
+	return nil
+}
+
+// thePolicyOfTheAgentUsesTheLogstashOutput sets the Logstash output of the scenario as the output
+// of the data and the monitoring data of the agents of the policy of the scenario
+func (fts *FleetTestSuite) thePolicyOfTheAgentUsesTheLogstashOutput() error {
+	if fts.LogstashOutput == nil || fts.LogstashOutput.id == "" {
+		return fmt.Errorf("There is no Logstash output in the scenario")
+	}
+
+	err := fts.suite.fleet.UpdateAgentPolicyOutputs(fts.PolicyID, fts.LogstashOutput.id, fts.LogstashOutput.id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"outputID": fts.LogstashOutput.id,
+			"policyID": fts.PolicyID,
+		}).Error("Could not set the Logstash output in the policy")
+		return err
+	}
+	fts.LogstashOutput.policyIDs = append(fts.LogstashOutput.policyIDs, fts.PolicyID)
+
+	return nil
+}
+
+// thereIsDataFromTheAgentInTheDataStreamThroughLogstash waits for the documents sent by the agent to
+// a data stream, i.e. metrics-system.cpu-default, through the pipeline of Logstash
+func (fts *FleetTestSuite) thereIsDataFromTheAgentInTheDataStreamThroughLogstash(name string) error {
+	return fts.suite.waitForDataThroughLogstash(fts.Hostname, name)
+}
+
+// removeLogstashOutput resets the outputs of the policies using the Logstash output of the scenario,
+// once their agents were un-enrolled, deleting the output and removing Logstash
+func (fts *FleetTestSuite) removeLogstashOutput() {
+	if fts.LogstashOutput == nil {
+		return
+	}
+
+	for _, policyID := range fts.LogstashOutput.policyIDs {
+		err := fts.suite.fleet.UpdateAgentPolicyOutputs(policyID, "", "")
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"policyID": policyID,
+			}).Warn("The outputs of the policy could not be reset to the default output")
+		}
+	}
+
+	if fts.LogstashOutput.id != "" {
+		err := fts.suite.fleet.DeleteOutput(fts.LogstashOutput.id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"outputID": fts.LogstashOutput.id,
+			}).Warn("The Logstash output could not be deleted")
+		}
+	}
+
+	fts.suite.removeLogstash()
+
+	fts.LogstashOutput = nil
+}
+
+// theStandaloneAgentSendsItsDataToLogstash deploys Logstash, and configures the output of the
+// stand-alone agent deployed later in the scenario to send its data to it
+func (sats *StandAloneTestSuite) theStandaloneAgentSendsItsDataToLogstash() error {
+	// Logstash is removed after the scenario, even if it could not be started
+	sats.Logstash = true
+
+	err := sats.suite.deployLogstash()
+	if err != nil {
+		return err
+	}
+
+	// the settings of the elasticsearch output are replaced once the type of the output changes
+	sats.Config.Output = map[string]interface{}{
+		"hosts": []string{getLogstashHost()},
+		"type":  kibana.LogstashOutputType,
+	}
+
+	return nil
+}
+
+// thereIsDataFromTheStandaloneAgentInTheDataStreamThroughLogstash waits for the documents sent by
+// the stand-alone agent to a data stream, i.e. metrics-system.cpu-default, through the pipeline of
+// Logstash
+func (sats *StandAloneTestSuite) thereIsDataFromTheStandaloneAgentInTheDataStreamThroughLogstash(name string) error {
+	return sats.suite.waitForDataThroughLogstash(sats.Hostname, name)
+}
+
+// deployLogstash deploys Logstash into the profile, waiting for it to be healthy, with a pipeline
+// receiving the events of the agents and indexing them into Elasticsearch, tagged
+func (sc *SuiteContext) deployLogstash() error {
+	sc.env.put(map[string]string{
+		"logstashTag": stackVersion,
+	})
+
+	serviceManager := services.NewServiceManager()
+	err := serviceManager.AddServicesToCompose(FleetProfileName, []string{LogstashServiceName}, sc.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": LogstashServiceName,
+		}).Error("Could not deploy Logstash")
+		return err
+	}
+
+	options := services.WaitOptions{
+		Timeout: time.Duration(timeoutFactor) * time.Minute,
+	}
+
+	err = serviceManager.WaitForHealthy(FleetProfileName, []string{LogstashServiceName}, options)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"host": getLogstashHost(),
+	}).Info("Logstash is deployed")
+
+	return nil
+}
+
+// removeLogstash removes the service of Logstash from the profile
+func (sc *SuiteContext) removeLogstash() {
+	if developerMode {
+		log.WithField("service", LogstashServiceName).Info("Because we are running in development mode, the service won't be stopped")
+		return
+	}
+
+	serviceManager := services.NewServiceManager()
+	err := serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{LogstashServiceName}, sc.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":     err,
+			"service": LogstashServiceName,
+		}).Warn("Logstash could not be removed")
+	}
+}
+
+// waitForDataThroughLogstash waits for the documents sent by the agent of a hostname to a data
+// stream, which were indexed by the pipeline of Logstash, as they are tagged by it
+func (sc *SuiteContext) waitForDataThroughLogstash(hostname string, name string) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	minimumHitsCount := 1
+
+	dataStream, err := parseDataStreamName(name)
+	if err != nil {
+		return err
+	}
+
+	assertions, err := e2e.GetDataStreamAssertions()
+	if err != nil {
+		return err
+	}
+
+	selector := datastreams.Selector{
+		DataStream: dataStream,
+		Hostname:   hostname,
+		Tags:       []string{logstashEventsTag},
+	}
+
+	_, err = assertions.HasDocs(selector, minimumHitsCount, maxTimeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dataStream": name,
+			"error":      err,
+			"hostname":   hostname,
+		}).Error("There is no data from the agent through Logstash in the data stream")
+		return err
+	}
+
+	return nil
+}
+
+// getLogstashHost returns the host of the input of the agents in the pipeline of Logstash, in the
+// network of the profile
+func getLogstashHost() string {
+	return fmt.Sprintf("%s:%d", LogstashServiceName, logstashPort)
+}
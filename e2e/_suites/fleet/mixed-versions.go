@@ -0,0 +1,337 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// fleetAgent an agent deployed to Fleet in a scenario enrolling agents of several versions
+// into the same policy, each one in its own container
+type fleetAgent struct {
+	alias     string // the alias of the version in the scenario, i.e. N-1
+	cleanup   *e2e.Cleanup
+	container string // the container run from the service of the image
+	hostname  string
+	installer ElasticAgentInstaller
+	version   string
+}
+
+// agentsInVersionsAreDeployedToFleetWithInstaller deploys an agent for each version in a comma-separated list,
+// i.e. "N, N-1, N-2", enrolling them into the policy of the scenario
+func (fts *FleetTestSuite) agentsInVersionsAreDeployedToFleetWithInstaller(image string, versions string, installerType string) error {
+	enrollmentKey, err := fts.suite.createEnrollmentToken(fts.PolicyID)
+	if err != nil {
+		return err
+	}
+	fts.CurrentToken = enrollmentKey.APIKey
+	fts.CurrentTokenID = enrollmentKey.ID
+
+	for _, alias := range strings.Split(versions, ",") {
+		alias = strings.TrimSpace(alias)
+
+		version, err := resolveAgentVersion(alias)
+		if err != nil {
+			return err
+		}
+
+		agent, err := fts.suite.deployAgentInVersion(image, installerType, alias, version, len(fts.Agents)+1, fts.fleetServerURL(), fts.CurrentToken)
+		if agent != nil {
+			fts.Agents = append(fts.Agents, agent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allTheAgentsAreListedInFleetWithStatus waits for all the agents of the scenario to be listed in Fleet in a status
+func (fts *FleetTestSuite) allTheAgentsAreListedInFleetWithStatus(desiredStatus string) error {
+	for _, agent := range fts.Agents {
+		err := fts.suite.waitForAgentStatus(agent.hostname, desiredStatus)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"hostname": agent.hostname,
+				"status":   desiredStatus,
+				"version":  agent.version,
+			}).Error("The agent is not listed in Fleet in the desired status")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// allTheAgentsAreListedInFleetInTheirVersions waits for all the agents of the scenario to be listed in Fleet
+// in the version they were deployed with
+func (fts *FleetTestSuite) allTheAgentsAreListedInFleetInTheirVersions() error {
+	for _, agent := range fts.Agents {
+		err := fts.suite.waitForAgentVersion(agent.hostname, agent.version)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"alias":    agent.alias,
+				"error":    err,
+				"hostname": agent.hostname,
+				"version":  agent.version,
+			}).Error("The agent is not listed in Fleet in its version")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// theUpgradeIsOnlyAvailableForTheAgentsOlderThanTheStack checks that Fleet lists as upgradeable the agents
+// older than the stack which support upgrades, i.e. the ones installed with the tar installer, and only them
+func (fts *FleetTestSuite) theUpgradeIsOnlyAvailableForTheAgentsOlderThanTheStack() error {
+	upgradeableIDs, err := fts.suite.getUpgradeableAgentIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, agent := range fts.Agents {
+		agentID, err := fts.suite.getAgentID(agent.hostname)
+		if err != nil {
+			return err
+		}
+
+		listedAgent, err := fts.suite.fleet.GetAgent(agentID)
+		if err != nil {
+			return err
+		}
+
+		// the agents report if they support upgrades, and Fleet offers them to the ones older than Kibana
+		supportsUpgrades := listedAgent.LocalMetadata.Elastic.Agent.Upgradeable
+		expected := supportsUpgrades && compareVersions(agent.version, stackVersion) < 0
+		upgradeAvailable := upgradeableIDs[agentID]
+
+		log.WithFields(log.Fields{
+			"alias":            agent.alias,
+			"hostname":         agent.hostname,
+			"stackVersion":     stackVersion,
+			"supportsUpgrades": supportsUpgrades,
+			"upgradeAvailable": upgradeAvailable,
+			"version":          agent.version,
+		}).Debug("Upgrade availability of the agent")
+
+		if upgradeAvailable != expected {
+			return fmt.Errorf("The upgrade of the %s agent (%s) to the stack version %s should be available: %t, but it is: %t", agent.alias, agent.version, stackVersion, expected, upgradeAvailable)
+		}
+	}
+
+	return nil
+}
+
+// thereIsDataFromAllTheAgentsInTheIndex waits for the documents sent by each agent of the scenario,
+// with its version, to be searchable in an index, so that the data of all the versions is compatible
+// with the stack
+func (fts *FleetTestSuite) thereIsDataFromAllTheAgentsInTheIndex(index string) error {
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+
+	for _, agent := range fts.Agents {
+		query := map[string]interface{}{
+			"query": map[string]interface{}{
+				"bool": map[string]interface{}{
+					"filter": []interface{}{
+						map[string]interface{}{
+							"term": map[string]interface{}{"host.hostname": agent.hostname},
+						},
+						map[string]interface{}{
+							"term": map[string]interface{}{"agent.version": strings.TrimSuffix(agent.version, "-SNAPSHOT")},
+						},
+					},
+				},
+			},
+		}
+
+		_, err := e2e.WaitForNumberOfHits(index, query, 1, maxTimeout)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"alias":    agent.alias,
+				"error":    err,
+				"hostname": agent.hostname,
+				"index":    index,
+				"version":  agent.version,
+			}).Error("There is no data from the agent in the index")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeAgents un-enrolls the agents of the scenario, including the named ones, removing their containers
+func (fts *FleetTestSuite) removeAgents() {
+	for _, agent := range fts.Agents {
+		if agent.hostname != "" {
+			err := fts.suite.unenrollAgentsOfHostname(agent.hostname, true)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"err":      err,
+					"hostname": agent.hostname,
+				}).Warn("The agentIDs for the hostname could not be unenrolled")
+			}
+		}
+
+		if developerMode {
+			log.WithField("container", agent.container).Info("Because we are running in development mode, the container won't be removed")
+			agent.cleanup.Discard()
+			continue
+		}
+
+		_ = agent.cleanup.Run()
+	}
+
+	fts.Agents = nil
+	fts.NamedAgents = map[string]*fleetAgent{}
+}
+
+// compareVersions compares the major, minor and patch numbers of two versions, i.e. 7.10.1 and
+// 8.0.0-SNAPSHOT, returning a negative number if the first is older, zero if they are equal, and
+// a positive number if it is newer
+func compareVersions(a string, b string) int {
+	numbers := func(version string) []int {
+		version = strings.SplitN(version, "-", 2)[0]
+		parts := strings.Split(version, ".")
+
+		result := make([]int, 3)
+		for i := 0; i < len(parts) && i < len(result); i++ {
+			result[i], _ = strconv.Atoi(parts[i])
+		}
+		return result
+	}
+
+	x, y := numbers(a), numbers(b)
+	for i := range x {
+		if x[i] != y[i] {
+			return x[i] - y[i]
+		}
+	}
+
+	return 0
+}
+
+// deployAgentInVersion installs a version of the agent in a new container run from the service of
+// an image, enrolling it with a token into the Fleet Server at a URL, or into Kibana if it's empty.
+// The agent is returned as soon as its container exists, so that it is removed at the end of the
+// scenario even if the installation fails
+func (sc *SuiteContext) deployAgentInVersion(image string, installerType string, alias string, version string, index int, fleetServerURL string, token string) (*fleetAgent, error) {
+	if err := sc.deployer.checkSeveralAgentsSupported(); err != nil {
+		return nil, err
+	}
+
+	installer := GetElasticAgentInstaller(sc.deployer, image, installerType, version)
+
+	profile := installer.profile // name of the runtime dependencies compose file
+	service := installer.service // name of the service
+	containerName := fmt.Sprintf("%s_%s_%s_v%d", config.GetComposeProjectName(profile), service, ElasticAgentServiceName, index)
+
+	log.WithFields(log.Fields{
+		"alias":     alias,
+		"container": containerName,
+		"image":     image,
+		"installer": installerType,
+		"version":   version,
+	}).Trace("Deploying an agent in a version to Fleet")
+
+	envVarsPrefix := strings.ReplaceAll(service, "-", "_")
+	sc.env.put(map[string]string{envVarsPrefix + "Tag": installer.tag})
+
+	serviceManager := services.NewServiceManager()
+
+	composes := []string{
+		profile, // profile name
+		service, // service
+	}
+
+	agent := &fleetAgent{
+		alias:     alias,
+		container: containerName,
+		installer: installer,
+		version:   version,
+	}
+	agent.cleanup = e2e.RegisterCleanup("agent container: "+containerName, func() error {
+		return docker.RemoveContainer(containerName)
+	})
+
+	err := serviceManager.RunCommand(profile, composes, []string{"run", "-d", "--name", containerName, service}, sc.env.get())
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"service":   service,
+		}).Error("Could not run the container of the agent")
+		agent.cleanup.Discard()
+		return nil, err
+	}
+
+	// the commands of the installer are executed in the new container, where the binary of the
+	// version is copied
+	installer.host.container = containerName
+
+	err = sc.deployer.provider.AddFiles(e2e.ScenarioContext(), sc.deployer.serviceRequest(installer.host), map[string]string{installer.name: installer.path})
+	if err != nil {
+		return agent, err
+	}
+
+	err = installer.PreInstallFn()
+	if err != nil {
+		return agent, err
+	}
+
+	err = installer.InstallFn(containerName, fleetServerURL, token, nil)
+	if err != nil {
+		return agent, err
+	}
+
+	err = installer.PostInstallFn()
+	if err != nil {
+		return agent, err
+	}
+
+	// the installation process for TAR includes the enrollment
+	if !installer.enrollsOnInstall() {
+		err = installer.EnrollFn(fleetServerURL, token, nil)
+		if err != nil {
+			return agent, err
+		}
+	}
+
+	hostname, err := getContainerHostname(containerName)
+	if err != nil {
+		return agent, err
+	}
+	agent.hostname = hostname
+
+	return agent, nil
+}
+
+// getUpgradeableAgentIDs returns the IDs of the agents listed by Fleet as upgradeable to the version of Kibana
+func (sc *SuiteContext) getUpgradeableAgentIDs() (map[string]bool, error) {
+	agents, err := sc.fleet.ListAgents(kibana.AgentsQuery{PerPage: 100, ShowUpgradeable: true})
+	if err != nil {
+		return nil, err
+	}
+
+	agentIDs := map[string]bool{}
+	for _, agent := range agents {
+		agentIDs[agent.ID] = true
+	}
+
+	return agentIDs, nil
+}
@@ -0,0 +1,311 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPolicyName the name of the policy of the scenario in the steps of the named agents
+const defaultPolicyName = "default"
+
+// scenarioPolicy a policy created in a scenario, with the enrollment token of its agents
+type scenarioPolicy struct {
+	id      string
+	token   string // enrollment token of the agents of the policy
+	tokenID string
+}
+
+// aPolicyIsCreated creates a policy with a name, which the named agents of the scenario are
+// enrolled into or reassigned to
+func (fts *FleetTestSuite) aPolicyIsCreated(name string) error {
+	if name == defaultPolicyName {
+		return fmt.Errorf("The %s policy is the policy of the scenario, and it cannot be created", defaultPolicyName)
+	}
+
+	if _, exists := fts.Policies[name]; exists {
+		return fmt.Errorf("The %s policy was already created in the scenario", name)
+	}
+
+	policy, err := fts.suite.fleet.CreateAgentPolicy(fmt.Sprintf("Test policy %s %s", name, uuid.New().String()), "default", "Policy created by the e2e tests")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"policy": name,
+		}).Error("Could not create the policy")
+		return err
+	}
+
+	// the policy is registered before its token is created, so that it's deleted anyway
+	fts.Policies[name] = &scenarioPolicy{id: policy.ID}
+
+	return nil
+}
+
+// agentIsAssignedToPolicy waits for a named agent to be listed in Fleet in a policy
+func (fts *FleetTestSuite) agentIsAssignedToPolicy(name string, policyName string) error {
+	agent, err := fts.getNamedAgent(name)
+	if err != nil {
+		return err
+	}
+
+	policyID, err := fts.getPolicyID(policyName)
+	if err != nil {
+		return err
+	}
+
+	maxTimeout := e2e.GetWaitTimeout(e2e.PolicyAppliedTimeout, time.Duration(timeoutFactor)*time.Minute*2)
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	agentInPolicyFn := func() error {
+		agentID, err := fts.suite.getAgentID(agent.hostname)
+		if err != nil {
+			return err
+		}
+		if agentID == "" {
+			return fmt.Errorf("The %s agent is not listed in Fleet", name)
+		}
+
+		listedAgent, err := fts.suite.fleet.GetAgent(agentID)
+		if err != nil {
+			return err
+		}
+
+		if listedAgent.PolicyID != policyID {
+			log.WithFields(log.Fields{
+				"agent":         name,
+				"agentID":       agentID,
+				"desiredPolicy": policyID,
+				"elapsedTime":   exp.GetElapsedTime(),
+				"policy":        listedAgent.PolicyID,
+			}).Warn("The agent is not assigned to the desired policy yet")
+			return fmt.Errorf("The %s agent is assigned to the %s policy, but it should be assigned to the %s policy (%s)", name, listedAgent.PolicyID, policyName, policyID)
+		}
+
+		return nil
+	}
+
+	return backoff.Retry(agentInPolicyFn, exp)
+}
+
+// agentIsDeployedToFleetWithInstaller deploys an agent with a name in the version under test,
+// enrolling it into the policy of the scenario
+func (fts *FleetTestSuite) agentIsDeployedToFleetWithInstaller(name string, image string, installerType string) error {
+	return fts.agentIsDeployedToFleetWithInstallerIntoPolicy(name, image, installerType, defaultPolicyName)
+}
+
+// agentIsDeployedToFleetWithInstallerIntoPolicy deploys an agent with a name in the version under
+// test, enrolling it into a policy of the scenario
+func (fts *FleetTestSuite) agentIsDeployedToFleetWithInstallerIntoPolicy(name string, image string, installerType string, policyName string) error {
+	token, err := fts.getPolicyEnrollmentToken(policyName)
+	if err != nil {
+		return err
+	}
+
+	return fts.deployNamedAgent(name, image, installerType, policyName, token)
+}
+
+// deployNamedAgent deploys an agent with a name in the version under test, enrolling it into a
+// policy of the scenario with an enrollment token
+func (fts *FleetTestSuite) deployNamedAgent(name string, image string, installerType string, policyName string, token string) error {
+	if _, exists := fts.NamedAgents[name]; exists {
+		return fmt.Errorf("The %s agent was already deployed in the scenario", name)
+	}
+
+	agent, err := fts.suite.deployAgentInVersion(image, installerType, "N", agentVersion, len(fts.Agents)+1, fts.fleetServerURL(), token)
+	if agent != nil {
+		// the named agents are removed with the rest of agents of the scenario
+		fts.Agents = append(fts.Agents, agent)
+		fts.NamedAgents[name] = agent
+	}
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"agent":    name,
+		"hostname": agent.hostname,
+		"policy":   policyName,
+	}).Debug("The agent was deployed to Fleet")
+
+	return nil
+}
+
+// agentIsListedInFleetWithStatus waits for a named agent to be listed in Fleet in a status
+func (fts *FleetTestSuite) agentIsListedInFleetWithStatus(name string, desiredStatus string) error {
+	agent, err := fts.getNamedAgent(name)
+	if err != nil {
+		return err
+	}
+
+	return fts.suite.waitForAgentStatus(agent.hostname, desiredStatus)
+}
+
+// agentIsReassignedToPolicy reassigns a named agent to a policy of the scenario
+func (fts *FleetTestSuite) agentIsReassignedToPolicy(name string, policyName string) error {
+	agent, err := fts.getNamedAgent(name)
+	if err != nil {
+		return err
+	}
+
+	policyID, err := fts.getPolicyID(policyName)
+	if err != nil {
+		return err
+	}
+
+	agentID, err := fts.suite.getAgentID(agent.hostname)
+	if err != nil {
+		return err
+	}
+	if agentID == "" {
+		return fmt.Errorf("The %s agent is not listed in Fleet", name)
+	}
+
+	return fts.suite.fleet.ReassignAgent(agentID, policyID)
+}
+
+// agentIsUnenrolled un-enrolls a named agent, keeping the rest of agents of the scenario
+func (fts *FleetTestSuite) agentIsUnenrolled(name string) error {
+	agent, err := fts.getNamedAgent(name)
+	if err != nil {
+		return err
+	}
+
+	return fts.suite.unenrollAgentsOfHostname(agent.hostname, false)
+}
+
+// createScenarioPolicy creates the policy of a scenario, named after it, with the system
+// integration as in the default policy
+func (fts *FleetTestSuite) createScenarioPolicy(scenario string) error {
+	policy, err := fts.suite.fleet.CreateAgentPolicyWithSystemMonitoring(fmt.Sprintf("Test policy for %s %s", scenario, uuid.New().String()), "default", "Policy of a scenario created by the e2e tests")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"scenario": scenario,
+		}).Warn("The policy of the scenario could not be created")
+		return err
+	}
+
+	fts.PolicyCreated = true
+	fts.PolicyID = policy.ID
+
+	return nil
+}
+
+// getNamedAgent returns an agent deployed in the scenario by its name
+func (fts *FleetTestSuite) getNamedAgent(name string) (*fleetAgent, error) {
+	agent, exists := fts.NamedAgents[name]
+	if !exists {
+		return nil, fmt.Errorf("There is no %s agent in the scenario", name)
+	}
+
+	if agent.hostname == "" {
+		return nil, fmt.Errorf("The %s agent was not deployed successfully, as it has no hostname", name)
+	}
+
+	return agent, nil
+}
+
+// getPolicyEnrollmentToken returns the enrollment token of a policy of the scenario, which is
+// created the first time an agent is enrolled into the policy
+func (fts *FleetTestSuite) getPolicyEnrollmentToken(policyName string) (string, error) {
+	if policyName == defaultPolicyName {
+		if fts.CurrentToken == "" || fts.CurrentTokenID == "" {
+			enrollmentKey, err := fts.suite.createEnrollmentToken(fts.PolicyID)
+			if err != nil {
+				return "", err
+			}
+			fts.CurrentToken = enrollmentKey.APIKey
+			fts.CurrentTokenID = enrollmentKey.ID
+		}
+
+		return fts.CurrentToken, nil
+	}
+
+	policy, exists := fts.Policies[policyName]
+	if !exists {
+		return "", fmt.Errorf("There is no %s policy in the scenario", policyName)
+	}
+
+	if policy.token == "" {
+		enrollmentKey, err := fts.suite.createEnrollmentToken(policy.id)
+		// the token is deleted with the policy, even if its secret could not be retrieved
+		policy.tokenID = enrollmentKey.ID
+		if err != nil {
+			return "", err
+		}
+		policy.token = enrollmentKey.APIKey
+	}
+
+	return policy.token, nil
+}
+
+// getPolicyID returns the ID of a policy of the scenario by its name, being the default one the
+// policy of the scenario
+func (fts *FleetTestSuite) getPolicyID(policyName string) (string, error) {
+	if policyName == defaultPolicyName {
+		return fts.PolicyID, nil
+	}
+
+	policy, exists := fts.Policies[policyName]
+	if !exists {
+		return "", fmt.Errorf("There is no %s policy in the scenario", policyName)
+	}
+
+	return policy.id, nil
+}
+
+// removePolicies deletes the policies created in the scenario, with their enrollment tokens,
+// once their agents were un-enrolled
+func (fts *FleetTestSuite) removePolicies() {
+	for name, policy := range fts.Policies {
+		if policy.tokenID != "" {
+			err := fts.suite.fleet.DeleteEnrollmentAPIKey(policy.tokenID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"err":     err,
+					"policy":  name,
+					"tokenID": policy.tokenID,
+				}).Warn("The enrollment token of the policy could not be deleted")
+			}
+		}
+
+		err := fts.suite.fleet.DeleteAgentPolicy(policy.id)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"err":      err,
+				"policy":   name,
+				"policyID": policy.id,
+			}).Warn("The policy could not be deleted")
+		}
+	}
+
+	fts.Policies = map[string]*scenarioPolicy{}
+}
+
+// removeScenarioPolicy deletes the policy of the scenario if it was created by the scenario,
+// which is not the default one
+func (fts *FleetTestSuite) removeScenarioPolicy() {
+	if !fts.PolicyCreated {
+		return
+	}
+
+	err := fts.suite.fleet.DeleteAgentPolicy(fts.PolicyID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err":      err,
+			"policyID": fts.PolicyID,
+		}).Warn("The policy of the scenario could not be deleted")
+	}
+
+	fts.PolicyCreated = false
+	fts.PolicyID = ""
+}
@@ -0,0 +1,352 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// packagePolicyBuilder builds the package policy of an integration from the manifest of its package
+// in the Package Registry, so that the scenarios of the new integrations do not hardcode its payload:
+// the inputs of its policy templates and the streams of its data streams are rendered with the
+// default values of their vars, which are changed by the options, and the required vars without a
+// value are reported before the package policy is sent to Fleet
+type packagePolicyBuilder struct {
+	manifest kibana.PackageManifest
+	options  []packagePolicyOption
+	policyID string
+}
+
+// newPackagePolicyBuilder returns the builder of the package policy adding an integration to a
+// policy, fetching the manifest of its package
+func (sc *SuiteContext) newPackagePolicyBuilder(integration kibana.Package, policyID string) (*packagePolicyBuilder, error) {
+	manifest, err := sc.fleet.GetPackageManifest(integration.Name, integration.Version)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":       err,
+			"integration": integration.Name,
+			"version":     integration.Version,
+		}).Error("Could not get the manifest of the integration")
+		return nil, err
+	}
+
+	return &packagePolicyBuilder{
+		manifest: manifest,
+		options:  []packagePolicyOption{},
+		policyID: policyID,
+	}, nil
+}
+
+// withInput enables or disables an input of the package policy, by its type, i.e. logfile
+func (b *packagePolicyBuilder) withInput(input string, enabled bool) *packagePolicyBuilder {
+	return b.withOptions(integrationSettingOption{Path: input + ".enabled", Value: enabled})
+}
+
+// withStream enables or disables the stream of an input reading a data stream, by its dataset,
+// i.e. system.auth
+func (b *packagePolicyBuilder) withStream(input string, dataset string, enabled bool) *packagePolicyBuilder {
+	return b.withOptions(integrationSettingOption{Path: input + "." + dataset + ".enabled", Value: enabled})
+}
+
+// withVar sets a var of the package, of an input, or of the stream of an input reading a data stream,
+// when the input and the dataset are empty, or only the dataset is
+func (b *packagePolicyBuilder) withVar(input string, dataset string, name string, value interface{}) *packagePolicyBuilder {
+	if input == "" {
+		return b.withOptions(packageVarOption{Name: name, Value: value})
+	}
+
+	path := input + "." + name
+	if dataset != "" {
+		path = input + "." + dataset + "." + name
+	}
+
+	return b.withOptions(integrationSettingOption{Path: path, Value: value})
+}
+
+// withOptions adds changes to the rendered package policy, which are applied in order
+func (b *packagePolicyBuilder) withOptions(options ...packagePolicyOption) *packagePolicyBuilder {
+	b.options = append(b.options, options...)
+	return b
+}
+
+// build renders the package policy, applies the options to it, and validates that its required vars
+// have a value, failing if an option is not supported by the package policy or a var is missing
+func (b *packagePolicyBuilder) build() (kibana.PackagePolicy, error) {
+	packagePolicy := b.render()
+
+	for _, option := range b.options {
+		err := option.applyTo(&packagePolicy)
+		if err != nil {
+			return kibana.PackagePolicy{}, err
+		}
+	}
+
+	missing, err := b.missingVars(packagePolicy)
+	if err != nil {
+		return kibana.PackagePolicy{}, err
+	}
+	if len(missing) > 0 {
+		return kibana.PackagePolicy{}, fmt.Errorf("The required vars of the %s package policy have no value: %s", b.manifest.Name, strings.Join(missing, ", "))
+	}
+
+	if log.IsLevelEnabled(log.TraceLevel) {
+		payload, _ := json.MarshalIndent(packagePolicy, "", "  ")
+		log.WithFields(log.Fields{
+			"integration": b.manifest.Name,
+			"payload":     string(payload),
+			"version":     b.manifest.Version,
+		}).Trace("Package policy rendered")
+	}
+
+	return packagePolicy, nil
+}
+
+// render returns the package policy with an input for each input of the policy templates, with the
+// streams of the data streams read from it, all of them enabled unless their manifest disables them,
+// and their vars set to their default values
+func (b *packagePolicyBuilder) render() kibana.PackagePolicy {
+	packagePolicy := newPackagePolicy(kibana.Package{
+		Name:    b.manifest.Name,
+		Title:   b.manifest.Title,
+		Version: b.manifest.Version,
+	}, b.policyID)
+	packagePolicy.Inputs = []kibana.PackagePolicyInput{}
+	packagePolicy.Vars = renderVars(b.manifest.Vars)
+
+	for _, template := range b.manifest.PolicyTemplates {
+		for _, input := range template.Inputs {
+			policyInput := kibana.PackagePolicyInput{
+				Enabled:        true,
+				PolicyTemplate: template.Name,
+				Streams:        []json.RawMessage{},
+				Type:           input.Type,
+				Vars:           renderVars(input.Vars),
+			}
+
+			for _, dataStream := range b.manifest.DataStreams {
+				if len(template.DataStreams) > 0 && !containsDataset(template.DataStreams, dataStream.Dataset) {
+					continue
+				}
+
+				for _, stream := range dataStream.Streams {
+					if stream.Input != input.Type {
+						continue
+					}
+
+					raw, err := json.Marshal(map[string]interface{}{
+						"data_stream": map[string]string{
+							"dataset": dataStream.Dataset,
+							"type":    dataStream.Type,
+						},
+						"enabled": stream.Enabled == nil || *stream.Enabled,
+						"vars":    renderVars(stream.Vars),
+					})
+					if err != nil {
+						continue
+					}
+
+					policyInput.Streams = append(policyInput.Streams, raw)
+				}
+			}
+
+			packagePolicy.Inputs = append(packagePolicy.Inputs, policyInput)
+		}
+	}
+
+	return packagePolicy
+}
+
+// missingVars returns the required vars of the package, of the enabled inputs and of their enabled
+// streams without a value, by their path, i.e. logfile.system.auth.paths
+func (b *packagePolicyBuilder) missingVars(packagePolicy kibana.PackagePolicy) ([]string, error) {
+	missing := []string{}
+
+	for _, v := range b.manifest.Vars {
+		if v.Required && isEmptyValue(packagePolicy.Vars[v.Name].Value) {
+			missing = append(missing, v.Name)
+		}
+	}
+
+	for _, template := range b.manifest.PolicyTemplates {
+		for _, input := range template.Inputs {
+			policyInput := findPolicyInput(packagePolicy, template.Name, input.Type)
+			if policyInput == nil || !policyInput.Enabled {
+				continue
+			}
+
+			for _, v := range input.Vars {
+				if v.Required && isEmptyValue(policyInput.Vars[v.Name].Value) {
+					missing = append(missing, input.Type+"."+v.Name)
+				}
+			}
+
+			for _, raw := range policyInput.Streams {
+				stream := struct {
+					DataStream struct {
+						Dataset string `json:"dataset"`
+					} `json:"data_stream"`
+					Enabled bool                                       `json:"enabled"`
+					Vars    map[string]kibana.PackagePolicyConfigValue `json:"vars"`
+				}{}
+
+				err := json.Unmarshal(raw, &stream)
+				if err != nil {
+					return nil, fmt.Errorf("The %s input of the %s package policy has an invalid stream: %w", input.Type, b.manifest.Name, err)
+				}
+
+				if !stream.Enabled {
+					continue
+				}
+
+				for _, v := range b.streamVars(input.Type, stream.DataStream.Dataset) {
+					if v.Required && isEmptyValue(stream.Vars[v.Name].Value) {
+						missing = append(missing, input.Type+"."+stream.DataStream.Dataset+"."+v.Name)
+					}
+				}
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// streamVars returns the vars of the stream of an input reading a data stream, by its dataset
+func (b *packagePolicyBuilder) streamVars(input string, dataset string) []kibana.PackageVar {
+	for _, dataStream := range b.manifest.DataStreams {
+		if dataStream.Dataset != dataset {
+			continue
+		}
+
+		for _, stream := range dataStream.Streams {
+			if stream.Input == input {
+				return stream.Vars
+			}
+		}
+	}
+
+	return nil
+}
+
+// packageVarOption sets a var of the package, shared by its inputs
+type packageVarOption struct {
+	Name  string
+	Value interface{}
+}
+
+// applyTo sets the var in the package policy, failing if the package has no such var
+func (o packageVarOption) applyTo(packagePolicy *kibana.PackagePolicy) error {
+	configValue, exists := packagePolicy.Vars[o.Name]
+	if !exists {
+		return fmt.Errorf("The %s package policy has no %s var", packagePolicy.Package.Name, o.Name)
+	}
+
+	configValue.Value = o.Value
+	packagePolicy.Vars[o.Name] = configValue
+	return nil
+}
+
+// String describes the change
+func (o packageVarOption) String() string {
+	return fmt.Sprintf("%s: %v", o.Name, o.Value)
+}
+
+// renderVars returns the config values of some vars, set to their default values, which are an empty
+// list for the vars with several values and no default
+func renderVars(vars []kibana.PackageVar) map[string]kibana.PackagePolicyConfigValue {
+	values := map[string]kibana.PackagePolicyConfigValue{}
+
+	for _, v := range vars {
+		value := v.Default
+		if value == nil && v.Multi {
+			value = []interface{}{}
+		}
+
+		values[v.Name] = kibana.PackagePolicyConfigValue{Type: v.Type, Value: value}
+	}
+
+	return values
+}
+
+// findPolicyInput returns the input of a package policy of a type, for a policy template
+func findPolicyInput(packagePolicy kibana.PackagePolicy, template string, inputType string) *kibana.PackagePolicyInput {
+	for i, input := range packagePolicy.Inputs {
+		if input.Type == inputType && input.PolicyTemplate == template {
+			return &packagePolicy.Inputs[i]
+		}
+	}
+
+	return nil
+}
+
+// containsDataset reports if a dataset is in a list of datasets, which could be listed by the name
+// of their data stream, i.e. auth for system.auth
+func containsDataset(datasets []string, dataset string) bool {
+	for _, d := range datasets {
+		if d == dataset || strings.HasSuffix(dataset, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEmptyValue reports if the value of a var is not set: nil, an empty string or an empty list
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	case []interface{}:
+		return len(v) == 0
+	case []string:
+		return len(v) == 0
+	}
+
+	return false
+}
+
+// theIntegrationIsAddedToThePolicyWith adds an integration to the policy of the agent, rendering its
+// package policy from the manifest of its package with the settings of a data table, i.e.
+// "logfile.system.auth.paths | ["/var/log/secure"]"
+func (fts *FleetTestSuite) theIntegrationIsAddedToThePolicyWith(title string, settings *godog.Table) error {
+	options, err := newIntegrationSettingOptions(settings)
+	if err != nil {
+		return err
+	}
+
+	integration, err := fts.suite.getRegistryPackage(title)
+	if err != nil {
+		return err
+	}
+
+	builder, err := fts.suite.newPackagePolicyBuilder(integration, fts.PolicyID)
+	if err != nil {
+		return err
+	}
+
+	packagePolicy, err := builder.withOptions(options...).build()
+	if err != nil {
+		return err
+	}
+
+	changedAt := time.Now()
+
+	packagePolicy, err = fts.suite.fleet.AddPackagePolicy(packagePolicy)
+	if err != nil {
+		return err
+	}
+
+	fts.Integration = packagePolicy
+	fts.recordPolicyChange(changedAt)
+	return nil
+}
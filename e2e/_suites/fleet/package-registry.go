@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// theIntegrationIsAvailableInThePackageRegistry checks that an integration, by its title, is listed
+// by Fleet from the Package Registry used by Kibana, which is the one run by the profile unless
+// PACKAGE_REGISTRY_URL is set. If a version is passed, it checks that the version is available,
+// i.e. the one the scenarios were written for, which could not be the latest one
+func (fts *FleetTestSuite) theIntegrationIsAvailableInThePackageRegistry(title string, version string) error {
+	latest, err := fts.suite.getRegistryPackage(title)
+	if err != nil || version == "" {
+		return err
+	}
+
+	pkg, err := fts.suite.fleet.GetPackage(latest.Name, version)
+	if errors.Is(err, kibana.ErrNotFound) {
+		return fmt.Errorf("the %s integration in the %s version, being %s the latest one: %w", title, version, latest.Version, e2eerrors.ErrIntegrationNotFound)
+	} else if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"latestVersion": latest.Version,
+		"name":          pkg.Name,
+		"version":       pkg.Version,
+	}).Debug("The version of the integration is available in the Package Registry")
+
+	return nil
+}
+
+// getRegistryPackage returns the latest version of an integration in the Package Registry, by its
+// title, failing with ErrIntegrationNotFound if it's not available
+func (sc *SuiteContext) getRegistryPackage(title string) (kibana.Package, error) {
+	pkg, err := sc.fleet.GetPackageByTitle(title)
+	if errors.Is(err, kibana.ErrNotFound) {
+		log.WithFields(log.Fields{
+			"image": packageRegistryImage,
+			"title": title,
+			"url":   packageRegistryURL,
+		}).Warn("The integration is not available in the Package Registry")
+		return kibana.Package{}, fmt.Errorf("the %s integration in the Package Registry: %w", title, e2eerrors.ErrIntegrationNotFound)
+	} else if err != nil {
+		return kibana.Package{}, err
+	}
+
+	return pkg, nil
+}
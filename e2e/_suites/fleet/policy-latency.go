@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// policyAcknowledgementLatency the name of the latency between a change of the policy and its
+// acknowledgement by the agent, measured in the benchmarks and checked against its SLO
+const policyAcknowledgementLatency = "policy-acknowledgement"
+
+// recordPolicyChange keeps the moment an integration was added to or removed from the policy, and
+// the revision of the policy with the change, so that the latency of its acknowledgement by the
+// agent is measured
+func (fts *FleetTestSuite) recordPolicyChange(changedAt time.Time) {
+	policy, err := fts.suite.fleet.GetAgentPolicy(fts.PolicyID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"policyID": fts.PolicyID,
+		}).Warn("Could not get the revision of the policy, its acknowledgement by the agent cannot be measured")
+		return
+	}
+
+	fts.PolicyChangedAt = changedAt
+	fts.PolicyRevision = policy.Revision
+}
+
+// theAgentAcknowledgesThePolicyChange waits for the agent to acknowledge the revision of the policy
+// with the last integration added to or removed from it, recording the latency since the change
+func (fts *FleetTestSuite) theAgentAcknowledgesThePolicyChange() error {
+	if fts.PolicyChangedAt.IsZero() {
+		return fmt.Errorf("there is no change of the policy to acknowledge in the scenario")
+	}
+
+	maxTimeout := e2e.GetWaitTimeout(e2e.PolicyAppliedTimeout, time.Duration(timeoutFactor)*time.Minute)
+	retryCount := 1
+
+	exp := e2e.GetExponentialBackOff(maxTimeout)
+
+	policyAcknowledgedFn := func() error {
+		agent, err := fts.suite.fleet.GetAgentByHostname(fts.Hostname)
+		if errors.Is(err, kibana.ErrNotFound) {
+			retryCount++
+			return fmt.Errorf("the agent of the %s hostname: %w", fts.Hostname, e2eerrors.ErrAgentNotListed)
+		} else if err != nil {
+			retryCount++
+			return err
+		}
+
+		if agent.PolicyRevision < fts.PolicyRevision {
+			log.WithFields(log.Fields{
+				"acknowledged": agent.PolicyRevision,
+				"elapsedTime":  exp.GetElapsedTime(),
+				"hostname":     fts.Hostname,
+				"retries":      retryCount,
+				"revision":     fts.PolicyRevision,
+			}).Warn("The agent has not acknowledged the revision of the policy yet")
+			retryCount++
+
+			return fmt.Errorf("the agent acknowledged the revision %d of the policy, not the %d yet", agent.PolicyRevision, fts.PolicyRevision)
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"hostname":    fts.Hostname,
+			"retries":     retryCount,
+			"revision":    agent.PolicyRevision,
+		}).Info("The agent acknowledged the revision of the policy")
+		return nil
+	}
+
+	err := backoff.Retry(policyAcknowledgedFn, exp)
+	if err != nil {
+		return &e2eerrors.StatusTimeoutError{
+			Elapsed:  exp.GetElapsedTime(),
+			Err:      err,
+			Resource: fmt.Sprintf("the agent of the %s hostname", fts.Hostname),
+			Status:   fmt.Sprintf("revision %d of the policy", fts.PolicyRevision),
+		}
+	}
+
+	changedAt := fts.PolicyChangedAt
+	fts.PolicyChangedAt = time.Time{}
+
+	return e2e.RecordLatency(policyAcknowledgementLatency, changedAt, map[string]string{
+		"hostname": fts.Hostname,
+		"policyId": fts.PolicyID,
+		"revision": strconv.Itoa(fts.PolicyRevision),
+	})
+}
@@ -1,22 +1,25 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/config"
 	"github.com/elastic/e2e-testing/cli/shell"
 	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/deploy"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 // to avoid downloading the same artifacts, we are adding this map to cache the URL of the downloaded binaries, using as key
 // the URL of the artifact. If another installer is trying to download the same URL, it will return the location of the
 // already downloaded artifact.
-var binariesCache = map[string]string{}
 
 // ElasticAgentInstaller represents how to install an agent, depending of the box type
 type ElasticAgentInstaller struct {
@@ -26,12 +29,14 @@ type ElasticAgentInstaller struct {
 	artifactOS        string // OS of the artifact
 	artifactVersion   string // version of the artifact
 	binDir            string // location of the binary
+	binaryPath        string // the installed binary of the agent, or its name if it's in the PATH
 	commitFile        string // elastic agent commit file
-	EnrollFn          func(token string) error
-	homeDir           string // elastic agent home dir
-	image             string // docker image
+	EnrollFn          func(fleetServerURL string, token string, tags []string) error
+	homeDir           string     // elastic agent home dir
+	host              *agentHost // the box where the agent is installed
+	image             string     // docker image
 	installerType     string
-	InstallFn         func(containerName string, token string) error
+	InstallFn         func(containerName string, fleetServerURL string, token string, tags []string) error
 	InstallCertsFn    func() error
 	logFile           string // the name of the log file
 	logsDir           string // location of the logs
@@ -47,13 +52,175 @@ type ElasticAgentInstaller struct {
 	workingDir        string // location of the application
 }
 
+// agentHost the box where an agent is installed: the container of a service of the profile, or a
+// container run from the service, when several agents are deployed in the same scenario, or a
+// remote host
+type agentHost struct {
+	container string         // the container run from the service, empty for the container of the service
+	deployer  *agentDeployer // the deployer of the box
+	image     string         // docker-compose file of the service
+	os        string         // linux, or windows for the remote Windows hosts
+	profile   string         // parent docker-compose file
+	service   string         // name of the service
+}
+
+// newAgentHost returns the box of the container of a service of the profile, deployed by a deployer
+func newAgentHost(d *agentDeployer, profile string, image string, service string) *agentHost {
+	return &agentHost{
+		deployer: d,
+		image:    image,
+		os:       linuxOS,
+		profile:  profile,
+		service:  service,
+	}
+}
+
+// exec executes a command in the box, with the deployer of the agents
+func (h *agentHost) exec(cmds []string, detach bool) error {
+	return h.deployer.exec(h, cmds, detach)
+}
+
+// trustCA adds the certificate of the CA of the secured stack to the ones trusted by the system of
+// the box, so that the agent and the beats it runs reach Kibana and Elasticsearch with TLS. It does
+// nothing when the stack is not secured
+func (h *agentHost) trustCA() error {
+	caCertPath := config.GetCACertPath()
+	if caCertPath == "" {
+		return nil
+	}
+
+	caCert, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  caCertPath,
+		}).Error("Could not read the CA certificate")
+		return err
+	}
+
+	if h.os == windowsOS {
+		return h.trustWindowsCA(string(caCert))
+	}
+
+	anchor := "/usr/local/share/ca-certificates/elastic-e2e-testing-ca.crt"
+	installCmd := "apt-get update && apt-get install -y ca-certificates"
+	updateCmd := "update-ca-certificates"
+	if isRPMBased(h.image) {
+		anchor = "/etc/pki/ca-trust/source/anchors/elastic-e2e-testing-ca.crt"
+		installCmd = "yum install -y ca-certificates"
+		updateCmd = "update-ca-trust extract"
+	}
+
+	// the tools managing the trusted CAs are installed only if the box does not have them
+	script := fmt.Sprintf(
+		"(command -v %s || %s) && mkdir -p %s && echo '%s' > %s && %s",
+		strings.Fields(updateCmd)[0], installCmd, filepath.Dir(anchor), strings.TrimSpace(string(caCert)), anchor, updateCmd)
+
+	err = h.exec([]string{"sh", "-c", script}, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": h.container,
+			"error":     err,
+			"service":   h.service,
+		}).Error("Could not trust the CA of the secured stack")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"anchor":    anchor,
+		"container": h.container,
+		"service":   h.service,
+	}).Debug("The CA of the secured stack is trusted")
+
+	return nil
+}
+
+// trustWindowsCA imports a certificate into the trusted root CAs of the local machine of a Windows box
+func (h *agentHost) trustWindowsCA(caCert string) error {
+	script := fmt.Sprintf(
+		"$f = New-TemporaryFile; Set-Content -Path $f -Value '%s'; Import-Certificate -FilePath $f -CertStoreLocation Cert:\\LocalMachine\\Root | Out-Null; Remove-Item $f",
+		strings.TrimSpace(caCert))
+
+	err := h.exec(powershellScript(script), false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"os":    h.os,
+		}).Error("Could not trust the CA of the secured stack")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"os": h.os,
+	}).Debug("The CA of the secured stack is trusted")
+
+	return nil
+}
+
+// getAgentEnrollArgs returns the args of the enroll command of the agents: the URL of the Fleet Server
+// and the token as flags if the URL is set, or the URL of Kibana and the token otherwise, which is
+// the only form supported by the older agents, and the tags of the agent, if any
+func getAgentEnrollArgs(fleetServerURL string, token string, tags []string) []string {
+	args := []string{getAgentKibanaURL(), token}
+	if fleetServerURL != "" {
+		args = []string{"--url", fleetServerURL, "--enrollment-token", token}
+	}
+	args = append(args, "-f")
+	args = append(args, getAgentTagArgs(tags)...)
+
+	return append(args, getAgentTLSArgs()...)
+}
+
+// getAgentInstallArgs returns the args of the install command of the agents, enrolling them with a
+// token into the Fleet Server at a URL, or into Kibana if it's empty, with their tags, if any
+func getAgentInstallArgs(fleetServerURL string, token string, tags []string) []string {
+	args := []string{"--force", "--enrollment-token", token}
+	if fleetServerURL != "" {
+		args = append(args, "--url", fleetServerURL)
+	} else {
+		args = append(args, "--kibana-url", getAgentKibanaURL())
+	}
+	args = append(args, getAgentTagArgs(tags)...)
+
+	return append(args, getAgentTLSArgs()...)
+}
+
+// getAgentKibanaURL returns the URL of Kibana in the network of the profile, used by the agents to
+// enroll into Fleet, with https when the stack is secured
+func getAgentKibanaURL() string {
+	return config.GetURLScheme() + "://kibana:5601"
+}
+
+// getAgentTagArgs returns the args of the agent commands enrolling into Fleet which set the tags of
+// the agent, listed in Fleet, none if the agent has no tags
+func getAgentTagArgs(tags []string) []string {
+	if len(tags) == 0 {
+		return []string{}
+	}
+
+	return []string{"--tag", strings.Join(tags, ",")}
+}
+
+// getAgentTLSArgs returns the args of the agent commands enrolling into Fleet, which allow insecure
+// connections unless the stack is secured, as the agents trust its CA then
+func getAgentTLSArgs() []string {
+	if config.GetCACertPath() != "" {
+		return []string{}
+	}
+
+	return []string{"--insecure"}
+}
+
 // listElasticAgentWorkingDirContent list Elastic Agent's working dir content
 func (i *ElasticAgentInstaller) listElasticAgentWorkingDirContent(containerName string) (string, error) {
 	cmd := []string{
 		"ls", "-l", i.workingDir,
 	}
+	if i.host.os == windowsOS {
+		cmd = []string{"Get-ChildItem", "-Force", i.workingDir}
+	}
 
-	content, err := docker.ExecCommandIntoContainer(context.Background(), containerName, "root", cmd)
+	content, err := i.host.deployer.output(containerName, cmd)
 	if err != nil {
 		return "", err
 	}
@@ -72,15 +239,13 @@ func (i *ElasticAgentInstaller) listElasticAgentWorkingDirContent(containerName
 func (i *ElasticAgentInstaller) getElasticAgentHash(containerName string) (string, error) {
 	commitFile := i.homeDir + i.commitFile
 
-	return getElasticAgentHash(containerName, commitFile)
+	return getElasticAgentHash(i.host.deployer, containerName, commitFile)
 }
 
-func getElasticAgentHash(containerName string, commitFile string) (string, error) {
-	cmd := []string{
-		"cat", commitFile,
-	}
+func getElasticAgentHash(d *agentDeployer, containerName string, commitFile string) (string, error) {
+	cmd := d.readFileCmd(commitFile, 0)
 
-	fullHash, err := docker.ExecCommandIntoContainer(context.Background(), containerName, "root", cmd)
+	fullHash, err := d.output(containerName, cmd)
 	if err != nil {
 		return "", err
 	}
@@ -98,6 +263,73 @@ func getElasticAgentHash(containerName string, commitFile string) (string, error
 	return shortHash, nil
 }
 
+// collectArtifacts writes the content of the working dir, the status and the diagnostics, and the
+// logs of the agent running in a container, and of the applications it runs, i.e. filebeat and
+// metricbeat, into the artifacts bundle of a failed scenario
+func (i *ElasticAgentInstaller) collectArtifacts(containerName string, bundleDir string) error {
+	content, err := i.listElasticAgentWorkingDirContent(containerName)
+	if err == nil {
+		_ = e2e.WriteArtifact(bundleDir, "elastic-agent-working-dir.txt", content)
+	}
+
+	// the output of the commands includes their errors, i.e. if the agent is not running
+	diagnostics := map[string][]string{
+		"elastic-agent-diagnostics.txt": {i.binaryPath, "diagnostics"},
+		"elastic-agent-status.txt":      {i.binaryPath, "status"},
+	}
+	for fileName, cmds := range diagnostics {
+		output, err := i.host.deployer.output(containerName, cmds)
+		if err == nil {
+			_ = e2e.WriteArtifact(bundleDir, fileName, output)
+		}
+	}
+
+	hash, err := i.getElasticAgentHash(containerName)
+	if err != nil {
+		return err
+	}
+
+	logsDir := i.logsDir
+	if strings.Contains(logsDir, "%s") {
+		logsDir = fmt.Sprintf(logsDir, hash)
+	}
+
+	logs, err := i.host.deployer.output(containerName, i.host.deployer.readFileCmd(logsDir+i.logFile, 0))
+	if err != nil {
+		return err
+	}
+
+	err = e2e.WriteArtifact(bundleDir, "elastic-agent.log", logs)
+	if err != nil {
+		return err
+	}
+
+	// the applications log to the logs/default dir of the data dir of the agent
+	files, err := i.host.deployer.output(containerName, i.host.deployer.listFilesCmd(logsDir))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range strings.Split(files, "\n") {
+		file = strings.TrimSpace(file)
+
+		// the paths of the Windows boxes use backslashes
+		slashedFile := strings.ReplaceAll(file, `\`, "/")
+		if !strings.HasPrefix(file, logsDir) || !strings.Contains(slashedFile, "/logs/default/") {
+			continue
+		}
+
+		logs, err := i.host.deployer.output(containerName, i.host.deployer.readFileCmd(file, 1000))
+		if err != nil {
+			continue
+		}
+
+		_ = e2e.WriteArtifact(bundleDir, filepath.Join("elastic-agent-applications", path.Base(slashedFile)), logs)
+	}
+
+	return nil
+}
+
 // getElasticAgentLogs uses elastic-agent log dir to read the entire log file
 func (i *ElasticAgentInstaller) getElasticAgentLogs(hostname string) error {
 	containerName := hostname // name of the container, which matches the hostname
@@ -116,11 +348,9 @@ func (i *ElasticAgentInstaller) getElasticAgentLogs(hostname string) error {
 	if strings.Contains(logFile, "%s") {
 		logFile = fmt.Sprintf(logFile, hash)
 	}
-	cmd := []string{
-		"cat", logFile,
-	}
+	cmd := i.host.deployer.readFileCmd(logFile, 0)
 
-	err = execCommandInService(i.profile, i.image, i.service, cmd, false)
+	err = i.host.exec(cmd, false)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"containerName": containerName,
@@ -136,19 +366,20 @@ func (i *ElasticAgentInstaller) getElasticAgentLogs(hostname string) error {
 }
 
 // runElasticAgentCommand runs a command for the elastic-agent
-func runElasticAgentCommand(profile string, image string, service string, process string, command string, arguments []string) error {
+func runElasticAgentCommand(host *agentHost, process string, command string, arguments []string) error {
 	cmds := []string{
 		process, command,
 	}
 	cmds = append(cmds, arguments...)
 
-	err := execCommandInService(profile, image, service, cmds, false)
+	err := host.exec(cmds, false)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"command": cmds,
-			"profile": profile,
-			"service": service,
-			"error":   err,
+			"command":   cmds,
+			"container": host.container,
+			"profile":   host.profile,
+			"service":   host.service,
+			"error":     err,
 		}).Error("Could not run agent command in the box")
 
 		return err
@@ -158,35 +389,43 @@ func runElasticAgentCommand(profile string, image string, service string, proces
 }
 
 // downloadAgentBinary it downloads the binary and stores the location of the downloaded file
-// into the installer struct, to be used else where
+// into the installer struct, to be used else where. The binary is verified against its checksum,
+// and cached across test runs by the artifacts client
 // If the environment variable ELASTIC_AGENT_DOWNLOAD_URL exists, then the artifact to be downloaded will
 // be defined by that value
 // Else, if the environment variable ELASTIC_AGENT_USE_CI_SNAPSHOTS is set, then the artifact
 // to be downloaded will be defined by the latest snapshot produced by the Beats CI.
+// Else, it's resolved in the source of the artifacts selected for the run.
 func downloadAgentBinary(artifact string, version string, OS string, arch string, extension string) (string, string, error) {
-	fileName := fmt.Sprintf("%s-%s-%s.%s", artifact, version, arch, extension)
-
-	handleDownload := func(URL string, fileName string) (string, string, error) {
-		if val, ok := binariesCache[URL]; ok {
-			log.WithFields(log.Fields{
-				"URL":  URL,
-				"path": val,
-			}).Debug("Retrieving binary from local cache")
-			return fileName, val, nil
-		}
+	fileName := agentFileName(artifact, version, OS, arch, extension)
 
-		filePath, err := e2e.DownloadFile(URL)
+	handleDownload := func(URL string, checksumURL string, fileName string) (string, string, error) {
+		filePath, err := e2e.GetArtifactsClient().Download(URL, checksumURL)
 		if err != nil {
 			return fileName, filePath, err
 		}
 
-		binariesCache[URL] = filePath
-
 		return fileName, filePath, nil
 	}
 
 	if downloadURL, exists := os.LookupEnv("ELASTIC_AGENT_DOWNLOAD_URL"); exists {
-		return handleDownload(downloadURL, fileName)
+		return handleDownload(downloadURL, "", fileName)
+	}
+
+	pkg := e2e.Package{
+		Arch:      arch,
+		Extension: extension,
+		Name:      artifact,
+		OS:        OS,
+		Version:   checkElasticAgentVersion(version),
+	}
+
+	// i.e. the packages built in a local clone of the Beats repository
+	if localPath, exists := e2e.FindLocalArtifact(pkg.FileName()); exists {
+		log.WithFields(log.Fields{
+			"path": localPath,
+		}).Info("Using the local package of the agent")
+		return fileName, localPath, nil
 	}
 
 	var downloadURL string
@@ -205,10 +444,7 @@ func downloadAgentBinary(artifact string, version string, OS string, arch string
 		// i.e. /pull-requests/pr-21100/elastic-agent/elastic-agent-8.0.0-SNAPSHOT-amd64.deb
 		// i.e. /pull-requests/pr-21100/elastic-agent/elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz
 		if strings.HasPrefix(strings.ToLower(version), "pr-") {
-			fileName = fmt.Sprintf("%s-%s-%s.%s", artifact, agentVersionBase, arch, extension)
-			if extension == "tar.gz" {
-				fileName = fmt.Sprintf("%s-%s-%s-%s.%s", artifact, agentVersionBase, OS, arch, extension)
-			}
+			fileName = agentFileName(artifact, agentVersionBase, OS, arch, extension)
 			log.WithFields(log.Fields{
 				"agentVersion": agentVersionBase,
 				"PR":           version,
@@ -223,34 +459,67 @@ func downloadAgentBinary(artifact string, version string, OS string, arch string
 			return "", "", err
 		}
 
-		return handleDownload(downloadURL, fileName)
+		checksumURL, err := e2e.GetObjectURLFromBucket(bucket, object+".sha512", maxTimeout)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"bucket": bucket,
+				"error":  err,
+				"object": object,
+			}).Warn("The checksum of the object was not found, it won't be verified")
+			checksumURL = ""
+		}
+
+		return handleDownload(downloadURL, checksumURL, fileName)
 	}
 
-	downloadURL, err = e2e.GetElasticArtifactURL(artifact, checkElasticAgentVersion(version), OS, arch, extension)
+	// i.e. the artifacts API, or the snapshots or the staging candidate of a build
+	downloadURL, checksumURL, err := e2e.GetArtifactsClient().ResolvePackage(pkg)
 	if err != nil {
 		return "", "", err
 	}
 
-	return handleDownload(downloadURL, fileName)
+	return handleDownload(downloadURL, checksumURL, fileName)
+}
+
+// agentFileName returns the name of the artifact of the agent, which includes the OS except for the
+// Linux packages, i.e. elastic-agent-8.0.0-SNAPSHOT-x86_64.rpm or elastic-agent-8.0.0-SNAPSHOT-windows-x86_64.zip
+func agentFileName(artifact string, version string, OS string, arch string, extension string) string {
+	if extension == "deb" || extension == "rpm" {
+		return fmt.Sprintf("%s-%s-%s.%s", artifact, version, arch, extension)
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s.%s", artifact, version, OS, arch, extension)
 }
 
-// GetElasticAgentInstaller returns an installer from a docker image
-func GetElasticAgentInstaller(image string, installerType string) ElasticAgentInstaller {
+// GetElasticAgentInstaller returns an installer of a version of the agent from a docker image, deploying
+// its box with a deployer
+func GetElasticAgentInstaller(d *agentDeployer, image string, installerType string, version string) ElasticAgentInstaller {
 	log.WithFields(log.Fields{
 		"image":     image,
 		"installer": installerType,
+		"version":   version,
 	}).Debug("Configuring installer for the agent")
 
 	var installer ElasticAgentInstaller
 	var err error
-	if "centos" == image && "tar" == installerType {
-		installer, err = newTarInstaller("centos", "latest")
+	if "amazonlinux" == image && "tar" == installerType {
+		installer, err = newTarInstaller(d, "amazonlinux", "2", version)
+	} else if "amazonlinux" == image && "systemd" == installerType {
+		installer, err = newCentosInstaller(d, "amazonlinux", "2", version)
+	} else if "centos" == image && "tar" == installerType {
+		installer, err = newTarInstaller(d, "centos", "latest", version)
 	} else if "centos" == image && "systemd" == installerType {
-		installer, err = newCentosInstaller("centos", "latest")
+		installer, err = newCentosInstaller(d, "centos", "latest", version)
 	} else if "debian" == image && "tar" == installerType {
-		installer, err = newTarInstaller("debian", "stretch")
+		installer, err = newTarInstaller(d, "debian", "stretch", version)
 	} else if "debian" == image && "systemd" == installerType {
-		installer, err = newDebianInstaller("debian", "stretch")
+		installer, err = newDebianInstaller(d, "debian", "stretch", version)
+	} else if "ubuntu" == image && "tar" == installerType {
+		installer, err = newTarInstaller(d, "ubuntu", "20.04", version)
+	} else if "ubuntu" == image && "systemd" == installerType {
+		installer, err = newDebianInstaller(d, "ubuntu", "20.04", version)
+	} else if "windows" == image && ("zip" == installerType || "msi" == installerType) {
+		installer, err = newWindowsInstaller(d, installerType, version)
 	} else {
 		log.WithFields(log.Fields{
 			"image":     image,
@@ -269,22 +538,35 @@ func GetElasticAgentInstaller(image string, installerType string) ElasticAgentIn
 	return installer
 }
 
+// enrollsOnInstall returns if the installer enrolls the agent when installing it, as the install
+// subcommand of the agent does for the tar and zip installers
+func (i *ElasticAgentInstaller) enrollsOnInstall() bool {
+	return i.installerType == "tar" || i.installerType == "zip"
+}
+
 func isSystemdBased(image string) bool {
 	return strings.HasSuffix(image, "-systemd")
 }
 
-// newCentosInstaller returns an instance of the Centos installer
-func newCentosInstaller(image string, tag string) (ElasticAgentInstaller, error) {
+// isRPMBased returns if the packages of the box of an image are managed with yum, i.e. Centos and
+// Amazon Linux, or with apt otherwise
+func isRPMBased(image string) bool {
+	return strings.HasPrefix(image, "centos") || strings.HasPrefix(image, "amazonlinux")
+}
+
+// newCentosInstaller returns an instance of the installer of the RPM package, for the Centos and the
+// Amazon Linux boxes
+func newCentosInstaller(d *agentDeployer, image string, tag string, version string) (ElasticAgentInstaller, error) {
 	image = image + "-systemd" // we want to consume systemd boxes
 	service := image
 	profile := FleetProfileName
+	host := newAgentHost(d, profile, image, service)
 
-	// extract the agent in the box, as it's mounted as a volume
+	// extract the agent in the box, as it's copied to its root dir
 	artifact := "elastic-agent"
-	version := agentVersion
 	os := "linux"
-	arch := "x86_64"
 	extension := "rpm"
+	arch := config.GetArtifactArch(extension)
 
 	binaryName, binaryPath, err := downloadAgentBinary(artifact, version, os, arch, extension)
 	if err != nil {
@@ -300,40 +582,39 @@ func newCentosInstaller(image string, tag string) (ElasticAgentInstaller, error)
 	}
 
 	preInstallFn := func() error {
-		log.Trace("No preinstall commands for Centos + systemd")
-		return nil
+		return host.trustCA()
 	}
-	installFn := func(containerName string, token string) error {
+	installFn := func(containerName string, fleetServerURL string, token string, tags []string) error {
 		cmds := []string{"yum", "localinstall", "/" + binaryName, "-y"}
-		return extractPackage(profile, image, service, cmds)
+		return extractPackage(host, cmds)
 	}
-	enrollFn := func(token string) error {
-		args := []string{"http://kibana:5601", token, "-f", "--insecure"}
+	enrollFn := func(fleetServerURL string, token string, tags []string) error {
+		args := getAgentEnrollArgs(fleetServerURL, token, tags)
 
-		return runElasticAgentCommand(profile, image, service, ElasticAgentProcessName, "enroll", args)
+		return runElasticAgentCommand(host, ElasticAgentProcessName, "enroll", args)
 	}
 	postInstallFn := func() error {
-		err = systemctlRun(profile, image, service, "enable")
+		err = systemctlRun(host, "enable")
 		if err != nil {
 			return err
 		}
-		return systemctlRun(profile, image, service, "start")
+		return systemctlRun(host, "start")
 	}
 	unInstallFn := func() error {
 		log.Trace("No uninstall commands for Centos + systemd")
 		return nil
 	}
 	installCertsFn := func() error {
-		if err := execCommandInService(profile, image, service, []string{"yum", "check-update"}, false); err != nil {
+		if err := host.exec([]string{"yum", "check-update"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"yum", "install", "ca-certificates", "-y"}, false); err != nil {
+		if err := host.exec([]string{"yum", "install", "ca-certificates", "-y"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"update-ca-trust", "force-enable"}, false); err != nil {
+		if err := host.exec([]string{"update-ca-trust", "force-enable"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"update-ca-trust", "extract"}, false); err != nil {
+		if err := host.exec([]string{"update-ca-trust", "extract"}, false); err != nil {
 			return err
 		}
 
@@ -349,8 +630,10 @@ func newCentosInstaller(image string, tag string) (ElasticAgentInstaller, error)
 		artifactOS:        os,
 		artifactVersion:   version,
 		binDir:            binDir,
+		binaryPath:        ElasticAgentProcessName,
 		commitFile:        ".elastic-agent.active.commit",
 		EnrollFn:          enrollFn,
+		host:              host,
 		homeDir:           "/etc/elastic-agent/",
 		image:             image,
 		InstallFn:         installFn,
@@ -371,18 +654,19 @@ func newCentosInstaller(image string, tag string) (ElasticAgentInstaller, error)
 	}, nil
 }
 
-// newDebianInstaller returns an instance of the Debian installer
-func newDebianInstaller(image string, tag string) (ElasticAgentInstaller, error) {
+// newDebianInstaller returns an instance of the installer of the DEB package, for the Debian and the
+// Ubuntu boxes
+func newDebianInstaller(d *agentDeployer, image string, tag string, version string) (ElasticAgentInstaller, error) {
 	image = image + "-systemd" // we want to consume systemd boxes
 	service := image
 	profile := FleetProfileName
+	host := newAgentHost(d, profile, image, service)
 
-	// extract the agent in the box, as it's mounted as a volume
+	// extract the agent in the box, as it's copied to its root dir
 	artifact := "elastic-agent"
-	version := agentVersion
 	os := "linux"
-	arch := "amd64"
 	extension := "deb"
+	arch := config.GetArtifactArch(extension)
 
 	binaryName, binaryPath, err := downloadAgentBinary(artifact, version, os, arch, extension)
 	if err != nil {
@@ -398,37 +682,36 @@ func newDebianInstaller(image string, tag string) (ElasticAgentInstaller, error)
 	}
 
 	preInstallFn := func() error {
-		log.Trace("No preinstall commands for Debian + systemd")
-		return nil
+		return host.trustCA()
 	}
-	installFn := func(containerName string, token string) error {
+	installFn := func(containerName string, fleetServerURL string, token string, tags []string) error {
 		cmds := []string{"apt", "install", "/" + binaryName, "-y"}
-		return extractPackage(profile, image, service, cmds)
+		return extractPackage(host, cmds)
 	}
-	enrollFn := func(token string) error {
-		args := []string{"http://kibana:5601", token, "-f", "--insecure"}
+	enrollFn := func(fleetServerURL string, token string, tags []string) error {
+		args := getAgentEnrollArgs(fleetServerURL, token, tags)
 
-		return runElasticAgentCommand(profile, image, service, ElasticAgentProcessName, "enroll", args)
+		return runElasticAgentCommand(host, ElasticAgentProcessName, "enroll", args)
 	}
 	postInstallFn := func() error {
-		err = systemctlRun(profile, image, service, "enable")
+		err = systemctlRun(host, "enable")
 		if err != nil {
 			return err
 		}
-		return systemctlRun(profile, image, service, "start")
+		return systemctlRun(host, "start")
 	}
 	unInstallFn := func() error {
 		log.Trace("No uninstall commands for Debian + systemd")
 		return nil
 	}
 	installCertsFn := func() error {
-		if err := execCommandInService(profile, image, service, []string{"apt-get", "update"}, false); err != nil {
+		if err := host.exec([]string{"apt-get", "update"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"apt", "install", "ca-certificates", "-y"}, false); err != nil {
+		if err := host.exec([]string{"apt", "install", "ca-certificates", "-y"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"update-ca-certificates"}, false); err != nil {
+		if err := host.exec([]string{"update-ca-certificates"}, false); err != nil {
 			return err
 		}
 		return nil
@@ -443,8 +726,10 @@ func newDebianInstaller(image string, tag string) (ElasticAgentInstaller, error)
 		artifactOS:        os,
 		artifactVersion:   version,
 		binDir:            binDir,
+		binaryPath:        ElasticAgentProcessName,
 		commitFile:        ".elastic-agent.active.commit",
 		EnrollFn:          enrollFn,
+		host:              host,
 		homeDir:           "/etc/elastic-agent/",
 		image:             image,
 		InstallFn:         installFn,
@@ -466,17 +751,17 @@ func newDebianInstaller(image string, tag string) (ElasticAgentInstaller, error)
 }
 
 // newTarInstaller returns an instance of the Debian installer
-func newTarInstaller(image string, tag string) (ElasticAgentInstaller, error) {
+func newTarInstaller(d *agentDeployer, image string, tag string, version string) (ElasticAgentInstaller, error) {
 	image = image + "-systemd" // we want to consume systemd boxes
 	service := image
 	profile := FleetProfileName
+	host := newAgentHost(d, profile, image, service)
 
-	// extract the agent in the box, as it's mounted as a volume
+	// extract the agent in the box, as it's copied to its root dir
 	artifact := "elastic-agent"
-	version := agentVersion
 	os := "linux"
-	arch := "x86_64"
 	extension := "tar.gz"
+	arch := config.GetArtifactArch(extension)
 
 	tarFile, binaryPath, err := downloadAgentBinary(artifact, version, os, arch, extension)
 	if err != nil {
@@ -496,24 +781,29 @@ func newTarInstaller(image string, tag string) (ElasticAgentInstaller, error) {
 	binDir := "/usr/bin/"
 
 	preInstallFn := func() error {
+		err := host.trustCA()
+		if err != nil {
+			return err
+		}
+
 		commitFile := homeDir + commitFile
-		return installFromTar(profile, image, service, tarFile, commitFile, artifact, checkElasticAgentVersion(version), os, arch)
+		return installFromTar(host, tarFile, commitFile, artifact, checkElasticAgentVersion(version), os, arch)
 	}
-	installFn := func(containerName string, token string) error {
+	installFn := func(containerName string, fleetServerURL string, token string, tags []string) error {
 		// install the elastic-agent to /usr/bin/elastic-agent using command
 		binary := fmt.Sprintf("/elastic-agent/%s", artifact)
-		args := []string{"--force", "--insecure", "--enrollment-token", token, "--kibana-url", "http://kibana:5601"}
+		args := getAgentInstallArgs(fleetServerURL, token, tags)
 
-		err = runElasticAgentCommand(profile, image, service, binary, "install", args)
+		err = runElasticAgentCommand(host, binary, "install", args)
 		if err != nil {
-			return fmt.Errorf("Failed to install the agent with subcommand: %v", err)
+			return fmt.Errorf("%w with the install subcommand: %v", e2eerrors.ErrAgentInstallFailed, err)
 		}
 		return nil
 	}
-	enrollFn := func(token string) error {
-		args := []string{"http://kibana:5601", token, "-f", "--insecure"}
+	enrollFn := func(fleetServerURL string, token string, tags []string) error {
+		args := getAgentEnrollArgs(fleetServerURL, token, tags)
 
-		return runElasticAgentCommand(profile, image, service, ElasticAgentProcessName, "enroll", args)
+		return runElasticAgentCommand(host, ElasticAgentProcessName, "enroll", args)
 	}
 	postInstallFn := func() error {
 		log.Trace("No postinstall commands for TAR installer")
@@ -522,16 +812,16 @@ func newTarInstaller(image string, tag string) (ElasticAgentInstaller, error) {
 	unInstallFn := func() error {
 		args := []string{"-f"}
 
-		return runElasticAgentCommand(profile, image, service, ElasticAgentProcessName, "uninstall", args)
+		return runElasticAgentCommand(host, ElasticAgentProcessName, "uninstall", args)
 	}
 	installCertsFn := func() error {
-		if err := execCommandInService(profile, image, service, []string{"apt-get", "update"}, false); err != nil {
+		if err := host.exec([]string{"apt-get", "update"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"apt", "install", "ca-certificates", "-y"}, false); err != nil {
+		if err := host.exec([]string{"apt", "install", "ca-certificates", "-y"}, false); err != nil {
 			return err
 		}
-		if err := execCommandInService(profile, image, service, []string{"update-ca-certificates"}, false); err != nil {
+		if err := host.exec([]string{"update-ca-certificates"}, false); err != nil {
 			return err
 		}
 		return nil
@@ -544,8 +834,10 @@ func newTarInstaller(image string, tag string) (ElasticAgentInstaller, error) {
 		artifactOS:        os,
 		artifactVersion:   version,
 		binDir:            binDir,
+		binaryPath:        ElasticAgentProcessName,
 		commitFile:        commitFile,
 		EnrollFn:          enrollFn,
+		host:              host,
 		homeDir:           homeDir,
 		image:             image,
 		InstallFn:         installFn,
@@ -566,14 +858,131 @@ func newTarInstaller(image string, tag string) (ElasticAgentInstaller, error) {
 	}, nil
 }
 
-func extractPackage(profile string, image string, service string, cmds []string) error {
-	err := execCommandInService(profile, image, service, cmds, false)
+// newWindowsInstaller returns an instance of the Windows installer, from the zip or the MSI package,
+// which is deployed to a remote Windows host
+func newWindowsInstaller(d *agentDeployer, installerType string, version string) (ElasticAgentInstaller, error) {
+	if d.boxOS() != windowsOS {
+		return ElasticAgentInstaller{}, fmt.Errorf("The Windows agents are deployed to remote Windows hosts only: set the ELASTIC_AGENT_SSH_HOST and ELASTIC_AGENT_SSH_OS=windows env vars")
+	}
+
+	image := "windows"
+	service := image
+	profile := FleetProfileName
+	host := newAgentHost(d, profile, image, service)
+	host.os = windowsOS
+
+	artifact := "elastic-agent"
+	os := windowsOS
+	extension := installerType
+	arch := "x86_64" // the Windows hosts run on x86_64
+
+	binaryName, binaryPath, err := downloadAgentBinary(artifact, version, os, arch, extension)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"command": cmds,
-			"error":   err,
-			"image":   image,
-			"service": service,
+			"artifact":  artifact,
+			"version":   version,
+			"os":        os,
+			"arch":      arch,
+			"extension": extension,
+			"error":     err,
+		}).Error("Could not download the binary for the agent")
+		return ElasticAgentInstaller{}, err
+	}
+
+	homeDir := `C:\Program Files\Elastic\Agent\`
+	agentBinary := homeDir + ElasticAgentProcessName + ".exe"
+
+	preInstallFn := func() error {
+		return host.trustCA()
+	}
+	installFn := func(containerName string, fleetServerURL string, token string, tags []string) error {
+		if installerType == "msi" {
+			return extractPackage(host, msiexecScript("/i", windowsRootDir+binaryName))
+		}
+
+		// extract the agent to C:\elastic-agent, and install it with the enrollment
+		extractedDir := fmt.Sprintf("%s%s-%s-%s-%s", windowsRootDir, artifact, checkElasticAgentVersion(version), os, arch)
+		script := fmt.Sprintf(
+			"Expand-Archive -Force -Path %s -DestinationPath %s; Move-Item -Force -Path %s -Destination %s",
+			deploy.PowershellQuote(windowsRootDir+binaryName), deploy.PowershellQuote(windowsRootDir), deploy.PowershellQuote(extractedDir), deploy.PowershellQuote(windowsRootDir+artifact))
+		err := extractPackage(host, powershellScript(script))
+		if err != nil {
+			return err
+		}
+
+		binary := windowsRootDir + artifact + `\` + ElasticAgentProcessName + ".exe"
+		args := getAgentInstallArgs(fleetServerURL, token, tags)
+
+		err = runElasticAgentCommand(host, binary, "install", args)
+		if err != nil {
+			return fmt.Errorf("%w with the install subcommand: %v", e2eerrors.ErrAgentInstallFailed, err)
+		}
+		return nil
+	}
+	enrollFn := func(fleetServerURL string, token string, tags []string) error {
+		args := getAgentEnrollArgs(fleetServerURL, token, tags)
+
+		return runElasticAgentCommand(host, agentBinary, "enroll", args)
+	}
+	postInstallFn := func() error {
+		if installerType == "msi" {
+			return serviceRun(host, "start")
+		}
+
+		log.Trace("No postinstall commands for the zip installer")
+		return nil
+	}
+	unInstallFn := func() error {
+		if installerType == "msi" {
+			return extractPackage(host, msiexecScript("/x", windowsRootDir+binaryName))
+		}
+
+		return runElasticAgentCommand(host, agentBinary, "uninstall", []string{"-f"})
+	}
+	installCertsFn := func() error {
+		return host.trustCA()
+	}
+
+	return ElasticAgentInstaller{
+		artifactArch:      arch,
+		artifactExtension: extension,
+		artifactName:      artifact,
+		artifactOS:        os,
+		artifactVersion:   version,
+		binDir:            homeDir,
+		binaryPath:        agentBinary,
+		commitFile:        ".elastic-agent.active.commit",
+		EnrollFn:          enrollFn,
+		host:              host,
+		homeDir:           homeDir,
+		image:             image,
+		InstallFn:         installFn,
+		InstallCertsFn:    installCertsFn,
+		installerType:     installerType,
+		logFile:           "elastic-agent-json.log",
+		logsDir:           homeDir + `data\elastic-agent-%s\logs\`,
+		name:              binaryName,
+		path:              binaryPath,
+		PostInstallFn:     postInstallFn,
+		PreInstallFn:      preInstallFn,
+		processName:       ElasticAgentProcessName,
+		profile:           profile,
+		service:           service,
+		tag:               version,
+		UninstallFn:       unInstallFn,
+		workingDir:        homeDir,
+	}, nil
+}
+
+func extractPackage(host *agentHost, cmds []string) error {
+	err := host.exec(cmds, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command":   cmds,
+			"container": host.container,
+			"error":     err,
+			"image":     host.image,
+			"service":   host.service,
 		}).Error("Could not extract agent package in the box")
 
 		return err
@@ -582,21 +991,22 @@ func extractPackage(profile string, image string, service string, cmds []string)
 	return nil
 }
 
-func installFromTar(profile string, image string, service string, tarFile string, commitFile string, artifact string, version string, OS string, arch string) error {
-	err := extractPackage(profile, image, service, []string{"tar", "-xvf", "/" + tarFile})
+func installFromTar(host *agentHost, tarFile string, commitFile string, artifact string, version string, OS string, arch string) error {
+	err := extractPackage(host, []string{"tar", "-xvf", "/" + tarFile})
 	if err != nil {
 		return err
 	}
 
 	// simplify layout
 	cmds := []string{"mv", fmt.Sprintf("/%s-%s-%s-%s", artifact, version, OS, arch), "/elastic-agent"}
-	err = execCommandInService(profile, image, service, cmds, false)
+	err = host.exec(cmds, false)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"command": cmds,
-			"error":   err,
-			"image":   image,
-			"service": service,
+			"command":   cmds,
+			"container": host.container,
+			"error":     err,
+			"image":     host.image,
+			"service":   host.service,
 		}).Error("Could not extract agent package in the box")
 
 		return err
@@ -605,14 +1015,34 @@ func installFromTar(profile string, image string, service string, tarFile string
 	return nil
 }
 
-func systemctlRun(profile string, image string, service string, command string) error {
-	cmd := []string{"systemctl", command, ElasticAgentProcessName}
-	err := execCommandInService(profile, image, service, cmd, false)
+// windowsServiceName the name of the service of the agent in Windows
+const windowsServiceName = "Elastic Agent"
+
+// serviceRun runs a command of the service manager of a box over the service of the agent: enable,
+// start, stop or restart. The Linux boxes use systemctl, and the Windows ones the cmdlets of PowerShell
+func serviceRun(host *agentHost, command string) error {
+	if host.os != windowsOS {
+		return systemctlRun(host, command)
+	}
+
+	cmdlets := map[string][]string{
+		"enable":  {"Set-Service", "-StartupType", "Automatic", "-Name", windowsServiceName},
+		"restart": {"Restart-Service", "-Name", windowsServiceName},
+		"start":   {"Start-Service", "-Name", windowsServiceName},
+		"stop":    {"Stop-Service", "-Name", windowsServiceName},
+	}
+
+	cmd, exists := cmdlets[command]
+	if !exists {
+		return fmt.Errorf("The %s command of the service is not supported in Windows", command)
+	}
+
+	err := host.exec(cmd, false)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"command": cmd,
 			"error":   err,
-			"service": service,
+			"os":      host.os,
 		}).Errorf("Could not %s the service", command)
 
 		return err
@@ -620,7 +1050,29 @@ func systemctlRun(profile string, image string, service string, command string)
 
 	log.WithFields(log.Fields{
 		"command": cmd,
-		"service": service,
+		"os":      host.os,
+	}).Trace("Service command executed")
+	return nil
+}
+
+func systemctlRun(host *agentHost, command string) error {
+	cmd := []string{"systemctl", command, ElasticAgentProcessName}
+	err := host.exec(cmd, false)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command":   cmd,
+			"container": host.container,
+			"error":     err,
+			"service":   host.service,
+		}).Errorf("Could not %s the service", command)
+
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"command":   cmd,
+		"container": host.container,
+		"service":   host.service,
 	}).Trace("Systemctl executed")
 	return nil
 }
@@ -0,0 +1,213 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cucumber/godog"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// standAloneOutputSettings the settings of the output of the stand-alone agents which can be
+// customised by a scenario
+var standAloneOutputSettings = map[string]bool{
+	"hosts":                 true,
+	"password":              true,
+	"ssl.verification_mode": true,
+	"type":                  true,
+	"username":              true,
+}
+
+// standAloneConfig the customisations of the configuration file of the stand-alone agent of a
+// scenario, which are rendered on top of the configuration file of the Docker image
+type standAloneConfig struct {
+	Inputs []interface{}          // the inputs added to the ones of the configuration file
+	Output map[string]interface{} // the settings of the default output, by their path
+}
+
+// isEmpty returns if there are no customisations, keeping the configuration file as it's downloaded
+func (c standAloneConfig) isEmpty() bool {
+	return len(c.Inputs) == 0 && len(c.Output) == 0
+}
+
+// render writes the customisations into a configuration file of the stand-alone agents, setting the
+// settings of its default output and appending the inputs to its inputs
+func (c standAloneConfig) render(path string) error {
+	if c.isEmpty() {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	agentConfig := map[string]interface{}{}
+	err = yaml.Unmarshal(content, &agentConfig)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  path,
+		}).Error("Could not parse the configuration file of the stand-alone agent")
+		return err
+	}
+
+	if len(c.Output) > 0 {
+		outputs, _ := agentConfig["outputs"].(map[interface{}]interface{})
+		if outputs == nil {
+			outputs = map[interface{}]interface{}{}
+		}
+
+		output, _ := outputs["default"].(map[interface{}]interface{})
+		if output == nil {
+			output = map[interface{}]interface{}{"type": "elasticsearch"}
+		}
+
+		// the settings of the output do not apply to the outputs of other types, i.e. logstash
+		if outputType, exists := c.Output["type"]; exists && output["type"] != outputType {
+			output = map[interface{}]interface{}{}
+		}
+
+		for setting, value := range c.Output {
+			setConfigValue(output, strings.Split(setting, "."), value)
+		}
+
+		outputs["default"] = output
+		agentConfig["outputs"] = outputs
+	}
+
+	if len(c.Inputs) > 0 {
+		inputs, _ := agentConfig["inputs"].([]interface{})
+		agentConfig["inputs"] = append(inputs, c.Inputs...)
+	}
+
+	rendered, err := yaml.Marshal(agentConfig)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(path, rendered, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  path,
+		}).Error("Could not write the configuration file of the stand-alone agent")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"inputs": len(c.Inputs),
+		"output": c.Output,
+		"path":   path,
+	}).Debug("Configuration file of the stand-alone agent customised")
+
+	return nil
+}
+
+// theStandaloneAgentIsConfiguredWithTheInput adds an input, or a list of them, in YAML to the
+// configuration of the stand-alone agent deployed later in the scenario
+func (sats *StandAloneTestSuite) theStandaloneAgentIsConfiguredWithTheInput(input *godog.DocString) error {
+	var parsed interface{}
+	err := yaml.Unmarshal([]byte(input.Content), &parsed)
+	if err != nil {
+		return fmt.Errorf("the input of the stand-alone agent is not valid YAML: %w", err)
+	}
+
+	switch value := parsed.(type) {
+	case []interface{}:
+		sats.Config.Inputs = append(sats.Config.Inputs, value...)
+	case map[interface{}]interface{}:
+		sats.Config.Inputs = append(sats.Config.Inputs, value)
+	default:
+		return fmt.Errorf("the input of the stand-alone agent must be a YAML object or a list of them")
+	}
+
+	return nil
+}
+
+// theStandaloneAgentIsConfiguredWithTheOutput sets the settings of the output of the stand-alone
+// agent deployed later in the scenario, from a table with a setting and its value in each row
+func (sats *StandAloneTestSuite) theStandaloneAgentIsConfiguredWithTheOutput(table *godog.Table) error {
+	settings, err := newStandAloneOutputSettings(table)
+	if err != nil {
+		return err
+	}
+
+	if sats.Config.Output == nil {
+		sats.Config.Output = map[string]interface{}{}
+	}
+
+	for setting, value := range settings {
+		sats.Config.Output[setting] = value
+	}
+
+	return nil
+}
+
+// newStandAloneOutputSettings returns the settings of the output of the stand-alone agents of a
+// table with a setting and its value in each row, skipping the optional "setting | value" header.
+// The hosts are a JSON list or a comma-separated list of URLs
+func newStandAloneOutputSettings(table *godog.Table) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+
+	for i, row := range table.Rows {
+		if len(row.Cells) != 2 {
+			return nil, fmt.Errorf("the row %d of the output must have a setting and a value", i+1)
+		}
+
+		setting := strings.TrimSpace(row.Cells[0].Value)
+		value := strings.TrimSpace(row.Cells[1].Value)
+
+		if i == 0 && setting == "setting" && value == "value" {
+			continue
+		}
+
+		if !standAloneOutputSettings[setting] {
+			return nil, fmt.Errorf("the %s setting of the output of the stand-alone agents is not supported", setting)
+		}
+
+		if setting != "hosts" {
+			settings[setting] = value
+			continue
+		}
+
+		hosts := []string{}
+		if err := json.Unmarshal([]byte(value), &hosts); err != nil {
+			hosts = []string{}
+			for _, host := range strings.Split(value, ",") {
+				hosts = append(hosts, strings.TrimSpace(host))
+			}
+		}
+		settings[setting] = hosts
+	}
+
+	if len(settings) == 0 {
+		return nil, fmt.Errorf("there are no settings of the output in the table")
+	}
+
+	return settings, nil
+}
+
+// setConfigValue sets a value in a path of a YAML object, creating the objects of the path which
+// do not exist
+func setConfigValue(object map[interface{}]interface{}, path []string, value interface{}) {
+	if len(path) == 1 {
+		object[path[0]] = value
+		return
+	}
+
+	child, _ := object[path[0]].(map[interface{}]interface{})
+	if child == nil {
+		child = map[interface{}]interface{}{}
+		object[path[0]] = child
+	}
+
+	setConfigValue(child, path[1:], value)
+}
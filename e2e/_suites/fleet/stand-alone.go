@@ -5,16 +5,19 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"regexp"
 	"time"
 
 	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
 	"github.com/elastic/e2e-testing/cli/docker"
 	"github.com/elastic/e2e-testing/cli/services"
 	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/datastreams"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -22,11 +25,17 @@ import (
 type StandAloneTestSuite struct {
 	AgentConfigFilePath string
 	Cleanup             bool
+	Config              standAloneConfig // the customisations of the configuration file of the scenario
+	DaemonSet           bool             // the agent is deployed as a DaemonSet into Kubernetes
 	Hostname            string
 	Image               string
+	InstallerType       string                           // deb, rpm or tar, empty for the Docker image
+	Installers          map[string]ElasticAgentInstaller // the installers of the boxes, by image and type
+	Logstash            bool                             // the agent sends its data to Logstash, removed in the teardown
 	// date controls for queries
-	AgentStoppedDate             time.Time
 	RuntimeDependenciesStartDate time.Time
+	// the context of the suite, with its clients and the environment of its profile
+	suite *SuiteContext
 }
 
 // afterScenario destroys the state created by a scenario
@@ -35,13 +44,28 @@ func (sats *StandAloneTestSuite) afterScenario() {
 	serviceName := ElasticAgentServiceName
 
 	if log.IsLevelEnabled(log.DebugLevel) {
-		_ = sats.getContainerLogs()
+		if sats.InstallerType != "" {
+			installer := sats.getInstaller()
+			_ = installer.getElasticAgentLogs(sats.Hostname)
+		} else if sats.DaemonSet {
+			_ = sats.getDaemonSetLogs()
+		} else {
+			_ = sats.getContainerLogs()
+		}
 	}
 
-	if !developerMode {
-		_ = serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{serviceName}, profileEnv)
-	} else {
+	if developerMode {
 		log.WithField("service", serviceName).Info("Because we are running in development mode, the service won't be stopped")
+	} else if sats.InstallerType != "" {
+		_ = sats.suite.deployer.remove(sats.getInstaller())
+	} else if sats.DaemonSet {
+		_ = serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{ElasticAgentDaemonSetServiceName}, sats.suite.env.get())
+	} else {
+		_ = serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{serviceName}, sats.suite.env.get())
+	}
+
+	if sats.Logstash {
+		sats.suite.removeLogstash()
 	}
 
 	if _, err := os.Stat(sats.AgentConfigFilePath); err == nil {
@@ -50,13 +74,25 @@ func (sats *StandAloneTestSuite) afterScenario() {
 			"path": sats.AgentConfigFilePath,
 		}).Debug("Elastic Agent configuration file removed.")
 	}
+
+	sats.Config = standAloneConfig{}
+	sats.DaemonSet = false
+	sats.Hostname = ""
+	sats.InstallerType = ""
+	sats.Logstash = false
 }
 
-func (sats *StandAloneTestSuite) contributeSteps(s *godog.Suite) {
-	s.Step(`^a "([^"]*)" stand-alone agent is deployed$`, sats.aStandaloneAgentIsDeployed)
-	s.Step(`^there is new data in the index from agent$`, sats.thereIsNewDataInTheIndexFromAgent)
-	s.Step(`^the "([^"]*)" docker container is stopped$`, sats.theDockerContainerIsStopped)
-	s.Step(`^there is no new data in the index after agent shuts down$`, sats.thereIsNoNewDataInTheIndexAfterAgentShutsDown)
+func (sats *StandAloneTestSuite) contributeSteps(s *godog.ScenarioContext) {
+	e2e.Step(s, `^a "([^"]*)" stand-alone agent is deployed$`, sats.aStandaloneAgentIsDeployed)
+	e2e.Step(s, `^a "([^"]*)" stand-alone agent is deployed with "([^"]*)" installer$`, sats.aStandaloneAgentIsDeployedWithInstaller)
+	e2e.Step(s, `^a "([^"]*)" stand-alone agent is deployed as a DaemonSet in Kubernetes$`, sats.aStandaloneAgentIsDeployedAsADaemonSet)
+	e2e.Step(s, `^the stand-alone agent is configured with the input:$`, sats.theStandaloneAgentIsConfiguredWithTheInput)
+	e2e.Step(s, `^the stand-alone agent is configured with the output:$`, sats.theStandaloneAgentIsConfiguredWithTheOutput)
+	e2e.Step(s, `^the stand-alone agent sends its data to Logstash$`, sats.theStandaloneAgentSendsItsDataToLogstash)
+	e2e.Step(s, `^there is new data in the index from agent$`, sats.thereIsNewDataInTheIndexFromAgent)
+	e2e.Step(s, `^there is data from the stand-alone agent in the "([^"]*)" data stream through Logstash$`, sats.thereIsDataFromTheStandaloneAgentInTheDataStreamThroughLogstash)
+	e2e.Step(s, `^there is new data in the "([^"]*)" data stream from the DaemonSet$`, sats.thereIsNewDataInTheDataStreamFromTheDaemonSet)
+	e2e.Step(s, `^there is no new data in the index after agent shuts down$`, sats.thereIsNoNewDataInTheIndexAfterAgentShutsDown)
 }
 
 func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployed(image string) error {
@@ -64,14 +100,17 @@ func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployed(image string) error
 
 	serviceManager := services.NewServiceManager()
 
-	profileEnv["elasticAgentDockerImageSuffix"] = ""
+	sats.InstallerType = ""
+
+	imageSuffix := ""
 	if image != "default" {
-		profileEnv["elasticAgentDockerImageSuffix"] = "-" + image
+		imageSuffix = "-" + image
 	}
+	sats.suite.env.put(map[string]string{"elasticAgentDockerImageSuffix": imageSuffix})
 
-	containerName := fmt.Sprintf("%s_%s_%d", FleetProfileName, ElasticAgentServiceName, 1)
+	containerName := fmt.Sprintf("%s_%s_%d", config.GetComposeProjectName(FleetProfileName), ElasticAgentServiceName, 1)
 
-	configurationFileURL := "https://raw.githubusercontent.com/elastic/beats/master/x-pack/elastic-agent/elastic-agent.docker.yml"
+	configurationFileURL := e2e.GetBeatsFileURL(agentVersion, "x-pack/elastic-agent/elastic-agent.docker.yml")
 
 	configurationFilePath, err := e2e.DownloadFile(configurationFileURL)
 	if err != nil {
@@ -79,11 +118,18 @@ func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployed(image string) error
 	}
 	sats.AgentConfigFilePath = configurationFilePath
 
-	profileEnv["elasticAgentContainerName"] = containerName
-	profileEnv["elasticAgentConfigFile"] = sats.AgentConfigFilePath
-	profileEnv["elasticAgentTag"] = agentVersion
+	err = sats.Config.render(configurationFilePath)
+	if err != nil {
+		return err
+	}
 
-	err = serviceManager.AddServicesToCompose(FleetProfileName, []string{ElasticAgentServiceName}, profileEnv)
+	sats.suite.env.put(map[string]string{
+		"elasticAgentContainerName": containerName,
+		"elasticAgentConfigFile":    sats.AgentConfigFilePath,
+		"elasticAgentTag":           agentVersion,
+	})
+
+	err = serviceManager.AddServicesToCompose(FleetProfileName, []string{ElasticAgentServiceName}, sats.suite.env.get())
 	if err != nil {
 		log.Error("Could not deploy the elastic-agent")
 		return err
@@ -107,6 +153,121 @@ func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployed(image string) error
 	return nil
 }
 
+// aStandaloneAgentIsDeployedWithInstaller installs a stand-alone agent from a package (deb, rpm or
+// tar) in the box of an image, i.e. ubuntu or amazonlinux, instead of running its Docker image, so
+// that the install paths of the package managers are covered. The agent sends its data to the
+// Elasticsearch of the profile, with the configuration file of the Docker image
+func (sats *StandAloneTestSuite) aStandaloneAgentIsDeployedWithInstaller(image string, installerType string) error {
+	log.WithFields(log.Fields{
+		"image":     image,
+		"installer": installerType,
+	}).Trace("Deploying a stand-alone agent with an installer")
+
+	if sats.suite.deployer.boxOS() == windowsOS {
+		log.WithFields(log.Fields{
+			"image":     image,
+			"installer": installerType,
+		}).Warn("The Linux agents cannot be deployed to the remote Windows hosts. Skipping the scenario")
+		return godog.ErrPending
+	}
+
+	installer, err := sats.standAloneInstaller(image, installerType)
+	if err != nil {
+		return err
+	}
+
+	configurationFileURL := e2e.GetBeatsFileURL(agentVersion, "x-pack/elastic-agent/elastic-agent.docker.yml")
+
+	configurationFilePath, err := e2e.DownloadFile(configurationFileURL)
+	if err != nil {
+		return err
+	}
+	sats.AgentConfigFilePath = configurationFilePath
+
+	// the customisations can reference the env vars of the Docker image, i.e. ${ELASTICSEARCH_HOST}
+	err = sats.Config.render(configurationFilePath)
+	if err != nil {
+		return err
+	}
+
+	err = renderStandAloneConfigFile(configurationFilePath)
+	if err != nil {
+		return err
+	}
+
+	sats.Image = image
+	sats.InstallerType = installerType
+	sats.Cleanup = true
+
+	_, containerName := sats.box()
+
+	err = sats.suite.deployer.deploy(installer, containerName)
+	if err != nil {
+		return err
+	}
+
+	err = installer.PreInstallFn()
+	if err != nil {
+		return err
+	}
+
+	err = sats.suite.deployer.provider.AddFiles(e2e.ScenarioContext(), sats.suite.deployer.serviceRequest(installer.host), map[string]string{"elastic-agent.yml": configurationFilePath})
+	if err != nil {
+		return err
+	}
+
+	if installer.installerType == "tar" {
+		// the install subcommand installs the agent in stand-alone mode, with the configuration
+		// file of the extracted artifact, if there is no URL to enroll it into
+		err = installer.host.exec([]string{"cp", "/elastic-agent.yml", installer.homeDir + "elastic-agent.yml"}, false)
+		if err != nil {
+			return err
+		}
+
+		err = runElasticAgentCommand(installer.host, installer.homeDir+installer.artifactName, "install", []string{"--force"})
+		if err != nil {
+			return err
+		}
+	} else {
+		err = installer.InstallFn(containerName, "", "", nil)
+		if err != nil {
+			return err
+		}
+
+		err = installer.host.exec([]string{"cp", "/elastic-agent.yml", installer.homeDir + "elastic-agent.yml"}, false)
+		if err != nil {
+			return err
+		}
+
+		err = installer.PostInstallFn()
+		if err != nil {
+			return err
+		}
+	}
+
+	// get the hostname of the box once
+	hostname, err := sats.suite.deployer.getAgentHostname(containerName)
+	if err != nil {
+		return err
+	}
+	sats.Hostname = hostname
+
+	return nil
+}
+
+// box returns the deployer and the container of the box of the stand-alone agent: the box of its
+// installer, or the container of the elastic-agent service when it runs the Docker image, which
+// always runs in a container
+func (sats *StandAloneTestSuite) box() (*agentDeployer, string) {
+	project := config.GetComposeProjectName(FleetProfileName)
+
+	if sats.InstallerType == "" {
+		return newContainerDeployer(sats.suite.deployer), fmt.Sprintf("%s_%s_%d", project, ElasticAgentServiceName, 1)
+	}
+
+	return sats.suite.deployer, fmt.Sprintf("%s_%s_%s_%d", project, sats.Image+"-systemd", ElasticAgentServiceName, 1)
+}
+
 func (sats *StandAloneTestSuite) getContainerLogs() error {
 	serviceManager := services.NewServiceManager()
 
@@ -117,7 +278,7 @@ func (sats *StandAloneTestSuite) getContainerLogs() error {
 		profile,     // profile name
 		serviceName, // agent service
 	}
-	err := serviceManager.RunCommand(profile, composes, []string{"logs", serviceName}, profileEnv)
+	err := serviceManager.RunCommand(profile, composes, []string{"logs", serviceName}, sats.suite.env.get())
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":   err,
@@ -145,7 +306,7 @@ func (sats *StandAloneTestSuite) installTestTools(containerName string) error {
 		"containerName": containerName,
 	}).Trace("Installing test tools ")
 
-	_, err := docker.ExecCommandIntoContainer(context.Background(), containerName, "root", cmd)
+	_, err := docker.ExecCommandIntoContainer(e2e.ScenarioContext(), containerName, "root", cmd)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"command":       cmd,
@@ -163,134 +324,116 @@ func (sats *StandAloneTestSuite) installTestTools(containerName string) error {
 	return nil
 }
 
+// getInstaller returns the installer of the stand-alone agent, deployed with a package
+func (sats *StandAloneTestSuite) getInstaller() ElasticAgentInstaller {
+	installer, _ := sats.standAloneInstaller(sats.Image, sats.InstallerType)
+	return installer
+}
+
+// standAloneInstaller returns the installer of a type of package for the box of an image, failing
+// if the image does not support the package, i.e. the rpm packages in the ubuntu boxes
+func (sats *StandAloneTestSuite) standAloneInstaller(image string, installerType string) (ElasticAgentInstaller, error) {
+	key := image + "-" + installerType
+	if installerType == "deb" || installerType == "rpm" {
+		key = image + "-systemd"
+	}
+
+	installer, exists := sats.Installers[key]
+	if !exists || installer.installerType != installerType {
+		return ElasticAgentInstaller{}, fmt.Errorf("the %s installer is not supported by the %s image", installerType, image)
+	}
+
+	return installer, nil
+}
+
 func (sats *StandAloneTestSuite) thereIsNewDataInTheIndexFromAgent() error {
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute * 2
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute*2)
 	minimumHitsCount := 50
 
-	result, err := searchAgentData(sats.Hostname, sats.RuntimeDependenciesStartDate, minimumHitsCount, maxTimeout)
+	assertions, err := e2e.GetDataStreamAssertions()
 	if err != nil {
 		return err
 	}
 
-	log.Tracef("Search result: %v", result)
-
-	return e2e.AssertHitsArePresent(result)
-}
-
-func (sats *StandAloneTestSuite) theDockerContainerIsStopped(serviceName string) error {
-	serviceManager := services.NewServiceManager()
+	selector := datastreams.Selector{
+		DataStream: agentLogsDataStream,
+		Hostname:   sats.Hostname,
+		Since:      sats.RuntimeDependenciesStartDate,
+	}
 
-	err := serviceManager.RemoveServicesFromCompose(FleetProfileName, []string{serviceName}, profileEnv)
+	_, err = assertions.HasDocs(selector, minimumHitsCount, maxTimeout)
 	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn(e2e.WaitForIndices())
 		return err
 	}
-	sats.AgentStoppedDate = time.Now().UTC()
 
 	return nil
 }
 
 func (sats *StandAloneTestSuite) thereIsNoNewDataInTheIndexAfterAgentShutsDown() error {
-	maxTimeout := time.Duration(30) * time.Second
-	minimumHitsCount := 1
+	period := time.Duration(30) * time.Second
 
-	result, err := searchAgentData(sats.Hostname, sats.AgentStoppedDate, minimumHitsCount, maxTimeout)
+	assertions, err := e2e.GetDataStreamAssertions()
 	if err != nil {
-		if strings.Contains(err.Error(), "type:index_not_found_exception") {
-			return err
-		}
+		return err
+	}
 
-		log.WithFields(log.Fields{
-			"error": err,
-		}).Info("No documents were found for the Agent in the index after it stopped")
-		return nil
+	// the agent is stopped with the "docker container is stopped" shared step
+	selector := datastreams.Selector{
+		DataStream: agentLogsDataStream,
+		Hostname:   sats.Hostname,
+		Since:      sats.suite.stoppedAt(ElasticAgentServiceName),
 	}
 
-	return e2e.AssertHitsAreNotPresent(result)
+	return assertions.HasNoDocs(selector, period)
 }
 
-func searchAgentData(hostname string, startDate time.Time, minimumHitsCount int, maxTimeout time.Duration) (e2e.SearchResult, error) {
-	timezone := "America/New_York"
-
-	esQuery := map[string]interface{}{
-		"version": true,
-		"size":    500,
-		"docvalue_fields": []map[string]interface{}{
-			{
-				"field":  "@timestamp",
-				"format": "date_time",
-			},
-			{
-				"field":  "system.process.cpu.start_time",
-				"format": "date_time",
-			},
-			{
-				"field":  "system.service.state_since",
-				"format": "date_time",
-			},
-		},
-		"_source": map[string]interface{}{
-			"excludes": []map[string]interface{}{},
-		},
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": []map[string]interface{}{},
-				"filter": []map[string]interface{}{
-					{
-						"bool": map[string]interface{}{
-							"filter": []map[string]interface{}{
-								{
-									"bool": map[string]interface{}{
-										"should": []map[string]interface{}{
-											{
-												"match_phrase": map[string]interface{}{
-													"host.name": hostname,
-												},
-											},
-										},
-										"minimum_should_match": 1,
-									},
-								},
-								{
-									"bool": map[string]interface{}{
-										"should": []map[string]interface{}{
-											{
-												"range": map[string]interface{}{
-													"@timestamp": map[string]interface{}{
-														"gte":       startDate,
-														"time_zone": timezone,
-													},
-												},
-											},
-										},
-										"minimum_should_match": 1,
-									},
-								},
-							},
-						},
-					},
-					{
-						"range": map[string]interface{}{
-							"@timestamp": map[string]interface{}{
-								"gte":    startDate,
-								"format": "strict_date_optional_time",
-							},
-						},
-					},
-				},
-				"should":   []map[string]interface{}{},
-				"must_not": []map[string]interface{}{},
-			},
-		},
-	}
-
-	indexName := "logs-elastic_agent-default"
-
-	result, err := e2e.WaitForNumberOfHits(indexName, esQuery, minimumHitsCount, maxTimeout)
+// standAloneConfigVarRegexp matches the references to the env vars in the configuration file of the
+// stand-alone agents, with or without a default value, i.e. ${ELASTICSEARCH_HOST:http://elasticsearch:9200}
+var standAloneConfigVarRegexp = regexp.MustCompile(`\$\{([A-Z_][A-Z0-9_]*)(:[^}]*)?\}`)
+
+// renderStandAloneConfigFile replaces the env vars of the configuration file of the Docker image of
+// the stand-alone agents by the values the Docker image is run with, as the agents installed from a
+// package run as a service, without them
+func renderStandAloneConfigFile(path string) error {
+	values := map[string]string{
+		"ELASTICSEARCH_HOST":     config.GetURLScheme() + "://elasticsearch:9200",
+		"ELASTICSEARCH_PASSWORD": "changeme",
+		"ELASTICSEARCH_USERNAME": "elastic",
+		"KIBANA_HOST":            getAgentKibanaURL(),
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	rendered := standAloneConfigVarRegexp.ReplaceAllStringFunc(string(content), func(reference string) string {
+		name := standAloneConfigVarRegexp.FindStringSubmatch(reference)[1]
+		if value, exists := values[name]; exists {
+			return value
+		}
+
+		return reference
+	})
+
+	err = ioutil.WriteFile(path, []byte(rendered), 0644)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error": err,
-		}).Warn(e2e.WaitForIndices())
+			"path":  path,
+		}).Error("Could not render the configuration file of the stand-alone agent")
+		return err
 	}
 
-	return result, err
+	return nil
+}
+
+// agentLogsDataStream the data stream of the logs of the agents
+var agentLogsDataStream = elasticsearch.DataStream{
+	Dataset:   "elastic_agent",
+	Namespace: "default",
+	Type:      "logs",
 }
@@ -0,0 +1,91 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/runner"
+)
+
+// SuiteContext the state shared by the scenarios of a run of the suite: the client of the APIs of
+// Fleet, the deployer of the boxes of the agents, and the environment of the profile. The steps get
+// it through the closures registering them, instead of package-level globals, so that a suite owns
+// its state, and the clients injected into it can be replaced, i.e. by a client of a fake Kibana
+type SuiteContext struct {
+	deployer *agentDeployer
+	env      *profileEnvironment
+	fleet    *kibana.Client
+	runner   *runner.Suite // the runner of the suite, holding the shared steps of the running scenario
+}
+
+// NewSuiteContext returns the context of a suite, with the client of the APIs of Fleet and the
+// deployer of the boxes of the agents, sharing the environment of the profile with the deployer
+func NewSuiteContext(fleet *kibana.Client, deployer *agentDeployer) *SuiteContext {
+	return &SuiteContext{
+		deployer: deployer,
+		env:      deployer.env,
+		fleet:    fleet,
+	}
+}
+
+// stoppedAt returns the time a service was stopped at in the running scenario by the shared steps,
+// being zero if it was not stopped
+func (sc *SuiteContext) stoppedAt(service string) time.Time {
+	if sc.runner == nil || sc.runner.Steps == nil {
+		return time.Time{}
+	}
+
+	return sc.runner.Steps.StoppedAt(service)
+}
+
+// profileEnvironment the environment of the docker-compose files of the profile, which the steps
+// change while they deploy the agents and the services of the scenarios. Its values are the ones
+// the runner of the suite and the shared steps use, so they are changed in place, and copied to be
+// passed to the service manager
+type profileEnvironment struct {
+	mutex  sync.RWMutex
+	values map[string]string
+}
+
+// newProfileEnvironment returns an empty environment of the profile
+func newProfileEnvironment() *profileEnvironment {
+	return &profileEnvironment{values: map[string]string{}}
+}
+
+// get returns a copy of the environment
+func (e *profileEnvironment) get() map[string]string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	values := make(map[string]string, len(e.values))
+	for k, v := range e.values {
+		values[k] = v
+	}
+
+	return values
+}
+
+// put sets some variables of the environment, keeping the rest
+func (e *profileEnvironment) put(values map[string]string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for k, v := range values {
+		e.values[k] = v
+	}
+}
+
+// reset replaces the environment, once the profile computes it at the beginning of the suite,
+// returning the values shared with the runner of the suite
+func (e *profileEnvironment) reset(values map[string]string) map[string]string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.values = values
+	return e.values
+}
@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/datastreams"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// unenrollGracePeriod the time an agent could keep sending documents after it's un-enrolled, while
+// it acknowledges the un-enrollment and stops its processes
+const unenrollGracePeriod = 30 * time.Second
+
+// agentDataStreams the data streams which the agents enrolled into the default policy send
+// documents to: the logs of the agents, and the metrics of the system integration
+var agentDataStreams = []elasticsearch.DataStream{
+	agentLogsDataStream,
+	{
+		Dataset:   "system.cpu",
+		Namespace: "default",
+		Type:      "metrics",
+	},
+}
+
+// theAgentIsForceUnenrolled un-enrolls the agent revoking its API keys right away, without waiting
+// for the agent to acknowledge it, i.e. when the agent is stopped
+func (fts *FleetTestSuite) theAgentIsForceUnenrolled() error {
+	fts.UnenrolledAt = time.Now()
+
+	return fts.unenrollHostname(true)
+}
+
+// theAgentStopsSendingDataToTheDataStreams checks that the agent sent documents to each data stream
+// before it was un-enrolled, and that it does not send new ones once the grace period passes
+func (fts *FleetTestSuite) theAgentStopsSendingDataToTheDataStreams() error {
+	if fts.UnenrolledAt.IsZero() {
+		return fmt.Errorf("the agent of the %s host was not un-enrolled in the scenario", fts.Hostname)
+	}
+
+	maxTimeout := time.Duration(timeoutFactor) * time.Minute * 2
+	period := time.Duration(timeoutFactor) * 30 * time.Second
+
+	assertions, err := e2e.GetDataStreamAssertions()
+	if err != nil {
+		return err
+	}
+
+	for _, dataStream := range agentDataStreams {
+		selector := datastreams.Selector{
+			DataStream: dataStream,
+			Hostname:   fts.Hostname,
+		}
+
+		_, err := assertions.HasDocs(selector, 1, maxTimeout)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dataStream": dataStream.Name(),
+				"error":      err,
+				"hostname":   fts.Hostname,
+			}).Error("The agent did not send documents to the data stream before it was un-enrolled")
+			return err
+		}
+
+		selector.Since = fts.UnenrolledAt.Add(unenrollGracePeriod)
+
+		// the documents sent during the grace period are not searched
+		if wait := time.Until(selector.Since); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		err = assertions.HasNoDocs(selector, period)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"dataStream":   dataStream.Name(),
+				"error":        err,
+				"hostname":     fts.Hostname,
+				"unenrolledAt": fts.UnenrolledAt,
+			}).Error("The agent keeps sending documents to the data stream after it was un-enrolled")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// theEnrollmentTokenIsListedInFleetAsRevoked checks that the enrollment token of the scenario is
+// not active in Fleet anymore
+func (fts *FleetTestSuite) theEnrollmentTokenIsListedInFleetAsRevoked() error {
+	token, err := fts.suite.fleet.GetEnrollmentAPIKey(fts.CurrentTokenID)
+	if err != nil {
+		return err
+	}
+
+	if token.Active {
+		return fmt.Errorf("the %s enrollment token is still active in Fleet", fts.CurrentTokenID)
+	}
+
+	log.WithFields(log.Fields{
+		"tokenID": fts.CurrentTokenID,
+	}).Debug("The enrollment token is listed in Fleet as revoked")
+
+	return nil
+}
@@ -5,9 +5,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
@@ -18,14 +20,13 @@ import (
 	"github.com/elastic/e2e-testing/e2e"
 
 	"github.com/cucumber/godog"
-	messages "github.com/cucumber/messages-go/v10"
 	log "github.com/sirupsen/logrus"
 )
 
 // developerMode tears down the backend services (the k8s cluster)
 // after a test suite. This is the desired behavior, but when developing, we maybe want to keep
 // them running to speed up the development cycle.
-// It can be overriden by the DEVELOPER_MODE env var
+// It can be overriden by the DEVELOPER_MODE env var, or the --keep-stack flag
 var developerMode = false
 
 var helm k8s.HelmManager
@@ -37,14 +38,15 @@ var timeoutFactor = 2
 //nolint:unused
 var kubectl k8s.Kubectl
 
+// clusterCleanup destroys the cluster of the suite, which is kept in developer mode
+var clusterCleanup *e2e.Cleanup
+
+// testSuite holds the state of the suite, shared by its hooks and the steps of its scenarios
+var testSuite HelmChartTestSuite
+
 func init() {
 	config.Init()
 
-	developerMode, _ = shell.GetEnvBool("DEVELOPER_MODE")
-	if developerMode {
-		log.Info("Running in Developer mode 💻: runtime dependencies between different test runs will be reused to speed up dev cycle")
-	}
-
 	helmVersion := "3.x"
 	if value, exists := os.LookupEnv("HELM_VERSION"); exists {
 		helmVersion = value
@@ -57,6 +59,19 @@ func init() {
 		log.Fatalf("Helm could not be initialised: %v", err)
 	}
 	helm = h
+
+	testSuite = HelmChartTestSuite{
+		ClusterName:       "helm-charts-test-suite",
+		KubernetesVersion: "1.18.2",
+		Version:           "7.10.0",
+	}
+
+	if value, exists := os.LookupEnv("HELM_CHART_VERSION"); exists {
+		testSuite.Version = value
+	}
+	if value, exists := os.LookupEnv("HELM_KUBERNETES_VERSION"); exists {
+		testSuite.KubernetesVersion = value
+	}
 }
 
 // HelmChartTestSuite represents a test suite for a helm chart
@@ -551,42 +566,51 @@ func (ts *HelmChartTestSuite) willRetrieveSpecificMetrics(chartName string) erro
 	return nil
 }
 
-// HelmChartFeatureContext adds steps to the Godog test suite
-//nolint:deadcode,unused
-func HelmChartFeatureContext(s *godog.Suite) {
-	testSuite := HelmChartTestSuite{
-		ClusterName:       "helm-charts-test-suite",
-		KubernetesVersion: "1.18.2",
-		Version:           "7.10.0",
+// collectArtifacts writes the state of the resources in the cluster, and the logs of the pods
+// for the chart under test, into the artifacts bundle of a failed scenario
+func (ts *HelmChartTestSuite) collectArtifacts(bundleDir string) error {
+	resources, err := kubectl.Run("get", "all", "--all-namespaces", "-o", "wide")
+	if err != nil {
+		return err
 	}
+	_ = e2e.WriteArtifact(bundleDir, "kubectl-get-all.txt", resources)
 
-	if value, exists := os.LookupEnv("HELM_CHART_VERSION"); exists {
-		testSuite.Version = value
+	pods, err := kubectl.Run("describe", "pods", "-l", "app="+ts.getPodName())
+	if err != nil {
+		return err
 	}
-	if value, exists := os.LookupEnv("HELM_KUBERNETES_VERSION"); exists {
-		testSuite.KubernetesVersion = value
+	_ = e2e.WriteArtifact(bundleDir, "kubectl-describe-pods.txt", pods)
+
+	logs, err := kubectl.Run("logs", "-l", "app="+ts.getPodName(), "--all-containers", "--tail=1000")
+	if err != nil {
+		return err
 	}
 
-	s.Step(`^a cluster is running$`, testSuite.aClusterIsRunning)
-	s.Step(`^the "([^"]*)" Elastic\'s helm chart is installed$`, testSuite.elasticsHelmChartIsInstalled)
-	s.Step(`^a pod will be deployed on each node of the cluster by a DaemonSet$`, testSuite.podsManagedByDaemonSet)
-	s.Step(`^a "([^"]*)" will manage additional pods for metricsets querying internal services$`, testSuite.resourceWillManageAdditionalPodsForMetricsets)
-	s.Step(`^a "([^"]*)" chart will retrieve specific Kubernetes metrics$`, testSuite.willRetrieveSpecificMetrics)
-	s.Step(`^a "([^"]*)" resource contains the "([^"]*)" key$`, testSuite.aResourceContainsTheKey)
-	s.Step(`^a "([^"]*)" resource manages RBAC$`, testSuite.aResourceManagesRBAC)
-	s.Step(`^the "([^"]*)" volume is mounted at "([^"]*)" with subpath "([^"]*)"$`, testSuite.volumeMountedWithSubpath)
-	s.Step(`^the "([^"]*)" volume is mounted at "([^"]*)" with no subpath$`, testSuite.volumeMountedWithNoSubpath)
-	s.Step(`^the "([^"]*)" strategy can be used during updates$`, testSuite.strategyCanBeUsedDuringUpdates)
-	s.Step(`^the "([^"]*)" strategy can be used for "([^"]*)" during updates$`, testSuite.strategyCanBeUsedForResourceDuringUpdates)
-	s.Step(`^resource "([^"]*)" are applied$`, testSuite.resourceConstraintsAreApplied)
+	return e2e.WriteArtifact(bundleDir, "pods.log", logs)
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(e2e.RunSuite("helm", InitializeHelmChartTestSuite, InitializeHelmChartScenario))
+}
 
-	s.Step(`^a "([^"]*)" will manage the pods$`, testSuite.aResourceWillManagePods)
-	s.Step(`^a "([^"]*)" will expose the pods as network services internal to the k8s cluster$`, testSuite.aResourceWillExposePods)
+// InitializeHelmChartTestSuite adds the hooks creating and destroying the cluster to the Godog test suite
+func InitializeHelmChartTestSuite(s *godog.TestSuiteContext) {
+	e2e.AddReportProperty("chartVersion", testSuite.Version)
+	e2e.AddReportProperty("kubernetesVersion", testSuite.KubernetesVersion)
 
 	s.BeforeSuite(func() {
+		developerMode = e2e.IsDeveloperMode()
+		if developerMode {
+			log.Info("Running in Developer mode 💻: runtime dependencies between different test runs will be reused to speed up dev cycle")
+		}
+
 		log.Trace("Before Suite...")
 		toolsAreInstalled()
 
+		if !developerMode {
+			clusterCleanup = e2e.RegisterCleanup("kind cluster", testSuite.destroyCluster)
+		}
+
 		err := testSuite.createCluster(testSuite.KubernetesVersion)
 		if err != nil {
 			return
@@ -600,21 +624,59 @@ func HelmChartFeatureContext(s *godog.Suite) {
 			return
 		}
 	})
-	s.BeforeScenario(func(*messages.Pickle) {
-		log.Trace("Before Helm scenario...")
-	})
 	s.AfterSuite(func() {
-		if !developerMode {
+		if clusterCleanup != nil {
 			log.Trace("After Suite...")
-			err := testSuite.destroyCluster()
+			err := clusterCleanup.Run()
 			if err != nil {
 				return
 			}
 		}
 	})
-	s.AfterScenario(func(*messages.Pickle, error) {
+}
+
+// InitializeHelmChartScenario adds steps to the scenarios of the Godog test suite
+func InitializeHelmChartScenario(s *godog.ScenarioContext) {
+	e2e.Step(s, `^a cluster is running$`, testSuite.aClusterIsRunning)
+	e2e.Step(s, `^the "([^"]*)" Elastic\'s helm chart is installed$`, testSuite.elasticsHelmChartIsInstalled)
+	e2e.Step(s, `^a pod will be deployed on each node of the cluster by a DaemonSet$`, testSuite.podsManagedByDaemonSet)
+	e2e.Step(s, `^a "([^"]*)" will manage additional pods for metricsets querying internal services$`, testSuite.resourceWillManageAdditionalPodsForMetricsets)
+	e2e.Step(s, `^a "([^"]*)" chart will retrieve specific Kubernetes metrics$`, testSuite.willRetrieveSpecificMetrics)
+	e2e.Step(s, `^a "([^"]*)" resource contains the "([^"]*)" key$`, testSuite.aResourceContainsTheKey)
+	e2e.Step(s, `^a "([^"]*)" resource manages RBAC$`, testSuite.aResourceManagesRBAC)
+	e2e.Step(s, `^the "([^"]*)" volume is mounted at "([^"]*)" with subpath "([^"]*)"$`, testSuite.volumeMountedWithSubpath)
+	e2e.Step(s, `^the "([^"]*)" volume is mounted at "([^"]*)" with no subpath$`, testSuite.volumeMountedWithNoSubpath)
+	e2e.Step(s, `^the "([^"]*)" strategy can be used during updates$`, testSuite.strategyCanBeUsedDuringUpdates)
+	e2e.Step(s, `^the "([^"]*)" strategy can be used for "([^"]*)" during updates$`, testSuite.strategyCanBeUsedForResourceDuringUpdates)
+	e2e.Step(s, `^resource "([^"]*)" are applied$`, testSuite.resourceConstraintsAreApplied)
+
+	e2e.Step(s, `^a "([^"]*)" will manage the pods$`, testSuite.aResourceWillManagePods)
+	e2e.Step(s, `^a "([^"]*)" will expose the pods as network services internal to the k8s cluster$`, testSuite.aResourceWillExposePods)
+
+	e2e.RegisterScenarioRetries(s)
+	e2e.RegisterScenarioTimeouts(s)
+	e2e.RegisterFailureArtifacts(s, testSuite.collectArtifacts)
+	e2e.RegisterSoakMonitor(s)
+
+	var scenarioCleanup *e2e.Cleanup
+
+	s.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
+		log.Trace("Before Helm scenario...")
+
+		// the chart installed by the scenario is deleted if the run is interrupted
+		scenarioCleanup = e2e.RegisterCleanup("helm scenario: "+sc.Name, func() error {
+			testSuite.deleteChart()
+			return nil
+		})
+
+		return ctx, nil
+	})
+	s.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
 		log.Trace("After Helm scenario...")
-		testSuite.deleteChart()
+		if scenarioCleanup != nil {
+			_ = scenarioCleanup.Run()
+		}
+		return ctx, nil
 	})
 }
 
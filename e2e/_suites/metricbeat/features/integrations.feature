@@ -14,6 +14,10 @@ Examples: Apache
 | apache      | 2.4.12  |
 | apache      | 2.4.20  |
 
+@kafka @supported-versions
+Examples: Kafka
+| integration | version |
+
 @redis
 Examples: Redis
 | integration | version |
@@ -33,13 +37,27 @@ Scenario Outline: <integration>-<variant>-<version> sends metrics to Elasticsear
   Then there are "<variant>" events in the index
     And there are no errors in the index
 
+@mysql @supported-versions
+Examples: MySQL
+| integration | variant | version |
+
+@secured
+Scenario Outline: <integration>-<version> secured with TLS and authentication sends metrics to Elasticsearch without errors
+  Given "<integration>" "<version>" is running secured for metricbeat with:
+    | option   | value      |
+    | tls      | true       |
+    | username | <username> |
+    | password | <password> |
+  When metricbeat is installed and configured for "<integration>" module
+  Then there are "<integration>" events in the index
+    And there are no errors in the index
+
+@apache
+Examples: Apache
+| integration | version | username | password |
+| apache      | 2.4.20  | elastic  | changeme |
+
 @mysql
 Examples: MySQL
-| integration | variant | version  |
-| mysql       | MariaDB | 10.2.23  |
-| mysql       | MariaDB | 10.3.14  |
-| mysql       | MariaDB | 10.4.4   |
-| mysql       | MySQL   | 5.7.12   |
-| mysql       | MySQL   | 8.0.13   |
-| mysql       | Percona | 5.7.24   |
-| mysql       | Percona | 8.0.13-4 |
+| integration | version | username | password |
+| mysql       | 8.0.13  | root     | test     |
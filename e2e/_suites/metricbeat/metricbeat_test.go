@@ -7,26 +7,25 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/cucumber/godog"
-	messages "github.com/cucumber/messages-go/v10"
 	"github.com/elastic/e2e-testing/cli/config"
 	"github.com/elastic/e2e-testing/cli/services"
 	"github.com/elastic/e2e-testing/cli/shell"
 	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/chaos"
+	"github.com/elastic/e2e-testing/e2e/pkg/datagen"
+	"github.com/elastic/e2e-testing/e2e/pkg/steps"
+	"github.com/elastic/e2e-testing/e2e/runner"
 	log "github.com/sirupsen/logrus"
 )
 
-// developerMode tears down the backend services (the elasticsearch instance)
-// after a test suite. This is the desired behavior, but when developing, we maybe want to keep
-// them running to speed up the development cycle.
-// It can be overriden by the DEVELOPER_MODE env var
-var developerMode = false
-
 const metricbeatVersionBase = "8.0.0-SNAPSHOT"
 
 // metricbeatVersion is the version of the metricbeat to use
@@ -46,16 +45,56 @@ var stackVersion = metricbeatVersionBase
 func init() {
 	config.Init()
 
-	developerMode, _ = shell.GetEnvBool("DEVELOPER_MODE")
-	if developerMode {
-		log.Info("Running in Developer mode 💻: runtime dependencies between different test runs will be reused to speed up dev cycle")
-	}
-
 	metricbeatVersion = shell.GetEnv("METRICBEAT_VERSION", metricbeatVersion)
 	timeoutFactor = shell.GetEnvInteger("TIMEOUT_FACTOR", timeoutFactor)
 	stackVersion = shell.GetEnv("STACK_VERSION", stackVersion)
 
 	serviceManager = services.NewServiceManager()
+
+	e2e.RegisterExamplesExpander("@supported-versions", supportedVersionsExamples)
+}
+
+// supportedVersionsExamples generates a row for each version and variant of the service supported by its
+// metricbeat module, read from the supported-versions.yml file of the module. The service is the one
+// of the other tag of the examples, i.e. @mysql, filling the integration, variant and version columns
+func supportedVersionsExamples(header []string, tags []string) ([][]string, error) {
+	for _, tag := range tags {
+		service := strings.TrimPrefix(tag, "@")
+		if service == "supported-versions" {
+			continue
+		}
+
+		variants, err := config.GetServiceVariants(service)
+		if err != nil {
+			continue
+		}
+
+		rows := [][]string{}
+		for _, v := range variants {
+			row := []string{}
+			for _, column := range header {
+				switch column {
+				case "integration":
+					row = append(row, service)
+				case "variant":
+					variant := v.Variant
+					if variant == "" {
+						variant = service
+					}
+					row = append(row, variant)
+				case "version":
+					row = append(row, v.Version)
+				default:
+					return nil, fmt.Errorf("the %s column of the examples is not supported, only integration, variant and version are", column)
+				}
+			}
+			rows = append(rows, row)
+		}
+
+		return rows, nil
+	}
+
+	return nil, fmt.Errorf("none of the %v tags of the examples is a service with supported versions", tags)
 }
 
 // MetricbeatTestSuite represents a test suite, holding references to both metricbeat ant
@@ -65,9 +104,11 @@ type MetricbeatTestSuite struct {
 	cleanUpTmpFiles   bool                   // if it's needed to clean up temporary files
 	configurationFile string                 // the  name of the configuration file to be used in this test suite
 	ServiceName       string                 // the service to be monitored by metricbeat
+	ServiceSecurity   config.ServiceSecurity // the security options of the service, if it runs secured
 	ServiceType       string                 // the type of the service to be monitored by metricbeat
 	ServiceVariant    string                 // the variant of the service to be monitored by metricbeat
 	ServiceVersion    string                 // the version of the service to be monitored by metricbeat
+	StartedAt         time.Time              // the moment metricbeat was started
 	Query             e2e.ElasticsearchQuery // the specs for the ES query
 	Version           string                 // the metricbeat version for the test
 }
@@ -146,67 +187,62 @@ func (mts *MetricbeatTestSuite) CleanUp() error {
 	return err
 }
 
-// MetricbeatFeatureContext adds steps to the Godog test suite
-//nolint:deadcode,unused
-func MetricbeatFeatureContext(s *godog.Suite) {
+func TestMain(m *testing.M) {
+	os.Exit(newMetricbeatSuite().Run())
+}
+
+// newMetricbeatSuite returns the metricbeat suite, running the metricbeat profile with the images of
+// metricbeat pulled in the version under test
+func newMetricbeatSuite() *runner.Suite {
+	return runner.New(runner.Options{
+		Name:         "metricbeat",
+		Profile:      "metricbeat",
+		StackVersion: stackVersion,
+		ReportProperties: map[string]string{
+			"metricbeatVersion": metricbeatVersion,
+			"stackVersion":      stackVersion,
+		},
+		Timeout:     time.Duration(timeoutFactor) * time.Minute,
+		LocalImages: "metricbeat",
+		PullServices: func(profileEnv map[string]string) ([]string, map[string]string) {
+			// the metricbeat service is added to the profile by the scenarios, in the version under test
+			metricbeatTag := metricbeatVersion
+			if strings.HasPrefix(metricbeatTag, "pr-") {
+				metricbeatTag = metricbeatVersionBase
+			}
+
+			return []string{"metricbeat"}, map[string]string{
+				"metricbeatTag": metricbeatTag,
+				"stackVersion":  stackVersion,
+			}
+		},
+		Scenario:    InitializeMetricbeatScenario,
+		StepBundles: []steps.Bundle{steps.ServicesBundle, steps.FilesBundle, steps.WaitsBundle, steps.ElasticsearchBundle},
+	})
+}
+
+// InitializeMetricbeatScenario adds steps to the scenarios of the Godog test suite. Each scenario
+// uses its own test suite, so that no state is shared between them
+func InitializeMetricbeatScenario(s *godog.ScenarioContext) func() error {
 	testSuite := MetricbeatTestSuite{
 		Query: e2e.ElasticsearchQuery{},
 	}
 
-	s.Step(`^"([^"]*)" "([^"]*)" is running for metricbeat$`, testSuite.serviceIsRunningForMetricbeat)
-	s.Step(`^"([^"]*)" v([^"]*), variant of "([^"]*)", is running for metricbeat$`, testSuite.serviceVariantIsRunningForMetricbeat)
-	s.Step(`^metricbeat is installed and configured for "([^"]*)" module$`, testSuite.installedAndConfiguredForModule)
-	s.Step(`^metricbeat is installed and configured for "([^"]*)", variant of the "([^"]*)" module$`, testSuite.installedAndConfiguredForVariantModule)
-	s.Step(`^there are no errors in the index$`, testSuite.thereAreNoErrorsInTheIndex)
-	s.Step(`^there are "([^"]*)" events in the index$`, testSuite.thereAreEventsInTheIndex)
+	e2e.Step(s, `^"([^"]*)" "([^"]*)" is running for metricbeat$`, testSuite.serviceIsRunningForMetricbeat)
+	e2e.Step(s, `^"([^"]*)" "([^"]*)" is running secured for metricbeat with:$`, testSuite.serviceIsRunningSecuredForMetricbeat)
+	e2e.Step(s, `^"([^"]*)" v([^"]*), variant of "([^"]*)", is running for metricbeat$`, testSuite.serviceVariantIsRunningForMetricbeat)
+	e2e.Step(s, `^metricbeat is installed and configured for "([^"]*)" module$`, testSuite.installedAndConfiguredForModule)
+	e2e.Step(s, `^metricbeat is installed and configured for "([^"]*)", variant of the "([^"]*)" module$`, testSuite.installedAndConfiguredForVariantModule)
+	e2e.Step(s, `^there are no errors in the index$`, testSuite.thereAreNoErrorsInTheIndex)
+	e2e.Step(s, `^there are "([^"]*)" events in the index$`, testSuite.thereAreEventsInTheIndex)
 
-	s.Step(`^metricbeat is installed using "([^"]*)" configuration$`, testSuite.installedUsingConfiguration)
+	e2e.Step(s, `^metricbeat is installed using "([^"]*)" configuration$`, testSuite.installedUsingConfiguration)
 
-	s.BeforeSuite(func() {
-		log.Trace("Before Metricbeat Suite...")
-		serviceManager := services.NewServiceManager()
+	e2e.RegisterSoakMonitor(s)
+	chaos.RegisterSteps(s, "metricbeat")
+	datagen.RegisterSteps(s, "metricbeat", datagen.Config{})
 
-		env := map[string]string{
-			"stackVersion": stackVersion,
-		}
-
-		err := serviceManager.RunCompose(true, []string{"metricbeat"}, env)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"profile": "metricbeat",
-			}).Fatal("Could not run the profile.")
-		}
-
-		minutesToBeHealthy := time.Duration(timeoutFactor) * time.Minute
-		healthy, err := e2e.WaitForElasticsearch(minutesToBeHealthy)
-		if !healthy {
-			log.WithFields(log.Fields{
-				"error":   err,
-				"minutes": minutesToBeHealthy,
-			}).Fatal("The Elasticsearch cluster could not get the healthy status")
-		}
-	})
-	s.BeforeScenario(func(*messages.Pickle) {
-		log.Trace("Before scenario...")
-	})
-	s.AfterSuite(func() {
-		if !developerMode {
-			serviceManager := services.NewServiceManager()
-			err := serviceManager.StopCompose(true, []string{"metricbeat"})
-			if err != nil {
-				log.WithFields(log.Fields{
-					"profile": "metricbeat",
-				}).Error("Could not stop the profile.")
-			}
-		}
-	})
-	s.AfterScenario(func(*messages.Pickle, error) {
-		log.Trace("After scenario...")
-		err := testSuite.CleanUp()
-		if err != nil {
-			log.Errorf("CleanUp failed: %v", err)
-		}
-	})
+	return testSuite.CleanUp
 }
 
 func (mts *MetricbeatTestSuite) installedAndConfiguredForModule(serviceType string) error {
@@ -222,6 +258,15 @@ func (mts *MetricbeatTestSuite) installedAndConfiguredForModule(serviceType stri
 	mts.configurationFile = path.Join(dir, "configurations", mts.ServiceName+".yml")
 	_ = os.Chmod(mts.configurationFile, 0666)
 
+	if isSecured(mts.ServiceSecurity) {
+		configurationFile, err := renderSecuredConfiguration(path.Join(dir, "configurations", mts.ServiceName+"-secured.yml"), mts.ServiceName, mts.ServiceSecurity)
+		if err != nil {
+			return err
+		}
+		mts.configurationFile = configurationFile
+		mts.cleanUpTmpFiles = true
+	}
+
 	mts.setEventModule(mts.ServiceType)
 	mts.setServiceVersion(mts.Version)
 
@@ -254,13 +299,7 @@ func (mts *MetricbeatTestSuite) installedUsingConfiguration(configuration string
 	mts.Version = metricbeatVersion
 	mts.setIndexName()
 
-	// use master branch for snapshots
-	tag := "v" + metricbeatVersion
-	if strings.Contains(metricbeatVersion, "SNAPSHOT") {
-		tag = "master"
-	}
-
-	configurationFileURL := "https://raw.githubusercontent.com/elastic/beats/" + tag + "/metricbeat/" + configuration + ".yml"
+	configurationFileURL := e2e.GetBeatsFileURL(metricbeatVersion, "metricbeat/"+configuration+".yml")
 
 	configurationFilePath, err := e2e.DownloadFile(configurationFileURL)
 	if err != nil {
@@ -282,10 +321,6 @@ func (mts *MetricbeatTestSuite) installedUsingConfiguration(configuration string
 
 // runMetricbeatService runs a metricbeat service entity for a service to monitor it
 func (mts *MetricbeatTestSuite) runMetricbeatService() error {
-	// this is needed because, in general, the target service (apache, mysql, redis) does not have a healthcheck
-	waitForService := time.Duration(timeoutFactor) * 10
-	e2e.Sleep(fmt.Sprintf("%d", waitForService))
-
 	serviceManager := services.NewServiceManager()
 
 	logLevel := log.GetLevel().String()
@@ -304,6 +339,11 @@ func (mts *MetricbeatTestSuite) runMetricbeatService() error {
 		"serviceName":           mts.ServiceName,
 	}
 
+	// metricbeat trusts the CA signing the certificate of the service
+	if mts.ServiceSecurity.TLS {
+		env[config.CertsDirKey] = config.GetCertsDir()
+	}
+
 	err := serviceManager.AddServicesToCompose("metricbeat", []string{"metricbeat"}, env)
 	if err != nil {
 		log.WithFields(log.Fields{
@@ -315,6 +355,7 @@ func (mts *MetricbeatTestSuite) runMetricbeatService() error {
 
 		return err
 	}
+	mts.StartedAt = time.Now()
 
 	if mts.ServiceName != "" && mts.ServiceVersion != "" {
 		fields := log.Fields{
@@ -372,12 +413,53 @@ func (mts *MetricbeatTestSuite) serviceIsRunningForMetricbeat(serviceType string
 		}).Error("Could not run the service.")
 	}
 
+	if err == nil {
+		err = waitForServiceToBeHealthy(serviceType)
+	}
+
 	mts.ServiceName = serviceType
 	mts.ServiceVersion = serviceVersion
 
 	return err
 }
 
+// serviceIsRunningSecuredForMetricbeat runs a service with the security options of a table, i.e.
+// tls, username and password, so that metricbeat monitors it with the secured configuration of the module
+func (mts *MetricbeatTestSuite) serviceIsRunningSecuredForMetricbeat(serviceType string, serviceVersion string, options *godog.Table) error {
+	serviceType = strings.ToLower(serviceType)
+
+	security, err := newServiceSecurity(options)
+	if err != nil {
+		return err
+	}
+
+	env := map[string]string{
+		"stackVersion": stackVersion,
+	}
+	env = config.PutServiceEnvironment(env, serviceType, serviceVersion)
+	env = config.PutServiceSecurityEnvironment(env, serviceType, security)
+
+	err = serviceManager.AddServicesToCompose("metricbeat", []string{serviceType}, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service":  serviceType,
+			"tls":      security.TLS,
+			"username": security.Username,
+			"version":  serviceVersion,
+		}).Error("Could not run the service secured.")
+	}
+
+	if err == nil {
+		err = waitForServiceToBeHealthy(serviceType)
+	}
+
+	mts.ServiceName = serviceType
+	mts.ServiceSecurity = security
+	mts.ServiceVersion = serviceVersion
+
+	return err
+}
+
 func (mts *MetricbeatTestSuite) serviceVariantIsRunningForMetricbeat(
 	serviceVariant string, serviceVersion string, serviceType string) error {
 
@@ -398,12 +480,101 @@ func (mts *MetricbeatTestSuite) serviceVariantIsRunningForMetricbeat(
 		}).Error("Could not run the service.")
 	}
 
+	if err == nil {
+		err = waitForServiceToBeHealthy(serviceType)
+	}
+
 	mts.ServiceName = serviceType
 	mts.ServiceVersion = serviceVersion
 
 	return err
 }
 
+// isSecured returns if a service runs with TLS or authentication
+func isSecured(security config.ServiceSecurity) bool {
+	return security.TLS || security.Username != ""
+}
+
+// newServiceSecurity returns the security options of a service from a table of options and values,
+// with an optional "option | value" header
+func newServiceSecurity(table *godog.Table) (config.ServiceSecurity, error) {
+	security := config.ServiceSecurity{}
+
+	for i, row := range table.Rows {
+		if len(row.Cells) != 2 {
+			return security, fmt.Errorf("the row %d of the security options must have an option and a value", i+1)
+		}
+
+		option := strings.TrimSpace(row.Cells[0].Value)
+		value := strings.TrimSpace(row.Cells[1].Value)
+
+		switch option {
+		case "option":
+			if i > 0 {
+				return security, fmt.Errorf("the header of the security options must be the first row")
+			}
+		case "password":
+			security.Password = value
+		case "tls":
+			security.TLS = value == "true"
+		case "username":
+			security.Username = value
+		default:
+			return security, fmt.Errorf("the %s security option is not supported, use tls, username or password", option)
+		}
+	}
+
+	if !isSecured(security) {
+		return security, fmt.Errorf("the service must run with tls or with a username")
+	}
+
+	return security, nil
+}
+
+// renderSecuredConfiguration renders the secured configuration of a module into a temporary file,
+// replacing the ${SERVICE_USERNAME} and ${SERVICE_PASSWORD} variables with the credentials of the service
+func renderSecuredConfiguration(configurationFile string, service string, security config.ServiceSecurity) (string, error) {
+	bytes, err := ioutil.ReadFile(configurationFile)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"path":    configurationFile,
+			"service": service,
+		}).Error("Could not read the secured configuration of the module")
+		return "", err
+	}
+
+	content := strings.NewReplacer(
+		"${SERVICE_PASSWORD}", security.Password,
+		"${SERVICE_USERNAME}", security.Username,
+	).Replace(string(bytes))
+
+	tmpFile, err := ioutil.TempFile("", "metricbeat-"+service+"-secured-*.yml")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	_, err = tmpFile.WriteString(content)
+	if err != nil {
+		return "", err
+	}
+	_ = os.Chmod(tmpFile.Name(), 0666)
+
+	return tmpFile.Name(), nil
+}
+
+// waitForServiceToBeHealthy waits for a service monitored by metricbeat to be healthy, so that
+// the events are collected once it's ready. The services without healthcheck nor probe are
+// considered healthy once they are running
+func waitForServiceToBeHealthy(serviceType string) error {
+	options := services.WaitOptions{
+		Timeout: time.Duration(timeoutFactor) * time.Minute,
+	}
+
+	return serviceManager.WaitForHealthy("metricbeat", []string{serviceType}, options)
+}
+
 func (mts *MetricbeatTestSuite) thereAreEventsInTheIndex() error {
 	esQuery := map[string]interface{}{
 		"query": map[string]interface{}{
@@ -420,7 +591,17 @@ func (mts *MetricbeatTestSuite) thereAreEventsInTheIndex() error {
 	}
 
 	minimumHitsCount := 5
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute)
+
+	if !mts.StartedAt.IsZero() {
+		_, err := e2e.WaitForNumberOfHits(mts.getIndexName(), esQuery, 1, maxTimeout)
+		if err != nil {
+			return err
+		}
+
+		e2e.RecordMeasurement("time-to-first-document", time.Since(mts.StartedAt))
+		mts.StartedAt = time.Time{}
+	}
 
 	result, err := e2e.WaitForNumberOfHits(mts.getIndexName(), esQuery, minimumHitsCount, maxTimeout)
 	if err != nil {
@@ -456,7 +637,7 @@ func (mts *MetricbeatTestSuite) thereAreNoErrorsInTheIndex() error {
 	}
 
 	minimumHitsCount := 5
-	maxTimeout := time.Duration(timeoutFactor) * time.Minute
+	maxTimeout := e2e.GetWaitTimeout(e2e.DataInIndexTimeout, time.Duration(timeoutFactor)*time.Minute)
 
 	result, err := e2e.WaitForNumberOfHits(mts.getIndexName(), esQuery, minimumHitsCount, maxTimeout)
 	if err != nil {
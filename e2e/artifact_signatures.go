@@ -0,0 +1,131 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ArtifactsVerifySignaturesEnvVar the environment variable enabling the verification of the GPG
+// signatures of the packages
+const ArtifactsVerifySignaturesEnvVar = "ARTIFACTS_VERIFY_SIGNATURES"
+
+// ArtifactsGPGKeyEnvVar the environment variable with the path or the URL of the public GPG key
+// the packages are signed with
+const ArtifactsGPGKeyEnvVar = "ARTIFACTS_GPG_KEY"
+
+// elasticGPGKeyURL the URL of the public GPG key Elastic signs its packages with
+const elasticGPGKeyURL = "https://artifacts.elastic.co/GPG-KEY-elasticsearch"
+
+// verifySignatures if the GPG signatures of the packages are verified, set with the
+// --artifacts.verify-signatures flag of the suites
+var verifySignatures = false
+
+// IsSignatureVerificationEnabled returns if the downloaded packages are verified against the GPG
+// signatures published next to them, which is enabled with the --artifacts.verify-signatures flag
+// of the suites, or the ARTIFACTS_VERIFY_SIGNATURES environment variable
+func IsSignatureVerificationEnabled() bool {
+	if verifySignatures {
+		return true
+	}
+
+	enabled, err := strconv.ParseBool(curl.GetEnv(ArtifactsVerifySignaturesEnvVar, "false"))
+
+	return err == nil && enabled
+}
+
+// verifySignature checks that a downloaded file is signed with the GPG key of the artifacts, with
+// the detached signature at a URL, which uses the ASCII armored format
+func (c *ArtifactsClient) verifySignature(filePath string, signatureURL string) error {
+	keyring, err := c.getKeyring()
+	if err != nil {
+		return err
+	}
+
+	signature, err := getWithRetries(signatureURL, "Could not download the signature")
+	if err != nil {
+		return fmt.Errorf("The GPG signature of %s could not be downloaded from %s: %v", filePath, signatureURL, err)
+	}
+
+	err = artifacts.VerifySignature(keyring, filePath, signature)
+	if err != nil {
+		return fmt.Errorf("Could not verify the GPG signature at %s: %v", signatureURL, err)
+	}
+
+	return nil
+}
+
+// getKeyring returns the keyring with the public GPG key of the artifacts, which is Elastic's one
+// unless its path or URL is set in the ARTIFACTS_GPG_KEY environment variable. It's read once per run
+func (c *ArtifactsClient) getKeyring() (openpgp.EntityList, error) {
+	if c.keyring != nil {
+		return c.keyring, nil
+	}
+
+	keyLocation := curl.GetEnv(ArtifactsGPGKeyEnvVar, elasticGPGKeyURL)
+
+	var key string
+	if u, err := url.Parse(keyLocation); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		key, err = getWithRetries(keyLocation, "Could not download the GPG key")
+		if err != nil {
+			return nil, fmt.Errorf("The GPG key of the artifacts could not be downloaded from %s: %v", keyLocation, err)
+		}
+	} else {
+		content, err := ioutil.ReadFile(keyLocation)
+		if err != nil {
+			return nil, fmt.Errorf("The GPG key of the artifacts could not be read from %s: %v", keyLocation, err)
+		}
+		key = string(content)
+	}
+
+	keyring, err := artifacts.ReadKeyRing(key)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the GPG key of the artifacts at %s: %v", keyLocation, err)
+	}
+
+	log.WithFields(log.Fields{
+		"key": keyLocation,
+	}).Debug("GPG key of the artifacts read")
+
+	c.keyring = keyring
+
+	return keyring, nil
+}
+
+// getWithRetries returns the body of a URL, retrying the request for a minute
+func getWithRetries(fileURL string, message string) (string, error) {
+	exp := GetExponentialBackOff(time.Minute)
+
+	content := ""
+
+	getFn := func() error {
+		response, err := curl.Get(curl.HTTPRequest{URL: fileURL})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"url":         fileURL,
+			}).Warn(message)
+			return err
+		}
+
+		content = response
+		return nil
+	}
+
+	err := backoff.Retry(getFn, exp)
+
+	return content, err
+}
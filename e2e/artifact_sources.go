@@ -0,0 +1,197 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	backoff "github.com/cenkalti/backoff/v4"
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+	log "github.com/sirupsen/logrus"
+)
+
+// ArtifactsSourceEnvVar the environment variable selecting the source of the packages
+const ArtifactsSourceEnvVar = "ARTIFACTS_SOURCE"
+
+// ArtifactsBuildIDEnvVar the environment variable with the build of the snapshots or the staging
+// candidate the packages are downloaded from, i.e. 8.0.0-59098054
+const ArtifactsBuildIDEnvVar = "ARTIFACTS_BUILD_ID"
+
+const (
+	// APISource resolves the packages, released or snapshots, in the artifacts API
+	APISource = "api"
+	// LocalSource uses the packages in the local artifacts path, without accessing the network
+	LocalSource = "local"
+	// ReleaseSource downloads the released packages from artifacts.elastic.co
+	ReleaseSource = "release"
+	// SnapshotsSource downloads the packages of a snapshot build from snapshots.elastic.co, which is the
+	// latest one of the version unless the build is set
+	SnapshotsSource = "snapshots"
+	// StagingSource downloads the packages of a build candidate from staging.elastic.co
+	StagingSource = "staging"
+)
+
+// artifactsBuildsURL the URL of the artifacts API listing the builds of a version, the latest first
+const artifactsBuildsURL = "https://artifacts-api.elastic.co/v1/versions/%s/builds?x-elastic-no-kpi=true"
+
+// releaseDownloadsURL the URL of the downloads of the released versions
+const releaseDownloadsURL = "https://artifacts.elastic.co/downloads/"
+
+// snapshotsDownloadsURL the URL of the downloads of a snapshot build
+const snapshotsDownloadsURL = "https://snapshots.elastic.co/%s/downloads/"
+
+// stagingDownloadsURL the URL of the downloads of a build candidate
+const stagingDownloadsURL = "https://staging.elastic.co/%s/downloads/"
+
+// artifactsSource the source of the packages, set with the --artifacts.source flag of the suites
+var artifactsSource = ""
+
+// artifactsBuildID the build the packages are downloaded from, set with the --artifacts.build-id
+// flag of the suites
+var artifactsBuildID = ""
+
+// GetArtifactsSource returns the source of the packages, which is set with the --artifacts.source
+// flag of the suites, or the ARTIFACTS_SOURCE environment variable, defaulting to the artifacts API.
+// It aborts the run if the source is not supported
+func GetArtifactsSource() string {
+	source := artifactsSource
+	if source == "" {
+		source = curl.GetEnv(ArtifactsSourceEnvVar, APISource)
+	}
+
+	source = strings.ToLower(source)
+	switch source {
+	case APISource, LocalSource, ReleaseSource, SnapshotsSource, StagingSource:
+		return source
+	}
+
+	log.WithFields(log.Fields{
+		"source":    source,
+		"supported": []string{APISource, LocalSource, ReleaseSource, SnapshotsSource, StagingSource},
+	}).Fatal("The source of the artifacts is not supported, aborting")
+	return ""
+}
+
+// GetArtifactsBuildID returns the build the packages are downloaded from, which is set with the
+// --artifacts.build-id flag of the suites, or the ARTIFACTS_BUILD_ID environment variable
+func GetArtifactsBuildID() string {
+	if artifactsBuildID != "" {
+		return artifactsBuildID
+	}
+
+	return curl.GetEnv(ArtifactsBuildIDEnvVar, "")
+}
+
+// GetBeatsFileURL returns the URL of a file of the Beats repository, i.e. the configuration file
+// of a Beat, at the ref of a version: the master branch for the snapshots and the pull requests,
+// and the tag of the released versions, i.e. v7.10.2. The ref can be set with the BEATS_GIT_REF
+// environment variable, i.e. to the branch of a pull request. The file is looked up in the local
+// artifacts path when it's downloaded
+// i.e. GetBeatsFileURL("8.0.0-SNAPSHOT", "x-pack/elastic-agent/elastic-agent.docker.yml")
+func GetBeatsFileURL(version string, filePath string) string {
+	ref := "master"
+	if _, released := artifacts.ParseReleaseVersion(version, false); released {
+		ref = "v" + version
+	}
+
+	return beatsRawContentPrefix + curl.GetEnv("BEATS_GIT_REF", ref) + "/" + strings.TrimPrefix(filePath, "/")
+}
+
+// resolvePackageInSource returns the URLs of a package and of its SHA-512 checksum in the downloads
+// of the source of the artifacts, which publishes the packages of the Beats and the Elastic Agent
+// under their beats/<name> dir
+func (c *ArtifactsClient) resolvePackageInSource(source string, pkg Package) (string, string, error) {
+	var downloadsURL string
+	switch source {
+	case LocalSource:
+		return "", "", fmt.Errorf("The %s package is not in the local artifacts path, and the %s source does not download it", pkg.FileName(), source)
+	case ReleaseSource:
+		downloadsURL = releaseDownloadsURL
+	case SnapshotsSource:
+		buildID := GetArtifactsBuildID()
+		if buildID == "" {
+			var err error
+			buildID, err = c.resolveLatestBuild(pkg.Version)
+			if err != nil {
+				return "", "", err
+			}
+		}
+		downloadsURL = fmt.Sprintf(snapshotsDownloadsURL, buildID)
+	case StagingSource:
+		buildID := GetArtifactsBuildID()
+		if buildID == "" {
+			return "", "", fmt.Errorf("The build of the %s source must be set with the --artifacts.build-id flag or the %s environment variable, i.e. 7.12.0-2a8c4f3b", source, ArtifactsBuildIDEnvVar)
+		}
+		downloadsURL = fmt.Sprintf(stagingDownloadsURL, buildID)
+	default:
+		return "", "", fmt.Errorf("The %s source of the artifacts is not supported", source)
+	}
+
+	fileURL := downloadsURL + "beats/" + pkg.Name + "/" + pkg.FileName()
+
+	log.WithFields(log.Fields{
+		"source": source,
+		"url":    fileURL,
+	}).Debug("Package resolved in the source of the artifacts")
+
+	return fileURL, fileURL + ".sha512", nil
+}
+
+// resolveLatestBuild returns the latest build of a version in the artifacts API, i.e. 8.0.0-59098054
+func (c *ArtifactsClient) resolveLatestBuild(version string) (string, error) {
+	exp := GetExponentialBackOff(time.Minute)
+
+	body := ""
+
+	apiStatus := func() error {
+		response, err := curl.Get(curl.HTTPRequest{URL: fmt.Sprintf(artifactsBuildsURL, version)})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"version":     version,
+			}).Warn("The Elastic artifacts API is not available yet")
+			return err
+		}
+
+		body = response
+		return nil
+	}
+
+	err := backoff.Retry(apiStatus, exp)
+	if err != nil {
+		return "", err
+	}
+
+	jsonParsed, err := gabs.ParseJSON([]byte(body))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"version": version,
+		}).Error("Could not parse the response body for the builds")
+		return "", err
+	}
+
+	builds := jsonParsed.Path("builds").Children()
+	if len(builds) == 0 {
+		return "", fmt.Errorf("The artifacts API did not list any build of the %s version", version)
+	}
+
+	buildID, ok := builds[0].Data().(string)
+	if !ok {
+		return "", fmt.Errorf("The artifacts API listed an invalid build of the %s version", version)
+	}
+
+	log.WithFields(log.Fields{
+		"buildID": buildID,
+		"version": version,
+	}).Debug("Latest build of the version resolved")
+
+	return buildID, nil
+}
@@ -0,0 +1,359 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRecordedExchanges number of HTTP requests kept for the running step, as the steps
+// waiting for a condition could execute lots of them
+const maxRecordedExchanges = 50
+
+// maxRecordedResponseSize size of the response bodies written to the bundle
+const maxRecordedResponseSize = 64 * 1024
+
+// ArtifactCollector collects the artifacts of a failed scenario into the bundle dir
+type ArtifactCollector func(bundleDir string) error
+
+// stepRecorder keeps the HTTP requests executed by the running step
+type stepRecorder struct {
+	exchanges []shell.HTTPExchange
+	failed    bool
+	mutex     sync.Mutex
+	step      string
+}
+
+var recorder = &stepRecorder{}
+
+var observeHTTPOnce sync.Once
+
+// record stores an HTTP request executed by the running step
+func (r *stepRecorder) record(exchange shell.HTTPExchange) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// the requests executed after the failed step belong to the clean up
+	if r.failed {
+		return
+	}
+
+	r.exchanges = append(r.exchanges, exchange)
+	if len(r.exchanges) > maxRecordedExchanges {
+		r.exchanges = r.exchanges[len(r.exchanges)-maxRecordedExchanges:]
+	}
+}
+
+// RegisterFailureArtifacts adds hooks to the suite that assemble a bundle of artifacts under
+// the outputs dir of a scenario when it fails: the containers of the docker-compose projects
+// and their logs, the HTTP requests executed by the failed step, the diagnostics of the indices
+// it searched, the persisted state of the tool, and the artifacts gathered by the collectors of
+// the suite. It must be called before
+// registering the hooks that clean up the scenarios, so that the bundle is assembled first
+func RegisterFailureArtifacts(s *godog.ScenarioContext, collectors ...ArtifactCollector) {
+	observeHTTPOnce.Do(func() {
+		shell.AddHTTPObserver(recorder.record)
+	})
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+
+		recorder.exchanges = []shell.HTTPExchange{}
+		recorder.failed = false
+		recorder.step = ""
+
+		return ctx, nil
+	})
+
+	s.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+
+		// keep the failed step, as the steps after it are skipped
+		if !recorder.failed {
+			recorder.exchanges = []shell.HTTPExchange{}
+			recorder.step = step.Text
+		}
+
+		return ctx, nil
+	})
+
+	s.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+
+		if status == godog.StepFailed {
+			recorder.failed = true
+		}
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		if err == nil {
+			return ctx, nil
+		}
+
+		bundleDir, dirErr := GetScenarioOutputsDir(pickle.Name)
+		if dirErr != nil {
+			return ctx, nil
+		}
+
+		recorder.mutex.Lock()
+		step := recorder.step
+		exchanges := recorder.exchanges
+		recorder.mutex.Unlock()
+
+		log.WithFields(log.Fields{
+			"dir":      bundleDir,
+			"scenario": pickle.Name,
+		}).Info("The scenario failed, assembling its artifacts bundle")
+
+		writeFailureSummary(bundleDir, pickle, step, err)
+		writeHTTPExchanges(bundleDir, exchanges)
+		writeStateFiles(bundleDir)
+		running := writeComposeArtifacts(bundleDir)
+		writeStackStatus(bundleDir, running)
+		if running["elasticsearch"] {
+			writeIndexDiagnostics(bundleDir, searchedIndices(exchanges))
+		}
+
+		for _, collector := range collectors {
+			collectorErr := collector(bundleDir)
+			if collectorErr != nil {
+				log.WithFields(log.Fields{
+					"dir":      bundleDir,
+					"error":    collectorErr,
+					"scenario": pickle.Name,
+				}).Warn("Could not collect the artifacts of the suite")
+			}
+		}
+
+		return ctx, nil
+	})
+}
+
+// WriteArtifact writes the content of an artifact into a file of the bundle dir
+func WriteArtifact(bundleDir string, fileName string, content string) error {
+	filePath := filepath.Join(bundleDir, fileName)
+
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Warn("Could not create the dir of the artifact")
+		return err
+	}
+
+	err = ioutil.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Warn("Could not write the artifact")
+		return err
+	}
+
+	return nil
+}
+
+// getComposeProjects returns the docker-compose projects run by the tool, reading them from the
+// state files in the workspace, i.e. "fleet-profile.run" belongs to the "fleet" project
+func getComposeProjects() []string {
+	stateFiles := getStateFiles()
+
+	projects := []string{}
+	for _, stateFile := range stateFiles {
+		name := strings.TrimSuffix(filepath.Base(stateFile), ".run")
+		name = strings.TrimSuffix(name, "-profile")
+		name = strings.TrimSuffix(name, "-service")
+
+		projects = append(projects, config.GetComposeProjectName(name))
+	}
+
+	return projects
+}
+
+// getStateFiles returns the state files of the tool in the workspace
+func getStateFiles() []string {
+	if config.Op == nil {
+		return []string{}
+	}
+
+	stateDir := config.GetStateDir()
+
+	stateFiles, err := filepath.Glob(filepath.Join(stateDir, "*.run"))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"dir":   stateDir,
+		}).Warn("Could not find the state files in the workspace")
+		return []string{}
+	}
+
+	return stateFiles
+}
+
+// truncate cuts a text to a maximum size
+func truncate(text string, size int) string {
+	if len(text) <= size {
+		return text
+	}
+
+	return text[:size] + fmt.Sprintf("\n... (%d bytes truncated)", len(text)-size)
+}
+
+// writeComposeArtifacts writes the status of the containers of the docker-compose projects,
+// in the same manner "docker-compose ps" does, and the logs of each container. It returns the
+// services of the running containers
+func writeComposeArtifacts(bundleDir string) map[string]bool {
+	running := map[string]bool{}
+
+	var ps strings.Builder
+
+	w := tabwriter.NewWriter(&ps, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tNAME\tIMAGE\tSTATE\tSTATUS")
+
+	for _, project := range getComposeProjects() {
+		containers, err := docker.ListComposeContainers(project)
+		if err != nil {
+			continue
+		}
+
+		for _, container := range containers {
+			name := container.ID[:12]
+			if len(container.Names) > 0 {
+				name = strings.TrimPrefix(container.Names[0], "/")
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", project, name, container.Image, container.State, container.Status)
+
+			if container.State == "running" {
+				running[container.Labels["com.docker.compose.service"]] = true
+			}
+
+			// the scenario context could be already done
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			logs, err := docker.GetContainerLogs(ctx, container.ID)
+			cancel()
+			if err != nil {
+				continue
+			}
+
+			_ = WriteArtifact(bundleDir, filepath.Join("logs", name+".log"), logs)
+		}
+	}
+
+	_ = w.Flush()
+
+	_ = WriteArtifact(bundleDir, "compose-ps.txt", ps.String())
+
+	return running
+}
+
+// writeFailureSummary writes the scenario, the failed step, the error and the ID of the run into
+// the bundle dir
+func writeFailureSummary(bundleDir string, pickle *godog.Scenario, step string, err error) {
+	summary := fmt.Sprintf("Scenario: %s\nLocation: %s\nStep: %s\nError: %v\nTime: %s\nRun: %s\n",
+		pickle.Name, getScenarioLocation(pickle), step, err, time.Now().UTC().Format(time.RFC3339), config.GetRunID())
+
+	_ = WriteArtifact(bundleDir, "failure.txt", summary)
+}
+
+// writeHTTPExchanges writes the HTTP requests executed by the failed step into the bundle dir,
+// which include the ones to Kibana and Elasticsearch
+func writeHTTPExchanges(bundleDir string, exchanges []shell.HTTPExchange) {
+	var content strings.Builder
+
+	for _, exchange := range exchanges {
+		fmt.Fprintf(&content, "%s %s %s\n", exchange.StartedAt.UTC().Format(time.RFC3339Nano), exchange.Method, exchange.URL)
+		fmt.Fprintf(&content, "Status: %d (%s)\n", exchange.StatusCode, exchange.Duration)
+		if exchange.Error != "" {
+			fmt.Fprintf(&content, "Error: %s\n", exchange.Error)
+		}
+		if exchange.Payload != "" {
+			fmt.Fprintf(&content, "Payload:\n%s\n", truncate(exchange.Payload, maxRecordedResponseSize))
+		}
+		fmt.Fprintf(&content, "Response:\n%s\n\n", truncate(exchange.Response, maxRecordedResponseSize))
+	}
+
+	_ = WriteArtifact(bundleDir, "http-requests.log", content.String())
+}
+
+// writeStackStatus writes the health and the indices of Elasticsearch, and the status of Kibana
+// and its plugins, into the stack dir of the bundle, for the ones run by the docker-compose projects
+func writeStackStatus(bundleDir string, running map[string]bool) {
+	if running["elasticsearch"] {
+		esClient, err := getElasticsearchClient()
+		if err == nil {
+			// the scenario context could be already done
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			res, err := esClient.Cluster.Health(esClient.Cluster.Health.WithContext(ctx), esClient.Cluster.Health.WithPretty())
+			if err == nil {
+				writeResponseArtifact(bundleDir, filepath.Join("stack", "elasticsearch-health.json"), res.Body)
+			}
+
+			res, err = esClient.Cat.Indices(esClient.Cat.Indices.WithContext(ctx), esClient.Cat.Indices.WithV(true))
+			if err == nil {
+				writeResponseArtifact(bundleDir, filepath.Join("stack", "elasticsearch-indices.txt"), res.Body)
+			}
+		}
+	}
+
+	if running["kibana"] {
+		status, err := kibana.NewClient().GetStatus()
+		if err == nil {
+			_ = WriteArtifact(bundleDir, filepath.Join("stack", "kibana-status.json"), string(status))
+		}
+	}
+}
+
+// writeResponseArtifact writes the body of a response into a file of the bundle dir, closing it
+func writeResponseArtifact(bundleDir string, fileName string, body io.ReadCloser) {
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return
+	}
+
+	_ = WriteArtifact(bundleDir, fileName, string(content))
+}
+
+// writeStateFiles copies the persisted state of the tool into the bundle dir
+func writeStateFiles(bundleDir string) {
+	for _, stateFile := range getStateFiles() {
+		content, err := ioutil.ReadFile(stateFile)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  stateFile,
+			}).Warn("Could not read the state file")
+			continue
+		}
+
+		_ = WriteArtifact(bundleDir, filepath.Join("state", filepath.Base(stateFile)), string(content))
+	}
+}
@@ -0,0 +1,394 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// artifactsSearchURL the URL of the artifacts API to search for the packages of a version
+const artifactsSearchURL = "https://artifacts-api.elastic.co/v1/search/%s/%s?x-elastic-no-kpi=true"
+
+// artifactsVersionsURL the URL of the artifacts API listing the versions, released or not
+const artifactsVersionsURL = "https://artifacts-api.elastic.co/v1/versions?x-elastic-no-kpi=true"
+
+// Package the coordinates of a package of a Beat or the Elastic Agent
+type Package struct {
+	Arch      string // the architecture, i.e. x86_64 or amd64
+	Extension string // the format, i.e. tar.gz, rpm or deb
+	Name      string // the name of the artifact, i.e. elastic-agent
+	OS        string // the operative system, i.e. linux
+	Version   string // the version, i.e. 8.0.0-SNAPSHOT
+}
+
+// FileName returns the name of the file of the package, which does not include the
+// operative system for the deb and rpm formats
+// i.e. elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz
+// i.e. elastic-agent-8.0.0-SNAPSHOT-x86_64.rpm
+// i.e. elastic-agent-8.0.0-SNAPSHOT-amd64.deb
+func (p Package) FileName() string {
+	if p.Extension == "deb" || p.Extension == "rpm" {
+		return fmt.Sprintf("%s-%s-%s.%s", p.Name, p.Version, p.Arch, p.Extension)
+	}
+
+	return fmt.Sprintf("%s-%s-%s-%s.%s", p.Name, p.Version, p.OS, p.Arch, p.Extension)
+}
+
+// ArtifactsClient downloads the packages of the Beats and the Elastic Agent, verifying their
+// SHA-512 checksums, and optionally their GPG signatures, and caching them in the workspace of the
+// tool across test runs
+type ArtifactsClient struct {
+	cacheDir  string             // the dir where the downloads are cached
+	downloads map[string]string  // the verified downloads of the current run, by URL
+	keyring   openpgp.EntityList // the public GPG key of the artifacts, read on the first verification
+	mutex     sync.Mutex
+}
+
+var artifactsClient *ArtifactsClient
+var artifactsClientOnce sync.Once
+
+// GetArtifactsClient returns the artifacts client, caching the downloads under the "downloads"
+// dir of the workspace of the tool
+func GetArtifactsClient() *ArtifactsClient {
+	artifactsClientOnce.Do(func() {
+		cacheDir := filepath.Join(os.TempDir(), "op-downloads")
+		if config.Op != nil {
+			cacheDir = filepath.Join(config.Op.Workspace, "downloads")
+		}
+
+		artifactsClient = NewArtifactsClient(cacheDir)
+	})
+
+	return artifactsClient
+}
+
+// NewArtifactsClient returns an artifacts client caching the downloads in a dir
+func NewArtifactsClient(cacheDir string) *ArtifactsClient {
+	return &ArtifactsClient{
+		cacheDir:  cacheDir,
+		downloads: map[string]string{},
+	}
+}
+
+// Download downloads a file, returning its path. When the URL of its SHA-512 checksum is not empty,
+// the file is verified against it, and reused from the cache if it was already downloaded. Otherwise,
+// it's reused from the cache for the TTL of the cache, and while the server serves the same version
+// of it. The cached files are downloaded again with the --refresh flag of the suites. When the
+// verification of the signatures is enabled, the file is also verified against the GPG signature
+// published next to it, failing if it has none
+func (c *ArtifactsClient) Download(fileURL string, checksumURL string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if filePath, exists := c.downloads[fileURL]; exists {
+		log.WithFields(log.Fields{
+			"path": filePath,
+			"url":  fileURL,
+		}).Debug("Retrieving the file from the downloads of the current run")
+		return filePath, nil
+	}
+
+	if localPath, exists := findLocalFile(fileURL); exists {
+		log.WithFields(log.Fields{
+			"path": localPath,
+			"url":  fileURL,
+		}).Info("Using the local artifact instead of downloading it")
+		c.downloads[fileURL] = localPath
+		return localPath, nil
+	}
+
+	filePath := c.getCachePath(fileURL)
+
+	checksum := ""
+	if checksumURL != "" {
+		var err error
+		checksum, err = getChecksum(checksumURL)
+		if err != nil {
+			return "", err
+		}
+
+		if !IsDownloadCacheRefreshed() && artifacts.VerifyChecksum(filePath, checksum) == nil {
+			log.WithFields(log.Fields{
+				"path": filePath,
+				"url":  fileURL,
+			}).Info("Retrieving the file from the cache, as its checksum matches")
+
+			err = c.verifyDownloadSignature(filePath, fileURL)
+			if err != nil {
+				return "", err
+			}
+
+			c.downloads[fileURL] = filePath
+			return filePath, nil
+		}
+	}
+
+	if checksum == "" {
+		log.WithFields(log.Fields{
+			"path": filePath,
+			"url":  fileURL,
+		}).Debug("There is no checksum for the file, so it's not verified, and it's cached for the TTL of the cache")
+
+		err := c.downloadCached(fileURL, filePath)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		err := artifacts.DownloadTo(fileURL, filePath, getDownloadOptions())
+		if err != nil {
+			return "", err
+		}
+
+		err = artifacts.VerifyChecksum(filePath, checksum)
+		if err != nil {
+			_ = os.Remove(filePath)
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  filePath,
+				"url":   fileURL,
+			}).Error("The checksum of the downloaded file does not match")
+			return "", err
+		}
+	}
+
+	err := c.verifyDownloadSignature(filePath, fileURL)
+	if err != nil {
+		return "", err
+	}
+
+	c.downloads[fileURL] = filePath
+
+	return filePath, nil
+}
+
+// DownloadPackage resolves a package in the source of the artifacts, downloading it. A package
+// in the local artifacts path is used instead, without accessing the network
+func (c *ArtifactsClient) DownloadPackage(pkg Package) (string, error) {
+	if localPath, exists := FindLocalArtifact(pkg.FileName()); exists {
+		log.WithFields(log.Fields{
+			"path": localPath,
+		}).Info("Using the local package")
+		return localPath, nil
+	}
+
+	fileURL, checksumURL, err := c.ResolvePackage(pkg)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Download(fileURL, checksumURL)
+}
+
+// ResolvePackage returns the URLs of a package and of its SHA-512 checksum in the source of the
+// artifacts, which is the artifacts API unless another one is selected
+func (c *ArtifactsClient) ResolvePackage(pkg Package) (string, string, error) {
+	source := GetArtifactsSource()
+	if source != APISource {
+		return c.resolvePackageInSource(source, pkg)
+	}
+
+	return c.resolvePackageInAPI(pkg)
+}
+
+// resolvePackageInAPI returns the URLs of a package and of its SHA-512 checksum in the artifacts API,
+// which serves both the released versions and the snapshots
+func (c *ArtifactsClient) resolvePackageInAPI(pkg Package) (string, string, error) {
+	exp := GetExponentialBackOff(time.Minute)
+
+	retryCount := 1
+
+	body := ""
+
+	apiStatus := func() error {
+		r := curl.HTTPRequest{
+			URL: fmt.Sprintf(artifactsSearchURL, pkg.Version, pkg.Name),
+		}
+
+		response, err := curl.Get(r)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"artifact":       pkg.Name,
+				"version":        pkg.Version,
+				"os":             pkg.OS,
+				"arch":           pkg.Arch,
+				"extension":      pkg.Extension,
+				"error":          err,
+				"retry":          retryCount,
+				"statusEndpoint": r.URL,
+				"elapsedTime":    exp.GetElapsedTime(),
+			}).Warn("The Elastic artifacts API is not available yet")
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"retries":        retryCount,
+			"statusEndpoint": r.URL,
+			"elapsedTime":    exp.GetElapsedTime(),
+		}).Debug("The Elastic artifacts API is available")
+
+		body = response
+		return nil
+	}
+
+	err := backoff.Retry(apiStatus, exp)
+	if err != nil {
+		return "", "", err
+	}
+
+	jsonParsed, err := gabs.ParseJSON([]byte(body))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"artifact":  pkg.Name,
+			"version":   pkg.Version,
+			"os":        pkg.OS,
+			"arch":      pkg.Arch,
+			"extension": pkg.Extension,
+		}).Error("Could not parse the response body for the artifact")
+		return "", "", err
+	}
+
+	// we need to get keys with dots using Search instead of Path
+	packageObject := jsonParsed.Path("packages").Search(pkg.FileName())
+
+	fileURL, ok := packageObject.Path("url").Data().(string)
+	if !ok {
+		return "", "", fmt.Errorf("The %s package was not found in the artifacts API", pkg.FileName())
+	}
+
+	checksumURL, _ := packageObject.Path("sha_url").Data().(string)
+
+	return fileURL, checksumURL, nil
+}
+
+// ListVersions returns the versions served by the artifacts API, the released ones and the
+// snapshots, i.e. 7.10.2 or 8.0.0-SNAPSHOT
+func (c *ArtifactsClient) ListVersions() ([]string, error) {
+	exp := GetExponentialBackOff(time.Minute)
+
+	body := ""
+
+	apiStatus := func() error {
+		response, err := curl.Get(curl.HTTPRequest{URL: artifactsVersionsURL})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":          err,
+				"statusEndpoint": artifactsVersionsURL,
+				"elapsedTime":    exp.GetElapsedTime(),
+			}).Warn("The Elastic artifacts API is not available yet")
+			return err
+		}
+
+		body = response
+		return nil
+	}
+
+	err := backoff.Retry(apiStatus, exp)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonParsed, err := gabs.ParseJSON([]byte(body))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not parse the response body for the versions")
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, child := range jsonParsed.Path("versions").Children() {
+		if version, ok := child.Data().(string); ok {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("The artifacts API did not list any version")
+	}
+
+	return versions, nil
+}
+
+// ResolvePreviousVersion returns the latest release of the N-th minor version before a version,
+// as listed by the artifacts API, i.e. 7.10.2 is the N-1 version of 7.11.0-SNAPSHOT, and the
+// latest 7.x release is the N-1 version of 8.0.0
+func (c *ArtifactsClient) ResolvePreviousVersion(version string, previous int) (string, error) {
+	versions, err := c.ListVersions()
+	if err != nil {
+		return "", err
+	}
+
+	previousVersion, err := artifacts.PreviousMinorVersion(versions, version, previous)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithFields(log.Fields{
+		"previous":        previous,
+		"previousVersion": previousVersion,
+		"version":         version,
+	}).Debug("Previous version resolved")
+
+	return previousVersion, nil
+}
+
+// verifyDownloadSignature verifies a downloaded file against its GPG signature when the verification
+// of the signatures is enabled, removing the file if it's not valid, so that it's downloaded again
+// in the next runs
+func (c *ArtifactsClient) verifyDownloadSignature(filePath string, fileURL string) error {
+	if !IsSignatureVerificationEnabled() {
+		return nil
+	}
+
+	err := c.verifySignature(filePath, artifacts.SignatureURL(fileURL))
+	if err != nil {
+		_ = os.Remove(filePath)
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+			"url":   fileURL,
+		}).Error("The signature of the downloaded file could not be verified")
+		return err
+	}
+
+	return nil
+}
+
+// getCachePath returns the path where a file is cached, which is namespaced by its URL,
+// as different builds of a snapshot share the name of the file
+func (c *ArtifactsClient) getCachePath(fileURL string) string {
+	return artifacts.CachePath(c.cacheDir, fileURL)
+}
+
+// getChecksum returns the SHA-512 checksum stored in a file, using the "checksum  file-name" format
+func getChecksum(checksumURL string) (string, error) {
+	content, err := getWithRetries(checksumURL, "Could not download the checksum")
+	if err != nil {
+		return "", fmt.Errorf("The checksum could not be downloaded from %s: %v", checksumURL, err)
+	}
+
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("The checksum file at %s is empty", checksumURL)
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
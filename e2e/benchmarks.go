@@ -0,0 +1,152 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/benchmarks"
+	log "github.com/sirupsen/logrus"
+)
+
+// benchmarksFileName name of the file where the measurements are stored, one line per measurement:
+// time, iteration, name and milliseconds
+const benchmarksFileName = "benchmarks.tsv"
+
+// benchmarksReportFileName name of the file where the statistics of the measurements are written
+const benchmarksReportFileName = "benchmarks-report.txt"
+
+// sloViolationsFileName name of the file where the SLOs exceeded by the measurements are written
+const sloViolationsFileName = "slo-violations.txt"
+
+// GetBenchmarkIteration returns the iteration of the benchmark run, read from the BENCHMARK_ITERATION
+// environment variable. It returns 0 when the scenarios are not run in benchmark mode
+func GetBenchmarkIteration() int {
+	return shell.GetEnvInteger("BENCHMARK_ITERATION", 0)
+}
+
+// GetSLOs returns the SLOs of the benchmark run, read from the BENCHMARK_SLOS environment variable,
+// i.e. "enrollment:p95=60s,time-to-first-document:max=2m"
+func GetSLOs() ([]benchmarks.SLO, error) {
+	return benchmarks.ParseSLOs(shell.GetEnv("BENCHMARK_SLOS", ""))
+}
+
+// RecordMeasurement stores the measurement of a key duration, i.e. the enrollment of an agent,
+// so that its statistics across the iterations of a benchmark run can be calculated
+func RecordMeasurement(name string, duration time.Duration) {
+	log.WithFields(log.Fields{
+		"duration": duration,
+		"name":     name,
+	}).Info("Measurement recorded")
+
+	_ = appendToOutputsFile(benchmarksFileName, fmt.Sprintf("%s\t%d\t%s\t%d",
+		time.Now().UTC().Format(time.RFC3339), GetBenchmarkIteration(), name, duration.Milliseconds()))
+}
+
+// RegisterBenchmarks adds an after-suite hook that, in the last iteration of a benchmark run, writes
+// the statistics of the measurements into the outputs dir, checking them against the SLOs
+func RegisterBenchmarks(s *godog.TestSuiteContext) {
+	iteration := GetBenchmarkIteration()
+	if iteration == 0 || iteration != shell.GetEnvInteger("BENCHMARK_ITERATIONS", 0) {
+		return
+	}
+
+	s.AfterSuite(func() {
+		_ = WriteBenchmarksReport()
+	})
+}
+
+// WriteBenchmarksReport writes the statistics of the measurements into the outputs dir, and the SLOs
+// exceeded by them, if any
+func WriteBenchmarksReport() error {
+	slos, err := GetSLOs()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not parse the SLOs")
+
+		// the run must fail, as the SLOs cannot be checked
+		_ = WriteArtifact(GetOutputsDir(), sloViolationsFileName, err.Error()+"\n")
+		return err
+	}
+
+	measurements, err := readMeasurements()
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name := range measurements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var report strings.Builder
+
+	w := tabwriter.NewWriter(&report, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCOUNT\tMIN\tMEAN\tP50\tP90\tP95\tP99\tMAX")
+
+	stats := map[string]benchmarks.Stats{}
+	for _, name := range names {
+		bs := benchmarks.Calculate(name, measurements[name])
+		stats[name] = bs
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, bs.Count,
+			bs.Min, bs.Mean, bs.P50, bs.P90, bs.P95, bs.P99, bs.Max)
+	}
+	_ = w.Flush()
+
+	violations := benchmarks.CheckSLOs(stats, slos)
+
+	outputsDir := GetOutputsDir()
+
+	err = WriteArtifact(outputsDir, benchmarksReportFileName, report.String())
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"file": filepath.Join(outputsDir, benchmarksReportFileName),
+	}).Info("Benchmarks report written:\n" + report.String())
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"violations": violations,
+	}).Error("The measurements exceeded the SLOs")
+
+	return WriteArtifact(outputsDir, sloViolationsFileName, strings.Join(violations, "\n")+"\n")
+}
+
+// readMeasurements reads the measurements stored in the outputs dir, by name
+func readMeasurements() (map[string][]time.Duration, error) {
+	measurements := map[string][]time.Duration{}
+
+	filePath := filepath.Join(GetOutputsDir(), benchmarksFileName)
+
+	f, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return measurements, nil
+	} else if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Error("Could not open the measurements file")
+		return nil, err
+	}
+	defer f.Close()
+
+	return benchmarks.ReadMeasurements(f)
+}
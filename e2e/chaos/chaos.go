@@ -0,0 +1,660 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/docker/docker/api/types/network"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultImage image used to alter the network of the services, as it bundles both tc and iptables.
+// It can be overriden by CHAOS_IMAGE env var
+const defaultImage = "nicolaka/netshoot"
+
+// networkInterface interface of the containers where the network faults are injected
+const networkInterface = "eth0"
+
+// dnsRules iptables rules dropping the DNS queries, both to the embedded DNS server of Docker,
+// which is reached at 127.0.0.11 on a random port, and to any other DNS server
+var dnsRules = [][]string{
+	{"OUTPUT", "-d", "127.0.0.11", "-j", "DROP"},
+	{"OUTPUT", "-p", "udp", "--dport", "53", "-j", "DROP"},
+	{"OUTPUT", "-p", "tcp", "--dport", "53", "-j", "DROP"},
+}
+
+// partitionRules iptables rules dropping the packets exchanged with an address, so that a service
+// is partitioned from another one
+func partitionRules(address string) [][]string {
+	return [][]string{
+		{"OUTPUT", "-d", address, "-j", "DROP"},
+		{"INPUT", "-s", address, "-j", "DROP"},
+	}
+}
+
+// serviceFaults the faults injected into the network of a service
+type serviceFaults struct {
+	aliases     bool                                 // if the aliases of the service were replaced
+	container   string                               // the container of the service
+	diskFills   []string                             // the files filling the disk of the service
+	dns         bool                                 // if the DNS queries are dropped
+	ioThrottles []string                             // the paths whose disk IO is throttled
+	latency     string                               // the delay added to the packets, i.e. 500ms
+	loss        string                               // the percentage of packets dropped, i.e. 20%
+	networks    map[string]*network.EndpointSettings // the networks the service was disconnected from
+	partitions  map[string][]string                  // the addresses of the services it cannot reach, by service
+	timers      []*time.Timer                        // the timers removing the faults injected for a while
+}
+
+// netem returns the arguments of the netem queueing discipline emulating the faults
+func (f *serviceFaults) netem() []string {
+	args := []string{}
+	if f.latency != "" {
+		args = append(args, "delay", f.latency)
+	}
+	if f.loss != "" {
+		args = append(args, "loss", f.loss)
+	}
+
+	return args
+}
+
+// Injector injects faults into the services of a docker-compose profile, keeping track of them
+// so that they are removed when the scenario finishes
+type Injector struct {
+	faults         map[string]*serviceFaults // the faults by service name
+	mutex          sync.Mutex
+	profile        string // the docker-compose profile where the services run
+	serviceManager services.ServiceManager
+}
+
+// NewInjector returns an injector of faults into the services of a profile
+func NewInjector(profile string) *Injector {
+	return &Injector{
+		faults:         map[string]*serviceFaults{},
+		profile:        profile,
+		serviceManager: services.NewServiceManager(),
+	}
+}
+
+// RegisterSteps adds the chaos steps to the suite, which inject faults into the services of a
+// docker-compose profile, and hooks removing the faults at the end of each scenario, or when
+// the run is interrupted
+func RegisterSteps(s *godog.ScenarioContext, profile string) *Injector {
+	injector := NewInjector(profile)
+
+	e2e.Step(s, `^the "([^"]*)" service has a latency of "([^"]*)"$`, injector.AddLatency)
+	e2e.Step(s, `^the "([^"]*)" service loses "([^"]*)" of the packets$`, injector.AddPacketLoss)
+	e2e.Step(s, `^the "([^"]*)" service cannot resolve DNS names$`, injector.BreakDNS)
+	e2e.Step(s, `^the "([^"]*)" service is not resolvable by its name$`, injector.HideService)
+	e2e.Step(s, `^the "([^"]*)" service is resolvable as "([^"]*)"$`, injector.SetAliases)
+	e2e.Step(s, `^the "([^"]*)" service is disconnected from the network(?: for "([^"]*)")?$`, injector.Disconnect)
+	e2e.Step(s, `^the "([^"]*)" service loses connectivity to the "([^"]*)" service(?: for "([^"]*)")?$`, injector.Partition)
+	e2e.Step(s, `^the "([^"]*)" service recovers connectivity to the "([^"]*)" service$`, injector.RemovePartition)
+	e2e.Step(s, `^the "([^"]*)" service is killed$`, injector.KillService)
+	e2e.Step(s, `^the "([^"]*)" service fills "([^"]*)" of the disk of "([^"]*)"$`, injector.FillDisk)
+	e2e.Step(s, `^the Elasticsearch node of the "([^"]*)" service runs out of disk$`, injector.RunOutOfDisk)
+	e2e.Step(s, `^the Elasticsearch node runs out of disk$`, func() error {
+		return injector.RunOutOfDisk("elasticsearch")
+	})
+	e2e.Step(s, `^the disk IO of the "([^"]*)" service is throttled to "([^"]*)" in "([^"]*)"$`, injector.ThrottleDiskIO)
+	e2e.Step(s, `^the "([^"]*)" process is killed in the "([^"]*)" service$`, injector.KillProcess)
+	e2e.Step(s, `^the faults in the "([^"]*)" service are removed$`, injector.RemoveFaults)
+
+	var cleanup *e2e.Cleanup
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		// the faults are removed if the run is interrupted, as the services could be kept
+		cleanup = e2e.RegisterCleanup("chaos faults: "+pickle.Name, func() error {
+			injector.RemoveAllFaults()
+			return nil
+		})
+		return ctx, nil
+	})
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		if cleanup != nil {
+			_ = cleanup.Run()
+		}
+		return ctx, nil
+	})
+
+	return injector
+}
+
+// AddLatency delays the packets sent by a service, i.e. 500ms
+func (i *Injector) AddLatency(service string, latency string) error {
+	_, err := time.ParseDuration(latency)
+	if err != nil {
+		return fmt.Errorf("The latency is not a valid duration: %s - %v", latency, err)
+	}
+
+	return i.updateNetem(service, func(f *serviceFaults) {
+		f.latency = latency
+	})
+}
+
+// AddPacketLoss drops a percentage of the packets sent by a service, i.e. 20%
+func (i *Injector) AddPacketLoss(service string, loss string) error {
+	if !strings.HasSuffix(loss, "%") {
+		loss += "%"
+	}
+
+	return i.updateNetem(service, func(f *serviceFaults) {
+		f.loss = loss
+	})
+}
+
+// BreakDNS drops the DNS queries of a service, so that it cannot resolve the names of the hosts
+func (i *Injector) BreakDNS(service string) error {
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if faults.dns {
+		return nil
+	}
+
+	for _, rule := range dnsRules {
+		_, err := runInNetwork(faults.container, append([]string{"iptables", "-I"}, rule...))
+		if err != nil {
+			return err
+		}
+	}
+
+	faults.dns = true
+
+	log.WithFields(log.Fields{
+		"profile": i.profile,
+		"service": service,
+	}).Info("The DNS queries of the service are dropped")
+
+	return nil
+}
+
+// Disconnect disconnects the container of a service from its networks, so that it cannot reach any
+// other service, nor be reached. If a duration is set, i.e. 2m, the service is connected back once it
+// elapses, otherwise when the faults are removed
+func (i *Injector) Disconnect(service string, duration string) error {
+	timeout, err := parseFaultDuration(duration)
+	if err != nil {
+		return err
+	}
+
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if len(faults.networks) == 0 {
+		networks, err := docker.DisconnectContainerFromNetworks(e2e.ScenarioContext(), faults.container)
+		// the networks already disconnected are connected back with the rest of the faults
+		faults.networks = networks
+		if err != nil {
+			return err
+		}
+
+		// the network faults went away with the interface
+		faults.latency = ""
+		faults.loss = ""
+
+		log.WithFields(log.Fields{
+			"duration": duration,
+			"profile":  i.profile,
+			"service":  service,
+		}).Info("The service was disconnected from the network")
+	}
+
+	if timeout > 0 {
+		i.removeAfter(service, faults, timeout, func(ctx context.Context) error {
+			return i.reconnect(ctx, service, faults)
+		})
+	}
+
+	return nil
+}
+
+// HideService removes the aliases of a service in the network of the profile, so that the other
+// services cannot resolve its name, i.e. the agents enrolled with it, while it keeps running and
+// reaching them. The aliases are restored when the faults are removed
+func (i *Injector) HideService(service string) error {
+	return i.replaceAliases(service, []string{})
+}
+
+// KillProcess kills a process running in the container of a service
+func (i *Injector) KillProcess(process string, service string) error {
+	container, err := i.getContainer(service)
+	if err != nil {
+		return err
+	}
+
+	_, err = docker.ExecCommandIntoContainer(e2e.ScenarioContext(), container, "root", []string{"pkill", "-KILL", process})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"process": process,
+			"service": service,
+		}).Error("Could not kill the process in the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"process": process,
+		"service": service,
+	}).Info("The process was killed in the service")
+
+	return nil
+}
+
+// KillService kills the container of a service
+func (i *Injector) KillService(service string) error {
+	container, err := i.getContainer(service)
+	if err != nil {
+		return err
+	}
+
+	err = docker.KillContainer(e2e.ScenarioContext(), container, "SIGKILL")
+	if err != nil {
+		return err
+	}
+
+	// the network faults went away with the container
+	i.mutex.Lock()
+	delete(i.faults, service)
+	i.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"profile": i.profile,
+		"service": service,
+	}).Info("The service was killed")
+
+	return nil
+}
+
+// Partition drops the packets exchanged by a service with another one, so that they cannot reach each
+// other, i.e. an agent and the Fleet Server, while both reach the rest of the services. If a duration
+// is set, i.e. 2m, the connectivity is recovered once it elapses, otherwise when the faults are removed
+func (i *Injector) Partition(service string, peer string, duration string) error {
+	timeout, err := parseFaultDuration(duration)
+	if err != nil {
+		return err
+	}
+
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	peerContainer, err := i.getContainer(peer)
+	if err != nil {
+		return err
+	}
+
+	addresses, err := docker.GetContainerIPAddresses(e2e.ScenarioContext(), peerContainer)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if _, exists := faults.partitions[peer]; !exists {
+		for _, address := range addresses {
+			for _, rule := range partitionRules(address) {
+				_, err := runInNetwork(faults.container, append([]string{"iptables", "-I"}, rule...))
+				if err != nil {
+					return err
+				}
+			}
+			// the rules already inserted are deleted with the rest of the faults
+			faults.partitions[peer] = append(faults.partitions[peer], address)
+		}
+
+		log.WithFields(log.Fields{
+			"addresses": addresses,
+			"duration":  duration,
+			"peer":      peer,
+			"profile":   i.profile,
+			"service":   service,
+		}).Info("The service lost connectivity to the peer service")
+	}
+
+	if timeout > 0 {
+		i.removeAfter(service, faults, timeout, func(ctx context.Context) error {
+			return i.removePartition(ctx, service, faults, peer)
+		})
+	}
+
+	return nil
+}
+
+// RemoveAllFaults removes the faults injected into all the services
+func (i *Injector) RemoveAllFaults() {
+	i.mutex.Lock()
+	services := []string{}
+	for service := range i.faults {
+		services = append(services, service)
+	}
+	i.mutex.Unlock()
+
+	for _, service := range services {
+		err := i.RemoveFaults(service)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"service": service,
+			}).Warn("The faults were not removed from the service")
+		}
+	}
+}
+
+// RemoveFaults removes the faults injected into a service
+func (i *Injector) RemoveFaults(service string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	faults, exists := i.faults[service]
+	if !exists {
+		return nil
+	}
+
+	for _, timer := range faults.timers {
+		timer.Stop()
+	}
+
+	// the scenario could have been cancelled, but the faults must be removed anyway
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if len(faults.netem()) > 0 {
+		_, err := docker.RunInContainerNetwork(ctx, getImage(), faults.container, []string{"tc", "qdisc", "del", "dev", networkInterface, "root"})
+		if err != nil {
+			return err
+		}
+	}
+
+	if faults.dns {
+		for _, rule := range dnsRules {
+			_, err := docker.RunInContainerNetwork(ctx, getImage(), faults.container, append([]string{"iptables", "-D"}, rule...))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for peer := range faults.partitions {
+		err := i.removePartition(ctx, service, faults, peer)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := i.removeDiskFaults(ctx, service, faults)
+	if err != nil {
+		return err
+	}
+
+	err = i.reconnect(ctx, service, faults)
+	if err != nil {
+		return err
+	}
+
+	if faults.aliases {
+		err := i.serviceManager.SetServiceAliases(i.profile, service, nil)
+		if err != nil {
+			return err
+		}
+		faults.aliases = false
+	}
+
+	delete(i.faults, service)
+
+	log.WithFields(log.Fields{
+		"profile": i.profile,
+		"service": service,
+	}).Info("The faults were removed from the service")
+
+	return nil
+}
+
+// RemovePartition recovers the connectivity of a service to another one
+func (i *Injector) RemovePartition(service string, peer string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	faults, exists := i.faults[service]
+	if !exists {
+		return nil
+	}
+
+	return i.removePartition(e2e.ScenarioContext(), service, faults, peer)
+}
+
+// SetAliases replaces the aliases of a service in the network of the profile with comma-separated
+// names, so that the other services resolve it by them only, i.e. to move a hostname from a service
+// to another. The aliases are restored when the faults are removed
+func (i *Injector) SetAliases(service string, aliases string) error {
+	names := []string{}
+	for _, alias := range strings.Split(aliases, ",") {
+		if alias = strings.TrimSpace(alias); alias != "" {
+			names = append(names, alias)
+		}
+	}
+
+	return i.replaceAliases(service, names)
+}
+
+// getContainer returns the name of the running container of a service of the profile
+func (i *Injector) getContainer(service string) (string, error) {
+	container, err := docker.GetComposeServiceContainer(config.GetComposeProjectName(i.profile), service)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/"), nil
+}
+
+// getFaults returns the faults injected into a service, creating them if there are none
+func (i *Injector) getFaults(service string) (*serviceFaults, error) {
+	i.mutex.Lock()
+	faults, exists := i.faults[service]
+	i.mutex.Unlock()
+
+	if exists {
+		return faults, nil
+	}
+
+	container, err := i.getContainer(service)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	faults = &serviceFaults{
+		container:  container,
+		partitions: map[string][]string{},
+	}
+	i.faults[service] = faults
+
+	return faults, nil
+}
+
+// reconnect connects a service back to the networks it was disconnected from. It must be called
+// holding the mutex of the injector
+func (i *Injector) reconnect(ctx context.Context, service string, faults *serviceFaults) error {
+	if len(faults.networks) == 0 {
+		return nil
+	}
+
+	err := docker.ConnectContainerToNetworks(ctx, faults.container, faults.networks)
+	if err != nil {
+		return err
+	}
+
+	faults.networks = nil
+
+	log.WithFields(log.Fields{
+		"profile": i.profile,
+		"service": service,
+	}).Info("The service was connected back to the network")
+
+	return nil
+}
+
+// replaceAliases replaces the aliases of a service in the default network of the profile, which
+// cannot be done while it's disconnected from it
+func (i *Injector) replaceAliases(service string, aliases []string) error {
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if len(faults.networks) > 0 {
+		return fmt.Errorf("The aliases of the %s service cannot be replaced while it's disconnected from the network", service)
+	}
+
+	err = i.serviceManager.SetServiceAliases(i.profile, service, aliases)
+	if err != nil {
+		return err
+	}
+
+	faults.aliases = true
+
+	log.WithFields(log.Fields{
+		"aliases": aliases,
+		"profile": i.profile,
+		"service": service,
+	}).Info("The aliases of the service were replaced")
+
+	return nil
+}
+
+// removeAfter removes a fault of a service once a duration elapses, unless the faults of the service
+// are removed before
+func (i *Injector) removeAfter(service string, faults *serviceFaults, duration time.Duration, remove func(ctx context.Context) error) {
+	timer := time.AfterFunc(duration, func() {
+		// the scenario could have been cancelled, but the fault must be removed anyway
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		i.mutex.Lock()
+		defer i.mutex.Unlock()
+
+		err := remove(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"duration": duration,
+				"error":    err,
+				"service":  service,
+			}).Warn("The fault was not removed from the service once its duration elapsed")
+		}
+	})
+
+	faults.timers = append(faults.timers, timer)
+}
+
+// removePartition deletes the rules dropping the packets exchanged by a service with another one. It
+// must be called holding the mutex of the injector
+func (i *Injector) removePartition(ctx context.Context, service string, faults *serviceFaults, peer string) error {
+	addresses, exists := faults.partitions[peer]
+	if !exists {
+		return nil
+	}
+
+	for _, address := range addresses {
+		for _, rule := range partitionRules(address) {
+			_, err := docker.RunInContainerNetwork(ctx, getImage(), faults.container, append([]string{"iptables", "-D"}, rule...))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(faults.partitions, peer)
+
+	log.WithFields(log.Fields{
+		"peer":    peer,
+		"profile": i.profile,
+		"service": service,
+	}).Info("The service recovered connectivity to the peer service")
+
+	return nil
+}
+
+// updateNetem updates the network faults of a service, emulating them with netem
+func (i *Injector) updateNetem(service string, update func(f *serviceFaults)) error {
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	update(faults)
+
+	cmd := append([]string{"tc", "qdisc", "replace", "dev", networkInterface, "root", "netem"}, faults.netem()...)
+
+	_, err = runInNetwork(faults.container, cmd)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"latency": faults.latency,
+		"loss":    faults.loss,
+		"profile": i.profile,
+		"service": service,
+	}).Info("The network faults of the service were updated")
+
+	return nil
+}
+
+// getImage returns the image used to alter the network of the services
+func getImage() string {
+	return shell.GetEnv("CHAOS_IMAGE", defaultImage)
+}
+
+// parseFaultDuration parses the duration of a fault, i.e. 2m, which is zero if it's not set, so that
+// the fault lasts until the faults are removed
+func parseFaultDuration(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(duration)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("The duration of the fault is not a valid duration: %s", duration)
+	}
+
+	return d, nil
+}
+
+// runInNetwork runs a command in the network stack of a container
+func runInNetwork(container string, cmd []string) (string, error) {
+	return docker.RunInContainerNetwork(e2e.ScenarioContext(), getImage(), container, cmd)
+}
@@ -0,0 +1,270 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// elasticsearchDataPath the path of the data of the Elasticsearch nodes
+const elasticsearchDataPath = "/usr/share/elasticsearch/data"
+
+// elasticsearchFullDisk the usage of the disk of an Elasticsearch node which runs out of disk, above
+// the flood stage watermark (95%), so that its indices are read-only
+const elasticsearchFullDisk = "97%"
+
+// diskFillFile the name of the file filling the disk of a service, in the filled path
+const diskFillFile = ".e2e-chaos-disk-fill"
+
+// defaultMaxDiskFillGB the max size of the files filling the disks, in GB, as the disks of the
+// containers are usually the disk of the host. It can be overriden by CHAOS_MAX_DISK_FILL_GB env var
+const defaultMaxDiskFillGB = 20
+
+// ioRatePattern matches the rates of the disk IO, i.e. 1MB/s or 512kb
+var ioRatePattern = regexp.MustCompile(`(?i)^(\d+)\s*(b|kb|mb|gb)?(/s)?$`)
+
+// ioThrottleScript throttles the disk IO of a container, writing the limits into its cgroup, from a
+// container in the PID namespace of the host. The device is the block device of the mount of the
+// path in the container, i.e. a volume, as the union filesystems of the containers have no device.
+// The partitions are throttled by their disk, and the limits are the ones of cgroup v2 (io.max) or
+// v1 (blkio.throttle.*_bps_device). The arguments are the PID and the ID of the container, the
+// path, and the limits of cgroup v2 and v1
+const ioThrottleScript = `pid=$1; id=$2; target=$3; v2=$4; v1=$5
+dev=$(awk -v t="$target" '{ m = $5; p = (m == "/") ? "/" : m "/"; if ((t == m || index(t, p) == 1) && length(m) >= best) { best = length(m); d = $3 } } END { print d }' /proc/$pid/mountinfo)
+case "$dev" in
+  ""|0:*) echo "the $target path is not in a block device, i.e. a volume" >&2; exit 1 ;;
+esac
+if [ -e /sys/dev/block/$dev/partition ]; then dev=$(cat /sys/dev/block/$dev/../dev); fi
+if [ -f /host/sys/fs/cgroup/cgroup.controllers ]; then
+  dir=$(find /host/sys/fs/cgroup -maxdepth 3 -type d -name "*$id*" | head -n 1)
+  [ -n "$dir" ] || { echo "there is no cgroup for the $id container" >&2; exit 1; }
+  echo "$dev rbps=$v2 wbps=$v2" > "$dir/io.max"
+else
+  dir=$(find /host/sys/fs/cgroup/blkio -maxdepth 3 -type d -name "*$id*" | head -n 1)
+  [ -n "$dir" ] || { echo "there is no cgroup for the $id container" >&2; exit 1; }
+  echo "$dev $v1" > "$dir/blkio.throttle.read_bps_device"
+  echo "$dev $v1" > "$dir/blkio.throttle.write_bps_device"
+fi
+echo "$dev"`
+
+// diskFillScript fills the filesystem of a path in a container up to a percentage of its size with a
+// file, unless it's already used above it, printing the size of the file in KB. The arguments are
+// the path, the percentage, the file and the max size of the file in KB
+const diskFillScript = `target=$1; pct=$2; file=$3; max=$4
+set -- $(df -P -k "$target" | awk 'NR == 2 { print $2, $4 }')
+size=$(( $1 * (100 - pct) / 100 )); fill=$(( $2 - size ))
+if [ "$fill" -le 0 ]; then echo 0; exit 0; fi
+if [ "$fill" -gt "$max" ]; then echo "filling the disk of $target needs $fill KB, above the max of $max KB" >&2; exit 1; fi
+fallocate -l "$(( fill * 1024 ))" "$file" 2>/dev/null || dd if=/dev/zero of="$file" bs=1024 count="$fill" 2>/dev/null || { rm -f "$file"; exit 1; }
+echo "$fill"`
+
+// FillDisk fills the filesystem of a path in a service with a file, i.e. the data path of
+// Elasticsearch, up to a percentage of its size, i.e. 97%. The file is removed when the faults are
+// removed
+func (i *Injector) FillDisk(service string, usage string, target string) error {
+	percentage, err := parseDiskUsage(usage)
+	if err != nil {
+		return err
+	}
+
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	maxFillGB, err := strconv.Atoi(shell.GetEnv("CHAOS_MAX_DISK_FILL_GB", strconv.Itoa(defaultMaxDiskFillGB)))
+	if err != nil {
+		return fmt.Errorf("The max size of the files filling the disks is not a number of GB: %v", err)
+	}
+
+	file := path.Join(target, diskFillFile)
+	cmd := []string{"sh", "-c", diskFillScript, "sh", target, strconv.Itoa(percentage), file, strconv.Itoa(maxFillGB * 1024 * 1024)}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	result, err := docker.ExecCommandIntoContainerWithResult(e2e.ScenarioContext(), faults.container, "root", cmd)
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("The disk of the %s service could not be filled: %s", service, strings.TrimSpace(result.Stderr))
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"path":    target,
+			"service": service,
+			"usage":   usage,
+		}).Error("Could not fill the disk of the service")
+		return err
+	}
+
+	if !contains(faults.diskFills, file) {
+		faults.diskFills = append(faults.diskFills, file)
+	}
+
+	log.WithFields(log.Fields{
+		"filledKB": strings.TrimSpace(result.Stdout),
+		"path":     target,
+		"profile":  i.profile,
+		"service":  service,
+		"usage":    usage,
+	}).Info("The disk of the service was filled")
+
+	return nil
+}
+
+// RunOutOfDisk fills the disk of the data path of the Elasticsearch node of a service above the flood
+// stage watermark, so that Elasticsearch blocks the writes to its indices
+func (i *Injector) RunOutOfDisk(service string) error {
+	return i.FillDisk(service, elasticsearchFullDisk, elasticsearchDataPath)
+}
+
+// ThrottleDiskIO limits the rate the container of a service reads and writes the disk of a path,
+// i.e. 1MB/s. The path must be in a block device, i.e. a volume. The limits are removed when the
+// faults are removed
+func (i *Injector) ThrottleDiskIO(service string, rate string, target string) error {
+	bytesPerSecond, err := parseIORate(rate)
+	if err != nil {
+		return err
+	}
+
+	faults, err := i.getFaults(service)
+	if err != nil {
+		return err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	limit := strconv.FormatInt(bytesPerSecond, 10)
+
+	device, err := i.setIOLimits(e2e.ScenarioContext(), service, faults, target, limit, limit)
+	if err != nil {
+		return err
+	}
+
+	if !contains(faults.ioThrottles, target) {
+		faults.ioThrottles = append(faults.ioThrottles, target)
+	}
+
+	log.WithFields(log.Fields{
+		"device":  device,
+		"path":    target,
+		"profile": i.profile,
+		"rate":    rate,
+		"service": service,
+	}).Info("The disk IO of the service was throttled")
+
+	return nil
+}
+
+// removeDiskFaults removes the files filling the disks of a service, and the limits of its disk IO.
+// It must be called holding the mutex of the injector
+func (i *Injector) removeDiskFaults(ctx context.Context, service string, faults *serviceFaults) error {
+	if len(faults.diskFills) > 0 {
+		cmd := append([]string{"rm", "-f"}, faults.diskFills...)
+
+		_, err := docker.ExecCommandIntoContainer(ctx, faults.container, "root", cmd)
+		if err != nil {
+			return err
+		}
+
+		faults.diskFills = nil
+	}
+
+	for len(faults.ioThrottles) > 0 {
+		_, err := i.setIOLimits(ctx, service, faults, faults.ioThrottles[0], "max", "0")
+		if err != nil {
+			return err
+		}
+
+		faults.ioThrottles = faults.ioThrottles[1:]
+	}
+
+	return nil
+}
+
+// setIOLimits writes the limits of the disk IO of the container of a service into its cgroup,
+// returning the device they apply to. It must be called holding the mutex of the injector
+func (i *Injector) setIOLimits(ctx context.Context, service string, faults *serviceFaults, target string, v2Limit string, v1Limit string) (string, error) {
+	container, err := docker.GetComposeServiceContainer(config.GetComposeProjectName(i.profile), service)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := docker.GetContainerState(ctx, container.ID)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := []string{"sh", "-c", ioThrottleScript, "sh", strconv.Itoa(state.Pid), container.ID, target, v2Limit, v1Limit}
+
+	output, err := docker.RunInHostPIDNamespace(ctx, getImage(), faults.container, cmd)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"path":    target,
+			"service": service,
+		}).Error("Could not set the limits of the disk IO of the service")
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// contains returns if a value is in a list
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDiskUsage parses a percentage of usage of a disk, i.e. 97%, which must be below 100%
+func parseDiskUsage(usage string) (int, error) {
+	percentage, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(usage), "%"))
+	if err != nil || percentage <= 0 || percentage >= 100 {
+		return 0, fmt.Errorf("The usage of the disk is not a percentage between 1%% and 99%%: %s", usage)
+	}
+
+	return percentage, nil
+}
+
+// parseIORate parses a rate of disk IO, i.e. 1MB/s, 512KB/s or 1048576, in bytes per second
+func parseIORate(rate string) (int64, error) {
+	matches := ioRatePattern.FindStringSubmatch(strings.TrimSpace(rate))
+	if matches == nil {
+		return 0, fmt.Errorf("The rate of the disk IO is not valid, i.e. 1MB/s: %s", rate)
+	}
+
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("The rate of the disk IO is not valid, i.e. 1MB/s: %s", rate)
+	}
+
+	switch strings.ToLower(matches[2]) {
+	case "kb":
+		value *= 1024
+	case "mb":
+		value *= 1024 * 1024
+	case "gb":
+		value *= 1024 * 1024 * 1024
+	}
+
+	return value, nil
+}
@@ -0,0 +1,157 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Cleanup the teardown function of a deployed resource
+type Cleanup struct {
+	fn       func() error
+	once     sync.Once
+	resource string // the name of the resource, i.e. the fleet profile
+}
+
+// cleanupRegistry the teardown functions of the resources which are not destroyed yet
+var cleanupRegistry = struct {
+	cleanups []*Cleanup
+	mutex    sync.Mutex
+}{}
+
+var interruptionsOnce sync.Once
+
+// RegisterCleanup registers the teardown function of a deployed resource, i.e. a docker-compose
+// profile, a container or a policy, so that it is destroyed when the test process is interrupted
+// with SIGINT or SIGTERM, panics or exits with a fatal error. The suites run the returned cleanup
+// when they destroy the resource in their hooks, which unregisters it
+func RegisterCleanup(resource string, fn func() error) *Cleanup {
+	cleanup := &Cleanup{
+		fn:       fn,
+		resource: resource,
+	}
+
+	cleanupRegistry.mutex.Lock()
+	cleanupRegistry.cleanups = append(cleanupRegistry.cleanups, cleanup)
+	cleanupRegistry.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"resource": resource,
+	}).Trace("Cleanup registered")
+
+	return cleanup
+}
+
+// Run destroys the resource, unregistering its teardown function. It is run once, returning nil
+// in the next calls
+func (c *Cleanup) Run() error {
+	var err error
+
+	c.once.Do(func() {
+		unregisterCleanup(c)
+
+		err = c.fn()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"resource": c.resource,
+			}).Warn("Could not clean up the resource")
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"resource": c.resource,
+		}).Trace("Resource cleaned up")
+	})
+
+	return err
+}
+
+// Discard unregisters the teardown function without running it, i.e. when the resource must be
+// kept after the run
+func (c *Cleanup) Discard() {
+	c.once.Do(func() {
+		unregisterCleanup(c)
+	})
+}
+
+// RunCleanups destroys the resources which are not destroyed yet, in the reverse order of their
+// registration, so that the resources of a scenario are destroyed before the ones of the suite
+func RunCleanups() {
+	cleanupRegistry.mutex.Lock()
+	cleanups := make([]*Cleanup, len(cleanupRegistry.cleanups))
+	copy(cleanups, cleanupRegistry.cleanups)
+	cleanupRegistry.mutex.Unlock()
+
+	if len(cleanups) == 0 {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"resources": len(cleanups),
+	}).Info("Cleaning up the resources deployed by the run")
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		_ = cleanups[i].Run()
+	}
+}
+
+// handleInterruptions runs the pending cleanups when the test process receives SIGINT or SIGTERM,
+// or exits with a fatal error, before exiting. A second signal exits without waiting for them
+func handleInterruptions() {
+	interruptionsOnce.Do(func() {
+		log.RegisterExitHandler(RunCleanups)
+
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+		go func() {
+			sig := <-signals
+
+			log.WithFields(log.Fields{
+				"signal": sig,
+			}).Warn("The run was interrupted, cleaning up the deployed resources. Send the signal again to exit right away")
+
+			go func() {
+				sig := <-signals
+				log.WithFields(log.Fields{
+					"signal": sig,
+				}).Warn("Exiting without cleaning up the deployed resources")
+				os.Exit(exitCode(sig))
+			}()
+
+			RunCleanups()
+
+			os.Exit(exitCode(sig))
+		}()
+	})
+}
+
+// exitCode returns the exit code of a process terminated by a signal, as the shells do
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+
+	return 1
+}
+
+// unregisterCleanup removes a teardown function from the registry
+func unregisterCleanup(cleanup *Cleanup) {
+	cleanupRegistry.mutex.Lock()
+	defer cleanupRegistry.mutex.Unlock()
+
+	for i, c := range cleanupRegistry.cleanups {
+		if c == cleanup {
+			cleanupRegistry.cleanups = append(cleanupRegistry.cleanups[:i], cleanupRegistry.cleanups[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// controlLogsBuffer the number of log lines buffered for each client streaming the logs, which are
+// dropped for that client when it does not read them fast enough
+const controlLogsBuffer = 256
+
+// controlShutdownTimeout the max time waiting for the requests in flight when the run finishes
+const controlShutdownTimeout = 5 * time.Second
+
+const (
+	runFinished = "finished"
+	runRunning  = "running"
+	runWaiting  = "waiting"
+)
+
+// controlAddr the address the control API of the runner listens at, i.e. :8090, set with the
+// --control.addr flag of the suites, or the CONTROL_API_ADDR environment variable. It's disabled if empty
+var controlAddr = ""
+
+// controlWait makes the runner wait for the start request of the control API before running the
+// scenarios, set with the --control.wait flag of the suites, or the CONTROL_API_WAIT environment variable
+var controlWait = false
+
+// controlServer the control API of the runner, which lets the orchestration systems drive and observe
+// a run: starting the suite, aborting the running scenarios, streaming the logs and fetching the report
+type controlServer struct {
+	done             chan struct{} // closed when the run finishes, ending the streams of the logs
+	mutex            sync.Mutex
+	running          map[string]*controlScenario // by the ID of the pickle
+	server           *http.Server
+	started          chan struct{} // closed when the suite is started
+	status           string
+	subscribers      map[chan []byte]bool // the clients streaming the logs
+	subscribersMutex sync.Mutex           // apart, as the entries are logged holding the other one
+}
+
+// controlScenario a scenario running in the suite, which can be aborted
+type controlScenario struct {
+	aborted bool
+	cancel  context.CancelFunc
+	id      string // the ID of the pickle
+	name    string
+}
+
+var control = &controlServer{
+	done:        make(chan struct{}),
+	running:     map[string]*controlScenario{},
+	started:     make(chan struct{}),
+	status:      runWaiting,
+	subscribers: map[chan []byte]bool{},
+}
+
+// startControlServer starts the control API of the runner if its address is set, shifting its port
+// for the worker running the suite, so that the workers do not collide
+func startControlServer() error {
+	if controlAddr == "" {
+		controlAddr = shell.GetEnv("CONTROL_API_ADDR", "")
+	}
+
+	if controlAddr == "" {
+		return nil
+	}
+
+	if !controlWait {
+		controlWait, _ = shell.GetEnvBool("CONTROL_API_WAIT")
+	}
+
+	host, port, err := net.SplitHostPort(controlAddr)
+	if err != nil {
+		return fmt.Errorf("the address of the control API is not valid: %v", err)
+	}
+
+	if p, err := strconv.Atoi(port); err == nil && p > 0 {
+		port = strconv.Itoa(config.GetHostPort(p))
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"addr":  controlAddr,
+			"error": err,
+		}).Error("Could not listen at the address of the control API")
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", control.handleStart)
+	mux.HandleFunc("/scenarios/abort", control.handleAbort)
+	mux.HandleFunc("/logs", control.handleLogs)
+	mux.HandleFunc("/report", control.handleReport)
+
+	control.server = &http.Server{Handler: mux}
+	log.AddHook(control)
+
+	go func() {
+		err := control.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Warn("The control API stopped")
+		}
+	}()
+
+	log.WithFields(log.Fields{
+		"addr": listener.Addr().String(),
+		"wait": controlWait,
+	}).Info("The control API of the runner is listening")
+
+	return nil
+}
+
+// waitForStart blocks until the start request of the control API is received, if the runner must
+// wait for it, and marks the run as running
+func (c *controlServer) waitForStart() {
+	if c.server != nil && controlWait {
+		log.Info("Waiting for the start request of the control API to run the scenarios")
+		<-c.started
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.started:
+	default:
+		close(c.started)
+	}
+
+	c.status = runRunning
+}
+
+// stop marks the run as finished, ending the streams of the logs, and shuts the control API down
+func (c *controlServer) stop() {
+	c.mutex.Lock()
+	c.status = runFinished
+	close(c.done)
+	c.mutex.Unlock()
+
+	if c.server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+
+	_ = c.server.Shutdown(ctx)
+}
+
+// register adds the hooks keeping the running scenarios, so that they can be aborted. They must be
+// added before the hooks of the suite, so that the context of the scenario passed to them is
+// cancelled when it's aborted, and its next steps fail with ErrScenarioAborted
+func (c *controlServer) register(s *godog.ScenarioContext) {
+	// the scenario context is initialised for each scenario, so the steps only check their own one
+	var current *controlScenario
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		current = &controlScenario{cancel: cancel, id: pickle.Id, name: pickle.Name}
+		c.running[pickle.Id] = current
+
+		return ctx, nil
+	})
+
+	s.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if current != nil && current.aborted {
+			return ctx, fmt.Errorf("the %q scenario: %w", current.name, e2eerrors.ErrScenarioAborted)
+		}
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if scenario, exists := c.running[pickle.Id]; exists {
+			scenario.cancel()
+			delete(c.running, pickle.Id)
+		}
+
+		return ctx, nil
+	})
+}
+
+// handleStart starts the suite waiting for it
+func (c *controlServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	select {
+	case <-c.started:
+		http.Error(w, "the suite was already started", http.StatusConflict)
+		return
+	default:
+	}
+
+	close(c.started)
+
+	log.Info("The suite was started with the control API")
+
+	writeControlJSON(w, map[string]string{"status": runRunning})
+}
+
+// handleAbort aborts the running scenario whose ID or name is the scenario parameter, or all of
+// them if it's empty, cancelling their context, so that their next steps fail. The scenarios after
+// them are run
+func (c *controlServer) handleAbort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	selected := r.URL.Query().Get("scenario")
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	matched := false
+	aborted := []string{}
+	for _, scenario := range c.running {
+		if selected != "" && selected != scenario.id && selected != scenario.name {
+			continue
+		}
+
+		matched = true
+		if scenario.aborted {
+			continue
+		}
+
+		scenario.aborted = true
+		scenario.cancel()
+		aborted = append(aborted, scenario.name)
+	}
+
+	if selected != "" && !matched {
+		http.Error(w, fmt.Sprintf("the %q scenario is not running", selected), http.StatusNotFound)
+		return
+	}
+
+	if len(aborted) == 0 && matched {
+		http.Error(w, "the running scenarios were already aborted", http.StatusConflict)
+		return
+	}
+
+	if len(aborted) == 0 {
+		http.Error(w, "there are no running scenarios", http.StatusConflict)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"scenarios": aborted,
+	}).Warn("The running scenarios were aborted with the control API")
+
+	writeControlJSON(w, map[string][]string{"aborted": aborted})
+}
+
+// handleLogs streams the log lines of the runner, from the moment of the request, until the run
+// finishes or the client disconnects
+func (c *controlServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lines := make(chan []byte, controlLogsBuffer)
+
+	c.subscribersMutex.Lock()
+	c.subscribers[lines] = true
+	c.subscribersMutex.Unlock()
+
+	defer func() {
+		c.subscribersMutex.Lock()
+		delete(c.subscribers, lines)
+		c.subscribersMutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case line := <-lines:
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// handleReport writes the report of the run as it is: its status, the scenarios run so far with
+// their steps, and the running ones
+func (c *controlServer) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.mutex.Lock()
+	status := c.status
+	c.mutex.Unlock()
+
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	running := []string{}
+	for _, sr := range report.running {
+		running = append(running, sr.Name)
+	}
+
+	writeControlJSON(w, struct {
+		Name       string            `json:"name"`
+		Properties map[string]string `json:"properties"`
+		Running    []string          `json:"running"`
+		Scenarios  []*scenarioReport `json:"scenarios"`
+		Start      time.Time         `json:"start"`
+		Status     string            `json:"status"`
+	}{
+		Name:       report.name,
+		Properties: report.properties,
+		Running:    running,
+		Scenarios:  report.scenarios,
+		Start:      report.start,
+		Status:     status,
+	})
+}
+
+// Levels returns the levels of the log entries sent to the clients streaming the logs, which are
+// all of them, as the level of the logger filters them before
+func (c *controlServer) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire sends a log entry to the clients streaming the logs, formatted as the output of the runner
+func (c *controlServer) Fire(entry *log.Entry) error {
+	c.subscribersMutex.Lock()
+	defer c.subscribersMutex.Unlock()
+
+	if len(c.subscribers) == 0 {
+		return nil
+	}
+
+	line, err := entry.Logger.Formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	for subscriber := range c.subscribers {
+		select {
+		case subscriber <- line:
+		default:
+			// the client is too slow, so the line is dropped for it
+		}
+	}
+
+	return nil
+}
+
+// writeControlJSON writes the response of a request of the control API in JSON
+func writeControlJSON(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Could not write the response of the control API")
+	}
+}
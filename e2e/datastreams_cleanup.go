@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// dataStreamsCleanupTimeout the max time to delete the data streams after a scenario
+const dataStreamsCleanupTimeout = time.Minute
+
+// defaultDataStreamsPatterns the data streams deleted after the scenarios if no pattern is passed,
+// which are the ones written by the agents. Their backing indices (.ds-*) are deleted with them
+var defaultDataStreamsPatterns = []string{"logs-*", "metrics-*"}
+
+// DeleteDataStreams deletes the data streams of the elasticsearch running in the host matching some
+// patterns, i.e. logs-*, with their backing indices. The data streams are created again by the next
+// document sent to them
+func DeleteDataStreams(ctx context.Context, patterns ...string) error {
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = elasticsearch.NewClient(esClient).DeleteDataStreams(ctx, patterns)
+	return err
+}
+
+// RegisterDataStreamsCleanup deletes the data streams matching some patterns, or the logs and
+// metrics ones if there are none, after each scenario, so that the documents written by a scenario
+// are not counted by the assertions of the next ones. It must be registered after the hooks
+// removing the agents, which would write the data streams again, as the hooks run in order.
+// It can be disabled with DATA_STREAMS_CLEANUP=false, i.e. to inspect the documents of a scenario
+func RegisterDataStreamsCleanup(s *godog.ScenarioContext, patterns ...string) {
+	if len(patterns) == 0 {
+		patterns = defaultDataStreamsPatterns
+	}
+
+	s.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		if enabled, envErr := shell.GetEnvBool("DATA_STREAMS_CLEANUP"); envErr == nil && !enabled {
+			log.Trace("The cleanup of the data streams is disabled")
+			return ctx, nil
+		}
+
+		// the context of the scenario could be cancelled by its timeout
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), dataStreamsCleanupTimeout)
+		defer cancel()
+
+		cleanupErr := DeleteDataStreams(cleanupCtx, patterns...)
+		if cleanupErr != nil {
+			log.WithFields(log.Fields{
+				"error":    cleanupErr,
+				"patterns": patterns,
+				"scenario": sc.Name,
+			}).Warn("The data streams of the scenario could not be deleted")
+		}
+
+		return ctx, nil
+	})
+}
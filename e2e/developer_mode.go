@@ -0,0 +1,101 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// keepStack keeps the runtime dependencies of the suite running once it finishes, so that the next
+// runs reuse them, which speeds up the development of the steps. It's set with the --keep-stack flag,
+// defaulting to the DEVELOPER_MODE env var
+var keepStack = false
+
+// IsDeveloperMode checks if the runtime dependencies of the suite are kept running after it, and
+// reused by the next runs. It's only set once the flags of the suite are parsed by RunSuite, so it
+// must be checked in the hooks and the steps of the suite, not when its package is initialised
+func IsDeveloperMode() bool {
+	return keepStack
+}
+
+// ReuseProfile checks if the services of a profile can be reused in developer mode, because a
+// previous run kept them running with the same values of the variables of the environment. The
+// services are recreated otherwise, i.e. when the version of the stack changes between the runs
+func ReuseProfile(profile string, env map[string]string) bool {
+	if !IsDeveloperMode() {
+		return false
+	}
+
+	runStatus, reusable, err := services.GetRunningProfile(profile, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": profile,
+		}).Warn("Could not check if the services of the profile are running, they will be run")
+		return false
+	}
+
+	if !reusable {
+		log.WithFields(log.Fields{
+			"profile": profile,
+		}).Debug("The services of the profile are not running with the environment of the run, they will be run")
+		return false
+	}
+
+	log.WithFields(log.Fields{
+		"profile": profile,
+		"project": runStatus.Project,
+		"runId":   runStatus.RunID,
+	}).Info("Reusing the services of the profile kept running by a previous run in Developer mode 💻")
+
+	return true
+}
+
+// PrintKeptProfile prints the services of a profile kept running in developer mode once the suite
+// finishes, and how to reuse them in the next runs or to destroy them
+func PrintKeptProfile(profile string) {
+	if !IsDeveloperMode() {
+		return
+	}
+
+	runStatus, _, err := services.GetRunningProfile(profile, map[string]string{})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": profile,
+		}).Warn("Could not get the status of the services of the profile kept running")
+		return
+	}
+
+	writeKeptProfile(os.Stdout, profile, runStatus)
+}
+
+// writeKeptProfile writes the services of a profile kept running, with their published ports, and
+// the commands reusing them in the next runs or destroying them
+func writeKeptProfile(w io.Writer, profile string, runStatus services.RunStatus) {
+	fmt.Fprintf(w, "\nThe services of the %s profile are kept running in Developer mode 💻:\n", profile)
+	for _, service := range runStatus.Services {
+		fmt.Fprintf(w, "  %-20s %-10s %s\n", service.Name, service.State, strings.Join(service.Ports, ", "))
+	}
+
+	fmt.Fprintln(w, "Reuse them in the next runs of the suite with the same environment, i.e. with the same STACK_VERSION:")
+	fmt.Fprintln(w, "  DEVELOPER_MODE=true make -C e2e functional-test, or the --keep-stack flag of the suite")
+	fmt.Fprintln(w, "Destroy them once they are not needed anymore:")
+	fmt.Fprintf(w, "  op stop profile %s\n", profile)
+}
+
+// developerModeFromEnv returns if the developer mode is enabled with the DEVELOPER_MODE env var
+func developerModeFromEnv() bool {
+	developerMode, _ := shell.GetEnvBool("DEVELOPER_MODE")
+
+	return developerMode
+}
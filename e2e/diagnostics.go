@@ -0,0 +1,110 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+)
+
+// maxDiagnosticsDocuments the number of the most recent documents of each index searched by the
+// failed step written to its diagnostics
+const maxDiagnosticsDocuments = 10
+
+// diagnosticsFileName replaces the characters of the names of the indices which are not valid in
+// the names of the files of the diagnostics
+var diagnosticsFileName = strings.NewReplacer("*", "_all_", ",", "_", "/", "_", ":", "_")
+
+// searchedIndices returns the indices, data streams or patterns searched by the HTTP requests of the
+// failed step, i.e. logs-elastic_agent-default, in the order they were searched first
+func searchedIndices(exchanges []shell.HTTPExchange) []string {
+	indices := []string{}
+	seen := map[string]bool{}
+
+	for _, exchange := range exchanges {
+		u, err := url.Parse(exchange.URL)
+		if err != nil {
+			continue
+		}
+
+		segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(segments) != 2 || (segments[1] != "_search" && segments[1] != "_count") {
+			continue
+		}
+
+		for _, index := range strings.Split(segments[0], ",") {
+			if index == "" || seen[index] {
+				continue
+			}
+
+			seen[index] = true
+			indices = append(indices, index)
+		}
+	}
+
+	return indices
+}
+
+// writeIndexDiagnostics writes the diagnostics of the indices searched by the failed step into the
+// diagnostics dir of the bundle: the stats of their data streams and their most recent documents,
+// summarising the number of documents and the time of the last one of each index, so that the
+// problems of the ingestion are told apart from the problems of the agents sending the data
+func writeIndexDiagnostics(bundleDir string, indices []string) {
+	if len(indices) == 0 {
+		return
+	}
+
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return
+	}
+	client := elasticsearch.NewClient(esClient)
+
+	// the scenario context could be already done
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Indices searched by the failed step: %s\n\n", strings.Join(indices, ", "))
+
+	for _, index := range indices {
+		fileName := diagnosticsFileName.Replace(index)
+
+		stats, err := client.GetDataStreamsStats(ctx, []string{index})
+		if err == nil {
+			_ = WriteArtifact(bundleDir, filepath.Join("diagnostics", fileName+"-stats.json"), string(stats))
+		}
+
+		query := elasticsearch.NewQuery().WithSort(elasticsearch.TimestampField, true).WithSize(maxDiagnosticsDocuments)
+
+		result, err := client.Search(ctx, index, query)
+		if err != nil {
+			fmt.Fprintf(&summary, "%s: could not search the index: %v\n", index, err)
+			continue
+		}
+
+		documents, err := json.MarshalIndent(result.Hits.Hits, "", "  ")
+		if err == nil {
+			_ = WriteArtifact(bundleDir, filepath.Join("diagnostics", fileName+"-documents.json"), string(documents))
+		}
+
+		latest := "none"
+		if len(result.Hits.Hits) > 0 {
+			latest = fmt.Sprint(result.Hits.Hits[0].Source[elasticsearch.TimestampField])
+		}
+
+		fmt.Fprintf(&summary, "%s: %d documents (%s), the last one at %s\n", index, result.Hits.Total.Value, result.Hits.Total.Relation, latest)
+	}
+
+	_ = WriteArtifact(bundleDir, filepath.Join("diagnostics", "summary.txt"), summary.String())
+}
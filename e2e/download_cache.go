@@ -0,0 +1,52 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"strconv"
+	"time"
+
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+)
+
+// DownloadCacheTTLEnvVar the environment variable with the time the downloads without a checksum
+// are reused from the cache before checking if they changed, i.e. 1h
+const DownloadCacheTTLEnvVar = "DOWNLOAD_CACHE_TTL"
+
+// DownloadCacheRefreshEnvVar the environment variable which downloads the files again, ignoring
+// the cached ones, i.e. true
+const DownloadCacheRefreshEnvVar = "DOWNLOAD_CACHE_REFRESH"
+
+// defaultDownloadCacheTTL the time the downloads without a checksum are reused from the cache
+// before checking if they changed
+const defaultDownloadCacheTTL = 24 * time.Hour
+
+// refreshDownloads if the files are downloaded again, ignoring the cached ones, set with the
+// --refresh flag of the suites
+var refreshDownloads = false
+
+// IsDownloadCacheRefreshed returns if the files are downloaded again, ignoring the ones in the
+// cache, which is enabled with the --refresh flag of the suites, or the DOWNLOAD_CACHE_REFRESH
+// environment variable
+func IsDownloadCacheRefreshed() bool {
+	if refreshDownloads {
+		return true
+	}
+
+	refresh, err := strconv.ParseBool(curl.GetEnv(DownloadCacheRefreshEnvVar, "false"))
+
+	return err == nil && refresh
+}
+
+// downloadCached downloads a file without a checksum to its path in the cache, reusing the cached
+// one for the TTL of the cache, unless the cache is refreshed
+func (c *ArtifactsClient) downloadCached(fileURL string, filePath string) error {
+	return artifacts.DownloadCached(fileURL, filePath, artifacts.CacheOptions{
+		DownloadOptions: getDownloadOptions(),
+		Refresh:         IsDownloadCacheRefreshed(),
+		TTL:             getDurationFromEnv(DownloadCacheTTLEnvVar, defaultDownloadCacheTTL),
+	})
+}
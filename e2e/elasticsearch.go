@@ -9,14 +9,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/config"
 	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/datastreams"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
 	es "github.com/elastic/go-elasticsearch/v8"
 	log "github.com/sirupsen/logrus"
 )
 
+// elasticsearchPort the port where Elasticsearch listens to. When running in parallel, each worker
+// exposes it at a different port of the host
+const elasticsearchPort = 9200
+
 // ElasticsearchQuery a very reduced representation of an elasticsearch query, where
 // we want to simply override the event.module and service.version fields
 //nolint:unused
@@ -29,6 +38,160 @@ type ElasticsearchQuery struct {
 // SearchResult wraps a search result
 type SearchResult map[string]interface{}
 
+// observedTransport notifies the HTTP observers about the requests executed by the Elasticsearch client
+type observedTransport struct{}
+
+// RoundTrip executes a request, notifying the observers about it
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := curl.HTTPExchange{
+		Method:    req.Method,
+		StartedAt: time.Now(),
+		URL:       req.URL.String(),
+	}
+
+	if req.Body != nil {
+		payload, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		exchange.Payload = string(payload)
+		req.Body = ioutil.NopCloser(bytes.NewReader(payload))
+	}
+
+	// the transport of the HTTP requests of the tool trusts the CA of the secured stack
+	resp, err := curl.GetTransport().RoundTrip(req)
+	exchange.Duration = time.Since(exchange.StartedAt)
+	if err != nil {
+		exchange.Error = err.Error()
+		curl.NotifyHTTPExchange(exchange)
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	exchange.Response = string(body)
+	exchange.StatusCode = resp.StatusCode
+	curl.NotifyHTTPExchange(exchange)
+
+	return resp, nil
+}
+
+// BulkIndex indexes documents into an index of the elasticsearch running in the host, with a
+// single request of the bulk API, refreshing the index so that they are searchable right away
+func BulkIndex(ctx context.Context, index string, documents []map[string]interface{}) error {
+	if len(documents) == 0 {
+		return nil
+	}
+
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, document := range documents {
+		// the documents are created, as data streams do not support the index action
+		action := map[string]interface{}{
+			"create": map[string]interface{}{},
+		}
+
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(document); err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"index": index,
+			}).Error("Error encoding the document to be indexed")
+
+			return err
+		}
+	}
+
+	res, err := esClient.Bulk(
+		&buf,
+		esClient.Bulk.WithContext(ctx),
+		esClient.Bulk.WithIndex(index),
+		esClient.Bulk.WithRefresh("true"),
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"index": index,
+		}).Error("Error performing the bulk request on Elasticsearch")
+
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		err := fmt.Errorf("Error indexing the documents in the %s index. Status: %s", index, res.Status())
+
+		log.WithFields(log.Fields{
+			"error": err,
+			"index": index,
+		}).Error("Could not index the documents")
+
+		return err
+	}
+
+	result := struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error  map[string]interface{} `json:"error"`
+			Status int                    `json:"status"`
+		} `json:"items"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Error parsing the bulk response body from Elasticsearch")
+
+		return err
+	}
+
+	if result.Errors {
+		failed := 0
+		var firstError map[string]interface{}
+		for _, item := range result.Items {
+			for _, action := range item {
+				if action.Error != nil {
+					if firstError == nil {
+						firstError = action.Error
+					}
+					failed++
+				}
+			}
+		}
+
+		err := fmt.Errorf("%d of the %d documents could not be indexed in the %s index: %v", failed, len(documents), index, firstError)
+
+		log.WithFields(log.Fields{
+			"error":  err,
+			"failed": failed,
+			"index":  index,
+		}).Error("Could not index the documents")
+
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"documents": len(documents),
+		"index":     index,
+		"status":    res.Status(),
+	}).Debug("Documents indexed using Elasticsearch Go client")
+
+	return nil
+}
+
 // DeleteIndex deletes an index from the elasticsearch running in the host
 func DeleteIndex(ctx context.Context, index string) error {
 	esClient, err := getElasticsearchClient()
@@ -67,19 +230,47 @@ func DeleteIndex(ctx context.Context, index string) error {
 	return nil
 }
 
+// GetDataStreamAssertions returns the assertions over the data streams of the elasticsearch running
+// in the host, which retry the searches with the backoff of the retries, capped by the timeout of
+// the running scenario
+func GetDataStreamAssertions() (*datastreams.Assertions, error) {
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return nil, err
+	}
+
+	newBackOff := func(maxElapsedTime time.Duration) backoff.BackOff {
+		return GetExponentialBackOff(maxElapsedTime)
+	}
+
+	return datastreams.New(elasticsearch.NewClient(esClient), newBackOff), nil
+}
+
+// GetElasticsearchClient returns a typed client of the elasticsearch running in the host, i.e. to
+// check the assets installed by the integrations
+func GetElasticsearchClient() (*elasticsearch.Client, error) {
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return elasticsearch.NewClient(esClient), nil
+}
+
 // getElasticsearchClient returns a client connected to the running elasticseach, defined
 // at configuration level. Then we will inspect the running container to get its port bindings
 // and from them, get the one related to the Elasticsearch port (9200). As it is bound to a
 // random port at localhost, we will build the URL with the bound port at localhost.
 //nolint:unused
 func getElasticsearchClient() (*es.Client, error) {
-	return getElasticsearchClientFromHostPort("localhost", 9200)
+	return getElasticsearchClientFromHostPort("localhost", config.GetHostPort(elasticsearchPort))
 }
 
 // getElasticsearchClientFromHostPort returns a client connected to a running elasticseach, defined
 // at configuration level. Then we will inspect the running container to get its port bindings
 // and from them, get the one related to the Elasticsearch port (9200). As it is bound to a
-// random port at localhost, we will build the URL with the bound port at localhost.
+// random port at localhost, we will build the URL with the bound port at localhost, with https
+// when the stack is secured.
 //nolint:unused
 func getElasticsearchClientFromHostPort(host string, port int) (*es.Client, error) {
 	if host == "" {
@@ -87,9 +278,10 @@ func getElasticsearchClientFromHostPort(host string, port int) (*es.Client, erro
 	}
 
 	cfg := es.Config{
-		Addresses: []string{fmt.Sprintf("http://%s:%d", host, port)},
+		Addresses: []string{fmt.Sprintf("%s://%s:%d", config.GetURLScheme(), host, port)},
 		Username:  "elastic",
 		Password:  "changeme",
+		Transport: &observedTransport{},
 	}
 	esClient, err := es.NewClient(cfg)
 	if err != nil {
@@ -104,40 +296,52 @@ func getElasticsearchClientFromHostPort(host string, port int) (*es.Client, erro
 	return esClient, nil
 }
 
-// RetrySearch executes a query over an inddex, with retry options
+// RetrySearch executes a query over an index, retrying it with an exponential backoff with
+// jitter for the time of the given number of attempts, spaced by the retry timeout in seconds
 func RetrySearch(indexName string, esQuery map[string]interface{}, maxAttempts int, retryTimeout int) (SearchResult, error) {
 	totalRetryTime := maxAttempts * retryTimeout
 
-	for attempt := maxAttempts; attempt > 0; attempt-- {
-		result, err := search(indexName, esQuery)
-		if err == nil {
-			return result, nil
-		}
+	exp := GetExponentialBackOff(time.Duration(totalRetryTime) * time.Second)
 
-		if attempt > 1 {
+	retryCount := 1
+	result := SearchResult{}
+
+	searchFn := func() error {
+		hits, err := search(indexName, esQuery)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"attempt":       attempt,
-				"errorCause":    err.Error(),
-				"index":         indexName,
-				"query":         esQuery,
-				"retryAttempts": maxAttempts,
-				"retryTimeout":  retryTimeout,
-			}).Tracef("Waiting %d seconds for the index to be ready", retryTimeout)
-			time.Sleep(time.Duration(retryTimeout) * time.Second)
+				"elapsedTime": exp.GetElapsedTime(),
+				"errorCause":  err.Error(),
+				"index":       indexName,
+				"query":       esQuery,
+				"retry":       retryCount,
+			}).Trace("Waiting for the index to be ready")
+
+			retryCount++
+
+			return err
 		}
+
+		result = hits
+		return nil
 	}
 
-	err := fmt.Errorf("Could not send query to Elasticsearch in the specified time (%d seconds)", totalRetryTime)
+	err := backoff.Retry(searchFn, exp)
+	if err != nil {
+		err = fmt.Errorf("Could not send query to Elasticsearch in the specified time (%d seconds)", totalRetryTime)
 
-	log.WithFields(log.Fields{
-		"error":         err,
-		"index":         indexName,
-		"query":         esQuery,
-		"retryAttempts": maxAttempts,
-		"retryTimeout":  retryTimeout,
-	}).Error(err.Error())
-
-	return SearchResult{}, err
+		log.WithFields(log.Fields{
+			"error":         err,
+			"index":         indexName,
+			"query":         esQuery,
+			"retryAttempts": maxAttempts,
+			"retryTimeout":  retryTimeout,
+		}).Error(err.Error())
+
+		return SearchResult{}, err
+	}
+
+	return result, nil
 }
 
 //nolint:unused
@@ -179,7 +383,12 @@ func search(indexName string, query map[string]interface{}) (SearchResult, error
 	defer res.Body.Close()
 
 	if res.IsError() {
-		var e map[string]interface{}
+		e := struct {
+			Error struct {
+				Reason string `json:"reason"`
+				Type   string `json:"type"`
+			} `json:"error"`
+		}{}
 		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
 			log.WithFields(log.Fields{
 				"error": err,
@@ -188,11 +397,12 @@ func search(indexName string, query map[string]interface{}) (SearchResult, error
 			return result, err
 		}
 
-		err := fmt.Errorf(
-			"Error getting response from Elasticsearch. Status: %s, ResponseError: %v",
-			res.Status(), e)
-
-		return result, err
+		// the typed error is checked with errors.Is, i.e. for elasticsearch.ErrIndexNotFound
+		return result, &elasticsearch.APIError{
+			Reason:     e.Error.Reason,
+			StatusCode: res.StatusCode,
+			Type:       e.Error.Type,
+		}
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
@@ -212,10 +422,10 @@ func search(indexName string, query map[string]interface{}) (SearchResult, error
 	return result, nil
 }
 
-// WaitForElasticsearch waits for elasticsearch running in localhost:9200 to be healthy, returning false
+// WaitForElasticsearch waits for elasticsearch running in localhost to be healthy, returning false
 // if elasticsearch does not get healthy status in a defined number of minutes.
 func WaitForElasticsearch(maxTimeoutMinutes time.Duration) (bool, error) {
-	return WaitForElasticsearchFromHostPort("localhost", 9200, maxTimeoutMinutes)
+	return WaitForElasticsearchFromHostPort("localhost", config.GetHostPort(elasticsearchPort), maxTimeoutMinutes)
 }
 
 // WaitForElasticsearchFromHostPort waits for an elasticsearch running in a host:port to be healthy, returning false
@@ -263,6 +473,66 @@ func WaitForElasticsearchFromHostPort(host string, port int, maxTimeoutMinutes t
 	return true, nil
 }
 
+// WaitForHits waits for a query over an index to return a number of hits at least, returning the
+// typed result of the last search, and its error if the number is not reached in time
+func WaitForHits(index string, query *elasticsearch.Query, desiredHits int, maxTimeout time.Duration) (*elasticsearch.SearchResult, error) {
+	esClient, err := getElasticsearchClient()
+	if err != nil {
+		return nil, err
+	}
+	client := elasticsearch.NewClient(esClient)
+
+	exp := GetExponentialBackOff(maxTimeout)
+
+	retryCount := 1
+	var result *elasticsearch.SearchResult
+
+	numberOfHits := func() error {
+		hits, err := client.Search(context.Background(), index, query)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"desiredHits": desiredHits,
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"index":       index,
+				"retry":       retryCount,
+			}).Warn("There was an error executing the query")
+
+			retryCount++
+			return err
+		}
+
+		result = hits
+
+		hitsCount := len(hits.Hits.Hits)
+		if hitsCount < desiredHits {
+			log.WithFields(log.Fields{
+				"currentHits": hitsCount,
+				"desiredHits": desiredHits,
+				"elapsedTime": exp.GetElapsedTime(),
+				"index":       index,
+				"retry":       retryCount,
+			}).Warn("Waiting for more hits in the index")
+
+			retryCount++
+
+			return fmt.Errorf("Not enough hits in the %s index yet. Current: %d, Desired: %d", index, hitsCount, desiredHits)
+		}
+
+		log.WithFields(log.Fields{
+			"currentHits": hitsCount,
+			"desiredHits": desiredHits,
+			"retries":     retryCount,
+			"elapsedTime": exp.GetElapsedTime(),
+		}).Info("Hits number satisfied")
+
+		return nil
+	}
+
+	err = backoff.Retry(numberOfHits, exp)
+	return result, err
+}
+
 // WaitForIndices waits for the elasticsearch indices to return the list of indices.
 func WaitForIndices() (string, error) {
 	exp := GetExponentialBackOff(60 * time.Second)
@@ -272,7 +542,7 @@ func WaitForIndices() (string, error) {
 
 	catIndices := func() error {
 		r := curl.HTTPRequest{
-			URL:               "http://localhost:9200/_cat/indices?v",
+			URL:               fmt.Sprintf("%s://localhost:%d/_cat/indices?v", config.GetURLScheme(), config.GetHostPort(elasticsearchPort)),
 			BasicAuthPassword: "changeme",
 			BasicAuthUser:     "elastic",
 		}
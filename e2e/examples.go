@@ -0,0 +1,375 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	gherkin "github.com/cucumber/gherkin/go/v26"
+	messages "github.com/cucumber/messages/go/v21"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExamplesExpander returns the rows generated for the examples of a scenario outline, with a cell
+// for each column of its header. It receives the header and the tags of the examples
+type ExamplesExpander func(header []string, tags []string) ([][]string, error)
+
+// examplesExpanders the expanders of the examples, by the tag of the examples they apply to
+var examplesExpanders = map[string]ExamplesExpander{}
+
+// expandedFeatures the feature files with generated examples, by their path
+var expandedFeatures = map[string]*expandedFeature{}
+
+// expandedFeature the content of a feature file with the generated rows of its examples
+type expandedFeature struct {
+	content    []byte
+	insertions []examplesInsertion // sorted by line
+}
+
+// examplesInsertion the rows generated for an examples table, inserted after a line of the
+// original feature file
+type examplesInsertion struct {
+	line int // the last line of the table in the original file
+	rows int
+}
+
+// RegisterExamplesExpander adds an expander generating the rows of the examples with a tag, i.e.
+// @supported-versions, which are appended to the rows written in the feature files before running
+// the suite. It must be called before RunSuite, i.e. in the init function of the suite
+func RegisterExamplesExpander(tag string, expander ExamplesExpander) {
+	examplesExpanders[tag] = expander
+}
+
+// expandFeatures generates the rows of the examples with a registered tag in the feature files of
+// the paths, returning the file system godog must read the features from, and the paths with their
+// lines translated to the expanded files. The file system is nil if no examples were expanded
+func expandFeatures(paths []string) (fs.FS, []string) {
+	if len(examplesExpanders) == 0 {
+		return nil, paths
+	}
+
+	walkPaths := paths
+	if len(walkPaths) == 0 {
+		walkPaths = []string{"features"}
+	}
+
+	for _, p := range walkPaths {
+		featurePath, _ := splitFeatureLine(p)
+
+		_ = filepath.Walk(featurePath, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".feature") {
+				return nil
+			}
+
+			key := featureKey(path)
+			if _, exists := expandedFeatures[key]; exists {
+				return nil
+			}
+
+			expanded, err := expandFeature(path)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error":   err,
+					"feature": path,
+				}).Warn("Could not expand the examples of the feature file, they are run as written")
+				return nil
+			}
+
+			if expanded != nil {
+				expandedFeatures[key] = expanded
+			}
+
+			return nil
+		})
+	}
+
+	if len(expandedFeatures) == 0 {
+		return nil, paths
+	}
+
+	translated := []string{}
+	for _, p := range paths {
+		featurePath, line := splitFeatureLine(p)
+		expanded, exists := expandedFeatures[featureKey(featurePath)]
+		if line < 0 || !exists {
+			translated = append(translated, p)
+			continue
+		}
+
+		translated = append(translated, fmt.Sprintf("%s:%d", featurePath, expanded.toExpandedLine(line)))
+	}
+
+	return featuresFS{}, translated
+}
+
+// expandFeature generates the rows of the examples with a registered tag of a feature file,
+// returning nil if it has none
+func expandFeature(path string) (*expandedFeature, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := gherkin.ParseGherkinDocument(bytes.NewReader(content), (&messages.Incrementing{}).NewId)
+	if err != nil {
+		return nil, err
+	}
+	if document.Feature == nil {
+		return nil, nil
+	}
+
+	scenarios := []*messages.Scenario{}
+	for _, child := range document.Feature.Children {
+		if child.Scenario != nil {
+			scenarios = append(scenarios, child.Scenario)
+		}
+		if child.Rule != nil {
+			for _, ruleChild := range child.Rule.Children {
+				if ruleChild.Scenario != nil {
+					scenarios = append(scenarios, ruleChild.Scenario)
+				}
+			}
+		}
+	}
+
+	generated := map[int][]string{} // the generated lines, by the line they are inserted after
+	for _, scenario := range scenarios {
+		for _, examples := range scenario.Examples {
+			lines := expandExamples(path, examples)
+			if len(lines) == 0 {
+				continue
+			}
+
+			last := examples.TableHeader.Location.Line
+			if len(examples.TableBody) > 0 {
+				last = examples.TableBody[len(examples.TableBody)-1].Location.Line
+			}
+			generated[int(last)] = lines
+		}
+	}
+
+	if len(generated) == 0 {
+		return nil, nil
+	}
+
+	expanded := &expandedFeature{insertions: []examplesInsertion{}}
+	for line, lines := range generated {
+		expanded.insertions = append(expanded.insertions, examplesInsertion{line: line, rows: len(lines)})
+	}
+	sort.Slice(expanded.insertions, func(i, j int) bool {
+		return expanded.insertions[i].line < expanded.insertions[j].line
+	})
+
+	var buf bytes.Buffer
+	for i, line := range strings.SplitAfter(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+
+		buf.WriteString(line)
+		if lines, exists := generated[i+1]; exists {
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString("\n")
+			}
+			for _, l := range lines {
+				buf.WriteString(l + "\n")
+			}
+		}
+	}
+	expanded.content = buf.Bytes()
+
+	log.WithFields(log.Fields{
+		"examples": len(expanded.insertions),
+		"feature":  path,
+	}).Debug("The examples of the feature file were expanded")
+
+	return expanded, nil
+}
+
+// expandExamples returns the table rows generated for an examples table by the expander of its
+// tags, if any, formatted with the indentation of its header
+func expandExamples(path string, examples *messages.Examples) []string {
+	if examples.TableHeader == nil {
+		return nil
+	}
+
+	tags := []string{}
+	for _, tag := range examples.Tags {
+		tags = append(tags, tag.Name)
+	}
+
+	header := []string{}
+	for _, cell := range examples.TableHeader.Cells {
+		header = append(header, cell.Value)
+	}
+
+	indentation := strings.Repeat(" ", int(examples.TableHeader.Location.Column)-1)
+
+	lines := []string{}
+	for _, tag := range tags {
+		expander, exists := examplesExpanders[tag]
+		if !exists {
+			continue
+		}
+
+		rows, err := expander(header, tags)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"examples": examples.Name,
+				"feature":  path,
+				"tag":      tag,
+			}).Warn("Could not generate the rows of the examples, they are run as written")
+			continue
+		}
+
+		for _, row := range rows {
+			if len(row) != len(header) {
+				log.WithFields(log.Fields{
+					"examples": examples.Name,
+					"feature":  path,
+					"header":   header,
+					"row":      row,
+					"tag":      tag,
+				}).Warn("The generated row does not match the header of the examples, it will be ignored")
+				continue
+			}
+
+			cells := []string{}
+			for _, cell := range row {
+				cells = append(cells, escapeTableCell(cell))
+			}
+			lines = append(lines, indentation+"| "+strings.Join(cells, " | ")+" |")
+		}
+	}
+
+	return lines
+}
+
+// toExpandedLine translates a line of the original feature file to the expanded one
+func (e *expandedFeature) toExpandedLine(line int) int {
+	expandedLine := line
+	for _, insertion := range e.insertions {
+		if insertion.line >= line {
+			break
+		}
+		expandedLine += insertion.rows
+	}
+
+	return expandedLine
+}
+
+// toOriginalLine translates a line of the expanded feature file to the original one. The generated
+// rows are translated to the last line of their table
+func (e *expandedFeature) toOriginalLine(line int) int {
+	offset := 0
+	for _, insertion := range e.insertions {
+		if line <= insertion.line+offset {
+			break
+		}
+		if line <= insertion.line+offset+insertion.rows {
+			return insertion.line
+		}
+		offset += insertion.rows
+	}
+
+	return line - offset
+}
+
+// readFeatureFile returns the content of a feature file as godog reads it, with the generated rows of
+// its examples, and translates its lines back to the original file
+func readFeatureFile(path string) ([]byte, func(line int) int, error) {
+	if expanded, exists := expandedFeatures[featureKey(path)]; exists {
+		return expanded.content, expanded.toOriginalLine, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	return content, func(line int) int { return line }, err
+}
+
+// escapeTableCell escapes the characters with a meaning in the cells of a gherkin table
+func escapeTableCell(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "|", `\|`)
+
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// featureKey normalises the path of a feature file, as it's the key of the expanded features
+func featureKey(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// splitFeatureLine splits the line from a path in godog's "file.feature:line" format, which is -1
+// if it has none
+func splitFeatureLine(path string) (string, int) {
+	i := strings.LastIndexByte(path, ':')
+	if i < 0 {
+		return path, -1
+	}
+
+	line, err := strconv.Atoi(path[i+1:])
+	if err != nil {
+		return path, -1
+	}
+
+	return path[:i], line
+}
+
+// featuresFS the file system godog reads the features from, serving the expanded feature files from
+// memory and the rest from the disk
+type featuresFS struct{}
+
+// Open opens a file of the features
+func (featuresFS) Open(name string) (fs.File, error) {
+	expanded, exists := expandedFeatures[featureKey(name)]
+	if !exists {
+		return os.Open(name)
+	}
+
+	return &expandedFile{
+		Reader: bytes.NewReader(expanded.content),
+		info:   expandedFileInfo{name: filepath.Base(name), size: int64(len(expanded.content))},
+	}, nil
+}
+
+// expandedFile an expanded feature file opened from memory
+type expandedFile struct {
+	*bytes.Reader
+	info expandedFileInfo
+}
+
+// Close closes the file
+func (f *expandedFile) Close() error {
+	return nil
+}
+
+// Stat returns the info of the file
+func (f *expandedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// expandedFileInfo the info of an expanded feature file
+type expandedFileInfo struct {
+	name string
+	size int64
+}
+
+func (i expandedFileInfo) Name() string       { return i.name }
+func (i expandedFileInfo) Size() int64        { return i.size }
+func (i expandedFileInfo) Mode() fs.FileMode  { return 0444 }
+func (i expandedFileInfo) ModTime() time.Time { return time.Time{} }
+func (i expandedFileInfo) IsDir() bool        { return false }
+func (i expandedFileInfo) Sys() interface{}   { return nil }
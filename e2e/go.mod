@@ -1,17 +1,24 @@
 module github.com/elastic/e2e-testing/e2e
 
-go 1.14
+go 1.16
 
 require (
 	github.com/Jeffail/gabs/v2 v2.5.1
 	github.com/cenkalti/backoff/v4 v4.0.2
-	github.com/cucumber/godog v0.10.0
-	github.com/cucumber/messages-go/v10 v10.0.3
+	github.com/cucumber/gherkin/go/v26 v26.2.0
+	github.com/cucumber/godog v0.13.0
+	github.com/cucumber/messages/go/v21 v21.0.1
+	github.com/docker/docker v0.7.3-0.20190506211059-b20a14b54661
 	github.com/elastic/e2e-testing/cli v0.0.0-20200717181709-15d2db53ded7
 	github.com/elastic/go-elasticsearch/v8 v8.0.0-20190731061900-ea052088db25
 	github.com/google/uuid v1.1.1
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.4.2
+	github.com/stretchr/testify v1.8.2
+	go.elastic.co/apm v1.15.0
+	go.elastic.co/apm/module/apmhttp v1.15.0
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf
+	gopkg.in/yaml.v2 v2.3.0
 )
 
 replace github.com/elastic/e2e-testing/cli v0.0.0-20200717181709-15d2db53ded7 => ../cli
@@ -0,0 +1,312 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// IngestMonitorDataStreamsEnvVar the environment variable enabling the monitor of the ingestion, with
+// the data streams, or patterns, whose documents are counted during the scenarios, i.e.
+// "logs-elastic_agent-default,metrics-system.*"
+const IngestMonitorDataStreamsEnvVar = "INGEST_MONITOR_DATA_STREAMS"
+
+// IngestMonitorIntervalEnvVar the environment variable setting the interval between the counts of the
+// documents of the monitored data streams
+const IngestMonitorIntervalEnvVar = "INGEST_MONITOR_INTERVAL"
+
+// defaultIngestMonitorInterval the default interval between the counts of the documents
+const defaultIngestMonitorInterval = 10 * time.Second
+
+// ingestSample the number of documents of the monitored data streams at a time of a scenario
+type ingestSample struct {
+	Counts map[string]int    `json:"counts"`           // by data stream or pattern
+	Errors map[string]string `json:"errors,omitempty"` // the errors counting the documents of a data stream, by data stream
+	Time   time.Time         `json:"time"`
+}
+
+// ingestMonitor samples the number of documents of some data streams in the background while a
+// scenario runs
+type ingestMonitor struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	mutex   sync.Mutex
+	samples []ingestSample
+}
+
+// ingestMonitors the monitors of the running scenarios, by the ID of their pickle
+var ingestMonitors = struct {
+	mutex    sync.Mutex
+	monitors map[string]*ingestMonitor
+}{
+	monitors: map[string]*ingestMonitor{},
+}
+
+// GetIngestMonitorDataStreams returns the data streams, or patterns, whose documents are counted
+// during the scenarios, read from the INGEST_MONITOR_DATA_STREAMS environment variable. The monitor
+// is disabled if there are none
+func GetIngestMonitorDataStreams() []string {
+	dataStreams := []string{}
+
+	for _, dataStream := range strings.Split(shell.GetEnv(IngestMonitorDataStreamsEnvVar, ""), ",") {
+		dataStream = strings.TrimSpace(dataStream)
+		if dataStream != "" {
+			dataStreams = append(dataStreams, dataStream)
+		}
+	}
+
+	return dataStreams
+}
+
+// getIngestMonitorInterval returns the interval between the counts of the documents, read from the
+// INGEST_MONITOR_INTERVAL environment variable, i.e. 5s
+func getIngestMonitorInterval() time.Duration {
+	value := shell.GetEnv(IngestMonitorIntervalEnvVar, "")
+	if value == "" {
+		return defaultIngestMonitorInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		log.WithFields(log.Fields{
+			"default":  defaultIngestMonitorInterval,
+			"error":    err,
+			"interval": value,
+		}).Warn("The interval of the monitor of the ingestion is not valid, using the default one")
+		return defaultIngestMonitorInterval
+	}
+
+	return interval
+}
+
+// registerIngestMonitor adds the hooks counting the documents of the monitored data streams in the
+// background while each scenario runs, adding the timeline of the counts to its report, and to its
+// artifacts bundle if it fails, so that a failed assertion about the new data in an index tells if
+// the ingestion never started, stalled, or kept going. They must be added after the hooks starting
+// the report of the scenario and before the ones ending it, and do nothing if there are no data
+// streams to monitor
+func registerIngestMonitor(s *godog.ScenarioContext) {
+	dataStreams := GetIngestMonitorDataStreams()
+	if len(dataStreams) == 0 {
+		return
+	}
+
+	interval := getIngestMonitorInterval()
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		monitor := startIngestMonitor(dataStreams, interval)
+
+		ingestMonitors.mutex.Lock()
+		ingestMonitors.monitors[pickle.Id] = monitor
+		ingestMonitors.mutex.Unlock()
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		ingestMonitors.mutex.Lock()
+		monitor := ingestMonitors.monitors[pickle.Id]
+		delete(ingestMonitors.monitors, pickle.Id)
+		ingestMonitors.mutex.Unlock()
+
+		if monitor == nil {
+			return ctx, nil
+		}
+
+		samples := monitor.stop(dataStreams)
+		report.setIngestTimeline(pickle.Id, samples)
+
+		if err != nil {
+			bundleDir, dirErr := GetScenarioOutputsDir(pickle.Name)
+			if dirErr == nil {
+				_ = WriteArtifact(bundleDir, "ingest-timeline.txt", formatIngestTimeline(dataStreams, samples))
+			}
+		}
+
+		return ctx, nil
+	})
+}
+
+// startIngestMonitor starts counting the documents of some data streams at an interval, until the
+// monitor is stopped
+func startIngestMonitor(dataStreams []string, interval time.Duration) *ingestMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	monitor := &ingestMonitor{
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		samples: []ingestSample{},
+	}
+
+	go func() {
+		defer close(monitor.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			monitor.sample(ctx, dataStreams)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return monitor
+}
+
+// sample counts the documents of the data streams, recording the errors of the ones which could not
+// be counted, i.e. while Elasticsearch is not running yet
+func (m *ingestMonitor) sample(ctx context.Context, dataStreams []string) {
+	sample := ingestSample{
+		Counts: map[string]int{},
+		Time:   time.Now(),
+	}
+
+	esClient, err := getElasticsearchClient()
+	for _, dataStream := range dataStreams {
+		if err == nil {
+			count, countErr := elasticsearch.NewClient(esClient).CountDocuments(ctx, dataStream)
+			if countErr == nil {
+				sample.Counts[dataStream] = count
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			sample.addError(dataStream, countErr)
+			continue
+		}
+
+		sample.addError(dataStream, err)
+	}
+
+	m.mutex.Lock()
+	m.samples = append(m.samples, sample)
+	m.mutex.Unlock()
+}
+
+// addError records the error counting the documents of a data stream
+func (s *ingestSample) addError(dataStream string, err error) {
+	if s.Errors == nil {
+		s.Errors = map[string]string{}
+	}
+
+	s.Errors[dataStream] = err.Error()
+}
+
+// stop stops the monitor, taking a last sample, and returns the samples of the scenario
+func (m *ingestMonitor) stop(dataStreams []string) []ingestSample {
+	m.cancel()
+	<-m.done
+
+	// the scenario context could be already done
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	m.sample(ctx, dataStreams)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.samples
+}
+
+// ingestVerdicts returns the state of the ingestion of each data stream in the samples: never
+// started if it had no documents, stalled since the last time its documents increased if they did
+// not increase in the last sample, and ingesting otherwise
+func ingestVerdicts(dataStreams []string, samples []ingestSample) map[string]string {
+	verdicts := map[string]string{}
+
+	for _, dataStream := range dataStreams {
+		previous := -1
+		last := -1
+		var increasedAt time.Time
+		increasing := false
+
+		for _, sample := range samples {
+			count, exists := sample.Counts[dataStream]
+			if !exists {
+				continue
+			}
+
+			increasing = previous >= 0 && count > previous
+			if increasing || (previous < 0 && count > 0) {
+				increasedAt = sample.Time
+			}
+
+			previous = count
+			last = count
+		}
+
+		switch {
+		case last < 0:
+			verdicts[dataStream] = "not counted"
+		case last == 0:
+			verdicts[dataStream] = "never started"
+		case increasing:
+			verdicts[dataStream] = fmt.Sprintf("ingesting, %d documents", last)
+		default:
+			verdicts[dataStream] = fmt.Sprintf("stalled since %s, %d documents", increasedAt.UTC().Format(time.RFC3339), last)
+		}
+	}
+
+	return verdicts
+}
+
+// formatIngestTimeline formats the samples of a scenario as a table, with a row per sample and a
+// column per data stream, headed by the state of the ingestion of each data stream
+func formatIngestTimeline(dataStreams []string, samples []ingestSample) string {
+	var out strings.Builder
+
+	verdicts := ingestVerdicts(dataStreams, samples)
+	for _, dataStream := range dataStreams {
+		fmt.Fprintf(&out, "%s: %s\n", dataStream, verdicts[dataStream])
+	}
+	out.WriteString("\n")
+
+	fmt.Fprintf(&out, "%-20s %s\n", "time", strings.Join(dataStreams, " "))
+	for _, sample := range samples {
+		counts := []string{}
+		for _, dataStream := range dataStreams {
+			count, exists := sample.Counts[dataStream]
+			if !exists {
+				counts = append(counts, fmt.Sprintf("%*s", len(dataStream), "error"))
+				continue
+			}
+
+			counts = append(counts, fmt.Sprintf("%*d", len(dataStream), count))
+		}
+
+		fmt.Fprintf(&out, "%-20s %s\n", sample.Time.UTC().Format(time.RFC3339), strings.Join(counts, " "))
+	}
+
+	errors := []string{}
+	for _, sample := range samples {
+		for _, dataStream := range dataStreams {
+			if err, exists := sample.Errors[dataStream]; exists {
+				errors = append(errors, fmt.Sprintf("%s %s: %s\n", sample.Time.UTC().Format(time.RFC3339), dataStream, err))
+			}
+		}
+	}
+	if len(errors) > 0 {
+		out.WriteString("\n" + strings.Join(errors, ""))
+	}
+
+	return out.String()
+}
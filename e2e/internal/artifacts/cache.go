@@ -0,0 +1,205 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// cacheEntrySuffix the suffix of the file describing a cached download, next to it
+const cacheEntrySuffix = ".cache.json"
+
+// CacheOptions the options of a download without a checksum reused from the cache
+type CacheOptions struct {
+	DownloadOptions
+	// Refresh if the file is downloaded again, ignoring the cached one
+	Refresh bool
+	// TTL the time the cached file is reused before checking if it changed
+	TTL time.Duration
+}
+
+// cacheEntry describes a download without a checksum in the cache: where it was downloaded from,
+// when, the validators of its version served by the server, and the SHA-256 checksum of its
+// content, so that a truncated or modified file is not reused
+type cacheEntry struct {
+	DownloadedAt time.Time `json:"downloaded_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	SHA256       string    `json:"sha256"`
+	URL          string    `json:"url"`
+}
+
+// DownloadCached downloads a file without a checksum to its path in the cache, reusing the cached
+// one for the TTL of the cache, unless it's refreshed. Once it expires, the cached file is reused
+// while the server serves the same version of it, as told by its ETag or its last modification,
+// or if the server is not reachable
+func DownloadCached(fileURL string, filePath string, options CacheOptions) error {
+	entry, cached := readCacheEntry(filePath)
+	if cached && !options.Refresh {
+		age := time.Since(entry.DownloadedAt)
+		if age < options.TTL {
+			log.WithFields(log.Fields{
+				"age":  age,
+				"path": filePath,
+				"url":  fileURL,
+			}).Info("Retrieving the file from the cache, as it was downloaded recently")
+			return nil
+		}
+
+		validators, unchanged, err := revalidate(fileURL, entry, options.DownloadOptions)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"path":  filePath,
+				"url":   fileURL,
+			}).Warn("Could not check if the cached file changed, retrieving it from the cache")
+			return nil
+		}
+
+		if unchanged {
+			log.WithFields(log.Fields{
+				"path": filePath,
+				"url":  fileURL,
+			}).Info("Retrieving the file from the cache, as it did not change")
+			entry.DownloadedAt = time.Now()
+			return writeCacheEntry(filePath, entry)
+		}
+
+		entry = validators
+	} else {
+		// the validators are optional, so the file is downloaded without them
+		entry, _, _ = revalidate(fileURL, cacheEntry{}, options.DownloadOptions)
+	}
+
+	_ = os.Remove(filePath + cacheEntrySuffix)
+	_ = os.Remove(filePath)
+
+	err := DownloadTo(fileURL, filePath, options.DownloadOptions)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := getSHA256(filePath)
+	if err != nil {
+		return err
+	}
+
+	entry.DownloadedAt = time.Now()
+	entry.SHA256 = checksum
+	entry.URL = fileURL
+
+	return writeCacheEntry(filePath, entry)
+}
+
+// revalidate requests the validators of the version of a file served by a server, its ETag and its
+// last modification, returning them and if they match the ones of a cached file
+func revalidate(fileURL string, entry cacheEntry, options DownloadOptions) (cacheEntry, bool, error) {
+	req, err := http.NewRequestWithContext(options.Context, http.MethodHead, fileURL, nil)
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+
+	resp, err := options.Client.Do(req)
+	if err != nil {
+		return cacheEntry{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return entry, true, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return cacheEntry{}, false, fmt.Errorf("the server responded %d to the request of the validators of %s", resp.StatusCode, fileURL)
+	}
+
+	validators := cacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	unchanged := (validators.ETag != "" && validators.ETag == entry.ETag) ||
+		(validators.ETag == "" && validators.LastModified != "" && validators.LastModified == entry.LastModified)
+
+	return validators, unchanged, nil
+}
+
+// readCacheEntry reads the entry of a cached file, which is false if the file is not cached, or
+// if its content does not match the checksum of the entry
+func readCacheEntry(filePath string) (cacheEntry, bool) {
+	content, err := ioutil.ReadFile(filePath + cacheEntrySuffix)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	entry := cacheEntry{}
+	err = json.Unmarshal(content, &entry)
+	if err != nil || entry.SHA256 == "" {
+		return cacheEntry{}, false
+	}
+
+	checksum, err := getSHA256(filePath)
+	if err != nil || checksum != entry.SHA256 {
+		log.WithFields(log.Fields{
+			"path": filePath,
+			"url":  entry.URL,
+		}).Debug("The cached file does not match its checksum, it will be downloaded again")
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+// writeCacheEntry writes the entry of a cached file next to it
+func writeCacheEntry(filePath string, entry cacheEntry) error {
+	content, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filePath+cacheEntrySuffix, content, 0666)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+		}).Warn("Could not write the entry of the cached file, it will be downloaded again")
+		return err
+	}
+
+	return nil
+}
+
+// getSHA256 returns the SHA-256 checksum of a file
+func getSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,213 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// versionedServer serves a file with an ETag, which changes with its content, counting the
+// requests by method
+type versionedServer struct {
+	*httptest.Server
+
+	content  string
+	etag     string
+	mutex    sync.Mutex
+	requests map[string]int
+}
+
+func newVersionedServer(content string, etag string) *versionedServer {
+	s := &versionedServer{content: content, etag: etag, requests: map[string]int{}}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.requests[r.Method]++
+
+		w.Header().Set("ETag", s.etag)
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(s.content))
+		}
+	}))
+
+	return s
+}
+
+// update changes the content of the file served by the server, and its ETag
+func (s *versionedServer) update(content string, etag string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.content = content
+	s.etag = etag
+}
+
+// count returns the number of requests by method
+func (s *versionedServer) count(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[method]
+}
+
+func testCacheOptions() CacheOptions {
+	return CacheOptions{
+		DownloadOptions: testDownloadOptions(),
+		TTL:             time.Hour,
+	}
+}
+
+// expireCacheEntry moves the time of the download of a cached file back beyond the TTL
+func expireCacheEntry(t *testing.T, filePath string) {
+	entry, cached := readCacheEntry(filePath)
+	assert.True(t, cached)
+
+	entry.DownloadedAt = time.Now().Add(-2 * time.Hour)
+	assert.Nil(t, writeCacheEntry(filePath, entry))
+}
+
+func assertFileContent(t *testing.T, filePath string, expected string) {
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(content))
+}
+
+func TestDownloadCached(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "first")
+	assert.Equal(t, 1, server.count(http.MethodGet))
+
+	entry, cached := readCacheEntry(filePath)
+	assert.True(t, cached)
+	assert.Equal(t, `"v1"`, entry.ETag)
+	assert.Equal(t, server.URL, entry.URL)
+}
+
+func TestDownloadCachedWithinTheTTL(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	server.update("second", `"v2"`)
+	heads := server.count(http.MethodHead)
+
+	// the server is not even asked if the file changed
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "first")
+	assert.Equal(t, 1, server.count(http.MethodGet))
+	assert.Equal(t, heads, server.count(http.MethodHead))
+}
+
+func TestDownloadCachedExpiredButUnchanged(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	expireCacheEntry(t, filePath)
+
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "first")
+	assert.Equal(t, 1, server.count(http.MethodGet))
+
+	// the TTL starts again once the file is revalidated
+	entry, cached := readCacheEntry(filePath)
+	assert.True(t, cached)
+	assert.True(t, time.Since(entry.DownloadedAt) < time.Minute)
+}
+
+func TestDownloadCachedExpiredAndChanged(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	expireCacheEntry(t, filePath)
+	server.update("second", `"v2"`)
+
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "second")
+	assert.Equal(t, 2, server.count(http.MethodGet))
+
+	entry, _ := readCacheEntry(filePath)
+	assert.Equal(t, `"v2"`, entry.ETag)
+}
+
+func TestDownloadCachedExpiredWithTheServerDown(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	expireCacheEntry(t, filePath)
+	server.Close()
+
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "first")
+}
+
+func TestDownloadCachedRefreshed(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	server.update("second", `"v2"`)
+
+	options := testCacheOptions()
+	options.Refresh = true
+
+	// the file is downloaded again within the TTL
+	err := DownloadCached(server.URL, filePath, options)
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "second")
+	assert.Equal(t, 2, server.count(http.MethodGet))
+}
+
+func TestDownloadCachedWithAModifiedFile(t *testing.T) {
+	server := newVersionedServer("first", `"v1"`)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, DownloadCached(server.URL, filePath, testCacheOptions()))
+
+	// the cached file does not match its checksum, so it's downloaded again within the TTL
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("firs"), 0666))
+
+	err := DownloadCached(server.URL, filePath, testCacheOptions())
+	assert.Nil(t, err)
+	assertFileContent(t, filePath, "first")
+	assert.Equal(t, 2, server.count(http.MethodGet))
+}
@@ -0,0 +1,244 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// DownloadOptions the options of a download
+type DownloadOptions struct {
+	// BackOff the backoff of the retries of the download, which bounds the time spent on it
+	BackOff *backoff.ExponentialBackOff
+	// Client the HTTP client of the download
+	Client *http.Client
+	// Context the context of the download, which cancels it when it's done
+	Context context.Context
+	// IdleTimeout the time after which a download not receiving data is considered stalled
+	IdleTimeout time.Duration
+}
+
+// DownloadTo downloads a file to a path, writing it to a partial file first, so that an
+// interrupted download is resumed, and not mistaken for a complete one
+func DownloadTo(fileURL string, filePath string, options DownloadOptions) error {
+	err := os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+		}).Error("Could not create the dir for the download")
+		return err
+	}
+
+	partialPath := filePath + ".part"
+
+	err = DownloadWithResume(fileURL, partialPath, options)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(partialPath, filePath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+		}).Error("Could not move the downloaded file")
+		return err
+	}
+
+	_ = os.Chmod(filePath, 0666)
+
+	log.WithFields(log.Fields{
+		"path": filePath,
+		"url":  fileURL,
+	}).Debug("File downloaded")
+
+	return nil
+}
+
+// DownloadWithResume downloads a URL into a file, retrying it when it fails. Each retry resumes the
+// download from the bytes already written, using HTTP range requests, so that large files, such as
+// the agent packages, are not downloaded again from the beginning. A download which does not
+// receive any data in the idle timeout is considered stalled, and it's retried too
+func DownloadWithResume(url string, filePath string, options DownloadOptions) error {
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+			"url":   url,
+		}).Error("Could not open the file for the download")
+		return err
+	}
+	defer f.Close()
+
+	exp := options.BackOff
+
+	retryCount := 1
+
+	download := func() error {
+		offset, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		ctx, cancel := context.WithCancel(options.Context)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+
+		resp, err := options.Client.Do(req)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"path":        filePath,
+				"retry":       retryCount,
+				"url":         url,
+			}).Warn("Could not download the file")
+
+			retryCount++
+
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if offset > 0 {
+				// the server does not support ranges, so the download starts again
+				log.WithFields(log.Fields{
+					"offset": offset,
+					"url":    url,
+				}).Debug("The server does not support resuming the download, starting it again")
+
+				err = f.Truncate(0)
+				if err != nil {
+					return backoff.Permanent(err)
+				}
+				_, err = f.Seek(0, io.SeekStart)
+				if err != nil {
+					return backoff.Permanent(err)
+				}
+			}
+		case http.StatusPartialContent:
+			log.WithFields(log.Fields{
+				"offset": offset,
+				"url":    url,
+			}).Debug("Resuming the download")
+		case http.StatusRequestedRangeNotSatisfiable:
+			// the file was completely downloaded before the interruption
+			if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+				return nil
+			}
+
+			_ = f.Truncate(0)
+
+			retryCount++
+
+			return fmt.Errorf("the download of %s could not be resumed from %d bytes", url, offset)
+		default:
+			err = fmt.Errorf("the download of %s failed with %d", url, resp.StatusCode)
+
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"path":        filePath,
+				"retry":       retryCount,
+				"status":      resp.StatusCode,
+				"url":         url,
+			}).Warn("Could not download the file")
+
+			retryCount++
+
+			// the client errors won't be fixed by retrying, except for throttling and timeouts
+			if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+				resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+				return backoff.Permanent(err)
+			}
+
+			return err
+		}
+
+		// cancel the download if it stalls
+		idleTimer := time.AfterFunc(options.IdleTimeout, cancel)
+		defer idleTimer.Stop()
+
+		written, err := io.Copy(f, &idleTimeoutReader{reader: resp.Body, timer: idleTimer, timeout: options.IdleTimeout})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"path":        filePath,
+				"retry":       retryCount,
+				"url":         url,
+				"written":     offset + written,
+			}).Warn("The download was interrupted, it will be resumed")
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"elapsedTime": exp.GetElapsedTime(),
+			"retries":     retryCount,
+			"path":        filePath,
+			"size":        offset + written,
+			"url":         url,
+		}).Trace("File downloaded")
+
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"url":  url,
+		"path": filePath,
+	}).Trace("Downloading file")
+
+	err = backoff.Retry(download, exp)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  filePath,
+			"url":   url,
+		}).Error("Could not download the file")
+		return err
+	}
+
+	return nil
+}
+
+// idleTimeoutReader resets a timer every time it reads data, so that the timer only fires when
+// the reads stall
+type idleTimeoutReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// Read reads from the underlying reader, resetting the timer
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+
+	return n, err
+}
@@ -0,0 +1,236 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// packageContent the content of the package served by the test servers
+var packageContent = bytes.Repeat([]byte("elastic-agent"), 1024)
+
+// testDownloadOptions returns the options of a download with short waits, so that the retries do
+// not slow down the tests
+func testDownloadOptions() DownloadOptions {
+	exp := backoff.NewExponentialBackOff()
+	exp.InitialInterval = time.Millisecond
+	exp.MaxInterval = 10 * time.Millisecond
+	exp.MaxElapsedTime = 5 * time.Second
+	exp.Reset()
+
+	return DownloadOptions{
+		BackOff:     exp,
+		Client:      http.DefaultClient,
+		Context:     context.Background(),
+		IdleTimeout: time.Second,
+	}
+}
+
+// rangeRecorder records the Range headers of the requests of a test server
+type rangeRecorder struct {
+	mutex  sync.Mutex
+	ranges []string
+}
+
+func (r *rangeRecorder) record(req *http.Request) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ranges = append(r.ranges, req.Header.Get("Range"))
+	return len(r.ranges)
+}
+
+func (r *rangeRecorder) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.ranges...)
+}
+
+// newPackageServer returns a server of the package supporting range requests
+func newPackageServer(recorder *rangeRecorder) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.record(r)
+		http.ServeContent(w, r, "elastic-agent.tar.gz", time.Time{}, bytes.NewReader(packageContent))
+	}))
+}
+
+func TestDownloadTo(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := newPackageServer(recorder)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "downloads", "elastic-agent.tar.gz")
+
+	err := DownloadTo(server.URL, filePath, testDownloadOptions())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{""}, recorder.get())
+
+	// the partial file is renamed once the download is complete
+	_, err = os.Stat(filePath + ".part")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadToResumesThePartialFile(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := newPackageServer(recorder)
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(filePath+".part", packageContent[:1000], 0666))
+
+	err := DownloadTo(server.URL, filePath, testDownloadOptions())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{"bytes=1000-"}, recorder.get())
+}
+
+func TestDownloadWithResumeOfACompleteFile(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := newPackageServer(recorder)
+	defer server.Close()
+
+	// the server responds 416 to the range after the end of the file, which is complete
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz.part")
+	assert.Nil(t, ioutil.WriteFile(filePath, packageContent, 0666))
+
+	err := DownloadWithResume(server.URL, filePath, testDownloadOptions())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{"bytes=" + strconv.Itoa(len(packageContent)) + "-"}, recorder.get())
+}
+
+func TestDownloadWithResumeRestartsWithoutRangeSupport(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder.record(r)
+		_, _ = w.Write(packageContent)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz.part")
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("stale bytes"), 0666))
+
+	err := DownloadWithResume(server.URL, filePath, testDownloadOptions())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{"bytes=11-"}, recorder.get())
+}
+
+func TestDownloadWithResumeAfterAnInterruption(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if recorder.record(r) == 1 {
+			// the connection is closed in the middle of the download
+			w.Header().Set("Content-Length", strconv.Itoa(len(packageContent)))
+			_, _ = w.Write(packageContent[:2000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+
+		http.ServeContent(w, r, "elastic-agent.tar.gz", time.Time{}, bytes.NewReader(packageContent))
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz.part")
+
+	err := DownloadWithResume(server.URL, filePath, testDownloadOptions())
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{"", "bytes=2000-"}, recorder.get())
+}
+
+func TestDownloadWithResumeOfAStalledDownload(t *testing.T) {
+	recorder := &rangeRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if recorder.record(r) == 1 {
+			// the download stalls until the client gives up on it
+			w.Header().Set("Content-Length", strconv.Itoa(len(packageContent)))
+			_, _ = w.Write(packageContent[:3000])
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		http.ServeContent(w, r, "elastic-agent.tar.gz", time.Time{}, bytes.NewReader(packageContent))
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz.part")
+
+	options := testDownloadOptions()
+	options.IdleTimeout = 50 * time.Millisecond
+
+	err := DownloadWithResume(server.URL, filePath, options)
+	assert.Nil(t, err)
+
+	content, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, packageContent, content)
+	assert.Equal(t, []string{"", "bytes=3000-"}, recorder.get())
+}
+
+func TestDownloadWithResumeErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		retried    bool
+	}{
+		{"not found is not retried", http.StatusNotFound, false},
+		{"forbidden is not retried", http.StatusForbidden, false},
+		{"throttling is retried", http.StatusTooManyRequests, true},
+		{"server errors are retried", http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := &rangeRecorder{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				recorder.record(r)
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			options := testDownloadOptions()
+			options.BackOff.MaxElapsedTime = 100 * time.Millisecond
+
+			filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz.part")
+
+			err := DownloadWithResume(server.URL, filePath, options)
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), strconv.Itoa(tt.statusCode))
+			assert.Equal(t, tt.retried, len(recorder.get()) > 1)
+		})
+	}
+}
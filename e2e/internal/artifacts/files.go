@@ -0,0 +1,61 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// CachePath returns the path where a file is cached in a dir, which is namespaced by its URL,
+// as different builds of a snapshot share the name of the file
+func CachePath(cacheDir string, fileURL string) string {
+	hash := sha256.Sum256([]byte(fileURL))
+
+	return filepath.Join(cacheDir, hex.EncodeToString(hash[:])[:16], FileNameFromURL(fileURL))
+}
+
+// FileNameFromURL returns the name of the file of a URL, without the query string
+func FileNameFromURL(fileURL string) string {
+	fileName := path.Base(fileURL)
+	if u, err := url.Parse(fileURL); err == nil {
+		// i.e. the media links of the objects in Google Cloud Storage escape the path of the object
+		fileName = path.Base(u.Path)
+		if unescaped, err := url.PathUnescape(fileName); err == nil {
+			fileName = path.Base(unescaped)
+		}
+	}
+
+	return fileName
+}
+
+// VerifyChecksum checks that the SHA-512 checksum of a file matches the expected one
+func VerifyChecksum(filePath string, checksum string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha512.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if actual != checksum {
+		return fmt.Errorf("the SHA-512 checksum of %s (%d bytes) is %s, but %s was expected: the download is truncated or corrupted", filePath, size, actual, checksum)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePath(t *testing.T) {
+	first := CachePath("/cache", "https://snapshots.elastic.co/8.0.0-abc/elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz")
+	second := CachePath("/cache", "https://snapshots.elastic.co/8.0.0-def/elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz")
+
+	assert.Equal(t, "elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz", filepath.Base(first))
+	assert.Equal(t, "/cache", filepath.Dir(filepath.Dir(first)))
+	assert.Equal(t, 16, len(filepath.Base(filepath.Dir(first))))
+
+	// the builds of a snapshot share the name of the file, but not its path in the cache
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first, CachePath("/cache", "https://snapshots.elastic.co/8.0.0-abc/elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz"))
+}
+
+func TestFileNameFromURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://artifacts.elastic.co/downloads/beats/elastic-agent/elastic-agent-7.10.2-amd64.deb", "elastic-agent-7.10.2-amd64.deb"},
+		{"https://artifacts.elastic.co/downloads/elastic-agent-7.10.2-x86_64.rpm?x-elastic-no-kpi=true", "elastic-agent-7.10.2-x86_64.rpm"},
+		{"https://storage.googleapis.com/download/storage/v1/b/beats-ci-artifacts/o/snapshots%2Felastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz?alt=media", "elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, FileNameFromURL(tt.url), tt.url)
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	content := []byte("the content of the package")
+	assert.Nil(t, ioutil.WriteFile(filePath, content, 0644))
+
+	hash := sha512.Sum512(content)
+	checksum := hex.EncodeToString(hash[:])
+
+	assert.Nil(t, VerifyChecksum(filePath, checksum))
+
+	// a truncated download does not match the checksum
+	assert.Nil(t, ioutil.WriteFile(filePath, content[:10], 0644))
+	err := VerifyChecksum(filePath, checksum)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "(10 bytes)")
+
+	assert.NotNil(t, VerifyChecksum(filepath.Join(t.TempDir(), "missing.tar.gz"), checksum))
+}
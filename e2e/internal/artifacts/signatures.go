@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ReadKeyRing reads a keyring from public GPG keys in the ASCII armored format
+func ReadKeyRing(key string) (openpgp.EntityList, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("the GPG key is not valid: %w", err)
+	}
+
+	return keyring, nil
+}
+
+// VerifySignature checks that a file is signed with a key of a keyring, with a detached signature
+// in the ASCII armored format
+func VerifySignature(keyring openpgp.EntityList, filePath string, signature string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, f, strings.NewReader(signature))
+	if err != nil {
+		return fmt.Errorf("the GPG signature of %s is not valid: %w", filePath, err)
+	}
+
+	for name := range signer.Identities {
+		log.WithFields(log.Fields{
+			"path":   filePath,
+			"signer": name,
+		}).Debug("The GPG signature of the file is valid")
+		break
+	}
+
+	return nil
+}
+
+// SignatureURL returns the URL of the detached signature of a file, which is published next to it
+// with the .asc extension, keeping the query string of the URL
+func SignatureURL(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL + ".asc"
+	}
+
+	u.Path += ".asc"
+	if u.RawPath != "" {
+		u.RawPath += ".asc"
+	}
+
+	return u.String()
+}
@@ -0,0 +1,107 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// newSigningKey returns a new GPG key, and its public key in the ASCII armored format
+func newSigningKey(t *testing.T, name string) (*openpgp.Entity, string) {
+	entity, err := openpgp.NewEntity(name, "", name+"@elastic.co", nil)
+	assert.Nil(t, err)
+
+	buf := &bytes.Buffer{}
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, entity.Serialize(w))
+	assert.Nil(t, w.Close())
+
+	return entity, buf.String()
+}
+
+// sign returns the detached signature of a content in the ASCII armored format
+func sign(t *testing.T, entity *openpgp.Entity, content []byte) string {
+	buf := &bytes.Buffer{}
+	assert.Nil(t, openpgp.ArmoredDetachSign(buf, entity, bytes.NewReader(content), nil))
+
+	return buf.String()
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer, publicKey := newSigningKey(t, "artifacts")
+	other, _ := newSigningKey(t, "other")
+
+	keyring, err := ReadKeyRing(publicKey)
+	assert.Nil(t, err)
+
+	content := []byte("the content of the package")
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(filePath, content, 0644))
+
+	tests := []struct {
+		name      string
+		signature string
+		valid     bool
+	}{
+		{"signed with the key", sign(t, signer, content), true},
+		{"signed with another key", sign(t, other, content), false},
+		{"signature of another content", sign(t, signer, []byte("the content of another package")), false},
+		{"malformed signature", "not a signature", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(keyring, filePath, tt.signature)
+			assert.Equal(t, tt.valid, err == nil, "%v", err)
+		})
+	}
+}
+
+func TestVerifySignatureOfAModifiedFile(t *testing.T) {
+	signer, publicKey := newSigningKey(t, "artifacts")
+
+	keyring, err := ReadKeyRing(publicKey)
+	assert.Nil(t, err)
+
+	content := []byte("the content of the package")
+	signature := sign(t, signer, content)
+
+	filePath := filepath.Join(t.TempDir(), "elastic-agent.tar.gz")
+	assert.Nil(t, ioutil.WriteFile(filePath, append(content, '!'), 0644))
+
+	err = VerifySignature(keyring, filePath, signature)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), filePath)
+
+	assert.NotNil(t, VerifySignature(keyring, filepath.Join(t.TempDir(), "missing.tar.gz"), signature))
+}
+
+func TestReadKeyRingOfAMalformedKey(t *testing.T) {
+	_, err := ReadKeyRing("not a key")
+	assert.NotNil(t, err)
+}
+
+func TestSignatureURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://artifacts.elastic.co/downloads/elastic-agent-7.10.2-amd64.deb", "https://artifacts.elastic.co/downloads/elastic-agent-7.10.2-amd64.deb.asc"},
+		{"https://artifacts.elastic.co/downloads/elastic-agent-7.10.2-amd64.deb?x-elastic-no-kpi=true", "https://artifacts.elastic.co/downloads/elastic-agent-7.10.2-amd64.deb.asc?x-elastic-no-kpi=true"},
+		{"https://storage.googleapis.com/download/storage/v1/b/beats-ci-artifacts/o/snapshots%2Felastic-agent.tar.gz?alt=media", "https://storage.googleapis.com/download/storage/v1/b/beats-ci-artifacts/o/snapshots%2Felastic-agent.tar.gz.asc?alt=media"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, SignatureURL(tt.url), tt.url)
+	}
+}
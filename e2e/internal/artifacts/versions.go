@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package artifacts resolves the versions of the packages of the Beats and the Elastic Agent, and
+// downloads them, verifying their checksums and caching them across test runs
+package artifacts
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReleaseVersion the numbers of a released version, i.e. 7.10.2
+type ReleaseVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// String returns the version, i.e. 7.10.2
+func (v ReleaseVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// ParseReleaseVersion parses a released version, i.e. 7.10.2, which is false for the snapshots and
+// the pre-releases, i.e. 8.0.0-SNAPSHOT or 7.11.0-rc1. The suffix of a version under test is ignored
+// with the lenient flag
+func ParseReleaseVersion(version string, lenient bool) (ReleaseVersion, bool) {
+	if index := strings.Index(version, "-"); index >= 0 {
+		if !lenient {
+			return ReleaseVersion{}, false
+		}
+		version = version[:index]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return ReleaseVersion{}, false
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return ReleaseVersion{}, false
+		}
+		numbers[i] = number
+	}
+
+	return ReleaseVersion{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, true
+}
+
+// PreviousMinorVersion returns the latest release of the N-th minor version before a version
+// among a list of versions, i.e. 7.10.2 is the N-1 version of 7.11.0-SNAPSHOT, and the latest 7.x
+// release is the N-1 version of 8.0.0
+func PreviousMinorVersion(versions []string, version string, previous int) (string, error) {
+	if previous < 1 {
+		return "", fmt.Errorf("the number of the previous version must be positive: %d", previous)
+	}
+
+	current, ok := ParseReleaseVersion(version, true)
+	if !ok {
+		return "", fmt.Errorf("%s is not a valid version", version)
+	}
+
+	// the latest release of each minor version older than the current one
+	latest := map[ReleaseVersion]ReleaseVersion{}
+	for _, v := range versions {
+		release, ok := ParseReleaseVersion(v, false)
+		if !ok {
+			continue
+		}
+
+		if release.Major > current.Major || (release.Major == current.Major && release.Minor >= current.Minor) {
+			continue
+		}
+
+		minor := ReleaseVersion{Major: release.Major, Minor: release.Minor}
+		if existing, exists := latest[minor]; !exists || release.Patch > existing.Patch {
+			latest[minor] = release
+		}
+	}
+
+	minors := []ReleaseVersion{}
+	for minor := range latest {
+		minors = append(minors, minor)
+	}
+	sort.Slice(minors, func(i, j int) bool {
+		if minors[i].Major != minors[j].Major {
+			return minors[i].Major > minors[j].Major
+		}
+		return minors[i].Minor > minors[j].Minor
+	})
+
+	if previous > len(minors) {
+		return "", fmt.Errorf("there is no N-%d release before %s in the artifacts API", previous, version)
+	}
+
+	return latest[minors[previous-1]].String(), nil
+}
@@ -0,0 +1,91 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package artifacts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReleaseVersion(t *testing.T) {
+	tests := []struct {
+		version  string
+		lenient  bool
+		expected ReleaseVersion
+		ok       bool
+	}{
+		{"7.10.2", false, ReleaseVersion{7, 10, 2}, true},
+		{"8.0.0-SNAPSHOT", false, ReleaseVersion{}, false},
+		{"8.0.0-SNAPSHOT", true, ReleaseVersion{8, 0, 0}, true},
+		{"7.11.0-rc1", false, ReleaseVersion{}, false},
+		{"7.11.0-rc1", true, ReleaseVersion{7, 11, 0}, true},
+		{"7.10", false, ReleaseVersion{}, false},
+		{"7.10.x", false, ReleaseVersion{}, false},
+		{"pr-22000", true, ReleaseVersion{}, false},
+	}
+
+	for _, tt := range tests {
+		version, ok := ParseReleaseVersion(tt.version, tt.lenient)
+		assert.Equal(t, tt.ok, ok, tt.version)
+		assert.Equal(t, tt.expected, version, tt.version)
+	}
+}
+
+func TestPreviousMinorVersion(t *testing.T) {
+	versions := []string{
+		"6.8.15", "6.8.16",
+		"7.9.0", "7.9.3",
+		"7.10.0", "7.10.1", "7.10.2",
+		"7.11.0-SNAPSHOT", "7.11.0-rc1",
+		"7.12.0", "7.12.1-SNAPSHOT",
+		"8.0.0-SNAPSHOT",
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		previous int
+		expected string
+	}{
+		{"N-1 of a snapshot", "7.11.0-SNAPSHOT", 1, "7.10.2"},
+		{"N-2 of a snapshot", "7.11.0-SNAPSHOT", 2, "7.9.3"},
+		{"N-1 of a release skipping the minors without releases", "7.12.0", 1, "7.10.2"},
+		{"N-1 of a patch release", "7.10.2", 1, "7.9.3"},
+		{"N-1 of a x.0 version is the latest minor of the previous major", "8.0.0-SNAPSHOT", 1, "7.12.0"},
+		{"N-3 of a x.0 version", "8.0.0-SNAPSHOT", 3, "7.9.3"},
+		{"N-1 of the first minor of a major", "7.0.0", 1, "6.8.16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := PreviousMinorVersion(versions, tt.version, tt.previous)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, version)
+		})
+	}
+}
+
+func TestPreviousMinorVersionErrors(t *testing.T) {
+	versions := []string{"7.9.3", "7.10.2"}
+
+	tests := []struct {
+		name     string
+		version  string
+		previous int
+	}{
+		{"not positive", "7.11.0", 0},
+		{"invalid version", "latest", 1},
+		{"no release old enough", "7.11.0", 3},
+		{"no older release", "7.9.0", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PreviousMinorVersion(versions, tt.version, tt.previous)
+			assert.NotNil(t, err)
+		})
+	}
+}
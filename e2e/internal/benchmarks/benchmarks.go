@@ -0,0 +1,181 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package benchmarks calculates the statistics of the measurements of the key durations of a
+// benchmark run, i.e. the enrollment of the agents, and checks them against their SLOs
+package benchmarks
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stats the statistics of the measurements of a key duration
+type Stats struct {
+	Count int
+	Max   time.Duration
+	Mean  time.Duration
+	Min   time.Duration
+	Name  string
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// Get returns the value of a statistic by name, i.e. p95
+func (s Stats) Get(statistic string) (time.Duration, error) {
+	switch statistic {
+	case "max":
+		return s.Max, nil
+	case "mean":
+		return s.Mean, nil
+	case "min":
+		return s.Min, nil
+	case "p50":
+		return s.P50, nil
+	case "p90":
+		return s.P90, nil
+	case "p95":
+		return s.P95, nil
+	case "p99":
+		return s.P99, nil
+	}
+
+	return 0, fmt.Errorf("the %s statistic is not supported, use one of: min, mean, max, p50, p90, p95 or p99", statistic)
+}
+
+// SLO a threshold for a statistic of the measurements of a key duration, i.e. the p95 of the enrollment
+type SLO struct {
+	Name      string
+	Statistic string
+	Threshold time.Duration
+}
+
+// ParseSLOs parses a comma-separated list of SLOs in the name:statistic=threshold format, i.e.
+// "enrollment:p95=60s,time-to-first-document:max=2m", which is empty if there are no SLOs
+func ParseSLOs(value string) ([]SLO, error) {
+	slos := []SLO{}
+
+	if strings.TrimSpace(value) == "" {
+		return slos, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		parts := strings.SplitN(item, "=", 2)
+		keys := strings.SplitN(parts[0], ":", 2)
+		if len(parts) != 2 || len(keys) != 2 || keys[0] == "" {
+			return nil, fmt.Errorf("the SLO is not valid: %s, use the name:statistic=threshold format", item)
+		}
+
+		threshold, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("the threshold of the SLO is not valid: %s - %v", item, err)
+		}
+
+		slo := SLO{
+			Name:      keys[0],
+			Statistic: strings.ToLower(keys[1]),
+			Threshold: threshold,
+		}
+
+		_, err = Stats{}.Get(slo.Statistic)
+		if err != nil {
+			return nil, err
+		}
+
+		slos = append(slos, slo)
+	}
+
+	return slos, nil
+}
+
+// Calculate calculates the statistics of the measurements of a key duration, using the
+// nearest-rank method for the percentiles. The statistics of no measurements are zero
+func Calculate(name string, durations []time.Duration) Stats {
+	if len(durations) == 0 {
+		return Stats{Name: name}
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	percentile := func(p float64) time.Duration {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		if rank < 1 {
+			rank = 1
+		}
+
+		return sorted[rank-1]
+	}
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	return Stats{
+		Count: len(sorted),
+		Max:   sorted[len(sorted)-1],
+		Mean:  total / time.Duration(len(sorted)),
+		Min:   sorted[0],
+		Name:  name,
+		P50:   percentile(50),
+		P90:   percentile(90),
+		P95:   percentile(95),
+		P99:   percentile(99),
+	}
+}
+
+// CheckSLOs returns the violations of the SLOs by the statistics of the measurements, by name,
+// which include the SLOs of the key durations without measurements
+func CheckSLOs(stats map[string]Stats, slos []SLO) []string {
+	violations := []string{}
+	for _, slo := range slos {
+		s, exists := stats[slo.Name]
+		if !exists || s.Count == 0 {
+			violations = append(violations, fmt.Sprintf("%s: there are no measurements", slo.Name))
+			continue
+		}
+
+		value, _ := s.Get(slo.Statistic)
+		if value > slo.Threshold {
+			violations = append(violations, fmt.Sprintf("%s: the %s is %s, exceeding the %s threshold", slo.Name, slo.Statistic, value, slo.Threshold))
+		}
+	}
+
+	return violations
+}
+
+// ReadMeasurements reads the measurements of a benchmark run, by name, one per line: time,
+// iteration, name and milliseconds, separated by tabs. The malformed lines are skipped
+func ReadMeasurements(r io.Reader) (map[string][]time.Duration, error) {
+	measurements := map[string][]time.Duration{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 {
+			continue
+		}
+
+		millis, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		measurements[fields[2]] = append(measurements[fields[2]], time.Duration(millis)*time.Millisecond)
+	}
+
+	return measurements, scanner.Err()
+}
@@ -0,0 +1,160 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package benchmarks
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func seconds(values ...int) []time.Duration {
+	durations := []time.Duration{}
+	for _, v := range values {
+		durations = append(durations, time.Duration(v)*time.Second)
+	}
+	return durations
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		expected  Stats
+	}{
+		{
+			name:      "no measurements",
+			durations: []time.Duration{},
+			expected:  Stats{Name: "enrollment"},
+		},
+		{
+			name:      "single measurement",
+			durations: seconds(7),
+			expected: Stats{
+				Count: 1, Name: "enrollment",
+				Min: 7 * time.Second, Mean: 7 * time.Second, Max: 7 * time.Second,
+				P50: 7 * time.Second, P90: 7 * time.Second, P95: 7 * time.Second, P99: 7 * time.Second,
+			},
+		},
+		{
+			name:      "unsorted measurements",
+			durations: seconds(4, 1, 3, 2),
+			expected: Stats{
+				Count: 4, Name: "enrollment",
+				Min: time.Second, Mean: 2500 * time.Millisecond, Max: 4 * time.Second,
+				P50: 2 * time.Second, P90: 4 * time.Second, P95: 4 * time.Second, P99: 4 * time.Second,
+			},
+		},
+		{
+			name:      "ten measurements",
+			durations: seconds(10, 9, 8, 7, 6, 5, 4, 3, 2, 1),
+			expected: Stats{
+				Count: 10, Name: "enrollment",
+				Min: time.Second, Mean: 5500 * time.Millisecond, Max: 10 * time.Second,
+				P50: 5 * time.Second, P90: 9 * time.Second, P95: 10 * time.Second, P99: 10 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Calculate("enrollment", tt.durations))
+		})
+	}
+}
+
+func TestCalculateDoesNotSortTheMeasurements(t *testing.T) {
+	durations := seconds(3, 1, 2)
+
+	_ = Calculate("enrollment", durations)
+
+	assert.Equal(t, seconds(3, 1, 2), durations)
+}
+
+func TestCalculatePercentilesOfAHundredMeasurements(t *testing.T) {
+	durations := []time.Duration{}
+	for i := 100; i >= 1; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	stats := Calculate("enrollment", durations)
+
+	assert.Equal(t, 50*time.Millisecond, stats.P50)
+	assert.Equal(t, 90*time.Millisecond, stats.P90)
+	assert.Equal(t, 95*time.Millisecond, stats.P95)
+	assert.Equal(t, 99*time.Millisecond, stats.P99)
+}
+
+func TestParseSLOs(t *testing.T) {
+	slos, err := ParseSLOs("enrollment:p95=60s, time-to-first-document:MAX=2m")
+	assert.Nil(t, err)
+	assert.Equal(t, []SLO{
+		{Name: "enrollment", Statistic: "p95", Threshold: time.Minute},
+		{Name: "time-to-first-document", Statistic: "max", Threshold: 2 * time.Minute},
+	}, slos)
+
+	slos, err = ParseSLOs("")
+	assert.Nil(t, err)
+	assert.Equal(t, []SLO{}, slos)
+}
+
+func TestParseMalformedSLOs(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"without threshold", "enrollment:p95"},
+		{"without statistic", "enrollment=60s"},
+		{"without name", ":p95=60s"},
+		{"invalid threshold", "enrollment:p95=fast"},
+		{"threshold without unit", "enrollment:p95=60"},
+		{"unsupported statistic", "enrollment:p42=60s"},
+		{"empty item", "enrollment:p95=60s,"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slos, err := ParseSLOs(tt.value)
+			assert.NotNil(t, err)
+			assert.Nil(t, slos)
+		})
+	}
+}
+
+func TestCheckSLOs(t *testing.T) {
+	stats := map[string]Stats{
+		"enrollment": Calculate("enrollment", seconds(10, 20, 30)),
+	}
+
+	slos := []SLO{
+		{Name: "enrollment", Statistic: "p95", Threshold: 30 * time.Second},
+		{Name: "enrollment", Statistic: "mean", Threshold: 15 * time.Second},
+		{Name: "time-to-first-document", Statistic: "max", Threshold: time.Minute},
+	}
+
+	assert.Equal(t, []string{
+		"enrollment: the mean is 20s, exceeding the 15s threshold",
+		"time-to-first-document: there are no measurements",
+	}, CheckSLOs(stats, slos))
+}
+
+func TestReadMeasurements(t *testing.T) {
+	content := strings.Join([]string{
+		"2021-06-01T10:00:00Z\t1\tenrollment\t1500",
+		"2021-06-01T10:01:00Z\t2\tenrollment\t2500",
+		"2021-06-01T10:01:00Z\t2\ttime-to-first-document\t60000",
+		"malformed line",
+		"2021-06-01T10:02:00Z\t3\tenrollment\tslow",
+	}, "\n")
+
+	measurements, err := ReadMeasurements(strings.NewReader(content))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]time.Duration{
+		"enrollment":             {1500 * time.Millisecond, 2500 * time.Millisecond},
+		"time-to-first-document": {time.Minute},
+	}, measurements)
+}
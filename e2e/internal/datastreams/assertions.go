@@ -0,0 +1,207 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package datastreams provides the assertions over the documents of the data streams shared by the
+// test suites, i.e. that a host sent documents to a data stream since a time, or that it did not
+// send any after being stopped. The searches are retried with a backoff, as the documents are
+// searchable with some delay
+package datastreams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// Searcher searches the documents of an index, which could be a data stream or a pattern, i.e. the
+// client of Elasticsearch
+type Searcher interface {
+	Search(ctx context.Context, index string, query *elasticsearch.Query) (*elasticsearch.SearchResult, error)
+}
+
+// Assertions the assertions over the documents of the data streams, retrying the searches with
+// the backoff of the suites
+type Assertions struct {
+	newBackOff func(maxElapsedTime time.Duration) backoff.BackOff
+	searcher   Searcher
+}
+
+// New returns the assertions over the documents searched by a searcher, retrying the searches
+// with the backoffs returned by a function for a max elapsed time
+func New(searcher Searcher, newBackOff func(maxElapsedTime time.Duration) backoff.BackOff) *Assertions {
+	return &Assertions{
+		newBackOff: newBackOff,
+		searcher:   searcher,
+	}
+}
+
+// Selector selects the documents of a data stream sent by a host since a time
+type Selector struct {
+	DataStream elasticsearch.DataStream
+	Hostname   string    // empty for the documents of any host
+	Since      time.Time // zero for the documents of any time
+	Tags       []string  // the tags of the documents, i.e. the ones added by a Logstash pipeline
+}
+
+// String returns the description of the selected documents, for the errors
+func (s Selector) String() string {
+	description := s.DataStream.Name()
+	if s.Hostname != "" {
+		description += " from the " + s.Hostname + " host"
+	}
+	if !s.Since.IsZero() {
+		description += " since " + s.Since.UTC().Format(time.RFC3339)
+	}
+	if len(s.Tags) > 0 {
+		description += " tagged with " + strings.Join(s.Tags, ", ")
+	}
+
+	return description
+}
+
+// query returns the query of the selected documents
+func (s Selector) query() *elasticsearch.Query {
+	query := elasticsearch.NewQuery().WithDataStream(s.DataStream)
+	if s.Hostname != "" {
+		query.WithHostName(s.Hostname)
+	}
+	if !s.Since.IsZero() {
+		query.WithTimeRange(s.Since, time.Time{})
+	}
+	for _, tag := range s.Tags {
+		query.WithTerm("tags", tag)
+	}
+
+	return query
+}
+
+// HasDocs waits for a number of selected documents at least, until a timeout, returning the result
+// of the last search, which includes the latest documents
+func (a *Assertions) HasDocs(selector Selector, minDocs int, timeout time.Duration) (*elasticsearch.SearchResult, error) {
+	query := selector.query().WithSort(elasticsearch.TimestampField, true).WithSize(minDocs)
+
+	var result *elasticsearch.SearchResult
+	countDocs := func() error {
+		r, err := a.searcher.Search(context.Background(), selector.DataStream.Name(), query)
+		if err != nil {
+			return err
+		}
+		result = r
+
+		if total := r.Hits.Total.Value; total < minDocs {
+			log.WithFields(log.Fields{
+				"desiredDocs": minDocs,
+				"docs":        total,
+				"selector":    selector.String(),
+			}).Debug("Waiting for more documents in the data stream")
+			return fmt.Errorf("there are %d documents in %s, but %d were expected at least", total, selector, minDocs)
+		}
+
+		return nil
+	}
+
+	err := backoff.Retry(countDocs, a.newBackOff(timeout))
+	if err != nil {
+		return result, err
+	}
+
+	log.WithFields(log.Fields{
+		"docs":     result.Hits.Total.Value,
+		"selector": selector.String(),
+	}).Debug("There are documents in the data stream")
+
+	return result, nil
+}
+
+// HasNoDocs checks that there are no selected documents during a period, i.e. after a host stopped
+// sending them, searching them with the backoff until the period passes. The data stream must
+// exist, as it's expected to have documents before the selected time
+func (a *Assertions) HasNoDocs(selector Selector, period time.Duration) error {
+	query := selector.query().WithSize(1)
+
+	b := a.newBackOff(period)
+	for {
+		result, err := a.searcher.Search(context.Background(), selector.DataStream.Name(), query)
+		if err != nil {
+			if errors.Is(err, elasticsearch.ErrIndexNotFound) {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"error":    err,
+				"selector": selector.String(),
+			}).Warn("Could not search the documents of the data stream")
+		} else if total := result.Hits.Total.Value; total > 0 {
+			return fmt.Errorf("there are %d documents in %s, but none was expected", total, selector)
+		}
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			break
+		}
+		time.Sleep(next)
+	}
+
+	log.WithFields(log.Fields{
+		"period":   period,
+		"selector": selector.String(),
+	}).Debug("There are no documents in the data stream")
+
+	return nil
+}
+
+// FieldExistsInLatestDoc waits for the latest selected document to have a field, until a timeout.
+// The field is a dotted path, i.e. host.name, which could be nested or flattened in the document
+func (a *Assertions) FieldExistsInLatestDoc(selector Selector, field string, timeout time.Duration) error {
+	query := selector.query().WithSort(elasticsearch.TimestampField, true).WithSize(1)
+
+	checkField := func() error {
+		result, err := a.searcher.Search(context.Background(), selector.DataStream.Name(), query)
+		if err != nil {
+			return err
+		}
+
+		if len(result.Hits.Hits) == 0 {
+			return fmt.Errorf("there are no documents in %s", selector)
+		}
+
+		latest := result.Hits.Hits[0]
+		if !hasField(latest.Source, field) {
+			log.WithFields(log.Fields{
+				"document": latest.ID,
+				"field":    field,
+				"selector": selector.String(),
+			}).Debug("Waiting for the field in the latest document of the data stream")
+			return fmt.Errorf("the %s field does not exist in the latest document of %s: %s", field, selector, latest.ID)
+		}
+
+		return nil
+	}
+
+	return backoff.Retry(checkField, a.newBackOff(timeout))
+}
+
+// hasField checks if a document has a field, which is a dotted path whose parts could be nested
+// objects or flattened keys, i.e. {"host": {"os.name": "Linux"}} has the host.os.name field
+func hasField(source map[string]interface{}, field string) bool {
+	if _, exists := source[field]; exists {
+		return true
+	}
+
+	parts := strings.Split(field, ".")
+	for i := 1; i < len(parts); i++ {
+		nested, ok := source[strings.Join(parts[:i], ".")].(map[string]interface{})
+		if ok && hasField(nested, strings.Join(parts[i:], ".")) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,213 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package datastreams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	"github.com/stretchr/testify/assert"
+)
+
+// maxRetries the retries of the searches of the tests, which do not wait between them
+const maxRetries = 2
+
+// fakeSearcher returns a scripted response for each search, repeating the last one, and records
+// the searches
+type fakeSearcher struct {
+	errs    []error
+	indices []string
+	queries []*elasticsearch.Query
+	results []*elasticsearch.SearchResult
+}
+
+func (s *fakeSearcher) Search(ctx context.Context, index string, query *elasticsearch.Query) (*elasticsearch.SearchResult, error) {
+	i := len(s.indices)
+	if i >= len(s.results) {
+		i = len(s.results) - 1
+	}
+
+	s.indices = append(s.indices, index)
+	s.queries = append(s.queries, query)
+
+	if s.errs != nil && s.errs[i] != nil {
+		return nil, s.errs[i]
+	}
+
+	return s.results[i], nil
+}
+
+func newAssertions(searcher Searcher) *Assertions {
+	return New(searcher, func(maxElapsedTime time.Duration) backoff.BackOff {
+		return backoff.WithMaxRetries(&backoff.ZeroBackOff{}, maxRetries)
+	})
+}
+
+// result returns the result of a search with a total number of documents, and the sources of the
+// hits returned
+func result(total int, sources ...map[string]interface{}) *elasticsearch.SearchResult {
+	r := &elasticsearch.SearchResult{}
+	r.Hits.Total.Value = total
+	for i, source := range sources {
+		r.Hits.Hits = append(r.Hits.Hits, elasticsearch.Hit{ID: fmt.Sprintf("doc-%d", i), Source: source})
+	}
+
+	return r
+}
+
+var agentLogs = Selector{
+	DataStream: elasticsearch.DataStream{Type: "logs", Dataset: "elastic_agent", Namespace: "default"},
+	Hostname:   "e2e-host",
+	Since:      time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+	Tags:       []string{"logstash"},
+}
+
+func TestSelector(t *testing.T) {
+	assert.Equal(t, "logs-elastic_agent-default from the e2e-host host since 2021-06-01T10:00:00Z tagged with logstash", agentLogs.String())
+	assert.Equal(t, "metrics-*-*", Selector{DataStream: elasticsearch.DataStream{Type: "metrics"}}.String())
+
+	body, err := json.Marshal(agentLogs.query().Map())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"query":{"bool":{"filter":[
+		{"term":{"data_stream.type":"logs"}},
+		{"term":{"data_stream.dataset":"elastic_agent"}},
+		{"term":{"data_stream.namespace":"default"}},
+		{"match_phrase":{"host.name":"e2e-host"}},
+		{"range":{"@timestamp":{"format":"strict_date_optional_time","gte":"2021-06-01T10:00:00Z"}}},
+		{"term":{"tags":"logstash"}}
+	]}}}`, string(body))
+}
+
+func TestHasDocs(t *testing.T) {
+	searcher := &fakeSearcher{results: []*elasticsearch.SearchResult{result(1), result(3)}}
+
+	r, err := newAssertions(searcher).HasDocs(agentLogs, 3, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, r.Hits.Total.Value)
+	assert.Equal(t, []string{"logs-elastic_agent-default", "logs-elastic_agent-default"}, searcher.indices)
+
+	// the latest documents are returned
+	body := searcher.queries[0].Map()
+	assert.Equal(t, 3, body["size"])
+	assert.Equal(t, []map[string]interface{}{
+		{elasticsearch.TimestampField: map[string]interface{}{"order": "desc"}},
+	}, body["sort"])
+}
+
+func TestHasDocsWithoutEnoughDocs(t *testing.T) {
+	searcher := &fakeSearcher{results: []*elasticsearch.SearchResult{result(2)}}
+
+	r, err := newAssertions(searcher).HasDocs(agentLogs, 3, time.Minute)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "there are 2 documents in logs-elastic_agent-default")
+	assert.Equal(t, 2, r.Hits.Total.Value)
+	assert.Equal(t, maxRetries+1, len(searcher.indices))
+}
+
+func TestHasNoDocs(t *testing.T) {
+	transient := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		searcher *fakeSearcher
+		valid    bool
+		searches int
+	}{
+		{
+			name:     "no documents during the period",
+			searcher: &fakeSearcher{results: []*elasticsearch.SearchResult{result(0)}},
+			valid:    true,
+			searches: maxRetries + 1,
+		},
+		{
+			name:     "transient errors are retried",
+			searcher: &fakeSearcher{errs: []error{transient, nil}, results: []*elasticsearch.SearchResult{nil, result(0)}},
+			valid:    true,
+			searches: maxRetries + 1,
+		},
+		{
+			name:     "documents during the period",
+			searcher: &fakeSearcher{results: []*elasticsearch.SearchResult{result(0), result(1)}},
+			searches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newAssertions(tt.searcher).HasNoDocs(agentLogs, time.Minute)
+			assert.Equal(t, tt.valid, err == nil, "%v", err)
+			assert.Equal(t, tt.searches, len(tt.searcher.indices))
+		})
+	}
+}
+
+func TestHasNoDocsOfAMissingDataStream(t *testing.T) {
+	searcher := &fakeSearcher{
+		errs:    []error{fmt.Errorf("search: %w", elasticsearch.ErrIndexNotFound)},
+		results: []*elasticsearch.SearchResult{nil},
+	}
+
+	err := newAssertions(searcher).HasNoDocs(agentLogs, time.Minute)
+	assert.True(t, errors.Is(err, elasticsearch.ErrIndexNotFound))
+	assert.Equal(t, 1, len(searcher.indices))
+}
+
+func TestFieldExistsInLatestDoc(t *testing.T) {
+	tests := []struct {
+		name     string
+		results  []*elasticsearch.SearchResult
+		valid    bool
+		searches int
+	}{
+		{"field in the latest document", []*elasticsearch.SearchResult{result(1, map[string]interface{}{"host": map[string]interface{}{"name": "e2e-host"}})}, true, 1},
+		{"field added later", []*elasticsearch.SearchResult{result(1, map[string]interface{}{}), result(2, map[string]interface{}{"host.name": "e2e-host"})}, true, 2},
+		{"field never added", []*elasticsearch.SearchResult{result(1, map[string]interface{}{"host": map[string]interface{}{}})}, false, maxRetries + 1},
+		{"no documents", []*elasticsearch.SearchResult{result(0)}, false, maxRetries + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			searcher := &fakeSearcher{results: tt.results}
+
+			err := newAssertions(searcher).FieldExistsInLatestDoc(agentLogs, "host.name", time.Minute)
+			assert.Equal(t, tt.valid, err == nil, "%v", err)
+			assert.Equal(t, tt.searches, len(searcher.indices))
+			assert.Equal(t, 1, searcher.queries[0].Map()["size"])
+		})
+	}
+}
+
+func TestHasField(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		field    string
+		expected bool
+	}{
+		{"top level field", `{"message": "hello"}`, "message", true},
+		{"nested field", `{"host": {"os": {"name": "Linux"}}}`, "host.os.name", true},
+		{"flattened field", `{"host.os.name": "Linux"}`, "host.os.name", true},
+		{"partially flattened field", `{"host": {"os.name": "Linux"}}`, "host.os.name", true},
+		{"partially nested field", `{"host.os": {"name": "Linux"}}`, "host.os.name", true},
+		{"null value", `{"host": {"os": {"name": null}}}`, "host.os.name", true},
+		{"missing field", `{"host": {"os": {"version": "10"}}}`, "host.os.name", false},
+		{"parent is not an object", `{"host": {"os": "Linux"}}`, "host.os.name", false},
+		{"empty document", `{}`, "message", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := map[string]interface{}{}
+			assert.Nil(t, json.Unmarshal([]byte(tt.source), &source))
+			assert.Equal(t, tt.expected, hasField(source, tt.field))
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package deploy deploys the services under test, i.e. the boxes where the agents are installed,
+// to a backend selected with the PROVIDER env var: the containers of docker-compose, the pods of
+// Kubernetes, or remote hosts reached over SSH. All the providers share the same contract, so that
+// the steps of the suites run against any of them
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProviderEnvVar the environment variable selecting the provider of the services under test
+const ProviderEnvVar = "PROVIDER"
+
+// the providers of the services under test
+const (
+	DockerProvider     = "docker"
+	KubernetesProvider = "kubernetes"
+	RemoteProvider     = "remote"
+)
+
+// the platforms of the services under test
+const (
+	LinuxPlatform   = "linux"
+	WindowsPlatform = "windows"
+)
+
+// Deployer deploys the services under test to a backend, running commands in them
+type Deployer interface {
+	// Add brings a service up
+	Add(ctx context.Context, service ServiceRequest) error
+	// AddFiles copies local files, by their name in the root dir of a service, i.e. the artifact
+	// of an agent
+	AddFiles(ctx context.Context, service ServiceRequest, files map[string]string) error
+	// CopyFileFrom copies a file of a service to a local path, i.e. the diagnostics bundle of an
+	// agent
+	CopyFileFrom(ctx context.Context, service ServiceRequest, path string, localPath string) error
+	// Disposable reports if the services are destroyed when they are removed, or reused by the
+	// next scenarios, which must clean them up
+	Disposable() bool
+	// Exec executes a command in a service, returning its output
+	Exec(ctx context.Context, service ServiceRequest, cmds []string, options ExecOptions) (string, error)
+	// Inspect returns the manifest of a running service
+	Inspect(ctx context.Context, service ServiceRequest) (ServiceManifest, error)
+	// Logs returns the logs of a service
+	Logs(ctx context.Context, service ServiceRequest) (string, error)
+	// Platform returns the platform of the services: linux, or windows for the remote Windows hosts
+	Platform() string
+	// Remove destroys a service
+	Remove(ctx context.Context, service ServiceRequest) error
+	// Restart restarts a service, waiting for it to be back
+	Restart(ctx context.Context, service ServiceRequest) error
+}
+
+// ExecOptions the options of the commands executed in the services
+type ExecOptions struct {
+	Detach         bool // runs the command in background, returning right away without output
+	IgnoreExitCode bool // returns the output of a failing command, including its errors, instead of failing
+}
+
+// ServiceManifest the manifest of a running service
+type ServiceManifest struct {
+	ContainerName string // name of the container or the pod of the service, empty for the remote hosts
+	Hostname      string
+	IP            string
+	Name          string // name of the service
+	Platform      string // linux or windows
+}
+
+// ServiceRequest the request of a service of a profile, i.e. the centos-systemd service of the
+// fleet profile
+type ServiceRequest struct {
+	Container string            // name of the container of the service, or of a container run from it
+	Env       map[string]string // environment of the profile, which renders the docker-compose files and the manifests
+	Name      string            // name of the service, which is the name of its docker-compose file
+	Profile   string            // name of the profile, which is the parent docker-compose file
+}
+
+// Factory creates the deployer of a provider
+type Factory func() (Deployer, error)
+
+var providers = map[string]Factory{
+	DockerProvider:     newDockerDeployer,
+	KubernetesProvider: newKubernetesDeployer,
+	RemoteProvider:     newRemoteDeployer,
+}
+var providersMutex sync.RWMutex
+
+// Register registers the factory of the deployer of a provider, replacing the existing one, so
+// that the providers of other backends, such as the cloud ones, are plugged in without changing
+// the steps of the suites
+func Register(provider string, factory Factory) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	providers[provider] = factory
+}
+
+// New returns the deployer of a provider, failing if the provider is not registered
+func New(provider string) (Deployer, error) {
+	providersMutex.RLock()
+	factory, exists := providers[provider]
+	providersMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("the %s provider is not supported: use one of %s", provider, strings.Join(supportedProviders(), ", "))
+	}
+
+	d, err := factory()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":    err,
+			"provider": provider,
+		}).Error("Could not create the deployer of the provider")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"platform": d.Platform(),
+		"provider": provider,
+	}).Debug("The services under test are deployed by the provider")
+
+	return d, nil
+}
+
+// NewFromEnv returns the deployer of the provider set in the PROVIDER env var. If it's not set,
+// the services are deployed to the remote host set in the ELASTIC_AGENT_SSH_HOST env var, if any,
+// or to docker-compose
+func NewFromEnv() (Deployer, error) {
+	defaultProvider := DockerProvider
+	if shell.GetEnv(remoteHostEnvVar, "") != "" {
+		defaultProvider = RemoteProvider
+	}
+
+	return New(strings.ToLower(shell.GetEnv(ProviderEnvVar, defaultProvider)))
+}
+
+// supportedProviders returns the names of the registered providers, sorted
+func supportedProviders() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	names := []string{}
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
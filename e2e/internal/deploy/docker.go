@@ -0,0 +1,287 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// dockerDeployer deploys the services to the containers of the docker-compose projects of their
+// profiles
+type dockerDeployer struct{}
+
+// newDockerDeployer returns the deployer of the docker provider
+func newDockerDeployer() (Deployer, error) {
+	return &dockerDeployer{}, nil
+}
+
+// Add adds the service to the running profile
+func (d *dockerDeployer) Add(ctx context.Context, service ServiceRequest) error {
+	serviceManager := services.NewServiceManager()
+
+	err := serviceManager.AddServicesToCompose(service.Profile, []string{service.Name}, service.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": service.Profile,
+			"service": service.Name,
+		}).Error("Could not add the service to the profile")
+		return err
+	}
+
+	return nil
+}
+
+// AddFiles copies the files to the root dir of the container of the service
+func (d *dockerDeployer) AddFiles(ctx context.Context, service ServiceRequest, files map[string]string) error {
+	containerName, err := d.containerName(service)
+	if err != nil {
+		return err
+	}
+
+	for name, file := range files {
+		target := containerName + ":/" + name
+
+		_, err := shell.Execute(".", config.GetContainerRuntime().Executable, "cp", file, target)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"container": containerName,
+				"error":     err,
+				"file":      file,
+			}).Error("Could not copy the file into the container")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"file":      file,
+		}).Debug("File copied into the container")
+	}
+
+	return nil
+}
+
+// CopyFileFrom copies a file of the container of the service to a local path
+func (d *dockerDeployer) CopyFileFrom(ctx context.Context, service ServiceRequest, path string, localPath string) error {
+	containerName, err := d.containerName(service)
+	if err != nil {
+		return err
+	}
+
+	_, err = shell.Execute(".", config.GetContainerRuntime().Executable, "cp", containerName+":"+path, localPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"path":      path,
+		}).Error("Could not copy the file from the container")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": containerName,
+		"path":      path,
+	}).Debug("File copied from the container")
+
+	return nil
+}
+
+// Disposable reports that the containers are destroyed when the services are removed
+func (d *dockerDeployer) Disposable() bool {
+	return true
+}
+
+// Exec executes a command in the container of the service, or in the container run from the
+// service, returning its output. The detached commands are run with docker-compose, which does not
+// return their output
+func (d *dockerDeployer) Exec(ctx context.Context, service ServiceRequest, cmds []string, options ExecOptions) (string, error) {
+	if options.IgnoreExitCode {
+		containerName, err := d.containerName(service)
+		if err != nil {
+			return "", err
+		}
+
+		// the Docker client returns the output of the command, no matter its exit code
+		return docker.ExecCommandIntoContainer(ctx, containerName, "root", cmds)
+	}
+
+	if service.Container == "" && options.Detach {
+		return "", d.composeExec(service, cmds, options.Detach)
+	}
+
+	if service.Container == "" {
+		serviceManager := services.NewServiceManager()
+
+		result, err := serviceManager.ExecCommandInService(service.Profile, service.Name, cmds)
+		if err != nil {
+			return "", err
+		}
+
+		if result.ExitCode != 0 {
+			log.WithFields(log.Fields{
+				"command":  cmds,
+				"exitCode": result.ExitCode,
+				"service":  service.Name,
+				"stderr":   result.Stderr,
+			}).Error("Could not execute command in container")
+
+			return result.Stdout, fmt.Errorf("the command exited with code %d in the %s service: %s", result.ExitCode, service.Name, strings.TrimSpace(result.Stderr))
+		}
+
+		return result.Stdout, nil
+	}
+
+	args := []string{"exec"}
+	if options.Detach {
+		args = append(args, "-d")
+	}
+	args = append(args, service.Container)
+	args = append(args, cmds...)
+
+	output, err := shell.Execute(".", config.GetContainerRuntime().Executable, args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command":   cmds,
+			"container": service.Container,
+			"error":     err,
+		}).Error("Could not execute command in container")
+
+		return "", err
+	}
+
+	return output, nil
+}
+
+// Inspect returns the manifest of the container of the service
+func (d *dockerDeployer) Inspect(ctx context.Context, service ServiceRequest) (ServiceManifest, error) {
+	containerName, err := d.containerName(service)
+	if err != nil {
+		return ServiceManifest{}, err
+	}
+
+	output, err := shell.Execute(".", config.GetContainerRuntime().Executable, "inspect", "--format", "{{.Config.Hostname}}{{range .NetworkSettings.Networks}} {{.IPAddress}}{{end}}", containerName)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+		}).Error("Could not inspect the container")
+		return ServiceManifest{}, err
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return ServiceManifest{}, fmt.Errorf("the inspection of the %s container has no hostname", containerName)
+	}
+
+	manifest := ServiceManifest{
+		ContainerName: containerName,
+		Hostname:      fields[0],
+		Name:          service.Name,
+		Platform:      LinuxPlatform,
+	}
+	if len(fields) > 1 {
+		manifest.IP = fields[1]
+	}
+
+	return manifest, nil
+}
+
+// Logs returns the logs of the container of the service
+func (d *dockerDeployer) Logs(ctx context.Context, service ServiceRequest) (string, error) {
+	containerName, err := d.containerName(service)
+	if err != nil {
+		return "", err
+	}
+
+	return docker.GetContainerLogs(ctx, containerName)
+}
+
+// Platform returns the platform of the containers, which is always Linux
+func (d *dockerDeployer) Platform() string {
+	return LinuxPlatform
+}
+
+// Remove removes the service from the running profile
+func (d *dockerDeployer) Remove(ctx context.Context, service ServiceRequest) error {
+	serviceManager := services.NewServiceManager()
+
+	return serviceManager.RemoveServicesFromCompose(service.Profile, []string{service.Name}, service.Env)
+}
+
+// Restart restarts the service of the running profile
+func (d *dockerDeployer) Restart(ctx context.Context, service ServiceRequest) error {
+	serviceManager := services.NewServiceManager()
+
+	composes := []string{
+		service.Profile, // profile name
+		service.Name,    // service
+	}
+
+	err := serviceManager.RunCommand(service.Profile, composes, []string{"restart", service.Name}, service.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"service": service.Name,
+		}).Error("Could not restart the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"service": service.Name,
+	}).Debug("The service has been restarted")
+	return nil
+}
+
+// composeExec executes a command in the container of the service with docker-compose
+func (d *dockerDeployer) composeExec(service ServiceRequest, cmds []string, detach bool) error {
+	serviceManager := services.NewServiceManager()
+
+	composes := []string{
+		service.Profile, // profile name
+		service.Name,    // service
+	}
+	composeArgs := []string{"exec", "-T"}
+	if detach {
+		composeArgs = append(composeArgs, "-d")
+	}
+	composeArgs = append(composeArgs, service.Name)
+	composeArgs = append(composeArgs, cmds...)
+
+	err := serviceManager.RunCommand(service.Profile, composes, composeArgs, service.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command": cmds,
+			"error":   err,
+			"service": service.Name,
+		}).Error("Could not execute command in container")
+
+		return err
+	}
+
+	return nil
+}
+
+// containerName returns the name of the container of the service, which is looked up in the
+// docker-compose project of its profile if the request does not set it
+func (d *dockerDeployer) containerName(service ServiceRequest) (string, error) {
+	if service.Container != "" {
+		return service.Container, nil
+	}
+
+	container, err := docker.GetComposeServiceContainer(config.GetComposeProjectName(service.Profile), service.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(container.Names[0], "/"), nil
+}
@@ -0,0 +1,214 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/services"
+	log "github.com/sirupsen/logrus"
+)
+
+// kubernetesDeployer deploys the services to the pods of the deployments of the namespaces of their
+// profiles, from the Kubernetes manifests bundled with the tool. The pods are recreated when they
+// are restarted, so the files added to them are lost
+type kubernetesDeployer struct {
+	kubectl        *services.Kubectl
+	serviceManager *services.KubernetesServiceManager
+}
+
+// newKubernetesDeployer returns the deployer of the kubernetes provider
+func newKubernetesDeployer() (Deployer, error) {
+	return &kubernetesDeployer{
+		kubectl:        &services.Kubectl{},
+		serviceManager: services.NewKubernetesServiceManager(),
+	}, nil
+}
+
+// Add applies the manifest of the service into the namespace of the running profile
+func (d *kubernetesDeployer) Add(ctx context.Context, service ServiceRequest) error {
+	err := d.serviceManager.AddServicesToCompose(service.Profile, []string{service.Name}, service.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": service.Profile,
+			"service": service.Name,
+		}).Error("Could not add the service to the profile in Kubernetes")
+		return err
+	}
+
+	return nil
+}
+
+// AddFiles copies the files to the root dir of the pod of the service
+func (d *kubernetesDeployer) AddFiles(ctx context.Context, service ServiceRequest, files map[string]string) error {
+	pod, err := d.podName(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	namespace := config.GetComposeProjectName(service.Profile)
+
+	for name, file := range files {
+		_, err := d.kubectl.Run("cp", file, namespace+"/"+pod+":/"+name)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  file,
+				"pod":   pod,
+			}).Error("Could not copy the file into the pod")
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"file": file,
+			"pod":  pod,
+		}).Debug("File copied into the pod")
+	}
+
+	return nil
+}
+
+// CopyFileFrom copies a file of the pod of the service to a local path
+func (d *kubernetesDeployer) CopyFileFrom(ctx context.Context, service ServiceRequest, path string, localPath string) error {
+	pod, err := d.podName(ctx, service)
+	if err != nil {
+		return err
+	}
+
+	namespace := config.GetComposeProjectName(service.Profile)
+
+	_, err = d.kubectl.Run("cp", namespace+"/"+pod+":"+path, localPath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"path":  path,
+			"pod":   pod,
+		}).Error("Could not copy the file from the pod")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path": path,
+		"pod":  pod,
+	}).Debug("File copied from the pod")
+
+	return nil
+}
+
+// Disposable reports that the pods are destroyed when the services are removed
+func (d *kubernetesDeployer) Disposable() bool {
+	return true
+}
+
+// Exec executes a command in the pod of the deployment of the service, in background if it's
+// detached
+func (d *kubernetesDeployer) Exec(ctx context.Context, service ServiceRequest, cmds []string, options ExecOptions) (string, error) {
+	if options.Detach {
+		cmds = []string{"sh", "-c", shellCommand(cmds) + " > /dev/null 2>&1 &"}
+	} else if options.IgnoreExitCode {
+		cmds = []string{"sh", "-c", shellCommand(cmds) + " 2>&1 || true"}
+	}
+
+	args := []string{"exec", "--namespace", config.GetComposeProjectName(service.Profile), "deployment/" + service.Name, "--"}
+	args = append(args, cmds...)
+
+	output, err := d.kubectl.Run(args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"command": cmds,
+			"error":   err,
+			"service": service.Name,
+		}).Error("Could not execute command in the pod")
+		return "", err
+	}
+
+	return output, nil
+}
+
+// Inspect returns the manifest of the pod of the service, whose hostname is the name of the pod
+func (d *kubernetesDeployer) Inspect(ctx context.Context, service ServiceRequest) (ServiceManifest, error) {
+	namespace := config.GetComposeProjectName(service.Profile)
+
+	output, err := d.kubectl.Run("get", "pods", "--namespace", namespace, "--selector", "app="+service.Name, "-o", "jsonpath={.items[0].metadata.name} {.items[0].status.podIP}")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": namespace,
+			"service":   service.Name,
+		}).Error("Could not inspect the pod of the service")
+		return ServiceManifest{}, err
+	}
+
+	fields := strings.Fields(output)
+	if len(fields) == 0 {
+		return ServiceManifest{}, fmt.Errorf("there is no pod for the %s service in the %s namespace", service.Name, namespace)
+	}
+
+	manifest := ServiceManifest{
+		ContainerName: fields[0],
+		Hostname:      fields[0],
+		Name:          service.Name,
+		Platform:      LinuxPlatform,
+	}
+	if len(fields) > 1 {
+		manifest.IP = fields[1]
+	}
+
+	return manifest, nil
+}
+
+// Logs returns the logs of the containers of the pod of the deployment of the service
+func (d *kubernetesDeployer) Logs(ctx context.Context, service ServiceRequest) (string, error) {
+	return d.kubectl.Run("logs", "--namespace", config.GetComposeProjectName(service.Profile), "--all-containers", "deployment/"+service.Name)
+}
+
+// Platform returns the platform of the pods, which is always Linux
+func (d *kubernetesDeployer) Platform() string {
+	return LinuxPlatform
+}
+
+// Remove deletes the manifest of the service from the namespace of the running profile
+func (d *kubernetesDeployer) Remove(ctx context.Context, service ServiceRequest) error {
+	return d.serviceManager.RemoveServicesFromCompose(service.Profile, []string{service.Name}, service.Env)
+}
+
+// Restart restarts the deployment of the service, waiting for its new pod to be ready
+func (d *kubernetesDeployer) Restart(ctx context.Context, service ServiceRequest) error {
+	namespace := config.GetComposeProjectName(service.Profile)
+	deployment := "deployment/" + service.Name
+
+	_, err := d.kubectl.Run("rollout", "restart", "--namespace", namespace, deployment)
+	if err == nil {
+		_, err = d.kubectl.Run("rollout", "status", "--namespace", namespace, deployment, "--timeout=600s")
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":     err,
+			"namespace": namespace,
+			"service":   service.Name,
+		}).Error("Could not restart the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"namespace": namespace,
+		"service":   service.Name,
+	}).Debug("The service has been restarted")
+	return nil
+}
+
+// podName returns the name of the pod of the deployment of the service
+func (d *kubernetesDeployer) podName(ctx context.Context, service ServiceRequest) (string, error) {
+	manifest, err := d.Inspect(ctx, service)
+	if err != nil {
+		return "", err
+	}
+
+	return manifest.ContainerName, nil
+}
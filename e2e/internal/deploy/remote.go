@@ -0,0 +1,404 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package deploy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// remoteHostEnvVar the environment variable setting the remote host of the remote provider
+const remoteHostEnvVar = "ELASTIC_AGENT_SSH_HOST"
+
+// rebootTimeout the max time to wait for a remote host to be back after a reboot
+const rebootTimeout = 10 * time.Minute
+
+// WindowsRootDir the root dir of the remote Windows hosts, where the files are added
+const WindowsRootDir = `C:\`
+
+// remoteDeployer deploys the services to a remote host, i.e. a VM in a cloud provider or a bare
+// metal box, running the commands over SSH with the ssh and scp clients. The host is not
+// disposable, so the scenarios must clean it up. The commands are run by a POSIX shell in the
+// Linux hosts, and by PowerShell in the Windows ones, where the user must be an administrator
+type remoteDeployer struct {
+	address      string // host name or IP of the remote host
+	identityFile string // private key of the user, empty for the default ones of the SSH client
+	os           string // linux or windows
+	port         string
+	user         string // the commands are run with sudo if it's not root, in Linux
+}
+
+// newRemoteDeployer returns the deployer of the remote provider, which deploys the services to the
+// remote host set in the ELASTIC_AGENT_SSH_HOST env var, running the OS set in the
+// ELASTIC_AGENT_SSH_OS env var
+func newRemoteDeployer() (Deployer, error) {
+	d := &remoteDeployer{
+		address:      shell.GetEnv(remoteHostEnvVar, ""),
+		identityFile: shell.GetEnv("ELASTIC_AGENT_SSH_KEY", ""),
+		os:           strings.ToLower(shell.GetEnv("ELASTIC_AGENT_SSH_OS", LinuxPlatform)),
+		port:         shell.GetEnv("ELASTIC_AGENT_SSH_PORT", "22"),
+		user:         shell.GetEnv("ELASTIC_AGENT_SSH_USER", "root"),
+	}
+
+	if d.address == "" {
+		return nil, fmt.Errorf("the remote host is not set: set the %s env var", remoteHostEnvVar)
+	}
+
+	if d.os != LinuxPlatform && d.os != WindowsPlatform {
+		return nil, fmt.Errorf("the %s OS of the remote host is not supported: use linux or windows", d.os)
+	}
+
+	log.WithFields(log.Fields{
+		"address": d.address,
+		"os":      d.os,
+		"port":    d.port,
+		"user":    d.user,
+	}).Info("The services under test are deployed to a remote host over SSH")
+
+	return d, nil
+}
+
+// Add does nothing, as the remote host is already up
+func (d *remoteDeployer) Add(ctx context.Context, service ServiceRequest) error {
+	log.WithFields(log.Fields{
+		"address": d.address,
+		"service": service.Name,
+	}).Trace("The service is deployed to the remote host")
+
+	return nil
+}
+
+// AddFiles copies the files to the root dir of the remote host
+func (d *remoteDeployer) AddFiles(ctx context.Context, service ServiceRequest, files map[string]string) error {
+	for name, file := range files {
+		// the administrators of the Windows hosts can write to the root dir
+		if d.os == WindowsPlatform {
+			err := d.copy(file, strings.ReplaceAll(WindowsRootDir+name, `\`, "/"))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		tmpPath := "/tmp/" + name
+
+		err := d.copy(file, tmpPath)
+		if err != nil {
+			return err
+		}
+
+		_, err = d.Exec(ctx, service, []string{"mv", "-f", tmpPath, "/" + name}, ExecOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CopyFileFrom copies a file of the remote host to a local path
+func (d *remoteDeployer) CopyFileFrom(ctx context.Context, service ServiceRequest, path string, localPath string) error {
+	if d.os == WindowsPlatform {
+		path = strings.ReplaceAll(path, `\`, "/")
+	}
+
+	args := append(d.clientArgs("-P"), d.user+"@"+d.address+":"+path, localPath)
+
+	_, err := shell.Execute(".", "scp", args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"address": d.address,
+			"error":   err,
+			"path":    path,
+		}).Error("Could not copy the file from the remote host")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"address": d.address,
+		"path":    localPath,
+	}).Debug("The file was copied from the remote host")
+
+	return nil
+}
+
+// Disposable reports that the remote host is reused by the next scenarios
+func (d *remoteDeployer) Disposable() bool {
+	return false
+}
+
+// Exec executes a command in the remote host, detached from the SSH session if needed. The output
+// of the commands ignoring the exit code includes their errors, as the Docker client does, so that
+// the checks of the output behave the same with all the providers
+func (d *remoteDeployer) Exec(ctx context.Context, service ServiceRequest, cmds []string, options ExecOptions) (string, error) {
+	command := d.command(cmds)
+	if d.os == WindowsPlatform {
+		if options.IgnoreExitCode {
+			command = powershellCommand("try { & { " + powershellInvocation(cmds) + " } 2>&1 | Out-String } catch { $_ | Out-String }; exit 0")
+		} else {
+			command = powershellCommand(windowsExecScript(cmds, options.Detach))
+		}
+	} else if options.Detach {
+		command = d.command(append([]string{"nohup"}, cmds...)) + " > /dev/null 2>&1 &"
+	} else if options.IgnoreExitCode {
+		command = command + " 2>&1 || true"
+	}
+
+	output, err := d.run(command)
+	if err != nil {
+		// the commands ignoring the exit code only fail if the remote host cannot be reached, which
+		// is expected while it reboots
+		if !options.IgnoreExitCode {
+			log.WithFields(log.Fields{
+				"address": d.address,
+				"command": cmds,
+				"error":   err,
+			}).Error("Could not execute command in the remote host")
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// Inspect returns the manifest of the remote host, whose IP is its address
+func (d *remoteDeployer) Inspect(ctx context.Context, service ServiceRequest) (ServiceManifest, error) {
+	hostname, err := d.Exec(ctx, service, []string{"hostname"}, ExecOptions{})
+	if err != nil {
+		return ServiceManifest{}, err
+	}
+
+	return ServiceManifest{
+		Hostname: hostname,
+		IP:       d.address,
+		Name:     service.Name,
+		Platform: d.os,
+	}, nil
+}
+
+// Logs returns the latest logs of the system of the remote host: the journal in Linux, and the
+// system event log in Windows
+func (d *remoteDeployer) Logs(ctx context.Context, service ServiceRequest) (string, error) {
+	cmds := []string{"journalctl", "--no-pager", "-n", "1000"}
+	if d.os == WindowsPlatform {
+		cmds = []string{"Invoke-Expression", "Get-EventLog -LogName System -Newest 1000 | Format-List | Out-String -Width 4096"}
+	}
+
+	return d.Exec(ctx, service, cmds, ExecOptions{})
+}
+
+// Platform returns the OS of the remote host
+func (d *remoteDeployer) Platform() string {
+	return d.os
+}
+
+// Remove does nothing, as the remote host is reused by the next scenarios
+func (d *remoteDeployer) Remove(ctx context.Context, service ServiceRequest) error {
+	return nil
+}
+
+// Restart reboots the remote host, waiting for it to be back with a new boot ID, which is the time
+// of the last boot in the Windows hosts
+func (d *remoteDeployer) Restart(ctx context.Context, service ServiceRequest) error {
+	bootIDCmd := []string{"cat", "/proc/sys/kernel/random/boot_id"}
+	rebootCmd := d.command([]string{"systemctl", "reboot"})
+	if d.os == WindowsPlatform {
+		bootIDCmd = []string{"Invoke-Expression", "(Get-CimInstance -ClassName Win32_OperatingSystem).LastBootUpTime.ToString('o')"}
+		rebootCmd = powershellCommand(powershellInvocation([]string{"Restart-Computer", "-Force"}))
+	}
+
+	bootID, err := d.Exec(ctx, service, bootIDCmd, ExecOptions{IgnoreExitCode: true})
+	if err != nil {
+		return err
+	}
+
+	// the SSH session is closed by the reboot, so its error is ignored
+	_, _ = d.run(rebootCmd)
+
+	exp := utils.NewExponentialBackOff(rebootTimeout)
+
+	rebootedFn := func() error {
+		currentBootID, err := d.Exec(ctx, service, bootIDCmd, ExecOptions{IgnoreExitCode: true})
+		if err != nil {
+			return err
+		}
+
+		if currentBootID == bootID {
+			return fmt.Errorf("The remote host %s has not been rebooted yet", d.address)
+		}
+
+		return nil
+	}
+
+	err = backoff.Retry(rebootedFn, backoff.WithContext(exp, ctx))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"address":     d.address,
+			"elapsedTime": exp.GetElapsedTime(),
+			"error":       err,
+		}).Error("The remote host is not back after the reboot")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"address":     d.address,
+		"elapsedTime": exp.GetElapsedTime(),
+	}).Debug("The remote host has been rebooted")
+	return nil
+}
+
+// clientArgs returns the args of the SSH clients connecting to the remote host, with the flag
+// setting the port, which is -p for ssh and -P for scp. The remote host is not known in advance,
+// so its host key is not checked
+func (d *remoteDeployer) clientArgs(portFlag string) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "LogLevel=ERROR",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		portFlag, d.port,
+	}
+
+	if d.identityFile != "" {
+		args = append(args, "-i", filepath.Clean(d.identityFile))
+	}
+
+	return args
+}
+
+// command returns the command line run by the remote shell, with sudo if the user is not root.
+// The Windows hosts run the commands with PowerShell
+func (d *remoteDeployer) command(cmds []string) string {
+	if d.os == WindowsPlatform {
+		return powershellCommand(powershellInvocation(cmds))
+	}
+
+	if d.user != "root" {
+		cmds = append([]string{"sudo", "-n"}, cmds...)
+	}
+
+	return shellCommand(cmds)
+}
+
+// copy copies a local file to a path of the remote host with scp
+func (d *remoteDeployer) copy(localPath string, remotePath string) error {
+	args := append(d.clientArgs("-P"), localPath, d.user+"@"+d.address+":"+remotePath)
+
+	_, err := shell.Execute(".", "scp", args...)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"address": d.address,
+			"error":   err,
+			"path":    localPath,
+		}).Error("Could not copy the file to the remote host")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"address": d.address,
+		"path":    remotePath,
+	}).Debug("The file was copied to the remote host")
+
+	return nil
+}
+
+// run runs a command line in the remote shell
+func (d *remoteDeployer) run(command string) (string, error) {
+	args := append(d.clientArgs("-p"), d.user+"@"+d.address, "--", command)
+
+	return shell.Execute(".", "ssh", args...)
+}
+
+// safeShellArg matches the args which do not need quoting in a shell
+var safeShellArg = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+
+// shellCommand returns the command line running a command with its args in a POSIX shell
+func shellCommand(cmds []string) string {
+	quoted := make([]string, len(cmds))
+	for i, arg := range cmds {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes an arg for a POSIX shell, as the remote shell splits the command line again
+func shellQuote(arg string) string {
+	if safeShellArg.MatchString(arg) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// powershellCommand returns the command line running a PowerShell script in the Windows hosts. The
+// script is encoded, so that it's not parsed by the default shell of the SSH server, i.e. cmd.exe
+func powershellCommand(script string) string {
+	encoded := utf16.Encode([]rune(script))
+
+	raw := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(raw[i*2:], r)
+	}
+
+	return "powershell.exe -NoProfile -NonInteractive -EncodedCommand " + base64.StdEncoding.EncodeToString(raw)
+}
+
+// powershellInvocation returns the PowerShell expression calling a command, which could be a
+// cmdlet or an executable, with its args
+func powershellInvocation(cmds []string) string {
+	quoted := make([]string, len(cmds))
+	for i, arg := range cmds {
+		quoted[i] = PowershellQuote(arg)
+	}
+
+	return "& " + strings.Join(quoted, " ")
+}
+
+// safePowershellArg matches the args which do not need quoting in PowerShell, so that the parameters
+// of the cmdlets, i.e. -Force, are not passed as strings
+var safePowershellArg = regexp.MustCompile(`^[A-Za-z0-9_./:\\-]+$`)
+
+// PowershellQuote quotes an arg for PowerShell, whose single-quoted strings are verbatim
+func PowershellQuote(arg string) string {
+	if safePowershellArg.MatchString(arg) {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+}
+
+// windowsExecScript returns the PowerShell script executing a command in the Windows hosts, which
+// fails if a cmdlet fails or an executable exits with an error, or starts it in a hidden window, so
+// that it's detached from the SSH session
+func windowsExecScript(cmds []string, detach bool) string {
+	if detach {
+		quoted := make([]string, len(cmds))
+		for i, arg := range cmds {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", "''") + "'"
+		}
+
+		script := "Start-Process -WindowStyle Hidden -FilePath " + quoted[0]
+		if len(quoted) > 1 {
+			script += " -ArgumentList " + strings.Join(quoted[1:], ", ")
+		}
+		return script
+	}
+
+	return "$ErrorActionPreference = 'Stop'; " + powershellInvocation(cmds) + "; if ($LASTEXITCODE) { exit $LASTEXITCODE }"
+}
@@ -0,0 +1,115 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package elasticsearch is a typed client of the search API of Elasticsearch, building the queries
+// with a fluent builder instead of nested maps, and decoding the responses into Go structs, so that
+// a change in the schema of a response is reported as an error instead of a panic
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	es "github.com/elastic/go-elasticsearch/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client a typed client of the search API of Elasticsearch
+type Client struct {
+	esClient *es.Client
+}
+
+// NewClient returns a typed client wrapping a client of Elasticsearch, which is configured with
+// its address and credentials
+func NewClient(esClient *es.Client) *Client {
+	return &Client{
+		esClient: esClient,
+	}
+}
+
+// SearchResult the result of a search
+type SearchResult struct {
+	Hits     Hits `json:"hits"`
+	TimedOut bool `json:"timed_out"`
+	Took     int  `json:"took"` // in milliseconds
+}
+
+// Hits the hits of a search, and their total number, which could be greater than the number of
+// hits returned by the search
+type Hits struct {
+	Hits  []Hit `json:"hits"`
+	Total struct {
+		Relation string `json:"relation"` // eq, or gte if the total is a lower bound
+		Value    int    `json:"value"`
+	} `json:"total"`
+}
+
+// Hit a document matching a search
+type Hit struct {
+	ID     string                 `json:"_id"`
+	Index  string                 `json:"_index"` // the backing index of a data stream
+	Source map[string]interface{} `json:"_source"`
+}
+
+// errorResponse the body of the responses with an error status code
+type errorResponse struct {
+	Error struct {
+		Reason string `json:"reason"`
+		Type   string `json:"type"`
+	} `json:"error"`
+}
+
+// Search executes a query over an index, which could be a data stream or a pattern
+func (c *Client) Search(ctx context.Context, index string, query *Query) (*SearchResult, error) {
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(query.Map())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.esClient.Search(
+		c.esClient.Search.WithContext(ctx),
+		c.esClient.Search.WithIndex(index),
+		c.esClient.Search.WithBody(&buf),
+		c.esClient.Search.WithTrackTotalHits(true),
+	)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"index": index,
+		}).Error("Error performing search on Elasticsearch")
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		errResponse := errorResponse{}
+		_ = json.NewDecoder(res.Body).Decode(&errResponse)
+
+		return nil, &APIError{
+			Reason:     errResponse.Error.Reason,
+			StatusCode: res.StatusCode,
+			Type:       errResponse.Error.Type,
+		}
+	}
+
+	result := SearchResult{}
+	err = json.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"index": index,
+		}).Error("Error parsing response body from Elasticsearch")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"hits":  result.Hits.Total.Value,
+		"index": index,
+		"took":  result.Took,
+	}).Debug("Response information")
+
+	return &result, nil
+}
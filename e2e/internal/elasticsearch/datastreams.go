@@ -0,0 +1,124 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CountDocuments returns the number of documents of the indices or data streams matching a pattern,
+// i.e. logs-*, which is zero if there are none yet
+func (c *Client) CountDocuments(ctx context.Context, pattern string) (int, error) {
+	response := struct {
+		Count int `json:"count"`
+	}{}
+
+	err := c.perform(ctx, http.MethodGet, "/"+pattern+"/_count?ignore_unavailable=true", &response)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Count, nil
+}
+
+// DeleteDataStreams deletes the data streams matching some patterns, i.e. logs-*, with their backing
+// indices, returning the names of the deleted ones. The data streams are deleted by name, as the
+// deletions with wildcards could be forbidden by the cluster
+func (c *Client) DeleteDataStreams(ctx context.Context, patterns []string) ([]string, error) {
+	names, err := c.ListDataStreams(ctx, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	err = c.perform(ctx, http.MethodDelete, "/_data_stream/"+strings.Join(names, ","), nil)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dataStreams": names,
+			"error":       err,
+		}).Error("Could not delete the data streams")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"dataStreams": names,
+	}).Debug("Data streams deleted")
+
+	return names, nil
+}
+
+// GetDataStreamsStats returns the stats of the data streams matching some patterns, i.e. logs-*,
+// with their number of backing indices, their size and their maximum timestamp
+func (c *Client) GetDataStreamsStats(ctx context.Context, patterns []string) (json.RawMessage, error) {
+	response := json.RawMessage{}
+
+	err := c.perform(ctx, http.MethodGet, "/_data_stream/"+strings.Join(patterns, ",")+"/_stats", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ListDataStreams returns the names of the data streams matching some patterns, i.e. logs-*
+func (c *Client) ListDataStreams(ctx context.Context, patterns []string) ([]string, error) {
+	response := struct {
+		DataStreams []struct {
+			Name string `json:"name"`
+		} `json:"data_streams"`
+	}{}
+
+	err := c.perform(ctx, http.MethodGet, "/_data_stream/"+strings.Join(patterns, ","), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, dataStream := range response.DataStreams {
+		names = append(names, dataStream.Name)
+	}
+
+	return names, nil
+}
+
+// perform sends a request to a path of the API not covered by the Elasticsearch client, decoding
+// the response into the result, which is ignored if it's nil
+func (c *Client) perform(ctx context.Context, method string, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, path, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.esClient.Perform(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		errResponse := errorResponse{}
+		_ = json.NewDecoder(res.Body).Decode(&errResponse)
+
+		return &APIError{
+			Reason:     errResponse.Error.Reason,
+			StatusCode: res.StatusCode,
+			Type:       errResponse.Error.Type,
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
@@ -0,0 +1,31 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIndexNotFound the error of the searches over an index which does not exist yet, i.e. because
+// no document was sent to a data stream. Check it with errors.Is
+var ErrIndexNotFound = errors.New("index not found")
+
+// APIError the error of a request to the Elasticsearch API whose response has an error status code
+type APIError struct {
+	Reason     string // the reason of the error in the body of the response
+	StatusCode int
+	Type       string // the type of the error in the body of the response, i.e. index_not_found_exception
+}
+
+// Error returns the message of the error
+func (e *APIError) Error() string {
+	return fmt.Sprintf("the request to Elasticsearch failed with %d: %s: %s", e.StatusCode, e.Type, e.Reason)
+}
+
+// Is checks if the error is ErrIndexNotFound
+func (e *APIError) Is(target error) bool {
+	return target == ErrIndexNotFound && e.Type == "index_not_found_exception"
+}
@@ -0,0 +1,167 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimestampField the field of the time of the documents
+const TimestampField = "@timestamp"
+
+// DataStream selects the data streams of a type, dataset and namespace, i.e. logs-elastic_agent-default.
+// An empty part selects all the data streams with any value for it
+type DataStream struct {
+	Dataset   string // i.e. elastic_agent or system.cpu
+	Namespace string // i.e. default
+	Type      string // i.e. logs or metrics
+}
+
+// Name returns the name of the data streams, which is a pattern if any part is empty,
+// i.e. metrics-*-default
+func (ds DataStream) Name() string {
+	return fmt.Sprintf("%s-%s-%s", orWildcard(ds.Type), orWildcard(ds.Dataset), orWildcard(ds.Namespace))
+}
+
+// orWildcard returns the wildcard for the empty parts of the name of a data stream
+func orWildcard(value string) string {
+	if value == "" {
+		return "*"
+	}
+
+	return value
+}
+
+// Query a builder of the queries of the search API, which match the documents passing all of
+// its filters
+type Query struct {
+	filters []map[string]interface{}
+	size    int
+	sort    []map[string]interface{}
+}
+
+// NewQuery returns a query matching all the documents
+func NewQuery() *Query {
+	return &Query{
+		filters: []map[string]interface{}{},
+	}
+}
+
+// WithDataStream filters the documents by the fields of a data stream, skipping its empty parts
+func (q *Query) WithDataStream(ds DataStream) *Query {
+	fields := map[string]string{
+		"data_stream.dataset":   ds.Dataset,
+		"data_stream.namespace": ds.Namespace,
+		"data_stream.type":      ds.Type,
+	}
+
+	for _, field := range []string{"data_stream.type", "data_stream.dataset", "data_stream.namespace"} {
+		if fields[field] != "" {
+			q.WithTerm(field, fields[field])
+		}
+	}
+
+	return q
+}
+
+// WithHostName filters the documents by the name of the host sending them
+func (q *Query) WithHostName(hostname string) *Query {
+	q.filters = append(q.filters, map[string]interface{}{
+		"match_phrase": map[string]interface{}{
+			"host.name": hostname,
+		},
+	})
+
+	return q
+}
+
+// WithPhrase filters the documents whose field contains a phrase, i.e. the lines of a log file with
+// a marker in their message
+func (q *Query) WithPhrase(field string, phrase string) *Query {
+	q.filters = append(q.filters, map[string]interface{}{
+		"match_phrase": map[string]interface{}{
+			field: phrase,
+		},
+	})
+
+	return q
+}
+
+// WithSize sets the max number of hits returned by the search
+func (q *Query) WithSize(size int) *Query {
+	q.size = size
+
+	return q
+}
+
+// WithSort sorts the hits by a field, in ascending or descending order, after the previous sorts
+func (q *Query) WithSort(field string, descending bool) *Query {
+	order := "asc"
+	if descending {
+		order = "desc"
+	}
+
+	q.sort = append(q.sort, map[string]interface{}{
+		field: map[string]interface{}{
+			"order": order,
+		},
+	})
+
+	return q
+}
+
+// WithTerm filters the documents by the exact value of a field
+func (q *Query) WithTerm(field string, value interface{}) *Query {
+	q.filters = append(q.filters, map[string]interface{}{
+		"term": map[string]interface{}{
+			field: value,
+		},
+	})
+
+	return q
+}
+
+// WithTimeRange filters the documents by their timestamp, from a time and up to another, both
+// included. A zero time leaves that side of the range open
+func (q *Query) WithTimeRange(from time.Time, to time.Time) *Query {
+	timeRange := map[string]interface{}{
+		"format": "strict_date_optional_time",
+	}
+	if !from.IsZero() {
+		timeRange["gte"] = from.UTC().Format(time.RFC3339Nano)
+	}
+	if !to.IsZero() {
+		timeRange["lte"] = to.UTC().Format(time.RFC3339Nano)
+	}
+
+	q.filters = append(q.filters, map[string]interface{}{
+		"range": map[string]interface{}{
+			TimestampField: timeRange,
+		},
+	})
+
+	return q
+}
+
+// Map returns the body of the search request of the query
+func (q *Query) Map() map[string]interface{} {
+	body := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": q.filters,
+			},
+		},
+	}
+
+	if q.size > 0 {
+		body["size"] = q.size
+	}
+	if len(q.sort) > 0 {
+		body["sort"] = q.sort
+	}
+
+	return body
+}
@@ -0,0 +1,106 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertQueryJSON checks that the body of the search request of a query marshals to the expected DSL
+func assertQueryJSON(t *testing.T, expected string, query *Query) {
+	body, err := json.Marshal(query.Map())
+	assert.Nil(t, err)
+	assert.JSONEq(t, expected, string(body))
+}
+
+func TestDataStreamName(t *testing.T) {
+	tests := []struct {
+		ds       DataStream
+		expected string
+	}{
+		{DataStream{Type: "logs", Dataset: "elastic_agent", Namespace: "default"}, "logs-elastic_agent-default"},
+		{DataStream{Type: "metrics", Namespace: "default"}, "metrics-*-default"},
+		{DataStream{}, "*-*-*"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.ds.Name())
+	}
+}
+
+func TestQuery(t *testing.T) {
+	from := time.Date(2021, 6, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	to := time.Date(2021, 6, 1, 10, 5, 0, 500, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    *Query
+		expected string
+	}{
+		{
+			name:     "all the documents",
+			query:    NewQuery(),
+			expected: `{"query":{"bool":{"filter":[]}}}`,
+		},
+		{
+			name:  "data stream skipping the empty parts",
+			query: NewQuery().WithDataStream(DataStream{Type: "metrics", Namespace: "default"}),
+			expected: `{"query":{"bool":{"filter":[
+				{"term":{"data_stream.type":"metrics"}},
+				{"term":{"data_stream.namespace":"default"}}
+			]}}}`,
+		},
+		{
+			name:  "host name and phrase",
+			query: NewQuery().WithHostName("e2e-host").WithPhrase("message", "the marker"),
+			expected: `{"query":{"bool":{"filter":[
+				{"match_phrase":{"host.name":"e2e-host"}},
+				{"match_phrase":{"message":"the marker"}}
+			]}}}`,
+		},
+		{
+			name:  "terms of any type",
+			query: NewQuery().WithTerm("labels.run_id", "abc").WithTerm("labels.datagen_seed", 42).WithTerm("event.ingested", true),
+			expected: `{"query":{"bool":{"filter":[
+				{"term":{"labels.run_id":"abc"}},
+				{"term":{"labels.datagen_seed":42}},
+				{"term":{"event.ingested":true}}
+			]}}}`,
+		},
+		{
+			name:  "closed time range in UTC",
+			query: NewQuery().WithTimeRange(from, to),
+			expected: `{"query":{"bool":{"filter":[
+				{"range":{"@timestamp":{"format":"strict_date_optional_time","gte":"2021-06-01T08:00:00Z","lte":"2021-06-01T10:05:00.0000005Z"}}}
+			]}}}`,
+		},
+		{
+			name:  "open time range",
+			query: NewQuery().WithTimeRange(from, time.Time{}),
+			expected: `{"query":{"bool":{"filter":[
+				{"range":{"@timestamp":{"format":"strict_date_optional_time","gte":"2021-06-01T08:00:00Z"}}}
+			]}}}`,
+		},
+		{
+			name:  "size and sorts",
+			query: NewQuery().WithSize(10).WithSort(TimestampField, true).WithSort("event.sequence", false),
+			expected: `{
+				"query":{"bool":{"filter":[]}},
+				"size":10,
+				"sort":[{"@timestamp":{"order":"desc"}},{"event.sequence":{"order":"asc"}}]
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertQueryJSON(t, tt.expected, tt.query)
+		})
+	}
+}
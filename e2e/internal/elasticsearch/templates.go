@@ -0,0 +1,36 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ExistsIndexTemplate checks if a composable index template exists, i.e. logs-nginx.access
+func (c *Client) ExistsIndexTemplate(ctx context.Context, name string) (bool, error) {
+	return c.exists(ctx, "/_index_template/"+name)
+}
+
+// ExistsIngestPipeline checks if an ingest pipeline exists, i.e. logs-nginx.access-1.0.0
+func (c *Client) ExistsIngestPipeline(ctx context.Context, id string) (bool, error) {
+	return c.exists(ctx, "/_ingest/pipeline/"+id)
+}
+
+// exists checks if a resource of the API exists, which is not found when the response has the 404
+// status code
+func (c *Client) exists(ctx context.Context, path string) (bool, error) {
+	err := c.perform(ctx, http.MethodGet, path, nil)
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
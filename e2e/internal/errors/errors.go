@@ -0,0 +1,86 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package errors defines the kinds of the errors of the steps of the suites, so that the steps and
+// the retry loops check them with errors.Is instead of matching their messages, and the reports
+// classify the failures by their kind
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAgentInstallFailed the error of the install command of an agent, i.e. because its enrollment
+// token was revoked
+var ErrAgentInstallFailed = errors.New("agent install failed")
+
+// ErrAgentNotListed the error of the lookups of an agent which is not listed in Fleet
+var ErrAgentNotListed = errors.New("agent not listed in Fleet")
+
+// ErrIntegrationNotFound the error of the lookups of an integration, in the Package Registry or in
+// a policy, which is not found
+var ErrIntegrationNotFound = errors.New("integration not found")
+
+// ErrScenarioAborted the error of the steps of a scenario aborted with the control API of the
+// runner, i.e. by an orchestration system
+var ErrScenarioAborted = errors.New("scenario aborted")
+
+// ErrSLOExceeded the error of a measurement exceeding its SLO, i.e. the time an agent takes to
+// acknowledge a change of its policy
+var ErrSLOExceeded = errors.New("SLO exceeded")
+
+// ErrTimeoutWaitingForStatus the error of the waits for a resource to be in a status which timed out
+var ErrTimeoutWaitingForStatus = errors.New("timeout waiting for status")
+
+// kinds the names of the kinds of the errors reported in the failures, checked in order, as the
+// timeouts wrap the last error of the wait
+var kinds = []struct {
+	err  error
+	name string
+}{
+	{err: ErrTimeoutWaitingForStatus, name: "timeout-waiting-for-status"},
+	{err: ErrAgentInstallFailed, name: "agent-install-failed"},
+	{err: ErrAgentNotListed, name: "agent-not-listed"},
+	{err: ErrIntegrationNotFound, name: "integration-not-found"},
+	{err: ErrSLOExceeded, name: "slo-exceeded"},
+	{err: ErrScenarioAborted, name: "scenario-aborted"},
+}
+
+// Kind returns the name of the kind of an error, i.e. agent-not-listed, or an empty string if the
+// error is not of a known kind
+func Kind(err error) string {
+	for _, kind := range kinds {
+		if errors.Is(err, kind.err) {
+			return kind.name
+		}
+	}
+
+	return ""
+}
+
+// StatusTimeoutError the error of a wait for a resource to be in a status which timed out, wrapping
+// the last error of the wait, i.e. ErrAgentNotListed
+type StatusTimeoutError struct {
+	Elapsed  time.Duration
+	Err      error  // the last error of the wait
+	Resource string // i.e. the agent of the centos-1 hostname
+	Status   string
+}
+
+// Error returns the message of the error
+func (e *StatusTimeoutError) Error() string {
+	return fmt.Sprintf("%s is not in the %s status after %s: %v", e.Resource, e.Status, e.Elapsed.Round(time.Second), e.Err)
+}
+
+// Is checks if the error is ErrTimeoutWaitingForStatus
+func (e *StatusTimeoutError) Is(target error) bool {
+	return target == ErrTimeoutWaitingForStatus
+}
+
+// Unwrap returns the last error of the wait
+func (e *StatusTimeoutError) Unwrap() error {
+	return e.Err
+}
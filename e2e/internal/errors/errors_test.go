@@ -0,0 +1,95 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrappedSentinelErrors(t *testing.T) {
+	sentinels := []error{
+		ErrAgentInstallFailed,
+		ErrAgentNotListed,
+		ErrIntegrationNotFound,
+		ErrScenarioAborted,
+		ErrSLOExceeded,
+		ErrTimeoutWaitingForStatus,
+	}
+
+	for _, sentinel := range sentinels {
+		t.Run(sentinel.Error(), func(t *testing.T) {
+			wrapped := fmt.Errorf("the step failed: %w", fmt.Errorf("the lookup failed: %w", sentinel))
+			assert.True(t, errors.Is(wrapped, sentinel))
+
+			// the errors wrapped with pkg/errors, as some steps do
+			assert.True(t, errors.Is(pkgerrors.Wrap(sentinel, "the step failed"), sentinel))
+
+			// the errors formatted without wrapping lose their kind
+			assert.False(t, errors.Is(fmt.Errorf("the step failed: %v", sentinel), sentinel))
+
+			for _, other := range sentinels {
+				if other != sentinel {
+					assert.False(t, errors.Is(wrapped, other), other.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestStatusTimeoutError(t *testing.T) {
+	err := &StatusTimeoutError{
+		Elapsed:  90*time.Second + 400*time.Millisecond,
+		Err:      fmt.Errorf("the agent of the centos-1 hostname is not listed: %w", ErrAgentNotListed),
+		Resource: "the agent of the centos-1 hostname",
+		Status:   "online",
+	}
+
+	wrapped := fmt.Errorf("the step failed: %w", err)
+
+	assert.True(t, errors.Is(wrapped, ErrTimeoutWaitingForStatus))
+	assert.True(t, errors.Is(wrapped, ErrAgentNotListed))
+	assert.False(t, errors.Is(wrapped, ErrAgentInstallFailed))
+
+	var timeoutErr *StatusTimeoutError
+	assert.True(t, errors.As(wrapped, &timeoutErr))
+	assert.Equal(t, "online", timeoutErr.Status)
+
+	assert.Equal(t, "the agent of the centos-1 hostname is not in the online status after 1m30s: the agent of the centos-1 hostname is not listed: agent not listed in Fleet", err.Error())
+
+	// a timeout without the last error of the wait
+	assert.True(t, errors.Is(&StatusTimeoutError{Status: "online"}, ErrTimeoutWaitingForStatus))
+}
+
+func TestKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"no error", nil, ""},
+		{"unknown error", errors.New("boom"), ""},
+		{"formatted sentinel", fmt.Errorf("boom: %v", ErrSLOExceeded), ""},
+		{"agent install failed", fmt.Errorf("install: %w", ErrAgentInstallFailed), "agent-install-failed"},
+		{"agent not listed", ErrAgentNotListed, "agent-not-listed"},
+		{"integration not found", fmt.Errorf("policy: %w", ErrIntegrationNotFound), "integration-not-found"},
+		{"scenario aborted", ErrScenarioAborted, "scenario-aborted"},
+		{"SLO exceeded", fmt.Errorf("enrollment: %w", ErrSLOExceeded), "slo-exceeded"},
+		{"timeout", ErrTimeoutWaitingForStatus, "timeout-waiting-for-status"},
+		// the timeouts are reported as such, instead of the last error of the wait
+		{"timeout wrapping the last error", &StatusTimeoutError{Err: ErrAgentNotListed}, "timeout-waiting-for-status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Kind(tt.err))
+		})
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package kibana is a typed client of the Fleet, Integrations and Security APIs of the Kibana
+// running in the host, decoding the responses into Go structs, so that a change in the schema
+// of a response is reported as an error instead of a panic
+package kibana
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/services"
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// Client a typed client of the Kibana API, retrying the requests which fail with a transient
+// error with the retry policy of the class of their endpoint
+type Client struct {
+	baseURL  func() string
+	policies map[EndpointClass]RetryPolicy
+}
+
+// versionCache the versions of the Kibanas reached by the clients, by base URL, which are
+// requested once, as the routes of some endpoints depend on them, until the stack is upgraded
+// or restored
+var versionCache = struct {
+	mutex   sync.Mutex
+	numbers map[string]string // i.e. 8.0.0
+}{
+	numbers: map[string]string{},
+}
+
+// ResetVersionCache forgets the versions of Kibana retrieved by the clients, so that they are
+// requested again, i.e. once the stack is upgraded in place or restored to its previous version
+func ResetVersionCache() {
+	versionCache.mutex.Lock()
+	defer versionCache.mutex.Unlock()
+
+	versionCache.numbers = map[string]string{}
+}
+
+// NewClient returns a client of the Kibana running in the host, which is reached with https
+// once the certificates of the secured stack are generated
+func NewClient() *Client {
+	kibanaClient := services.NewKibanaClient()
+
+	return &Client{
+		baseURL: kibanaClient.GetBaseURL,
+		policies: map[EndpointClass]RetryPolicy{
+			MutatingEndpoints: DefaultMutatingPolicy,
+			ReadEndpoints:     DefaultReadPolicy,
+		},
+	}
+}
+
+// NewClientWithBaseURL returns a client of the Kibana served at a base URL, i.e. a fake Kibana
+// replacing the one of the profile in the contexts of the suites
+func NewClientWithBaseURL(baseURL string) *Client {
+	client := NewClient()
+	client.baseURL = func() string {
+		return baseURL
+	}
+
+	return client
+}
+
+// kibanaStatusURL the URL of the status API of Kibana
+const kibanaStatusURL = "/api/status"
+
+// BaseURL returns the base URL of Kibana
+func (c *Client) BaseURL() string {
+	return c.baseURL()
+}
+
+// delete sends a DELETE request to a path of the API, decoding the response into the result,
+// which is ignored if it's nil
+func (c *Client) delete(path string, result interface{}) error {
+	return c.do(http.MethodDelete, path, "", nil, result)
+}
+
+// do sends a request to a path of the API, with the payload encoded as JSON, decoding the
+// response into the result, which is ignored if it's nil
+func (c *Client) do(method string, path string, query string, payload interface{}, result interface{}) error {
+	r := curl.HTTPRequest{
+		BasicAuthUser:     "elastic",
+		BasicAuthPassword: "changeme",
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"kbn-xsrf":     "e2e-tests",
+		},
+		// let's not URL encode the querystring, as Kibana is not handling the encoded
+		// ones properly, returning a 400 Bad Request error with this message:
+		// [request query.page=1&perPage=20&showInactive=true]: definition for this key is missing
+		EncodeURL:   false,
+		QueryString: query,
+		URL:         c.baseURL() + path,
+	}
+
+	if payload != nil {
+		bytes, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		r.Payload = string(bytes)
+	}
+
+	class := endpointClass(method)
+	policy := c.retryPolicy(class)
+	attempts := []*APIError{}
+	startedAt := time.Now()
+
+	var body string
+	for {
+		var apiErr *APIError
+		body, apiErr = c.send(method, path, r)
+		if apiErr == nil {
+			break
+		}
+		attempts = append(attempts, apiErr)
+
+		if len(attempts) >= policy.MaxAttempts || !policy.retryable(class, apiErr) {
+			log.WithFields(log.Fields{
+				"attempts":   len(attempts),
+				"body":       body,
+				"error":      apiErr.Err,
+				"method":     method,
+				"payload":    r.Payload,
+				"statusCode": apiErr.StatusCode,
+				"url":        apiErr.URL,
+			}).Error("The request to Kibana failed")
+
+			if len(attempts) == 1 {
+				return apiErr
+			}
+
+			return &RetryError{
+				Attempts: attempts,
+				Elapsed:  time.Since(startedAt),
+			}
+		}
+
+		wait := policy.wait(len(attempts), apiErr)
+
+		log.WithFields(log.Fields{
+			"attempt":    len(attempts),
+			"error":      apiErr.Err,
+			"method":     method,
+			"retryIn":    wait,
+			"statusCode": apiErr.StatusCode,
+			"url":        apiErr.URL,
+		}).Warn("The request to Kibana failed with a transient error, retrying it")
+
+		time.Sleep(wait)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(body), result)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":        err,
+			"responseBody": body,
+			"url":          r.GetURL(),
+		}).Error("Could not parse response into JSON")
+
+		return &DecodeError{
+			Body: body,
+			Err:  err,
+			URL:  r.GetURL(),
+		}
+	}
+
+	return nil
+}
+
+// GetStatus returns the status of Kibana and its plugins, as returned by its status API, which is
+// not decoded, as its schema changes between the versions of Kibana
+func (c *Client) GetStatus() (json.RawMessage, error) {
+	status := json.RawMessage{}
+
+	err := c.get(kibanaStatusURL, "", &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// GetVersion returns the version of Kibana, i.e. 8.0.0, without the -SNAPSHOT suffix, which is
+// requested to its status API once, until the cache of the versions is reset
+func (c *Client) GetVersion() (string, error) {
+	baseURL := c.baseURL()
+
+	versionCache.mutex.Lock()
+	defer versionCache.mutex.Unlock()
+
+	if number, cached := versionCache.numbers[baseURL]; cached {
+		return number, nil
+	}
+
+	status := struct {
+		Version struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}{}
+
+	err := c.get(kibanaStatusURL, "", &status)
+	if err != nil {
+		return "", err
+	}
+
+	if status.Version.Number == "" {
+		return "", fmt.Errorf("the status of Kibana has no version")
+	}
+
+	number := strings.TrimSuffix(status.Version.Number, snapshotSuffix)
+	versionCache.numbers[baseURL] = number
+
+	log.WithFields(log.Fields{
+		"url":     baseURL,
+		"version": number,
+	}).Trace("Version of Kibana retrieved")
+
+	return number, nil
+}
+
+// majorVersion returns the major version of Kibana, failing if it's not known, as the routes of
+// the versions differ
+func (c *Client) majorVersion() (int, error) {
+	version, err := c.GetVersion()
+	if err != nil {
+		return 0, fmt.Errorf("could not get the version of Kibana: %w", err)
+	}
+
+	major, err := strconv.Atoi(strings.Split(version, ".")[0])
+	if err != nil {
+		return 0, fmt.Errorf("the %s version of Kibana is not valid: %w", version, err)
+	}
+
+	return major, nil
+}
+
+// get sends a GET request to a path of the API, decoding the response into the result
+func (c *Client) get(path string, query string, result interface{}) error {
+	return c.do(http.MethodGet, path, query, nil, result)
+}
+
+// send sends an attempt of a request, as a span of the running step, returning the body of the
+// response and the error of the attempt, if it failed
+func (c *Client) send(method string, path string, r curl.HTTPRequest) (string, *APIError) {
+	// the request is a span of the running step, propagated to Kibana, so that its own spans are
+	// correlated with the scenario when it's instrumented with APM too
+	span := tracing.StartSpan(method+" "+path, "external.http.kibana", nil)
+	if traceparent := tracing.Traceparent(span); traceparent != "" {
+		r.Headers["Traceparent"] = traceparent
+	}
+
+	var body string
+	var err error
+	switch method {
+	case http.MethodDelete:
+		body, err = curl.Delete(r)
+	case http.MethodPost:
+		body, err = curl.Post(r)
+	case http.MethodPut:
+		body, err = curl.Put(r)
+	default:
+		body, err = curl.Get(r)
+	}
+	tracing.EndSpan(span, err)
+
+	if err == nil {
+		return body, nil
+	}
+
+	apiErr := &APIError{
+		Body:   body,
+		Err:    err,
+		Method: method,
+		URL:    r.GetURL(),
+	}
+
+	var statusErr *curl.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		apiErr.StatusCode = statusErr.StatusCode
+	}
+
+	return body, apiErr
+}
+
+// post sends a POST request to a path of the API, decoding the response into the result,
+// which is ignored if it's nil
+func (c *Client) post(path string, payload interface{}, result interface{}) error {
+	return c.do(http.MethodPost, path, "", payload, result)
+}
+
+// retryPolicy returns the retry policy of a class of endpoints
+func (c *Client) retryPolicy(class EndpointClass) RetryPolicy {
+	policy, exists := c.policies[class]
+	if !exists || policy.MaxAttempts < 1 {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+
+	return policy
+}
+
+// put sends a PUT request to a path of the API, decoding the response into the result, which
+// is ignored if it's nil
+func (c *Client) put(path string, payload interface{}, result interface{}) error {
+	return c.do(http.MethodPut, path, "", payload, result)
+}
+
+// WithRetryPolicy returns a copy of the client retrying the requests of a class of endpoints with
+// a policy, i.e. one with a single attempt to disable the retries of the mutating endpoints
+func (c *Client) WithRetryPolicy(class EndpointClass, policy RetryPolicy) *Client {
+	policies := map[EndpointClass]RetryPolicy{}
+	for k, v := range c.policies {
+		policies[k] = v
+	}
+	policies[class] = policy
+
+	return &Client{
+		baseURL:  c.baseURL,
+		policies: policies,
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newVersionServer returns a server of the status API of a Kibana, whose version can be changed,
+// i.e. when the stack is upgraded, recording the paths of the requests
+func newVersionServer(version string) (*httptest.Server, func(string), func() []string) {
+	mutex := sync.Mutex{}
+	paths := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		paths = append(paths, r.URL.Path)
+
+		if r.URL.Path != kibanaStatusURL {
+			_, _ = w.Write([]byte(`{"items":[],"list":[]}`))
+			return
+		}
+
+		if version == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"version":{"number":"%s"}}`, version)))
+	}))
+
+	upgrade := func(v string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		version = v
+	}
+
+	requested := func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return append([]string{}, paths...)
+	}
+
+	return server, upgrade, requested
+}
+
+func TestGetVersionIsCached(t *testing.T) {
+	server, _, requested := newVersionServer("7.16.0-SNAPSHOT")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL)
+
+	version, err := client.GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "7.16.0", version)
+
+	// the copies and the other clients of the same Kibana reuse the version
+	version, err = client.WithRetryPolicy(ReadEndpoints, testPolicy).GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "7.16.0", version)
+
+	version, err = NewClientWithBaseURL(server.URL).GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "7.16.0", version)
+
+	assert.Equal(t, []string{kibanaStatusURL}, requested())
+}
+
+func TestGetVersionOfDifferentKibanas(t *testing.T) {
+	legacy, _, _ := newVersionServer("7.16.0")
+	defer legacy.Close()
+
+	current, _, _ := newVersionServer("8.0.0")
+	defer current.Close()
+
+	version, err := NewClientWithBaseURL(legacy.URL).GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "7.16.0", version)
+
+	version, err = NewClientWithBaseURL(current.URL).GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "8.0.0", version)
+}
+
+func TestResetVersionCache(t *testing.T) {
+	server, upgrade, requested := newVersionServer("7.16.0")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL)
+
+	_, err := client.ListEnrollmentAPIKeys("")
+	assert.Nil(t, err)
+
+	upgrade("8.0.0")
+	ResetVersionCache()
+
+	_, err = client.ListEnrollmentAPIKeys("")
+	assert.Nil(t, err)
+
+	// the routes of the tokens follow the upgrade of the stack
+	assert.Equal(t, []string{
+		kibanaStatusURL, fleetLegacyEnrollmentAPIKeysURL,
+		kibanaStatusURL, fleetEnrollmentAPIKeysURL,
+	}, requested())
+}
+
+func TestUnknownVersionIsNotLegacy(t *testing.T) {
+	server, upgrade, requested := newVersionServer("")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL).WithRetryPolicy(ReadEndpoints, RetryPolicy{MaxAttempts: 1})
+
+	_, err := client.ListEnrollmentAPIKeys("")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "could not get the version of Kibana")
+
+	// the failed lookup is not cached, and no route of the tokens is requested without the version
+	upgrade("8.0.0")
+
+	_, err = client.ListEnrollmentAPIKeys("")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{kibanaStatusURL, kibanaStatusURL, fleetEnrollmentAPIKeysURL}, requested())
+}
@@ -0,0 +1,161 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fleetEnrollmentAPIKeysURL the route of the enrollment tokens since Kibana 8.0
+const fleetEnrollmentAPIKeysURL = "/api/fleet/enrollment_api_keys"
+
+// fleetLegacyEnrollmentAPIKeysURL the route of the enrollment tokens before Kibana 8.0, which is
+// deprecated since then
+const fleetLegacyEnrollmentAPIKeysURL = "/api/fleet/enrollment-api-keys"
+
+// EnrollmentAPIKey an enrollment token of a policy
+type EnrollmentAPIKey struct {
+	Active    bool   `json:"active"`
+	APIKey    string `json:"api_key"` // the secret used to enroll the agents
+	APIKeyID  string `json:"api_key_id"`
+	CreatedAt string `json:"created_at"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PolicyID  string `json:"policy_id"`
+}
+
+// CreateEnrollmentAPIKey creates an enrollment token with a name for a policy
+func (c *Client) CreateEnrollmentAPIKey(name string, policyID string) (EnrollmentAPIKey, error) {
+	payload := map[string]string{
+		"name":      name,
+		"policy_id": policyID,
+	}
+
+	response := struct {
+		Item EnrollmentAPIKey `json:"item"`
+	}{}
+
+	url, err := c.enrollmentAPIKeysURL()
+	if err != nil {
+		return EnrollmentAPIKey{}, err
+	}
+
+	err = c.post(url, payload, &response)
+	if err != nil {
+		return EnrollmentAPIKey{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"apiKeyId": response.Item.APIKeyID,
+		"policyID": policyID,
+		"tokenId":  response.Item.ID,
+	}).Debug("Fleet token created")
+
+	return response.Item, nil
+}
+
+// DeleteEnrollmentAPIKey deletes an enrollment token, revoking it
+func (c *Client) DeleteEnrollmentAPIKey(id string) error {
+	url, err := c.enrollmentAPIKeysURL()
+	if err != nil {
+		return err
+	}
+
+	return c.delete(url+"/"+id, nil)
+}
+
+// GetEnrollmentAPIKey returns an enrollment token by its ID, which is not active once it's revoked
+func (c *Client) GetEnrollmentAPIKey(id string) (EnrollmentAPIKey, error) {
+	response := struct {
+		Item EnrollmentAPIKey `json:"item"`
+	}{}
+
+	url, err := c.enrollmentAPIKeysURL()
+	if err != nil {
+		return EnrollmentAPIKey{}, err
+	}
+
+	err = c.get(url+"/"+id, "", &response)
+	if err != nil {
+		return EnrollmentAPIKey{}, err
+	}
+
+	return response.Item, nil
+}
+
+// GetEnrollmentAPIKeySecret returns the secret of an enrollment token, which the agents are
+// enrolled with, failing if the token is revoked
+func (c *Client) GetEnrollmentAPIKeySecret(id string) (string, error) {
+	key, err := c.GetEnrollmentAPIKey(id)
+	if err != nil {
+		return "", err
+	}
+
+	if !key.Active {
+		return "", fmt.Errorf("the %s enrollment token is revoked", id)
+	}
+
+	if key.APIKey == "" {
+		return "", fmt.Errorf("the %s enrollment token has no secret", id)
+	}
+
+	return key.APIKey, nil
+}
+
+// ListEnrollmentAPIKeys returns the enrollment tokens of a policy, active or revoked, or the ones of
+// all the policies if the policy is empty. The tokens are filtered by their policy once listed, as
+// the KQL queries of the tokens depend on the version of Kibana
+func (c *Client) ListEnrollmentAPIKeys(policyID string) ([]EnrollmentAPIKey, error) {
+	// the tokens are listed in the items since 8.0, and in the list before it
+	response := struct {
+		Items []EnrollmentAPIKey `json:"items"`
+		List  []EnrollmentAPIKey `json:"list"`
+	}{}
+
+	url, err := c.enrollmentAPIKeysURL()
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.get(url, "page=1&perPage=1000", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := response.Items
+	if listed == nil {
+		listed = response.List
+	}
+
+	keys := []EnrollmentAPIKey{}
+	for _, key := range listed {
+		if policyID == "" || key.PolicyID == policyID {
+			keys = append(keys, key)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"count":    len(keys),
+		"policyID": policyID,
+	}).Trace("Fleet tokens retrieved")
+
+	return keys, nil
+}
+
+// enrollmentAPIKeysURL returns the route of the enrollment tokens in the version of Kibana
+func (c *Client) enrollmentAPIKeysURL() (string, error) {
+	major, err := c.majorVersion()
+	if err != nil {
+		return "", err
+	}
+
+	if major >= 8 {
+		return fleetEnrollmentAPIKeysURL, nil
+	}
+
+	return fleetLegacyEnrollmentAPIKeysURL, nil
+}
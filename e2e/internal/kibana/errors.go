@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound the error of the requests and the lookups which do not find a resource, i.e. an agent
+// by its hostname. Check it with errors.Is, as it's wrapped with the details of the lookup
+var ErrNotFound = errors.New("not found")
+
+// APIError the error of a request to the Kibana API which failed, or whose response has an error
+// status code, which is zero if the request could not be executed
+type APIError struct {
+	Body       string // the body of the response
+	Err        error  // the error executing the request
+	Method     string
+	StatusCode int
+	URL        string
+}
+
+// Error returns the message of the error
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s failed: %v", e.Method, e.URL, e.Err)
+	}
+
+	return fmt.Sprintf("%s %s failed with %d: %s", e.Method, e.URL, e.StatusCode, e.Body)
+}
+
+// Is checks if the error is ErrNotFound, which is the case of the responses with a 404 status code
+func (e *APIError) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Unwrap returns the error executing the request
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError the error of a response of the Kibana API which does not match the expected schema,
+// so that the changes of the API are reported instead of panicking on the missing fields
+type DecodeError struct {
+	Body string // the body of the response
+	Err  error  // the error decoding the body
+	URL  string
+}
+
+// Error returns the message of the error
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("could not decode the response of %s: %v", e.URL, e.Err)
+}
+
+// Unwrap returns the error decoding the body
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// RetryError the error of a request to the Kibana API which failed after retrying it, keeping
+// the error of each attempt. It unwraps to the error of the last attempt, so that errors.Is and
+// errors.As work as for a single attempt
+type RetryError struct {
+	Attempts []*APIError
+	Elapsed  time.Duration
+}
+
+// Error returns the message of the error, with the errors of all the attempts
+func (e *RetryError) Error() string {
+	last := e.Attempts[len(e.Attempts)-1]
+
+	causes := []string{}
+	for i, attempt := range e.Attempts {
+		if attempt.StatusCode == 0 {
+			causes = append(causes, fmt.Sprintf("#%d: %v", i+1, attempt.Err))
+		} else {
+			causes = append(causes, fmt.Sprintf("#%d: %d", i+1, attempt.StatusCode))
+		}
+	}
+
+	return fmt.Sprintf("%s (%d attempts in %s: %s)", last.Error(), len(e.Attempts), e.Elapsed.Round(time.Millisecond), strings.Join(causes, ", "))
+}
+
+// Unwrap returns the error of the last attempt
+func (e *RetryError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1]
+}
@@ -0,0 +1,625 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const fleetAgentsURL = "/api/fleet/agents"
+const fleetAgentURL = fleetAgentsURL + "/%s"
+const fleetAgentEventsURL = fleetAgentURL + "/events"
+const fleetAgentReassignURL = fleetAgentURL + "/reassign"
+const fleetAgentUnenrollURL = fleetAgentURL + "/unenroll"
+const fleetAgentUpgradeURL = fleetAgentURL + "/upgrade"
+const fleetAgentPoliciesURL = "/api/fleet/agent_policies"
+const fleetAgentPolicyURL = fleetAgentPoliciesURL + "/%s"
+const fleetAgentPoliciesDeleteURL = fleetAgentPoliciesURL + "/delete"
+const fleetDataStreamsURL = "/api/fleet/data_streams"
+const fleetOutputsURL = "/api/fleet/outputs"
+const fleetOutputURL = fleetOutputsURL + "/%s"
+const fleetServiceTokensURL = "/api/fleet/service-tokens"
+const fleetSettingsURL = "/api/fleet/settings"
+const fleetSetupURL = "/api/fleet/agents/setup"
+
+// Agent an agent enrolled in Fleet
+type Agent struct {
+	Active            bool          `json:"active"`
+	ID                string        `json:"id"`
+	LastCheckin       string        `json:"last_checkin"`        // the moment of the last checkin of the agent, i.e. 2021-06-01T10:00:00.000Z
+	LastCheckinStatus string        `json:"last_checkin_status"` // the health reported by the agent in its last checkin, i.e. degraded
+	LocalMetadata     AgentMetadata `json:"local_metadata"`
+	PolicyID          string        `json:"policy_id"`
+	PolicyRevision    int           `json:"policy_revision"` // the revision of its policy acknowledged by the agent
+	Status            string        `json:"status"`
+	Tags              []string      `json:"tags"` // the tags the agent was enrolled with
+}
+
+// AgentMetadata the metadata reported by an agent about itself, its host and the operative
+// system of its host
+type AgentMetadata struct {
+	Elastic ElasticMetadata `json:"elastic"`
+	Host    HostMetadata    `json:"host"`
+	OS      OSMetadata      `json:"os"`
+}
+
+// ElasticMetadata the metadata of the agent, reported by the agent and by Endpoint
+type ElasticMetadata struct {
+	Agent AgentInfo `json:"agent"`
+}
+
+// AgentInfo the build of an agent, and if it supports upgrades
+type AgentInfo struct {
+	BuildOriginal string `json:"build.original"` // i.e. 8.0.0-SNAPSHOT (build: 2f5ab8e0ad at 2021-06-01 10:00:00 +0000 UTC)
+	ID            string `json:"id"`
+	LogLevel      string `json:"log_level"`
+	Snapshot      bool   `json:"snapshot"`
+	Upgradeable   bool   `json:"upgradeable"`
+	Version       string `json:"version"`
+}
+
+// HostMetadata the metadata of the host of an agent
+type HostMetadata struct {
+	Architecture string   `json:"architecture"` // i.e. x86_64 or aarch64
+	Hostname     string   `json:"hostname"`
+	ID           string   `json:"id"`
+	IP           []string `json:"ip"`
+	MAC          []string `json:"mac"`
+	Name         string   `json:"name"`
+}
+
+// OSMetadata the metadata of the operative system of the host of an agent
+type OSMetadata struct {
+	Family   string `json:"family"` // i.e. redhat, debian or windows
+	Full     string `json:"full"`   // i.e. CentOS Linux(7 (Core))
+	Kernel   string `json:"kernel"`
+	Name     string `json:"name"`     // i.e. CentOS Linux
+	Platform string `json:"platform"` // i.e. centos, ubuntu or windows
+	Version  string `json:"version"`
+}
+
+// Hostname returns the hostname of the host of the agent
+func (a Agent) Hostname() string {
+	return a.LocalMetadata.Host.Hostname
+}
+
+// LastCheckinTime returns the moment of the last checkin of the agent, failing if the agent has
+// not checked in yet
+func (a Agent) LastCheckinTime() (time.Time, error) {
+	if a.LastCheckin == "" {
+		return time.Time{}, fmt.Errorf("the agent %s has not checked in yet", a.ID)
+	}
+
+	return time.Parse(time.RFC3339Nano, a.LastCheckin)
+}
+
+// Version returns the version of the agent, with the -SNAPSHOT suffix for the snapshots,
+// i.e. 8.0.0-SNAPSHOT
+func (a Agent) Version() string {
+	version := a.LocalMetadata.Elastic.Agent.Version
+	if a.LocalMetadata.Elastic.Agent.Snapshot {
+		version += "-SNAPSHOT"
+	}
+
+	return version
+}
+
+// AgentEvent an event reported by an agent to Fleet
+type AgentEvent struct {
+	Message   string `json:"message"`
+	Subtype   string `json:"subtype"`
+	Timestamp string `json:"timestamp"` // kept as reported, as the events use several layouts
+	Type      string `json:"type"`
+}
+
+// AgentUpgrade the upgrade action of an agent
+type AgentUpgrade struct {
+	Force     bool   `json:"force"`                // upgrade to any version, even if it's not newer than the current one
+	SourceURI string `json:"source_uri,omitempty"` // where the agent downloads the artifact from, i.e. for the snapshots
+	Version   string `json:"version"`
+}
+
+// AgentsQuery filters the agents listed by Fleet
+type AgentsQuery struct {
+	Kuery           string // the KQL query the agents match, i.e. built with AgentsByPolicy and KueryAnd
+	Page            int    // the page of the agents, starting at 1, which is the default
+	PerPage         int    // the max number of agents, defaulting to 20
+	ShowInactive    bool   // include the inactive agents, i.e. the unenrolled ones
+	ShowUpgradeable bool   // only the agents which can be upgraded to the version of Kibana
+}
+
+// querystring returns the querystring of the request listing the agents. The KQL query is the only
+// encoded parameter, as the client does not encode the querystring
+func (q AgentsQuery) querystring() string {
+	page := q.Page
+	if page == 0 {
+		page = 1
+	}
+
+	perPage := q.PerPage
+	if perPage == 0 {
+		perPage = 20
+	}
+
+	query := fmt.Sprintf("page=%d&perPage=%d&showInactive=%t", page, perPage, q.ShowInactive)
+	if q.ShowUpgradeable {
+		query += "&showUpgradeable=true"
+	}
+	if q.Kuery != "" {
+		query += "&kuery=" + url.QueryEscape(q.Kuery)
+	}
+
+	return query
+}
+
+// DataStream a data stream listed by Fleet
+type DataStream struct {
+	Dataset   string `json:"dataset"`
+	Index     string `json:"index"`
+	Namespace string `json:"namespace"`
+	Package   string `json:"package"`
+	Type      string `json:"type"`
+}
+
+// FleetSetup the status of the setup of Fleet
+type FleetSetup struct {
+	IsReady             bool     `json:"isReady"`
+	MissingRequirements []string `json:"missing_requirements"`
+}
+
+// Output an output of Fleet, where the agents send their data to
+type Output struct {
+	Hosts     []string   `json:"hosts"` // i.e. http://elasticsearch:9200, or logstash:5044 without scheme
+	ID        string     `json:"id"`
+	IsDefault bool       `json:"is_default"`
+	Name      string     `json:"name"`
+	SSL       *OutputSSL `json:"ssl,omitempty"`
+	Type      string     `json:"type"` // elasticsearch or logstash
+}
+
+// Policy an agent policy
+type Policy struct {
+	DataOutputID         string `json:"data_output_id,omitempty"` // empty for the default output
+	Description          string `json:"description"`
+	ID                   string `json:"id"`
+	IsDefault            bool   `json:"is_default"`
+	IsDefaultFleetServer bool   `json:"is_default_fleet_server"`        // the policy of the Fleet Servers
+	MonitoringOutputID   string `json:"monitoring_output_id,omitempty"` // empty for the default output
+	Name                 string `json:"name"`
+	Namespace            string `json:"namespace"`
+	// the package policies are only IDs when the policies are listed
+	PackagePolicies []PackagePolicy `json:"package_policies"`
+	Revision        int             `json:"revision"`
+	UpdatedAt       string          `json:"updated_at"`
+}
+
+// ServiceToken a service token of Elasticsearch, which a Fleet Server authenticates with
+type ServiceToken struct {
+	Name  string `json:"name"`
+	Value string `json:"value"` // the token used by the Fleet Server
+}
+
+// CreateAgentPolicy creates an agent policy with a name, which must be unique, in a namespace
+func (c *Client) CreateAgentPolicy(name string, namespace string, description string) (Policy, error) {
+	return c.createAgentPolicy(name, namespace, description, "")
+}
+
+// CreateAgentPolicyWithSystemMonitoring creates an agent policy with a name, which must be unique,
+// in a namespace, adding the system integration to it, as in the default policy
+func (c *Client) CreateAgentPolicyWithSystemMonitoring(name string, namespace string, description string) (Policy, error) {
+	return c.createAgentPolicy(name, namespace, description, "sys_monitoring=true")
+}
+
+// createAgentPolicy creates an agent policy, with a querystring to set the integrations added to it
+func (c *Client) createAgentPolicy(name string, namespace string, description string, query string) (Policy, error) {
+	payload := map[string]string{
+		"description": description,
+		"name":        name,
+		"namespace":   namespace,
+	}
+
+	response := struct {
+		Item Policy `json:"item"`
+	}{}
+
+	err := c.do(http.MethodPost, fleetAgentPoliciesURL, query, payload, &response)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"name":     name,
+		"policyID": response.Item.ID,
+	}).Debug("Fleet policy created")
+
+	return response.Item, nil
+}
+
+// CreateServiceToken creates a service token for a Fleet Server, which is only returned once
+func (c *Client) CreateServiceToken() (ServiceToken, error) {
+	token := ServiceToken{}
+
+	err := c.post(fleetServiceTokensURL, nil, &token)
+	if err != nil {
+		return ServiceToken{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"name": token.Name,
+	}).Debug("Fleet Server service token created")
+
+	return token, nil
+}
+
+// DeleteAgentPolicy deletes an agent policy, which fails if there are active agents in it
+func (c *Client) DeleteAgentPolicy(id string) error {
+	payload := map[string]string{
+		"agentPolicyId": id,
+	}
+
+	err := c.post(fleetAgentPoliciesDeleteURL, payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"policyID": id,
+	}).Debug("Fleet policy deleted")
+
+	return nil
+}
+
+// GetAgent returns an agent by its ID
+func (c *Client) GetAgent(id string) (Agent, error) {
+	response := struct {
+		Item Agent `json:"item"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetAgentURL, id), "", &response)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	return response.Item, nil
+}
+
+// GetAgentVersion returns the version of an agent by its ID, as reported by the agent, with the
+// -SNAPSHOT suffix for the snapshots
+func (c *Client) GetAgentVersion(id string) (string, error) {
+	agent, err := c.GetAgent(id)
+	if err != nil {
+		return "", err
+	}
+
+	return agent.Version(), nil
+}
+
+// GetAgentByHostname returns the agent of a hostname, failing with ErrNotFound if there is no
+// active agent for it
+func (c *Client) GetAgentByHostname(hostname string) (Agent, error) {
+	agents, err := c.ListAgents(AgentsQuery{Kuery: AgentsByHostname(hostname)})
+	if err != nil {
+		return Agent{}, err
+	}
+
+	for _, agent := range agents {
+		if agent.Hostname() == hostname {
+			return agent, nil
+		}
+	}
+
+	return Agent{}, fmt.Errorf("the agent of the %s hostname: %w", hostname, ErrNotFound)
+}
+
+// GetAgentPolicy returns a policy by its ID, including its package policies
+func (c *Client) GetAgentPolicy(id string) (Policy, error) {
+	response := struct {
+		Item Policy `json:"item"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetAgentPolicyURL, id), "", &response)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	return response.Item, nil
+}
+
+// GetAgentPolicyByName returns a policy by its name, failing with ErrNotFound if there is none
+func (c *Client) GetAgentPolicyByName(name string) (Policy, error) {
+	policies, err := c.ListAgentPolicies()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	for _, policy := range policies {
+		if policy.Name == name {
+			return policy, nil
+		}
+	}
+
+	return Policy{}, fmt.Errorf("the %s policy: %w", name, ErrNotFound)
+}
+
+// GetDefaultAgentPolicy returns the default policy, failing with ErrNotFound if there is none
+func (c *Client) GetDefaultAgentPolicy() (Policy, error) {
+	policies, err := c.ListAgentPolicies()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	for _, policy := range policies {
+		if policy.IsDefault {
+			return policy, nil
+		}
+	}
+
+	return Policy{}, fmt.Errorf("the default policy: %w", ErrNotFound)
+}
+
+// GetDefaultFleetServerPolicy returns the default policy of the Fleet Servers, which is created by
+// the setup of Fleet, failing with ErrNotFound if there is none
+func (c *Client) GetDefaultFleetServerPolicy() (Policy, error) {
+	policies, err := c.ListAgentPolicies()
+	if err != nil {
+		return Policy{}, err
+	}
+
+	for _, policy := range policies {
+		if policy.IsDefaultFleetServer {
+			return policy, nil
+		}
+	}
+
+	return Policy{}, fmt.Errorf("the default Fleet Server policy: %w", ErrNotFound)
+}
+
+// GetDefaultOutput returns the default output of Fleet, used by the policies without an output
+func (c *Client) GetDefaultOutput() (Output, error) {
+	outputs, err := c.ListOutputs()
+	if err != nil {
+		return Output{}, err
+	}
+
+	for _, output := range outputs {
+		if output.IsDefault {
+			return output, nil
+		}
+	}
+
+	return Output{}, fmt.Errorf("the default output: %w", ErrNotFound)
+}
+
+// GetFleetSetup returns the status of the setup of Fleet
+func (c *Client) GetFleetSetup() (FleetSetup, error) {
+	setup := FleetSetup{}
+
+	err := c.get(fleetSetupURL, "", &setup)
+	if err != nil {
+		return FleetSetup{}, err
+	}
+
+	return setup, nil
+}
+
+// ListAgentEvents returns the last events reported by an agent
+func (c *Client) ListAgentEvents(agentID string) ([]AgentEvent, error) {
+	response := struct {
+		List []AgentEvent `json:"list"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetAgentEventsURL, agentID), "page=1&perPage=20", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.List, nil
+}
+
+// ListAgentPolicies returns the agent policies, which are not paginated, as there could be
+// more than a page of them when each scenario creates its own policy
+func (c *Client) ListAgentPolicies() ([]Policy, error) {
+	response := struct {
+		Items []Policy `json:"items"`
+	}{}
+
+	err := c.get(fleetAgentPoliciesURL, "perPage=1000", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.Items),
+	}).Trace("Fleet policies retrieved")
+
+	return response.Items, nil
+}
+
+// CountAgents returns the number of agents enrolled in Fleet matching a query, in all its pages
+func (c *Client) CountAgents(query AgentsQuery) (int, error) {
+	query.Page = 1
+	query.PerPage = 1
+
+	response := struct {
+		Total int `json:"total"`
+	}{}
+
+	err := c.get(fleetAgentsURL, query.querystring(), &response)
+	if err != nil {
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{
+		"kuery": query.Kuery,
+		"total": response.Total,
+	}).Trace("Fleet agents counted")
+
+	return response.Total, nil
+}
+
+// ListAgents returns a page of the agents enrolled in Fleet, filtered by a query
+func (c *Client) ListAgents(query AgentsQuery) ([]Agent, error) {
+	response := struct {
+		List []Agent `json:"list"`
+	}{}
+
+	err := c.get(fleetAgentsURL, query.querystring(), &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.List),
+		"kuery": query.Kuery,
+	}).Trace("Fleet agents retrieved")
+
+	return response.List, nil
+}
+
+// ListDataStreams returns the data streams listed by Fleet, which are none until an agent ships
+// data
+func (c *Client) ListDataStreams() ([]DataStream, error) {
+	response := struct {
+		DataStreams []DataStream `json:"data_streams"`
+	}{}
+
+	err := c.get(fleetDataStreamsURL, "", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.DataStreams),
+	}).Debug("Data Streams retrieved")
+
+	return response.DataStreams, nil
+}
+
+// ListOutputs returns the outputs of Fleet
+func (c *Client) ListOutputs() ([]Output, error) {
+	response := struct {
+		Items []Output `json:"items"`
+	}{}
+
+	err := c.get(fleetOutputsURL, "", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Items, nil
+}
+
+// ReassignAgent assigns an agent to another policy, which the agent runs once it acknowledges it
+func (c *Client) ReassignAgent(id string, policyID string) error {
+	payload := map[string]string{
+		"policy_id": policyID,
+	}
+
+	err := c.put(fmt.Sprintf(fleetAgentReassignURL, id), payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"agentID":  id,
+		"policyID": policyID,
+	}).Debug("Fleet agent was reassigned")
+
+	return nil
+}
+
+// SetupFleet sends a request to Fleet forcing the recreation of its setup
+func (c *Client) SetupFleet() error {
+	payload := map[string]bool{
+		"forceRecreate": true,
+	}
+
+	return c.post(fleetSetupURL, payload, nil)
+}
+
+// UnenrollAgent unenrolls an agent. A graceful unenrollment waits for the agent to acknowledge
+// it, so that the agent is listed as unenrolling until then, while a forced one revokes its API
+// keys right away, so that the agent is listed as inactive
+func (c *Client) UnenrollAgent(id string, force bool) error {
+	var payload interface{}
+	if force {
+		payload = map[string]bool{
+			"force": true,
+		}
+	}
+
+	err := c.post(fmt.Sprintf(fleetAgentUnenrollURL, id), payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"agentID": id,
+		"force":   force,
+	}).Debug("Fleet agent was unenrolled")
+
+	return nil
+}
+
+// UpdateFleetServerHosts sets the URLs of the Fleet Servers in the settings of Fleet, which are
+// sent to the agents enrolled into them
+func (c *Client) UpdateFleetServerHosts(hosts []string) error {
+	payload := map[string][]string{
+		"fleet_server_hosts": hosts,
+	}
+
+	err := c.put(fleetSettingsURL, payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"hosts": hosts,
+	}).Debug("Fleet Server hosts updated")
+
+	return nil
+}
+
+// UpdateOutputHosts sets the hosts of an output of Fleet, which are sent to the agents in the
+// policies using it
+func (c *Client) UpdateOutputHosts(id string, hosts []string) error {
+	payload := map[string][]string{
+		"hosts": hosts,
+	}
+
+	err := c.put(fmt.Sprintf(fleetOutputURL, id), payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"hosts":    hosts,
+		"outputID": id,
+	}).Debug("Fleet output hosts updated")
+
+	return nil
+}
+
+// UpgradeAgent triggers the upgrade action of an agent, which is acknowledged by the agent once
+// it's running the new version
+func (c *Client) UpgradeAgent(id string, upgrade AgentUpgrade) error {
+	err := c.post(fmt.Sprintf(fleetAgentUpgradeURL, id), upgrade, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"agentID":   id,
+		"sourceURI": upgrade.SourceURI,
+		"version":   upgrade.Version,
+	}).Debug("Fleet agent upgrade was triggered")
+
+	return nil
+}
@@ -0,0 +1,400 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const fleetPackagesURL = "/api/fleet/epm/packages"
+const fleetPackageURL = fleetPackagesURL + "/%s-%s"
+const fleetPackagePoliciesURL = "/api/fleet/package_policies"
+const fleetPackagePolicyURL = fleetPackagePoliciesURL + "/%s"
+const fleetPackagePoliciesDeleteURL = fleetPackagePoliciesURL + "/delete"
+
+// AssetTypeDashboard the type of the dashboards of an integration, installed in Kibana
+const AssetTypeDashboard = "dashboard"
+
+// AssetTypeIndexTemplate the type of the index templates of an integration, installed in Elasticsearch
+const AssetTypeIndexTemplate = "index_template"
+
+// AssetTypeIngestPipeline the type of the ingest pipelines of an integration, installed in Elasticsearch
+const AssetTypeIngestPipeline = "ingest_pipeline"
+
+// Asset an asset of an integration installed in Kibana or Elasticsearch, i.e. a dashboard
+type Asset struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Package an integration in the Package Registry
+type Package struct {
+	LatestVersion string `json:"latestVersion"` // only set when the package is get by its version
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+	Title         string `json:"title"`
+	Version       string `json:"version"`
+}
+
+// PackageManifest the manifest of an integration in a version, with the inputs of its policy
+// templates, the streams of its data streams, and the vars of all of them
+type PackageManifest struct {
+	DataStreams     []PackageDataStream     `json:"data_streams"`
+	Name            string                  `json:"name"`
+	PolicyTemplates []PackagePolicyTemplate `json:"policy_templates"`
+	Title           string                  `json:"title"`
+	Vars            []PackageVar            `json:"vars"` // the vars of the package, shared by its inputs
+	Version         string                  `json:"version"`
+}
+
+// PackagePolicyTemplate a policy template of an integration, i.e. the system template of the System
+// integration, with the inputs it configures
+type PackagePolicyTemplate struct {
+	DataStreams []string       `json:"data_streams"` // the datasets of the data streams of the template, all of them if empty
+	Inputs      []PackageInput `json:"inputs"`
+	Name        string         `json:"name"`
+	Title       string         `json:"title"`
+}
+
+// PackageInput an input of a policy template, i.e. logfile
+type PackageInput struct {
+	Title string       `json:"title"`
+	Type  string       `json:"type"`
+	Vars  []PackageVar `json:"vars"`
+}
+
+// PackageDataStream a data stream of an integration, with the streams reading its data from the
+// inputs of the policy templates
+type PackageDataStream struct {
+	Dataset string          `json:"dataset"` // i.e. system.auth
+	Streams []PackageStream `json:"streams"`
+	Type    string          `json:"type"` // logs or metrics
+}
+
+// PackageStream a stream of a data stream, read from an input
+type PackageStream struct {
+	Enabled *bool        `json:"enabled"` // enabled by default if it's not set
+	Input   string       `json:"input"`   // the type of the input, i.e. logfile
+	Title   string       `json:"title"`
+	Vars    []PackageVar `json:"vars"`
+}
+
+// PackageVar a var of an integration, of an input or of a stream, with its default value
+type PackageVar struct {
+	Default  interface{} `json:"default"`
+	Multi    bool        `json:"multi"` // the value is a list
+	Name     string      `json:"name"`
+	Required bool        `json:"required"`
+	Type     string      `json:"type"` // i.e. text, integer, bool or yaml
+}
+
+// PackageInfo the integration of a package policy
+type PackageInfo struct {
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PackagePolicy an integration added to a policy
+type PackagePolicy struct {
+	Description string                              `json:"description"`
+	Enabled     bool                                `json:"enabled"`
+	ID          string                              `json:"id"`
+	Inputs      []PackagePolicyInput                `json:"inputs"`
+	Name        string                              `json:"name"`
+	Namespace   string                              `json:"namespace"`
+	OutputID    string                              `json:"output_id"`
+	Package     PackageInfo                         `json:"package"`
+	PolicyID    string                              `json:"policy_id"`
+	Revision    int                                 `json:"revision"`
+	UpdatedAt   string                              `json:"updated_at"`     // kept as reported, to be compared with the events of the agents
+	Vars        map[string]PackagePolicyConfigValue `json:"vars,omitempty"` // the vars of the package, shared by its inputs
+}
+
+// PackagePolicyInput an input of a package policy, whose streams are kept as they are, as they
+// are only sent back to Fleet when the package policy is updated
+type PackagePolicyInput struct {
+	Config         map[string]PackagePolicyConfigValue `json:"config,omitempty"`
+	Enabled        bool                                `json:"enabled"`
+	PolicyTemplate string                              `json:"policy_template,omitempty"`
+	Streams        []json.RawMessage                   `json:"streams"`
+	Type           string                              `json:"type"`
+	Vars           map[string]PackagePolicyConfigValue `json:"vars,omitempty"`
+}
+
+// PackagePolicyConfigValue a value of the config of an input, which depends on the integration
+type PackagePolicyConfigValue struct {
+	Type  string      `json:"type,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// packagePolicyRequest the fields of a package policy which can be set when it's created or
+// updated, as the API rejects the ones set by Fleet, such as the ID or the revision
+type packagePolicyRequest struct {
+	Description string                              `json:"description"`
+	Enabled     bool                                `json:"enabled"`
+	Inputs      []PackagePolicyInput                `json:"inputs"`
+	Name        string                              `json:"name"`
+	Namespace   string                              `json:"namespace"`
+	OutputID    string                              `json:"output_id"`
+	Package     PackageInfo                         `json:"package"`
+	PolicyID    string                              `json:"policy_id"`
+	Vars        map[string]PackagePolicyConfigValue `json:"vars,omitempty"`
+}
+
+// UnmarshalJSON decodes a package policy, which is only its ID when the policies are listed
+func (p *PackagePolicy) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		*p = PackagePolicy{ID: id}
+		return nil
+	}
+
+	// an alias of the type, so that it's decoded without calling this method again
+	type packagePolicy PackagePolicy
+
+	var policy packagePolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+
+	*p = PackagePolicy(policy)
+
+	return nil
+}
+
+// request returns the fields of the package policy which can be sent to the API
+func (p PackagePolicy) request() packagePolicyRequest {
+	inputs := p.Inputs
+	if inputs == nil {
+		inputs = []PackagePolicyInput{}
+	}
+
+	return packagePolicyRequest{
+		Description: p.Description,
+		Enabled:     p.Enabled,
+		Inputs:      inputs,
+		Name:        p.Name,
+		Namespace:   p.Namespace,
+		OutputID:    p.OutputID,
+		Package:     p.Package,
+		PolicyID:    p.PolicyID,
+		Vars:        p.Vars,
+	}
+}
+
+// AddPackagePolicy adds an integration to a policy, returning the package policy created by Fleet
+func (c *Client) AddPackagePolicy(packagePolicy PackagePolicy) (PackagePolicy, error) {
+	response := struct {
+		Item PackagePolicy `json:"item"`
+	}{}
+
+	err := c.post(fleetPackagePoliciesURL, packagePolicy.request(), &response)
+	if err != nil {
+		return PackagePolicy{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"integration":     response.Item.Package.Name,
+		"packagePolicyID": response.Item.ID,
+		"policyID":        response.Item.PolicyID,
+		"version":         response.Item.Package.Version,
+	}).Info("Integration added to the policy")
+
+	return response.Item, nil
+}
+
+// DeletePackagePolicy deletes an integration from the policy it was added to
+func (c *Client) DeletePackagePolicy(id string) error {
+	payload := map[string][]string{
+		"packagePolicyIds": {id},
+	}
+
+	err := c.post(fleetPackagePoliciesDeleteURL, payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"packagePolicyID": id,
+	}).Info("Integration deleted from the policy")
+
+	return nil
+}
+
+// GetPackage returns an integration in a version
+func (c *Client) GetPackage(name string, version string) (Package, error) {
+	response := struct {
+		Response Package `json:"response"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetPackageURL, name, version), "", &response)
+	if err != nil {
+		return Package{}, err
+	}
+
+	return response.Response, nil
+}
+
+// GetPackageManifest returns the manifest of an integration in a version, as served by the Package
+// Registry, with its policy templates, data streams and vars
+func (c *Client) GetPackageManifest(name string, version string) (PackageManifest, error) {
+	response := struct {
+		Response PackageManifest `json:"response"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetPackageURL, name, version), "", &response)
+	if err != nil {
+		return PackageManifest{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"dataStreams":     len(response.Response.DataStreams),
+		"name":            name,
+		"policyTemplates": len(response.Response.PolicyTemplates),
+		"version":         version,
+	}).Trace("Manifest of the integration retrieved")
+
+	return response.Response, nil
+}
+
+// GetInstalledAssets returns the assets of an integration installed in Kibana and in Elasticsearch,
+// as recorded by Fleet when it installed them. It fails with ErrNotFound if the integration is not
+// installed in the version
+func (c *Client) GetInstalledAssets(name string, version string) ([]Asset, error) {
+	response := struct {
+		Response struct {
+			SavedObject *struct {
+				Attributes struct {
+					InstalledES     []Asset `json:"installed_es"`
+					InstalledKibana []Asset `json:"installed_kibana"`
+				} `json:"attributes"`
+			} `json:"savedObject"`
+		} `json:"response"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetPackageURL, name, version), "", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	installation := response.Response.SavedObject
+	if installation == nil {
+		return nil, fmt.Errorf("the installation of the %s integration in version %s: %w", name, version, ErrNotFound)
+	}
+
+	assets := append([]Asset{}, installation.Attributes.InstalledKibana...)
+	return append(assets, installation.Attributes.InstalledES...), nil
+}
+
+// GetPackageByTitle returns the latest version of an integration, looked up by its title in the
+// Package Registry, i.e. "Endpoint Security", ignoring the case. It fails with ErrNotFound if
+// there is no integration with the title
+func (c *Client) GetPackageByTitle(title string) (Package, error) {
+	packages, err := c.ListPackages()
+	if err != nil {
+		return Package{}, err
+	}
+
+	for _, pkg := range packages {
+		if strings.EqualFold(pkg.Title, title) {
+			log.WithFields(log.Fields{
+				"name":    pkg.Name,
+				"title":   pkg.Title,
+				"version": pkg.Version,
+			}).Debug("Integration in latest version found")
+
+			return pkg, nil
+		}
+	}
+
+	return Package{}, fmt.Errorf("the %s integration: %w", title, ErrNotFound)
+}
+
+// GetPackagePolicyByTitle returns the package policy of an integration added to a policy, looked
+// up by the title of the integration. It fails with ErrNotFound if the integration was not added
+func (c *Client) GetPackagePolicyByTitle(policyID string, title string) (PackagePolicy, error) {
+	policy, err := c.GetAgentPolicy(policyID)
+	if err != nil {
+		return PackagePolicy{}, err
+	}
+
+	for _, packagePolicy := range policy.PackagePolicies {
+		if packagePolicy.Package.Title == title {
+			log.WithFields(log.Fields{
+				"packagePolicyID": packagePolicy.ID,
+				"policyID":        policyID,
+				"title":           title,
+			}).Debug("Package policy found in the policy")
+
+			return packagePolicy, nil
+		}
+	}
+
+	return PackagePolicy{}, fmt.Errorf("the %s package policy in the %s policy: %w", title, policyID, ErrNotFound)
+}
+
+// InstallPackage installs the assets of an integration in a version, returning them
+func (c *Client) InstallPackage(name string, version string) ([]Asset, error) {
+	response := struct {
+		Response []Asset `json:"response"`
+	}{}
+
+	err := c.post(fmt.Sprintf(fleetPackageURL, name, version), nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"assets":      len(response.Response),
+		"integration": name,
+		"version":     version,
+	}).Info("Assets for the integration where installed")
+
+	return response.Response, nil
+}
+
+// ListPackages returns the latest version of the integrations in the Package Registry, including
+// the experimental ones
+func (c *Client) ListPackages() ([]Package, error) {
+	response := struct {
+		Response []Package `json:"response"`
+	}{}
+
+	err := c.get(fleetPackagesURL, "experimental=true&category=", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.Response),
+	}).Trace("Integrations retrieved")
+
+	return response.Response, nil
+}
+
+// UpdatePackagePolicy updates the settable fields of a package policy, returning the package
+// policy updated by Fleet
+func (c *Client) UpdatePackagePolicy(packagePolicy PackagePolicy) (PackagePolicy, error) {
+	response := struct {
+		Item PackagePolicy `json:"item"`
+	}{}
+
+	err := c.put(fmt.Sprintf(fleetPackagePolicyURL, packagePolicy.ID), packagePolicy.request(), &response)
+	if err != nil {
+		return PackagePolicy{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"packagePolicyID": packagePolicy.ID,
+		"updatedAt":       response.Item.UpdatedAt,
+	}).Debug("Configuration for the integration was updated")
+
+	return response.Item, nil
+}
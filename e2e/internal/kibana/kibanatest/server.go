@@ -0,0 +1,976 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package kibanatest provides a fake Kibana serving the endpoints of Fleet used by the test suites,
+// so that the logic orchestrating the agents, the policies and the integrations is unit tested
+// without running the containers of the stack. The server keeps the state of Fleet in memory, and
+// its responses can be replaced for an endpoint, i.e. to fail with a transient error
+package kibanatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+)
+
+// DefaultPolicyID the ID of the default policy of the server
+const DefaultPolicyID = "default-policy"
+
+// DefaultFleetServerPolicyID the ID of the default policy of the Fleet Servers of the server
+const DefaultFleetServerPolicyID = "default-fleet-server-policy"
+
+// DefaultOutputID the ID of the default output of the server
+const DefaultOutputID = "fleet-default-output"
+
+// DefaultVersion the version of Kibana of the server, unless it's set
+const DefaultVersion = "8.0.0"
+
+// Request a request received by the server
+type Request struct {
+	Body   string
+	Method string
+	Path   string
+	Query  string
+}
+
+// Server a fake Kibana, keeping the agents, the policies, the enrollment tokens, the integrations
+// and the package policies of Fleet in memory. It starts with a default policy, a default policy
+// of the Fleet Servers and a default output
+type Server struct {
+	URL string // the base URL of the server, i.e. http://127.0.0.1:51234
+
+	agents           map[string]*kibana.Agent
+	dataStreams      []kibana.DataStream
+	enrollmentKeys   map[string]*kibana.EnrollmentAPIKey
+	fleetServerHosts []string
+	handlers         map[string]http.HandlerFunc // the handlers replacing the responses, by method and path
+	installed        map[string]bool             // the installed integrations, by name and version
+	mutex            sync.Mutex
+	nextID           int
+	outputs          map[string]*kibana.Output
+	packagePolicies  map[string]*kibana.PackagePolicy
+	packages         []Package
+	policies         map[string]*kibana.Policy
+	requests         []Request
+	server           *httptest.Server
+	version          string // the version of Kibana, which selects the routes of the versioned APIs
+}
+
+// Package an integration served by the Package Registry of the server, with the assets installed
+// with it
+type Package struct {
+	Assets   []kibana.Asset
+	Manifest kibana.PackageManifest
+}
+
+// NewServer starts a fake Kibana, which must be closed once the test finishes
+func NewServer() *Server {
+	s := &Server{
+		agents:          map[string]*kibana.Agent{},
+		enrollmentKeys:  map[string]*kibana.EnrollmentAPIKey{},
+		handlers:        map[string]http.HandlerFunc{},
+		installed:       map[string]bool{},
+		outputs:         map[string]*kibana.Output{},
+		packagePolicies: map[string]*kibana.PackagePolicy{},
+		packages:        []Package{},
+		policies:        map[string]*kibana.Policy{},
+		requests:        []Request{},
+		version:         DefaultVersion,
+	}
+
+	s.policies[DefaultPolicyID] = &kibana.Policy{ID: DefaultPolicyID, IsDefault: true, Name: "Default policy", Namespace: "default", Revision: 1}
+	s.policies[DefaultFleetServerPolicyID] = &kibana.Policy{ID: DefaultFleetServerPolicyID, IsDefaultFleetServer: true, Name: "Default Fleet Server policy", Namespace: "default", Revision: 1}
+	s.outputs[DefaultOutputID] = &kibana.Output{Hosts: []string{"http://elasticsearch:9200"}, ID: DefaultOutputID, IsDefault: true, Name: "default", Type: kibana.ElasticsearchOutputType}
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Client returns a client of the server, which does not retry the failed requests
+func (s *Server) Client() *kibana.Client {
+	noRetries := kibana.RetryPolicy{MaxAttempts: 1}
+
+	return kibana.NewClientWithBaseURL(s.URL).
+		WithRetryPolicy(kibana.MutatingEndpoints, noRetries).
+		WithRetryPolicy(kibana.ReadEndpoints, noRetries)
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetVersion sets the version of Kibana of the server, i.e. 7.16.0, which selects the routes of the
+// versioned APIs, as the enrollment tokens. It must be set before the client of the server detects it
+func (s *Server) SetVersion(version string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.version = version
+}
+
+// Handle replaces the responses of the server to the requests with a method to a path, i.e.
+// GET /api/fleet/agents, with a handler
+func (s *Server) Handle(method string, path string, handler http.HandlerFunc) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.handlers[method+" "+path] = handler
+}
+
+// Respond replaces the responses of the server to the requests with a method to a path with a
+// status code and a body
+func (s *Server) Respond(method string, path string, statusCode int, body string) {
+	s.Handle(method, path, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+// AddAgent enrolls an agent into Fleet, in the default policy if it has none, returning it with
+// its ID
+func (s *Server) AddAgent(agent kibana.Agent) kibana.Agent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if agent.ID == "" {
+		agent.ID = s.newID("agent")
+	}
+	if agent.PolicyID == "" {
+		agent.PolicyID = DefaultPolicyID
+	}
+	if agent.Status == "" {
+		agent.Status = "online"
+	}
+	agent.Active = agent.Status != "inactive"
+
+	s.agents[agent.ID] = &agent
+	return agent
+}
+
+// UpdateAgent changes an agent enrolled into Fleet, i.e. its status when it checks in, failing if
+// there is no such agent
+func (s *Server) UpdateAgent(id string, update func(agent *kibana.Agent)) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, exists := s.agents[id]
+	if !exists {
+		return fmt.Errorf("the %s agent: %w", id, kibana.ErrNotFound)
+	}
+
+	update(agent)
+	return nil
+}
+
+// Agent returns an agent enrolled into Fleet, and if it exists
+func (s *Server) Agent(id string) (kibana.Agent, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	agent, exists := s.agents[id]
+	if !exists {
+		return kibana.Agent{}, false
+	}
+
+	return *agent, true
+}
+
+// AddDataStream adds a data stream to the ones listed by Fleet
+func (s *Server) AddDataStream(dataStream kibana.DataStream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.dataStreams = append(s.dataStreams, dataStream)
+}
+
+// AddPackage adds an integration in a version to the Package Registry, with the assets installed
+// with it. The last version added of an integration is its latest one
+func (s *Server) AddPackage(manifest kibana.PackageManifest, assets ...kibana.Asset) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.packages = append(s.packages, Package{Assets: assets, Manifest: manifest})
+}
+
+// FleetServerHosts returns the URLs of the Fleet Servers set in the settings of Fleet
+func (s *Server) FleetServerHosts() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string{}, s.fleetServerHosts...)
+}
+
+// PackagePolicies returns the integrations added to a policy
+func (s *Server) PackagePolicies(policyID string) []kibana.PackagePolicy {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	packagePolicies := []kibana.PackagePolicy{}
+	for _, packagePolicy := range s.packagePolicies {
+		if packagePolicy.PolicyID == policyID {
+			packagePolicies = append(packagePolicies, *packagePolicy)
+		}
+	}
+
+	return packagePolicies
+}
+
+// Policy returns a policy, and if it exists
+func (s *Server) Policy(id string) (kibana.Policy, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	policy, exists := s.policies[id]
+	if !exists {
+		return kibana.Policy{}, false
+	}
+
+	return *policy, true
+}
+
+// Requests returns the requests received by the server, in order
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]Request{}, s.requests...)
+}
+
+// majorVersion returns the major version of Kibana of the server
+func (s *Server) majorVersion() int {
+	major, _ := strconv.Atoi(strings.SplitN(s.version, ".", 2)[0])
+	return major
+}
+
+// newID returns a new ID of a kind of resource, i.e. agent-1
+func (s *Server) newID(kind string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", kind, s.nextID)
+}
+
+// serveHTTP records a request, and serves it with the handler replacing its responses, if any, or
+// with the state of Fleet. The mutating requests must have the kbn-xsrf header, as in Kibana
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{Body: string(body), Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery})
+	handler, exists := s.handlers[r.Method+" "+r.URL.Path]
+	s.mutex.Unlock()
+
+	if exists {
+		handler(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Header.Get("kbn-xsrf") == "" {
+		writeError(w, http.StatusBadRequest, "Request must contain a kbn-xsrf header.")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statusCode, response := s.route(r.Method, r.URL.Path, r.URL.Query(), body)
+	if statusCode >= http.StatusBadRequest {
+		writeError(w, statusCode, fmt.Sprintf("%v", response))
+		return
+	}
+
+	writeJSON(w, statusCode, response)
+}
+
+// route serves a request with the state of Fleet, returning the status code and the response
+func (s *Server) route(method string, path string, query map[string][]string, body []byte) (int, interface{}) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case path == "/api/status":
+		return http.StatusOK, map[string]interface{}{
+			"status":  map[string]interface{}{"overall": map[string]string{"level": "available"}},
+			"version": map[string]string{"number": s.version},
+		}
+	case path == "/api/fleet/agents/setup":
+		return http.StatusOK, map[string]interface{}{"isReady": true, "missing_requirements": []string{}}
+	case path == "/api/fleet/agents":
+		return s.listAgents(query)
+	case strings.HasPrefix(path, "/api/fleet/agents/"):
+		return s.routeAgent(method, segments[3:], body)
+	case path == "/api/fleet/agent_policies" && method == http.MethodPost:
+		return s.createPolicy(query, body)
+	case path == "/api/fleet/agent_policies":
+		return s.listPolicies()
+	case path == "/api/fleet/agent_policies/delete":
+		return s.deletePolicy(body)
+	case strings.HasPrefix(path, "/api/fleet/agent_policies/") && method == http.MethodPut:
+		return s.updatePolicy(segments[3], body)
+	case strings.HasPrefix(path, "/api/fleet/agent_policies/"):
+		return s.getPolicy(segments[3])
+	case path == "/api/fleet/data_streams":
+		return http.StatusOK, map[string]interface{}{"data_streams": append([]kibana.DataStream{}, s.dataStreams...)}
+	case path == "/api/fleet/enrollment_api_keys" && s.majorVersion() < 8:
+		return http.StatusNotFound, fmt.Sprintf("Not Found: %s", path)
+	case (path == "/api/fleet/enrollment-api-keys" || path == "/api/fleet/enrollment_api_keys") && method == http.MethodPost:
+		return s.createEnrollmentKey(body)
+	case path == "/api/fleet/enrollment-api-keys" || path == "/api/fleet/enrollment_api_keys":
+		return s.listEnrollmentKeys()
+	case strings.HasPrefix(path, "/api/fleet/enrollment_api_keys/") && s.majorVersion() < 8:
+		return http.StatusNotFound, fmt.Sprintf("Not Found: %s", path)
+	case strings.HasPrefix(path, "/api/fleet/enrollment-api-keys/") || strings.HasPrefix(path, "/api/fleet/enrollment_api_keys/"):
+		return s.routeEnrollmentKey(method, segments[3])
+	case path == "/api/fleet/outputs" && method == http.MethodPost:
+		return s.createOutput(body)
+	case path == "/api/fleet/outputs":
+		return s.listOutputs()
+	case strings.HasPrefix(path, "/api/fleet/outputs/") && method == http.MethodDelete:
+		return s.deleteOutput(segments[3])
+	case strings.HasPrefix(path, "/api/fleet/outputs/"):
+		return s.updateOutput(segments[3], body)
+	case path == "/api/fleet/service-tokens":
+		return http.StatusOK, kibana.ServiceToken{Name: s.newID("token"), Value: "fake-service-token"}
+	case path == "/api/fleet/settings":
+		return s.updateSettings(body)
+	case path == "/api/fleet/epm/packages":
+		return s.listPackages()
+	case strings.HasPrefix(path, "/api/fleet/epm/packages/"):
+		return s.routePackage(method, segments[4])
+	case path == "/api/fleet/package_policies" && method == http.MethodPost:
+		return s.savePackagePolicy("", body)
+	case path == "/api/fleet/package_policies/delete":
+		return s.deletePackagePolicies(body)
+	case strings.HasPrefix(path, "/api/fleet/package_policies/") && method == http.MethodPut:
+		return s.savePackagePolicy(segments[3], body)
+	}
+
+	return http.StatusNotFound, "Not Found"
+}
+
+// kueryClausePattern matches the clauses of the KQL queries of the agents, i.e. policy_id:"abc" or
+// local_metadata.elastic.agent.snapshot:true
+var kueryClausePattern = regexp.MustCompile(`([\w.]+):(?:"((?:[^"\\]|\\.)*)"|(\w+))`)
+
+// defaultAgentsPerPage the number of agents listed in a page when it's not requested, as in Kibana
+const defaultAgentsPerPage = 20
+
+// listAgents returns a page of the active agents matching the KQL query, which only supports the
+// clauses of the fields the suites filter by joined with "and", and the inactive ones if they are
+// requested. The agents are sorted by their ID, so that the pages do not overlap
+func (s *Server) listAgents(query map[string][]string) (int, interface{}) {
+	kuery := first(query["kuery"])
+	showInactive := first(query["showInactive"]) == "true"
+	showUpgradeable := first(query["showUpgradeable"]) == "true"
+
+	agents := []kibana.Agent{}
+	for _, agent := range s.agents {
+		if !agent.Active && !showInactive {
+			continue
+		}
+		if showUpgradeable && !agent.LocalMetadata.Elastic.Agent.Upgradeable {
+			continue
+		}
+		if !matchesKuery(*agent, kuery) {
+			continue
+		}
+
+		agents = append(agents, *agent)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	page, err := strconv.Atoi(first(query["page"]))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(first(query["perPage"]))
+	if err != nil || perPage < 1 {
+		perPage = defaultAgentsPerPage
+	}
+
+	total := len(agents)
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+
+	return http.StatusOK, map[string]interface{}{"list": agents[start:end], "page": page, "perPage": perPage, "total": total}
+}
+
+// matchesKuery reports if an agent matches all the clauses of a KQL query
+func matchesKuery(agent kibana.Agent, kuery string) bool {
+	for _, clause := range kueryClausePattern.FindAllStringSubmatch(kuery, -1) {
+		value := clause[3]
+		if clause[3] == "" {
+			value = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(clause[2])
+		}
+
+		values := []string{}
+		switch clause[1] {
+		case "local_metadata.elastic.agent.snapshot":
+			values = append(values, fmt.Sprintf("%t", agent.LocalMetadata.Elastic.Agent.Snapshot))
+		case "local_metadata.elastic.agent.version":
+			values = append(values, agent.LocalMetadata.Elastic.Agent.Version)
+		case "local_metadata.host.hostname":
+			values = append(values, agent.Hostname())
+		case "policy_id":
+			values = append(values, agent.PolicyID)
+		case "status":
+			values = append(values, agent.Status)
+		case "tags":
+			values = append(values, agent.Tags...)
+		}
+
+		if !contains(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// routeAgent serves the requests to an agent: getting it, its events, and reassigning,
+// unenrolling and upgrading it
+func (s *Server) routeAgent(method string, segments []string, body []byte) (int, interface{}) {
+	agent, exists := s.agents[segments[0]]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Agent %s not found", segments[0])
+	}
+
+	action := ""
+	if len(segments) > 1 {
+		action = segments[1]
+	}
+
+	switch action {
+	case "":
+		return http.StatusOK, map[string]interface{}{"item": agent}
+	case "events":
+		return http.StatusOK, map[string]interface{}{"list": []kibana.AgentEvent{}, "total": 0}
+	case "reassign":
+		payload := struct {
+			PolicyID string `json:"policy_id"`
+		}{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if _, exists := s.policies[payload.PolicyID]; !exists {
+			return http.StatusNotFound, fmt.Sprintf("Agent policy %s not found", payload.PolicyID)
+		}
+
+		agent.PolicyID = payload.PolicyID
+		agent.PolicyRevision = 0
+		return http.StatusOK, map[string]interface{}{}
+	case "unenroll":
+		payload := struct {
+			Force bool `json:"force"`
+		}{}
+		_ = json.Unmarshal(body, &payload)
+
+		agent.Status = "unenrolling"
+		if payload.Force {
+			agent.Active = false
+			agent.Status = "inactive"
+		}
+		return http.StatusOK, map[string]interface{}{}
+	case "upgrade":
+		upgrade := kibana.AgentUpgrade{}
+		if err := json.Unmarshal(body, &upgrade); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		agent.LocalMetadata.Elastic.Agent.Snapshot = strings.HasSuffix(upgrade.Version, "-SNAPSHOT")
+		agent.LocalMetadata.Elastic.Agent.Version = strings.TrimSuffix(upgrade.Version, "-SNAPSHOT")
+		agent.Status = "updating"
+		return http.StatusOK, map[string]interface{}{}
+	}
+
+	return http.StatusNotFound, "Not Found"
+}
+
+// createPolicy creates an agent policy, which must have a unique name, adding the System
+// integration to it if the system monitoring is requested
+func (s *Server) createPolicy(query map[string][]string, body []byte) (int, interface{}) {
+	policy := kibana.Policy{}
+	if err := json.Unmarshal(body, &policy); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	for _, existing := range s.policies {
+		if existing.Name == policy.Name {
+			return http.StatusConflict, fmt.Sprintf("Agent policy '%s' already exists", policy.Name)
+		}
+	}
+
+	policy.ID = s.newID("policy")
+	policy.Revision = 1
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	s.policies[policy.ID] = &policy
+
+	if first(query["sys_monitoring"]) == "true" {
+		s.addPackagePolicy(kibana.PackagePolicy{
+			Enabled:   true,
+			Inputs:    []kibana.PackagePolicyInput{},
+			Name:      "system-1",
+			Namespace: policy.Namespace,
+			Package:   kibana.PackageInfo{Name: "system", Title: "System"},
+			PolicyID:  policy.ID,
+		})
+	}
+
+	return http.StatusOK, map[string]interface{}{"item": s.policyWithPackagePolicies(policy.ID)}
+}
+
+// updatePolicy changes the name, the namespace, the description and the outputs of an agent policy,
+// bumping its revision, which fails if the outputs do not exist
+func (s *Server) updatePolicy(id string, body []byte) (int, interface{}) {
+	policy, exists := s.policies[id]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Agent policy %s not found", id)
+	}
+
+	update := kibana.Policy{}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	for _, outputID := range []string{update.DataOutputID, update.MonitoringOutputID} {
+		if _, exists := s.outputs[outputID]; outputID != "" && !exists {
+			return http.StatusBadRequest, fmt.Sprintf("Output %s not found", outputID)
+		}
+	}
+
+	policy.DataOutputID = update.DataOutputID
+	policy.Description = update.Description
+	policy.MonitoringOutputID = update.MonitoringOutputID
+	policy.Name = update.Name
+	policy.Namespace = update.Namespace
+	policy.Revision++
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	return http.StatusOK, map[string]interface{}{"item": s.policyWithPackagePolicies(id)}
+}
+
+// listPolicies returns the agent policies, with the IDs of their package policies, as Fleet does
+func (s *Server) listPolicies() (int, interface{}) {
+	items := []map[string]interface{}{}
+
+	for id, policy := range s.policies {
+		packagePolicyIDs := []string{}
+		for _, packagePolicy := range s.packagePolicies {
+			if packagePolicy.PolicyID == id {
+				packagePolicyIDs = append(packagePolicyIDs, packagePolicy.ID)
+			}
+		}
+
+		item := map[string]interface{}{}
+		bytes, _ := json.Marshal(policy)
+		_ = json.Unmarshal(bytes, &item)
+		item["package_policies"] = packagePolicyIDs
+
+		items = append(items, item)
+	}
+
+	return http.StatusOK, map[string]interface{}{"items": items, "total": len(items)}
+}
+
+// getPolicy returns an agent policy, with its package policies
+func (s *Server) getPolicy(id string) (int, interface{}) {
+	if _, exists := s.policies[id]; !exists {
+		return http.StatusNotFound, fmt.Sprintf("Agent policy %s not found", id)
+	}
+
+	return http.StatusOK, map[string]interface{}{"item": s.policyWithPackagePolicies(id)}
+}
+
+// policyWithPackagePolicies returns an agent policy with its package policies
+func (s *Server) policyWithPackagePolicies(id string) kibana.Policy {
+	policy := *s.policies[id]
+
+	policy.PackagePolicies = []kibana.PackagePolicy{}
+	for _, packagePolicy := range s.packagePolicies {
+		if packagePolicy.PolicyID == id {
+			policy.PackagePolicies = append(policy.PackagePolicies, *packagePolicy)
+		}
+	}
+
+	return policy
+}
+
+// deletePolicy deletes an agent policy, which fails if there are active agents in it
+func (s *Server) deletePolicy(body []byte) (int, interface{}) {
+	payload := struct {
+		AgentPolicyID string `json:"agentPolicyId"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if _, exists := s.policies[payload.AgentPolicyID]; !exists {
+		return http.StatusNotFound, fmt.Sprintf("Agent policy %s not found", payload.AgentPolicyID)
+	}
+
+	for _, agent := range s.agents {
+		if agent.Active && agent.PolicyID == payload.AgentPolicyID {
+			return http.StatusBadRequest, "Cannot delete agent policy that is assigned to any active agents"
+		}
+	}
+
+	delete(s.policies, payload.AgentPolicyID)
+	for id, packagePolicy := range s.packagePolicies {
+		if packagePolicy.PolicyID == payload.AgentPolicyID {
+			delete(s.packagePolicies, id)
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{"id": payload.AgentPolicyID}
+}
+
+// createEnrollmentKey creates an active enrollment token for an existing policy
+func (s *Server) createEnrollmentKey(body []byte) (int, interface{}) {
+	key := kibana.EnrollmentAPIKey{}
+	if err := json.Unmarshal(body, &key); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if _, exists := s.policies[key.PolicyID]; !exists {
+		return http.StatusBadRequest, fmt.Sprintf("Agent policy %s not found", key.PolicyID)
+	}
+
+	key.Active = true
+	key.ID = s.newID("enrollment-api-key")
+	key.APIKeyID = s.newID("api-key")
+	key.APIKey = "fake-" + key.APIKeyID
+	s.enrollmentKeys[key.ID] = &key
+
+	return http.StatusOK, map[string]interface{}{"item": key}
+}
+
+// listEnrollmentKeys returns the enrollment tokens, active or revoked, in the items and in the list
+// since 8.0, and only in the list before it
+func (s *Server) listEnrollmentKeys() (int, interface{}) {
+	keys := []kibana.EnrollmentAPIKey{}
+	for _, key := range s.enrollmentKeys {
+		keys = append(keys, *key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	response := map[string]interface{}{"list": keys, "total": len(keys)}
+	if s.majorVersion() >= 8 {
+		response["items"] = keys
+	}
+
+	return http.StatusOK, response
+}
+
+// routeEnrollmentKey serves the requests to an enrollment token: getting it, and revoking it,
+// which keeps it listed as inactive
+func (s *Server) routeEnrollmentKey(method string, id string) (int, interface{}) {
+	key, exists := s.enrollmentKeys[id]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Enrollment API key %s not found", id)
+	}
+
+	if method == http.MethodDelete {
+		key.Active = false
+		return http.StatusOK, map[string]interface{}{"action": "deleted"}
+	}
+
+	return http.StatusOK, map[string]interface{}{"item": key}
+}
+
+// listOutputs returns the outputs of Fleet
+func (s *Server) listOutputs() (int, interface{}) {
+	items := []kibana.Output{}
+	for _, output := range s.outputs {
+		items = append(items, *output)
+	}
+
+	return http.StatusOK, map[string]interface{}{"items": items, "total": len(items)}
+}
+
+// createOutput creates an output of Fleet, which must be of the elasticsearch or logstash types
+func (s *Server) createOutput(body []byte) (int, interface{}) {
+	output := kibana.Output{}
+	if err := json.Unmarshal(body, &output); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if output.Type != kibana.ElasticsearchOutputType && output.Type != kibana.LogstashOutputType {
+		return http.StatusBadRequest, fmt.Sprintf("Output type %s is not supported", output.Type)
+	}
+
+	output.ID = s.newID("output")
+	output.IsDefault = false
+	s.outputs[output.ID] = &output
+
+	return http.StatusOK, map[string]interface{}{"item": output}
+}
+
+// deleteOutput deletes an output of Fleet, which fails for the default output, and for the ones
+// used by the agent policies
+func (s *Server) deleteOutput(id string) (int, interface{}) {
+	output, exists := s.outputs[id]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Output %s not found", id)
+	}
+
+	if output.IsDefault {
+		return http.StatusBadRequest, "Default output cannot be deleted"
+	}
+
+	for _, policy := range s.policies {
+		if policy.DataOutputID == id || policy.MonitoringOutputID == id {
+			return http.StatusBadRequest, fmt.Sprintf("Output %s is used by the agent policy %s", id, policy.ID)
+		}
+	}
+
+	delete(s.outputs, id)
+	return http.StatusOK, map[string]interface{}{"id": id}
+}
+
+// updateOutput sets the hosts of an output
+func (s *Server) updateOutput(id string, body []byte) (int, interface{}) {
+	output, exists := s.outputs[id]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Output %s not found", id)
+	}
+
+	payload := struct {
+		Hosts []string `json:"hosts"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	output.Hosts = payload.Hosts
+	return http.StatusOK, map[string]interface{}{"item": output}
+}
+
+// updateSettings sets the URLs of the Fleet Servers
+func (s *Server) updateSettings(body []byte) (int, interface{}) {
+	payload := struct {
+		FleetServerHosts []string `json:"fleet_server_hosts"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	s.fleetServerHosts = payload.FleetServerHosts
+	return http.StatusOK, map[string]interface{}{"item": payload}
+}
+
+// listPackages returns the latest version of the integrations of the Package Registry
+func (s *Server) listPackages() (int, interface{}) {
+	latest := map[string]kibana.Package{}
+	names := []string{}
+
+	for _, pkg := range s.packages {
+		if _, exists := latest[pkg.Manifest.Name]; !exists {
+			names = append(names, pkg.Manifest.Name)
+		}
+		latest[pkg.Manifest.Name] = s.packageInfo(pkg.Manifest)
+	}
+
+	packages := []kibana.Package{}
+	for _, name := range names {
+		packages = append(packages, latest[name])
+	}
+
+	return http.StatusOK, map[string]interface{}{"response": packages}
+}
+
+// routePackage serves the requests to an integration in a version, i.e. system-1.0.0: getting its
+// manifest, with its installation if it's installed, and installing its assets
+func (s *Server) routePackage(method string, nameVersion string) (int, interface{}) {
+	var pkg *Package
+	for i := range s.packages {
+		if s.packages[i].Manifest.Name+"-"+s.packages[i].Manifest.Version == nameVersion {
+			pkg = &s.packages[i]
+		}
+	}
+	if pkg == nil {
+		return http.StatusNotFound, fmt.Sprintf("Package %s not found", nameVersion)
+	}
+
+	if method == http.MethodPost {
+		s.installed[nameVersion] = true
+		return http.StatusOK, map[string]interface{}{"response": append([]kibana.Asset{}, pkg.Assets...)}
+	}
+
+	response := map[string]interface{}{}
+	bytes, _ := json.Marshal(pkg.Manifest)
+	_ = json.Unmarshal(bytes, &response)
+
+	info := s.packageInfo(pkg.Manifest)
+	response["latestVersion"] = info.LatestVersion
+	response["status"] = info.Status
+
+	if s.installed[nameVersion] {
+		kibanaAssets := []kibana.Asset{}
+		esAssets := []kibana.Asset{}
+		for _, asset := range pkg.Assets {
+			if asset.Type == kibana.AssetTypeIndexTemplate || asset.Type == kibana.AssetTypeIngestPipeline {
+				esAssets = append(esAssets, asset)
+			} else {
+				kibanaAssets = append(kibanaAssets, asset)
+			}
+		}
+
+		response["savedObject"] = map[string]interface{}{
+			"attributes": map[string]interface{}{
+				"installed_es":     esAssets,
+				"installed_kibana": kibanaAssets,
+			},
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{"response": response}
+}
+
+// packageInfo returns the integration of a manifest, with its latest version and its status
+func (s *Server) packageInfo(manifest kibana.PackageManifest) kibana.Package {
+	info := kibana.Package{
+		Name:    manifest.Name,
+		Status:  "not_installed",
+		Title:   manifest.Title,
+		Version: manifest.Version,
+	}
+
+	for _, pkg := range s.packages {
+		if pkg.Manifest.Name == manifest.Name {
+			info.LatestVersion = pkg.Manifest.Version
+		}
+	}
+
+	if s.installed[manifest.Name+"-"+manifest.Version] {
+		info.Status = "installed"
+	}
+
+	return info
+}
+
+// savePackagePolicy creates a package policy, or updates it if it has an ID, increasing the
+// revision of its policy
+func (s *Server) savePackagePolicy(id string, body []byte) (int, interface{}) {
+	packagePolicy := kibana.PackagePolicy{}
+	if err := json.Unmarshal(body, &packagePolicy); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if _, exists := s.policies[packagePolicy.PolicyID]; !exists {
+		return http.StatusBadRequest, fmt.Sprintf("Agent policy %s not found", packagePolicy.PolicyID)
+	}
+
+	if id == "" {
+		return http.StatusOK, map[string]interface{}{"item": s.addPackagePolicy(packagePolicy)}
+	}
+
+	existing, exists := s.packagePolicies[id]
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Package policy %s not found", id)
+	}
+
+	packagePolicy.ID = id
+	packagePolicy.Revision = existing.Revision + 1
+	packagePolicy.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	s.packagePolicies[id] = &packagePolicy
+	s.bumpPolicy(packagePolicy.PolicyID)
+
+	return http.StatusOK, map[string]interface{}{"item": packagePolicy}
+}
+
+// addPackagePolicy adds a package policy to its policy, increasing the revision of the policy
+func (s *Server) addPackagePolicy(packagePolicy kibana.PackagePolicy) kibana.PackagePolicy {
+	packagePolicy.ID = s.newID("package-policy")
+	packagePolicy.Revision = 1
+	packagePolicy.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	s.packagePolicies[packagePolicy.ID] = &packagePolicy
+	s.bumpPolicy(packagePolicy.PolicyID)
+
+	return packagePolicy
+}
+
+// deletePackagePolicies deletes some package policies, increasing the revision of their policies
+func (s *Server) deletePackagePolicies(body []byte) (int, interface{}) {
+	payload := struct {
+		PackagePolicyIDs []string `json:"packagePolicyIds"`
+	}{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	results := []map[string]interface{}{}
+	for _, id := range payload.PackagePolicyIDs {
+		packagePolicy, exists := s.packagePolicies[id]
+		if exists {
+			delete(s.packagePolicies, id)
+			s.bumpPolicy(packagePolicy.PolicyID)
+		}
+
+		results = append(results, map[string]interface{}{"id": id, "success": exists})
+	}
+
+	return http.StatusOK, results
+}
+
+// bumpPolicy increases the revision of a policy, as Fleet does when its integrations change
+func (s *Server) bumpPolicy(id string) {
+	if policy, exists := s.policies[id]; exists {
+		policy.Revision++
+		policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// contains reports if a value is in a list of values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// first returns the first value of a parameter of the querystring, empty if there is none
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// writeError writes an error response, with the body of the errors of Kibana
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"error":      http.StatusText(statusCode),
+		"message":    message,
+		"statusCode": statusCode,
+	})
+}
+
+// writeJSON writes a response with a status code and a body encoded as JSON
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,267 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibanatest
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/stretchr/testify/assert"
+)
+
+// requestedPaths returns the paths of the requests received by the server, in order
+func requestedPaths(s *Server) []string {
+	paths := []string{}
+	for _, request := range s.Requests() {
+		paths = append(paths, request.Path)
+	}
+
+	return paths
+}
+
+func TestListAgentsByKuery(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	online := kibana.Agent{Status: "online"}
+	online.LocalMetadata.Host.Hostname = "centos"
+	s.AddAgent(online)
+
+	offline := kibana.Agent{Status: "offline"}
+	offline.LocalMetadata.Host.Hostname = "debian"
+	s.AddAgent(offline)
+
+	agents, err := s.Client().ListAgents(kibana.AgentsQuery{
+		Kuery: kibana.KueryAnd(kibana.AgentsByPolicy(DefaultPolicyID), kibana.AgentsByStatus("offline")),
+	})
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(agents)) {
+		assert.Equal(t, "debian", agents[0].Hostname())
+	}
+}
+
+func TestUnenrolledAgentIsInactive(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	agent := kibana.Agent{}
+	agent.LocalMetadata.Host.Hostname = "centos"
+	agent = s.AddAgent(agent)
+
+	client := s.Client()
+	assert.Nil(t, client.UnenrollAgent(agent.ID, true))
+
+	_, err := client.GetAgentByHostname("centos")
+	assert.True(t, errors.Is(err, kibana.ErrNotFound), "%v", err)
+
+	count, err := client.CountAgents(kibana.AgentsQuery{ShowInactive: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestPackagePolicyBumpsPolicyRevision(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	client := s.Client()
+	policy, err := client.CreateAgentPolicy("test-policy", "default", "a policy")
+	assert.Nil(t, err)
+
+	packagePolicy, err := client.AddPackagePolicy(kibana.PackagePolicy{
+		Name:     "linux-1",
+		Package:  kibana.PackageInfo{Name: "linux", Title: "Linux", Version: "0.4.1"},
+		PolicyID: policy.ID,
+	})
+	assert.Nil(t, err)
+
+	policy, err = client.GetAgentPolicy(policy.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, policy.Revision)
+	if assert.Equal(t, 1, len(policy.PackagePolicies)) {
+		assert.Equal(t, packagePolicy.ID, policy.PackagePolicies[0].ID)
+	}
+
+	assert.Nil(t, client.DeletePackagePolicy(packagePolicy.ID))
+	assert.Empty(t, s.PackagePolicies(policy.ID))
+}
+
+func TestDeletePolicyWithActiveAgentsFails(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.AddAgent(kibana.Agent{PolicyID: DefaultFleetServerPolicyID})
+
+	err := s.Client().DeleteAgentPolicy(DefaultFleetServerPolicyID)
+
+	apiErr := &kibana.APIError{}
+	if assert.True(t, errors.As(err, &apiErr), "%v", err) {
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	}
+}
+
+func TestEnrollmentAPIKeys(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	client := s.Client()
+
+	key, err := client.CreateEnrollmentAPIKey("Test token", DefaultPolicyID)
+	assert.Nil(t, err)
+
+	_, err = client.CreateEnrollmentAPIKey("Fleet Server token", DefaultFleetServerPolicyID)
+	assert.Nil(t, err)
+
+	keys, err := client.ListEnrollmentAPIKeys(DefaultPolicyID)
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(keys)) {
+		assert.Equal(t, key.ID, keys[0].ID)
+	}
+
+	secret, err := client.GetEnrollmentAPIKeySecret(key.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, key.APIKey, secret)
+
+	assert.Nil(t, client.DeleteEnrollmentAPIKey(key.ID))
+
+	// the secret of a revoked token is not returned
+	_, err = client.GetEnrollmentAPIKeySecret(key.ID)
+	assert.NotNil(t, err)
+
+	// the tokens are managed with the routes of 8.0
+	assert.NotContains(t, requestedPaths(s), "/api/fleet/enrollment-api-keys")
+}
+
+func TestLegacyEnrollmentAPIKeys(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.SetVersion("7.16.0-SNAPSHOT")
+
+	client := s.Client()
+
+	key, err := client.CreateEnrollmentAPIKey("Test token", DefaultPolicyID)
+	assert.Nil(t, err)
+
+	keys, err := client.ListEnrollmentAPIKeys("")
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(keys)) {
+		assert.Equal(t, key.ID, keys[0].ID)
+	}
+
+	// the version is retrieved once, without the snapshot suffix
+	version, err := client.GetVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "7.16.0", version)
+
+	assert.Equal(t, []string{
+		"/api/status",
+		"/api/fleet/enrollment-api-keys",
+		"/api/fleet/enrollment-api-keys",
+	}, requestedPaths(s))
+}
+
+func TestInstallPackage(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.AddPackage(kibana.PackageManifest{Name: "linux", Title: "Linux", Version: "0.4.1"},
+		kibana.Asset{ID: "linux-dashboard", Type: "dashboard"},
+		kibana.Asset{ID: "metrics-linux.memory", Type: kibana.AssetTypeIndexTemplate},
+	)
+
+	client := s.Client()
+	_, err := client.GetInstalledAssets("linux", "0.4.1")
+	assert.True(t, errors.Is(err, kibana.ErrNotFound), "%v", err)
+
+	_, err = client.InstallPackage("linux", "0.4.1")
+	assert.Nil(t, err)
+
+	assets, err := client.GetInstalledAssets("linux", "0.4.1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(assets))
+
+	pkg, err := client.GetPackageByTitle("linux")
+	assert.Nil(t, err)
+	assert.Equal(t, "installed", pkg.Status)
+}
+
+func TestRespond(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	s.Respond(http.MethodGet, "/api/fleet/agent_policies", http.StatusServiceUnavailable, `{"message":"unavailable"}`)
+
+	_, err := s.Client().ListAgentPolicies()
+
+	apiErr := &kibana.APIError{}
+	if assert.True(t, errors.As(err, &apiErr), "%v", err) {
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	}
+
+	assert.Equal(t, []string{"/api/fleet/agent_policies"}, requestedPaths(s))
+}
+
+func TestAgentLocalMetadata(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	agent := kibana.Agent{}
+	agent.LocalMetadata.Elastic.Agent.BuildOriginal = "8.0.0-SNAPSHOT (build: 2f5ab8e0ad at 2021-06-01 10:00:00 +0000 UTC)"
+	agent.LocalMetadata.Host.Architecture = "x86_64"
+	agent.LocalMetadata.OS.Family = "redhat"
+	agent = s.AddAgent(agent)
+
+	metadata, err := s.Client().GetAgentLocalMetadata(agent.ID)
+	assert.Nil(t, err)
+
+	expected := map[string]string{
+		"elastic.agent.build.original": agent.LocalMetadata.Elastic.Agent.BuildOriginal,
+		"host.architecture":            "x86_64",
+		"os.family":                    "redhat",
+	}
+	for path, value := range expected {
+		field, exists := kibana.LookupMetadataField(metadata, path)
+		assert.True(t, exists, path)
+		assert.Equal(t, value, field, path)
+	}
+
+	_, exists := kibana.LookupMetadataField(metadata, "os.codename")
+	assert.False(t, exists)
+
+	assert.Equal(t, "2f5ab8e0ad", agent.LocalMetadata.Elastic.Agent.BuildHash())
+}
+
+func TestLogstashOutput(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	client := s.Client()
+
+	output, err := client.CreateOutput(kibana.Output{Hosts: []string{"logstash:5044"}, Name: "logstash", Type: kibana.LogstashOutputType})
+	assert.Nil(t, err)
+
+	assert.Nil(t, client.UpdateAgentPolicyOutputs(DefaultPolicyID, output.ID, ""))
+
+	// the policy sends its data to the output in its next revision
+	policy, err := client.GetAgentPolicy(DefaultPolicyID)
+	assert.Nil(t, err)
+	assert.Equal(t, output.ID, policy.DataOutputID)
+	assert.Equal(t, "", policy.MonitoringOutputID)
+	assert.Equal(t, 2, policy.Revision)
+
+	// the output used by a policy is not deleted
+	assert.NotNil(t, client.DeleteOutput(output.ID))
+
+	assert.Nil(t, client.UpdateAgentPolicyOutputs(DefaultPolicyID, "", ""))
+	assert.Nil(t, client.DeleteOutput(output.ID))
+
+	outputs, err := client.ListOutputs()
+	assert.Nil(t, err)
+	if assert.Equal(t, 1, len(outputs)) {
+		assert.True(t, outputs[0].IsDefault)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"strings"
+)
+
+// snapshotSuffix the suffix of the versions of the snapshots, which the agents report apart
+const snapshotSuffix = "-SNAPSHOT"
+
+// AgentsByHostname returns the KQL query filtering the agents by the hostname of their host
+func AgentsByHostname(hostname string) string {
+	return kueryClause("local_metadata.host.hostname", hostname)
+}
+
+// AgentsByPolicy returns the KQL query filtering the agents by the ID of their policy
+func AgentsByPolicy(policyID string) string {
+	return kueryClause("policy_id", policyID)
+}
+
+// AgentsByStatus returns the KQL query filtering the agents by the status computed by Fleet,
+// i.e. online, offline, error, updating or unenrolling
+func AgentsByStatus(status string) string {
+	return kueryClause("status", strings.ToLower(status))
+}
+
+// AgentsByTag returns the KQL query filtering the agents by one of the tags they were enrolled with
+func AgentsByTag(tag string) string {
+	return kueryClause("tags", tag)
+}
+
+// AgentsByVersion returns the KQL query filtering the agents by their version, which matches the
+// snapshots only if it has the -SNAPSHOT suffix, i.e. 8.0.0-SNAPSHOT
+func AgentsByVersion(version string) string {
+	snapshot := strings.HasSuffix(version, snapshotSuffix)
+
+	return KueryAnd(
+		kueryClause("local_metadata.elastic.agent.version", strings.TrimSuffix(version, snapshotSuffix)),
+		fmt.Sprintf("local_metadata.elastic.agent.snapshot:%t", snapshot),
+	)
+}
+
+// KueryAnd returns the KQL query matching all the queries, skipping the empty ones
+func KueryAnd(kueries ...string) string {
+	clauses := []string{}
+	for _, kuery := range kueries {
+		if kuery != "" {
+			clauses = append(clauses, "("+kuery+")")
+		}
+	}
+
+	if len(clauses) == 1 {
+		return strings.TrimSuffix(strings.TrimPrefix(clauses[0], "("), ")")
+	}
+
+	return strings.Join(clauses, " and ")
+}
+
+// kueryClause returns the KQL clause matching a value of a field, quoting the value
+func kueryClause(field string, value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+
+	return fmt.Sprintf(`%s:"%s"`, field, value)
+}
@@ -0,0 +1,75 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKueryClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{"plain value", "e2e-host", `field:"e2e-host"`},
+		{"spaces", "my host name", `field:"my host name"`},
+		{"quotes", `the "host"`, `field:"the \"host\""`},
+		{"backslashes", `DOMAIN\host`, `field:"DOMAIN\\host"`},
+		{"backslash before a quote", `host\"`, `field:"host\\\""`},
+		{"KQL operators", "host or status:online", `field:"host or status:online"`},
+		{"empty value", "", `field:""`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, kueryClause("field", tt.value))
+		})
+	}
+}
+
+func TestKueryAnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		kueries  []string
+		expected string
+	}{
+		{"no queries", []string{}, ""},
+		{"only empty queries", []string{"", ""}, ""},
+		{"single query", []string{`policy_id:"abc"`}, `policy_id:"abc"`},
+		{"empty queries skipped", []string{"", `policy_id:"abc"`, ""}, `policy_id:"abc"`},
+		{"several queries", []string{`policy_id:"abc"`, `status:"online"`}, `(policy_id:"abc") and (status:"online")`},
+		{"nested queries", []string{`a:"1" or b:"2"`, `c:"3"`}, `(a:"1" or b:"2") and (c:"3")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, KueryAnd(tt.kueries...))
+		})
+	}
+}
+
+func TestAgentsKueries(t *testing.T) {
+	tests := []struct {
+		name     string
+		kuery    string
+		expected string
+	}{
+		{"hostname", AgentsByHostname("e2e host"), `local_metadata.host.hostname:"e2e host"`},
+		{"policy", AgentsByPolicy("fleet-server-policy"), `policy_id:"fleet-server-policy"`},
+		{"status lowercased", AgentsByStatus("Online"), `status:"online"`},
+		{"tag", AgentsByTag(`the "tag"`), `tags:"the \"tag\""`},
+		{"release version", AgentsByVersion("7.10.2"), `(local_metadata.elastic.agent.version:"7.10.2") and (local_metadata.elastic.agent.snapshot:false)`},
+		{"snapshot version", AgentsByVersion("8.0.0-SNAPSHOT"), `(local_metadata.elastic.agent.version:"8.0.0") and (local_metadata.elastic.agent.snapshot:true)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.kuery)
+		})
+	}
+}
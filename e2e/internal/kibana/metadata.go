@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// buildHashRegexp matches the build hash in the original build of an agent, i.e.
+// 8.0.0-SNAPSHOT (build: 2f5ab8e0ad at 2021-06-01 10:00:00 +0000 UTC)
+var buildHashRegexp = regexp.MustCompile(`\(build: ([0-9a-f]+)`)
+
+// BuildHash returns the hash of the commit the agent was built from, as reported in its original
+// build, or an empty string if it does not report it
+func (i AgentInfo) BuildHash() string {
+	matches := buildHashRegexp.FindStringSubmatch(i.BuildOriginal)
+	if matches == nil {
+		return ""
+	}
+
+	return matches[1]
+}
+
+// GetAgentLocalMetadata returns the local metadata reported by an agent, by its ID, as it's listed
+// in Fleet, so that any field can be looked up, including the ones not in AgentMetadata
+func (c *Client) GetAgentLocalMetadata(id string) (map[string]interface{}, error) {
+	response := struct {
+		Item struct {
+			LocalMetadata map[string]interface{} `json:"local_metadata"`
+		} `json:"item"`
+	}{}
+
+	err := c.get(fmt.Sprintf(fleetAgentURL, id), "", &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Item.LocalMetadata == nil {
+		return nil, fmt.Errorf("the agent %s has no local metadata: %w", id, ErrNotFound)
+	}
+
+	return response.Item.LocalMetadata, nil
+}
+
+// LookupMetadataField returns the value of a field of the local metadata of an agent by its path,
+// i.e. os.family, and if it exists. The metadata mixes nested objects and keys with dots, i.e.
+// elastic.agent.build.original, so the longest key matching the path is looked up at each level
+func LookupMetadataField(metadata map[string]interface{}, path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+
+	for i := len(segments); i > 0; i-- {
+		value, exists := metadata[strings.Join(segments[:i], ".")]
+		if !exists {
+			continue
+		}
+
+		if i == len(segments) {
+			return value, true
+		}
+
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if found, exists := LookupMetadataField(nested, strings.Join(segments[i:], ".")); exists {
+			return found, true
+		}
+	}
+
+	return nil, false
+}
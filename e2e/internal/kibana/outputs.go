@@ -0,0 +1,109 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ElasticsearchOutputType the type of the outputs sending the data of the agents to Elasticsearch
+const ElasticsearchOutputType = "elasticsearch"
+
+// LogstashOutputType the type of the outputs sending the data of the agents to Logstash
+const LogstashOutputType = "logstash"
+
+// OutputSSL the TLS settings of an output, i.e. the certificates of the agents sending their data
+// to Logstash
+type OutputSSL struct {
+	Certificate            string   `json:"certificate,omitempty"`
+	CertificateAuthorities []string `json:"certificate_authorities,omitempty"`
+	Key                    string   `json:"key,omitempty"`
+}
+
+// CreateOutput creates an output of Fleet, which the policies send the data of their agents to
+// once they use it
+func (c *Client) CreateOutput(output Output) (Output, error) {
+	payload := map[string]interface{}{
+		"hosts": output.Hosts,
+		"name":  output.Name,
+		"type":  output.Type,
+	}
+	if output.SSL != nil {
+		payload["ssl"] = output.SSL
+	}
+
+	response := struct {
+		Item Output `json:"item"`
+	}{}
+
+	err := c.post(fleetOutputsURL, payload, &response)
+	if err != nil {
+		return Output{}, err
+	}
+
+	log.WithFields(log.Fields{
+		"hosts":    response.Item.Hosts,
+		"outputID": response.Item.ID,
+		"type":     response.Item.Type,
+	}).Debug("Fleet output created")
+
+	return response.Item, nil
+}
+
+// DeleteOutput deletes an output of Fleet, which fails if there are policies using it
+func (c *Client) DeleteOutput(id string) error {
+	err := c.delete(fmt.Sprintf(fleetOutputURL, id), nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"outputID": id,
+	}).Debug("Fleet output deleted")
+
+	return nil
+}
+
+// UpdateAgentPolicyOutputs sets the outputs of a policy: the one of the data of its agents, and the
+// one of their monitoring data, being the default output of Fleet the empty ones
+func (c *Client) UpdateAgentPolicyOutputs(id string, dataOutputID string, monitoringOutputID string) error {
+	policy, err := c.GetAgentPolicy(id)
+	if err != nil {
+		return err
+	}
+
+	// the policies are updated as a whole, keeping their name and namespace
+	payload := map[string]interface{}{
+		"data_output_id":       nullableID(dataOutputID),
+		"description":          policy.Description,
+		"monitoring_output_id": nullableID(monitoringOutputID),
+		"name":                 policy.Name,
+		"namespace":            policy.Namespace,
+	}
+
+	err = c.put(fmt.Sprintf(fleetAgentPolicyURL, id), payload, nil)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"dataOutputID":       dataOutputID,
+		"monitoringOutputID": monitoringOutputID,
+		"policyID":           id,
+	}).Debug("Fleet policy outputs updated")
+
+	return nil
+}
+
+// nullableID returns an ID, or null if it's empty, which resets the references to the defaults
+func nullableID(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+
+	return id
+}
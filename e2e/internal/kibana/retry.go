@@ -0,0 +1,115 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"errors"
+	"net/http"
+	"syscall"
+	"time"
+
+	curl "github.com/elastic/e2e-testing/cli/shell"
+)
+
+// EndpointClass the class of the endpoints of the API sharing a retry policy
+type EndpointClass string
+
+const (
+	// ReadEndpoints the endpoints of the GET requests, which are safe to repeat
+	ReadEndpoints EndpointClass = "read"
+	// MutatingEndpoints the endpoints of the POST, PUT and DELETE requests, which are repeated
+	// only when Kibana did not process them
+	MutatingEndpoints EndpointClass = "mutating"
+)
+
+// RetryPolicy the policy retrying the requests to Kibana which fail with a transient error, i.e.
+// a 503 Service Unavailable while Kibana initializes
+type RetryPolicy struct {
+	MaxAttempts          int           // attempts of a request, including the first one. One disables the retries
+	InitialInterval      time.Duration // wait before the second attempt, doubled for each of the next ones
+	MaxInterval          time.Duration // max wait between two attempts, which caps the Retry-After header too
+	RetryableStatusCodes []int         // status codes of the responses which are retried
+	RetryConnectionError bool          // retries the requests failing to reach Kibana, i.e. while it's restarted
+}
+
+// DefaultReadPolicy the retry policy of the read endpoints, which retries the gateway errors and
+// the connection errors, as repeating a GET request has no side effects
+var DefaultReadPolicy = RetryPolicy{
+	MaxAttempts:     5,
+	InitialInterval: 500 * time.Millisecond,
+	MaxInterval:     10 * time.Second,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	RetryConnectionError: true,
+}
+
+// DefaultMutatingPolicy the retry policy of the mutating endpoints, which only retries the
+// responses telling that the request was not processed, and the refused connections, so that an
+// agent is never enrolled nor a policy created twice
+var DefaultMutatingPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	InitialInterval: time.Second,
+	MaxInterval:     10 * time.Second,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusServiceUnavailable,
+	},
+	RetryConnectionError: true,
+}
+
+// endpointClass returns the class of the endpoints of a method
+func endpointClass(method string) EndpointClass {
+	if method == http.MethodGet || method == http.MethodHead {
+		return ReadEndpoints
+	}
+
+	return MutatingEndpoints
+}
+
+// retryable checks if the error of an attempt of a request of a class of endpoints is retried by
+// the policy
+func (p RetryPolicy) retryable(class EndpointClass, apiErr *APIError) bool {
+	if apiErr.StatusCode == 0 {
+		if !p.RetryConnectionError {
+			return false
+		}
+
+		// the mutating requests are only repeated if the connection was refused, as any other
+		// error, such as a reset connection, could happen once Kibana received them
+		return class == ReadEndpoints || errors.Is(apiErr.Err, syscall.ECONNREFUSED)
+	}
+
+	for _, code := range p.RetryableStatusCodes {
+		if code == apiErr.StatusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wait returns the wait before the next attempt, honoring the Retry-After header of the response,
+// capped to the max interval
+func (p RetryPolicy) wait(attempt int, apiErr *APIError) time.Duration {
+	wait := p.InitialInterval
+	for i := 1; i < attempt && wait < p.MaxInterval; i++ {
+		wait *= 2
+	}
+
+	var statusErr *curl.HTTPStatusError
+	if errors.As(apiErr.Err, &statusErr) && statusErr.RetryAfter > wait {
+		wait = statusErr.RetryAfter
+	}
+
+	if p.MaxInterval > 0 && wait > p.MaxInterval {
+		wait = p.MaxInterval
+	}
+
+	return wait
+}
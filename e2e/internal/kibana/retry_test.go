@@ -0,0 +1,225 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPolicy a retry policy with short waits, so that the retries do not slow down the tests
+var testPolicy = RetryPolicy{
+	MaxAttempts:          3,
+	InitialInterval:      time.Millisecond,
+	MaxInterval:          10 * time.Millisecond,
+	RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	RetryConnectionError: true,
+}
+
+// newFailingServer returns a server responding to the first requests with a status code, and with
+// an empty JSON object once they are done, counting the requests
+func newFailingServer(failures int, statusCode int, retryAfter string) (*httptest.Server, func() int) {
+	mutex := sync.Mutex{}
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests++
+		current := requests
+		mutex.Unlock()
+
+		if current <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statusCode)
+			_, _ = w.Write([]byte(`{"message":"failure"}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{}`))
+	}))
+
+	return server, func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return requests
+	}
+}
+
+func TestEndpointClass(t *testing.T) {
+	tests := []struct {
+		method string
+		class  EndpointClass
+	}{
+		{http.MethodGet, ReadEndpoints},
+		{http.MethodHead, ReadEndpoints},
+		{http.MethodPost, MutatingEndpoints},
+		{http.MethodPut, MutatingEndpoints},
+		{http.MethodDelete, MutatingEndpoints},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.class, endpointClass(tt.method), tt.method)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		class    EndpointClass
+		apiErr   *APIError
+		expected bool
+	}{
+		{"GET on 503", DefaultReadPolicy, ReadEndpoints, &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"GET on 502", DefaultReadPolicy, ReadEndpoints, &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"GET on 500", DefaultReadPolicy, ReadEndpoints, &APIError{StatusCode: http.StatusInternalServerError}, false},
+		{"GET on 404", DefaultReadPolicy, ReadEndpoints, &APIError{StatusCode: http.StatusNotFound}, false},
+		{"GET on a reset connection", DefaultReadPolicy, ReadEndpoints, &APIError{Err: syscall.ECONNRESET}, true},
+		{"POST on 503", DefaultMutatingPolicy, MutatingEndpoints, &APIError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"POST on 500", DefaultMutatingPolicy, MutatingEndpoints, &APIError{StatusCode: http.StatusInternalServerError}, false},
+		{"POST on 502", DefaultMutatingPolicy, MutatingEndpoints, &APIError{StatusCode: http.StatusBadGateway}, false},
+		{"POST on 504", DefaultMutatingPolicy, MutatingEndpoints, &APIError{StatusCode: http.StatusGatewayTimeout}, false},
+		{"POST on a refused connection", DefaultMutatingPolicy, MutatingEndpoints, &APIError{Err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED)}, true},
+		{"POST on a reset connection", DefaultMutatingPolicy, MutatingEndpoints, &APIError{Err: syscall.ECONNRESET}, false},
+		{"connection errors disabled", RetryPolicy{MaxAttempts: 3}, ReadEndpoints, &APIError{Err: syscall.ECONNREFUSED}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.policy.retryable(tt.class, tt.apiErr))
+		})
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: time.Second,
+		MaxInterval:     10 * time.Second,
+	}
+
+	retryAfter := func(d time.Duration) *APIError {
+		return &APIError{
+			Err:        &curl.HTTPStatusError{RetryAfter: d, StatusCode: http.StatusServiceUnavailable},
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		attempt  int
+		apiErr   *APIError
+		expected time.Duration
+	}{
+		{"first attempt", 1, &APIError{StatusCode: http.StatusServiceUnavailable}, time.Second},
+		{"doubled for the second attempt", 2, &APIError{StatusCode: http.StatusServiceUnavailable}, 2 * time.Second},
+		{"doubled for the third attempt", 3, &APIError{StatusCode: http.StatusServiceUnavailable}, 4 * time.Second},
+		{"capped to the max interval", 10, &APIError{StatusCode: http.StatusServiceUnavailable}, 10 * time.Second},
+		{"Retry-After honored", 1, retryAfter(3 * time.Second), 3 * time.Second},
+		{"Retry-After shorter than the backoff", 3, retryAfter(time.Second), 4 * time.Second},
+		{"Retry-After capped to the max interval", 1, retryAfter(time.Minute), 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.wait(tt.attempt, tt.apiErr))
+		})
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		failures   int
+		statusCode int
+		requests   int
+		success    bool
+	}{
+		{"GET retried on 503", http.MethodGet, 2, http.StatusServiceUnavailable, 3, true},
+		{"GET not retried on 500", http.MethodGet, 1, http.StatusInternalServerError, 1, false},
+		{"GET failing in all the attempts", http.MethodGet, 5, http.StatusServiceUnavailable, 3, false},
+		{"POST retried on 503", http.MethodPost, 1, http.StatusServiceUnavailable, 2, true},
+		{"POST not retried on 500", http.MethodPost, 1, http.StatusInternalServerError, 1, false},
+		{"PUT not retried on 502", http.MethodPut, 1, http.StatusBadGateway, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newFailingServer(tt.failures, tt.statusCode, "")
+			defer server.Close()
+
+			client := NewClientWithBaseURL(server.URL).
+				WithRetryPolicy(ReadEndpoints, testPolicy).
+				WithRetryPolicy(MutatingEndpoints, testPolicy)
+
+			err := client.do(tt.method, "/api/fleet/agents", "", map[string]string{}, nil)
+			assert.Equal(t, tt.success, err == nil, "%v", err)
+			assert.Equal(t, tt.requests, requests())
+		})
+	}
+}
+
+func TestClientHonorsCappedRetryAfter(t *testing.T) {
+	// the server asks to wait for an hour, which is capped to the max interval of the policy
+	server, requests := newFailingServer(1, http.StatusServiceUnavailable, "3600")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL).WithRetryPolicy(ReadEndpoints, testPolicy)
+
+	startedAt := time.Now()
+	err := client.get("/api/fleet/agents", "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests())
+	assert.True(t, time.Since(startedAt) >= testPolicy.MaxInterval)
+	assert.True(t, time.Since(startedAt) < time.Minute)
+}
+
+func TestRetryErrorKeepsAllTheAttempts(t *testing.T) {
+	server, _ := newFailingServer(5, http.StatusServiceUnavailable, "")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL).WithRetryPolicy(ReadEndpoints, testPolicy)
+
+	err := client.get("/api/fleet/agents", "", nil)
+
+	var retryErr *RetryError
+	assert.True(t, errors.As(err, &retryErr))
+	assert.Equal(t, testPolicy.MaxAttempts, len(retryErr.Attempts))
+	for _, attempt := range retryErr.Attempts {
+		assert.Equal(t, http.StatusServiceUnavailable, attempt.StatusCode)
+		assert.Equal(t, http.MethodGet, attempt.Method)
+	}
+	assert.Contains(t, err.Error(), "3 attempts")
+
+	// the error unwraps to the last attempt
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, retryErr.Attempts[2], apiErr)
+}
+
+func TestSingleAttemptIsNotWrapped(t *testing.T) {
+	server, requests := newFailingServer(1, http.StatusNotFound, "")
+	defer server.Close()
+
+	client := NewClientWithBaseURL(server.URL).WithRetryPolicy(ReadEndpoints, testPolicy)
+
+	err := client.get("/api/fleet/agents", "", nil)
+
+	var retryErr *RetryError
+	assert.False(t, errors.As(err, &retryErr))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 1, requests())
+}
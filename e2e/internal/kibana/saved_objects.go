@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+const savedObjectsBulkGetURL = "/api/saved_objects/_bulk_get"
+
+// SavedObject a saved object of Kibana, i.e. a dashboard, with the error of its lookup if it does
+// not exist
+type SavedObject struct {
+	Attributes struct {
+		Title string `json:"title"`
+	} `json:"attributes"`
+	Error *SavedObjectError `json:"error"`
+	ID    string            `json:"id"`
+	Type  string            `json:"type"`
+}
+
+// SavedObjectError the error of the lookup of a saved object, i.e. not found
+type SavedObjectError struct {
+	Message    string `json:"message"`
+	StatusCode int    `json:"statusCode"`
+}
+
+// BulkGetSavedObjects returns the saved objects of some assets with a single request, in the same
+// order. The ones which do not exist are returned with the error of their lookup
+func (c *Client) BulkGetSavedObjects(assets []Asset) ([]SavedObject, error) {
+	response := struct {
+		SavedObjects []SavedObject `json:"saved_objects"`
+	}{}
+
+	err := c.post(savedObjectsBulkGetURL, assets, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.SavedObjects),
+	}).Trace("Saved objects retrieved")
+
+	return response.SavedObjects, nil
+}
@@ -0,0 +1,103 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package kibana
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const endpointMetadataURL = "/api/endpoint/metadata"
+
+// EndpointHost a host listed in the Administration view of the Security App
+type EndpointHost struct {
+	HostStatus string           `json:"host_status"`
+	Metadata   EndpointMetadata `json:"metadata"`
+}
+
+// EndpointMetadata the metadata reported by Endpoint about its host and its agent
+type EndpointMetadata struct {
+	Elastic  ElasticMetadata `json:"elastic"`
+	Endpoint EndpointInfo    `json:"Endpoint"`
+	Host     HostMetadata    `json:"host"`
+}
+
+// EndpointInfo the state of Endpoint in a host
+type EndpointInfo struct {
+	Policy EndpointPolicy `json:"policy"`
+}
+
+// EndpointPolicy the policy of Endpoint in a host
+type EndpointPolicy struct {
+	Applied AppliedPolicy `json:"applied"`
+}
+
+// AppliedPolicy the policy applied by Endpoint, and the status of the application, i.e. success.
+// The ID is the one of the package policy of the integration, and the Endpoint policy version its
+// revision, so that an update of the integration is reflected once it's applied
+type AppliedPolicy struct {
+	EndpointPolicyVersion int    `json:"endpoint_policy_version"`
+	ID                    string `json:"id"`
+	Name                  string `json:"name"`
+	Status                string `json:"status"`
+	Version               int    `json:"version"` // the revision of the agent policy
+}
+
+// GetEndpointHostByAgentID returns the host of an agent in the Security App, failing with ErrNotFound
+// if it's not listed
+func (c *Client) GetEndpointHostByAgentID(agentID string) (EndpointHost, error) {
+	hosts, err := c.ListEndpointHosts()
+	if err != nil {
+		return EndpointHost{}, err
+	}
+
+	for _, host := range hosts {
+		if host.Metadata.Elastic.Agent.ID == agentID {
+			return host, nil
+		}
+	}
+
+	return EndpointHost{}, fmt.Errorf("the host of the %s agent in the Security App: %w", agentID, ErrNotFound)
+}
+
+// GetEndpointHostByHostname returns the host of a hostname in the Security App, failing with
+// ErrNotFound if it's not listed
+func (c *Client) GetEndpointHostByHostname(hostname string) (EndpointHost, error) {
+	hosts, err := c.ListEndpointHosts()
+	if err != nil {
+		return EndpointHost{}, err
+	}
+
+	for _, host := range hosts {
+		if host.Metadata.Host.Hostname == hostname {
+			log.WithFields(log.Fields{
+				"hostname": hostname,
+			}).Debug("Hostname for the agent listed in the Security App")
+
+			return host, nil
+		}
+	}
+
+	return EndpointHost{}, fmt.Errorf("the host of the %s hostname in the Security App: %w", hostname, ErrNotFound)
+}
+
+// ListEndpointHosts returns the hosts listed in the Administration view of the Security App
+func (c *Client) ListEndpointHosts() ([]EndpointHost, error) {
+	response := struct {
+		Hosts []EndpointHost `json:"hosts"`
+	}{}
+
+	err := c.post(endpointMetadataURL, nil, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"count": len(response.Hosts),
+	}).Trace("Hosts in the Security App")
+
+	return response.Hosts, nil
+}
@@ -0,0 +1,204 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package tracing records the scenarios of the test suites in Elastic APM, as a transaction per
+// scenario with a span per step, and the operations run by the steps, such as the requests to
+// Kibana or the docker-compose commands, as spans of the running step. It's disabled unless the
+// ELASTIC_APM_SERVER_URL environment variable is set
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+// ServerURLEnvVar the environment variable with the URL of the APM Server receiving the traces
+const ServerURLEnvVar = "ELASTIC_APM_SERVER_URL"
+
+// defaultServiceName the name of the service of the traces, unless it's set in the
+// ELASTIC_APM_SERVICE_NAME environment variable
+const defaultServiceName = "e2e-testing"
+
+// scenarioTracer keeps the transaction of the running scenario and the span of its running step
+type scenarioTracer struct {
+	mutex  sync.Mutex
+	step   *apm.Span
+	tracer *apm.Tracer // nil when tracing is disabled
+	tx     *apm.Transaction
+}
+
+var current = &scenarioTracer{}
+
+func init() {
+	// the default tracer is configured from the environment when the package is imported, polling
+	// the APM Server even if it's not set, so it's replaced by the one of the suite
+	apm.DefaultTracer.Close()
+}
+
+// Start starts the tracer of the suite if the URL of the APM Server is set. The rest of the settings
+// of the agent are read from the ELASTIC_APM_* environment variables as usual
+func Start() error {
+	if shell.GetEnv(ServerURLEnvVar, "") == "" {
+		return nil
+	}
+
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{
+		ServiceName: shell.GetEnv("ELASTIC_APM_SERVICE_NAME", defaultServiceName),
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not start the tracer of the scenarios")
+		return err
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	current.tracer = tracer
+
+	log.WithFields(log.Fields{
+		"serverURL": shell.GetEnv(ServerURLEnvVar, ""),
+	}).Info("The scenarios are traced in Elastic APM")
+
+	return nil
+}
+
+// Stop sends the pending traces to the APM Server, and stops the tracer
+func Stop() {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if current.tracer == nil {
+		return
+	}
+
+	current.tracer.Flush(nil)
+	current.tracer.Close()
+	current.tracer = nil
+}
+
+// StartScenario starts the transaction of a scenario, labelled with the labels of the run
+func StartScenario(name string, labels map[string]string) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if current.tracer == nil {
+		return
+	}
+
+	current.tx = current.tracer.StartTransaction(name, "scenario")
+	for key, value := range labels {
+		current.tx.Context.SetLabel(key, value)
+	}
+}
+
+// EndScenario ends the transaction of the running scenario, sending the error of the failed
+// scenarios too
+func EndScenario(err error) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if current.tx == nil {
+		return
+	}
+
+	current.tx.Result = "passed"
+	current.tx.Outcome = "success"
+	if err != nil {
+		current.tx.Result = "failed"
+		current.tx.Outcome = "failure"
+
+		e := current.tracer.NewError(err)
+		e.SetTransaction(current.tx)
+		e.Send()
+	}
+
+	current.tx.End()
+	current.tx = nil
+	current.step = nil
+}
+
+// StartStep starts the span of a step of the running scenario
+func StartStep(text string) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	current.step = current.tx.StartSpan(text, "step", nil)
+}
+
+// EndStep ends the span of the running step, with the outcome of the step
+func EndStep(err error) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if current.step == nil {
+		return
+	}
+
+	endSpan(current.step, err)
+	current.step = nil
+}
+
+// StartSpan starts the span of an operation of the running step, or of the running scenario if
+// it's run by its hooks. The span is dropped when there is no running scenario, so that it can be
+// ended anyway. The type of the span is a dot-separated type, subtype and action, i.e. external.http
+func StartSpan(name string, spanType string, labels map[string]string) *apm.Span {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	span := current.tx.StartSpan(name, spanType, current.step)
+	for key, value := range labels {
+		span.Context.SetLabel(key, value)
+	}
+
+	return span
+}
+
+// RecordSpan records the span of an operation of the running scenario which started at a time and
+// ends now, i.e. the propagation of a change of a policy to its agents, which spans several steps
+func RecordSpan(name string, spanType string, start time.Time, labels map[string]string) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	span := current.tx.StartSpanOptions(name, spanType, apm.SpanOptions{Start: start})
+	for key, value := range labels {
+		span.Context.SetLabel(key, value)
+	}
+
+	endSpan(span, nil)
+}
+
+// EndSpan ends a span, with the outcome of its operation
+func EndSpan(span *apm.Span, err error) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	endSpan(span, err)
+}
+
+// Traceparent returns the W3C traceparent header propagating the trace context of a span, so that
+// the services instrumented with APM continue the trace. It's empty for the dropped spans
+func Traceparent(span *apm.Span) string {
+	if span.Dropped() {
+		return ""
+	}
+
+	return apmhttp.FormatTraceparentHeader(span.TraceContext())
+}
+
+// endSpan ends a span, with the outcome of its operation
+func endSpan(span *apm.Span, err error) {
+	span.Outcome = "success"
+	if err != nil {
+		span.Outcome = "failure"
+	}
+
+	span.End()
+}
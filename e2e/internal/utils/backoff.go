@@ -0,0 +1,40 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package utils
+
+import (
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+)
+
+// the policy of the retries: the interval between them doubles from half a second up to five
+// seconds, randomized by half of its value, so that the pollers of several workers or agents
+// do not hit the services at the same time
+const (
+	initialInterval     = 500 * time.Millisecond
+	maxInterval         = 5 * time.Second
+	multiplier          = 2.0
+	randomizationFactor = 0.5
+)
+
+// NewExponentialBackOff returns an exponential backoff with jitter, retrying an operation until
+// the max elapsed time passes, no matter the number of attempts. As the backoff retries forever
+// with a zero max elapsed time, it's a millisecond at least
+func NewExponentialBackOff(maxElapsedTime time.Duration) *backoff.ExponentialBackOff {
+	if maxElapsedTime < time.Millisecond {
+		maxElapsedTime = time.Millisecond
+	}
+
+	exp := backoff.NewExponentialBackOff()
+	exp.InitialInterval = initialInterval
+	exp.MaxElapsedTime = maxElapsedTime
+	exp.MaxInterval = maxInterval
+	exp.Multiplier = multiplier
+	exp.RandomizationFactor = randomizationFactor
+	exp.Reset()
+
+	return exp
+}
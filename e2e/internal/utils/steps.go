@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// stepPanic a panic of a step function, raised again in the goroutine calling the step
+type stepPanic struct {
+	value interface{}
+}
+
+// WithContextDeadline wraps a step function, keeping its signature, so that the step fails as soon
+// as the context of the scenario is done, even if the function hangs, which keeps running in the
+// background. The context is the first argument of the step, if it accepts one, or the one
+// returned by a function otherwise. The steps returning an error fail with the error of the
+// context, and the other ones panic with it
+func WithContextDeadline(stepFunc interface{}, scenarioContext func() context.Context) interface{} {
+	fn := reflect.ValueOf(stepFunc)
+	if fn.Kind() != reflect.Func {
+		// godog reports the invalid steps when they are registered
+		return stepFunc
+	}
+
+	fnType := fn.Type()
+
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		ctx := scenarioContext()
+		if len(args) > 0 && fnType.In(0) == contextType && !args[0].IsNil() {
+			ctx = args[0].Interface().(context.Context)
+		}
+
+		if ctx.Done() == nil {
+			return fn.Call(args)
+		}
+
+		results := make(chan []reflect.Value, 1)
+		panics := make(chan stepPanic, 1)
+		go func() {
+			defer func() {
+				if r := recover(); r != nil {
+					panics <- stepPanic{value: r}
+				}
+			}()
+
+			results <- fn.Call(args)
+		}()
+
+		select {
+		case r := <-results:
+			return r
+		case p := <-panics:
+			panic(p.value)
+		case <-ctx.Done():
+		}
+
+		// the step could finish at the same time as the context
+		select {
+		case r := <-results:
+			return r
+		default:
+		}
+
+		err := fmt.Errorf("the step did not finish before the scenario was cancelled: %w", ctx.Err())
+
+		out := make([]reflect.Value, fnType.NumOut())
+		failed := false
+		for i := range out {
+			switch fnType.Out(i) {
+			case errorType:
+				out[i] = reflect.ValueOf(&err).Elem()
+				failed = true
+			case contextType:
+				out[i] = reflect.ValueOf(&ctx).Elem()
+			default:
+				out[i] = reflect.Zero(fnType.Out(i))
+			}
+		}
+
+		if !failed {
+			panic(err)
+		}
+
+		return out
+	}).Interface()
+}
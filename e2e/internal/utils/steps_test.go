@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hang blocks until the test finishes, as a step which never returns
+func hang(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	<-done
+}
+
+func expired() context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_ = cancel
+
+	return ctx
+}
+
+func TestWithContextDeadlineFailsAHungStep(t *testing.T) {
+	step := WithContextDeadline(func(name string) error {
+		hang(t)
+		return nil
+	}, expired).(func(string) error)
+
+	startedAt := time.Now()
+	err := step("the agent is online")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.True(t, time.Since(startedAt) < time.Minute)
+}
+
+func TestWithContextDeadlineUsesTheContextOfTheStep(t *testing.T) {
+	// the context of the scenario has no deadline, but the one passed to the step has
+	step := WithContextDeadline(func(ctx context.Context, name string) (context.Context, error) {
+		hang(t)
+		return ctx, nil
+	}, context.Background).(func(context.Context, string) (context.Context, error))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	returned, err := step(ctx, "the agent is online")
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.Equal(t, ctx, returned)
+}
+
+func TestWithContextDeadlineReturnsTheResults(t *testing.T) {
+	failure := errors.New("the agent is offline")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	scenarioContext := func() context.Context { return ctx }
+
+	succeeding := WithContextDeadline(func(count int) error { return nil }, scenarioContext).(func(int) error)
+	assert.Nil(t, succeeding(1))
+
+	failing := WithContextDeadline(func(count int) error { return failure }, scenarioContext).(func(int) error)
+	assert.Equal(t, failure, failing(1))
+
+	// the steps are called in place when the context of the scenario is never done
+	called := false
+	inPlace := WithContextDeadline(func() error { called = true; return nil }, context.Background).(func() error)
+	assert.Nil(t, inPlace())
+	assert.True(t, called)
+}
+
+func TestWithContextDeadlineRaisesThePanics(t *testing.T) {
+	step := WithContextDeadline(func() error {
+		panic("the step panicked")
+	}, expired).(func() error)
+
+	assert.PanicsWithValue(t, "the step panicked", func() { _ = step() })
+}
+
+func TestWithContextDeadlinePanicsWithoutAnErrorResult(t *testing.T) {
+	step := WithContextDeadline(func() {
+		hang(t)
+	}, expired).(func())
+
+	assert.Panics(t, step)
+}
+
+func TestWithContextDeadlineOfANonFunction(t *testing.T) {
+	assert.Equal(t, "not a step", WithContextDeadline("not a step", context.Background))
+}
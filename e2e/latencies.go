@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	"github.com/elastic/e2e-testing/e2e/internal/tracing"
+	log "github.com/sirupsen/logrus"
+)
+
+// LatencySLOsEnvVar the environment variable setting the max latencies of the operations of the
+// scenarios, which fail when one of them is exceeded, i.e. "policy-acknowledgement=1m"
+const LatencySLOsEnvVar = "LATENCY_SLOS"
+
+// GetLatencySLOs returns the max latencies of the operations of the scenarios by name, read from the
+// LATENCY_SLOS environment variable, i.e. "policy-acknowledgement=1m,enrollment=2m"
+func GetLatencySLOs() (map[string]time.Duration, error) {
+	slos := map[string]time.Duration{}
+
+	value := shell.GetEnv(LatencySLOsEnvVar, "")
+	if value == "" {
+		return slos, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("The SLO of the latency is not valid: %s, use the name=threshold format", item)
+		}
+
+		threshold, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("The threshold of the SLO of the latency is not valid: %s - %v", item, err)
+		}
+
+		slos[parts[0]] = threshold
+	}
+
+	return slos, nil
+}
+
+// RecordLatency records the latency of an operation of a scenario which started at a time and
+// completes now, i.e. the time an agent takes to acknowledge a change of its policy: as a measurement
+// of the benchmark runs, and as a span of the scenario in Elastic APM, with the labels. It returns an
+// error wrapping ErrSLOExceeded if the latency exceeds its SLO, so that the scenario fails
+func RecordLatency(name string, start time.Time, labels map[string]string) error {
+	latency := time.Since(start)
+
+	RecordMeasurement(name, latency)
+	tracing.RecordSpan(name, "app.latency", start, labels)
+
+	slos, err := GetLatencySLOs()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Could not parse the SLOs of the latencies")
+		return err
+	}
+
+	threshold, exists := slos[name]
+	if !exists || latency <= threshold {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"labels":    labels,
+		"latency":   latency,
+		"name":      name,
+		"threshold": threshold,
+	}).Error("The latency exceeded its SLO")
+
+	return fmt.Errorf("the %s latency is %s, exceeding the %s threshold: %w", name, latency.Round(time.Millisecond), threshold, e2eerrors.ErrSLOExceeded)
+}
@@ -0,0 +1,186 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+	log "github.com/sirupsen/logrus"
+)
+
+// beatsRawContentPrefix prefix of the URLs of the files in the Beats repository, i.e. the configuration
+// files of the Beats, which are followed by the branch and the path of the file
+const beatsRawContentPrefix = "https://raw.githubusercontent.com/elastic/beats/"
+
+// localImagesNamespace namespace of the docker images built by the Beats
+const localImagesNamespace = "docker.elastic.co/beats/"
+
+// testImagesNamespace namespace of the docker images of the Beats used by the compose files
+const testImagesNamespace = "docker.elastic.co/observability-ci/"
+
+// errLocalArtifactFound stops walking the local artifacts path when the artifact is found
+var errLocalArtifactFound = errors.New("local artifact found")
+
+// GetLocalArtifactsPath returns the path where the artifacts are looked up before downloading
+// them, read from the BEATS_LOCAL_PATH environment variable, i.e. a local clone of the Beats
+// repository, where the packages and docker images are built under the build/distributions dirs.
+// It returns an empty string if there is no local path
+func GetLocalArtifactsPath() string {
+	return shell.GetEnv("BEATS_LOCAL_PATH", "")
+}
+
+// FindLocalArtifact looks up a file by name in the local artifacts path, returning its path
+// and if it exists
+func FindLocalArtifact(fileName string) (string, bool) {
+	root := GetLocalArtifactsPath()
+	if root == "" {
+		return "", false
+	}
+
+	candidate := filepath.Join(root, fileName)
+	if isFile(candidate) {
+		return candidate, true
+	}
+
+	found := ""
+	_ = walkLocalArtifacts(root, func(filePath string) error {
+		if filepath.Base(filePath) == fileName {
+			found = filePath
+			return errLocalArtifactFound
+		}
+		return nil
+	})
+
+	if found == "" {
+		return "", false
+	}
+
+	log.WithFields(log.Fields{
+		"file": fileName,
+		"path": found,
+	}).Debug("Local artifact found")
+
+	return found, true
+}
+
+// LoadLocalDockerImages loads the docker images of an artifact built in the local artifacts path,
+// i.e. elastic-agent-8.0.0-SNAPSHOT-linux-amd64.docker.tar.gz, tagging them in the namespace used
+// by the compose files, so that they are used instead of pulling them. The images of other
+// architectures than the one of the services are skipped
+func LoadLocalDockerImages(artifact string) error {
+	root := GetLocalArtifactsPath()
+	if root == "" {
+		return nil
+	}
+
+	archSuffix := "-linux-" + config.GetArch() + ".docker.tar.gz"
+
+	imageFiles := []string{}
+	err := walkLocalArtifacts(root, func(filePath string) error {
+		fileName := filepath.Base(filePath)
+		if strings.HasPrefix(fileName, artifact+"-") && strings.HasSuffix(fileName, archSuffix) {
+			imageFiles = append(imageFiles, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	for _, imageFile := range imageFiles {
+		images, err := docker.LoadImage(ctx, imageFile)
+		if err != nil {
+			return err
+		}
+
+		for _, image := range images {
+			if !strings.HasPrefix(image, localImagesNamespace) {
+				continue
+			}
+
+			target := testImagesNamespace + strings.TrimPrefix(image, localImagesNamespace)
+
+			err = docker.TagImage(ctx, image, target)
+			if err != nil {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"file":  imageFile,
+				"image": target,
+			}).Info("Using the local docker image")
+		}
+	}
+
+	return nil
+}
+
+// findLocalFile looks up the file of a URL in the local artifacts path. The files in the Beats
+// repository are looked up by their path in the repository, as their names are not unique,
+// and the rest by their name
+func findLocalFile(fileURL string) (string, bool) {
+	root := GetLocalArtifactsPath()
+	if root == "" {
+		return "", false
+	}
+
+	if strings.HasPrefix(fileURL, beatsRawContentPrefix) {
+		// i.e. master/x-pack/elastic-agent/elastic-agent.docker.yml
+		parts := strings.SplitN(strings.TrimPrefix(fileURL, beatsRawContentPrefix), "/", 2)
+		if len(parts) == 2 {
+			candidate := filepath.Join(root, filepath.FromSlash(parts[1]))
+			if isFile(candidate) {
+				return candidate, true
+			}
+		}
+
+		return "", false
+	}
+
+	return FindLocalArtifact(artifacts.FileNameFromURL(fileURL))
+}
+
+// isFile checks if a path exists, being a regular file
+func isFile(filePath string) bool {
+	info, err := os.Stat(filePath)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// walkLocalArtifacts walks the files in the local artifacts path, skipping the hidden dirs and
+// the dependencies, as they are not going to include artifacts
+func walkLocalArtifacts(root string, fn func(filePath string) error) error {
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if info.IsDir() {
+			name := info.Name()
+			if filePath != root && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return fn(filePath)
+	})
+	if err == errLocalArtifactFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// outputsMutex serialises the writes to the files in the outputs dir
+var outputsMutex sync.Mutex
+
+// unsafeFileNameChars matches the characters that should not be part of a file name
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// GetOutputsDir returns the directory where the test runs store their reports,
+// which is read from the OUTPUTS_DIR environment variable, defaulting to the
+// "outputs" directory of the current suite
+func GetOutputsDir() string {
+	return shell.GetEnv("OUTPUTS_DIR", "outputs")
+}
+
+// GetScenarioOutputsDir returns the directory in the outputs dir where the files
+// for a scenario are stored, creating it if needed
+func GetScenarioOutputsDir(scenario string) (string, error) {
+	scenarioDir := getScenarioOutputsPath(scenario)
+
+	err := os.MkdirAll(scenarioDir, 0755)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":      scenarioDir,
+			"error":    err,
+			"scenario": scenario,
+		}).Error("Could not create the outputs dir for the scenario")
+		return "", err
+	}
+
+	return scenarioDir, nil
+}
+
+// getScenarioOutputsPath returns the path of the dir in the outputs dir where the files for a
+// scenario are stored, named after the scenario
+func getScenarioOutputsPath(scenario string) string {
+	name := strings.Trim(unsafeFileNameChars.ReplaceAllString(scenario, "_"), "_")
+	if name == "" {
+		name = "scenario"
+	}
+
+	return filepath.Join(GetOutputsDir(), name)
+}
+
+// appendToOutputsFile appends a line to a file in the outputs dir, creating it if needed
+func appendToOutputsFile(fileName string, line string) error {
+	outputsMutex.Lock()
+	defer outputsMutex.Unlock()
+
+	outputsDir := GetOutputsDir()
+
+	err := os.MkdirAll(outputsDir, 0755)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"dir":   outputsDir,
+			"error": err,
+		}).Error("Could not create the outputs dir")
+		return err
+	}
+
+	filePath := filepath.Join(outputsDir, fileName)
+
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Error("Could not open the report file")
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(line + "\n")
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Error("Could not write to the report file")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package datagen generates synthetic test data: fake hosts, with their processes, emitting log
+// lines, process events and security events at configurable rates. The data is deterministic,
+// as it is generated from a seed, so the scenarios can assert the exact number of documents
+// expected by dashboards, detections and transforms, without relying on the noise of a real system.
+// The events are fed to an agent writing log files into its container, or indexed directly
+package datagen
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind the kind of the synthetic events
+type Kind string
+
+const (
+	// LogKind log lines of the processes, at info, warning and error levels
+	LogKind Kind = "log"
+	// ProcessKind start and end events of the processes
+	ProcessKind Kind = "process"
+	// SecurityKind authentication events of the users, successful or failed
+	SecurityKind Kind = "security"
+)
+
+// datasetPrefix prefix of the event.dataset field of the synthetic events, followed by their kind
+const datasetPrefix = "datagen."
+
+// bulkSize max number of documents indexed with a single request
+const bulkSize = 1000
+
+// maxResultWindow max number of hits returned by a search, as Elasticsearch limits it by default
+const maxResultWindow = 10000
+
+// processes the fake processes run by the hosts
+var processes = []Process{
+	{Executable: "/usr/sbin/nginx", Name: "nginx"},
+	{Executable: "/usr/sbin/sshd", Name: "sshd"},
+	{Executable: "/usr/bin/java", Name: "java"},
+	{Executable: "/usr/bin/python3", Name: "python3"},
+	{Executable: "/usr/lib/postgresql/12/bin/postgres", Name: "postgres"},
+	{Executable: "/usr/sbin/cron", Name: "cron"},
+	{Executable: "/usr/bin/dockerd", Name: "dockerd"},
+	{Executable: "/usr/sbin/rsyslogd", Name: "rsyslogd"},
+}
+
+// messages the messages of the log lines, by level
+var messages = map[string][]string{
+	"info": {
+		"request completed in %dms",
+		"connection accepted from 10.1.0.%d",
+		"cache refreshed with %d entries",
+		"job %d finished",
+	},
+	"warning": {
+		"request took %dms, over the threshold",
+		"retrying the connection, attempt %d",
+	},
+	"error": {
+		"could not connect to the database after %d attempts",
+		"request failed with status 50%d",
+	},
+}
+
+// osFamilies the operating systems of the hosts
+var osFamilies = []string{"debian", "redhat", "ubuntu", "windows"}
+
+// users the users of the processes and authentications
+var users = []string{"alice", "bob", "carol", "dave", "root"}
+
+// Config configures the generation of the synthetic data
+type Config struct {
+	Duration   time.Duration // the period of time covered by the events. Default 1m
+	ErrorRatio float64       // the ratio of log lines at error level, and of failed authentications, between 0 and 1
+	Hosts      int           // the number of fake hosts. Default 1
+	Processes  int           // the number of processes run by each host. Default 3
+	Rate       int           // the events of each kind emitted per second by each host. Default 1
+	Seed       int64         // the seed of the generation, generating the same data with the same config
+	Start      time.Time     // the time of the first event, defaulting to the duration before now, so that the events are recent
+}
+
+// Host a fake host
+type Host struct {
+	IP        string
+	Name      string
+	OS        string
+	Processes []Process
+}
+
+// Process a fake process run by a host
+type Process struct {
+	Executable string
+	Name       string
+	PID        int
+	User       string
+}
+
+// Generator generates synthetic events of fake hosts
+type Generator struct {
+	cfg   Config
+	hosts []Host
+}
+
+// NewGenerator returns a generator of the synthetic data described by a config, creating its
+// fake hosts from the seed
+func NewGenerator(cfg Config) *Generator {
+	if cfg.Duration <= 0 {
+		cfg.Duration = time.Minute
+	}
+	if cfg.Hosts <= 0 {
+		cfg.Hosts = 1
+	}
+	if cfg.Processes <= 0 {
+		cfg.Processes = 3
+	}
+	if cfg.Processes > len(processes) {
+		cfg.Processes = len(processes)
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 1
+	}
+	cfg.ErrorRatio = math.Max(0, math.Min(1, cfg.ErrorRatio))
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Now().UTC().Add(-cfg.Duration).Truncate(time.Second)
+	}
+
+	random := rand.New(rand.NewSource(cfg.Seed))
+
+	hosts := make([]Host, cfg.Hosts)
+	for i := range hosts {
+		host := Host{
+			IP:   fmt.Sprintf("10.0.%d.%d", i/250, i%250+1),
+			Name: fmt.Sprintf("datagen-host-%02d", i+1),
+			OS:   osFamilies[random.Intn(len(osFamilies))],
+		}
+
+		for _, p := range random.Perm(len(processes))[:cfg.Processes] {
+			process := processes[p]
+			process.PID = 1000 + random.Intn(31000)
+			process.User = users[random.Intn(len(users))]
+			host.Processes = append(host.Processes, process)
+		}
+
+		hosts[i] = host
+	}
+
+	return &Generator{
+		cfg:   cfg,
+		hosts: hosts,
+	}
+}
+
+// ParseKind returns the kind of the synthetic events with a name, i.e. log
+func ParseKind(name string) (Kind, error) {
+	switch kind := Kind(strings.ToLower(name)); kind {
+	case LogKind, ProcessKind, SecurityKind:
+		return kind, nil
+	}
+
+	return "", fmt.Errorf("%s is not a kind of synthetic events. Supported: %s, %s, %s", name, LogKind, ProcessKind, SecurityKind)
+}
+
+// Config returns the config of the generator, with the defaults applied
+func (g *Generator) Config() Config {
+	return g.cfg
+}
+
+// Count returns the number of events of each kind generated, which is the same for all of them
+func (g *Generator) Count() int {
+	return g.cfg.Hosts * g.cfg.Rate * int(math.Ceil(g.cfg.Duration.Seconds()))
+}
+
+// Errors returns the number of log lines at error level, and of failed authentications, generated
+func (g *Generator) Errors() int {
+	return int(math.Floor(float64(g.Count()) * g.cfg.ErrorRatio))
+}
+
+// Hosts returns the fake hosts emitting the events
+func (g *Generator) Hosts() []Host {
+	return g.hosts
+}
+
+// Events returns the synthetic events of a kind, as ECS documents. The events of each kind are
+// generated from their own source of randomness, so they do not depend on the other kinds
+func (g *Generator) Events(kind Kind) ([]map[string]interface{}, error) {
+	kind, err := ParseKind(string(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(kind))
+	random := rand.New(rand.NewSource(g.cfg.Seed ^ int64(hash.Sum64())))
+
+	count := g.Count()
+	interval := time.Second / time.Duration(g.cfg.Rate)
+
+	events := make([]map[string]interface{}, count)
+	for i := 0; i < count; i++ {
+		host := g.hosts[i%len(g.hosts)]
+		process := host.Processes[random.Intn(len(host.Processes))]
+		timestamp := g.cfg.Start.Add(time.Duration(i/len(g.hosts)) * interval)
+
+		event := map[string]interface{}{
+			"@timestamp": timestamp.Format(time.RFC3339Nano),
+			"event": map[string]interface{}{
+				"dataset": datasetPrefix + string(kind),
+				"kind":    "event",
+			},
+			"host": map[string]interface{}{
+				"hostname": host.Name,
+				"ip":       host.IP,
+				"name":     host.Name,
+				"os": map[string]interface{}{
+					"family": host.OS,
+				},
+			},
+			"labels": map[string]interface{}{
+				"datagen_seed": fmt.Sprintf("%d", g.cfg.Seed),
+				"run_id":       config.GetRunID(),
+			},
+			"process": map[string]interface{}{
+				"executable": process.Executable,
+				"name":       process.Name,
+				"pid":        process.PID,
+			},
+		}
+
+		switch kind {
+		case LogKind:
+			level := "error"
+			if !g.isError(i) {
+				level = []string{"info", "info", "info", "warning"}[random.Intn(4)]
+			}
+			templates := messages[level]
+			message := fmt.Sprintf(templates[random.Intn(len(templates))], 1+random.Intn(9))
+
+			event["log"] = map[string]interface{}{
+				"level": level,
+			}
+			event["message"] = fmt.Sprintf("%s %s %s[%d]: %s", timestamp.Format(time.RFC3339), strings.ToUpper(level), process.Name, process.PID, message)
+		case ProcessKind:
+			eventType := "start"
+			if i%2 == 1 {
+				eventType = "end"
+			}
+
+			event["event"].(map[string]interface{})["category"] = "process"
+			event["event"].(map[string]interface{})["type"] = eventType
+			event["process"].(map[string]interface{})["args"] = []string{process.Executable}
+			event["user"] = map[string]interface{}{
+				"name": process.User,
+			}
+		case SecurityKind:
+			outcome := "success"
+			if g.isError(i) {
+				outcome = "failure"
+			}
+
+			event["event"].(map[string]interface{})["action"] = "logon"
+			event["event"].(map[string]interface{})["category"] = "authentication"
+			event["event"].(map[string]interface{})["outcome"] = outcome
+			event["source"] = map[string]interface{}{
+				"ip": fmt.Sprintf("192.168.%d.%d", random.Intn(4), 1+random.Intn(254)),
+			}
+			event["user"] = map[string]interface{}{
+				"name": users[random.Intn(len(users))],
+			}
+		}
+
+		events[i] = event
+	}
+
+	return events, nil
+}
+
+// LogLines returns the messages of the synthetic log events, to be harvested by an agent
+func (g *Generator) LogLines() []string {
+	events, _ := g.Events(LogKind)
+
+	lines := make([]string, len(events))
+	for i, event := range events {
+		lines[i] = event["message"].(string)
+	}
+
+	return lines
+}
+
+// Index indexes the synthetic events of a kind into an index, or data stream, of the
+// Elasticsearch of the suite, using the bulk API
+func (g *Generator) Index(ctx context.Context, kind Kind, index string) error {
+	events, err := g.Events(kind)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(events); start += bulkSize {
+		end := start + bulkSize
+		if end > len(events) {
+			end = len(events)
+		}
+
+		err := e2e.BulkIndex(ctx, index, events[start:end])
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"index": index,
+				"kind":  kind,
+			}).Error("Could not index the synthetic events")
+			return err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"events": len(events),
+		"index":  index,
+		"kind":   kind,
+		"seed":   g.cfg.Seed,
+	}).Info("Synthetic events indexed")
+
+	return nil
+}
+
+// Query returns the Elasticsearch query matching the synthetic events of a kind generated by
+// this run with the seed of the generator, requesting all of them, up to the result window
+func (g *Generator) Query(kind Kind) map[string]interface{} {
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{
+						"term": map[string]interface{}{"event.dataset": datasetPrefix + string(kind)},
+					},
+					map[string]interface{}{
+						"term": map[string]interface{}{"labels.datagen_seed": fmt.Sprintf("%d", g.cfg.Seed)},
+					},
+					map[string]interface{}{
+						"term": map[string]interface{}{"labels.run_id": config.GetRunID()},
+					},
+				},
+			},
+		},
+		"size": g.searchableCount(),
+	}
+}
+
+// WriteLogFile writes the synthetic log lines into a file of a container, i.e. a log file
+// harvested by the agent running in it
+func (g *Generator) WriteLogFile(ctx context.Context, container string, filePath string) error {
+	content := strings.Join(g.LogLines(), "\n") + "\n"
+
+	err := docker.CopyToContainer(ctx, container, filePath, []byte(content))
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"container": container,
+		"file":      filePath,
+		"lines":     g.Count(),
+		"seed":      g.cfg.Seed,
+	}).Info("Synthetic log lines written")
+
+	return nil
+}
+
+// searchableCount returns the number of events of each kind returned by a search, which is
+// limited by the result window of Elasticsearch
+func (g *Generator) searchableCount() int {
+	if count := g.Count(); count < maxResultWindow {
+		return count
+	}
+
+	return maxResultWindow
+}
+
+// isError returns if an event is an error, spreading the errors evenly over the events, so that
+// their number is exactly the ratio of the events
+func (g *Generator) isError(i int) bool {
+	ratio := g.cfg.ErrorRatio
+
+	return math.Floor(float64(i+1)*ratio) > math.Floor(float64(i)*ratio)
+}
@@ -0,0 +1,168 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package datagen
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+var testStart = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func testConfig(seed int64) Config {
+	return Config{
+		Duration:   10 * time.Second,
+		ErrorRatio: 0.25,
+		Hosts:      2,
+		Processes:  3,
+		Rate:       2,
+		Seed:       seed,
+		Start:      testStart,
+	}
+}
+
+func TestNewGeneratorDefaults(t *testing.T) {
+	g := NewGenerator(Config{Seed: 1, ErrorRatio: 2, Processes: 100})
+
+	cfg := g.Config()
+	assert.Equal(t, time.Minute, cfg.Duration)
+	assert.Equal(t, 1, cfg.Hosts)
+	assert.Equal(t, len(processes), cfg.Processes)
+	assert.Equal(t, 1, cfg.Rate)
+	assert.Equal(t, 1.0, cfg.ErrorRatio)
+	assert.False(t, cfg.Start.IsZero())
+	assert.Equal(t, 60, g.Count())
+}
+
+func TestSameSeedGeneratesTheSameData(t *testing.T) {
+	first := NewGenerator(testConfig(42))
+	second := NewGenerator(testConfig(42))
+
+	assert.Equal(t, first.Hosts(), second.Hosts())
+
+	for _, kind := range []Kind{LogKind, ProcessKind, SecurityKind} {
+		firstEvents, err := first.Events(kind)
+		assert.Nil(t, err)
+
+		// the events of a kind do not depend on the events of the other kinds generated before
+		if kind != LogKind {
+			_, _ = second.Events(LogKind)
+		}
+
+		secondEvents, err := second.Events(kind)
+		assert.Nil(t, err)
+
+		assert.Equal(t, firstEvents, secondEvents, kind)
+	}
+
+	assert.Equal(t, first.LogLines(), second.LogLines())
+}
+
+func TestDifferentSeedsGenerateDifferentData(t *testing.T) {
+	first, err := NewGenerator(testConfig(42)).Events(SecurityKind)
+	assert.Nil(t, err)
+
+	second, err := NewGenerator(testConfig(43)).Events(SecurityKind)
+	assert.Nil(t, err)
+
+	assert.Equal(t, len(first), len(second))
+	assert.NotEqual(t, first, second)
+}
+
+func TestEvents(t *testing.T) {
+	g := NewGenerator(testConfig(42))
+	assert.Equal(t, 40, g.Count())
+	assert.Equal(t, 10, g.Errors())
+
+	tests := []struct {
+		kind   Kind
+		errors func(event map[string]interface{}) bool
+	}{
+		{LogKind, func(event map[string]interface{}) bool {
+			return event["log"].(map[string]interface{})["level"] == "error"
+		}},
+		{ProcessKind, func(event map[string]interface{}) bool { return false }},
+		{SecurityKind, func(event map[string]interface{}) bool {
+			return event["event"].(map[string]interface{})["outcome"] == "failure"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			events, err := g.Events(tt.kind)
+			assert.Nil(t, err)
+			assert.Equal(t, g.Count(), len(events))
+
+			errors := 0
+			for _, event := range events {
+				assert.Equal(t, datasetPrefix+string(tt.kind), event["event"].(map[string]interface{})["dataset"])
+
+				// the filters of the query of the events of the run
+				labels := event["labels"].(map[string]interface{})
+				assert.Equal(t, "42", labels["datagen_seed"])
+				assert.Equal(t, config.GetRunID(), labels["run_id"])
+
+				if tt.errors(event) {
+					errors++
+				}
+			}
+
+			if tt.kind != ProcessKind {
+				assert.Equal(t, g.Errors(), errors)
+			}
+
+			// the events of all the hosts are spread over the duration, at the rate
+			assert.Equal(t, testStart.Format(time.RFC3339Nano), events[0]["@timestamp"])
+			assert.Equal(t, testStart.Format(time.RFC3339Nano), events[1]["@timestamp"])
+			assert.Equal(t, testStart.Add(9500*time.Millisecond).Format(time.RFC3339Nano), events[len(events)-1]["@timestamp"])
+		})
+	}
+}
+
+func TestEventsOfAnUnknownKind(t *testing.T) {
+	_, err := NewGenerator(testConfig(42)).Events(Kind("metric"))
+	assert.NotNil(t, err)
+}
+
+func TestParseKind(t *testing.T) {
+	kind, err := ParseKind("Security")
+	assert.Nil(t, err)
+	assert.Equal(t, SecurityKind, kind)
+
+	_, err = ParseKind("metric")
+	assert.NotNil(t, err)
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		size int
+		seed string
+	}{
+		{"all the events", testConfig(42), 40, "42"},
+		{"capped to the result window", Config{Duration: time.Hour, Hosts: 10, Rate: 1, Seed: -7}, maxResultWindow, "-7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(NewGenerator(tt.cfg).Query(SecurityKind))
+			assert.Nil(t, err)
+			assert.JSONEq(t, fmt.Sprintf(`{
+				"query": {"bool": {"filter": [
+					{"term": {"event.dataset": "datagen.security"}},
+					{"term": {"labels.datagen_seed": "%s"}},
+					{"term": {"labels.run_id": "%s"}}
+				]}},
+				"size": %d
+			}`, tt.seed, config.GetRunID(), tt.size), string(body))
+		})
+	}
+}
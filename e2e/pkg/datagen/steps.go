@@ -0,0 +1,159 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package datagen
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultTimeoutFactor multiplier of the minutes the steps wait for the events to be searchable,
+// which can be overriden by TIMEOUT_FACTOR env var, as the suites do
+const defaultTimeoutFactor = 3
+
+// Steps holds the generator of the synthetic data for the running scenario
+type Steps struct {
+	cfg       Config // the config the scenarios start with
+	generator *Generator
+	mutex     sync.Mutex
+	profile   string // the docker-compose profile where the services run
+	timeout   time.Duration
+}
+
+// RegisterSteps adds the steps generating synthetic data to the suite, for the services of a
+// docker-compose profile, and a hook resetting the generator to the config at the beginning
+// of each scenario
+func RegisterSteps(s *godog.ScenarioContext, profile string, cfg Config) *Steps {
+	steps := &Steps{
+		cfg:       cfg,
+		generator: NewGenerator(cfg),
+		profile:   profile,
+		timeout:   time.Duration(shell.GetEnvInteger("TIMEOUT_FACTOR", defaultTimeoutFactor)) * time.Minute,
+	}
+
+	e2e.Step(s, `^"(\d+)" hosts emit "(\d+)" synthetic events per second for "([^"]*)"$`, steps.HostsEmitEvents)
+	e2e.Step(s, `^"([^"]*)" of the synthetic events are errors$`, steps.EventsAreErrors)
+	e2e.Step(s, `^the synthetic "([^"]*)" events are indexed into the "([^"]*)" index$`, steps.EventsAreIndexed)
+	e2e.Step(s, `^the synthetic log lines are written to "([^"]*)" in the "([^"]*)" service$`, steps.LogLinesAreWritten)
+	e2e.Step(s, `^all the synthetic "([^"]*)" events are in the "([^"]*)" index$`, steps.AllEventsAreInTheIndex)
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		steps.mutex.Lock()
+		defer steps.mutex.Unlock()
+
+		steps.generator = NewGenerator(steps.cfg)
+		return ctx, nil
+	})
+
+	return steps
+}
+
+// Generator returns the generator of the synthetic data of the running scenario
+func (st *Steps) Generator() *Generator {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	return st.generator
+}
+
+// HostsEmitEvents configures the number of hosts, the rate of the events and the period of time
+// they cover, i.e. 30s
+func (st *Steps) HostsEmitEvents(hosts string, rate string, duration string) error {
+	cfg := st.Generator().Config()
+
+	var err error
+	if cfg.Hosts, err = strconv.Atoi(hosts); err != nil {
+		return err
+	}
+	if cfg.Rate, err = strconv.Atoi(rate); err != nil {
+		return err
+	}
+	if cfg.Duration, err = time.ParseDuration(duration); err != nil {
+		return err
+	}
+	// the events cover the period before now, as in a new generator
+	cfg.Start = time.Time{}
+
+	st.setGenerator(cfg)
+	return nil
+}
+
+// EventsAreErrors configures the percentage of log lines at error level and of failed
+// authentications, i.e. 10%
+func (st *Steps) EventsAreErrors(percentage string) error {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(percentage, "%"), 64)
+	if err != nil {
+		return err
+	}
+
+	cfg := st.Generator().Config()
+	cfg.ErrorRatio = value / 100
+
+	st.setGenerator(cfg)
+	return nil
+}
+
+// EventsAreIndexed indexes the synthetic events of a kind into an index, or data stream
+func (st *Steps) EventsAreIndexed(kindName string, index string) error {
+	kind, err := ParseKind(kindName)
+	if err != nil {
+		return err
+	}
+
+	return st.Generator().Index(context.Background(), kind, index)
+}
+
+// LogLinesAreWritten writes the synthetic log lines into a file of the container of a service,
+// so that they are harvested by the agent running in it
+func (st *Steps) LogLinesAreWritten(filePath string, service string) error {
+	container, err := docker.GetComposeServiceContainer(config.GetComposeProjectName(st.profile), service)
+	if err != nil {
+		return err
+	}
+
+	return st.Generator().WriteLogFile(context.Background(), strings.TrimPrefix(container.Names[0], "/"), filePath)
+}
+
+// AllEventsAreInTheIndex waits for all the synthetic events of a kind to be searchable in an index,
+// up to the result window of Elasticsearch
+func (st *Steps) AllEventsAreInTheIndex(kindName string, index string) error {
+	kind, err := ParseKind(kindName)
+	if err != nil {
+		return err
+	}
+
+	generator := st.Generator()
+
+	_, err = e2e.WaitForNumberOfHits(index, generator.Query(kind), generator.searchableCount(), st.timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"events": generator.Count(),
+			"index":  index,
+			"kind":   kind,
+		}).Error("The synthetic events are not in the index")
+		return err
+	}
+
+	return nil
+}
+
+// setGenerator replaces the generator of the running scenario with one for a config
+func (st *Steps) setGenerator(cfg Config) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.generator = NewGenerator(cfg)
+}
@@ -0,0 +1,85 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bundle a group of shared steps a suite opts into, so that the features of the suites use the
+// same wording for the same steps
+type Bundle string
+
+const (
+	// ServicesBundle the steps starting, stopping and restarting the services of the profile, and
+	// waiting for the state of their processes
+	ServicesBundle Bundle = "services"
+	// FilesBundle the steps creating, appending lines to, truncating, rotating and removing files
+	// in the services of the profile
+	FilesBundle Bundle = "files"
+	// WaitsBundle the steps waiting for some time, or for the stack to be healthy
+	WaitsBundle Bundle = "waits"
+	// StackUpgradesBundle the steps upgrading the stack in place
+	StackUpgradesBundle Bundle = "stack-upgrades"
+	// ElasticsearchBundle the assertions on the documents in the indices of Elasticsearch, including
+	// the events of the lines appended with the steps of the files bundle
+	ElasticsearchBundle Bundle = "elasticsearch"
+	// FleetBundle the operations and assertions on the integrations, the data streams and the agents
+	// of Fleet
+	FleetBundle Bundle = "fleet"
+)
+
+// AllBundles the bundles of shared steps, in the order they are registered
+var AllBundles = []Bundle{
+	ServicesBundle,
+	FilesBundle,
+	WaitsBundle,
+	StackUpgradesBundle,
+	ElasticsearchBundle,
+	FleetBundle,
+}
+
+// register adds the steps of a bundle to a scenario
+func (b Bundle) register(s *godog.ScenarioContext, steps *Steps) {
+	switch b {
+	case ServicesBundle:
+		e2e.Step(s, `^the "([^"]*)" service is started$`, steps.ServiceIsStarted)
+		e2e.Step(s, `^the "([^"]*)" (?:service|docker container) is stopped$`, steps.ServiceIsStopped)
+		e2e.Step(s, `^the "([^"]*)" service is restarted$`, steps.ServiceIsRestarted)
+		e2e.Step(s, `^the "([^"]*)" process is in the "([^"]*)" state in the "([^"]*)" service$`, steps.ProcessIsInStateInService)
+	case FilesBundle:
+		e2e.Step(s, `^the "([^"]*)" file is created in the "([^"]*)" service$`, steps.FileIsCreatedInService)
+		e2e.Step(s, `^"(\d+)" lines are appended to the "([^"]*)" file in the "([^"]*)" service$`, steps.LinesAreAppendedToFileInService)
+		e2e.Step(s, `^the "([^"]*)" file is truncated in the "([^"]*)" service$`, steps.FileIsTruncatedInService)
+		e2e.Step(s, `^the "([^"]*)" file is rotated in the "([^"]*)" service$`, steps.FileIsRotatedInService)
+		e2e.Step(s, `^the "([^"]*)" file is removed from the "([^"]*)" service$`, steps.FileIsRemovedFromService)
+	case WaitsBundle:
+		e2e.Step(s, `^"([^"]*)" seconds have passed$`, e2e.Sleep)
+		e2e.Step(s, `^Elasticsearch is healthy$`, steps.ElasticsearchIsHealthy)
+		e2e.Step(s, `^Kibana is healthy$`, steps.KibanaIsHealthy)
+	case StackUpgradesBundle:
+		e2e.Step(s, `^the stack is upgraded to "([^"]*)"$`, steps.StackIsUpgradedTo)
+		e2e.Step(s, `^there is new data in the "([^"]*)" index after the stack is upgraded$`, steps.ThereIsNewDataInTheIndexAfterTheStackIsUpgraded)
+	case ElasticsearchBundle:
+		e2e.Step(s, `^there is new data in the "([^"]*)" index$`, steps.ThereIsNewDataInTheIndex)
+		e2e.Step(s, `^there are at least "(\d+)" documents in the "([^"]*)" index$`, steps.ThereAreAtLeastDocumentsInTheIndex)
+		e2e.Step(s, `^there is no new data in the "([^"]*)" index after the "([^"]*)" service is stopped$`, steps.ThereIsNoNewDataInTheIndexAfterServiceIsStopped)
+		e2e.Step(s, `^there are no errors in the "([^"]*)" index$`, steps.ThereAreNoErrorsInTheIndex)
+		e2e.Step(s, `^the appended lines are indexed in the "([^"]*)" index$`, steps.AppendedLinesAreIndexed)
+		e2e.Step(s, `^"(\d+)" events of the appended lines are indexed in the "([^"]*)" index$`, steps.EventsOfTheAppendedLinesAreIndexed)
+	case FleetBundle:
+		e2e.Step(s, `^the "([^"]*)" integration is installed in Fleet$`, steps.IntegrationIsInstalledInFleet)
+		e2e.Step(s, `^the "([^"]*)" integration (dashboards|index templates|ingest pipelines) are installed$`, steps.IntegrationAssetsAreInstalled)
+		e2e.Step(s, `^data streams are listed in Fleet$`, steps.DataStreamsAreListedInFleet)
+		e2e.Step(s, `^there are "(\d+)" "([^"]*)" agents in the "([^"]*)" policy$`, steps.ThereAreAgentsInPolicy)
+	default:
+		log.WithFields(log.Fields{
+			"bundle":  b,
+			"bundles": AllBundles,
+		}).Fatal("The bundle of shared steps does not exist")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// noNewDataTimeout the time waiting for documents that should not be sent anymore
+const noNewDataTimeout = 30 * time.Second
+
+// ThereIsNewDataInTheIndex waits for documents in an index sent since the scenario started
+func (st *Steps) ThereIsNewDataInTheIndex(index string) error {
+	return st.ThereAreAtLeastDocumentsInTheIndex(1, index)
+}
+
+// ThereAreAtLeastDocumentsInTheIndex waits for a number of documents in an index sent since the
+// scenario started
+func (st *Steps) ThereAreAtLeastDocumentsInTheIndex(count int, index string) error {
+	st.mutex.Lock()
+	startedAt := st.startedAt
+	st.mutex.Unlock()
+
+	result, err := e2e.WaitForNumberOfHits(index, getDocumentsSinceQuery(startedAt, count), count, e2e.GetWaitTimeout(e2e.DataInIndexTimeout, st.opts.Timeout))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"index": index,
+		}).Warn(e2e.WaitForIndices())
+		return err
+	}
+
+	return e2e.AssertHitsArePresent(result)
+}
+
+// ThereIsNoNewDataInTheIndexAfterServiceIsStopped checks that there are no documents in an index
+// sent after a service was stopped in the scenario
+func (st *Steps) ThereIsNoNewDataInTheIndexAfterServiceIsStopped(index string, service string) error {
+	stoppedAt := st.StoppedAt(service)
+	if stoppedAt.IsZero() {
+		return fmt.Errorf("The %s service was not stopped in the scenario", service)
+	}
+
+	result, err := e2e.WaitForNumberOfHits(index, getDocumentsSinceQuery(stoppedAt, 1), 1, noNewDataTimeout)
+	if err != nil {
+		if errors.Is(err, elasticsearch.ErrIndexNotFound) {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"error":   err,
+			"index":   index,
+			"service": service,
+		}).Info("No documents were found in the index after the service stopped")
+		return nil
+	}
+
+	return e2e.AssertHitsAreNotPresent(result)
+}
+
+// ThereIsNewDataInTheIndexAfterTheStackIsUpgraded waits for documents in an index sent since the
+// stack was upgraded in the scenario, i.e. by the agents reconnecting to it
+func (st *Steps) ThereIsNewDataInTheIndexAfterTheStackIsUpgraded(index string) error {
+	upgradedAt := st.UpgradedAt()
+	if upgradedAt.IsZero() {
+		return errors.New("The stack was not upgraded in the scenario")
+	}
+
+	result, err := e2e.WaitForNumberOfHits(index, getDocumentsSinceQuery(upgradedAt, 1), 1, e2e.GetWaitTimeout(e2e.DataInIndexTimeout, st.opts.Timeout))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":      err,
+			"index":      index,
+			"upgradedAt": upgradedAt,
+		}).Warn("No documents were found in the index after the stack was upgraded")
+		return err
+	}
+
+	return e2e.AssertHitsArePresent(result)
+}
+
+// ThereAreNoErrorsInTheIndex checks that the documents in an index sent since the scenario
+// started do not contain errors
+func (st *Steps) ThereAreNoErrorsInTheIndex(index string) error {
+	st.mutex.Lock()
+	startedAt := st.startedAt
+	st.mutex.Unlock()
+
+	result, err := e2e.WaitForNumberOfHits(index, getDocumentsSinceQuery(startedAt, 500), 1, e2e.GetWaitTimeout(e2e.DataInIndexTimeout, st.opts.Timeout))
+	if err != nil {
+		return err
+	}
+
+	return e2e.AssertHitsDoNotContainErrors(result, e2e.ElasticsearchQuery{IndexName: index})
+}
+
+// getDocumentsSinceQuery returns the query of the documents with a timestamp after a date
+func getDocumentsSinceQuery(date time.Time, size int) map[string]interface{} {
+	return map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{
+					{
+						"range": map[string]interface{}{
+							"@timestamp": map[string]interface{}{
+								"gte":    date,
+								"format": "strict_date_optional_time",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/elasticsearch"
+	log "github.com/sirupsen/logrus"
+)
+
+// messageField the field of the events with the lines read from the log files
+const messageField = "message"
+
+// FileIsCreatedInService creates an empty file in the container of a service, with its parent dirs,
+// so that the inputs harvesting the files of a dir find it. An existing file is kept
+func (st *Steps) FileIsCreatedInService(file string, service string) error {
+	script := fmt.Sprintf("mkdir -p %s && touch %s", shellQuote(path.Dir(file)), shellQuote(file))
+
+	return st.runInService(service, file, "create", script)
+}
+
+// LinesAreAppendedToFileInService appends a number of lines to a file in the container of a service,
+// creating it if it does not exist. The lines carry a marker of the scenario and their number in
+// it, so that the events read from them are told apart from the rest of the events of the index
+func (st *Steps) LinesAreAppendedToFileInService(count int, file string, service string) error {
+	st.mutex.Lock()
+	first := st.appendedLines + 1
+	marker := st.linesMarker
+	st.mutex.Unlock()
+
+	last := first + count - 1
+
+	// the lines are written by the shell of the container, as they could be too many for a command line
+	script := fmt.Sprintf(`mkdir -p %s && i=%d && while [ "$i" -le %d ]; do echo "%s line $i"; i=$((i+1)); done >> %s`,
+		shellQuote(path.Dir(file)), first, last, marker, shellQuote(file))
+
+	err := st.runInService(service, file, "append to", script)
+	if err != nil {
+		return err
+	}
+
+	st.mutex.Lock()
+	st.appendedLines = last
+	st.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"file":    file,
+		"lines":   count,
+		"marker":  marker,
+		"service": service,
+	}).Debug("Lines appended to the file")
+
+	return nil
+}
+
+// FileIsTruncatedInService truncates a file in the container of a service, keeping its inode, as
+// the tools rotating the files with copytruncate do
+func (st *Steps) FileIsTruncatedInService(file string, service string) error {
+	return st.runInService(service, file, "truncate", fmt.Sprintf(": > %s", shellQuote(file)))
+}
+
+// FileIsRotatedInService rotates a file in the container of a service, as logrotate does: the
+// rotated files are renamed with the next number, i.e. test.log.1 to test.log.2, the file is renamed
+// to test.log.1, and an empty file is created in its place, with another inode
+func (st *Steps) FileIsRotatedInService(file string, service string) error {
+	script := fmt.Sprintf(`f=%s && i=1 && while [ -e "$f.$i" ]; do i=$((i+1)); done && `+
+		`while [ "$i" -gt 1 ]; do mv "$f.$((i-1))" "$f.$i"; i=$((i-1)); done && mv "$f" "$f.1" && : > "$f"`, shellQuote(file))
+
+	return st.runInService(service, file, "rotate", script)
+}
+
+// FileIsRemovedFromService removes a file from the container of a service, doing nothing if it does
+// not exist
+func (st *Steps) FileIsRemovedFromService(file string, service string) error {
+	return st.runInService(service, file, "remove", fmt.Sprintf("rm -f %s", shellQuote(file)))
+}
+
+// AppendedLinesAreIndexed waits for an event in an index for each line appended to the files of
+// the services in the scenario, failing if there are more, i.e. when a rotated file is read again
+func (st *Steps) AppendedLinesAreIndexed(index string) error {
+	st.mutex.Lock()
+	count := st.appendedLines
+	st.mutex.Unlock()
+
+	if count == 0 {
+		return errors.New("No lines were appended to the files of the services in the scenario")
+	}
+
+	return st.EventsOfTheAppendedLinesAreIndexed(count, index)
+}
+
+// EventsOfTheAppendedLinesAreIndexed waits for a number of events in an index read from the lines
+// appended to the files of the services in the scenario, failing if there are more, i.e. when the
+// lines of a rotated file are read again
+func (st *Steps) EventsOfTheAppendedLinesAreIndexed(count int, index string) error {
+	st.mutex.Lock()
+	marker := st.linesMarker
+	st.mutex.Unlock()
+
+	query := elasticsearch.NewQuery().WithPhrase(messageField, marker).WithSize(count)
+
+	result, err := e2e.WaitForHits(index, query, count, e2e.GetWaitTimeout(e2e.DataInIndexTimeout, st.opts.Timeout))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"events": count,
+			"index":  index,
+			"marker": marker,
+		}).Error("The events of the appended lines were not indexed")
+		return err
+	}
+
+	if result.Hits.Total.Value > count {
+		return fmt.Errorf("There are %d events of the appended lines in the %s index, instead of %d: some lines were read twice", result.Hits.Total.Value, index, count)
+	}
+
+	return nil
+}
+
+// runInService runs a shell script operating on a file in the container of a service, failing if it
+// exits abnormally
+func (st *Steps) runInService(service string, file string, operation string, script string) error {
+	result, err := st.serviceManager.ExecCommandInService(st.opts.Profile, service, []string{"sh", "-c", script})
+	if err == nil && result.ExitCode != 0 {
+		err = fmt.Errorf("The script exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"file":    file,
+			"profile": st.opts.Profile,
+			"service": service,
+		}).Errorf("Could not %s the file in the service", operation)
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"file":      file,
+		"operation": operation,
+		"profile":   st.opts.Profile,
+		"service":   service,
+	}).Trace("The file has been operated in the service")
+
+	return nil
+}
+
+// newLinesMarker returns a marker of the lines appended in a scenario, unique in the run
+func newLinesMarker() string {
+	return "e2e-lines-" + strings.ToLower(e2e.RandomString(12))
+}
+
+// shellQuote quotes an arg for a POSIX shell
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,236 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"context"
+	"fmt"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// integrationAssetTypes the types of the assets of the integrations, by their name in the steps
+var integrationAssetTypes = map[string]string{
+	"dashboards":       kibana.AssetTypeDashboard,
+	"index templates":  kibana.AssetTypeIndexTemplate,
+	"ingest pipelines": kibana.AssetTypeIngestPipeline,
+}
+
+// IntegrationIsInstalledInFleet installs the assets of the latest version of an integration,
+// looked up by its title in the Package Registry, i.e. "Linux" or "Endpoint Security"
+func (st *Steps) IntegrationIsInstalledInFleet(title string) error {
+	integration, err := st.fleetClient.GetPackageByTitle(title)
+	if err != nil {
+		return err
+	}
+
+	_, err = st.fleetClient.InstallPackage(integration.Name, integration.Version)
+	return err
+}
+
+// IntegrationAssetsAreInstalled waits for the assets of a type of the latest version of an
+// integration, looked up by its title in the Package Registry, to exist where Fleet installed them:
+// the dashboards as saved objects of Kibana, and the index templates and the ingest pipelines in
+// Elasticsearch. The integration must have assets of the type
+func (st *Steps) IntegrationAssetsAreInstalled(title string, assets string) error {
+	assetType, supported := integrationAssetTypes[assets]
+	if !supported {
+		return fmt.Errorf("the %s assets are not supported: use dashboards, index templates or ingest pipelines", assets)
+	}
+
+	integration, err := st.fleetClient.GetPackageByTitle(title)
+	if err != nil {
+		return err
+	}
+
+	exp := e2e.GetExponentialBackOff(st.opts.Timeout)
+	retryCount := 1
+
+	assetsInstalledFn := func() error {
+		missing, err := st.getMissingAssets(integration, assetType)
+		if err == nil && len(missing) > 0 {
+			err = fmt.Errorf("the %s of the %s integration are not installed: %v", assets, title, missing)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"integration": title,
+				"retry":       retryCount,
+				"version":     integration.Version,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"assets":      assets,
+			"elapsedTime": exp.GetElapsedTime(),
+			"integration": title,
+			"retries":     retryCount,
+			"version":     integration.Version,
+		}).Info("The assets of the integration are installed")
+
+		return nil
+	}
+
+	return backoff.Retry(assetsInstalledFn, exp)
+}
+
+// DataStreamsAreListedInFleet waits for Fleet to list at least one data stream
+func (st *Steps) DataStreamsAreListedInFleet() error {
+	exp := e2e.GetExponentialBackOff(st.opts.Timeout)
+	retryCount := 1
+
+	countDataStreamsFn := func() error {
+		count, err := st.getDataStreamsCount()
+		if err == nil && count == 0 {
+			err = fmt.Errorf("There are no datastreams yet")
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"retry":       retryCount,
+			}).Warn(err.Error())
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"datastreams": count,
+			"elapsedTime": exp.GetElapsedTime(),
+			"retries":     retryCount,
+		}).Info("Datastreams are present")
+
+		return nil
+	}
+
+	return backoff.Retry(countDataStreamsFn, exp)
+}
+
+// ThereAreAgentsInPolicy waits for Fleet to list a number of agents with a status, i.e. online, in
+// a policy, looked up by its name, i.e. "Default policy"
+func (st *Steps) ThereAreAgentsInPolicy(count int, status string, policyName string) error {
+	policy, err := st.fleetClient.GetAgentPolicyByName(policyName)
+	if err != nil {
+		return err
+	}
+
+	query := kibana.AgentsQuery{
+		Kuery: kibana.KueryAnd(kibana.AgentsByPolicy(policy.ID), kibana.AgentsByStatus(status)),
+	}
+
+	exp := e2e.GetExponentialBackOff(st.opts.Timeout)
+	retryCount := 1
+
+	countAgentsFn := func() error {
+		total, err := st.fleetClient.CountAgents(query)
+		if err == nil && total != count {
+			err = fmt.Errorf("there are %d %s agents in the %s policy, but %d were expected", total, status, policyName, count)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"retry":       retryCount,
+			}).Warn("The agents in the policy do not match yet")
+
+			retryCount++
+
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"agents":      total,
+			"elapsedTime": exp.GetElapsedTime(),
+			"policy":      policyName,
+			"retries":     retryCount,
+			"status":      status,
+		}).Info("The agents in the policy match")
+
+		return nil
+	}
+
+	return backoff.Retry(countAgentsFn, exp)
+}
+
+// getMissingAssets returns the IDs of the assets of a type installed by Fleet for an integration
+// which do not exist in Kibana or in Elasticsearch. It fails permanently if the integration has no
+// assets of the type
+func (st *Steps) getMissingAssets(integration kibana.Package, assetType string) ([]string, error) {
+	installed, err := st.fleetClient.GetInstalledAssets(integration.Name, integration.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := []kibana.Asset{}
+	for _, asset := range installed {
+		if asset.Type == assetType {
+			assets = append(assets, asset)
+		}
+	}
+
+	if len(assets) == 0 {
+		return nil, backoff.Permanent(fmt.Errorf("the %s integration in version %s has no assets of the %s type", integration.Title, integration.Version, assetType))
+	}
+
+	missing := []string{}
+
+	if assetType == kibana.AssetTypeDashboard {
+		savedObjects, err := st.fleetClient.BulkGetSavedObjects(assets)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, savedObject := range savedObjects {
+			if savedObject.Error != nil {
+				missing = append(missing, savedObject.ID)
+			}
+		}
+
+		return missing, nil
+	}
+
+	esClient, err := e2e.GetElasticsearchClient()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, asset := range assets {
+		exists := esClient.ExistsIndexTemplate
+		if assetType == kibana.AssetTypeIngestPipeline {
+			exists = esClient.ExistsIngestPipeline
+		}
+
+		found, err := exists(context.Background(), asset.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			missing = append(missing, asset.ID)
+		}
+	}
+
+	return missing, nil
+}
+
+// getDataStreamsCount returns the number of data streams listed in Fleet
+func (st *Steps) getDataStreamsCount() (int, error) {
+	dataStreams, err := st.fleetClient.ListDataStreams()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(dataStreams), nil
+}
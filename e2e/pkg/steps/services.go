@@ -0,0 +1,100 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/e2e"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServiceIsStarted adds a service to the docker-compose profile, starting it
+func (st *Steps) ServiceIsStarted(service string) error {
+	err := st.serviceManager.AddServicesToCompose(st.opts.Profile, []string{service}, st.opts.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": st.opts.Profile,
+			"service": service,
+		}).Error("Could not start the service")
+		return err
+	}
+
+	return nil
+}
+
+// ServiceIsStopped removes a service from the docker-compose profile, recording the time it
+// was stopped at, so that the documents sent after it can be looked up
+func (st *Steps) ServiceIsStopped(service string) error {
+	err := st.serviceManager.RemoveServicesFromCompose(st.opts.Profile, []string{service}, st.opts.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": st.opts.Profile,
+			"service": service,
+		}).Error("Could not stop the service")
+		return err
+	}
+
+	st.mutex.Lock()
+	st.stoppedAt[service] = time.Now().UTC()
+	st.mutex.Unlock()
+
+	return nil
+}
+
+// ServiceIsRestarted restarts the container of a service of the docker-compose profile
+func (st *Steps) ServiceIsRestarted(service string) error {
+	composes := []string{
+		st.opts.Profile, // profile name
+		service,         // service
+	}
+
+	err := st.serviceManager.RunCommand(st.opts.Profile, composes, []string{"restart", service}, st.opts.Env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": st.opts.Profile,
+			"service": service,
+		}).Error("Could not restart the service")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"profile": st.opts.Profile,
+		"service": service,
+	}).Debug("The service has been restarted")
+
+	return nil
+}
+
+// ProcessIsInStateInService waits for a process to be in the desired state, started or
+// stopped, in the container of a service of the docker-compose profile
+func (st *Steps) ProcessIsInStateInService(process string, state string, service string) error {
+	containerName := st.getContainerName(service)
+
+	err := e2e.WaitForProcess(containerName, process, state, st.opts.Timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"container": containerName,
+			"error":     err,
+			"process":   process,
+			"state":     state,
+			"timeout":   st.opts.Timeout,
+		}).Error("The process did not get the desired state")
+		return err
+	}
+
+	return nil
+}
+
+// getContainerName returns the name of the first container of a service of the profile, in the
+// docker-compose project of the worker
+func (st *Steps) getContainerName(service string) string {
+	return fmt.Sprintf("%s_%s_%d", config.GetComposeProjectName(st.opts.Profile), service, 1)
+}
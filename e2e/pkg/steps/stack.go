@@ -0,0 +1,144 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package steps
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// stackVersionKey the variable of the environment of the profile with the version of the stack
+const stackVersionKey = "stackVersion"
+
+// StackIsUpgradedTo upgrades Elasticsearch and Kibana in place to a version, or an alias resolved
+// by the suite, recreating their containers with the images of the version, which keep the data in
+// the volumes of the profile, and waiting for them to be healthy. The agents deployed by the
+// scenario keep running while the stack is upgraded
+func (st *Steps) StackIsUpgradedTo(version string) error {
+	if st.opts.ResolveVersion != nil {
+		resolved, err := st.opts.ResolveVersion(version)
+		if err != nil {
+			return err
+		}
+		version = resolved
+	}
+
+	st.mutex.Lock()
+	currentVersion := st.opts.Env[stackVersionKey]
+	if st.originalStackVersion == "" {
+		st.originalStackVersion = currentVersion
+	}
+	st.mutex.Unlock()
+
+	if version == currentVersion {
+		return fmt.Errorf("The stack already runs in the %s version", version)
+	}
+
+	env := map[string]string{}
+	for k, v := range st.opts.Env {
+		env[k] = v
+	}
+	env[stackVersionKey] = version
+
+	log.WithFields(log.Fields{
+		"from":    currentVersion,
+		"profile": st.opts.Profile,
+		"to":      version,
+	}).Info("Upgrading the stack")
+
+	startedAt := time.Now()
+
+	err := st.serviceManager.RunCompose(true, []string{st.opts.Profile}, env)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": st.opts.Profile,
+			"version": version,
+		}).Error("Could not upgrade the stack")
+		return err
+	}
+
+	st.mutex.Lock()
+	st.opts.Env[stackVersionKey] = version
+	st.upgradedAt = time.Now().UTC()
+	st.mutex.Unlock()
+
+	// the routes of the Kibana API depend on its version
+	kibana.ResetVersionCache()
+
+	err = st.ElasticsearchIsHealthy()
+	if err != nil {
+		return err
+	}
+
+	err = st.KibanaIsHealthy()
+	if err != nil {
+		return err
+	}
+
+	e2e.RecordMeasurement("stack-upgrade", time.Since(startedAt))
+
+	log.WithFields(log.Fields{
+		"profile": st.opts.Profile,
+		"version": version,
+	}).Debug("The stack has been upgraded")
+
+	return nil
+}
+
+// UpgradedAt returns the time the stack was upgraded at in the running scenario, being zero if it
+// was not upgraded
+func (st *Steps) UpgradedAt() time.Time {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	return st.upgradedAt
+}
+
+// RestoreStack destroys the stack upgraded by the running scenario, with its data, and runs it again
+// in the version it ran before the scenario, as it cannot be downgraded keeping its data. The
+// suite must set the stack up again, i.e. Fleet. It returns false if the stack was not upgraded
+func (st *Steps) RestoreStack() (bool, error) {
+	st.mutex.Lock()
+	originalVersion := st.originalStackVersion
+	st.mutex.Unlock()
+
+	if originalVersion == "" {
+		return false, nil
+	}
+
+	log.WithFields(log.Fields{
+		"profile": st.opts.Profile,
+		"version": originalVersion,
+	}).Info("Restoring the version of the upgraded stack")
+
+	err := st.serviceManager.StopCompose(true, []string{st.opts.Profile})
+	if err != nil {
+		return true, fmt.Errorf("Could not destroy the upgraded stack: %v", err)
+	}
+
+	st.mutex.Lock()
+	st.opts.Env[stackVersionKey] = originalVersion
+	st.originalStackVersion = ""
+	st.mutex.Unlock()
+
+	err = st.serviceManager.RunCompose(true, []string{st.opts.Profile}, st.opts.Env)
+	if err != nil {
+		return true, fmt.Errorf("Could not run the stack in the %s version: %v", originalVersion, err)
+	}
+
+	kibana.ResetVersionCache()
+
+	err = st.ElasticsearchIsHealthy()
+	if err != nil {
+		return true, err
+	}
+
+	return true, st.KibanaIsHealthy()
+}
@@ -0,0 +1,149 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package steps is a library of the step definitions shared by the test suites, covering the
+// lifecycle of the services, the waits, the assertions on the documents in Elasticsearch and the
+// operations in Kibana and Fleet, so that any godog suite, in this or in other repositories,
+// can embed them calling RegisterSteps from its scenario initializer. The steps are grouped in
+// bundles, which the suites opt into
+package steps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultTimeoutFactor multiplier of the minutes the steps wait for a condition, which can be
+// overriden by TIMEOUT_FACTOR env var, as the suites do
+const defaultTimeoutFactor = 3
+
+// Options configures the runtime dependencies the steps operate on
+type Options struct {
+	Env     map[string]string // the environment of the docker-compose files of the profile
+	Profile string            // the docker-compose profile where the services run, i.e. fleet
+	Timeout time.Duration     // the max time waiting for a condition, defaulting to TIMEOUT_FACTOR minutes
+	Bundles []Bundle          // the bundles of steps the suite opts into, all of them if it's empty
+
+	// ResolveVersion returns the version of the stack for an alias of the suite, i.e. N-1. The versions
+	// are used as they are written in the steps if it's nil
+	ResolveVersion func(alias string) (string, error)
+}
+
+// Steps holds the state of the shared steps for the running scenario
+type Steps struct {
+	appendedLines  int // the number of lines appended to the files of the services in the scenario
+	fleetClient    *kibana.Client
+	kibanaClient   *services.KibanaClient
+	linesMarker    string // the marker of the lines appended in the scenario, telling their events apart
+	mutex          sync.Mutex
+	opts           Options
+	serviceManager services.ServiceManager
+	startedAt      time.Time            // the time the scenario started at
+	stoppedAt      map[string]time.Time // the time each service was stopped at, by service name
+	upgradedAt     time.Time            // the time the stack was upgraded at, once it's healthy
+
+	originalStackVersion string // the version of the stack before a scenario upgraded it, until it's restored
+}
+
+// NewSteps returns the shared steps for the services of a profile
+func NewSteps(opts Options) *Steps {
+	if opts.Env == nil {
+		opts.Env = map[string]string{}
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Duration(shell.GetEnvInteger("TIMEOUT_FACTOR", defaultTimeoutFactor)) * time.Minute
+	}
+
+	return &Steps{
+		fleetClient:    kibana.NewClient(),
+		kibanaClient:   services.NewKibanaClient(),
+		linesMarker:    newLinesMarker(),
+		opts:           opts,
+		serviceManager: services.NewServiceManager(),
+		startedAt:      time.Now().UTC(),
+		stoppedAt:      map[string]time.Time{},
+	}
+}
+
+// RegisterSteps adds the bundles of shared steps the suite opts into, all of them if it does not
+// choose any, and a hook resetting their state at the beginning of each scenario. The steps of the
+// suite take precedence over the shared ones when both match, so it must be called after the suite
+// adds its own steps
+func RegisterSteps(s *godog.ScenarioContext, opts Options) *Steps {
+	steps := NewSteps(opts)
+
+	bundles := opts.Bundles
+	if len(bundles) == 0 {
+		bundles = AllBundles
+	}
+
+	for _, bundle := range bundles {
+		bundle.register(s, steps)
+	}
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		steps.reset()
+		return ctx, nil
+	})
+
+	return steps
+}
+
+// StoppedAt returns the time a service was stopped at in the running scenario, being zero
+// if it was not stopped
+func (st *Steps) StoppedAt(service string) time.Time {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	return st.stoppedAt[service]
+}
+
+// ElasticsearchIsHealthy waits for the Elasticsearch cluster to get the healthy status
+func (st *Steps) ElasticsearchIsHealthy() error {
+	_, err := e2e.WaitForElasticsearch(st.opts.Timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"timeout": st.opts.Timeout,
+		}).Error("The Elasticsearch cluster could not get the healthy status")
+		return err
+	}
+
+	return nil
+}
+
+// KibanaIsHealthy waits for the Kibana instance to get the healthy status
+func (st *Steps) KibanaIsHealthy() error {
+	_, err := st.kibanaClient.WaitForKibana(st.opts.Timeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"timeout": st.opts.Timeout,
+		}).Error("The Kibana instance could not get the healthy status")
+		return err
+	}
+
+	return nil
+}
+
+// reset forgets the state of the previous scenario
+func (st *Steps) reset() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.appendedLines = 0
+	st.linesMarker = newLinesMarker()
+	st.startedAt = time.Now().UTC()
+	st.stoppedAt = map[string]time.Time{}
+	st.upgradedAt = time.Time{}
+}
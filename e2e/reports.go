@@ -0,0 +1,728 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
+	e2eerrors "github.com/elastic/e2e-testing/e2e/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	scenarioFailed  = "failed"
+	scenarioFlaky   = "flaky"
+	scenarioPassed  = "passed"
+	scenarioSkipped = "skipped"
+)
+
+// reportsDir the dir where the reports are written, set with the --reports.dir flag of the suites
+var reportsDir = ""
+
+// suiteReport keeps the results of the scenarios run by a test suite
+type suiteReport struct {
+	mutex         sync.Mutex
+	name          string
+	properties    map[string]string
+	running       map[string]*scenarioReport // by the ID of the pickle
+	scenarios     []*scenarioReport
+	start         time.Time
+	stepScenarios map[string]*scenarioReport // by the ID of the pickle step
+}
+
+// scenarioReport the result of a scenario
+type scenarioReport struct {
+	Attachments []string       `json:"attachments"` // the artifacts of the scenario, i.e. the logs of the containers
+	Duration    time.Duration  `json:"duration"`
+	Error       string         `json:"error"`
+	ErrorKind   string         `json:"errorKind"`        // the kind of the error, i.e. agent-not-listed, empty if it's unknown
+	Feature     string         `json:"feature"`          // the feature file of the scenario
+	FlakyErrors []string       `json:"flakyErrors"`      // the errors of the attempts that failed, if it passed after a retry
+	Ingest      []ingestSample `json:"ingest,omitempty"` // the counts of the documents of the monitored data streams during the scenario
+	Name        string         `json:"name"`
+	Start       time.Time      `json:"start"`
+	Steps       []*stepReport  `json:"steps"`
+	Tags        []string       `json:"tags"`
+}
+
+// stepReport the result of a step of a scenario
+type stepReport struct {
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error"`
+	ErrorKind string        `json:"errorKind"` // the kind of the error, i.e. timeout-waiting-for-status, empty if it's unknown
+	ID        string        `json:"id"`
+	Start     time.Time     `json:"start"`
+	Status    string        `json:"status"` // passed, failed, skipped, undefined or pending, empty if it was not run
+	Text      string        `json:"text"`
+}
+
+var report = &suiteReport{
+	properties:    map[string]string{},
+	running:       map[string]*scenarioReport{},
+	scenarios:     []*scenarioReport{},
+	stepScenarios: map[string]*scenarioReport{},
+}
+
+// AddReportProperty adds a property of the run to the reports of the suite, i.e. the version of
+// the stack under test
+func AddReportProperty(name string, value string) {
+	report.mutex.Lock()
+	defer report.mutex.Unlock()
+
+	report.properties[name] = value
+}
+
+// GetReportsDir returns the dir where the JUnit and the HTML reports of the suites are written, which
+// is set with the --reports.dir flag of the suites, or the REPORTS_DIR environment variable, defaulting
+// to the "reports" dir of the outputs dir
+func GetReportsDir() string {
+	if reportsDir != "" {
+		return reportsDir
+	}
+
+	return shell.GetEnv("REPORTS_DIR", filepath.Join(GetOutputsDir(), "reports"))
+}
+
+// isFlaky checks if the scenario passed after failing in a previous attempt
+func (sr *scenarioReport) isFlaky() bool {
+	return len(sr.FlakyErrors) > 0
+}
+
+// status returns the status of the scenario: failed if a step or a hook failed, skipped if a
+// step was undefined, pending or skipped on its own, and passed otherwise
+func (sr *scenarioReport) status() string {
+	if sr.Error != "" {
+		return scenarioFailed
+	}
+
+	status := scenarioPassed
+	for _, step := range sr.Steps {
+		switch step.Status {
+		case "failed":
+			return scenarioFailed
+		case "passed":
+		default:
+			status = scenarioSkipped
+		}
+	}
+
+	return status
+}
+
+// failedStep returns the first failed step of the scenario, if any
+func (sr *scenarioReport) failedStep() *stepReport {
+	for _, step := range sr.Steps {
+		if step.Status == "failed" {
+			return step
+		}
+	}
+
+	return nil
+}
+
+// step returns the step of the scenario with an ID
+func (sr *scenarioReport) step(id string) *stepReport {
+	for _, step := range sr.Steps {
+		if step.ID == id {
+			return step
+		}
+	}
+
+	return &stepReport{}
+}
+
+// registerStart adds the hooks recording the start of the scenarios and their steps. They must
+// be added before the hooks of the suite, so that the durations include them
+func (r *suiteReport) registerStart(s *godog.ScenarioContext) {
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		sr := &scenarioReport{
+			Attachments: []string{},
+			Feature:     pickle.Uri,
+			Name:        pickle.Name,
+			Start:       time.Now(),
+			Steps:       []*stepReport{},
+			Tags:        []string{},
+		}
+
+		for _, tag := range pickle.Tags {
+			sr.Tags = append(sr.Tags, tag.Name)
+		}
+
+		for _, step := range pickle.Steps {
+			sr.Steps = append(sr.Steps, &stepReport{ID: step.Id, Text: step.Text})
+			r.stepScenarios[step.Id] = sr
+		}
+
+		r.running[pickle.Id] = sr
+		r.scenarios = append(r.scenarios, sr)
+
+		return ctx, nil
+	})
+
+	s.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if sr := r.stepScenarios[step.Id]; sr != nil {
+			sr.step(step.Id).Start = time.Now()
+		}
+
+		return ctx, nil
+	})
+}
+
+// registerEnd adds the hooks recording the results of the scenarios and their steps. They must
+// be added after the hooks of the suite, so that the errors of their hooks are recorded too
+func (r *suiteReport) registerEnd(s *godog.ScenarioContext) {
+	s.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		sr := r.stepScenarios[step.Id]
+		if sr == nil {
+			return ctx, nil
+		}
+		delete(r.stepScenarios, step.Id)
+
+		st := sr.step(step.Id)
+		st.Status = status.String()
+		if !st.Start.IsZero() {
+			st.Duration = time.Since(st.Start)
+		}
+		if err != nil {
+			st.Error = err.Error()
+			st.ErrorKind = e2eerrors.Kind(err)
+		}
+
+		return ctx, nil
+	})
+
+	// the hook is run once the scenario fails, so the skipped steps are recorded after it
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		sr := r.running[pickle.Id]
+		if sr == nil {
+			return ctx, nil
+		}
+		delete(r.running, pickle.Id)
+
+		sr.Duration = time.Since(sr.Start)
+		// the undefined and pending steps are recorded as such, skipping the scenario
+		if err != nil && !errors.Is(err, godog.ErrUndefined) && !errors.Is(err, godog.ErrPending) {
+			sr.Error = err.Error()
+			sr.ErrorKind = e2eerrors.Kind(err)
+		}
+
+		// a scenario passing after a retry is reported as flaky, with the errors of the attempts that failed
+		if GetRetryAttempt() > 0 && sr.status() == scenarioPassed {
+			sr.FlakyErrors = getScenarioFailures(getScenarioLocation(pickle), pickle.Name)
+			if len(sr.FlakyErrors) == 0 {
+				sr.FlakyErrors = []string{"the scenario failed in a previous attempt"}
+			}
+		}
+
+		return ctx, nil
+	})
+}
+
+// setIngestTimeline sets the counts of the documents of the monitored data streams sampled during a
+// running scenario
+func (r *suiteReport) setIngestTimeline(pickleID string, samples []ingestSample) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if sr := r.running[pickleID]; sr != nil {
+		sr.Ingest = samples
+	}
+}
+
+// fileName returns the name of the report files of the suite, which is unique for each process
+// of a run: the workers, the retries of the failed scenarios, and the soak and benchmark iterations
+func (r *suiteReport) fileName() string {
+	name := r.name
+
+	if worker := config.GetWorkerID(); worker > 0 {
+		name += fmt.Sprintf("-worker-%d", worker)
+	}
+	if iteration := GetSoakIteration(); iteration > 0 {
+		name += fmt.Sprintf("-soak-%d", iteration)
+	}
+	if iteration := GetBenchmarkIteration(); iteration > 0 {
+		name += fmt.Sprintf("-benchmark-%d", iteration)
+	}
+	if attempt := GetRetryAttempt(); attempt > 0 {
+		name += fmt.Sprintf("-retry-%d", attempt)
+	}
+
+	return name
+}
+
+// runProperties returns the properties of the run, with the ones added by the suite, sorted by name
+func (r *suiteReport) runProperties() []junitProperty {
+	properties := map[string]string{
+		"runID": config.GetRunID(),
+	}
+	if worker := config.GetWorkerID(); worker > 0 {
+		properties["worker"] = fmt.Sprint(worker)
+	}
+	if attempt := GetRetryAttempt(); attempt > 0 {
+		properties["retryAttempt"] = fmt.Sprint(attempt)
+	}
+
+	for name, value := range r.properties {
+		properties[name] = value
+	}
+
+	names := []string{}
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sorted := []junitProperty{}
+	for _, name := range names {
+		sorted = append(sorted, junitProperty{Name: name, Value: properties[name]})
+	}
+
+	return sorted
+}
+
+// collectAttachments adds the files of the artifacts bundles of the failed scenarios to them
+func (r *suiteReport) collectAttachments() {
+	for _, sr := range r.scenarios {
+		if sr.status() != scenarioFailed {
+			continue
+		}
+
+		bundleDir := getScenarioOutputsPath(sr.Name)
+
+		_ = filepath.Walk(bundleDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				return nil
+			}
+
+			sr.Attachments = append(sr.Attachments, absPath)
+			return nil
+		})
+	}
+}
+
+// write writes the JUnit and the HTML reports of the scenarios run by the suite into the reports dir
+func (r *suiteReport) write() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.collectAttachments()
+
+	dir := GetReportsDir()
+	name := r.fileName()
+
+	junit, err := r.junit()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"suite": r.name,
+		}).Error("Could not generate the JUnit report")
+		return err
+	}
+
+	err = WriteArtifact(dir, "TEST-"+name+".xml", junit)
+	if err != nil {
+		return err
+	}
+
+	html, err := r.html(dir)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"suite": r.name,
+		}).Error("Could not generate the HTML report")
+		return err
+	}
+
+	err = WriteArtifact(dir, name+".html", html)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"dir":       dir,
+		"scenarios": len(r.scenarios),
+		"suite":     r.name,
+	}).Info("The reports of the suite were written")
+
+	return nil
+}
+
+// junitTestSuites the root element of a JUnit report, with a test suite per feature file
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Failures   int              `xml:"failures,attr"`
+	Name       string           `xml:"name,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Time       string           `xml:"time,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite the scenarios of a feature file in a JUnit report
+type junitTestSuite struct {
+	Failures   int             `xml:"failures,attr"`
+	Name       string          `xml:"name,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+// junitProperty a property of the run in a JUnit report
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase a scenario in a JUnit report
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	// the failures of the attempts of a flaky scenario, in the format of the reruns of Surefire,
+	// which the JUnit plugin of Jenkins reports as flaky tests
+	FlakyFailures []junitMessage `xml:"flakyFailure,omitempty"`
+	SystemOut     *junitOutput   `xml:"system-out,omitempty"`
+}
+
+// junitOutput the output of a scenario in a JUnit report
+type junitOutput struct {
+	Content string `xml:",cdata"`
+}
+
+// junitMessage the failure or the reason to skip a scenario in a JUnit report
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"` // the kind of the error of a failure, if it's known
+	Content string `xml:",cdata"`
+}
+
+// junit returns the JUnit report of the scenarios, grouping them by feature file. The steps of
+// each scenario and its attachments are written to its output, the latter in the format of the
+// JUnit attachments plugin of Jenkins
+func (r *suiteReport) junit() (string, error) {
+	properties := r.runProperties()
+
+	root := junitTestSuites{Name: r.name}
+	suites := map[string]*junitTestSuite{}
+	features := []string{}
+
+	var total time.Duration
+	for _, sr := range r.scenarios {
+		suite, exists := suites[sr.Feature]
+		if !exists {
+			suite = &junitTestSuite{
+				Name:       sr.Feature,
+				Properties: properties,
+				Timestamp:  sr.Start.UTC().Format(time.RFC3339),
+				TestCases:  []junitTestCase{},
+			}
+			suites[sr.Feature] = suite
+			features = append(features, sr.Feature)
+		}
+
+		testCase := junitTestCase{
+			ClassName: sr.Feature,
+			Name:      sr.Name,
+			Time:      formatSeconds(sr.Duration),
+		}
+
+		var out strings.Builder
+		for _, step := range sr.Steps {
+			fmt.Fprintf(&out, "%-9s %s (%s)\n", orNotRun(step.Status), step.Text, step.Duration.Round(time.Millisecond))
+		}
+		if len(sr.Ingest) > 0 {
+			fmt.Fprintf(&out, "\n%s\n", formatIngestTimeline(GetIngestMonitorDataStreams(), sr.Ingest))
+		}
+		for _, attachment := range sr.Attachments {
+			fmt.Fprintf(&out, "[[ATTACHMENT|%s]]\n", attachment)
+		}
+		testCase.SystemOut = &junitOutput{Content: out.String()}
+
+		switch sr.status() {
+		case scenarioFailed:
+			message := "a hook of the scenario failed"
+			content := sr.Error
+			kind := sr.ErrorKind
+			if step := sr.failedStep(); step != nil {
+				message = step.Text
+				content = step.Error
+				kind = step.ErrorKind
+			}
+
+			testCase.Failure = &junitMessage{Message: message, Type: kind, Content: content}
+			suite.Failures++
+		case scenarioSkipped:
+			testCase.Skipped = &junitMessage{Message: "the scenario has undefined, pending or skipped steps"}
+			suite.Skipped++
+		}
+
+		for _, flakyError := range sr.FlakyErrors {
+			testCase.FlakyFailures = append(testCase.FlakyFailures, junitMessage{Message: "the scenario passed after a retry", Content: flakyError})
+		}
+
+		suite.Tests++
+		suite.TestCases = append(suite.TestCases, testCase)
+		total += sr.Duration
+	}
+
+	for _, feature := range features {
+		suite := suites[feature]
+
+		var duration time.Duration
+		for _, sr := range r.scenarios {
+			if sr.Feature == feature {
+				duration += sr.Duration
+			}
+		}
+		suite.Time = formatSeconds(duration)
+
+		root.Failures += suite.Failures
+		root.Skipped += suite.Skipped
+		root.Tests += suite.Tests
+		root.TestSuites = append(root.TestSuites, *suite)
+	}
+	root.Time = formatSeconds(total)
+
+	content, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return xml.Header + string(content) + "\n", nil
+}
+
+// htmlReport the data of the HTML report of a suite
+type htmlReport struct {
+	Failed     int
+	Flaky      int
+	Name       string
+	Passed     int
+	Properties []junitProperty
+	Scenarios  []htmlScenario
+	Skipped    int
+	Start      string
+	Time       string
+}
+
+// htmlScenario a scenario in the HTML report, with its attachments relative to the report
+type htmlScenario struct {
+	Attachments []string
+	Duration    string
+	Error       string
+	ErrorKind   string
+	FailedStep  string
+	Feature     string
+	FlakyErrors []string
+	Ingest      string // the timeline of the counts of the documents of the monitored data streams
+	Name        string
+	Status      string
+	Steps       []*stepReport
+	Tags        string
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"orNotRun": orNotRun,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - E2E tests report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; width: 100%; }
+th, td { border: 1px solid #ddd; padding: 6px; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+pre { white-space: pre-wrap; margin: 0; }
+.failed { color: #bd271e; font-weight: bold; }
+.passed { color: #017d73; font-weight: bold; }
+.flaky { color: #b0581d; font-weight: bold; }
+.skipped, .undefined, .pending, .not-run { color: #98a2b3; font-weight: bold; }
+.steps { margin: 0.5em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<p>Started at {{.Start}}, run in {{.Time}}: <span class="passed">{{.Passed}} passed</span>, <span class="flaky">{{.Flaky}} flaky</span>, <span class="failed">{{.Failed}} failed</span>, <span class="skipped">{{.Skipped}} skipped</span></p>
+<table>
+<tr><th>Property</th><th>Value</th></tr>
+{{- range .Properties}}
+<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{- end}}
+</table>
+<table>
+<tr><th>Status</th><th>Feature</th><th>Scenario</th><th>Duration</th><th>Details</th></tr>
+{{- range .Scenarios}}
+<tr>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.Feature}}</td>
+<td>{{.Name}}<br><small>{{.Tags}}</small></td>
+<td>{{.Duration}}</td>
+<td>
+{{- if .FailedStep}}<p>Failed step: <code>{{.FailedStep}}</code></p>{{end}}
+{{- if .ErrorKind}}<p>Kind: <code>{{.ErrorKind}}</code></p>{{end}}
+{{- if .Error}}<pre>{{.Error}}</pre>{{end}}
+{{- if .FlakyErrors}}
+<details><summary>Failed attempts</summary>
+{{- range .FlakyErrors}}
+<pre>{{.}}</pre>
+{{- end}}
+</details>
+{{- end}}
+<details class="steps"><summary>Steps</summary>
+<table>
+{{- range .Steps}}
+<tr><td class="{{orNotRun .Status}}">{{orNotRun .Status}}</td><td>{{.Text}}</td><td>{{duration .Duration}}</td></tr>
+{{- end}}
+</table>
+</details>
+{{- if .Ingest}}
+<details><summary>Ingestion</summary>
+<pre>{{.Ingest}}</pre>
+</details>
+{{- end}}
+{{- if .Attachments}}
+<details><summary>Attachments</summary>
+<ul>
+{{- range .Attachments}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+</details>
+{{- end}}
+</td>
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// html returns the HTML summary of the scenarios, linking their attachments relative to the dir
+// of the report
+func (r *suiteReport) html(dir string) (string, error) {
+	data := htmlReport{
+		Name:       r.name,
+		Properties: r.runProperties(),
+		Scenarios:  []htmlScenario{},
+		Start:      r.start.UTC().Format(time.RFC3339),
+		Time:       time.Since(r.start).Round(time.Second).String(),
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, sr := range r.scenarios {
+		scenario := htmlScenario{
+			Attachments: []string{},
+			Duration:    sr.Duration.Round(time.Millisecond).String(),
+			Error:       sr.Error,
+			ErrorKind:   sr.ErrorKind,
+			Feature:     sr.Feature,
+			FlakyErrors: sr.FlakyErrors,
+			Name:        sr.Name,
+			Status:      sr.status(),
+			Steps:       sr.Steps,
+			Tags:        strings.Join(sr.Tags, " "),
+		}
+
+		if len(sr.Ingest) > 0 {
+			scenario.Ingest = formatIngestTimeline(GetIngestMonitorDataStreams(), sr.Ingest)
+		}
+
+		if step := sr.failedStep(); step != nil {
+			scenario.FailedStep = step.Text
+			scenario.Error = step.Error
+			scenario.ErrorKind = step.ErrorKind
+		}
+
+		for _, attachment := range sr.Attachments {
+			relPath, err := filepath.Rel(absDir, attachment)
+			if err != nil {
+				relPath = attachment
+			}
+
+			scenario.Attachments = append(scenario.Attachments, filepath.ToSlash(relPath))
+		}
+
+		if scenario.Status == scenarioPassed && sr.isFlaky() {
+			scenario.Status = scenarioFlaky
+		}
+
+		switch scenario.Status {
+		case scenarioFailed:
+			data.Failed++
+		case scenarioFlaky:
+			data.Flaky++
+		case scenarioPassed:
+			data.Passed++
+		default:
+			data.Skipped++
+		}
+
+		data.Scenarios = append(data.Scenarios, scenario)
+	}
+
+	var content bytes.Buffer
+
+	err = htmlReportTemplate.Execute(&content, data)
+	if err != nil {
+		return "", err
+	}
+
+	return content.String(), nil
+}
+
+// formatSeconds formats a duration in seconds, as the JUnit reports do
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// orNotRun returns "not-run" for the steps without status, as godog did not run them
+func orNotRun(status string) string {
+	if status == "" {
+		return "not-run"
+	}
+
+	return status
+}
@@ -0,0 +1,273 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gherkin "github.com/cucumber/gherkin/go/v26"
+	"github.com/cucumber/godog"
+	messages "github.com/cucumber/messages/go/v21"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// rerunFileName name of the file where the locations of the failed scenarios are stored,
+// so that they can be passed back to godog in the next retry attempt
+const rerunFileName = "rerun.txt"
+
+// flakyFileName name of the file where the scenarios that passed after a retry are reported
+const flakyFileName = "flaky-scenarios.txt"
+
+// flakyReportFileName name of the file with the machine-readable list of the flaky scenarios, for
+// their triage
+const flakyReportFileName = "flaky-scenarios.json"
+
+// failuresFileName name of the file where the failures of the scenarios are recorded, a JSON
+// object per line, so that the retries report the errors of the attempts that failed
+const failuresFileName = "failed-scenarios.jsonl"
+
+// FlakyScenario a scenario that passed after a retry, with the errors of the attempts that failed
+type FlakyScenario struct {
+	Attempt  int      `json:"attempt"` // the retry attempt in which it passed
+	Errors   []string `json:"errors"`
+	Feature  string   `json:"feature"`
+	Location string   `json:"location"` // i.e. features/fleet_mode_agent.feature:12
+	Name     string   `json:"name"`
+	RunID    string   `json:"runID"`
+	Tags     []string `json:"tags"`
+}
+
+// scenarioFailure a failure of a scenario in an attempt
+type scenarioFailure struct {
+	Attempt  int    `json:"attempt"`
+	Error    string `json:"error"`
+	Location string `json:"location"`
+	Name     string `json:"name"`
+}
+
+// GetFlakyScenarios returns the scenarios of the run that passed after a retry, which are read
+// from the flaky-scenarios.json file of the outputs dir
+func GetFlakyScenarios() ([]FlakyScenario, error) {
+	outputsMutex.Lock()
+	defer outputsMutex.Unlock()
+
+	return readFlakyScenarios()
+}
+
+// GetRetryAttempt returns the retry attempt of the current test run, 0 being the first
+// execution, which is read from the SCENARIO_RETRY_ATTEMPT environment variable
+func GetRetryAttempt() int {
+	return shell.GetEnvInteger("SCENARIO_RETRY_ATTEMPT", 0)
+}
+
+// RegisterScenarioRetries adds an after-scenario hook to the suite that keeps track of the failed
+// scenarios, so that they can be retried in a clean run, and reports as flaky those scenarios
+// that passed in a retry attempt, with the errors of the attempts that failed
+func RegisterScenarioRetries(s *godog.ScenarioContext) {
+	attempt := GetRetryAttempt()
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		location := getScenarioLocation(pickle)
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"attempt":  attempt,
+				"error":    err,
+				"location": location,
+				"scenario": pickle.Name,
+			}).Warn("The scenario failed, it will be marked for retry")
+
+			_ = appendToOutputsFile(rerunFileName, location)
+			_ = recordScenarioFailure(scenarioFailure{
+				Attempt:  attempt,
+				Error:    err.Error(),
+				Location: location,
+				Name:     pickle.Name,
+			})
+			return ctx, nil
+		}
+
+		if attempt > 0 {
+			log.WithFields(log.Fields{
+				"attempt":  attempt,
+				"location": location,
+				"scenario": pickle.Name,
+			}).Warn("The scenario passed after a retry, reporting it as flaky")
+
+			_ = appendToOutputsFile(flakyFileName, fmt.Sprintf("%s\t%d\t%s", location, attempt, pickle.Name))
+
+			tags := []string{}
+			for _, tag := range pickle.Tags {
+				tags = append(tags, tag.Name)
+			}
+
+			_ = recordFlakyScenario(FlakyScenario{
+				Attempt:  attempt,
+				Errors:   getScenarioFailures(location, pickle.Name),
+				Feature:  pickle.Uri,
+				Location: location,
+				Name:     pickle.Name,
+				RunID:    config.GetRunID(),
+				Tags:     tags,
+			})
+		}
+
+		return ctx, nil
+	})
+}
+
+// getScenarioFailures returns the errors of the attempts in which a scenario failed, in order
+func getScenarioFailures(location string, name string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(GetOutputsDir(), failuresFileName))
+	if err != nil {
+		return []string{}
+	}
+
+	errors := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		failure := scenarioFailure{}
+		if json.Unmarshal([]byte(line), &failure) != nil {
+			continue
+		}
+
+		if failure.Location == location && failure.Name == name {
+			errors = append(errors, failure.Error)
+		}
+	}
+
+	return errors
+}
+
+// getScenarioLocation returns the location of the scenario in the feature file, using
+// godog's "file.feature:line" format. As pickles do not keep the line of the scenario,
+// the feature file is parsed again to find it, falling back to the feature file when
+// it's not possible
+func getScenarioLocation(pickle *godog.Scenario) string {
+	content, toOriginalLine, err := readFeatureFile(pickle.Uri)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"feature": pickle.Uri,
+		}).Warn("Could not read the feature file")
+		return pickle.Uri
+	}
+
+	newIDFunc := (&messages.Incrementing{}).NewId
+
+	document, err := gherkin.ParseGherkinDocument(bytes.NewReader(content), newIDFunc)
+	if err != nil || document.Feature == nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"feature": pickle.Uri,
+		}).Warn("Could not parse the feature file")
+		return pickle.Uri
+	}
+
+	for _, candidate := range gherkin.Pickles(*document, pickle.Uri, newIDFunc) {
+		if !samePickle(candidate, pickle) {
+			continue
+		}
+
+		for _, child := range document.Feature.Children {
+			if sc := child.Scenario; sc != nil && sc.Id == candidate.AstNodeIds[0] {
+				return fmt.Sprintf("%s:%d", pickle.Uri, toOriginalLine(int(sc.Location.Line)))
+			}
+		}
+	}
+
+	return pickle.Uri
+}
+
+// readFlakyScenarios reads the flaky scenarios from the outputs dir, which are none if the file
+// does not exist
+func readFlakyScenarios() ([]FlakyScenario, error) {
+	flakyScenarios := []FlakyScenario{}
+
+	content, err := ioutil.ReadFile(filepath.Join(GetOutputsDir(), flakyReportFileName))
+	if os.IsNotExist(err) {
+		return flakyScenarios, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &flakyScenarios)
+	if err != nil {
+		return nil, err
+	}
+
+	return flakyScenarios, nil
+}
+
+// recordFlakyScenario adds a flaky scenario to the flaky-scenarios.json file of the outputs dir
+func recordFlakyScenario(flaky FlakyScenario) error {
+	outputsMutex.Lock()
+	defer outputsMutex.Unlock()
+
+	flakyScenarios, err := readFlakyScenarios()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  flakyReportFileName,
+		}).Warn("Could not read the flaky scenarios, the file will be overwritten")
+		flakyScenarios = []FlakyScenario{}
+	}
+	flakyScenarios = append(flakyScenarios, flaky)
+
+	content, err := json.MarshalIndent(flakyScenarios, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(GetOutputsDir(), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(GetOutputsDir(), flakyReportFileName), append(content, '\n'), 0644)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  flakyReportFileName,
+		}).Error("Could not write the flaky scenarios")
+		return err
+	}
+
+	return nil
+}
+
+// recordScenarioFailure appends the failure of a scenario to the failed-scenarios.jsonl file of the
+// outputs dir
+func recordScenarioFailure(failure scenarioFailure) error {
+	content, err := json.Marshal(failure)
+	if err != nil {
+		return err
+	}
+
+	return appendToOutputsFile(failuresFileName, string(content))
+}
+
+// samePickle checks if two pickles represent the same scenario, comparing their names and steps
+func samePickle(a *messages.Pickle, b *messages.Pickle) bool {
+	if a.Name != b.Name || len(a.Steps) != len(b.Steps) {
+		return false
+	}
+
+	for i := range a.Steps {
+		if strings.TrimSpace(a.Steps[i].Text) != strings.TrimSpace(b.Steps[i].Text) {
+			return false
+		}
+	}
+
+	return true
+}
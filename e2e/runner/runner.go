@@ -0,0 +1,322 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package runner bootstraps the test suites whose runtime dependencies run in a docker-compose
+// profile: it runs the profile before the scenarios, waiting for the stack to be healthy, wires the
+// shared steps and the hooks of the framework into each scenario, and destroys the profile after the
+// suite, unless it's kept in developer mode. A suite only declares its steps and the environment of
+// its profile, calling Run from its TestMain function
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e"
+	"github.com/elastic/e2e-testing/e2e/internal/kibana"
+	"github.com/elastic/e2e-testing/e2e/pkg/steps"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultTimeoutFactor multiplier of the minutes the suite waits for the stack to be healthy, which
+// can be overriden by TIMEOUT_FACTOR env var, as the suites do
+const defaultTimeoutFactor = 3
+
+// Options configures the bootstrap of a suite
+type Options struct {
+	Name             string            // the name of the suite, naming its reports and its resources, i.e. apm
+	Profile          string            // the docker-compose profile of the runtime dependencies, i.e. fleet
+	StackVersion     string            // the version of the stack, which is the environment of the profile without ProfileEnv
+	ReportProperties map[string]string // the properties of the reports of the run, i.e. the versions under test
+	Timeout          time.Duration     // the max time waiting for the stack, defaulting to TIMEOUT_FACTOR minutes
+
+	LocalImages string // the artifact whose local docker images are loaded before the profile is run, i.e. metricbeat
+	Kibana      bool   // waits for Kibana to be healthy once Elasticsearch is
+	Fleet       bool   // sets Fleet up once Kibana is healthy, which implies waiting for it
+
+	// ProfileEnv returns the environment of the docker-compose files of the profile, computed when the
+	// suite starts, i.e. with the paths of the config files of its services
+	ProfileEnv func() (map[string]string, error)
+	// PullServices returns the services, and their environment, whose images are pulled before the
+	// profile is run, so that the scenarios adding them to the profile do not pull them
+	PullServices func(profileEnv map[string]string) ([]string, map[string]string)
+
+	BeforeSuite func() // runs once the stack is healthy
+	AfterSuite  func() // runs once the profile is destroyed, or kept in developer mode
+
+	// Scenario adds the steps of the suite to a scenario, before the shared ones, returning the
+	// function destroying the resources deployed by the scenario, which runs after it, and when the
+	// run is interrupted. It's nil if the scenario deploys nothing
+	Scenario           func(s *godog.ScenarioContext) func() error
+	StepBundles        []steps.Bundle          // the bundles of shared steps the suite opts into, all of them if it's empty
+	ArtifactCollectors []e2e.ArtifactCollector // collect the artifacts of the suite when a scenario fails
+	CleanDataStreams   bool                    // deletes the data streams once the resources of each scenario are destroyed
+	DataStreams        []string                // the patterns of the deleted data streams, the logs and metrics ones if empty
+
+	// ResolveVersion returns the version of the stack for an alias of the suite in the steps upgrading
+	// the stack, i.e. N-1. The versions are used as they are written if it's nil
+	ResolveVersion func(alias string) (string, error)
+}
+
+// Suite a test suite running its runtime dependencies in a docker-compose profile
+type Suite struct {
+	ProfileEnv     map[string]string // the environment of the profile, once the suite started
+	Steps          *steps.Steps      // the shared steps of the running scenario
+	opts           Options
+	profileCleanup *e2e.Cleanup
+	serviceManager services.ServiceManager
+}
+
+// New returns a suite bootstrapped with some options
+func New(opts Options) *Suite {
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Duration(shell.GetEnvInteger("TIMEOUT_FACTOR", defaultTimeoutFactor)) * time.Minute
+	}
+
+	return &Suite{
+		ProfileEnv:     map[string]string{},
+		opts:           opts,
+		serviceManager: services.NewServiceManager(),
+	}
+}
+
+// Run runs the scenarios of the suite, returning the exit status of the run
+func (s *Suite) Run() int {
+	return e2e.RunSuite(s.opts.Name, s.InitializeTestSuite, s.InitializeScenario)
+}
+
+// InitializeTestSuite adds the hooks running and destroying the profile to the Godog test suite
+func (s *Suite) InitializeTestSuite(ctx *godog.TestSuiteContext) {
+	e2e.RegisterBenchmarks(ctx)
+	for name, value := range s.opts.ReportProperties {
+		e2e.AddReportProperty(name, value)
+	}
+
+	ctx.BeforeSuite(s.beforeSuite)
+	ctx.AfterSuite(s.afterSuite)
+}
+
+// InitializeScenario adds the steps of the suite and the bundles of shared steps it opts into to a scenario of the Godog test
+// suite, with the hooks retrying it, timing it out, collecting its artifacts when it fails, and
+// destroying the resources it deployed
+func (s *Suite) InitializeScenario(ctx *godog.ScenarioContext) {
+	var cleanupFn func() error
+	if s.opts.Scenario != nil {
+		cleanupFn = s.opts.Scenario(ctx)
+	}
+
+	s.Steps = steps.RegisterSteps(ctx, steps.Options{
+		Bundles:        s.opts.StepBundles,
+		Env:            s.ProfileEnv,
+		Profile:        s.opts.Profile,
+		ResolveVersion: s.opts.ResolveVersion,
+		Timeout:        s.opts.Timeout,
+	})
+
+	e2e.RegisterScenarioRetries(ctx)
+	e2e.RegisterScenarioTimeouts(ctx)
+	e2e.RegisterFailureArtifacts(ctx, s.opts.ArtifactCollectors...)
+
+	if cleanupFn != nil {
+		s.registerScenarioCleanup(ctx, cleanupFn)
+	}
+
+	// the data streams are deleted once the resources of the scenario, which write them, are destroyed
+	if s.opts.CleanDataStreams {
+		e2e.RegisterDataStreamsCleanup(ctx, s.opts.DataStreams...)
+	}
+
+	// the stack upgraded by the scenario is restored once nothing else runs against it
+	ctx.After(func(c context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		s.restoreStack()
+		return c, nil
+	})
+}
+
+// registerScenarioCleanup adds the hooks destroying the resources deployed by a scenario after it,
+// or when the run is interrupted
+func (s *Suite) registerScenarioCleanup(ctx *godog.ScenarioContext, cleanupFn func() error) {
+	var scenarioCleanup *e2e.Cleanup
+
+	ctx.Before(func(c context.Context, sc *godog.Scenario) (context.Context, error) {
+		log.WithFields(log.Fields{
+			"suite": s.opts.Name,
+		}).Trace("Before scenario")
+
+		// the resources deployed by the scenario are destroyed if the run is interrupted
+		scenarioCleanup = e2e.RegisterCleanup(s.opts.Name+" scenario: "+sc.Name, cleanupFn)
+
+		return c, nil
+	})
+	ctx.After(func(c context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		log.WithFields(log.Fields{
+			"suite": s.opts.Name,
+		}).Trace("After scenario")
+
+		if scenarioCleanup == nil {
+			return c, nil
+		}
+
+		cleanUpErr := scenarioCleanup.Run()
+		if cleanUpErr != nil {
+			log.WithFields(log.Fields{
+				"error":    cleanUpErr,
+				"scenario": sc.Name,
+			}).Error("Could not destroy the resources of the scenario")
+		}
+
+		return c, nil
+	})
+}
+
+// beforeSuite runs the profile, reusing it in developer mode, and waits for the stack to be healthy
+func (s *Suite) beforeSuite() {
+	developerMode := e2e.IsDeveloperMode()
+	if developerMode {
+		log.Info("Running in Developer mode 💻: runtime dependencies between different test runs will be reused to speed up dev cycle")
+	}
+
+	log.WithFields(log.Fields{
+		"profile": s.opts.Profile,
+	}).Trace("Installing the runtime dependencies")
+
+	if s.opts.LocalImages != "" {
+		err := e2e.LoadLocalDockerImages(s.opts.LocalImages)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"artifact": s.opts.LocalImages,
+				"error":    err,
+			}).Warn("Could not load the local docker images, they will be pulled")
+		}
+	}
+
+	if s.opts.ProfileEnv != nil {
+		env, err := s.opts.ProfileEnv()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": s.opts.Profile,
+			}).Fatal("Could not configure the runtime dependencies for the profile")
+		}
+		s.ProfileEnv = env
+	} else {
+		s.ProfileEnv = map[string]string{
+			"stackVersion": s.opts.StackVersion,
+		}
+	}
+
+	if s.opts.PullServices != nil {
+		pullServices, pullEnv := s.opts.PullServices(s.ProfileEnv)
+
+		err := s.serviceManager.PullImages(s.opts.Profile, pullServices, pullEnv)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": s.opts.Profile,
+			}).Warn("Could not pull the images of the profile, they will be pulled when the services are run")
+		}
+	}
+
+	if !developerMode {
+		s.profileCleanup = e2e.RegisterCleanup(s.opts.Name+" profile", func() error {
+			log.WithFields(log.Fields{
+				"profile": s.opts.Profile,
+			}).Debug("Destroying the runtime dependencies")
+			return s.serviceManager.StopCompose(true, []string{s.opts.Profile})
+		})
+	}
+
+	if !e2e.ReuseProfile(s.opts.Profile, s.ProfileEnv) {
+		err := s.serviceManager.RunCompose(true, []string{s.opts.Profile}, s.ProfileEnv)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": s.opts.Profile,
+			}).Fatal("Could not run the runtime dependencies for the profile.")
+		}
+	}
+
+	healthy, err := e2e.WaitForElasticsearch(s.opts.Timeout)
+	if !healthy {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"timeout": s.opts.Timeout,
+		}).Fatal("The Elasticsearch cluster could not get the healthy status")
+	}
+
+	if s.opts.Kibana || s.opts.Fleet {
+		healthyKibana, err := services.NewKibanaClient().WaitForKibana(s.opts.Timeout)
+		if !healthyKibana {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"timeout": s.opts.Timeout,
+			}).Fatal("The Kibana instance could not get the healthy status")
+		}
+	}
+
+	if s.opts.Fleet {
+		err := kibana.NewClient().SetupFleet()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not initialise Fleet setup")
+		}
+	}
+
+	if s.opts.BeforeSuite != nil {
+		s.opts.BeforeSuite()
+	}
+}
+
+// restoreStack runs the stack upgraded by the scenario again in the version of the suite, setting
+// it up as the suite did before the first scenario
+func (s *Suite) restoreStack() {
+	restored, err := s.Steps.RestoreStack()
+	if !restored {
+		return
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"profile": s.opts.Profile,
+		}).Fatal("Could not restore the version of the upgraded stack")
+	}
+
+	if s.opts.Fleet {
+		err := kibana.NewClient().SetupFleet()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+			}).Fatal("Could not initialise Fleet setup")
+		}
+	}
+
+	if s.opts.BeforeSuite != nil {
+		s.opts.BeforeSuite()
+	}
+}
+
+// afterSuite destroys the profile, unless it's kept in developer mode
+func (s *Suite) afterSuite() {
+	if s.profileCleanup != nil {
+		err := s.profileCleanup.Run()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":   err,
+				"profile": s.opts.Profile,
+			}).Warn("Could not destroy the runtime dependencies for the profile.")
+		}
+	}
+
+	if s.opts.AfterSuite != nil {
+		s.opts.AfterSuite()
+	}
+
+	if e2e.IsDeveloperMode() {
+		e2e.PrintKeptProfile(s.opts.Profile)
+	}
+}
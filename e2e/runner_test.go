@@ -20,7 +20,7 @@ import (
 type contextMetadata struct {
 	name         string
 	modules      []string
-	contextFuncs []func(s *godog.Suite) // the functions that hold the steps for a specific
+	contextFuncs []func(s *godog.ScenarioContext) // the functions that hold the steps for a specific
 }
 
 func (c *contextMetadata) getFeaturePaths() []string {
@@ -54,13 +54,17 @@ func TestMain(m *testing.M) {
 
 	opt.Paths = featurePaths
 
-	status := godog.RunWithOptions("godog", func(s *godog.Suite) {
-		for _, metadata := range metadatas {
-			for _, f := range metadata.contextFuncs {
-				f(s)
+	status := godog.TestSuite{
+		Name: "godog",
+		ScenarioInitializer: func(s *godog.ScenarioContext) {
+			for _, metadata := range metadatas {
+				for _, f := range metadata.contextFuncs {
+					f(s)
+				}
 			}
-		}
-	}, opt)
+		},
+		Options: &opt,
+	}.Run()
 
 	if st := m.Run(); st > status {
 		status = st
@@ -0,0 +1,84 @@
+#!/usr/bin/env bash
+
+## Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+## or more contributor license agreements. Licensed under the Elastic License;
+## you may not use this file except in compliance with the Elastic License.
+
+set -uo pipefail
+#
+# Run the godog test suite in the current directory a number of times, as a Go test binary,
+# passing the arguments to godog, i.e. the --godog.format and --godog.tags flags. The key
+# durations measured by the scenarios, such as the enrollment of an agent, are aggregated
+# in a report with their percentiles, which is written to the standard output. The run fails if any iteration fails or if the measurements
+# exceed the SLOs.
+#
+# Environment variables:
+#   - BENCHMARK_ITERATIONS - number of times the scenarios are run. Default '10'.
+#   - BENCHMARK_SLOS - thresholds for the statistics of the measurements, in the
+#     name:statistic=threshold format, i.e. 'enrollment:p95=60s,policy-propagation:max=2m'.
+#     Default ''.
+#   - OP_RUN_ID - ID correlating the logs, state and containers of all the processes of the
+#     run, i.e. the tag of the CI build. Default: generated from the current time.
+#   - OUTPUTS_DIR - directory where the reports are written. Default 'outputs'.
+#
+
+BENCHMARK_ITERATIONS=${BENCHMARK_ITERATIONS:-10}
+BENCHMARK_SLOS=${BENCHMARK_SLOS:-}
+OP_RUN_ID=${OP_RUN_ID:-$(date -u +%Y%m%dT%H%M%S)-$(od -An -N3 -tx1 /dev/urandom | tr -d ' \n')}
+OUTPUTS_DIR=${OUTPUTS_DIR:-outputs}
+
+REPORT_FILE="${OUTPUTS_DIR}/benchmarks-report.txt"
+VIOLATIONS_FILE="${OUTPUTS_DIR}/slo-violations.txt"
+
+export BENCHMARK_ITERATIONS
+export BENCHMARK_SLOS
+export OP_RUN_ID
+export OUTPUTS_DIR
+
+## The suite binary runs its scenarios, and not its unit tests, even when no argument is passed to it
+export RUN_SCENARIOS=true
+
+mkdir -p "${OUTPUTS_DIR}"
+rm -f "${OUTPUTS_DIR}/benchmarks.tsv" "${REPORT_FILE}" "${VIOLATIONS_FILE}"
+
+## Build the test suite once, as it is run in every iteration
+SUITE_BINARY="$(mktemp -d)/suite.test"
+if ! go test -c -o "${SUITE_BINARY}" . ; then
+  echo "The test suite could not be built" >&2
+  exit 1
+fi
+
+failedIterations=0
+
+for ((iteration = 1; iteration <= BENCHMARK_ITERATIONS; iteration++)); do
+  echo "Running benchmark iteration ${iteration} of ${BENCHMARK_ITERATIONS}" >&2
+
+  output="${OUTPUTS_DIR}/benchmark-iteration-${iteration}.out"
+  if BENCHMARK_ITERATION=${iteration} "${SUITE_BINARY}" "$@" > "${output}"; then
+    rm -f "${output}"
+  else
+    failedIterations=$((failedIterations + 1))
+    echo "Benchmark iteration ${iteration} failed, see ${output}" >&2
+  fi
+done
+
+echo "Benchmark run finished, ${failedIterations} of ${BENCHMARK_ITERATIONS} iterations failed"
+
+if [[ -f "${REPORT_FILE}" ]]; then
+  echo ""
+  cat "${REPORT_FILE}"
+fi
+
+status=0
+if [[ ${failedIterations} -gt 0 ]]; then
+  status=1
+fi
+
+if [[ -s "${VIOLATIONS_FILE}" ]]; then
+  echo ""
+  echo "The measurements exceeded the SLOs:"
+  cat "${VIOLATIONS_FILE}"
+  status=1
+fi
+
+exit ${status}
@@ -0,0 +1,160 @@
+#!/usr/bin/env bash
+
+## Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+## or more contributor license agreements. Licensed under the Elastic License;
+## you may not use this file except in compliance with the Elastic License.
+
+set -uo pipefail
+#
+# Run the godog test suite in the current directory as a Go test binary, passing the arguments
+# to godog, i.e. the --godog.format and --godog.tags flags, and the feature files. The output
+# of godog is written to the standard output.
+#
+# Flags:
+#   - --parallel N - number of workers running the scenarios in parallel, overriding the
+#     PARALLEL environment variable. It's not passed to godog.
+#
+# Environment variables:
+#   - OP_RUN_ID - ID correlating the logs, state and containers of all the processes of the
+#     run, i.e. the tag of the CI build. Default: generated from the current time.
+#   - OUTPUTS_DIR - directory where the reports are written. Default 'outputs'.
+#   - PARALLEL - number of workers running the scenarios in parallel, each one in an isolated
+#     environment: its own docker-compose projects, state and host ports. Default '1'.
+#   - REPORTS_DIR - directory where the JUnit and HTML reports of the suite are written.
+#     Default: the reports dir of OUTPUTS_DIR.
+#   - SCENARIO_RETRIES - number of times the failed scenarios are retried. Default '0'. The
+#     scenarios passing on retry are listed as flaky in the flaky-scenarios.json file of OUTPUTS_DIR.
+#
+
+OP_RUN_ID=${OP_RUN_ID:-$(date -u +%Y%m%dT%H%M%S)-$(od -An -N3 -tx1 /dev/urandom | tr -d ' \n')}
+OUTPUTS_DIR=${OUTPUTS_DIR:-outputs}
+PARALLEL=${PARALLEL:-1}
+SCENARIO_RETRIES=${SCENARIO_RETRIES:-0}
+
+## Consume the flags of this script, passing the rest of the arguments to godog
+GODOG_ARGS=()
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --parallel)
+      PARALLEL="${2:-}"
+      shift 2 || shift
+      ;;
+    --parallel=*)
+      PARALLEL="${1#*=}"
+      shift
+      ;;
+    *)
+      GODOG_ARGS+=("$1")
+      shift
+      ;;
+  esac
+done
+set -- "${GODOG_ARGS[@]+"${GODOG_ARGS[@]}"}"
+
+if ! [[ ${PARALLEL} =~ ^[1-9][0-9]*$ ]]; then
+  echo "The number of workers must be a positive integer: '${PARALLEL}'" >&2
+  exit 1
+fi
+
+RERUN_FILE="${OUTPUTS_DIR}/rerun.txt"
+FLAKY_FILE="${OUTPUTS_DIR}/flaky-scenarios.txt"
+
+export OP_RUN_ID
+export OUTPUTS_DIR
+
+## The suite binary runs its scenarios, and not its unit tests, even when no argument is passed to it
+export RUN_SCENARIOS=true
+
+mkdir -p "${OUTPUTS_DIR}"
+rm -f "${RERUN_FILE}" "${FLAKY_FILE}" "${OUTPUTS_DIR}/flaky-scenarios.json" "${OUTPUTS_DIR}/failed-scenarios.jsonl"
+
+## Build the test suite once, as it could be run several times, i.e. by the workers or the retries
+SUITE_BINARY="$(mktemp -d)/suite.test"
+if ! go test -c -o "${SUITE_BINARY}" . ; then
+  echo "The test suite could not be built" >&2
+  exit 1
+fi
+
+## List the scenarios of the feature files as godog arguments, i.e. features/fleet_mode_agent.feature:12,
+## so that the scenarios of a feature file can run in different workers. Every keyword of a scenario
+## in Gherkin is matched: Scenario, Example, Scenario Outline and Scenario Template. The examples of
+## an outline are run together. A feature file without scenarios found is listed as a whole, so that
+## it's still run by a worker
+list_scenarios() {
+  local feature
+  find features -name '*.feature' | sort | while IFS= read -r feature; do
+    awk -v feature="${feature}" '
+      /^[[:space:]]*(Scenario|Example|Scenario Outline|Scenario Template):/ { print feature ":" NR; found = 1 }
+      END { if (!found) print feature }
+    ' "${feature}"
+  done
+}
+
+## Run the scenarios, or the feature files, distributing them among the workers, in a round-robin
+## manner. The tags are still applied by each worker, so a worker could have no scenario to run
+run_in_parallel() {
+  local scenarios=()
+  while IFS= read -r scenario; do
+    scenarios+=("${scenario}")
+  done < <(list_scenarios)
+
+  local pids=()
+  for ((worker = 1; worker <= PARALLEL; worker++)); do
+    local shard=()
+    for ((i = worker - 1; i < ${#scenarios[@]}; i += PARALLEL)); do
+      shard+=("${scenarios[$i]}")
+    done
+
+    if [[ ${#shard[@]} -eq 0 ]]; then
+      continue
+    fi
+
+    echo "Worker ${worker} runs: ${shard[*]}" >&2
+    OP_WORKER_ID=${worker} "${SUITE_BINARY}" "$@" "${shard[@]}" > "${OUTPUTS_DIR}/worker-${worker}.out" &
+    pids+=($!)
+  done
+
+  local status=0
+  for pid in "${pids[@]}"; do
+    if ! wait "${pid}"; then
+      status=1
+    fi
+  done
+
+  ## Write the output of the workers one after another, so that they are not interleaved
+  for ((worker = 1; worker <= PARALLEL; worker++)); do
+    if [[ -f "${OUTPUTS_DIR}/worker-${worker}.out" ]]; then
+      cat "${OUTPUTS_DIR}/worker-${worker}.out"
+      rm -f "${OUTPUTS_DIR}/worker-${worker}.out"
+    fi
+  done
+
+  return ${status}
+}
+
+if [[ ${PARALLEL} -gt 1 ]]; then
+  run_in_parallel "$@"
+else
+  "${SUITE_BINARY}" "$@"
+fi
+status=$?
+
+attempt=0
+while [[ ${status} -ne 0 && ${attempt} -lt ${SCENARIO_RETRIES} && -s "${RERUN_FILE}" ]]; do
+  attempt=$((attempt + 1))
+  scenarios=$(sort -u "${RERUN_FILE}")
+  rm -f "${RERUN_FILE}"
+
+  echo "Retrying failed scenarios (attempt ${attempt} of ${SCENARIO_RETRIES}):" ${scenarios} >&2
+  # shellcheck disable=SC2086
+  SCENARIO_RETRY_ATTEMPT=${attempt} "${SUITE_BINARY}" "$@" ${scenarios}
+  status=$?
+done
+
+## The scenarios passing on retry do not fail the run, but they are not silently green either
+if [[ -s "${FLAKY_FILE}" ]]; then
+  echo "Flaky scenarios, which passed after a retry (see ${OUTPUTS_DIR}/flaky-scenarios.json):" >&2
+  cut -f1,3 "${FLAKY_FILE}" | sed 's/^/  /' >&2
+fi
+
+exit ${status}
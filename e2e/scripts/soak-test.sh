@@ -0,0 +1,94 @@
+#!/usr/bin/env bash
+
+## Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+## or more contributor license agreements. Licensed under the Elastic License;
+## you may not use this file except in compliance with the Elastic License.
+
+set -uo pipefail
+#
+# Run the godog test suite in the current directory in a loop, for a period of time, as a Go
+# test binary, passing the arguments to godog, i.e. the --godog.format and --godog.tags flags.
+# A summary of the failures and of the resource usage of the containers over time is written
+# to the standard output, while the output of the failed iterations is kept in the outputs dir.
+#
+# Environment variables:
+#   - OP_RUN_ID - ID correlating the logs, state and containers of all the processes of the
+#     run, i.e. the tag of the CI build. Default: generated from the current time.
+#   - OUTPUTS_DIR - directory where the reports are written. Default 'outputs'.
+#   - SOAK_DURATION - period of time the scenarios are repeated, in hours, minutes or
+#     seconds, i.e. '8h', '30m' or '90s'. Default '8h'.
+#
+
+OP_RUN_ID=${OP_RUN_ID:-$(date -u +%Y%m%dT%H%M%S)-$(od -An -N3 -tx1 /dev/urandom | tr -d ' \n')}
+OUTPUTS_DIR=${OUTPUTS_DIR:-outputs}
+SOAK_DURATION=${SOAK_DURATION:-8h}
+
+SCENARIOS_FILE="${OUTPUTS_DIR}/soak-scenarios.tsv"
+RESOURCES_FILE="${OUTPUTS_DIR}/soak-resources.tsv"
+
+export OP_RUN_ID
+export OUTPUTS_DIR
+
+## The suite binary runs its scenarios, and not its unit tests, even when no argument is passed to it
+export RUN_SCENARIOS=true
+
+## Convert a duration, i.e. '8h', to seconds
+to_seconds() {
+  local duration=$1
+  case "${duration}" in
+    *h) echo $((${duration%h} * 3600)) ;;
+    *m) echo $((${duration%m} * 60)) ;;
+    *s) echo "${duration%s}" ;;
+    *) echo "${duration}" ;;
+  esac
+}
+
+mkdir -p "${OUTPUTS_DIR}"
+rm -f "${SCENARIOS_FILE}" "${RESOURCES_FILE}"
+
+## Build the test suite once, as it is run in every iteration
+SUITE_BINARY="$(mktemp -d)/suite.test"
+if ! go test -c -o "${SUITE_BINARY}" . ; then
+  echo "The test suite could not be built" >&2
+  exit 1
+fi
+
+end=$(($(date +%s) + $(to_seconds "${SOAK_DURATION}")))
+iteration=0
+failedIterations=0
+
+while [[ $(date +%s) -lt ${end} ]]; do
+  iteration=$((iteration + 1))
+  echo "Running soak iteration ${iteration}, $(((end - $(date +%s)) / 60)) minutes left" >&2
+
+  output="${OUTPUTS_DIR}/soak-iteration-${iteration}.out"
+  if SOAK_ITERATION=${iteration} "${SUITE_BINARY}" "$@" > "${output}"; then
+    ## Keep the output of the failed iterations only, as the run could last for hours
+    rm -f "${output}"
+  else
+    failedIterations=$((failedIterations + 1))
+    echo "Soak iteration ${iteration} failed, see ${output}" >&2
+  fi
+done
+
+echo "Soak run finished after ${iteration} iterations, ${failedIterations} of them failed"
+
+if [[ -s "${SCENARIOS_FILE}" ]]; then
+  echo ""
+  echo "Failures by iteration:"
+  awk -F'\t' '{ runs[$2]++; if ($3 == "failed") failures[$2]++ }
+    END { for (i in runs) printf "  iteration %s: %d of %d scenarios failed\n", i, failures[i], runs[i] }' \
+    "${SCENARIOS_FILE}" | sort -t' ' -k2 -n
+fi
+
+if [[ -s "${RESOURCES_FILE}" ]]; then
+  echo ""
+  echo "Memory usage by container (first sample, last sample, max):"
+  awk -F'\t' '{ if (!($3 in first)) first[$3] = $5; last[$3] = $5; if ($5 > max[$3]) max[$3] = $5 }
+    END { for (c in first) printf "  %s: %.1f MiB, %.1f MiB, %.1f MiB\n", c, first[c] / 1048576, last[c] / 1048576, max[c] / 1048576 }' \
+    "${RESOURCES_FILE}" | sort
+fi
+
+if [[ ${failedIterations} -gt 0 ]]; then
+  exit 1
+fi
@@ -0,0 +1,112 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/docker/docker/api/types"
+	"github.com/elastic/e2e-testing/cli/docker"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// soakScenariosFileName name of the file where the results of the scenarios of a soak run are stored,
+// one line per execution: time, iteration, status, duration, location and name
+const soakScenariosFileName = "soak-scenarios.tsv"
+
+// soakResourcesFileName name of the file where the resource usage of the containers of a soak run
+// is stored, one line per sample: time, iteration, container, CPU percentage, memory bytes and processes
+const soakResourcesFileName = "soak-resources.tsv"
+
+// GetSoakIteration returns the iteration of the soak run, read from the SOAK_ITERATION environment
+// variable. It returns 0 when the scenarios are not run in soak mode
+func GetSoakIteration() int {
+	return shell.GetEnvInteger("SOAK_ITERATION", 0)
+}
+
+// RegisterSoakMonitor adds hooks to the suite that, in soak mode, record the result of each scenario
+// and sample the resource usage of the containers of the docker-compose projects after it, so that
+// failures and leaks can be tracked over the whole soak run. It must be called before registering
+// the hooks that clean up the scenarios, so that the containers are sampled before being removed
+func RegisterSoakMonitor(s *godog.ScenarioContext) {
+	iteration := GetSoakIteration()
+	if iteration == 0 {
+		return
+	}
+
+	var start time.Time
+
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		start = time.Now()
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		now := time.Now().UTC().Format(time.RFC3339)
+
+		status := "passed"
+		if err != nil {
+			status = "failed"
+		}
+
+		_ = appendToOutputsFile(soakScenariosFileName, fmt.Sprintf("%s\t%d\t%s\t%.0f\t%s\t%s",
+			now, iteration, status, time.Since(start).Seconds(), getScenarioLocation(pickle), pickle.Name))
+
+		for _, project := range getComposeProjects() {
+			containers, err := docker.ListComposeContainers(project)
+			if err != nil {
+				continue
+			}
+
+			for _, container := range containers {
+				if container.State != "running" {
+					continue
+				}
+
+				statsCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				stats, err := docker.GetContainerStats(statsCtx, container.ID)
+				cancel()
+				if err != nil {
+					continue
+				}
+
+				name := strings.TrimPrefix(container.Names[0], "/")
+
+				_ = appendToOutputsFile(soakResourcesFileName, fmt.Sprintf("%s\t%d\t%s\t%.2f\t%d\t%d",
+					now, iteration, name, getCPUPercentage(stats), stats.MemoryStats.Usage, stats.PidsStats.Current))
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"iteration": iteration,
+			"scenario":  pickle.Name,
+			"status":    status,
+		}).Debug("Soak results recorded for the scenario")
+
+		return ctx, nil
+	})
+}
+
+// getCPUPercentage calculates the usage of the CPUs of a container, in the same manner "docker stats" does
+func getCPUPercentage(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+
+	return cpuDelta / systemDelta * cpus * 100
+}
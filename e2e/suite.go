@@ -0,0 +1,155 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/cucumber/godog/colors"
+	"github.com/elastic/e2e-testing/cli/config"
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+)
+
+// RunSuite runs the scenarios of a test suite with godog, returning the exit status of the run.
+// It must be called from the TestMain function of the suite, once the flags of the tests are
+// defined. The options are read from the command line flags prefixed by "godog.", i.e.
+// --godog.tags="@nginx && ~@skip", and the feature files from the arguments, defaulting to
+// the "features" dir of the suite. The scenarios of a test process share the runtime
+// dependencies of the suite, so running them concurrently with the --godog.concurrency flag
+// is only safe for suites whose steps do not keep state between scenarios. The resources registered
+// with RegisterCleanup are destroyed if the run is interrupted or panics. Once the scenarios are run,
+// their JUnit and HTML reports are written to the dir set with the --reports.dir flag. The resources
+// created by the tool are labelled with the names of the suite and the running scenario. The runtime
+// dependencies of the suite are kept running after it with the --keep-stack flag. The run is driven
+// and observed by the orchestration systems with the control API, listening at the --control.addr flag.
+// The files cached in the downloads dir of the workspace are downloaded again with the --refresh flag.
+// The examples tagged with an expander registered with RegisterExamplesExpander get their generated
+// rows appended before the run
+func RunSuite(name string, testSuiteInitializer func(*godog.TestSuiteContext), scenarioInitializer func(*godog.ScenarioContext)) int {
+	handleInterruptions()
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{
+				"panic": r,
+				"suite": name,
+			}).Error("The test suite panicked, cleaning up the deployed resources")
+			RunCleanups()
+			panic(r)
+		}
+	}()
+
+	opts := godog.Options{
+		Output: colors.Colored(os.Stdout),
+	}
+
+	godog.BindFlags("godog.", flag.CommandLine, &opts)
+	flag.StringVar(&artifactsSource, "artifacts.source", "", "Sets the source of the packages: api, release, snapshots, staging or local (default: ARTIFACTS_SOURCE, or api)")
+	flag.StringVar(&artifactsBuildID, "artifacts.build-id", "", "Sets the build of the snapshots or the staging candidate the packages are downloaded from, i.e. 8.0.0-59098054 (default: ARTIFACTS_BUILD_ID)")
+	flag.BoolVar(&verifySignatures, "artifacts.verify-signatures", false, "Verifies the downloaded packages against their GPG signatures (default: ARTIFACTS_VERIFY_SIGNATURES)")
+	flag.StringVar(&controlAddr, "control.addr", "", "Sets the address the control API of the runner listens at, i.e. :8090, disabled if empty (default: CONTROL_API_ADDR)")
+	flag.BoolVar(&controlWait, "control.wait", false, "Waits for the start request of the control API before running the scenarios (default: CONTROL_API_WAIT)")
+	flag.BoolVar(&keepStack, "keep-stack", developerModeFromEnv(), "Keeps the runtime dependencies of the suite running after it, reusing them in the next runs (default: DEVELOPER_MODE)")
+	flag.BoolVar(&refreshDownloads, "refresh", false, "Downloads the files again, ignoring the ones cached in the downloads dir of the workspace (default: DOWNLOAD_CACHE_REFRESH)")
+	flag.StringVar(&reportsDir, "reports.dir", "", "Sets the dir where the JUnit and HTML reports are written (default: REPORTS_DIR, or the reports dir of OUTPUTS_DIR)")
+	flag.Parse()
+
+	if len(flag.Args()) > 0 {
+		opts.Paths = flag.Args()
+	}
+
+	if fsys, paths := expandFeatures(opts.Paths); fsys != nil {
+		opts.FS = fsys
+		opts.Paths = paths
+	}
+
+	log.WithFields(log.Fields{
+		"concurrency": opts.Concurrency,
+		"paths":       opts.Paths,
+		"suite":       name,
+		"tags":        opts.Tags,
+	}).Debug("Running the test suite")
+
+	report.name = name
+	report.start = time.Now()
+
+	config.SetRunScope(name, "")
+
+	startTracing()
+	defer stopTracing()
+
+	err := startControlServer()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"suite": name,
+		}).Warn("Could not start the control API of the runner, the suite runs without it")
+	}
+
+	control.waitForStart()
+
+	status := godog.TestSuite{
+		Name:                 name,
+		TestSuiteInitializer: testSuiteInitializer,
+		ScenarioInitializer: func(s *godog.ScenarioContext) {
+			control.register(s)
+			registerRunScope(s, name)
+			report.registerStart(s)
+			registerIngestMonitor(s)
+			registerTracingStart(s)
+			scenarioInitializer(s)
+			registerTracingEnd(s)
+			report.registerEnd(s)
+		},
+		Options: &opts,
+	}.Run()
+
+	_ = report.write()
+
+	control.stop()
+
+	return status
+}
+
+// IsSuiteRequested reports if the test process of a suite must run its scenarios, which is the case
+// when it gets any argument but the flags of go test, i.e. the feature files or the godog. flags, or
+// when the RUN_SCENARIOS env var is true, as the scripts running the suites set it. Otherwise the
+// TestMain function of the suite runs its unit tests only, which do not need the runtime dependencies
+func IsSuiteRequested() bool {
+	if run, err := shell.GetEnvBool("RUN_SCENARIOS"); err == nil {
+		return run
+	}
+
+	for _, arg := range os.Args[1:] {
+		if !strings.HasPrefix(arg, "-test.") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registerRunScope adds the hooks setting the scenario running in the scope of the run, so that the
+// resources created by its steps are labelled with it. They must be added before the hooks of the
+// suite, which bring the services up. The scope is shared by the concurrent scenarios, so their
+// resources are labelled with any of them
+func registerRunScope(s *godog.ScenarioContext, suite string) {
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		config.SetRunScope(suite, pickle.Name)
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		config.SetRunScope(suite, "")
+
+		return ctx, nil
+	})
+}
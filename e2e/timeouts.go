@@ -0,0 +1,293 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// timeoutTagPrefix prefix of the tags used to set the timeout of a scenario, i.e. @timeout-10m
+const timeoutTagPrefix = "@timeout-"
+
+// scenarioWatchdog keeps the deadline of the running scenario
+type scenarioWatchdog struct {
+	cancel     context.CancelFunc
+	ctx        context.Context
+	deadline   time.Time
+	done       chan struct{}
+	failed     bool
+	mutex      sync.Mutex
+	pickle     *godog.Scenario
+	start      time.Time
+	step       string
+	timedOut   bool
+	waitCapped bool
+}
+
+var watchdog = &scenarioWatchdog{}
+
+// GetScenarioTimeout returns the timeout of a scenario, read from its @timeout-<duration> tag,
+// i.e. @timeout-10m, or from the SCENARIO_TIMEOUT environment variable if the scenario is not
+// tagged. A zero value means that the scenario has no timeout
+func GetScenarioTimeout(pickle *godog.Scenario) time.Duration {
+	for _, tag := range pickle.Tags {
+		if !strings.HasPrefix(tag.Name, timeoutTagPrefix) {
+			continue
+		}
+
+		timeout, err := time.ParseDuration(strings.TrimPrefix(tag.Name, timeoutTagPrefix))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err,
+				"scenario": pickle.Name,
+				"tag":      tag.Name,
+			}).Warn("The timeout tag is not valid, it will be ignored")
+			continue
+		}
+
+		return timeout
+	}
+
+	defaultTimeout := shell.GetEnv("SCENARIO_TIMEOUT", "")
+	if defaultTimeout == "" {
+		return 0
+	}
+
+	timeout, err := time.ParseDuration(defaultTimeout)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"timeout": defaultTimeout,
+		}).Warn("SCENARIO_TIMEOUT is not a valid duration, it will be ignored")
+		return 0
+	}
+
+	return timeout
+}
+
+// ScenarioContext returns the context of the running scenario, which is cancelled when
+// the scenario exceeds its timeout. It returns a background context if there is no
+// running scenario
+func ScenarioContext() context.Context {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+
+	if watchdog.ctx == nil {
+		return context.Background()
+	}
+
+	return watchdog.ctx
+}
+
+// Step adds a step to a scenario, which fails as soon as the context of the scenario is done, i.e.
+// when it exceeds its timeout or it's aborted, even if the step hangs, so that the scenario fails
+// cleanly instead of blocking the suite
+func Step(s *godog.ScenarioContext, expr interface{}, stepFunc interface{}) {
+	s.Step(expr, utils.WithContextDeadline(stepFunc, ScenarioContext))
+}
+
+// capToScenarioDeadline caps the duration of a wait to the time left before the running
+// scenario exceeds its timeout
+func capToScenarioDeadline(d time.Duration) time.Duration {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+
+	if watchdog.ctx == nil || watchdog.deadline.IsZero() {
+		return d
+	}
+
+	remaining := time.Until(watchdog.deadline)
+	if remaining >= d {
+		return d
+	}
+
+	watchdog.waitCapped = true
+
+	// a zero value would mean waiting forever
+	if remaining < time.Millisecond {
+		return time.Millisecond
+	}
+
+	return remaining
+}
+
+// RegisterScenarioTimeouts adds hooks to the suite that enforce the timeout of each scenario.
+// When a scenario exceeds it, its context is cancelled, the waits on it are stopped, the running
+// step fails if it was added with Step, and the diagnostics of the running step are written to
+// the outputs dir of the scenario. The context of the scenario, with its deadline, is passed to
+// the steps accepting a context.Context as first argument
+func RegisterScenarioTimeouts(s *godog.ScenarioContext) {
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		timeout := GetScenarioTimeout(pickle)
+
+		watchdog.mutex.Lock()
+		defer watchdog.mutex.Unlock()
+
+		watchdog.pickle = pickle
+		watchdog.start = time.Now()
+		watchdog.step = ""
+		watchdog.failed = false
+		watchdog.timedOut = false
+		watchdog.waitCapped = false
+		watchdog.done = make(chan struct{})
+
+		if timeout <= 0 {
+			watchdog.deadline = time.Time{}
+			watchdog.ctx, watchdog.cancel = context.WithCancel(ctx)
+			return watchdog.ctx, nil
+		}
+
+		watchdog.deadline = watchdog.start.Add(timeout)
+		watchdog.ctx, watchdog.cancel = context.WithDeadline(ctx, watchdog.deadline)
+
+		go watchScenario(watchdog.ctx, watchdog.done, timeout)
+
+		return watchdog.ctx, nil
+	})
+
+	s.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		watchdog.mutex.Lock()
+		defer watchdog.mutex.Unlock()
+
+		// keep the failed step, as the steps after it are skipped
+		if !watchdog.failed {
+			watchdog.step = step.Text
+		}
+
+		return ctx, nil
+	})
+
+	s.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
+		watchdog.mutex.Lock()
+		defer watchdog.mutex.Unlock()
+
+		if status == godog.StepFailed {
+			watchdog.failed = true
+		}
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		watchdog.mutex.Lock()
+		defer watchdog.mutex.Unlock()
+
+		if watchdog.cancel == nil {
+			return ctx, nil
+		}
+
+		close(watchdog.done)
+		deadlineExceeded := watchdog.ctx.Err() == context.DeadlineExceeded
+		watchdog.cancel()
+
+		// the scenario could fail because of the deadline before the watchdog fires, i.e. when
+		// a wait was cut short by it, or when a step returned as soon as the context was done
+		if err != nil && !watchdog.timedOut && (watchdog.waitCapped || deadlineExceeded) {
+			elapsedTime := time.Since(watchdog.start)
+
+			log.WithFields(log.Fields{
+				"elapsedTime": elapsedTime,
+				"error":       err,
+				"scenario":    pickle.Name,
+				"step":        watchdog.step,
+			}).Error("The scenario failed because it reached its timeout")
+
+			_ = writeTimeoutDiagnostics(pickle, watchdog.step, watchdog.deadline.Sub(watchdog.start), elapsedTime)
+		}
+
+		watchdog.cancel = nil
+		watchdog.ctx = nil
+
+		return ctx, nil
+	})
+}
+
+// watchScenario waits for the scenario to finish, capturing the diagnostics when it exceeds the timeout
+func watchScenario(ctx context.Context, done chan struct{}, timeout time.Duration) {
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+	}
+
+	watchdog.mutex.Lock()
+	select {
+	case <-done:
+		// the scenario already finished, and it will report the timeout
+		watchdog.mutex.Unlock()
+		return
+	default:
+	}
+
+	watchdog.timedOut = true
+	pickle := watchdog.pickle
+	step := watchdog.step
+	elapsedTime := time.Since(watchdog.start)
+	watchdog.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"elapsedTime": elapsedTime,
+		"scenario":    pickle.Name,
+		"step":        step,
+		"timeout":     timeout,
+	}).Error("The scenario exceeded its timeout, cancelling it")
+
+	_ = writeTimeoutDiagnostics(pickle, step, timeout, elapsedTime)
+}
+
+// writeTimeoutDiagnostics writes the running step and the stack traces of the goroutines
+// into the outputs dir of the scenario
+func writeTimeoutDiagnostics(pickle *godog.Scenario, step string, timeout time.Duration, elapsedTime time.Duration) error {
+	scenarioDir, err := GetScenarioOutputsDir(pickle.Name)
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(scenarioDir, "timeout.log")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Error("Could not create the timeout diagnostics file")
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "Scenario: %s\nLocation: %s\nStep: %s\nTimeout: %s\nElapsed time: %s\n\n",
+		pickle.Name, getScenarioLocation(pickle), step, timeout, elapsedTime)
+
+	err = pprof.Lookup("goroutine").WriteTo(f, 2)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"file":  filePath,
+		}).Error("Could not write the stack traces to the timeout diagnostics file")
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"file":     filePath,
+		"scenario": pickle.Name,
+	}).Info("Timeout diagnostics written")
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"context"
+
+	"github.com/cucumber/godog"
+	"github.com/elastic/e2e-testing/cli/services"
+	"github.com/elastic/e2e-testing/e2e/internal/tracing"
+)
+
+// startTracing starts tracing the scenarios of the suite in Elastic APM, if it's enabled, with the
+// operations of the service managers as spans of the running steps
+func startTracing() {
+	err := tracing.Start()
+	if err != nil {
+		return
+	}
+
+	services.SetSpanStarter(func(name string, labels map[string]string) func(err error) {
+		span := tracing.StartSpan(name, "app.services", labels)
+
+		return func(err error) {
+			tracing.EndSpan(span, err)
+		}
+	})
+}
+
+// stopTracing sends the pending traces of the suite to Elastic APM
+func stopTracing() {
+	services.SetSpanStarter(nil)
+	tracing.Stop()
+}
+
+// registerTracingStart adds the hooks starting the transactions of the scenarios and the spans of
+// their steps. They must be added before the hooks of the suite, so that their operations are traced
+func registerTracingStart(s *godog.ScenarioContext) {
+	s.Before(func(ctx context.Context, pickle *godog.Scenario) (context.Context, error) {
+		report.mutex.Lock()
+		labels := map[string]string{
+			"feature": pickle.Uri,
+			"suite":   report.name,
+		}
+		for _, property := range report.runProperties() {
+			labels[property.Name] = property.Value
+		}
+		report.mutex.Unlock()
+
+		tracing.StartScenario(pickle.Name, labels)
+
+		return ctx, nil
+	})
+
+	s.StepContext().Before(func(ctx context.Context, step *godog.Step) (context.Context, error) {
+		tracing.StartStep(step.Text)
+
+		return ctx, nil
+	})
+}
+
+// registerTracingEnd adds the hooks ending the transactions of the scenarios and the spans of their
+// steps. They must be added after the hooks of the suite, so that their operations are traced
+func registerTracingEnd(s *godog.ScenarioContext) {
+	s.StepContext().After(func(ctx context.Context, step *godog.Step, status godog.StepResultStatus, err error) (context.Context, error) {
+		tracing.EndStep(err)
+
+		return ctx, nil
+	})
+
+	s.After(func(ctx context.Context, pickle *godog.Scenario, err error) (context.Context, error) {
+		tracing.EndScenario(err)
+
+		return ctx, nil
+	})
+}
@@ -5,25 +5,40 @@
 package e2e
 
 import (
-	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
 	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/elastic/e2e-testing/cli/docker"
 	curl "github.com/elastic/e2e-testing/cli/shell"
+	"github.com/elastic/e2e-testing/e2e/internal/artifacts"
+	"github.com/elastic/e2e-testing/e2e/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
+// defaultDownloadIdleTimeout time after which a download not receiving data is considered stalled.
+// It can be overriden by DOWNLOAD_IDLE_TIMEOUT env var
+const defaultDownloadIdleTimeout = time.Minute
+
+// defaultDownloadTimeout max time spent downloading a file, including the retries.
+// It can be overriden by DOWNLOAD_TIMEOUT env var
+const defaultDownloadTimeout = 10 * time.Minute
+
+var downloadClient *http.Client
+var downloadClientOnce sync.Once
+
 //nolint:unused
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
@@ -31,24 +46,11 @@ const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 var seededRand *rand.Rand = rand.New(
 	rand.NewSource(time.Now().UnixNano()))
 
-// GetExponentialBackOff returns a preconfigured exponential backoff instance
+// GetExponentialBackOff returns the exponential backoff with jitter shared by the retries.
+// If the running scenario has a timeout, the elapsed time is capped to the time left
+// before exceeding it, so that a wait cannot outlive the scenario
 func GetExponentialBackOff(elapsedTime time.Duration) *backoff.ExponentialBackOff {
-	var (
-		initialInterval     = 500 * time.Millisecond
-		randomizationFactor = 0.5
-		multiplier          = 2.0
-		maxInterval         = 5 * time.Second
-		maxElapsedTime      = elapsedTime
-	)
-
-	exp := backoff.NewExponentialBackOff()
-	exp.InitialInterval = initialInterval
-	exp.RandomizationFactor = randomizationFactor
-	exp.Multiplier = multiplier
-	exp.MaxInterval = maxInterval
-	exp.MaxElapsedTime = maxElapsedTime
-
-	return exp
+	return utils.NewExponentialBackOff(capToScenarioDeadline(elapsedTime))
 }
 
 // GetElasticArtifactVersion returns the current version:
@@ -136,76 +138,19 @@ func GetElasticArtifactVersion(version string) string {
 // i.e. GetElasticArtifactURL("elastic-agent", "8.0.0-SNAPSHOT", "x86_64", "rpm")
 // i.e. GetElasticArtifactURL("elastic-agent", "8.0.0-SNAPSHOT", "amd64", "deb")
 func GetElasticArtifactURL(artifact string, version string, operativeSystem string, arch string, extension string) (string, error) {
-	exp := GetExponentialBackOff(time.Minute)
-
-	retryCount := 1
-
-	body := ""
-
-	apiStatus := func() error {
-		r := curl.HTTPRequest{
-			URL: fmt.Sprintf("https://artifacts-api.elastic.co/v1/search/%s/%s?x-elastic-no-kpi=true", version, artifact),
-		}
-
-		response, err := curl.Get(r)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"artifact":       artifact,
-				"version":        version,
-				"os":             operativeSystem,
-				"arch":           arch,
-				"extension":      extension,
-				"error":          err,
-				"retry":          retryCount,
-				"statusEndpoint": r.URL,
-				"elapsedTime":    exp.GetElapsedTime(),
-			}).Warn("The Elastic artifacts API is not available yet")
-
-			retryCount++
-
-			return err
-		}
-
-		log.WithFields(log.Fields{
-			"retries":        retryCount,
-			"statusEndpoint": r.URL,
-			"elapsedTime":    exp.GetElapsedTime(),
-		}).Debug("The Elastic artifacts API is available")
-
-		body = response
-		return nil
+	pkg := Package{
+		Arch:      arch,
+		Extension: extension,
+		Name:      artifact,
+		OS:        operativeSystem,
+		Version:   version,
 	}
 
-	err := backoff.Retry(apiStatus, exp)
+	downloadURL, _, err := GetArtifactsClient().ResolvePackage(pkg)
 	if err != nil {
 		return "", err
 	}
 
-	jsonParsed, err := gabs.ParseJSON([]byte(body))
-	if err != nil {
-		log.WithFields(log.Fields{
-			"artifact":  artifact,
-			"version":   version,
-			"os":        operativeSystem,
-			"arch":      arch,
-			"extension": extension,
-		}).Error("Could not parse the response body for the artifact")
-		return "", err
-	}
-
-	// elastic-agent-8.0.0-SNAPSHOT-linux-x86_64.tar.gz
-	artifactPath := fmt.Sprintf("%s-%s-%s-%s.%s", artifact, version, operativeSystem, arch, extension)
-	if extension == "deb" || extension == "rpm" {
-		// elastic-agent-8.0.0-SNAPSHOT-x86_64.rpm
-		// elastic-agent-8.0.0-SNAPSHOT-amd64.deb
-		artifactPath = fmt.Sprintf("%s-%s-%s.%s", artifact, version, arch, extension)
-	}
-
-	packagesObject := jsonParsed.Path("packages")
-	// we need to get keys with dots using Search instead of Path
-	downloadObject := packagesObject.Search(artifactPath)
-	downloadURL := downloadObject.Path("url").Data().(string)
-
 	return downloadURL, nil
 }
 
@@ -331,8 +276,9 @@ func GetObjectURLFromBucket(bucket string, object string, maxtimeout time.Durati
 }
 
 // DownloadFile will download a url and store it in a temporary path.
-// It writes to the destination file as it downloads it, without
-// loading the entire file into memory.
+// The file is downloaded into the cache of the artifacts client, shared by the suites across
+// test runs, and copied to the temporary path, as the callers could modify or remove it.
+// If the file exists in the local artifacts path, it's copied instead.
 func DownloadFile(url string) (string, error) {
 	tempFile, err := ioutil.TempFile(os.TempDir(), path.Base(url))
 	if err != nil {
@@ -346,64 +292,83 @@ func DownloadFile(url string) (string, error) {
 
 	filepath := tempFile.Name()
 
-	exp := GetExponentialBackOff(3)
-
-	retryCount := 1
-	var fileReader io.ReadCloser
-
-	download := func() error {
-		resp, err := http.Get(url)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"elapsedTime": exp.GetElapsedTime(),
-				"error":       err,
-				"path":        filepath,
-				"retry":       retryCount,
-				"url":         url,
-			}).Warn("Could not download the file")
+	// the artifacts client looks up the file in the local artifacts path before downloading it
+	cachedPath, err := GetArtifactsClient().Download(url, "")
+	if err != nil {
+		return filepath, err
+	}
 
-			retryCount++
+	cachedFile, err := os.Open(cachedPath)
+	if err != nil {
+		return filepath, err
+	}
+	defer cachedFile.Close()
 
-			return err
-		}
+	_, err = io.Copy(tempFile, cachedFile)
+	if err != nil {
+		return filepath, err
+	}
 
-		log.WithFields(log.Fields{
-			"elapsedTime": exp.GetElapsedTime(),
-			"retries":     retryCount,
-			"path":        filepath,
-			"url":         url,
-		}).Trace("File downloaded")
+	_ = os.Chmod(filepath, 0666)
 
-		fileReader = resp.Body
+	return filepath, nil
+}
 
-		return nil
-	}
+// getDownloadClient returns the HTTP client for the downloads, which honours the HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY environment variables, and gives up on the connections that do not
+// respond in the idle timeout
+func getDownloadClient() *http.Client {
+	downloadClientOnce.Do(func() {
+		idleTimeout := getDurationFromEnv("DOWNLOAD_IDLE_TIMEOUT", defaultDownloadIdleTimeout)
+
+		downloadClient = &http.Client{
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					KeepAlive: 30 * time.Second,
+					Timeout:   idleTimeout,
+				}).DialContext,
+				IdleConnTimeout:       90 * time.Second,
+				Proxy:                 http.ProxyFromEnvironment,
+				ResponseHeaderTimeout: idleTimeout,
+				TLSHandshakeTimeout:   idleTimeout,
+			},
+		}
+	})
 
-	log.WithFields(log.Fields{
-		"url":  url,
-		"path": filepath,
-	}).Trace("Downloading file")
+	return downloadClient
+}
 
-	err = backoff.Retry(download, exp)
-	if err != nil {
-		return "", err
+// getDurationFromEnv returns the duration set in an environment variable, i.e. 10m, or
+// a default value if it's not set or it's not valid
+func getDurationFromEnv(name string, defaultValue time.Duration) time.Duration {
+	value := curl.GetEnv(name, "")
+	if value == "" {
+		return defaultValue
 	}
-	defer fileReader.Close()
 
-	_, err = io.Copy(tempFile, fileReader)
+	d, err := time.ParseDuration(value)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"error": err,
-			"url":   url,
-			"path":  filepath,
-		}).Error("Could not write file")
-
-		return filepath, err
+			"default": defaultValue,
+			"error":   err,
+			"value":   value,
+			"env":     name,
+		}).Warn("The duration is not valid, using the default one")
+		return defaultValue
 	}
 
-	_ = os.Chmod(tempFile.Name(), 0666)
+	return d
+}
 
-	return filepath, nil
+// getDownloadOptions returns the options of the downloads, which are bounded by the DOWNLOAD_TIMEOUT
+// and DOWNLOAD_IDLE_TIMEOUT environment variables, and cancelled with the running scenario
+func getDownloadOptions() artifacts.DownloadOptions {
+	return artifacts.DownloadOptions{
+		BackOff:     GetExponentialBackOff(getDurationFromEnv("DOWNLOAD_TIMEOUT", defaultDownloadTimeout)),
+		Client:      getDownloadClient(),
+		Context:     ScenarioContext(),
+		IdleTimeout: getDurationFromEnv("DOWNLOAD_IDLE_TIMEOUT", defaultDownloadIdleTimeout),
+	}
 }
 
 //nolint:unused
@@ -441,6 +406,17 @@ func Sleep(seconds string) error {
 // WaitForProcess polls a container executing "ps" command until the process is in the desired state (present or not),
 // or a timeout happens
 func WaitForProcess(containerName string, process string, desiredState string, maxTimeout time.Duration) error {
+	outputFn := func(cmd []string) (string, error) {
+		return docker.ExecCommandIntoContainer(ScenarioContext(), containerName, "root", cmd)
+	}
+
+	return WaitForProcessInBox(containerName, outputFn, process, desiredState, maxTimeout)
+}
+
+// WaitForProcessInBox polls a box, i.e. a container or a remote host, executing "pgrep" with a function
+// returning the output of a command in the box, until the process is in the desired state (present or
+// not), or a timeout happens
+func WaitForProcessInBox(box string, outputFn func(cmd []string) (string, error), process string, desiredState string, maxTimeout time.Duration) error {
 	exp := GetExponentialBackOff(maxTimeout)
 
 	mustBePresent := false
@@ -453,19 +429,19 @@ func WaitForProcess(containerName string, process string, desiredState string, m
 		log.WithFields(log.Fields{
 			"desiredState": desiredState,
 			"process":      process,
-		}).Trace("Checking process desired state on the container")
+		}).Trace("Checking process desired state on the box")
 
-		output, err := docker.ExecCommandIntoContainer(context.Background(), containerName, "root", []string{"pgrep", "-n", "-l", "-f", process})
+		output, err := outputFn([]string{"pgrep", "-n", "-l", "-f", process})
 		if err != nil {
 			log.WithFields(log.Fields{
 				"desiredState":  desiredState,
 				"elapsedTime":   exp.GetElapsedTime(),
 				"error":         err,
-				"container":     containerName,
+				"box":           box,
 				"mustBePresent": mustBePresent,
 				"process":       process,
 				"retry":         retryCount,
-			}).Warn("Could not execute 'pgrep -n -l -f' in the container")
+			}).Warn("Could not execute 'pgrep -n -l -f' in the box")
 
 			retryCount++
 
@@ -478,7 +454,7 @@ func WaitForProcess(containerName string, process string, desiredState string, m
 		if mustBePresent == outputContainsProcess {
 			log.WithFields(log.Fields{
 				"desiredState":  desiredState,
-				"container":     containerName,
+				"box":           box,
 				"mustBePresent": mustBePresent,
 				"process":       process,
 			}).Infof("Process desired state checked")
@@ -487,12 +463,12 @@ func WaitForProcess(containerName string, process string, desiredState string, m
 		}
 
 		if mustBePresent {
-			err = fmt.Errorf("%s process is not running in the container yet", process)
+			err = fmt.Errorf("%s process is not running in the box yet", process)
 			log.WithFields(log.Fields{
 				"desiredState": desiredState,
 				"elapsedTime":  exp.GetElapsedTime(),
 				"error":        err,
-				"container":    containerName,
+				"box":          box,
 				"process":      process,
 				"retry":        retryCount,
 			}).Warn(err.Error())
@@ -502,11 +478,11 @@ func WaitForProcess(containerName string, process string, desiredState string, m
 			return err
 		}
 
-		err = fmt.Errorf("%s process is still running in the container", process)
+		err = fmt.Errorf("%s process is still running in the box", process)
 		log.WithFields(log.Fields{
 			"elapsedTime": exp.GetElapsedTime(),
 			"error":       err,
-			"container":   containerName,
+			"box":         box,
 			"process":     process,
 			"state":       desiredState,
 			"retry":       retryCount,
@@ -524,3 +500,97 @@ func WaitForProcess(containerName string, process string, desiredState string, m
 
 	return nil
 }
+
+// ListProcessesCmd the command listing the command lines of the processes of a box, in a line each
+var ListProcessesCmd = []string{"ps", "-eo", "args="}
+
+// RunningProcesses returns which processes are running, from the output of a command listing the
+// processes of a box in a line each, i.e. their command lines or their names. A process is running
+// if the executable of a line is named as the process
+func RunningProcesses(output string, processes []string) map[string]bool {
+	running := map[string]bool{}
+	for _, process := range processes {
+		running[process] = false
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		executable := strings.TrimSuffix(path.Base(strings.ReplaceAll(fields[0], "\\", "/")), ".exe")
+		if _, exists := running[executable]; exists {
+			running[executable] = true
+		}
+	}
+
+	return running
+}
+
+// WaitForProcessesInBox polls a box, i.e. a container or a remote host, listing its processes with a
+// function returning the output of a command in the box, until all the processes are in their
+// desired state (started or stopped), or a timeout happens. The processes are listed once per
+// retry, so that the states are checked at the same time
+func WaitForProcessesInBox(box string, outputFn func(cmd []string) (string, error), desiredStates map[string]string, maxTimeout time.Duration) error {
+	exp := GetExponentialBackOff(maxTimeout)
+
+	processes := []string{}
+	for process := range desiredStates {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+
+	retryCount := 1
+
+	processesStatus := func() error {
+		output, err := outputFn(ListProcessesCmd)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"box":         box,
+				"elapsedTime": exp.GetElapsedTime(),
+				"error":       err,
+				"processes":   processes,
+				"retry":       retryCount,
+			}).Warn("Could not list the processes of the box")
+
+			retryCount++
+
+			return err
+		}
+
+		running := RunningProcesses(output, processes)
+
+		wrong := []string{}
+		for _, process := range processes {
+			if running[process] != (desiredStates[process] == "started") {
+				wrong = append(wrong, process)
+			}
+		}
+
+		if len(wrong) == 0 {
+			log.WithFields(log.Fields{
+				"box":           box,
+				"desiredStates": desiredStates,
+			}).Info("Processes desired states checked")
+
+			return nil
+		}
+
+		err = fmt.Errorf("%s processes are not in the desired state in the box yet", strings.Join(wrong, ", "))
+		log.WithFields(log.Fields{
+			"box":           box,
+			"desiredStates": desiredStates,
+			"elapsedTime":   exp.GetElapsedTime(),
+			"error":         err,
+			"retry":         retryCount,
+			"running":       running,
+		}).Warn(err.Error())
+
+		retryCount++
+
+		return err
+	}
+
+	return backoff.Retry(processesStatus, exp)
+}
@@ -0,0 +1,158 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package e2e
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/e2e-testing/cli/shell"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// the named timeouts of the waits of the steps, which can be overridden for slow environments
+// without changing the steps
+const (
+	AgentEnrollTimeout   = "agent-enroll"   // an agent listed in Fleet with a status or a version
+	DataInIndexTimeout   = "data-in-index"  // the documents of an agent or a service in an index
+	PolicyAppliedTimeout = "policy-applied" // a change of a policy applied by its agents
+)
+
+// WaitTimeoutsFileEnvVar the environment variable setting the YAML file with the named timeouts of
+// the waits and their multiplier
+const WaitTimeoutsFileEnvVar = "WAIT_TIMEOUTS_FILE"
+
+// WaitTimeoutMultiplierEnvVar the environment variable setting the multiplier of all the timeouts
+// of the waits, i.e. 1.5 for slow CI machines, overriding the one of the file
+const WaitTimeoutMultiplierEnvVar = "WAIT_TIMEOUT_MULTIPLIER"
+
+// waitTimeoutEnvVarPrefix prefix of the environment variables overriding a named timeout, i.e.
+// WAIT_TIMEOUT_AGENT_ENROLL=5m
+const waitTimeoutEnvVarPrefix = "WAIT_TIMEOUT_"
+
+// waitTimeoutsFile the file with the named timeouts of the waits, i.e.
+//
+//	multiplier: 2
+//	timeouts:
+//	  agent-enroll: 5m
+//	  data-in-index: 10m
+type waitTimeoutsFile struct {
+	Multiplier float64           `yaml:"multiplier"`
+	Timeouts   map[string]string `yaml:"timeouts"`
+}
+
+var waitTimeouts *waitTimeoutsFile
+var waitTimeoutsOnce sync.Once
+
+// GetWaitTimeout returns the max time a step waits for a named condition, i.e. agent-enroll: the
+// timeout set in the WAIT_TIMEOUT_<NAME> environment variable, in the file of the timeouts, or the
+// default timeout of the step otherwise, multiplied by the multiplier of the timeouts
+func GetWaitTimeout(name string, defaultTimeout time.Duration) time.Duration {
+	file := getWaitTimeoutsFile()
+
+	timeout := defaultTimeout
+	if value, exists := file.Timeouts[name]; exists {
+		timeout = parseWaitTimeout(name, value, timeout)
+	}
+
+	envVar := waitTimeoutEnvVarPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if value := shell.GetEnv(envVar, ""); value != "" {
+		timeout = parseWaitTimeout(envVar, value, timeout)
+	}
+
+	multiplier := file.Multiplier
+	if value := shell.GetEnv(WaitTimeoutMultiplierEnvVar, ""); value != "" {
+		m, err := strconv.ParseFloat(value, 64)
+		if err != nil || m <= 0 {
+			log.WithFields(log.Fields{
+				"error":      err,
+				"multiplier": value,
+			}).Warn(WaitTimeoutMultiplierEnvVar + " is not a positive number, it will be ignored")
+		} else {
+			multiplier = m
+		}
+	}
+
+	if multiplier > 0 {
+		timeout = time.Duration(float64(timeout) * multiplier)
+	}
+
+	log.WithFields(log.Fields{
+		"default": defaultTimeout,
+		"name":    name,
+		"timeout": timeout,
+	}).Trace("Timeout of the wait resolved")
+
+	return timeout
+}
+
+// getWaitTimeoutsFile returns the file of the timeouts set in the WAIT_TIMEOUTS_FILE environment
+// variable, which is read once. The file is ignored if it cannot be read
+func getWaitTimeoutsFile() *waitTimeoutsFile {
+	waitTimeoutsOnce.Do(func() {
+		waitTimeouts = &waitTimeoutsFile{}
+
+		path := shell.GetEnv(WaitTimeoutsFileEnvVar, "")
+		if path == "" {
+			return
+		}
+
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  path,
+			}).Warn("Could not read the file of the timeouts of the waits, it will be ignored")
+			return
+		}
+
+		file := waitTimeoutsFile{}
+		err = yaml.Unmarshal(bytes, &file)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"file":  path,
+			}).Warn("Could not parse the file of the timeouts of the waits, it will be ignored")
+			return
+		}
+
+		if file.Multiplier < 0 {
+			log.WithFields(log.Fields{
+				"file":       path,
+				"multiplier": file.Multiplier,
+			}).Warn("The multiplier of the timeouts is negative, it will be ignored")
+			file.Multiplier = 0
+		}
+
+		waitTimeouts = &file
+
+		log.WithFields(log.Fields{
+			"file":       path,
+			"multiplier": file.Multiplier,
+			"timeouts":   file.Timeouts,
+		}).Debug("Timeouts of the waits read")
+	})
+
+	return waitTimeouts
+}
+
+// parseWaitTimeout parses the duration of a timeout, i.e. 5m, returning the fallback if it's not valid
+func parseWaitTimeout(source string, value string, fallback time.Duration) time.Duration {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"source":  source,
+			"timeout": value,
+		}).Warn("The timeout is not a positive duration, it will be ignored")
+		return fallback
+	}
+
+	return timeout
+}